@@ -0,0 +1,104 @@
+package dom
+
+import (
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+)
+
+// --- Box-tree seeds -------------------------------------------------------------
+
+// BoxSeed is the information a layout engine needs to create a box for a node
+// of a styled document. Seeds are produced by BoxSeeds.
+//
+// Element seeds carry the layout hints of the element (see LayoutHint), i.e. its
+// display mode and whether it establishes a new formatting context. Text seeds
+// carry the content of a text node as runs of normalized text (see
+// css.SegmentText), with white space handled according to the text's
+// white-space mode. Text seeds are inline-level and in-flow, and inherit
+// visibility from their parent.
+type BoxSeed struct {
+	Node    *W3CNode
+	Depth   int               // depth of the box within the box tree, the first seed has depth 0
+	Layout  LayoutHints       // display mode and formatting context of the box
+	Text    []css.TextSegment // text runs of a text node, nil for elements
+	Foreign string            // namespace of a foreign-content root ("svg" or "math"), if any
+}
+
+// IsText is a predicate wether a seed has been created for a text node.
+func (seed BoxSeed) IsText() bool {
+	return seed.Node.NodeType() == html.TextNode
+}
+
+// BoxSeeds flattens the styled tree below w (including w) into a list of box
+// seeds, in document order. It is the contract between the DOM and layout
+// engines: a layout engine may build its box tree from the seeds alone, without
+// having to interpret display, float, position or white-space properties on its
+// own. The box tree is defined by the depths of the seeds; every seed is a
+// child of the nearest seed before it with a lower depth.
+//
+// If w is a document node, seeds start with the document element. Seeds are
+// created for elements and for text nodes, with the following exceptions:
+//
+//     - elements with display: none are skipped, together with their descendents
+//     - text nodes without any text are skipped
+//     - the descendents of a foreign-content root (see styledtree.StyNode.ForeignContent)
+//       are skipped, as foreign content has to be laid out by a dedicated engine
+//
+// Comments (even if preserved, see DocumentOptions) and other nodes which do not
+// generate boxes do not produce seeds. If w is nil, nil is returned.
+func BoxSeeds(w *W3CNode) []BoxSeed {
+	if w == nil {
+		return nil
+	}
+	tn, ok := NodeAsTreeNode(w)
+	if !ok {
+		return nil
+	}
+	var seeds []BoxSeed
+	if w.IsDocument() {
+		for _, ch := range tn.Children(true) {
+			seeds = appendSeeds(seeds, ch, 0, true)
+		}
+		return seeds
+	}
+	return appendSeeds(seeds, tn, 0, true)
+}
+
+// appendSeeds appends the seeds for the subtree of tn to seeds. visible is the
+// visibility of the parent box, inherited by text seeds.
+func appendSeeds(seeds []BoxSeed, tn *tree.Node[*styledtree.StyNode], depth int, visible bool) []BoxSeed {
+	w := domify(tn)
+	switch w.NodeType() {
+	case html.TextNode:
+		segments := css.SegmentText(tn.Payload)
+		if len(segments) == 0 {
+			return seeds
+		}
+		return append(seeds, BoxSeed{
+			Node:  w,
+			Depth: depth,
+			Layout: LayoutHints{
+				Outer:   css.InlineMode,
+				InFlow:  true,
+				Visible: visible,
+			},
+			Text: segments,
+		})
+	case html.ElementNode:
+		hints := LayoutHint(w)
+		if hints.Outer == css.DisplayNone {
+			return seeds
+		}
+		seed := BoxSeed{Node: w, Depth: depth, Layout: hints, Foreign: tn.Payload.ForeignContent()}
+		seeds = append(seeds, seed)
+		if seed.Foreign != "" {
+			return seeds
+		}
+		for _, ch := range tn.Children(true) {
+			seeds = appendSeeds(seeds, ch, depth+1, hints.Visible)
+		}
+	}
+	return seeds
+}
@@ -0,0 +1,367 @@
+package dom
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// --- Document -------------------------------------------------------------------
+
+// W3CDocument wraps the document node of a DOM and provides access to
+// document-level information, like the doctype, the <head> and <body> elements
+// and the rendering mode.
+type W3CDocument struct {
+	*W3CNode
+	doctype *DocumentType
+	mode    DocumentMode
+	options DocumentOptions
+}
+
+// DocumentType holds the information of a <!DOCTYPE …> declaration.
+type DocumentType struct {
+	Name     string // e.g., "html"
+	PublicID string // public identifier, empty if not present
+	SystemID string // system identifier, empty if not present
+}
+
+// DocumentMode is the rendering mode of a document, detected from its doctype.
+// See https://html.spec.whatwg.org/multipage/parsing.html#the-initial-insertion-mode
+type DocumentMode uint8
+
+// Document modes, ordered from legacy to standards mode.
+const (
+	QuirksMode        DocumentMode = iota // no doctype or legacy doctype
+	LimitedQuirksMode                     // transitional doctypes of HTML 4.01 and XHTML 1.0
+	NoQuirksMode                          // standards mode, e.g. for <!DOCTYPE html>
+)
+
+func (mode DocumentMode) String() string {
+	switch mode {
+	case QuirksMode:
+		return "quirks"
+	case LimitedQuirksMode:
+		return "limited-quirks"
+	}
+	return "no-quirks"
+}
+
+// OwnerDocument returns the document w belongs to. Other than the W3C DOM
+// property, it returns the document for the document node itself. If w is not
+// connected to a document node, nil is returned.
+func (w *W3CNode) OwnerDocument() *W3CDocument {
+	for n := w; n != nil; {
+		if n.IsDocument() {
+			return documentFor(n)
+		}
+		p, ok := n.ParentNode().(*W3CNode)
+		if !ok {
+			break
+		}
+		n = p
+	}
+	return nil
+}
+
+// documentFor creates a document wrapper for a document node.
+func documentFor(w *W3CNode) *W3CDocument {
+	doc := &W3CDocument{W3CNode: w}
+	if opts, ok := w.Index().Data().(DocumentOptions); ok {
+		doc.options = opts
+	}
+	for h := w.HTMLNode().FirstChild; h != nil; h = h.NextSibling {
+		if h.Type == html.DoctypeNode {
+			doc.doctype = doctypeOf(h)
+			break
+		}
+	}
+	doc.mode = modeFromDoctype(doc.doctype)
+	if doc.options.OverrideMode {
+		doc.mode = doc.options.Mode
+	}
+	return doc
+}
+
+func doctypeOf(h *html.Node) *DocumentType {
+	dt := &DocumentType{Name: h.Data}
+	for _, attr := range h.Attr {
+		switch attr.Key {
+		case "public":
+			dt.PublicID = attr.Val
+		case "system":
+			dt.SystemID = attr.Val
+		}
+	}
+	return dt
+}
+
+// Doctype returns the doctype declaration of the document, or nil if the
+// document does not have one.
+func (doc *W3CDocument) Doctype() *DocumentType {
+	if doc == nil {
+		return nil
+	}
+	return doc.doctype
+}
+
+// Mode returns the rendering mode of the document, as detected from its doctype
+// or as set by the options of the document (see DocumentOptions.OverrideMode).
+func (doc *W3CDocument) Mode() DocumentMode {
+	if doc == nil {
+		return NoQuirksMode
+	}
+	return doc.mode
+}
+
+// IsQuirksMode is a predicate wether the document is rendered in quirks mode.
+// Documents in limited quirks mode are not considered to be in quirks mode.
+func (doc *W3CDocument) IsQuirksMode() bool {
+	return doc.Mode() == QuirksMode
+}
+
+// DocumentElement returns the <html> element of the document, or nil.
+func (doc *W3CDocument) DocumentElement() *W3CNode {
+	if doc == nil {
+		return nil
+	}
+	return childElement(doc.W3CNode, atom.Html)
+}
+
+// Head returns the <head> element of the document, or nil.
+func (doc *W3CDocument) Head() *W3CNode {
+	return childElement(doc.DocumentElement(), atom.Head)
+}
+
+// Body returns the <body> element of the document, or nil.
+func (doc *W3CDocument) Body() *W3CNode {
+	return childElement(doc.DocumentElement(), atom.Body)
+}
+
+// Title returns the text of the <title> element of the document, with
+// white space collapsed. If the document has no title, an empty string is
+// returned.
+func (doc *W3CDocument) Title() string {
+	title := childElement(doc.Head(), atom.Title)
+	if title == nil {
+		return ""
+	}
+	var b strings.Builder
+	for h := title.HTMLNode().FirstChild; h != nil; h = h.NextSibling {
+		if h.Type == html.TextNode {
+			b.WriteString(h.Data)
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Charset returns the character encoding declared by a <meta> element of the
+// document, either by a charset attribute or by an http-equiv="content-type"
+// pragma. The encoding is returned in lower case. If no encoding is declared,
+// an empty string is returned.
+func (doc *W3CDocument) Charset() string {
+	head := doc.Head()
+	if head == nil {
+		return ""
+	}
+	for h := head.HTMLNode().FirstChild; h != nil; h = h.NextSibling {
+		if h.Type != html.ElementNode || h.DataAtom != atom.Meta {
+			continue
+		}
+		if cs := attributeValue(h, "charset"); cs != "" {
+			return strings.ToLower(strings.TrimSpace(cs))
+		}
+		if strings.EqualFold(attributeValue(h, "http-equiv"), "content-type") {
+			content := strings.ToLower(attributeValue(h, "content"))
+			if i := strings.Index(content, "charset="); i >= 0 {
+				cs := strings.Trim(content[i+len("charset="):], ` "';`)
+				return strings.TrimSpace(strings.SplitN(cs, ";", 2)[0])
+			}
+		}
+	}
+	return ""
+}
+
+// --- Document options -----------------------------------------------------------
+
+// DocumentOptions configure the creation of a DOM, see FromHTMLParseTreeWithOptions.
+// The options are kept with the DOM and are available from the owner document of
+// its nodes. The zero value describes a document without a known location, which
+// honors <base> elements and has been parsed with scripting enabled, as is the
+// default for html.Parse.
+//
+// With scripting enabled, html.Parse stores the content of <noscript> elements as
+// raw text, and <noscript> elements are hidden by a user-agent style rule. Clients
+// treating scripting as disabled should parse the document with
+// html.ParseOptionEnableScripting(false), for the content of <noscript> elements
+// to be parsed as markup and rendered like any other content.
+type DocumentOptions struct {
+	BaseURL           *url.URL     // location of the document, for resolving relative URLs; may be nil
+	IgnoreBaseElement bool         // do not let a <base href="…"> element override BaseURL
+	ScriptingDisabled bool         // treat scripting as disabled, i.e. show <noscript>
+	PreserveComments  bool         // keep comment nodes in the DOM
+	OverrideMode      bool         // use Mode instead of the mode detected from the doctype
+	Mode              DocumentMode // rendering mode, if OverrideMode is set
+}
+
+// Options returns the options the document has been created with. For documents
+// not created by FromHTMLParseTreeWithOptions, the zero value is returned.
+func (doc *W3CDocument) Options() DocumentOptions {
+	if doc == nil {
+		return DocumentOptions{}
+	}
+	return doc.options
+}
+
+// BaseURL returns the URL to resolve relative URLs of the document against. It is
+// the href of the first <base> element of the document, resolved against the
+// BaseURL of the document options, unless the options demand to ignore <base>
+// elements. Lacking a <base> element, the BaseURL of the options is returned,
+// which may be nil.
+func (doc *W3CDocument) BaseURL() *url.URL {
+	if doc == nil {
+		return nil
+	}
+	fallback := doc.options.BaseURL
+	if doc.options.IgnoreBaseElement {
+		return fallback
+	}
+	tn, ok := NodeAsTreeNode(doc.W3CNode)
+	if !ok {
+		return fallback
+	}
+	var base *url.URL
+	found := false
+	walkElements(tn, func(n *tree.Node[*styledtree.StyNode], h *html.Node) {
+		if found || h.Namespace != "" || h.DataAtom != atom.Base {
+			return
+		}
+		href, ok := n.Payload.Attribute("href")
+		if !ok {
+			return
+		}
+		found = true // only the first <base> element with an href counts
+		if u, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			base = u
+			if fallback != nil {
+				base = fallback.ResolveReference(u)
+			}
+		}
+	})
+	if base == nil {
+		return fallback
+	}
+	return base
+}
+
+// ResolveURL resolves a URL reference of the document, e.g. the value of an href
+// or src attribute, against the base URL of the document (see BaseURL). If the
+// document does not have a base URL, the reference is returned unresolved.
+func (doc *W3CDocument) ResolveURL(ref string) (*url.URL, error) {
+	return resolveURL(doc.BaseURL(), ref)
+}
+
+func resolveURL(base *url.URL, ref string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || base == nil {
+		return u, err
+	}
+	return base.ResolveReference(u), nil
+}
+
+// childElement returns the first child element of w with the given atom, or nil.
+func childElement(w *W3CNode, a atom.Atom) *W3CNode {
+	if w == nil {
+		return nil
+	}
+	tn, ok := NodeAsTreeNode(w)
+	if !ok {
+		return nil
+	}
+	for _, ch := range tn.Children(true) {
+		if h := ch.Payload.HTMLNode(); h.Type == html.ElementNode && h.DataAtom == a {
+			return domify(ch)
+		}
+	}
+	return nil
+}
+
+func attributeValue(h *html.Node, key string) string {
+	for _, attr := range h.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// --- Quirks mode detection ------------------------------------------------------
+
+// Public identifiers of doctypes triggering quirks mode, in lower case. Entries
+// ending in '/' or ' ' are prefixes, others have to match exactly.
+var quirksPublicIDs = []string{
+	"+//silmaril//dtd html pro v0r11 19970101//",
+	"-//advasoft ltd//dtd html 3.0 aswedit + extensions//",
+	"-//as//dtd html 3.0 aswedit + extensions//",
+	"-//ietf//dtd html ",
+	"-//ietf//dtd html//",
+	"-//metrius//dtd metrius presentational//",
+	"-//microsoft//dtd internet explorer ",
+	"-//netscape comm. corp.//dtd ",
+	"-//o'reilly and associates//dtd html ",
+	"-//softquad software//dtd hotmetal pro 6.0::19990601::extensions to html 4.0//",
+	"-//softquad//dtd hotmetal pro 4.0::19971010::extensions to html 4.0//",
+	"-//spyglass//dtd html 2.0 extended//",
+	"-//sq//dtd html 2.0 hotmetal + extensions//",
+	"-//sun microsystems corp.//dtd hotjava ",
+	"-//w3c//dtd html 3 1995-03-24//",
+	"-//w3c//dtd html 3.2 draft//",
+	"-//w3c//dtd html 3.2 final//",
+	"-//w3c//dtd html 3.2//",
+	"-//w3c//dtd html 3.2s draft//",
+	"-//w3c//dtd html 4.0 frameset//",
+	"-//w3c//dtd html 4.0 transitional//",
+	"-//w3c//dtd html experimental 19960712//",
+	"-//w3c//dtd html experimental 970421//",
+	"-//w3c//dtd w3 html//",
+	"-//w3o//dtd w3 html 3.0//",
+	"-//webtechs//dtd mozilla html 2.0//",
+	"-//webtechs//dtd mozilla html//",
+	"-//w3o//dtd w3 html strict 3.0//en//",
+	"-/w3c/dtd html 4.0 transitional/en",
+	"html",
+}
+
+// modeFromDoctype detects the rendering mode of a document, following the
+// rules of the HTML parsing algorithm.
+func modeFromDoctype(dt *DocumentType) DocumentMode {
+	if dt == nil || !strings.EqualFold(dt.Name, "html") {
+		return QuirksMode
+	}
+	public, system := strings.ToLower(dt.PublicID), strings.ToLower(dt.SystemID)
+	for _, id := range quirksPublicIDs {
+		if strings.HasSuffix(id, "/") || strings.HasSuffix(id, " ") {
+			if strings.HasPrefix(public, id) {
+				return QuirksMode
+			}
+		} else if public == id {
+			return QuirksMode
+		}
+	}
+	if system == "http://www.ibm.com/data/dtd/v11/ibmxhtml1-transitional.dtd" {
+		return QuirksMode
+	}
+	html401 := strings.HasPrefix(public, "-//w3c//dtd html 4.01 frameset//") ||
+		strings.HasPrefix(public, "-//w3c//dtd html 4.01 transitional//")
+	if html401 && dt.SystemID == "" {
+		return QuirksMode
+	}
+	if html401 || strings.HasPrefix(public, "-//w3c//dtd xhtml 1.0 frameset//") ||
+		strings.HasPrefix(public, "-//w3c//dtd xhtml 1.0 transitional//") {
+		return LimitedQuirksMode
+	}
+	return NoQuirksMode
+}
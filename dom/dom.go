@@ -3,6 +3,8 @@ package dom
 import (
 	"bytes"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/npillmayer/fp/dom/style"
 	"github.com/npillmayer/fp/dom/style/css"
@@ -99,6 +101,7 @@ func (w *W3CNode) NodeType() html.NodeType {
 //      Document     "#document"
 //      Element      The value of Element.TagName
 //      Text         "#text"
+//      Comment      "#comment"
 //
 func (w *W3CNode) NodeName() string {
 	if w == nil {
@@ -112,23 +115,58 @@ func (w *W3CNode) NodeName() string {
 		return h.Data
 	case html.TextNode:
 		return "#text"
+	case html.CommentNode:
+		return "#comment"
 	}
 	return "<node>"
 }
 
-// NodeValue returns textual content for text/CData-Nodes, and an empty string for any other
+// NodeValue returns textual content for text/CData- and comment-Nodes, and an empty string for any other
 // Node type.
 func (w *W3CNode) NodeValue() string {
 	if w == nil {
 		return ""
 	}
 	h := w.HTMLNode()
-	if h.Type == html.TextNode {
+	if h.Type == html.TextNode || h.Type == html.CommentNode {
 		return h.Data
 	}
 	return ""
 }
 
+// NamespaceURI returns the namespace URI of an element: w3cdom.SVGNamespace for
+// inline SVG, w3cdom.MathMLNamespace for MathML and w3cdom.HTMLNamespace for
+// all other elements. For other node types, an empty string is returned.
+func (w *W3CNode) NamespaceURI() string {
+	if w == nil || w.HTMLNode().Type != html.ElementNode {
+		return ""
+	}
+	switch w.HTMLNode().Namespace {
+	case cssom.NamespaceHTML:
+		return w3cdom.HTMLNamespace
+	case cssom.NamespaceSVG:
+		return w3cdom.SVGNamespace
+	case cssom.NamespaceMathML:
+		return w3cdom.MathMLNamespace
+	}
+	return ""
+}
+
+// LocalName returns the name of an element, or an empty string for other node
+// types. Names of SVG elements keep their case, e.g. "foreignObject".
+func (w *W3CNode) LocalName() string {
+	if w == nil || w.HTMLNode().Type != html.ElementNode {
+		return ""
+	}
+	return w.HTMLNode().Data
+}
+
+// Prefix returns an empty string, as the HTML parser does not keep namespace
+// prefixes of elements.
+func (w *W3CNode) Prefix() string {
+	return ""
+}
+
 // HasAttributes returns a boolean indicating whether the current element has any
 // attributes or not.
 func (w *W3CNode) HasAttributes() bool {
@@ -165,7 +203,7 @@ func (w *W3CNode) HasChildNodes() bool {
 	}
 	tn, ok := NodeAsTreeNode(w)
 	if ok {
-		return tn.ChildCount() > 0
+		return len(tn.ChildSlots()) > 0 // ignore empty slots left by removed children
 	}
 	return false
 }
@@ -176,39 +214,18 @@ func (w *W3CNode) ChildNodes() w3cdom.NodeList {
 	if w == nil {
 		return nil
 	}
-	tn, ok := NodeAsTreeNode(w)
-	if ok {
-		children := tn.Children(true)
-		childnodes := make([]*W3CNode, len(children))
-		for i, ch := range children {
-			childnodes[i] = &W3CNode{styledtree.Node(ch)}
-		}
-		return &W3CNodeList{childnodes}
-	}
-	return nil
+	return LiveNodeList(w, nil)
 }
 
-// Children is a read-only property that returns a node list which contains all of
-// the child *elements* of the node upon which it was called
+// Children is a read-only property that returns a live node list which contains
+// all of the child *elements* of the node upon which it was called
 func (w *W3CNode) Children() w3cdom.NodeList {
 	if w == nil {
 		return nil
 	}
-	tn, ok := NodeAsTreeNode(w)
-	if ok {
-		children := tn.Children(true)
-		childnodes := make([]*W3CNode, len(children))
-		j := 0
-		for _, ch := range children {
-			sn := styledtree.Node(ch)
-			if sn.HTMLNode().Type == html.ElementNode {
-				childnodes[j] = &W3CNode{sn}
-				j++
-			}
-		}
-		return &W3CNodeList{childnodes}
-	}
-	return nil
+	return LiveNodeList(w, func(ch *W3CNode) bool {
+		return ch.HTMLNode().Type == html.ElementNode
+	})
 }
 
 // FirstChild read-only property returns the node's first child in the tree,
@@ -296,6 +313,95 @@ func (w *W3CNode) ComputedStyles() w3cdom.ComputedStyles {
 	return &computedStyles{w, w.Styles()}
 }
 
+// CascadedValue resolves the value of a style property for w. Inherited properties
+// cascade to the styles of ancestors, non-inherited properties fall back to their
+// initial value. CSS keywords "inherit", "initial" and "unset" are respected.
+//
+// If w is nil or the property is unknown, NullStyle is returned.
+func (w *W3CNode) CascadedValue(key string) style.Property {
+	if w == nil {
+		return style.NullStyle
+	}
+	return css.ResolveProperty(w.StyNode, key)
+}
+
+// CloneSubtree returns a duplicate of the node. If deep is set, the copy will
+// include all descendents of the node, otherwise it is a single, childless node.
+// The copy is not connected to a parent.
+func (w *W3CNode) CloneSubtree(deep bool) *W3CNode {
+	if w == nil {
+		return nil
+	}
+	return domify(w.StyNode.CloneSubtree(deep))
+}
+
+// AdoptNode re-parents node n (together with its descendents) and appends it as the
+// last child of w. n may belong to a different DOM, e.g., when assembling a book
+// from per-chapter documents. n is removed from its former parent, if any, and its
+// style context is re-computed to cascade to the new ancestors.
+//
+// Clients wishing to keep the original document unmodified should adopt a clone
+// of n (see CloneSubtree). AdoptNode returns the adopted node.
+func (w *W3CNode) AdoptNode(n *W3CNode) (*W3CNode, error) {
+	if w == nil || n == nil {
+		return nil, ErrNotAStyledNode
+	}
+	if w.NodeType() != html.ElementNode && w.NodeType() != html.DocumentNode {
+		return nil, ErrCannotAdopt
+	}
+	if w.CheckChild(&n.Node) != nil {
+		return nil, ErrCannotAdopt // n is w or an ancestor of w
+	}
+	w.StyNode.AdoptSubtree(&n.Node)
+	return n, nil
+}
+
+// RemoveChild removes ch, a child of w, together with its descendents, both from
+// the DOM and from the underlying HTML parse tree. Removed nodes lose their IDs
+// (see NodeByID). RemoveChild returns the removed node, or ErrNotAChild if ch is
+// not a child of w.
+func (w *W3CNode) RemoveChild(ch *W3CNode) (*W3CNode, error) {
+	if w == nil || ch == nil {
+		return nil, ErrNotAStyledNode
+	}
+	if !w.StyNode.RemoveSubtree(&ch.Node) {
+		return nil, ErrNotAChild
+	}
+	return ch, nil
+}
+
+// Normalize merges adjacent text nodes of the subtree of w and removes empty
+// text nodes, both in the DOM and in the underlying HTML parse tree. Clients
+// should normalize after assembling a document from parts (see AdoptNode),
+// as white-space processing and selectors like :empty expect a normalized tree.
+func (w *W3CNode) Normalize() {
+	if w == nil {
+		return
+	}
+	w.StyNode.Normalize()
+}
+
+// NodeByID returns the node with the given ID, if it belongs to the same document
+// as w. IDs are assigned to DOM nodes during styling; they are stable for the
+// lifetime of a document and may be used by clients to refer to DOM nodes
+// without holding on to them. Returns nil if id is unknown.
+func (w *W3CNode) NodeByID(id styledtree.NodeID) *W3CNode {
+	if w == nil {
+		return nil
+	}
+	if sn, ok := w.StyNode.Index().Lookup(id); ok {
+		return &W3CNode{sn}
+	}
+	return nil
+}
+
+// ErrCannotAdopt is returned if a node cannot be adopted by a DOM node, either because
+// the target node cannot have children or because the adoption would create a cycle.
+var ErrCannotAdopt = fmt.Errorf("Node cannot be adopted at this position")
+
+// ErrNotAChild is returned if a node to remove is not a child of a DOM node.
+var ErrNotAChild = fmt.Errorf("Node is not a child of this node")
+
 // --- computed styles -------------------------------------------------------
 
 // computedStyles is a little proxy type for a node's styles.
@@ -347,7 +453,7 @@ func (cstyles *computedStyles) GetPropertyValue(key string) style.Property {
 		return style.NullStyle
 	}
 	//p, err := css.GetProperty(cstyles.domnode.AsStyler(), key)
-	p, err := css.GetProperty(cstyles.domnode.StyNode, key)
+	p, err := css.GetComputedProperty(cstyles.domnode.StyNode, key)
 	if err != nil {
 		tracer().Errorf("W3C node styles: %v", err)
 		//return cstyles.propsMap.GetPropertyValue(key, node, styler)
@@ -356,6 +462,92 @@ func (cstyles *computedStyles) GetPropertyValue(key string) style.Property {
 	return p
 }
 
+// --- Style declaration ---------------------------------------------------------
+
+// Style returns a mutable view of the styles of an element node, similar to
+// W3C's CSSStyleDeclaration. Modifications write through to the node's
+// property map and mark the node as dirty (see styledtree.StyNode.IsDirty).
+//
+// The style declaration is live, i.e. it reflects subsequent modifications
+// of the node's styles.
+func (w *W3CNode) Style() w3cdom.StyleDeclaration {
+	if w == nil {
+		return nil
+	}
+	return &styleDeclaration{w}
+}
+
+// styleDeclaration is a proxy type for modifying a node's styles.
+type styleDeclaration struct {
+	domnode *W3CNode
+}
+
+var _ w3cdom.StyleDeclaration = &styleDeclaration{}
+
+// Styles returns the underlying style.PropertyMap.
+func (decl *styleDeclaration) Styles() *style.PropertyMap {
+	return decl.domnode.Styles()
+}
+
+// GetPropertyValue returns the property value for a given key.
+// If the property could not be found, NullStyle is returned.
+func (decl *styleDeclaration) GetPropertyValue(key string) style.Property {
+	cstyles := &computedStyles{decl.domnode, decl.domnode.Styles()}
+	return cstyles.GetPropertyValue(key)
+}
+
+// GetPropertyPriority returns "important" if a property has been set as
+// important with SetProperty, and "" otherwise.
+func (decl *styleDeclaration) GetPropertyPriority(key string) string {
+	if decl.domnode.StyNode.PropertyIsImportant(key) {
+		return "important"
+	}
+	return ""
+}
+
+// SetProperty sets the value of a style property. Compound properties, e.g.
+// "margin", are split up into their individual properties. As with W3C's
+// CSSStyleDeclaration, setting an empty value removes the property.
+//
+// Only element nodes may be styled; for other nodes ErrNotAStyledNode is
+// returned.
+func (decl *styleDeclaration) SetProperty(key string, value style.Property, important bool) error {
+	if decl.domnode.NodeType() != html.ElementNode {
+		return ErrNotAStyledNode
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	if key == "" {
+		return fmt.Errorf("Style property key is empty")
+	}
+	if value.IsEmpty() {
+		decl.RemoveProperty(key)
+		return nil
+	}
+	props, err := style.SplitCompoundProperty(key, value)
+	if err != nil { // not a compound property
+		props = []style.KeyValue{{Key: key, Value: value}}
+	}
+	for _, kv := range props {
+		decl.domnode.StyNode.SetProperty(kv.Key, kv.Value, important)
+	}
+	return nil
+}
+
+// RemoveProperty removes a style property, returning its former value.
+// Shorthand properties, e.g. "border", are removed by removing their individual
+// properties (see style.Longhands), returning NullStyle.
+func (decl *styleDeclaration) RemoveProperty(key string) style.Property {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if keys := style.Longhands(key); keys != nil {
+		for _, k := range keys {
+			decl.domnode.StyNode.RemoveProperty(k)
+		}
+		decl.domnode.StyNode.RemoveProperty(key) // may have been set without splitting
+		return style.NullStyle
+	}
+	return decl.domnode.StyNode.RemoveProperty(key)
+}
+
 // --- Attributes -----------------------------------------------------------------
 
 // A W3CAttr represents a single attribute of an element Node.
@@ -370,6 +562,55 @@ func (a *W3CAttr) Namespace() string {
 	return a.attr.Namespace
 }
 
+// NamespaceURI returns the namespace URI of an attribute, which is empty for
+// attributes without a prefix.
+func (a *W3CAttr) NamespaceURI() string {
+	if a == nil {
+		return ""
+	}
+	return attrNamespaceURI(a.attr.Namespace)
+}
+
+// LocalName returns the name of an attribute without its prefix.
+func (a *W3CAttr) LocalName() string {
+	if a == nil {
+		return ""
+	}
+	return a.attr.Key
+}
+
+// Prefix returns the namespace prefix of an attribute, e.g. "xlink" for
+// attribute xlink:href. The HTML parser keeps prefixes of attributes of foreign
+// elements only, i.e. for xlink, xml and xmlns.
+func (a *W3CAttr) Prefix() string {
+	if a == nil {
+		return ""
+	}
+	return a.attr.Namespace
+}
+
+// attrNamespaceURI maps the namespace prefixes the HTML parser sets for
+// attributes of foreign elements to namespace URIs.
+func attrNamespaceURI(prefix string) string {
+	switch prefix {
+	case "xlink":
+		return w3cdom.XLinkNamespace
+	case "xml":
+		return w3cdom.XMLNamespace
+	case "xmlns":
+		return w3cdom.XMLNSNamespace
+	}
+	return ""
+}
+
+// qualifiedName returns the name of an attribute including its prefix, if any.
+func qualifiedName(a *html.Attribute) string {
+	if a.Namespace == "" {
+		return a.Key
+	}
+	return a.Namespace + ":" + a.Key
+}
+
 // Key is the name of an attribute.
 func (a *W3CAttr) Key() string {
 	return a.attr.Key
@@ -386,12 +627,13 @@ var _ w3cdom.Node = &W3CAttr{} // Attributes are W3C DOM nodes as well
 // standard-package html.
 const AttrNode = html.NodeType(77)
 
-// NodeName for an attribute is the attribute key
+// NodeName for an attribute is the qualified name of the attribute, i.e. its
+// key with its prefix, if any.
 func (a *W3CAttr) NodeName() string {
 	if a == nil {
 		return ""
 	}
-	return a.attr.Key
+	return qualifiedName(a.attr)
 }
 
 // NodeValue for an attribute is the attribute value
@@ -432,6 +674,9 @@ func (a *W3CAttr) Attributes() w3cdom.NamedNodeMap { return nil }
 // TextContent returns an empty string
 func (a *W3CAttr) TextContent() (string, error) { return "", nil }
 
+// Normalize does nothing
+func (a *W3CAttr) Normalize() {}
+
 // ComputedStyles gets null-styles
 func (a *W3CAttr) ComputedStyles() w3cdom.ComputedStyles {
 	return nullStyles{}
@@ -485,69 +730,136 @@ func (wm *W3CMap) Item(i int) w3cdom.Attr {
 	return &W3CAttr{&attrs[i]}
 }
 
-// GetNamedItem returns the attribute with key key.
+// GetNamedItem returns the attribute with qualified name key, e.g. "xlink:href".
 func (wm *W3CMap) GetNamedItem(key string) w3cdom.Attr {
 	if wm == nil {
 		return nil
 	}
 	attrs := wm.forNode.HTMLNode().Attr
-	for _, a := range attrs {
-		if a.Key == key {
-			return &W3CAttr{&a}
+	for i := range attrs {
+		if qualifiedName(&attrs[i]) == key {
+			return &W3CAttr{&attrs[i]}
 		}
 	}
 	return nil
 }
 
-// --- NodeList -------------------------------------------------------------------
-
-// A W3CNodeList is a type for a list of nodes
-type W3CNodeList struct {
-	nodes []*W3CNode
+// GetNamedItemNS returns the attribute with a namespace URI and a local name.
+// Use an empty namespace URI for attributes without a prefix.
+func (wm *W3CMap) GetNamedItemNS(namespaceURI, localName string) w3cdom.Attr {
+	if wm == nil {
+		return nil
+	}
+	attrs := wm.forNode.HTMLNode().Attr
+	for i := range attrs {
+		if attrs[i].Key == localName && attrNamespaceURI(attrs[i].Namespace) == namespaceURI {
+			return &W3CAttr{&attrs[i]}
+		}
+	}
+	return nil
 }
 
-var _ w3cdom.NodeList = &W3CNodeList{}
+// --------------------------------------------------------------------------------
 
-// Length returns the number of Nodes in a list
-func (wl *W3CNodeList) Length() int {
-	if wl == nil {
-		return 0
+// FromHTMLParseTree returns a W3C DOM from parsed HTML and an optional style sheet.
+// Styling may be configured with options, e.g.
+//
+//     doc := dom.FromHTMLParseTree(h, nil, dom.DropInterElementWhitespace(true))
+//
+func FromHTMLParseTree(h *html.Node, css cssom.StyleSheet, opts ...StylingOption) *W3CNode {
+	if h == nil {
+		tracer().Infof("Cannot create DOM for null-HTML")
+		return nil
 	}
-	return len(wl.nodes)
+	s := cssomForDocument(h, css)
+	for _, option := range opts {
+		option(s)
+	}
+	stytree, err := s.Style(h) //, styledtree.Creator())
+	if err != nil {
+		tracer().Errorf("Cannot style test document: %s", err.Error())
+		return nil
+	}
+	d := domify(stytree)
+	return d
 }
 
-// Item returns the i.th Node
-func (wl *W3CNodeList) Item(i int) w3cdom.Node {
-	if wl == nil {
+// FromHTMLParseTreeWithOptions returns a W3C DOM from parsed HTML and an optional
+// style sheet, configured by document options. The options are available from the
+// owner document of the nodes of the DOM (see W3CDocument.Options). Styling options
+// are applied after the document options, thus may override them.
+//
+// Other than FromHTMLParseTree, FromHTMLParseTreeWithOptions hides <noscript>
+// elements by a user-agent style rule, unless ScriptingDisabled is set.
+func FromHTMLParseTreeWithOptions(h *html.Node, css cssom.StyleSheet, docopts DocumentOptions,
+	opts ...StylingOption) *W3CNode {
+	//
+	if h == nil {
+		tracer().Infof("Cannot create DOM for null-HTML")
 		return nil
 	}
-	if i >= len(wl.nodes) || i < 0 {
+	s := cssomForDocument(h, css)
+	if !docopts.ScriptingDisabled {
+		if err := s.AddStylesForScope(nil, noscriptSheet(), cssom.Global); err != nil {
+			tracer().Errorf("Cannot add styles for <noscript>: %s", err.Error())
+		}
+	}
+	s.SetPreserveComments(docopts.PreserveComments)
+	for _, option := range opts {
+		option(s)
+	}
+	stytree, err := s.Style(h) //, styledtree.Creator())
+	if err != nil {
+		tracer().Errorf("Cannot style test document: %s", err.Error())
 		return nil
 	}
-	return wl.nodes[i]
+	stytree.Payload.Index().SetData(docopts)
+	d := domify(stytree)
+	return d
 }
 
-func (wl *W3CNodeList) String() string {
-	var s bytes.Buffer
-	s.WriteString("[ ")
-	if wl != nil {
-		for _, n := range wl.nodes {
-			s.WriteString(n.NodeName())
-			s.WriteString(" ")
-		}
-	}
-	s.WriteString("]")
-	return s.String()
+// noscriptStyles hides <noscript> elements of documents with scripting enabled.
+const noscriptStyles = "noscript { display: none }"
+
+// noscriptSheet returns the style sheet for noscriptStyles, which is parsed once
+// and shared by all documents.
+func noscriptSheet() cssom.StyleSheet {
+	noscript.once.Do(func() {
+		noscript.sheet = douceuradapter.Parse(noscriptStyles, nil)
+	})
+	return noscript.sheet
 }
 
-// --------------------------------------------------------------------------------
+var noscript struct {
+	once  sync.Once
+	sheet cssom.StyleSheet
+}
 
-// FromHTMLParseTree returns a W3C DOM from parsed HTML and an optional style sheet.
-func FromHTMLParseTree(h *html.Node, css cssom.StyleSheet) *W3CNode {
-	if h == nil {
-		tracer().Infof("Cannot create DOM for null-HTML")
-		return nil
+// StylingOption is a type to configure the styling of documents created by
+// FromHTMLParseTree.
+type StylingOption func(*cssom.CSSOM)
+
+// DropInterElementWhitespace is an option to drop whitespace-only text nodes
+// between block-level elements, e.g. indentation of the HTML source.
+// See cssom.CSSOM.SetDropInterElementWhitespace for the rules applied.
+func DropInterElementWhitespace(drop bool) StylingOption {
+	return func(s *cssom.CSSOM) {
+		s.SetDropInterElementWhitespace(drop)
+	}
+}
+
+// PreserveForeignContent is an option to keep inline SVG and MathML subtrees
+// verbatim, without styling their content. Renderers may then delegate these
+// subtrees to a dedicated engine, see styledtree.StyNode.ForeignContent.
+func PreserveForeignContent(preserve bool) StylingOption {
+	return func(s *cssom.CSSOM) {
+		s.SetPreserveForeignContent(preserve)
 	}
+}
+
+// cssomForDocument creates a CSSOM for an HTML parse tree, including the
+// <style> elements of the document and an optional style sheet.
+func cssomForDocument(h *html.Node, css cssom.StyleSheet) *cssom.CSSOM {
 	styles := douceuradapter.ExtractStyleElements(h)
 	tracer().Debugf("Extracted %d <style> elements", len(styles))
 	s := cssom.NewCSSOM(nil) // nil = no additional properties
@@ -557,13 +869,7 @@ func FromHTMLParseTree(h *html.Node, css cssom.StyleSheet) *W3CNode {
 	if css != nil {
 		s.AddStylesForScope(nil, css, cssom.Author)
 	}
-	stytree, err := s.Style(h) //, styledtree.Creator())
-	if err != nil {
-		tracer().Errorf("Cannot style test document: %s", err.Error())
-		return nil
-	}
-	d := domify(stytree)
-	return d
+	return s
 }
 
 /*
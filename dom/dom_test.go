@@ -1,16 +1,28 @@
 package dom_test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/url"
+	"runtime"
 	"strings"
 	"testing"
 
 	"github.com/npillmayer/fp/dom"
 	"github.com/npillmayer/fp/dom/domdbg"
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/fp/dom/style/cssom"
+	"github.com/npillmayer/fp/dom/style/cssom/douceuradapter"
 	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/dom/w3cdom"
 	"github.com/npillmayer/fp/tree"
 	"github.com/npillmayer/schuko/tracing/gotestingadapter"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 var graphviz = false
@@ -101,6 +113,1518 @@ func TestW3CStyles1(t *testing.T) {
 	}
 }
 
+func TestW3CCssText(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	root := buildDOM(t)
+	body := root.FirstChild().FirstChild().NextSibling().(*dom.W3CNode)
+	if css := body.ComputedStyles().Styles().CssText(); css != "border-color: red;" {
+		t.Errorf("expected body to serialize to 'border-color: red;', is '%s'", css)
+	}
+	margins := style.NewPropertyGroup(style.PGMargins)
+	for k, v := range map[string]style.Property{"margin-top": "10pt", "margin-right": "0",
+		"margin-bottom": "10pt", "margin-left": "0"} {
+		margins.Set(k, v)
+	}
+	border := style.NewPropertyGroup(style.PGBorder)
+	for _, side := range []string{"top", "right", "bottom", "left"} {
+		border.Set("border-"+side+"-width", "thin")
+		border.Set("border-"+side+"-style", "solid")
+		border.Set("border-"+side+"-color", "blue")
+	}
+	border.Set("border-top-left-radius", "2px")
+	pmap := style.NewPropertyMap().AddAllFromGroup(margins, false).AddAllFromGroup(border, false)
+	expected := "border: thin solid blue; border-top-left-radius: 2px; margin: 10pt 0;"
+	if css := pmap.CssText(); css != expected {
+		t.Errorf("expected '%s', have '%s'", expected, css)
+	}
+}
+
+func TestW3CMergeProperties(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	base := style.NewPropertyGroup(style.PGColor)
+	base.Set("color", "black")
+	base.Set("background-color", "white")
+	theme := style.NewPropertyGroup(style.PGColor)
+	theme.Set("color", "red")
+	theme.Set("background-color", "blue")
+	margins := style.NewPropertyGroup(style.PGMargins)
+	margins.Set("margin-top", "1pt")
+	for _, test := range []struct {
+		policy    style.MergePolicy
+		color, bg style.Property
+	}{
+		{style.OverwriteAll, "red", "blue"},
+		{style.KeepExisting, "black", "white"},
+		{style.HigherSpecificityWins(style.Specificities{"color": 10, "background-color": 100},
+			style.Specificities{"color": 10, "background-color": 20}), "red", "white"},
+	} {
+		pmap := style.NewPropertyMap().AddAllFromGroup(base, false)
+		overlay := style.NewPropertyMap().AddAllFromGroup(theme, false).AddAllFromGroup(margins, false)
+		pmap = pmap.Merge(overlay, test.policy)
+		if c, _ := pmap.Property("color"); c != test.color {
+			t.Errorf("expected color to be %s, is %s", test.color, c)
+		}
+		if c, _ := pmap.Property("background-color"); c != test.bg {
+			t.Errorf("expected background-color to be %s, is %s", test.bg, c)
+		}
+		if m, _ := pmap.Property("margin-top"); m != "1pt" {
+			t.Errorf("expected margin-top to be merged, is %s", m)
+		}
+	}
+	if c, _ := base.Get("color"); c != "black" {
+		t.Errorf("expected shared property group not to be modified, color is %s", c)
+	}
+}
+
+var mycustom = `
+<html><head>
+<style>
+  div { -tyse-flow: main; x-marker: star; -tyse-column-span: none; }
+  p { -tyse-column-span: all; x-note: margin; -tyse-flow: nowhere; }
+</style>
+</head><body>
+  <div><p>Hello <b>World</b></p></div>
+</body>
+`
+
+func TestW3CPropertyNamespaces(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	err := style.RegisterPropertyNamespace(style.PropertyNamespace{
+		Prefix:    "-tyse-",
+		Group:     "Tyse",
+		Inherited: true,
+		Defaults:  []style.KeyValue{{Key: "-tyse-flow", Value: "default"}},
+		Validate: func(key string, value style.Property) error {
+			if key == "-tyse-flow" && value == "nowhere" {
+				return fmt.Errorf("illegal flow %s", value)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer style.UnregisterPropertyNamespace("-tyse-")
+	if err = style.RegisterPropertyNamespace(style.PropertyNamespace{Prefix: "x-", Group: "Ext"}); err != nil {
+		t.Fatal(err)
+	}
+	defer style.UnregisterPropertyNamespace("x-")
+	if err = style.RegisterPropertyNamespace(style.PropertyNamespace{Prefix: "-tyse-", Group: "T2"}); err == nil {
+		t.Errorf("expected duplicate namespace to be rejected")
+	}
+	if err = style.RegisterPropertyNamespace(style.PropertyNamespace{Prefix: "y-", Group: style.PGText}); err == nil {
+		t.Errorf("expected namespace with standard group to be rejected")
+	}
+	if g := style.GroupNameFromPropertyKey("-tyse-flow"); g != "Tyse" {
+		t.Errorf("expected -tyse-flow to be in group Tyse, is in %s", g)
+	}
+	if g := style.GroupNameFromPropertyKey("-moz-whatever"); g != style.PGX {
+		t.Errorf("expected unregistered vendor property to be in group X, is in %s", g)
+	}
+	//
+	h, err := html.Parse(strings.NewReader(mycustom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	div, p, b := findElement(t, root, "div"), findElement(t, root, "p"), findElement(t, root, "b")
+	if p.ComputedStyles().Styles().Group("Tyse") == nil {
+		t.Errorf("expected <p> to have a property group Tyse")
+	}
+	for _, x := range []struct {
+		node     *dom.W3CNode
+		key      string
+		expected style.Property
+	}{
+		{div, "-tyse-flow", "main"},
+		{p, "-tyse-flow", "main"}, // invalid value dropped, inherited
+		{b, "-tyse-flow", "main"},
+		{b, "-tyse-column-span", "all"},
+		{root, "-tyse-flow", "default"},
+		{div, "x-marker", "star"},
+		{p, "x-marker", style.NullStyle}, // not inherited
+		{p, "x-note", "margin"},
+	} {
+		if v := x.node.CascadedValue(x.key); v != x.expected {
+			t.Errorf("expected %s of <%s> to be %q, is %q", x.key, x.node.NodeName(), x.expected, v)
+		}
+	}
+}
+
+var mycascade = `
+<html><head>
+<style>
+  div { color: green; margin-top: 4pt; }
+  span { margin-top: inherit; }
+  em { color: initial; }
+  i { color: inherit; }
+  p { border-top-color: red; }
+</style>
+</head><body>
+  <div><span>Hello</span> <em>World <b>and</b> <i>all</i></em><p>!</p></div>
+</body>
+`
+
+func TestW3CCascadedValue(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	h, err := html.Parse(strings.NewReader(mycascade))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	div, span := findElement(t, root, "div"), findElement(t, root, "span")
+	em, p := findElement(t, root, "em"), findElement(t, root, "p")
+	b, i := findElement(t, root, "b"), findElement(t, root, "i")
+	for _, x := range []struct {
+		node     *dom.W3CNode
+		key      string
+		expected style.Property
+	}{
+		{span, "color", "green"},             // inherited
+		{span, "margin-top", "4pt"},          // explicitly inherited
+		{em, "color", "default"},             // initial
+		{b, "color", "default"},              // inherited from initial value of ancestor
+		{i, "color", "default"},              // explicitly inherited from initial value of ancestor
+		{p, "margin-top", "0"},               // not inherited
+		{p, "border-top-color", "red"},       // local
+		{div, "border-top-color", "default"}, // initial
+		{span, "display", "inline"},          // user-agent default for element
+	} {
+		if v := x.node.CascadedValue(x.key); v != x.expected {
+			t.Errorf("expected %s of <%s> to be %q, is %q", x.key, x.node.NodeName(), x.expected, v)
+		}
+	}
+}
+
+var mykeywords = `
+<html><head>
+<style>
+  div { color: green; margin-top: 4pt; display: inline; }
+  #inherit { color: inherit; margin-top: inherit; display: inherit; }
+  #initial { color: initial; margin-top: initial; display: initial; }
+  #unset { color: unset; margin-top: unset; display: unset; }
+  #revert { color: revert; margin-top: revert; display: revert; }
+</style>
+</head><body>
+  <div><p id="inherit">1</p><p id="initial">2</p><p id="unset">3</p><p id="revert">4</p></div>
+</body>
+`
+
+func TestW3CCSSWideKeywords(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	h, err := html.Parse(strings.NewReader(mykeywords))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	ps := findElements(root, "p")
+	nodes := make(map[string]*dom.W3CNode)
+	for _, n := range ps {
+		w := dom.NodeFromStyledNode(n.Payload)
+		id, _ := w.Attribute("id")
+		nodes[id] = w
+	}
+	for _, x := range []struct {
+		id       string
+		key      string
+		expected style.Property
+	}{
+		{"inherit", "color", "green"},
+		{"inherit", "margin-top", "4pt"},
+		{"inherit", "display", "inline"},
+		{"initial", "color", "default"},
+		{"initial", "margin-top", "0"},
+		{"initial", "display", "inline"}, // CSS initial value, not the <p> default
+		{"unset", "color", "green"},      // inherited property: like inherit
+		{"unset", "margin-top", "0"},     // non-inherited property: like initial
+		{"unset", "display", "inline"},
+		{"revert", "color", "green"},          // no user-agent default: like unset
+		{"revert", "margin-top", "0"},         // user-agent default
+		{"revert", "display", "block-inline"}, // user-agent default for <p>
+	} {
+		n := nodes[x.id]
+		if n == nil {
+			t.Fatalf("cannot find <p id=%q>", x.id)
+		}
+		if v := n.CascadedValue(x.key); v != x.expected {
+			t.Errorf("expected %s of #%s to be %q, is %q", x.key, x.id, x.expected, v)
+		}
+		if v := n.ComputedStyles().GetPropertyValue(x.key); v != x.expected {
+			t.Errorf("expected computed %s of #%s to be %q, is %q", x.key, x.id, x.expected, v)
+		}
+	}
+}
+
+var mylayout = `
+<html><head>
+<style>
+  div { overflow: auto; }
+  span { float: left; }
+  section { position: absolute; float: right; }
+  strong { display: inline-block; }
+  b { visibility: hidden; }
+</style>
+</head><body>
+  <div><span>A</span><section>B</section><strong>C</strong><b>D</b><i>E</i></div><p>F</p>
+</body>
+`
+
+func TestW3CLayoutHint(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	h, err := html.Parse(strings.NewReader(mylayout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	for _, x := range []struct {
+		element                 string
+		outer                   css.DisplayMode
+		floating, inFlow, fc, v bool
+	}{
+		{"head", css.DisplayNone, false, false, false, false},
+		{"div", css.BlockMode, false, true, true, true},      // overflow
+		{"span", css.BlockMode, true, false, true, true},     // blockified float
+		{"section", css.BlockMode, false, false, true, true}, // absolute wins over float
+		{"strong", css.InlineMode, false, true, true, true},  // inline-block
+		{"b", css.InlineMode, false, true, false, false},     // hidden
+		{"i", css.InlineMode, false, true, false, true},
+		{"p", css.BlockMode, false, true, false, true},
+	} {
+		hint := dom.LayoutHint(findElement(t, root, x.element))
+		if hint.Outer != x.outer || hint.Floating != x.floating || hint.InFlow != x.inFlow ||
+			hint.FormattingContext != x.fc || hint.Visible != x.v {
+			t.Errorf("unexpected layout hints for <%s>: %+v", x.element, hint)
+		}
+	}
+	if hint := dom.LayoutHint(nil); hint.Outer != css.DisplayNone {
+		t.Errorf("expected nil node to have display none, has %v", hint.Outer)
+	}
+}
+
+func TestW3CCloneAndAdopt(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	styled := func(css string) *dom.W3CNode {
+		h, err := html.Parse(strings.NewReader(myhtml))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dom.FromHTMLParseTree(h, douceuradapter.Parse(css, nil))
+	}
+	chapter := styled("body { color: red } p { background-color: yellow }")
+	book := styled("body { color: green }")
+	body := chapter.FirstChild().FirstChild().NextSibling().(*dom.W3CNode)
+	para := body.Children().Item(1).(*dom.W3CNode)
+	clone := para.CloneSubtree(true)
+	if clone.ParentNode() != nil {
+		t.Errorf("expected clone to be detached, has parent %v", clone.ParentNode())
+	}
+	if clone.HTMLNode() == para.HTMLNode() {
+		t.Errorf("expected clone to have its own HTML node")
+	}
+	if clone.ChildNodes().Length() != para.ChildNodes().Length() {
+		t.Errorf("expected deep clone to have %d children, has %d",
+			para.ChildNodes().Length(), clone.ChildNodes().Length())
+	}
+	bookBody := book.FirstChild().FirstChild().NextSibling().(*dom.W3CNode)
+	n := bookBody.Children().Length()
+	if _, err := bookBody.AdoptNode(clone); err != nil {
+		t.Fatal(err)
+	}
+	if bookBody.Children().Length() != n+1 {
+		t.Errorf("expected body to have %d element children, has %d", n+1, bookBody.Children().Length())
+	}
+	if clone.HTMLNode().Parent != bookBody.HTMLNode() {
+		t.Errorf("expected adopted HTML node to be re-parented")
+	}
+	if v := clone.CascadedValue("color"); v != "green" {
+		t.Errorf("expected adopted paragraph to inherit color green from book, is %q", v)
+	}
+	if v := clone.CascadedValue("background-color"); v != "yellow" {
+		t.Errorf("expected adopted paragraph to keep background-color yellow, is %q", v)
+	}
+	bold := clone.FirstChild().NextSibling().(*dom.W3CNode)
+	if v := bold.CascadedValue("color"); bold.NodeName() != "b" || v != "green" {
+		t.Errorf("expected <b> of adopted paragraph to inherit color green, is %q", v)
+	}
+	// the source document has been left untouched
+	group := para.Styles().Group(style.PGColor)
+	if group == nil || group.Parent != body.Styles().Group(style.PGColor) {
+		t.Errorf("expected color group of source paragraph to cascade to source <body>")
+	}
+	if clone.Styles().Group(style.PGColor) == group {
+		t.Errorf("expected adopted paragraph to have a re-linked copy of its color group")
+	}
+	if v := para.CascadedValue("color"); v != "red" {
+		t.Errorf("expected source paragraph to keep color red, is %q", v)
+	}
+	text, _ := clone.TextContent()
+	if !strings.Contains(text, "World") {
+		t.Errorf("expected adopted paragraph to contain 'World', is '%s'", text)
+	}
+	if _, err := clone.AdoptNode(bookBody); err == nil {
+		t.Errorf("expected adoption of ancestor to fail")
+	}
+}
+
+func TestW3CNodeList(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	root := buildDOM(t)
+	body := root.FirstChild().FirstChild().NextSibling().(*dom.W3CNode)
+	live := body.Children().(*dom.W3CNodeList)
+	if !live.IsLive() || live.Length() != 3 {
+		t.Fatalf("expected live list of 3 paragraphs, is %v (live=%v)", live, live.IsLive())
+	}
+	var names []string
+	live.ForEach(func(i int, n w3cdom.Node) {
+		names = append(names, n.NodeName())
+	})
+	if strings.Join(names, " ") != "p p p" {
+		t.Errorf("expected ForEach to visit 3 paragraphs, visited %v", names)
+	}
+	static := live.Snapshot()
+	if static.IsLive() {
+		t.Errorf("expected snapshot not to be live")
+	}
+	clone := live.Item(0).(*dom.W3CNode).CloneSubtree(true)
+	if _, err := body.AdoptNode(clone); err != nil {
+		t.Fatal(err)
+	}
+	if live.Length() != 4 || static.Length() != 3 {
+		t.Errorf("expected live list to grow to 4 and snapshot to stay at 3, are %d and %d",
+			live.Length(), static.Length())
+	}
+	if live.Item(3) != live.Item(3) {
+		t.Errorf("expected live list to cache its nodes while the DOM is unchanged")
+	}
+	if tn, ok := dom.NodeAsTreeNode(clone); ok {
+		tn.Isolate()
+	}
+	if live.Length() != 3 || live.Item(3) != nil {
+		t.Errorf("expected live list to shrink to 3 after removing a paragraph, is %v", live)
+	}
+	it, cnt := static.Iter(), 0
+	for it.Next() {
+		if it.Index() != cnt || it.Node() != static.Item(cnt) {
+			t.Errorf("iterator out of sync at index %d", cnt)
+		}
+		cnt++
+	}
+	if cnt != 3 {
+		t.Errorf("expected iterator to visit 3 nodes, visited %d", cnt)
+	}
+	if dom.StaticNodeList().Iter().Next() {
+		t.Errorf("expected iterator over empty list to be exhausted")
+	}
+}
+
+func TestW3CNodeIDs(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	root := buildDOM(t)
+	if root.ID() != 1 {
+		t.Errorf("expected document node to have ID 1, has %d", root.ID())
+	}
+	b := findElement(t, root, "b")
+	if b.ID() == styledtree.NoNodeID {
+		t.Fatalf("expected <b> to have been assigned an ID")
+	}
+	if n := root.NodeByID(b.ID()); n == nil || n.HTMLNode() != b.HTMLNode() {
+		t.Errorf("expected lookup of ID %d to return <b>, is %v", b.ID(), n)
+	}
+	body := findElement(t, root, "body")
+	if n := b.NodeByID(body.ID()); n == nil || n.NodeName() != "body" {
+		t.Errorf("expected lookup from any node of the document to work, is %v", n)
+	}
+	if body.ID() >= b.ID() {
+		t.Errorf("expected IDs in document order, have body=%d, b=%d", body.ID(), b.ID())
+	}
+	if root.NodeByID(99999) != nil {
+		t.Errorf("expected lookup of unknown ID to fail")
+	}
+	// clones do not have IDs until they are adopted
+	book := buildDOM(t)
+	clone := b.CloneSubtree(true)
+	if clone.ID() != styledtree.NoNodeID {
+		t.Errorf("expected clone to have no ID, has %d", clone.ID())
+	}
+	bookBody := findElement(t, book, "body")
+	if _, err := bookBody.AdoptNode(clone); err != nil {
+		t.Fatal(err)
+	}
+	if clone.ID() == styledtree.NoNodeID || book.NodeByID(clone.ID()) == nil {
+		t.Errorf("expected adopted node to be registered with the new document")
+	}
+	// moving a node between documents re-assigns its ID
+	id := b.ID()
+	if _, err := bookBody.AdoptNode(b); err != nil {
+		t.Fatal(err)
+	}
+	if root.NodeByID(id) != nil {
+		t.Errorf("expected moved node not to be found in the old document")
+	}
+	if n := book.NodeByID(b.ID()); n == nil || n.HTMLNode() != b.HTMLNode() {
+		t.Errorf("expected moved node to be found in the new document")
+	}
+	// removed nodes are unregistered
+	id, size := b.ID(), book.Index().Len()
+	if _, err := bookBody.RemoveChild(b); err != nil {
+		t.Fatal(err)
+	}
+	if book.NodeByID(id) != nil || b.ID() != styledtree.NoNodeID {
+		t.Errorf("expected removed node to be unregistered")
+	}
+	if book.Index().Len() != size-2 { // <b> and its text
+		t.Errorf("expected removal of 2 nodes from index of %d nodes, has %d", size, book.Index().Len())
+	}
+	if _, err := bookBody.RemoveChild(b); err != dom.ErrNotAChild {
+		t.Errorf("expected removal of non-child to fail with ErrNotAChild, is %v", err)
+	}
+	checkDocumentPositions(t, book)
+	// nodes isolated by other means are dropped on lookup
+	id = clone.ID()
+	if tn, ok := dom.NodeAsTreeNode(clone); ok {
+		tn.Isolate()
+	}
+	if book.NodeByID(id) != nil || clone.ID() != styledtree.NoNodeID {
+		t.Errorf("expected isolated node not to be found")
+	}
+}
+
+func TestW3CAttributeFilter(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	root := buildDOM(t)
+	nodes, err := root.Walk().AllDescendents().AttributeIs("id", "world").
+		SetAttribute("lang", "en").Promise()()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 {
+		t.Fatalf("expected 1 node with id=world, have %d", len(nodes))
+	}
+	if lang, _ := nodes[0].Payload.Attribute("lang"); lang != "en" {
+		t.Errorf("expected attribute lang=en to be set, is %q", lang)
+	}
+}
+
+var mysvg = `
+<html><head>
+<style>
+  circle { fill: yellow; }
+  my-box { color: blue; }
+</style>
+</head><body>
+  <svg><rect fill="red"/><g stroke="blue"><circle fill="green"/></g></svg>
+  <my-box>custom</my-box>
+</body>
+`
+
+func TestW3CInlineSVG(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	h, err := html.Parse(strings.NewReader(mysvg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	for _, sty := range douceuradapter.ExtractStyleElements(h) {
+		s.AddStylesForScope(nil, sty, cssom.Script)
+	}
+	s.RegisterStylableElement(cssom.NamespaceHTML, "my-box")
+	stytree, err := s.Style(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := dom.NodeFromTreeNode(stytree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	find := func(name string) *dom.W3CNode {
+		return findElement(t, root, name)
+	}
+	if fill := find("rect").ComputedStyles().GetPropertyValue("fill"); fill != "red" {
+		t.Errorf("expected presentation attribute fill=red for <rect>, is %v", fill)
+	}
+	circle := find("circle").ComputedStyles()
+	if fill := circle.GetPropertyValue("fill"); fill != "yellow" {
+		t.Errorf("expected CSS rule to override presentation attribute for <circle>, fill is %v", fill)
+	}
+	if stroke := circle.GetPropertyValue("stroke"); stroke != "blue" {
+		t.Errorf("expected <circle> to inherit stroke=blue, is %v", stroke)
+	}
+	if color := find("my-box").ComputedStyles().GetPropertyValue("color"); color != "blue" {
+		t.Errorf("expected registered custom element to be styled, color is %v", color)
+	}
+}
+
+func TestStreamStyled(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	root := buildDOM(t) // styled tree for reference
+	var expected []*dom.W3CNode
+	nodes, _ := root.Walk().TopDownDF(
+		func(n, _ *tree.Node[*styledtree.StyNode], _ int) (*tree.Node[*styledtree.StyNode], error) {
+			return n, nil
+		}).Promise()()
+	for _, n := range nodes {
+		expected = append(expected, dom.NodeFromStyledNode(n.Payload))
+	}
+	keys := []string{"border-top-color", "padding-left", "display", "color"}
+	var events []string
+	var open []*dom.W3CNode
+	i := 0
+	err := dom.StreamStyled(strings.NewReader(myhtml), nil, func(ev dom.StyledEvent) error {
+		events = append(events, fmt.Sprintf("%s:%s@%d", ev.Type, ev.Node.NodeName(), ev.Depth))
+		if ev.Type == dom.CloseEvent {
+			open = append(open, ev.Node)
+			return nil
+		}
+		if i >= len(expected) || expected[i].NodeName() != ev.Node.NodeName() {
+			return fmt.Errorf("node #%d in stream is %s, expected to match styled tree", i, ev.Node.NodeName())
+		}
+		for _, key := range keys {
+			if v, x := ev.Node.CascadedValue(key), expected[i].CascadedValue(key); v != x {
+				t.Errorf("expected %s of streamed <%s> to be %q, is %q", key, ev.Node.NodeName(), x, v)
+			}
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != len(expected) {
+		t.Errorf("expected stream to emit %d nodes, emitted %d", len(expected), i)
+	}
+	if events[0] != "open:#document@0" || events[len(events)-1] != "close:#document@0" {
+		t.Errorf("expected stream to be enclosed by document events, is %v", events)
+	}
+	for _, n := range open[:len(open)-1] {
+		if n.ParentNode() != nil {
+			t.Errorf("expected <%s> to be released after closing it", n.NodeName())
+		}
+	}
+	abort := errors.New("abort")
+	last := ""
+	err = dom.StreamStyled(strings.NewReader(myhtml), nil, func(ev dom.StyledEvent) error {
+		if last = ev.Node.NodeName(); last == "body" {
+			return abort
+		}
+		return nil
+	})
+	if err != abort || last != "body" {
+		t.Errorf("expected stream to abort at <body>, err = %v after <%s>", err, last)
+	}
+}
+
+func TestStyleSharing(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	doc := `<html><head><style>p { margin-top: 3pt; } p.x { margin-top: 4pt; }</style></head>
+	<body><p>A</p><p>B</p><p class="x">C</p><p>D</p></body></html>`
+	h, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	nodes := findElements(root, "p")
+	margins := make(map[*style.PropertyGroup]int)
+	for _, n := range nodes {
+		margins[n.Payload.Styles().Group("Margins")]++
+	}
+	if len(nodes) != 4 || len(margins) != 2 {
+		t.Errorf("expected 4 paragraphs to share 2 margin groups, have %d groups", len(margins))
+	}
+	r := dom.StyleSharing(root)
+	t.Logf("%s", r)
+	if r.Duplicates != 0 || r.Shared() < 2 {
+		t.Errorf("expected property groups to be shared without duplicates, report = %s", r)
+	}
+	if dom.StyleSharing(nil).Nodes != 0 {
+		t.Errorf("expected empty report for nil node")
+	}
+}
+
+func TestW3CDocument(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	root := buildDOM(t)
+	doc := findElement(t, root, "b").OwnerDocument()
+	if doc == nil || doc.W3CNode.HTMLNode() != root.HTMLNode() {
+		t.Fatalf("expected <b> to be owned by document")
+	}
+	if doc.Doctype() != nil || !doc.IsQuirksMode() {
+		t.Errorf("expected document without doctype to be in quirks mode, is %s", doc.Mode())
+	}
+	if doc.Head().NodeName() != "head" || doc.Body().NodeName() != "body" {
+		t.Errorf("expected to find <head> and <body>, have %v and %v", doc.Head(), doc.Body())
+	}
+	for _, test := range []struct {
+		doctype string
+		mode    dom.DocumentMode
+	}{
+		{`<!DOCTYPE html>`, dom.NoQuirksMode},
+		{`<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN">`, dom.QuirksMode},
+		{`<!DOCTYPE html PUBLIC "-//W3C//DTD HTML 4.01 Transitional//EN" "http://www.w3.org/TR/html4/loose.dtd">`, dom.LimitedQuirksMode},
+		{`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">`, dom.NoQuirksMode},
+		{`<!DOCTYPE html PUBLIC "-//IETF//DTD HTML 2.0//EN">`, dom.QuirksMode},
+	} {
+		h, err := html.Parse(strings.NewReader(test.doctype + `<html><head><meta charset="UTF-8">
+		<title>  The   Book </title></head><body><p>x</p></body></html>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc := dom.FromHTMLParseTree(h, nil).OwnerDocument()
+		if doc.Mode() != test.mode {
+			t.Errorf("expected %s to result in %s mode, is %s", test.doctype, test.mode, doc.Mode())
+		}
+		if doc.Doctype() == nil || doc.Doctype().Name != "html" {
+			t.Errorf("expected doctype to be named html, is %v", doc.Doctype())
+		}
+		if doc.Title() != "The Book" || doc.Charset() != "utf-8" {
+			t.Errorf("expected title and charset, have %q and %q", doc.Title(), doc.Charset())
+		}
+	}
+}
+
+func TestNodesBetween(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	h, err := html.Parse(strings.NewReader(`<html><body><h1>T</h1><p>one <b>two</b></p><p>three</p><h2>U</h2></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	if pos, ok := root.DocumentPosition(); !ok || pos != 0 {
+		t.Errorf("expected document node to be at position 0, is at %d", pos)
+	}
+	h1, h2 := findElement(t, root, "h1"), findElement(t, root, "h2")
+	names := func(list *dom.W3CNodeList) string {
+		var b strings.Builder
+		list.ForEach(func(i int, n w3cdom.Node) {
+			b.WriteString(n.NodeName() + " ")
+		})
+		return b.String()
+	}
+	expected := "h1 #text p #text b #text p #text h2 "
+	if s := names(dom.NodesBetween(h1, h2)); s != expected {
+		t.Errorf("expected nodes between <h1> and <h2> to be %q, are %q", expected, s)
+	}
+	if s := names(dom.NodesBetween(h2, h1)); s != expected {
+		t.Errorf("expected anchors to be swapped, nodes are %q", s)
+	}
+	h2pos, _ := h2.DocumentPosition()
+	body := findElement(t, root, "body")
+	clone := findElement(t, root, "b").CloneSubtree(true)
+	if _, err := body.AdoptNode(clone); err != nil {
+		t.Fatal(err)
+	}
+	if pos, ok := clone.DocumentPosition(); !ok || pos != h2pos+2 {
+		t.Errorf("expected adopted node to follow <h2> and its text, is at %d", pos)
+	}
+	if s := names(dom.NodesBetween(h1, h2)); s != expected {
+		t.Errorf("expected adopted node not to affect range, nodes are %q", s)
+	}
+	if _, err := h1.AdoptNode(clone); err != nil { // move clone to the start of the document
+		t.Fatal(err)
+	}
+	if pos, ok := h2.DocumentPosition(); !ok || pos != h2pos+2 {
+		t.Errorf("expected <h2> to move 2 positions down to %d, is at %d", h2pos+2, pos)
+	}
+	expected = "h1 #text b #text p #text b #text p #text h2 "
+	if s := names(dom.NodesBetween(h1, h2)); s != expected {
+		t.Errorf("expected nodes between <h1> and <h2> to be %q after move, are %q", expected, s)
+	}
+	checkDocumentPositions(t, root)
+	other := buildDOM(t)
+	if dom.NodesBetween(h1, other).Length() != 0 {
+		t.Errorf("expected nodes of different documents not to span a range")
+	}
+}
+
+// checkDocumentPositions checks the document positions of all the nodes of the
+// document of root against a pre-order traversal.
+func checkDocumentPositions(t *testing.T, root *dom.W3CNode) {
+	t.Helper()
+	pos := 0
+	var check func(n *dom.W3CNode)
+	check = func(n *dom.W3CNode) {
+		if p, ok := n.DocumentPosition(); !ok || p != pos {
+			t.Errorf("expected %s to be at position %d, is at %d", n.NodeName(), pos, p)
+		}
+		pos++
+		n.ChildNodes().ForEach(func(_ int, ch w3cdom.Node) {
+			check(ch.(*dom.W3CNode))
+		})
+	}
+	check(root)
+}
+
+func TestUADisplayDefaults(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	style.RegisterDisplayForElement("book-box", "block")
+	h, err := html.Parse(strings.NewReader(`<html><body><ul><li>item</li></ul>
+	<span data-type="index-term">term</span><table><tr><td>cell</td></tr></table>
+	<my-widget>x</my-widget><book-box>y</book-box><em data-type="sidebar">z</em>
+	<pre hidden>hidden</pre></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	for _, x := range []struct {
+		element  string
+		expected style.Property
+	}{
+		{"li", "list-item"},
+		{"span", "none"}, // HTMLBook index term
+		{"table", "table"},
+		{"my-widget", "inline"}, // unknown element
+		{"book-box", "block"},   // registered by client
+		{"em", "block"},         // HTMLBook data-type wins over element
+		{"pre", "none"},         // hidden attribute
+	} {
+		if v := findElement(t, root, x.element).CascadedValue("display"); v != x.expected {
+			t.Errorf("expected display of <%s> to be %q, is %q", x.element, x.expected, v)
+		}
+	}
+}
+
+func TestW3CStyleDeclaration(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	h, err := html.Parse(strings.NewReader(mycascade))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	div, span, p := findElement(t, root, "div"), findElement(t, root, "span"), findElement(t, root, "p")
+	decl := div.Style()
+	if err := decl.SetProperty("color", "Blue", true); err != nil {
+		t.Fatal(err)
+	}
+	if v := decl.GetPropertyValue("color"); v != "blue" {
+		t.Errorf("expected color of <div> to be blue, is %q", v)
+	}
+	if decl.GetPropertyPriority("color") != "important" {
+		t.Errorf("expected color of <div> to be important")
+	}
+	if v := span.CascadedValue("color"); v != "blue" {
+		t.Errorf("expected <span> to inherit color blue, is %q", v)
+	}
+	if !div.StyNode.IsDirty() || p.StyNode.IsDirty() {
+		t.Errorf("expected <div> to be dirty and <p> to be clean")
+	}
+	if err := p.Style().SetProperty("margin", "1pt 2pt", false); err != nil {
+		t.Fatal(err)
+	}
+	if v := p.CascadedValue("margin-left"); v != "2pt" {
+		t.Errorf("expected compound margin to set margin-left of <p> to 2pt, is %q", v)
+	}
+	pdecl := p.Style()
+	pdecl.SetProperty("border-style", "solid", false)
+	pdecl.SetProperty("font-size", "9pt", false)
+	if err := pdecl.SetProperty("border-radius", "4px 2px", false); err != nil {
+		t.Fatal(err)
+	}
+	if v := p.CascadedValue("border-bottom-right-radius"); v != "4px" {
+		t.Errorf("expected border-radius to set border-bottom-right-radius to 4px, is %q", v)
+	}
+	if pdecl.RemoveProperty("border-radius"); p.CascadedValue("border-top-style") != "solid" {
+		t.Errorf("expected removing border-radius to keep border styles")
+	}
+	if v := p.CascadedValue("border-top-left-radius"); v == "4px" {
+		t.Errorf("expected border-radius to be removed")
+	}
+	if pdecl.RemoveProperty("border"); p.CascadedValue("border-left-style") == "solid" {
+		t.Errorf("expected removing border to remove border styles")
+	}
+	if pdecl.RemoveProperty("font"); p.CascadedValue("font-size") == "9pt" {
+		t.Errorf("expected removing font to remove font-size")
+	}
+	if old := decl.RemoveProperty("color"); old != "blue" {
+		t.Errorf("expected removed color to be blue, is %q", old)
+	}
+	if v := span.CascadedValue("color"); v == "blue" {
+		t.Errorf("expected <span> not to inherit removed color")
+	}
+	if decl.GetPropertyPriority("color") != "" {
+		t.Errorf("expected removed color to have no priority")
+	}
+	text := dom.NodeFromStyledNode(span.StyNode.Children(true)[0].Payload)
+	if err := text.Style().SetProperty("color", "red", false); err == nil {
+		t.Errorf("expected text nodes to reject style modifications")
+	}
+}
+
+func TestSetPropertyRelinksDescendents(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	doc := `<html><head><style>div { color: red } p { background-color: blue }
+	span { background-color: green }</style></head>
+	<body><div><p><span>Hello</span></p></div></body></html>`
+	h, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	div, p, span := findElement(t, root, "div"), findElement(t, root, "p"), findElement(t, root, "span")
+	for _, n := range []*dom.W3CNode{div, p, span} {
+		if n.Styles().Group(style.PGColor) == nil {
+			t.Fatalf("expected <%s> to have a color group of its own", n.NodeName())
+		}
+	}
+	if err := div.Style().SetProperty("color", "black", false); err != nil {
+		t.Fatal(err)
+	}
+	if v := p.CascadedValue("color"); v != "black" {
+		t.Errorf("expected <p> to inherit color black, is %q", v)
+	}
+	if v := span.CascadedValue("color"); v != "black" {
+		t.Errorf("expected <span> to inherit color black, is %q", v)
+	}
+	if v := span.CascadedValue("background-color"); v != "green" {
+		t.Errorf("expected <span> to keep its background-color green, is %q", v)
+	}
+	if !p.StyNode.IsDirty() || !span.StyNode.IsDirty() {
+		t.Errorf("expected re-linked <p> and <span> to be dirty")
+	}
+}
+
+func TestCompactStyleStore(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	styleDoc := func(backend style.StoreBackend) *dom.W3CNode {
+		style.SetStoreBackend(backend)
+		defer style.SetStoreBackend(style.MapBackend)
+		h, err := html.Parse(strings.NewReader(mycascade))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dom.FromHTMLParseTree(h, nil)
+	}
+	mapped, compact := styleDoc(style.MapBackend), styleDoc(style.CompactBackend)
+	keys := []string{"color", "margin-top", "border-top-color", "display"}
+	for _, name := range []string{"div", "span", "em", "p"} {
+		m, c := findElement(t, mapped, name), findElement(t, compact, name)
+		for _, key := range keys {
+			if v, w := m.CascadedValue(key), c.CascadedValue(key); v != w {
+				t.Errorf("expected %s of <%s> to be %q with compact backend, is %q", key, name, v, w)
+			}
+		}
+		if v, w := m.Styles().CssText(), c.Styles().CssText(); v != w {
+			t.Errorf("expected styles of <%s> to be %q with compact backend, are %q", name, v, w)
+		}
+	}
+	p := findElement(t, compact, "p")
+	if err := p.Style().SetProperty("-x-custom", "42", false); err != nil {
+		t.Fatal(err)
+	}
+	if v := p.ComputedStyles().GetPropertyValue("-x-custom"); v != "42" {
+		t.Errorf("expected custom property to be stored with compact backend, is %q", v)
+	}
+}
+
+var mybooks = `
+<html><body>
+  <ul id="books">
+    <li class="book" id="b1"><h2>The  Go Programming
+      Language</h2><a href="/gopl">Details</a><span class="year">2015</span></li>
+    <li class="book" id="b2"><h2>The TeXbook</h2><span class="year">1984</span></li>
+  </ul>
+</body></html>
+`
+
+func TestExtract(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	h, err := html.Parse(strings.NewReader(mybooks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := dom.FromHTMLParseTree(h, nil)
+	spec := dom.ExtractSpec{
+		Records: "li.book",
+		Fields: map[string]string{
+			"id":    "@id",
+			"title": "h2",
+			"link":  "a@href",
+			"year":  ".year",
+		},
+	}
+	records, err := dom.Extract(doc, spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, have %d", len(records))
+	}
+	if r := records[0]; r["id"] != "b1" || r["title"] != "The Go Programming Language" ||
+		r["link"] != "/gopl" || r["year"] != "2015" {
+		t.Errorf("unexpected first record %v", r)
+	}
+	if r := records[1]; r["title"] != "The TeXbook" || r["link"] != "" {
+		t.Errorf("unexpected second record %v", r)
+	}
+	type book struct {
+		ID    string
+		Name  string `dom:"title"`
+		Year  int
+		Link  string
+		dummy int
+	}
+	var books []book
+	if err = dom.ExtractInto(doc, spec, &books); err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 2 || books[1].Name != "The TeXbook" || books[1].Year != 1984 || books[0].Link != "/gopl" {
+		t.Errorf("unexpected books %+v", books)
+	}
+	var first book
+	if err = dom.ExtractInto(doc, spec, &first); err != nil || first.ID != "b1" {
+		t.Errorf("expected first book to be b1, is %+v, err = %v", first, err)
+	}
+	if err = dom.ExtractInto(doc, spec, books); err != dom.ErrInvalidTarget {
+		t.Errorf("expected non-pointer target to be rejected, err = %v", err)
+	}
+	spec.Fields["title"] = "h2[" // invalid selector
+	if _, err = dom.Extract(doc, spec); err == nil {
+		t.Errorf("expected invalid selector to be reported")
+	}
+}
+
+func TestClassListAndInlineStyle(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	doc := `<html><body><p class=" note  wide note" style="Color: red; margin-top: 2pt">A</p></body></html>`
+	h, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	p := findElement(t, root, "p")
+	if classes := p.ClassList(); len(classes) != 2 || classes[0] != "note" || classes[1] != "wide" {
+		t.Errorf("expected class list [note wide], have %v", classes)
+	}
+	decls := p.InlineStyle()
+	if len(decls) != 2 || decls[0].Key != "color" || decls[1].Value != "2pt" {
+		t.Errorf("expected 2 inline declarations, have %v", decls)
+	}
+	if decls := style.ParseDeclarations(`background: url("a;b.png"); ; bad`); len(decls) != 1 ||
+		decls[0].Value != `url("a;b.png")` {
+		t.Errorf("expected semicolons in quotes to be retained, have %v", decls)
+	}
+	if v := p.CascadedValue("color"); v != "red" {
+		t.Errorf("expected inline style to set color to red, is %q", v)
+	}
+	p.SetAttribute("class", "narrow")
+	if !p.HasClass("narrow") || p.HasClass("note") {
+		t.Errorf("expected class list to be updated after modification, have %v", p.ClassList())
+	}
+	p.SetAttribute("style", "")
+	if decls := p.InlineStyle(); len(decls) != 0 {
+		t.Errorf("expected inline style to be updated after modification, have %v", decls)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	doc := `<html><body><h1 id="ch1">Chapter</h1><p id="p1">See <a href="#ch1">chapter  1</a>,
+	<a href="#missing">this</a>, <a href="#old">that</a>, <a href="#top">top</a>
+	and <a href="other.html#sec%201">other</a>.<a name="old"></a><a>no link</a></p><p id="p1">Dup</p>
+	<a href="#missing">again</a></body></html>`
+	h, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := dom.FromHTMLParseTree(h, nil).OwnerDocument()
+	links := dom.Links(d)
+	if len(links) != 6 {
+		t.Fatalf("expected 6 links, have %d", len(links))
+	}
+	if links[0].Text != "chapter 1" || links[0].Fragment != "ch1" || !links[0].Internal {
+		t.Errorf("expected internal link to ch1, have %+v", links[0])
+	}
+	if links[4].Internal || links[4].Fragment != "sec 1" {
+		t.Errorf("expected external link with fragment 'sec 1', have %+v", links[4])
+	}
+	refs := dom.ResolveInternalRefs(d)
+	if refs.OK() || len(refs.Links) != 5 {
+		t.Errorf("expected 5 internal links with errors, have %d links", len(refs.Links))
+	}
+	if len(refs.Dangling) != 2 || refs.Dangling[0].Fragment != "missing" || refs.Dangling[1].Text != "again" {
+		t.Errorf("expected 2 dangling references to #missing, have %v", refs.Dangling)
+	}
+	if len(refs.Duplicates) != 1 || refs.Duplicates[0] != "p1" {
+		t.Errorf("expected id p1 to be reported as duplicate, have %v", refs.Duplicates)
+	}
+	if target := refs.Targets["ch1"]; target == nil || target.NodeName() != "h1" {
+		t.Errorf("expected #ch1 to refer to <h1>, have %v", target)
+	}
+	if target := refs.Targets["old"]; target == nil || target.NodeName() != "a" {
+		t.Errorf("expected #old to refer to named anchor, have %v", target)
+	}
+	if target := refs.Targets["top"]; target == nil || !target.IsDocument() {
+		t.Errorf("expected #top to refer to the document, have %v", target)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	h, err := html.Parse(strings.NewReader(`<html><body><p>A<b>B</b>C</p></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// append text nodes "D" and "" and an empty element after "C", as assembling a document may do
+	var hp *html.Node
+	for n := h.FirstChild.LastChild.FirstChild; n != nil; n = n.NextSibling {
+		hp = n
+	}
+	hp.AppendChild(&html.Node{Type: html.TextNode, Data: "D"})
+	hp.AppendChild(&html.Node{Type: html.CommentNode, Data: "comment"})
+	hp.AppendChild(&html.Node{Type: html.TextNode, Data: ""})
+	hp.AppendChild(&html.Node{Type: html.TextNode, Data: "E"})
+	hp.AppendChild(&html.Node{Type: html.ElementNode, Data: "i", DataAtom: atom.I})
+	hp.LastChild.AppendChild(&html.Node{Type: html.TextNode, Data: ""})
+	root := dom.FromHTMLParseTree(h, nil)
+	if root == nil {
+		t.Fatal("cannot create DOM")
+	}
+	p := findElement(t, root, "p")
+	if p.ChildNodes().Length() != 7 {
+		t.Fatalf("expected <p> to have 7 children before normalization, has %d", p.ChildNodes().Length())
+	}
+	p.Normalize()
+	if n := p.ChildNodes().Length(); n != 4 {
+		t.Errorf("expected <p> to have 4 children after normalization, has %d", n)
+	}
+	if text := p.ChildNodes().Item(2).NodeValue(); text != "CDE" {
+		t.Errorf("expected adjacent text nodes to be merged into 'CDE', is %q", text)
+	}
+	if i := findElement(t, root, "i"); i.HasChildNodes() {
+		t.Errorf("expected empty text node of <i> to be removed")
+	}
+	var texts []string
+	for c := hp.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			texts = append(texts, c.Data)
+		}
+	}
+	if strings.Join(texts, "|") != "A|CDE" {
+		t.Errorf("expected HTML text nodes to be normalized as well, are %q", texts)
+	}
+	if n := hp.LastChild.PrevSibling; n.Type != html.CommentNode || n.PrevSibling.Data != "CDE" {
+		t.Errorf("expected comment to follow merged text node")
+	}
+}
+
+func TestQueryByStyle(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	root := buildDOM(t)
+	nodes, err := root.QueryByStyle(func(cs w3cdom.ComputedStyles) bool {
+		return cs.GetPropertyValue("padding-left") == "5px"
+	})
+	if err != nil || nodes.Length() != 1 || nodes.Item(0).NodeName() != "p" {
+		t.Fatalf("expected to find 1 paragraph with padding-left 5px, found %v (%v)", nodes, err)
+	}
+	nodes, _ = root.QueryByStyle(func(cs w3cdom.ComputedStyles) bool {
+		return cs.GetPropertyValue("display") == "block-inline"
+	})
+	var names []string
+	last := -1
+	nodes.ForEach(func(_ int, n w3cdom.Node) {
+		names = append(names, n.NodeName())
+		pos, _ := n.(*dom.W3CNode).DocumentPosition()
+		if pos <= last {
+			t.Errorf("expected nodes in document order, %s at position %d follows position %d", n.NodeName(), pos, last)
+		}
+		last = pos
+	})
+	if strings.Join(names, " ") != "p p p" {
+		t.Errorf("expected 3 paragraphs with display block-inline, have %v", names)
+	}
+}
+
+func TestEncodeStyledTree(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	root := buildDOM(t)
+	findElement(t, root, "b").Style().SetProperty("color", "red", true)
+	n, _ := dom.NodeAsTreeNode(root)
+	var buf bytes.Buffer
+	if err := styledtree.Encode(&buf, n); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("encoded styled tree in %d bytes", buf.Len())
+	encoded := buf.Bytes()
+	decoded, err := styledtree.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := [2]map[*style.PropertyGroup]bool{{}, {}} // distinct groups of both trees
+	var compare func(a, b *tree.Node[*styledtree.StyNode])
+	compare = func(a, b *tree.Node[*styledtree.StyNode]) {
+		sa, sb := a.Payload, b.Payload
+		if sa.String() != sb.String() || sa.ID() != sb.ID() || sa.IsDirty() != sb.IsDirty() {
+			t.Fatalf("expected decoded node %v (ID %d) to equal %v (ID %d)", sb, sb.ID(), sa, sa.ID())
+		}
+		if ha, hb := sa.HTMLNode(), sb.HTMLNode(); ha.DataAtom != hb.DataAtom || len(ha.Attr) != len(hb.Attr) {
+			t.Errorf("expected decoded HTML node %v to equal original", hb.Data)
+		}
+		if sa.Styles().CssText() != sb.Styles().CssText() || sa.PropertyIsImportant("color") != sb.PropertyIsImportant("color") {
+			t.Errorf("expected styles of decoded node %v to equal original, have\n%s\nvs.\n%s", sb,
+				sb.Styles().CssText(), sa.Styles().CssText())
+		}
+		for i, pmap := range []*style.PropertyMap{sa.Styles(), sb.Styles()} {
+			for _, g := range pmap.Groups() {
+				groups[i][g] = true
+			}
+		}
+		ca, cb := a.Children(true), b.Children(true)
+		if len(ca) != len(cb) {
+			t.Fatalf("expected decoded node %v to have %d children, has %d", sb, len(ca), len(cb))
+		}
+		for i := range ca {
+			compare(ca[i], cb[i])
+		}
+	}
+	compare(n, decoded)
+	if len(groups[0]) != len(groups[1]) {
+		t.Errorf("expected property groups to be shared as in the original, have %d distinct groups instead of %d",
+			len(groups[1]), len(groups[0]))
+	}
+	if sn, ok := decoded.Payload.Index().Lookup(n.Payload.ID() + 3); !ok || sn.Index() != decoded.Payload.Index() {
+		t.Errorf("expected decoded nodes to be registered with a node index")
+	}
+	if _, err := styledtree.Decode(bytes.NewReader(encoded[:len(encoded)/2])); err != styledtree.ErrCorruptEncoding {
+		t.Errorf("expected truncated input to be rejected as corrupt, error is %v", err)
+	}
+}
+
+func TestDecodeCorruptInput(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	n, _ := dom.NodeAsTreeNode(buildDOM(t))
+	var buf bytes.Buffer
+	if err := styledtree.Encode(&buf, n); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	for l := 0; l < len(encoded); l++ {
+		if _, err := styledtree.Decode(bytes.NewReader(encoded[:l])); err == nil {
+			t.Fatalf("expected input truncated to %d bytes to be rejected", l)
+		}
+	}
+	mutated := make([]byte, len(encoded))
+	for i := range encoded {
+		for _, b := range []byte{0x00, 0x7f, 0xff} {
+			copy(mutated, encoded)
+			mutated[i] = b
+			styledtree.Decode(bytes.NewReader(mutated)) // must not panic
+		}
+	}
+	// counts of corrupt input must not lead to allocations in advance
+	uvarints := func(xs ...uint64) []byte {
+		b := []byte("STY")
+		var v [binary.MaxVarintLen64]byte
+		for _, x := range append([]uint64{1}, xs...) { // version 1
+			b = append(b, v[:binary.PutUvarint(v[:], x)]...)
+		}
+		return b
+	}
+	const huge = 1 << 24
+	for _, c := range []struct {
+		name  string
+		input []byte
+	}{
+		{"strings", uvarints(huge)},
+		{"string length", append(uvarints(1, huge), 'x')},
+		{"maps", uvarints(0, 0, huge)},
+		{"attributes", uvarints(1, 0, 0, 0, uint64(html.ElementNode), 0, 0, 0, huge)},
+	} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := styledtree.Decode(bytes.NewReader(c.input))
+		runtime.ReadMemStats(&after)
+		if err != styledtree.ErrCorruptEncoding {
+			t.Errorf("%s: expected input to be rejected as corrupt, error is %v", c.name, err)
+		}
+		if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+			t.Errorf("%s: expected decoding of corrupt input to allocate little, allocated %d bytes", c.name, alloc)
+		}
+	}
+}
+
+func TestDropInterElementWhitespace(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	doc := `<html><body>
+  <div>
+    <p>One</p>
+    <p><b>Two</b> <i>words</i></p>
+  </div>
+  <pre>
+  <span>x</span>
+  </pre>
+  <pre><div>y</div>
+  </pre>
+</body></html>`
+	var htmlWhitespace func(h *html.Node) int
+	htmlWhitespace = func(h *html.Node) int {
+		cnt := 0
+		if h.Type == html.TextNode && strings.TrimSpace(h.Data) == "" {
+			cnt++
+		}
+		for ch := h.FirstChild; ch != nil; ch = ch.NextSibling {
+			cnt += htmlWhitespace(ch)
+		}
+		return cnt
+	}
+	var whitespace func(n w3cdom.Node) int
+	whitespace = func(n w3cdom.Node) int {
+		cnt := 0
+		if n.NodeType() == html.TextNode && strings.TrimSpace(n.NodeValue()) == "" {
+			cnt++
+		}
+		for ch := n.FirstChild(); ch != nil; ch = ch.NextSibling() {
+			cnt += whitespace(ch)
+		}
+		return cnt
+	}
+	for _, test := range []struct {
+		opts  []dom.StylingOption
+		count int
+	}{
+		{nil, 11},
+		{[]dom.StylingOption{dom.DropInterElementWhitespace(false)}, 11},
+		{[]dom.StylingOption{dom.DropInterElementWhitespace(true)}, 4}, // between <b> and <i>, within <pre>
+	} {
+		h, err := html.Parse(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := dom.FromHTMLParseTree(h, nil, test.opts...)
+		if n := whitespace(root); n != test.count {
+			t.Errorf("expected %d whitespace-only text nodes, have %d", test.count, n)
+		}
+		if n := htmlWhitespace(h); n != test.count {
+			t.Errorf("expected %d whitespace-only text nodes in the HTML parse tree, have %d", test.count, n)
+		}
+		body, _ := dom.NodeAsTreeNode(findElement(t, root, "body"))
+		if body.ChildCount() != len(body.ChildSlots()) {
+			t.Errorf("expected no empty slots in children of <body>, have %d slots for %d children",
+				body.ChildCount(), len(body.ChildSlots()))
+		}
+		if text, _ := findElement(t, root, "b").TextContent(); text != "Two" {
+			t.Errorf("expected text of <b> to be kept, is %q", text)
+		}
+	}
+}
+
+func TestW3CNamespaces(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	doc := `<html><body><p id="p">Text</p>
+<svg viewBox="0 0 10 10"><a xlink:href="#x"><circle r="4"/></a></svg>
+<math><mi>x</mi></math>
+</body></html>`
+	h, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	for _, test := range []struct {
+		name, uri string
+	}{
+		{"p", w3cdom.HTMLNamespace},
+		{"svg", w3cdom.SVGNamespace},
+		{"circle", w3cdom.SVGNamespace},
+		{"math", w3cdom.MathMLNamespace},
+		{"mi", w3cdom.MathMLNamespace},
+	} {
+		n := findElement(t, root, test.name)
+		if n.NamespaceURI() != test.uri || n.LocalName() != test.name {
+			t.Errorf("expected <%s> in namespace %q, is %q:%q", test.name, test.uri, n.NamespaceURI(), n.LocalName())
+		}
+	}
+	attrs := findElement(t, root, "a").Attributes()
+	href := attrs.GetNamedItemNS(w3cdom.XLinkNamespace, "href")
+	if href == nil || href.Value() != "#x" || href.Namespace() != "xlink" || href.(*dom.W3CAttr).NodeName() != "xlink:href" {
+		t.Errorf("expected to find attribute xlink:href by namespace, found %v", href)
+	}
+	if attrs.GetNamedItem("xlink:href") == nil || attrs.GetNamedItemNS("", "href") != nil {
+		t.Errorf("expected xlink:href to be found by qualified name only")
+	}
+	if a := findElement(t, root, "svg").Attributes().GetNamedItemNS("", "viewBox"); a == nil || a.Value() != "0 0 10 10" {
+		t.Errorf("expected to find attribute viewBox without namespace, found %v", a)
+	}
+	//
+	h, err = html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = dom.FromHTMLParseTree(h, nil, dom.PreserveForeignContent(true))
+	for _, ns := range []string{"svg", "math"} {
+		n := findElement(t, root, ns)
+		if n.ForeignContent() != ns {
+			t.Errorf("expected <%s> to be root of foreign content, is %q", ns, n.ForeignContent())
+		}
+		if n.HasChildNodes() {
+			t.Errorf("expected content of <%s> not to be styled", ns)
+		}
+		if n.HTMLNode().FirstChild == nil {
+			t.Errorf("expected HTML content of <%s> to be kept", ns)
+		}
+	}
+	if text, _ := findElement(t, root, "p").TextContent(); text != "Text" {
+		t.Errorf("expected HTML content to be styled, text of <p> is %q", text)
+	}
+}
+
+func TestBoxSeeds(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	doc := `<html><head><title>Seeds</title></head><body><p>Hello <b>World</b></p>` +
+		`<div style="overflow: hidden"><span style="display: none">hidden</span>` +
+		`<pre>a  b
+c</pre></div><svg><circle r="4"/></svg></body></html>`
+	h, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, nil)
+	seeds := dom.BoxSeeds(root)
+	var b strings.Builder
+	for _, seed := range seeds {
+		name := seed.Node.NodeName()
+		if seed.IsText() {
+			name = fmt.Sprintf("%q", seed.Node.NodeValue())
+		}
+		level := "inline"
+		if seed.Layout.Outer.IsBlockLevel() {
+			level = "block"
+		}
+		fmt.Fprintf(&b, "%d %s %s %v %d|", seed.Depth, name, level,
+			seed.Layout.FormattingContext, len(seed.Text))
+	}
+	t.Logf("seeds = %s", b.String())
+	expected := `0 html block true 0|1 body block false 0|2 p block false 0|` +
+		`3 "Hello " inline false 1|3 b inline false 0|4 "World" inline false 1|` +
+		`2 div block true 0|3 pre block false 0|4 "a  b\nc" inline false 3|` +
+		`2 svg inline false 0|`
+	if b.String() != expected {
+		t.Errorf("expected seeds\n%s\nhave\n%s", expected, b.String())
+	}
+	if svg := seeds[len(seeds)-1]; svg.Foreign != "svg" {
+		t.Errorf("expected <svg> to be seed for foreign content, is %q", svg.Foreign)
+	}
+	if dom.BoxSeeds(nil) != nil {
+		t.Errorf("expected no seeds for nil")
+	}
+}
+
+func TestDocumentOptions(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	doc := `<html><head><base href="docs/"></head><body><!-- note -->` +
+		`<p><a href="intro.html#s1">Intro</a></p><noscript><p>No script</p></noscript></body></html>`
+	h, err := html.ParseWithOptions(strings.NewReader(doc), html.ParseOptionEnableScripting(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, _ := url.Parse("https://example.com/book/index.html")
+	opts := dom.DocumentOptions{BaseURL: location, ScriptingDisabled: true, PreserveComments: true}
+	d := dom.FromHTMLParseTreeWithOptions(h, nil, opts).OwnerDocument()
+	if d.Options().BaseURL != location || !d.Options().ScriptingDisabled {
+		t.Errorf("expected options to be available from document, have %+v", d.Options())
+	}
+	if base := d.BaseURL().String(); base != "https://example.com/book/docs/" {
+		t.Errorf("expected base URL to honor <base>, have %s", base)
+	}
+	links := dom.Links(d)
+	if len(links) != 1 || links[0].URL.String() != "https://example.com/book/docs/intro.html#s1" {
+		t.Errorf("expected link to be resolved against base URL, have %+v", links)
+	}
+	body := d.Body()
+	if first := body.FirstChild(); first.NodeName() != "#comment" || first.NodeValue() != " note " {
+		t.Errorf("expected comment to be preserved, have %v", first)
+	}
+	if !hasSeed(dom.BoxSeeds(body), "noscript") {
+		t.Errorf("expected <noscript> to generate a box with scripting disabled")
+	}
+	//
+	opts.IgnoreBaseElement = true
+	h, _ = html.Parse(strings.NewReader(doc))
+	d = dom.FromHTMLParseTreeWithOptions(h, nil, opts).OwnerDocument()
+	if u, _ := d.ResolveURL("img/a.png"); u.String() != "https://example.com/book/img/a.png" {
+		t.Errorf("expected <base> to be ignored, have %s", u)
+	}
+	d = dom.FromHTMLParseTree(h, nil).OwnerDocument()
+	if d.BaseURL().String() != "docs/" || d.Options().PreserveComments {
+		t.Errorf("expected default options, have %+v", d.Options())
+	}
+	if first := d.Body().FirstChild(); first.NodeName() == "#comment" {
+		t.Errorf("expected comment to be dropped by default")
+	}
+	if !hasSeed(dom.BoxSeeds(d.Body()), "noscript") {
+		t.Errorf("expected FromHTMLParseTree not to add styles for <noscript>")
+	}
+	d = dom.FromHTMLParseTreeWithOptions(h, nil, dom.DocumentOptions{}).OwnerDocument()
+	if hasSeed(dom.BoxSeeds(d.Body()), "noscript") {
+		t.Errorf("expected <noscript> to be hidden with scripting enabled")
+	}
+}
+
+func hasSeed(seeds []dom.BoxSeed, name string) bool {
+	for _, seed := range seeds {
+		if seed.Node.NodeName() == name {
+			return true
+		}
+	}
+	return false
+}
+
 /*
 func prepareStyledTree(t *testing.T) *tree.Node {
 	h, errhtml := html.Parse(strings.NewReader(myhtml))
@@ -143,6 +1667,26 @@ func TestDom2(t *testing.T) {
 
 // --- Helpers ----------------------------------------------------------
 
+// findElements finds the elements with a given name below root.
+func findElements(root *dom.W3CNode, name string) []*tree.Node[*styledtree.StyNode] {
+	nodes, _ := root.Walk().DescendentsWith(func(n, _ *tree.Node[*styledtree.StyNode]) (*tree.Node[*styledtree.StyNode], error) {
+		if n.Payload.HTMLNode().Type == html.ElementNode && n.Payload.HTMLNode().Data == name {
+			return n, nil
+		}
+		return nil, nil
+	}).Promise()()
+	return nodes
+}
+
+// findElement finds the single element with a given name below root.
+func findElement(t *testing.T, root *dom.W3CNode, name string) *dom.W3CNode {
+	nodes := findElements(root, name)
+	if len(nodes) != 1 {
+		t.Fatalf("expected to find 1 <%s>, found %d", name, len(nodes))
+	}
+	return dom.NodeFromStyledNode(nodes[0].Payload)
+}
+
 /*
 func domFmt(dn dom.RODomNode) string {
 	return dn.String()
@@ -0,0 +1,290 @@
+package domdbg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/template"
+
+	"github.com/npillmayer/fp/dom"
+	"github.com/npillmayer/fp/dom/style"
+)
+
+// Change states of nodes within a diff.
+const (
+	nodeUnchanged = iota
+	nodeAdded
+	nodeRemoved
+	nodeChanged
+)
+
+// DiffGraphViz outputs a diagram of the differences between two DOM trees, a and b.
+// The diagram is in GraphViz (DOT) format and shows the tree structure of b,
+// together with nodes of a which are not present in b any more:
+//
+//     - nodes only present in b (added) are drawn in green
+//     - nodes only present in a (removed) are drawn in red
+//     - nodes present in both trees are drawn in the usual color
+//     - text nodes with changed content are drawn in orange
+//
+// For nodes present in both trees, every property group with changed style
+// properties is shown as an orange table, listing the old and new values of all
+// properties which differ. Unchanged property groups are omitted from the diagram.
+//
+// Children of nodes are matched by node name, keeping document order as far as
+// possible (i.e., by a longest common subsequence of children).
+func DiffGraphViz(a, b *dom.W3CNode, w io.Writer) {
+	tmpl, err := template.New("dom").Parse(graphHeadTmpl)
+	if err != nil {
+		panic(err)
+	}
+	if err = tmpl.Execute(w, graphParamsType{Fontname: "Helvetica"}); err != nil {
+		panic(err)
+	}
+	d := &differ{w: w}
+	d.nodeTmpl = template.Must(template.New("diffnode").Funcs(
+		template.FuncMap{
+			"shortstring": shortText,
+		}).Parse(diffNodeTmpl))
+	d.edgeTmpl = template.Must(template.New("domedge").Parse(domEdgeTmpl))
+	d.groupTmpl = template.Must(template.New("diffgroup").Parse(diffGroupTmpl))
+	d.pgedgeTmpl = template.Must(template.New("pgedge").Parse(diffPgEdgeTmpl))
+	switch {
+	case a == nil && b == nil:
+	case a == nil:
+		d.subtree(b, nodeAdded)
+	case b == nil:
+		d.subtree(a, nodeRemoved)
+	case !sameKind(a, b):
+		d.subtree(a, nodeRemoved)
+		d.subtree(b, nodeAdded)
+	default:
+		d.diff(a, b)
+	}
+	w.Write([]byte("}\n"))
+}
+
+type differ struct {
+	w          io.Writer
+	count      int
+	nodeTmpl   *template.Template
+	edgeTmpl   *template.Template
+	groupTmpl  *template.Template
+	pgedgeTmpl *template.Template
+}
+
+type diffNode struct {
+	N     *dom.W3CNode
+	Name  string
+	State int
+}
+
+// Fill colors for the change states of nodes.
+func (n diffNode) Color() string {
+	switch n.State {
+	case nodeAdded:
+		return "palegreen"
+	case nodeRemoved:
+		return "salmon"
+	case nodeChanged:
+		return "orange"
+	}
+	if n.N.NodeName() == "#text" {
+		return "grey95"
+	}
+	return "lightblue3"
+}
+
+type propertyChange struct {
+	Key, Old, New string
+}
+
+type groupChange struct {
+	Node    string
+	Name    string
+	Changes []propertyChange
+}
+
+// diff outputs the diff of two nodes of the same kind and returns the name of the
+// resulting diagram node.
+func (d *differ) diff(a, b *dom.W3CNode) string {
+	state := nodeUnchanged
+	if a.NodeName() == "#text" && a.HTMLNode().Data != b.HTMLNode().Data {
+		state = nodeChanged
+	}
+	name := d.node(b, state)
+	for _, g := range groupChanges(a, b) {
+		g.Node = name
+		if err := d.groupTmpl.Execute(d.w, g); err != nil {
+			panic(err)
+		}
+		if err := d.pgedgeTmpl.Execute(d.w, g); err != nil {
+			panic(err)
+		}
+	}
+	ach, bch := children(a), children(b)
+	i, j := 0, 0
+	for _, m := range matchChildren(ach, bch) {
+		for ; i < m[0]; i++ {
+			d.edge(name, d.subtree(ach[i], nodeRemoved))
+		}
+		for ; j < m[1]; j++ {
+			d.edge(name, d.subtree(bch[j], nodeAdded))
+		}
+		d.edge(name, d.diff(ach[i], bch[j]))
+		i, j = i+1, j+1
+	}
+	for ; i < len(ach); i++ {
+		d.edge(name, d.subtree(ach[i], nodeRemoved))
+	}
+	for ; j < len(bch); j++ {
+		d.edge(name, d.subtree(bch[j], nodeAdded))
+	}
+	return name
+}
+
+// subtree outputs n and all of its descendents with a common change state.
+func (d *differ) subtree(n *dom.W3CNode, state int) string {
+	name := d.node(n, state)
+	for _, ch := range children(n) {
+		d.edge(name, d.subtree(ch, state))
+	}
+	return name
+}
+
+func (d *differ) node(n *dom.W3CNode, state int) string {
+	d.count++
+	name := fmt.Sprintf("node%05d", d.count)
+	if err := d.nodeTmpl.Execute(d.w, diffNode{n, name, state}); err != nil {
+		panic(err)
+	}
+	return name
+}
+
+func (d *differ) edge(from, to string) {
+	e := edge{node{Name: from}, node{Name: to}}
+	if err := d.edgeTmpl.Execute(d.w, e); err != nil {
+		panic(err)
+	}
+}
+
+func children(n *dom.W3CNode) []*dom.W3CNode {
+	var chs []*dom.W3CNode
+	if !n.HasChildNodes() {
+		return chs
+	}
+	for ch := n.FirstChild(); ch != nil; ch = ch.NextSibling() {
+		chs = append(chs, ch.(*dom.W3CNode))
+	}
+	return chs
+}
+
+func sameKind(a, b *dom.W3CNode) bool {
+	return a.NodeType() == b.NodeType() && a.NodeName() == b.NodeName()
+}
+
+// matchChildren returns index pairs of matching children, i.e. a longest common
+// subsequence of ach and bch with respect to sameKind.
+func matchChildren(ach, bch []*dom.W3CNode) [][2]int {
+	l := make([][]int, len(ach)+1)
+	for i := range l {
+		l[i] = make([]int, len(bch)+1)
+	}
+	for i := len(ach) - 1; i >= 0; i-- {
+		for j := len(bch) - 1; j >= 0; j-- {
+			if sameKind(ach[i], bch[j]) {
+				l[i][j] = l[i+1][j+1] + 1
+			} else if l[i+1][j] >= l[i][j+1] {
+				l[i][j] = l[i+1][j]
+			} else {
+				l[i][j] = l[i][j+1]
+			}
+		}
+	}
+	var pairs [][2]int
+	for i, j := 0, 0; i < len(ach) && j < len(bch); {
+		switch {
+		case sameKind(ach[i], bch[j]):
+			pairs = append(pairs, [2]int{i, j})
+			i, j = i+1, j+1
+		case l[i+1][j] >= l[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// groupChanges collects the style properties which differ between a and b,
+// grouped by property group and sorted by group name and property key.
+func groupChanges(a, b *dom.W3CNode) []groupChange {
+	amap, bmap := stylesOf(a), stylesOf(b)
+	names := make(map[string]bool)
+	for _, g := range amap.Groups() {
+		names[g.Name()] = true
+	}
+	for _, g := range bmap.Groups() {
+		names[g.Name()] = true
+	}
+	var changes []groupChange
+	for name := range names {
+		oldp, newp := propertiesOf(amap.Group(name)), propertiesOf(bmap.Group(name))
+		g := groupChange{Name: name}
+		for k, v := range oldp {
+			if nv, ok := newp[k]; !ok || nv != v {
+				g.Changes = append(g.Changes, propertyChange{k, string(v), string(nv)})
+			}
+		}
+		for k, nv := range newp {
+			if _, ok := oldp[k]; !ok {
+				g.Changes = append(g.Changes, propertyChange{k, "", string(nv)})
+			}
+		}
+		if len(g.Changes) > 0 {
+			sort.Slice(g.Changes, func(i, j int) bool { return g.Changes[i].Key < g.Changes[j].Key })
+			changes = append(changes, g)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+func stylesOf(n *dom.W3CNode) *style.PropertyMap {
+	if cs := n.ComputedStyles(); cs != nil {
+		return cs.Styles()
+	}
+	return nil
+}
+
+func propertiesOf(pg *style.PropertyGroup) map[string]style.Property {
+	props := make(map[string]style.Property)
+	if pg == nil {
+		return props
+	}
+	for _, kv := range pg.Properties() {
+		props[kv.Key] = kv.Value
+	}
+	return props
+}
+
+// --- Templates --------------------------------------------------------
+
+const diffNodeTmpl = `{{ if eq .N.NodeName "#text" }}
+{{ .Name }}	[ label={{ shortstring .N }} shape=box style=filled fillcolor={{ .Color }} fontname="Courier" fontsize=11.0 ] ;
+{{ else }}
+{{ .Name }}	[ label={{ printf "%q" .N.NodeName }} shape=ellipse style=filled fillcolor={{ .Color }} ] ;
+{{ end }}
+`
+
+const diffGroupTmpl = `"{{ .Node }}_{{ .Name }}" [ style="filled" penwidth=1 fillcolor="orange" shape="Mrecord" fontsize=12
+    label=<<table border="0" cellborder="0" cellpadding="2" cellspacing="0" bgcolor="orange">
+      <tr><td bgcolor="darkorange3" align="center" colspan="3"><font color="white">{{ .Name }}</font></td></tr>
+      {{ range .Changes }}
+      <tr><td align="right">{{ .Key }}:</td><td><s>{{ html .Old }}</s></td><td>{{ html .New }}</td></tr>
+      {{ end }}
+    </table>> ] ;
+`
+
+const diffPgEdgeTmpl = `{{ .Node }} -> "{{ .Node }}_{{ .Name }}" [dir=none weight=1 style="dashed" color="darkorange3"] ;
+`
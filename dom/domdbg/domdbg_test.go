@@ -0,0 +1,88 @@
+package domdbg_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/npillmayer/fp/dom"
+	"github.com/npillmayer/fp/dom/domdbg"
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/cssom/douceuradapter"
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+	"golang.org/x/net/html"
+)
+
+var graphviz = false
+
+func TestToGraphViz(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	h, err := html.Parse(strings.NewReader(`<html><body><p id="x">Hello</p></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := dom.FromHTMLParseTree(h, douceuradapter.Parse("p { color: red }", nil))
+	var dot bytes.Buffer
+	domdbg.ToGraphViz(root, &dot, nil)
+	if graphviz {
+		ioutil.WriteFile("dom.dot", dot.Bytes(), 0o644)
+	}
+	if !strings.HasPrefix(dot.String(), "digraph") || !strings.Contains(dot.String(), `label="p"`) {
+		t.Errorf("expected GraphViz digraph containing <p>, have\n%s", dot.String())
+	}
+}
+
+func TestDiffGraphViz(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.engine")
+	defer teardown()
+	//
+	styled := func(doc, css string) *dom.W3CNode {
+		h, err := html.Parse(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dom.FromHTMLParseTree(h, douceuradapter.Parse(css, nil))
+	}
+	a := styled(`<html><body><p>Hello</p><ul><li>item</li></ul></body></html>`, "p { color: red }")
+	b := styled(`<html><body><p>Hallo</p><div>new</div></body></html>`, "p { color: blue }")
+	var dot bytes.Buffer
+	domdbg.DiffGraphViz(a, b, &dot)
+	if graphviz {
+		ioutil.WriteFile("diff.dot", dot.Bytes(), 0o644)
+	}
+	lines := strings.Split(dot.String(), "\n")
+	colorOf := func(label string) string {
+		for _, line := range lines {
+			if strings.Contains(line, "label="+label+" ") {
+				if _, color, ok := strings.Cut(line, "fillcolor="); ok {
+					return strings.Fields(color)[0]
+				}
+			}
+		}
+		return ""
+	}
+	for label, color := range map[string]string{
+		`"ul"`:        "salmon",
+		`"li"`:        "salmon",
+		`"div"`:       "palegreen",
+		`"p"`:         "lightblue3",
+		`"\"Hallo\""`: "orange",
+	} {
+		if c := colorOf(label); c != color {
+			t.Errorf("expected node %s to be drawn in %s, is %q", label, color, c)
+		}
+	}
+	group := "_" + style.PGColor + `" [ style="filled"`
+	if n := strings.Count(dot.String(), group); n != 1 {
+		t.Errorf("expected 1 changed color group, have %d", n)
+	}
+	if !strings.Contains(dot.String(), "color:</td><td><s>red</s></td><td>blue</td>") {
+		t.Errorf("expected change of color from red to blue to be listed, have\n%s", dot.String())
+	}
+	if !strings.Contains(dot.String(), "_"+style.PGColor+`" [dir=none`) {
+		t.Errorf("expected changed color group to be connected to its node")
+	}
+}
@@ -0,0 +1,293 @@
+package dom
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/npillmayer/fp/dom/style/cssom"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+)
+
+// --- Extraction of records ------------------------------------------------------
+
+// ExtractSpec describes records of data to extract from a DOM.
+//
+// Records is a selector for the elements forming a record each. If Records is
+// empty, the node extraction starts at forms the only record.
+//
+// Fields maps the names of the fields of a record to accessors, relative to the
+// element of the record:
+//
+//     "h2"        text content of the first descendent matching selector "h2"
+//     "a@href"    attribute href of the first descendent matching selector "a"
+//     "@id"       attribute id of the record element
+//     "."         text content of the record element
+//
+// Text content is extracted with white space collapsed. Fields without a
+// matching element or attribute are set to an empty string.
+type ExtractSpec struct {
+	Records string            // selector for record elements
+	Fields  map[string]string // field name -> accessor
+}
+
+// ErrInvalidTarget is returned by ExtractInto if the target is not a pointer to
+// a struct or to a slice of structs.
+var ErrInvalidTarget = errors.New("extraction target must be a pointer to a struct or to a slice of structs")
+
+// Extract extracts records of data from the DOM below w (including w), as
+// described by spec. Records are returned in document order.
+func Extract(w *W3CNode, spec ExtractSpec) ([]map[string]string, error) {
+	tn, ok := NodeAsTreeNode(w)
+	if !ok {
+		return nil, ErrNotAStyledNode
+	}
+	fields, err := compileAccessors(spec.Fields)
+	if err != nil {
+		return nil, err
+	}
+	elements := []*tree.Node[*styledtree.StyNode]{tn}
+	if spec.Records != "" {
+		sel, err := cssom.CompileSelector(spec.Records)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector for records: %w", err)
+		}
+		elements = selectAll(tn, sel, nil)
+	}
+	records := make([]map[string]string, len(elements))
+	for i, el := range elements {
+		record := make(map[string]string, len(fields))
+		for name, acc := range fields {
+			record[name] = acc.extract(el)
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+// ExtractInto extracts records of data from the DOM below w (including w), as
+// described by spec, and stores them in target. target has to be a pointer to
+// a slice of structs, which receives all records, or a pointer to a struct,
+// which receives the first record (if any).
+//
+// Fields of records are stored in the struct field with a tag `dom:"name"`, or
+// else in the struct field with the name of the record field, ignoring case.
+// Struct fields may be of type string, bool, of integer or floating point
+// types, or implement encoding.TextUnmarshaler. Empty record fields leave
+// struct fields untouched.
+func ExtractInto(w *W3CNode, spec ExtractSpec, target interface{}) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return ErrInvalidTarget
+	}
+	v = v.Elem()
+	var structType reflect.Type
+	switch {
+	case v.Kind() == reflect.Struct:
+		structType = v.Type()
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		structType = v.Type().Elem()
+	default:
+		return ErrInvalidTarget
+	}
+	records, err := Extract(w, spec)
+	if err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Struct {
+		if len(records) > 0 {
+			return scanRecord(records[0], v)
+		}
+		return nil
+	}
+	slice := reflect.MakeSlice(v.Type(), len(records), len(records))
+	for i, record := range records {
+		if err := scanRecord(record, slice.Index(i)); err != nil {
+			return fmt.Errorf("record #%d of type %s: %w", i, structType, err)
+		}
+	}
+	v.Set(slice)
+	return nil
+}
+
+// scanRecord stores the fields of a record in the fields of struct v.
+func scanRecord(record map[string]string, v reflect.Value) error {
+	t := v.Type()
+	for name, value := range record {
+		if value == "" {
+			continue
+		}
+		i := structFieldFor(t, name)
+		if i < 0 {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// structFieldFor returns the index of the exported struct field to store
+// record field name in, or -1.
+func structFieldFor(t reflect.Type, name string) int {
+	candidate := -1
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		if tag, ok := f.Tag.Lookup("dom"); ok {
+			if tag == name {
+				return i
+			}
+		} else if candidate < 0 && strings.EqualFold(f.Name, name) {
+			candidate = i
+		}
+	}
+	return candidate
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// setField converts s to the type of a struct field and stores it.
+func setField(f reflect.Value, s string) error {
+	if f.CanAddr() && f.Addr().Type().Implements(textUnmarshalerType) {
+		return f.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(x)
+	default:
+		return fmt.Errorf("cannot store text in a field of type %s", f.Type())
+	}
+	return nil
+}
+
+// --- Accessors ------------------------------------------------------------------
+
+// accessor extracts a field of a record, relative to the record element.
+type accessor struct {
+	sel  cascadia.Selector // selector for a descendent, nil for the record element
+	attr string            // attribute to extract, or empty for text content
+}
+
+func compileAccessors(fields map[string]string) (map[string]accessor, error) {
+	accessors := make(map[string]accessor, len(fields))
+	for name, spec := range fields {
+		selector, attr := splitAccessor(spec)
+		acc := accessor{attr: attr}
+		if selector != "" && selector != "." {
+			sel, err := cssom.CompileSelector(selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid selector for field %q: %w", name, err)
+			}
+			acc.sel = sel
+		}
+		accessors[name] = acc
+	}
+	return accessors, nil
+}
+
+// splitAccessor splits an accessor into a selector and an attribute name. An
+// '@' is taken to introduce an attribute name only if it is followed by a plain
+// name, thus attribute selectors like a[href$="@example.com"] are left intact.
+func splitAccessor(spec string) (selector, attr string) {
+	spec = strings.TrimSpace(spec)
+	at := strings.LastIndexByte(spec, '@')
+	if at < 0 {
+		return spec, ""
+	}
+	name := spec[at+1:]
+	if name == "" || strings.IndexFunc(name, func(r rune) bool {
+		return !(r == '-' || r == '_' || r == ':' || r >= 'a' && r <= 'z' ||
+			r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) >= 0 {
+		return spec, ""
+	}
+	return strings.TrimSpace(spec[:at]), name
+}
+
+func (acc accessor) extract(record *tree.Node[*styledtree.StyNode]) string {
+	el := record
+	if acc.sel != nil {
+		if el = selectFirst(record, acc.sel); el == nil {
+			return ""
+		}
+	}
+	if acc.attr != "" {
+		v, _ := el.Payload.Attribute(acc.attr)
+		return v
+	}
+	var b strings.Builder
+	collectText(el, &b)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// selectAll appends the element nodes of the subtree of n (including n) matching
+// sel to nodes, in document order.
+func selectAll(n *tree.Node[*styledtree.StyNode], sel cascadia.Selector,
+	nodes []*tree.Node[*styledtree.StyNode]) []*tree.Node[*styledtree.StyNode] {
+	//
+	if h := n.Payload.HTMLNode(); h.Type == html.ElementNode && sel.Match(h) {
+		nodes = append(nodes, n)
+	}
+	for _, ch := range n.Children(true) {
+		nodes = selectAll(ch, sel, nodes)
+	}
+	return nodes
+}
+
+// selectFirst returns the first descendent of n matching sel, in document order.
+func selectFirst(n *tree.Node[*styledtree.StyNode], sel cascadia.Selector) *tree.Node[*styledtree.StyNode] {
+	for _, ch := range n.Children(true) {
+		if h := ch.Payload.HTMLNode(); h.Type == html.ElementNode && sel.Match(h) {
+			return ch
+		}
+		if match := selectFirst(ch, sel); match != nil {
+			return match
+		}
+	}
+	return nil
+}
+
+// collectText writes the text of the text nodes of the subtree of n to b.
+func collectText(n *tree.Node[*styledtree.StyNode], b *strings.Builder) {
+	if h := n.Payload.HTMLNode(); h.Type == html.TextNode {
+		b.WriteString(h.Data)
+		return
+	}
+	for _, ch := range n.Children(true) {
+		collectText(ch, b)
+	}
+}
@@ -0,0 +1,83 @@
+package dom
+
+import (
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"golang.org/x/net/html"
+)
+
+// --- Layout Hints ---------------------------------------------------------------
+
+// LayoutHints summarizes the style properties of a node which determine how
+// the node's box takes part in layout: 'display', 'float', 'position',
+// 'visibility' and 'overflow'.
+//
+// Boxes which are floated or absolutely positioned are blockified, i.e., their
+// outer display mode is BlockMode (as required by CSS 2.1, section 9.7).
+type LayoutHints struct {
+	Outer             css.DisplayMode // outer display mode: BlockMode, InlineMode or DisplayNone
+	Inner             css.DisplayMode // inner display mode, e.g. InnerInlineMode or FlexMode
+	Position          css.PositionT   // value of property 'position'
+	Floating          bool            // box is floated left or right
+	InFlow            bool            // box participates in normal flow
+	Visible           bool            // box is rendered; invisible boxes may still take up space
+	FormattingContext bool            // box establishes a new formatting context for its content
+}
+
+// LayoutHint combines display, float, position and visibility of a node into
+// layout hints. Properties are resolved along the cascade, see CascadedValue.
+// For nil, a hint with Outer = DisplayNone is returned.
+func LayoutHint(w *W3CNode) LayoutHints {
+	hints := LayoutHints{Outer: css.DisplayNone}
+	if w == nil {
+		return hints
+	}
+	disp, err := css.ParseDisplay(w.CascadedValue("display").String())
+	if err != nil {
+		tracer().Debugf("layout hints for %v: %v", w.NodeName(), err)
+	}
+	if disp == css.NoMode || disp.Contains(css.DisplayNone) {
+		return hints
+	}
+	hints.Outer, hints.Inner = disp.Outer(), disp.Inner()
+	hints.Position = css.Position(w.CascadedValue("position"))
+	outOfFlow := hints.Position.Match().Absolute(nil) != nil ||
+		hints.Position.Match().Fixed(nil) != nil
+	switch w.CascadedValue("float") {
+	case "left", "right", "inline-start", "inline-end":
+		hints.Floating = !outOfFlow // absolute positioning overrides floats
+	}
+	if hints.Floating || outOfFlow {
+		hints.Outer = css.BlockMode // blockification
+	}
+	hints.InFlow = !hints.Floating && !outOfFlow
+	switch w.CascadedValue("visibility") {
+	case "hidden", "collapse":
+	default:
+		hints.Visible = true
+	}
+	hints.FormattingContext = !hints.InFlow || establishesFormattingContext(w, disp)
+	return hints
+}
+
+// establishesFormattingContext is a predicate wether an in-flow box with
+// display mode disp establishes a new formatting context for its content.
+func establishesFormattingContext(w *W3CNode, disp css.DisplayMode) bool {
+	if disp.Overlaps(css.FlowRootMode | css.FlexMode | css.GridMode | css.TableMode) {
+		return true
+	}
+	if disp.Contains(css.InlineMode) && disp.Contains(css.InnerBlockMode) { // inline-block
+		return true
+	}
+	if h := w.HTMLNode(); h != nil && h.Type == html.ElementNode && h.Data == "html" {
+		return true // root element
+	}
+	if disp.Outer() == css.BlockMode {
+		switch w.CascadedValue("overflow") {
+		case style.NullStyle, "visible", "clip":
+		default:
+			return true
+		}
+	}
+	return false
+}
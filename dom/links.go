@@ -0,0 +1,144 @@
+package dom
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// --- Links and cross-references -------------------------------------------------
+
+// Link is a hyperlink of a document, i.e. an <a> or <area> element with an
+// href attribute.
+type Link struct {
+	Anchor   *W3CNode // the element carrying the href attribute
+	Href     string   // value of attribute href
+	URL      *url.URL // href resolved against the base URL of the document, nil if malformed
+	Fragment string   // fragment identifier (without '#'), percent-decoded
+	Internal bool     // href consists of a fragment only, i.e. refers to the document itself
+	Text     string   // text content of the anchor, with white space collapsed
+}
+
+// Links returns all hyperlinks of a document, in document order. URLs of links
+// are resolved against the base URL of the document (see W3CDocument.BaseURL).
+func Links(doc *W3CDocument) []Link {
+	if doc == nil {
+		return nil
+	}
+	tn, ok := NodeAsTreeNode(doc.W3CNode)
+	if !ok {
+		return nil
+	}
+	base := doc.BaseURL()
+	var links []Link
+	walkElements(tn, func(n *tree.Node[*styledtree.StyNode], h *html.Node) {
+		if h.Namespace != "" || (h.DataAtom != atom.A && h.DataAtom != atom.Area) {
+			return
+		}
+		href, ok := n.Payload.Attribute("href")
+		if !ok {
+			return
+		}
+		href = strings.TrimSpace(href)
+		link := Link{Anchor: domify(n), Href: href}
+		if u, err := resolveURL(base, href); err == nil {
+			link.URL = u
+		}
+		if rest, fragment, found := strings.Cut(href, "#"); found {
+			if f, err := url.PathUnescape(fragment); err == nil {
+				fragment = f
+			}
+			link.Fragment = fragment
+			link.Internal = rest == ""
+		}
+		var b strings.Builder
+		collectText(n, &b)
+		link.Text = strings.Join(strings.Fields(b.String()), " ")
+		links = append(links, link)
+	})
+	return links
+}
+
+// InternalRefs is the result of checking the intra-document references of a
+// document. See ResolveInternalRefs.
+type InternalRefs struct {
+	Links      []Link              // internal links, in document order
+	Targets    map[string]*W3CNode // targets of internal links, by fragment
+	Dangling   []Link              // internal links without a target, in document order
+	Duplicates []string            // ids used for more than one element, in order of first use
+}
+
+// OK is true if every internal link has a target and no id is used twice.
+func (refs InternalRefs) OK() bool {
+	return len(refs.Dangling) == 0 && len(refs.Duplicates) == 0
+}
+
+// ResolveInternalRefs resolves the fragment references of the internal links of a
+// document (see Links) against the elements of the document. A fragment refers to
+// the first element with a matching id or, lacking one, to the first <a> element
+// with a matching name. Empty fragments and fragment "top" (ignoring case) refer
+// to the top of the document, if no element matches.
+//
+// Links to fragments of other documents are not checked.
+func ResolveInternalRefs(doc *W3CDocument) InternalRefs {
+	var refs InternalRefs
+	refs.Targets = make(map[string]*W3CNode)
+	if doc == nil {
+		return refs
+	}
+	tn, ok := NodeAsTreeNode(doc.W3CNode)
+	if !ok {
+		return refs
+	}
+	ids := make(map[string]*tree.Node[*styledtree.StyNode])
+	names := make(map[string]*tree.Node[*styledtree.StyNode])
+	reported := make(map[string]bool)
+	walkElements(tn, func(n *tree.Node[*styledtree.StyNode], h *html.Node) {
+		if id, ok := n.Payload.Attribute("id"); ok && id != "" {
+			if _, dup := ids[id]; !dup {
+				ids[id] = n
+			} else if !reported[id] {
+				refs.Duplicates = append(refs.Duplicates, id)
+				reported[id] = true
+			}
+		}
+		if h.Namespace == "" && h.DataAtom == atom.A {
+			if name, ok := n.Payload.Attribute("name"); ok && name != "" && names[name] == nil {
+				names[name] = n
+			}
+		}
+	})
+	for _, link := range Links(doc) {
+		if !link.Internal {
+			continue
+		}
+		refs.Links = append(refs.Links, link)
+		if _, ok := refs.Targets[link.Fragment]; ok {
+			continue
+		}
+		if n := ids[link.Fragment]; n != nil {
+			refs.Targets[link.Fragment] = domify(n)
+		} else if n := names[link.Fragment]; n != nil {
+			refs.Targets[link.Fragment] = domify(n)
+		} else if link.Fragment == "" || strings.EqualFold(link.Fragment, "top") {
+			refs.Targets[link.Fragment] = doc.W3CNode
+		} else {
+			refs.Dangling = append(refs.Dangling, link)
+		}
+	}
+	return refs
+}
+
+// walkElements calls f for every element node of the subtree of n, in document order.
+func walkElements(n *tree.Node[*styledtree.StyNode], f func(*tree.Node[*styledtree.StyNode], *html.Node)) {
+	if h := n.Payload.HTMLNode(); h != nil && h.Type == html.ElementNode {
+		f(n, h)
+	}
+	for _, ch := range n.Children(true) {
+		walkElements(ch, f)
+	}
+}
@@ -0,0 +1,165 @@
+package dom
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/dom/w3cdom"
+	"github.com/npillmayer/fp/tree"
+)
+
+// --- NodeList -------------------------------------------------------------------
+
+// A W3CNodeList is a type for a list of nodes. Node lists come in two flavours:
+//
+// ▪︎ Static node lists are snapshots of nodes, created with StaticNodeList.
+// Changes to the DOM do not affect the list.
+//
+// ▪︎ Live node lists, created with LiveNodeList, hold the children of a parent
+// node. They reflect changes to the children of the parent, e.g. by AdoptNode.
+//
+// ChildNodes and Children of W3CNode return live node lists. Use Snapshot to
+// get a static copy of a live list.
+//
+// Live lists cache the nodes collected from the parent node, until the children
+// of the parent are modified.
+type W3CNodeList struct {
+	nodes   []*W3CNode          // nodes of a static list, cached nodes of a live list
+	live    bool                // is this a live list?
+	parent  *W3CNode            // parent node of a live list
+	filter  func(*W3CNode) bool // filter for children of a live list; nil for all children
+	mx      sync.Mutex          // guards the cache of a live list
+	cached  bool                // are nodes valid for a live list?
+	version uint64              // version of the parent's children the cache reflects
+}
+
+var _ w3cdom.NodeList = &W3CNodeList{}
+
+// StaticNodeList creates a node list which is a snapshot of nodes.
+func StaticNodeList(nodes ...*W3CNode) *W3CNodeList {
+	return &W3CNodeList{nodes: nodes}
+}
+
+// LiveNodeList creates a live node list for the children of parent. If filter
+// is non-nil, only children for which filter returns true are part of the list.
+func LiveNodeList(parent *W3CNode, filter func(*W3CNode) bool) *W3CNodeList {
+	return &W3CNodeList{live: true, parent: parent, filter: filter}
+}
+
+// IsLive returns true if wl is a live node list.
+func (wl *W3CNodeList) IsLive() bool {
+	return wl != nil && wl.live
+}
+
+// Snapshot returns a static node list with the current nodes of wl.
+func (wl *W3CNodeList) Snapshot() *W3CNodeList {
+	return StaticNodeList(wl.current()...)
+}
+
+// current returns the nodes of wl. For static lists this is the snapshot of
+// nodes, for live lists the nodes are collected from the parent node, if the
+// children of the parent have changed since they have been collected last.
+//
+// Clients must not modify the slice returned.
+func (wl *W3CNodeList) current() []*W3CNode {
+	if wl == nil {
+		return nil
+	}
+	if !wl.live {
+		return wl.nodes
+	}
+	tn, ok := NodeAsTreeNode(wl.parent)
+	if !ok {
+		return nil
+	}
+	wl.mx.Lock()
+	defer wl.mx.Unlock()
+	if version := tn.ChildrenVersion(); !wl.cached || version != wl.version {
+		wl.nodes, wl.version, wl.cached = collectChildren(tn, wl.filter), version, true
+	}
+	return wl.nodes
+}
+
+// collectChildren returns the children of tn for which filter returns true,
+// or all children if filter is nil.
+func collectChildren(tn *tree.Node[*styledtree.StyNode], filter func(*W3CNode) bool) []*W3CNode {
+	children := tn.Children(true)
+	nodes := make([]*W3CNode, 0, len(children))
+	for _, ch := range children {
+		w := &W3CNode{styledtree.Node(ch)}
+		if filter == nil || filter(w) {
+			nodes = append(nodes, w)
+		}
+	}
+	return nodes
+}
+
+// Length returns the number of Nodes in a list
+func (wl *W3CNodeList) Length() int {
+	return len(wl.current())
+}
+
+// Item returns the i.th Node
+func (wl *W3CNodeList) Item(i int) w3cdom.Node {
+	nodes := wl.current()
+	if i >= len(nodes) || i < 0 {
+		return nil
+	}
+	return nodes[i]
+}
+
+// ForEach calls f for every node of the list, in order. For live lists, the
+// nodes are determined once, before the first call to f.
+func (wl *W3CNodeList) ForEach(f func(int, w3cdom.Node)) {
+	for i, n := range wl.current() {
+		f(i, n)
+	}
+}
+
+// Iter returns an iterator over the nodes of the list. For live lists, the
+// iterator works on the nodes present at the time of the call to Iter.
+func (wl *W3CNodeList) Iter() w3cdom.NodeIterator {
+	return &W3CNodeIterator{nodes: wl.current(), index: -1}
+}
+
+func (wl *W3CNodeList) String() string {
+	var s bytes.Buffer
+	s.WriteString("[ ")
+	for _, n := range wl.current() {
+		s.WriteString(n.NodeName())
+		s.WriteString(" ")
+	}
+	s.WriteString("]")
+	return s.String()
+}
+
+// W3CNodeIterator is an iterator over the nodes of a W3CNodeList.
+type W3CNodeIterator struct {
+	nodes []*W3CNode
+	index int // index of the current node
+}
+
+var _ w3cdom.NodeIterator = &W3CNodeIterator{}
+
+// Next moves the iterator to the next node. It returns false if there are no
+// more nodes.
+func (it *W3CNodeIterator) Next() bool {
+	if it == nil || it.index+1 >= len(it.nodes) {
+		return false
+	}
+	it.index++
+	return true
+}
+
+// Index returns the index of the current node.
+// It is illegal to call Index if Next has not returned true.
+func (it *W3CNodeIterator) Index() int {
+	return it.index
+}
+
+// Node returns the current node.
+// It is illegal to call Node if Next has not returned true.
+func (it *W3CNodeIterator) Node() w3cdom.Node {
+	return it.nodes[it.index]
+}
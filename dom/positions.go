@@ -0,0 +1,49 @@
+package dom
+
+// --- Document positions ---------------------------------------------------------
+
+// DocumentPosition returns the position of w within its document, i.e. the
+// ordinal of w in a depth-first pre-order traversal, with the document node at
+// position 0. Nodes which are not part of a styled document do not have a
+// position.
+//
+// Positions are maintained by an ordered index of the document's nodes, which is
+// set up by styling and is kept in sync by AdoptNode and Normalize.
+func (w *W3CNode) DocumentPosition() (int, bool) {
+	if w == nil {
+		return -1, false
+	}
+	return w.Index().Position(w.StyNode)
+}
+
+// NodesBetween returns the nodes of a document from anchor a up to and including
+// anchor b, in document order. If b precedes a, the anchors are swapped. This is
+// useful for collecting the content between two anchors, e.g. for index entries
+// spanning page ranges.
+//
+// Descendents of a which precede b are part of the result. If a and b do not
+// belong to the same document, an empty list is returned.
+//
+// For a document of n nodes and a result of k nodes, finding the nodes takes
+// O(log n + k) time if the positions of the nodes are up to date. Modifications
+// of the document leave the positions preceding the modified nodes intact; the
+// positions following are re-computed first (see styledtree.NodeIndex.Position).
+func NodesBetween(a, b *W3CNode) *W3CNodeList {
+	if a == nil || b == nil || a.Index() == nil || a.Index() != b.Index() {
+		return StaticNodeList()
+	}
+	from, ok1 := a.DocumentPosition()
+	to, ok2 := b.DocumentPosition()
+	if !ok1 || !ok2 {
+		return StaticNodeList()
+	}
+	if to < from {
+		from, to = to, from
+	}
+	styled := a.Index().Range(from, to+1)
+	nodes := make([]*W3CNode, len(styled))
+	for i, sn := range styled {
+		nodes[i] = NodeFromStyledNode(sn)
+	}
+	return StaticNodeList(nodes...)
+}
@@ -0,0 +1,42 @@
+package dom
+
+import (
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/dom/w3cdom"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+)
+
+// --- Queries by style -----------------------------------------------------------
+
+// QueryByStyle returns the element nodes below w whose computed styles satisfy
+// a predicate, in document order. w itself is not part of the result. Queries
+// by style are useful for auditing a document before layout, e.g.
+//
+//     nodes, err := doc.QueryByStyle(func(cs w3cdom.ComputedStyles) bool {
+//         return cs.GetPropertyValue("position") == "absolute"
+//     })
+func (w *W3CNode) QueryByStyle(predicate func(w3cdom.ComputedStyles) bool) (*W3CNodeList, error) {
+	if w == nil || predicate == nil {
+		return StaticNodeList(), nil
+	}
+	root := &w.Node
+	styled, err := w.Walk().TopDownDF(
+		func(n, _ *tree.Node[*styledtree.StyNode], _ int) (*tree.Node[*styledtree.StyNode], error) {
+			if n == root || n.Payload.HTMLNode().Type != html.ElementNode {
+				return nil, nil
+			}
+			if predicate(domify(n).ComputedStyles()) {
+				return n, nil
+			}
+			return nil, nil
+		}).Promise()()
+	if err != nil {
+		return StaticNodeList(), err
+	}
+	nodes := make([]*W3CNode, len(styled))
+	for i, n := range styled {
+		nodes[i] = domify(n)
+	}
+	return StaticNodeList(nodes...), nil
+}
@@ -0,0 +1,75 @@
+package dom
+
+import (
+	"fmt"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+)
+
+// StyleSharingReport holds statistics about the sharing of property groups
+// within a styled tree. See style.GroupInterner.
+type StyleSharingReport struct {
+	Nodes      int // number of nodes carrying style properties
+	GroupRefs  int // number of references from nodes to property groups
+	Groups     int // number of distinct property groups referenced
+	Duplicates int // number of distinct groups with the content of another group
+}
+
+// Shared returns the number of group references saved by sharing, i.e. the
+// number of references not needing a property group of their own.
+func (r StyleSharingReport) Shared() int {
+	return r.GroupRefs - r.Groups
+}
+
+func (r StyleSharingReport) String() string {
+	return fmt.Sprintf("%d styled nodes referencing %d property groups: %d distinct, %d shared, %d duplicates",
+		r.Nodes, r.GroupRefs, r.Groups, r.Shared(), r.Duplicates)
+}
+
+// StyleSharing reports on how property groups are shared between the nodes of
+// the subtree starting at w. Duplicates are groups which have not been shared,
+// although another group has the same content and parent group. Trees created
+// by FromHTMLParseTree should not contain duplicates.
+//
+// If w is nil, an empty report is returned.
+func StyleSharing(w *W3CNode) StyleSharingReport {
+	var r StyleSharingReport
+	if w == nil {
+		return r
+	}
+	tn, ok := NodeAsTreeNode(w)
+	if !ok {
+		return r
+	}
+	distinct := make(map[*style.PropertyGroup]bool)
+	bySignature := make(map[uint64][]*style.PropertyGroup)
+	var collect func(n *tree.Node[*styledtree.StyNode])
+	collect = func(n *tree.Node[*styledtree.StyNode]) {
+		if groups := n.Payload.Styles().Groups(); len(groups) > 0 {
+			r.Nodes++
+			for _, g := range groups {
+				r.GroupRefs++
+				if distinct[g] {
+					continue
+				}
+				distinct[g] = true
+				sig := g.Signature()
+				for _, other := range bySignature[sig] {
+					if other.SameContent(g) {
+						r.Duplicates++
+						break
+					}
+				}
+				bySignature[sig] = append(bySignature[sig], g)
+			}
+		}
+		for _, ch := range n.Children(true) {
+			collect(ch)
+		}
+	}
+	collect(tn)
+	r.Groups = len(distinct)
+	return r
+}
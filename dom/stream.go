@@ -0,0 +1,82 @@
+package dom
+
+import (
+	"io"
+
+	"github.com/npillmayer/fp/dom/style/cssom"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+)
+
+// StyledEventType is the type of events emitted by StreamStyled.
+type StyledEventType uint8
+
+// Types of styled events.
+const (
+	OpenEvent  StyledEventType = iota + 1 // entering a document or element node
+	CloseEvent                            // leaving a document or element node
+	TextEvent                             // a text node
+)
+
+func (t StyledEventType) String() string {
+	switch t {
+	case OpenEvent:
+		return "open"
+	case CloseEvent:
+		return "close"
+	case TextEvent:
+		return "text"
+	}
+	return "<unknown event>"
+}
+
+// StyledEvent is emitted by StreamStyled for nodes of a styled document.
+//
+// Node is valid during the call to the event handler only. During the call, Node
+// is connected to its ancestors, i.e. ComputedStyles() and CascadedValue(…) may be
+// used to access the styles of the node. Descendents and siblings of Node are not
+// accessible.
+type StyledEvent struct {
+	Type  StyledEventType
+	Node  *W3CNode
+	Depth int // depth of Node, the document node has depth 0
+}
+
+// StreamStyled parses an HTML document from r and styles it node by node, in
+// document order, calling handler for every node. This is an alternative to
+// FromHTMLParseTree(…) for very large documents, where the styled tree with
+// styles expanded would be too large to hold in memory. Subtrees are released
+// as soon as their CloseEvent has been handled.
+//
+// Document and element nodes produce an OpenEvent and a CloseEvent, enclosing
+// the events of their children. Text nodes produce a TextEvent.
+//
+// Style sheets are taken from <style> elements of the document and from css,
+// which may be nil. Please note that the HTML parse tree itself is built in full,
+// as CSS selectors may refer to siblings of nodes.
+//
+// If handler returns an error, streaming is aborted and the error is returned.
+func StreamStyled(r io.Reader, css cssom.StyleSheet, handler func(ev StyledEvent) error) error {
+	h, err := html.Parse(r)
+	if err != nil {
+		return err
+	}
+	s := cssomForDocument(h, css)
+	depth := 0
+	return s.StyleStream(h, func(n *tree.Node[*styledtree.StyNode], entering bool) error {
+		w := domify(n)
+		if w.NodeType() == html.TextNode {
+			if !entering {
+				return nil
+			}
+			return handler(StyledEvent{TextEvent, w, depth})
+		}
+		if entering {
+			depth++
+			return handler(StyledEvent{OpenEvent, w, depth - 1})
+		}
+		depth--
+		return handler(StyledEvent{CloseEvent, w, depth})
+	})
+}
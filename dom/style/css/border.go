@@ -0,0 +1,131 @@
+package css
+
+import (
+	"image/color"
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+)
+
+// --- Border style ----------------------------------------------------------
+
+// BorderStyle is an enum type for CSS properties border-*-style.
+type BorderStyle uint8
+
+// Values for CSS properties border-*-style.
+const (
+	BorderNone   BorderStyle = iota // no border (default)
+	BorderHidden                    // no border, wins in table border conflicts
+	BorderDotted
+	BorderDashed
+	BorderSolid
+	BorderDouble
+	BorderGroove
+	BorderRidge
+	BorderInset
+	BorderOutset
+)
+
+var borderStyleNames = [...]string{"none", "hidden", "dotted", "dashed", "solid",
+	"double", "groove", "ridge", "inset", "outset"}
+
+func (bs BorderStyle) String() string {
+	if int(bs) < len(borderStyleNames) {
+		return borderStyleNames[bs]
+	}
+	return "none"
+}
+
+// ParseBorderStyle returns the border style for a property string.
+// Unknown values result in BorderNone.
+func ParseBorderStyle(p style.Property) BorderStyle {
+	s := strings.ToLower(strings.TrimSpace(string(p)))
+	for i, name := range borderStyleNames {
+		if s == name {
+			return BorderStyle(i)
+		}
+	}
+	return BorderNone
+}
+
+// IsVisible is false for border styles none and hidden.
+func (bs BorderStyle) IsVisible() bool {
+	return bs != BorderNone && bs != BorderHidden
+}
+
+// --- Border model ----------------------------------------------------------
+
+// BorderEdge holds the typed border properties of one edge of a box.
+type BorderEdge struct {
+	Width DimenT      // border width; zero for invisible border styles
+	Style BorderStyle // border style
+	Color color.Color // border color; nil means the foreground color of the element
+}
+
+// IsVisible is true if an edge has a visible style and a non-zero width.
+func (e BorderEdge) IsVisible() bool {
+	return e.Style.IsVisible() && !(e.Width.IsAbsolute() && e.Width.d == 0)
+}
+
+// BorderT is the border model of a box, aggregated from the 16 longhand
+// properties border-{top,right,bottom,left}-{width,style,color} and
+// border-{top-left,top-right,bottom-right,bottom-left}-radius.
+type BorderT struct {
+	Top, Right, Bottom, Left BorderEdge
+	TopLeftRadius            DimenT
+	TopRightRadius           DimenT
+	BottomRightRadius        DimenT
+	BottomLeftRadius         DimenT
+}
+
+// Edges returns the border edges in CSS order top, right, bottom, left.
+func (b BorderT) Edges() [4]BorderEdge {
+	return [4]BorderEdge{b.Top, b.Right, b.Bottom, b.Left}
+}
+
+// Border aggregates the border properties of a property map into a typed
+// border model. Properties missing from styles are set to their initial
+// values, as are CSS-wide keywords, which should have been resolved before
+// (see ResolveProperty).
+//
+// As required by CSS, the width of an edge with border style none or hidden
+// is zero, regardless of the value of border-*-width.
+func Border(styles *style.PropertyMap) BorderT {
+	return BorderT{
+		Top:               borderEdge(styles, "top"),
+		Right:             borderEdge(styles, "right"),
+		Bottom:            borderEdge(styles, "bottom"),
+		Left:              borderEdge(styles, "left"),
+		TopLeftRadius:     DimenOption(borderProperty(styles, "border-top-left-radius")),
+		TopRightRadius:    DimenOption(borderProperty(styles, "border-top-right-radius")),
+		BottomRightRadius: DimenOption(borderProperty(styles, "border-bottom-right-radius")),
+		BottomLeftRadius:  DimenOption(borderProperty(styles, "border-bottom-left-radius")),
+	}
+}
+
+func borderEdge(styles *style.PropertyMap, dir string) BorderEdge {
+	edge := BorderEdge{
+		Style: ParseBorderStyle(borderProperty(styles, "border-"+dir+"-style")),
+		Width: JustDimen(0),
+	}
+	if edge.Style.IsVisible() {
+		edge.Width = DimenOption(borderProperty(styles, "border-"+dir+"-width"))
+	}
+	switch c := borderProperty(styles, "border-"+dir+"-color"); c {
+	case "default", "currentcolor", style.NullStyle:
+	default:
+		edge.Color = c.Color()
+	}
+	return edge
+}
+
+// borderProperty looks up a border property, substituting its initial value
+// if it is missing or a CSS-wide keyword.
+func borderProperty(styles *style.PropertyMap, key string) style.Property {
+	if styles != nil {
+		if p, ok := styles.Property(key); ok && !p.IsEmpty() && !p.IsCSSWideKeyword() {
+			return p
+		}
+	}
+	return style.InitialValue(key)
+}
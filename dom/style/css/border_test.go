@@ -0,0 +1,47 @@
+package css_test
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/tyse/core/dimen"
+)
+
+func TestBorder(t *testing.T) {
+	if bs := css.ParseBorderStyle("Dashed"); bs != css.BorderDashed || bs.String() != "dashed" {
+		t.Errorf("expected border style to be dashed, is %s", bs)
+	}
+	b := css.Border(nil)
+	for i, e := range b.Edges() {
+		if e.Style != css.BorderNone || e.IsVisible() || e.Color != nil {
+			t.Errorf("expected edge #%d to be invisible by default, is %v", i, e)
+		}
+	}
+	border := style.NewPropertyGroup(style.PGBorder)
+	border.Set("border-top-style", "solid")
+	border.Set("border-top-width", "2pt")
+	border.Set("border-top-color", "red")
+	border.Set("border-left-style", "double")
+	border.Set("border-bottom-style", "none")
+	border.Set("border-bottom-width", "5pt")
+	border.Set("border-right-style", "inherit")
+	border.Set("border-top-left-radius", "4pt")
+	b = css.Border(style.NewPropertyMap().AddAllFromGroup(border, false))
+	if !b.Top.IsVisible() || b.Top.Width != css.JustDimen(2*dimen.PT) || b.Top.Color != (color.RGBA{0xff, 0, 0, 0xff}) {
+		t.Errorf("expected top edge to be 2pt solid red, is %v", b.Top)
+	}
+	if b.Left.Style != css.BorderDouble || b.Left.Width != css.JustDimen(dimen.PX) {
+		t.Errorf("expected left edge to be medium double, is %v", b.Left)
+	}
+	if b.Bottom.IsVisible() || b.Bottom.Width != css.JustDimen(0) {
+		t.Errorf("expected bottom edge of style none to have zero width, is %v", b.Bottom)
+	}
+	if b.Right.Style != css.BorderNone {
+		t.Errorf("expected CSS-wide keyword to result in initial style none, is %s", b.Right.Style)
+	}
+	if b.TopLeftRadius != css.JustDimen(4*dimen.PT) || b.BottomRightRadius != css.JustDimen(0) {
+		t.Errorf("expected radii 4pt/0, are %v/%v", b.TopLeftRadius, b.BottomRightRadius)
+	}
+}
@@ -8,10 +8,26 @@ import (
 	"github.com/npillmayer/fp/dom/styledtree"
 )
 
-// GetCascadedProperty gets the value of a property. The search cascades to
-// parent property maps, if available.
+// --- Levels of property values ---------------------------------------
+
+// The value of a style property for a styled node may be inspected at three
+// levels (see https://www.w3.org/TR/css-cascade-4/#value-stages):
+//
+//     GetLocalProperty      the value the style rules specified for the node, if any
+//     GetCascadedProperty   the winning value for the node, before inheritance
+//                           and CSS-wide keywords are applied
+//     GetComputedProperty   the value after inheritance and resolution of
+//                           CSS-wide keywords
 //
-// Clients will usually call GetProperty(…) instead as this will respect
+// Layout will usually need computed values only, while the other levels are
+// helpful for debugging styles.
+
+// GetCascadedProperty gets the value of a property. If the property is not set
+// locally for the node, the search cascades to the property groups of
+// ancestors, regardless of wether the property is inherited or not.
+// CSS-wide keywords ("inherit", "initial", …) are returned unresolved.
+//
+// Clients will usually call GetComputedProperty(…) instead as this will respect
 // CSS semantics for inherited properties.
 //
 // The call to GetCascadedProperty will flag an error if the style property
@@ -28,7 +44,7 @@ func GetCascadedProperty(node *styledtree.StyNode, key string) (style.Property,
 	var group *style.PropertyGroup
 	for node != nil && group == nil {
 		group = node.Styles().Group(groupname)
-		node = node.Parent().Payload
+		node = parentStyNode(node)
 	}
 	if group == nil {
 		errmsg := fmt.Sprintf("Cannot find ancestor with prop-group %s -- did you create global properties?", groupname)
@@ -38,19 +54,30 @@ func GetCascadedProperty(node *styledtree.StyNode, key string) (style.Property,
 	return p, nil // must succeed
 }
 
-// GetProperty gets the value of a property. If the property is not set
-// locally on the style node and the property is inheritable, he search
-// cascades to parent property maps, if available.
+// GetComputedProperty gets the computed value of a property. If the property
+// is not set locally on the style node and the property is inheritable, the
+// search cascades to parent property maps, if available. Properties which are
+// not inheritable and not set locally get their user-agent default.
 //
-// The call to GetProperty will flag an error if the style property isn't found
-// (which should not happen, as every property should be included in the
-// 'user-agent' default style properties).
-func GetProperty(node *styledtree.StyNode, key string) (style.Property, error) {
+// The call to GetComputedProperty will flag an error if the style property
+// isn't found (which should not happen, as every property should be included
+// in the 'user-agent' default style properties).
+//
+// CSS-wide keywords ("initial", "inherit", "unset", "revert") are resolved as
+// described for ResolveProperty.
+func GetComputedProperty(node *styledtree.StyNode, key string) (style.Property, error) {
 	if style.IsCascading(key) {
-		return GetCascadedProperty(node, key)
+		p, err := GetCascadedProperty(node, key)
+		if err == nil && p.IsCSSWideKeyword() {
+			p = ResolveProperty(node, key)
+		}
+		return p, err
 	}
 	//T().Debugf("css get property: %s is not inherited", key)
 	p := GetLocalProperty(node.Styles(), key)
+	if p.IsCSSWideKeyword() {
+		return ResolveProperty(node, key), nil
+	}
 	if p == style.NullStyle {
 		p = style.GetUserAgentDefaultProperty(node.HTMLNode(), key)
 	}
@@ -58,8 +85,16 @@ func GetProperty(node *styledtree.StyNode, key string) (style.Property, error) {
 	return p, nil
 }
 
+// GetProperty gets the computed value of a property. It is the same as
+// GetComputedProperty.
+func GetProperty(node *styledtree.StyNode, key string) (style.Property, error) {
+	return GetComputedProperty(node, key)
+}
+
 // GetLocalProperty returns a style property value, if it is set locally
-// for a styled node's property map. No cascading is performed.
+// for a styled node's property map, i.e. the value the style rules specified
+// for the node. No cascading is performed and CSS-wide keywords are returned
+// unresolved. If the property is not set locally, NullStyle is returned.
 func GetLocalProperty(pmap *style.PropertyMap, key string) style.Property {
 	groupname := style.GroupNameFromPropertyKey(key)
 	var group *style.PropertyGroup
@@ -70,3 +105,102 @@ func GetLocalProperty(pmap *style.PropertyMap, key string) style.Property {
 	p, _ := group.Get(key)
 	return p
 }
+
+// ResolveProperty resolves the value of a style property for a styled node,
+// respecting the CSS-wide keywords "inherit", "initial", "unset" and "revert":
+//
+// For inherited properties, the search walks the chain of property groups,
+// starting at the nearest ancestor (or self) with a property group for key.
+// For non-inherited properties, only the value set locally for the node is
+// considered. If no value is specified, the user-agent default is returned.
+//
+// A user-agent default is either a per-element default (e.g., for "display")
+// or the initial value. An initial value is either the initial value of the
+// CSS specification (see style.InitialValue) or the value of the default
+// style properties at the root of the styled tree.
+//
+// The keywords resolve as follows:
+//
+//     inherit   the resolved value of the parent node
+//     initial   the initial value
+//     unset     like inherit for inherited properties, otherwise like initial
+//     revert    the user-agent default, i.e. rolls back author styles
+//
+// As the user-agent does not define per-element defaults for inherited
+// properties, revert behaves like unset for them.
+func ResolveProperty(node *styledtree.StyNode, key string) style.Property {
+	if node == nil {
+		return style.NullStyle
+	}
+	if !style.IsCascading(key) {
+		p := GetLocalProperty(node.Styles(), key)
+		switch p {
+		case "inherit":
+			if parent := parentStyNode(node); parent != nil {
+				return ResolveProperty(parent, key)
+			}
+			return initialProperty(node, key)
+		case "initial", "unset":
+			return initialProperty(node, key)
+		case style.NullStyle, "revert":
+			return defaultProperty(node, key)
+		}
+		return p
+	}
+	groupname := style.GroupNameFromPropertyKey(key)
+	for n := node; n != nil; n = parentStyNode(n) {
+		group := n.Styles().Group(groupname)
+		if group == nil {
+			continue // search upwards for a node with property group attached
+		}
+		for ; group != nil; group = group.Parent { // walk the cascade of groups
+			p, _ := group.Get(key)
+			switch p {
+			case style.NullStyle, "inherit", "unset", "revert":
+				continue
+			case "initial": // descendents of n inherit the initial value of n
+				return initialProperty(n, key)
+			}
+			return p
+		}
+		break
+	}
+	return defaultProperty(node, key)
+}
+
+// defaultProperty returns the user-agent default of a style property for a node.
+func defaultProperty(node *styledtree.StyNode, key string) style.Property {
+	if p := style.GetUserAgentDefaultProperty(node.HTMLNode(), key); p != style.NullStyle {
+		return p
+	}
+	return rootProperty(node, key)
+}
+
+// initialProperty returns the initial value of a style property.
+func initialProperty(node *styledtree.StyNode, key string) style.Property {
+	if p := style.InitialValue(key); p != style.NullStyle {
+		return p
+	}
+	return rootProperty(node, key)
+}
+
+// rootProperty returns the value of a style property from the default
+// properties at the root of the styled tree containing node.
+func rootProperty(node *styledtree.StyNode, key string) style.Property {
+	root := node
+	for parent := parentStyNode(root); parent != nil; parent = parentStyNode(root) {
+		root = parent
+	}
+	p := GetLocalProperty(root.Styles(), key) // root holds the default properties
+	if p.IsCSSWideKeyword() {
+		return style.NullStyle
+	}
+	return p
+}
+
+func parentStyNode(node *styledtree.StyNode) *styledtree.StyNode {
+	if parent := node.Parent(); parent != nil {
+		return parent.Payload
+	}
+	return nil
+}
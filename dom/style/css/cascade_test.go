@@ -0,0 +1,47 @@
+package css_test
+
+import (
+	"testing"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"golang.org/x/net/html"
+)
+
+func TestPropertyLevels(t *testing.T) {
+	root := styledtree.NewNodeForHTMLNode(&html.Node{Type: html.DocumentNode})
+	styledtree.Node(root).SetStyles(style.InitializeDefaultPropertyValues(nil))
+	parent := styledtree.NewNodeForHTMLNode(&html.Node{Type: html.ElementNode, Data: "div"})
+	margins := style.NewPropertyGroup(style.PGMargins)
+	margins.Set("margin-top", "5pt")
+	styledtree.Node(parent).SetStyles(style.NewPropertyMap().AddAllFromGroup(margins, false))
+	child := styledtree.NewNodeForHTMLNode(&html.Node{Type: html.ElementNode, Data: "p"})
+	inherit := style.NewPropertyGroup(style.PGMargins)
+	inherit.Set("margin-top", "inherit")
+	styledtree.Node(child).SetStyles(style.NewPropertyMap().AddAllFromGroup(inherit, false))
+	root.AddChild(parent)
+	parent.AddChild(child)
+	//
+	for _, test := range []struct {
+		node                      *styledtree.StyNode
+		key                       string
+		local, cascaded, computed style.Property
+	}{
+		{styledtree.Node(child), "margin-top", "inherit", "inherit", "5pt"},
+		{styledtree.Node(parent), "margin-top", "5pt", "5pt", "5pt"},
+		{styledtree.Node(child), "padding-left", style.NullStyle, "0", "0"},
+	} {
+		if p := css.GetLocalProperty(test.node.Styles(), test.key); p != test.local {
+			t.Errorf("expected local %s of <%s> to be %q, is %q", test.key, test.node.HTMLNode().Data, test.local, p)
+		}
+		if p, err := css.GetCascadedProperty(test.node, test.key); err != nil || p != test.cascaded {
+			t.Errorf("expected cascaded %s of <%s> to be %q, is %q (err = %v)", test.key, test.node.HTMLNode().Data,
+				test.cascaded, p, err)
+		}
+		if p, err := css.GetComputedProperty(test.node, test.key); err != nil || p != test.computed {
+			t.Errorf("expected computed %s of <%s> to be %q, is %q (err = %v)", test.key, test.node.HTMLNode().Data,
+				test.computed, p, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package css
+
+import (
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/styledtree"
+)
+
+// --- Containment -----------------------------------------------------------
+
+// Contain is a set of flags for CSS property contain. Containment tells a
+// layout engine that the content of an element is independent of the rest of
+// the document, allowing it to skip laying out or painting the content.
+type Contain uint8
+
+// Flags for CSS property contain.
+const (
+	ContainSize       Contain = 1 << iota // size of the box is independent of its content
+	ContainInlineSize                     // inline size of the box is independent of its content
+	ContainLayout                         // layout of the content is independent of the rest of the document
+	ContainStyle                          // counters and quotes do not escape the box
+	ContainPaint                          // content is not painted outside the box
+
+	ContainNone    Contain = 0                                           // no containment (default)
+	ContainContent         = ContainLayout | ContainStyle | ContainPaint // keyword content
+	ContainStrict          = ContainSize | ContainContent                // keyword strict
+)
+
+var containKeywords = []struct {
+	keyword string
+	flag    Contain
+}{
+	{"size", ContainSize},
+	{"inline-size", ContainInlineSize},
+	{"layout", ContainLayout},
+	{"style", ContainStyle},
+	{"paint", ContainPaint},
+}
+
+// Has is a predicate wether all flags of f are set in c.
+func (c Contain) Has(f Contain) bool {
+	return c&f == f
+}
+
+func (c Contain) String() string {
+	switch c {
+	case ContainNone:
+		return "none"
+	case ContainStrict:
+		return "strict"
+	case ContainContent:
+		return "content"
+	}
+	var keywords []string
+	for _, k := range containKeywords {
+		if c.Has(k.flag) {
+			keywords = append(keywords, k.keyword)
+		}
+	}
+	return strings.Join(keywords, " ")
+}
+
+// ParseContain returns the containment for a property string, which is either
+// one of the keywords none, strict and content, or a combination of size (or
+// inline-size), layout, style and paint. Malformed values result in ContainNone.
+func ParseContain(p style.Property) Contain {
+	fields := strings.Fields(strings.ToLower(string(p)))
+	if len(fields) == 1 {
+		switch fields[0] {
+		case "strict":
+			return ContainStrict
+		case "content":
+			return ContainContent
+		}
+	}
+	c := ContainNone
+	for _, f := range fields {
+		found := false
+		for _, k := range containKeywords {
+			if f == k.keyword && !c.Has(k.flag) {
+				c |= k.flag
+				found = true
+			}
+		}
+		if !found {
+			return ContainNone
+		}
+	}
+	if c.Has(ContainSize | ContainInlineSize) {
+		return ContainNone // size and inline-size exclude each other
+	}
+	return c
+}
+
+// ContentVisibility is an enum type for CSS property content-visibility.
+type ContentVisibility uint8
+
+// Values for CSS property content-visibility.
+const (
+	ContentVisible ContentVisibility = iota // content is rendered (default)
+	ContentAuto                             // content may be skipped while off-screen
+	ContentHidden                           // content is skipped, like with display: none
+)
+
+func (cv ContentVisibility) String() string {
+	switch cv {
+	case ContentAuto:
+		return "auto"
+	case ContentHidden:
+		return "hidden"
+	}
+	return "visible"
+}
+
+// ParseContentVisibility returns the content visibility for a property string.
+// Unknown values result in ContentVisible.
+func ParseContentVisibility(p style.Property) ContentVisibility {
+	switch strings.ToLower(strings.TrimSpace(string(p))) {
+	case "auto":
+		return ContentAuto
+	case "hidden":
+		return ContentHidden
+	}
+	return ContentVisible
+}
+
+// ContainmentT holds the containment properties of an element.
+type ContainmentT struct {
+	Contain           Contain
+	ContentVisibility ContentVisibility
+}
+
+// Containment resolves properties contain and content-visibility of a styled
+// node (see ResolveProperty). Malformed values result in the defaults of the
+// properties.
+func Containment(node *styledtree.StyNode) ContainmentT {
+	return ContainmentT{
+		Contain:           ParseContain(ResolveProperty(node, "contain")),
+		ContentVisibility: ParseContentVisibility(ResolveProperty(node, "content-visibility")),
+	}
+}
+
+// Effective returns the containment in effect for an element, which includes
+// the containment implied by content-visibility: content-visibility auto
+// implies layout, style and paint containment, and so does hidden, which
+// additionally implies size containment.
+func (c ContainmentT) Effective() Contain {
+	switch c.ContentVisibility {
+	case ContentAuto:
+		return c.Contain | ContainContent
+	case ContentHidden:
+		return c.Contain | ContainStrict
+	}
+	return c.Contain
+}
+
+// SkipsContents is a predicate wether the contents of an element are not
+// rendered, i.e. do not generate boxes, while the element itself does.
+func (c ContainmentT) SkipsContents() bool {
+	return c.ContentVisibility == ContentHidden
+}
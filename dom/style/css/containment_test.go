@@ -0,0 +1,46 @@
+package css_test
+
+import (
+	"testing"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+)
+
+func TestParseContain(t *testing.T) {
+	for _, test := range []struct {
+		value   style.Property
+		contain css.Contain
+		str     string
+	}{
+		{"none", css.ContainNone, "none"},
+		{"Strict", css.ContainStrict, "strict"},
+		{"content", css.ContainContent, "content"},
+		{"paint layout", css.ContainLayout | css.ContainPaint, "layout paint"},
+		{"inline-size style", css.ContainInlineSize | css.ContainStyle, "inline-size style"},
+		{"size inline-size", css.ContainNone, "none"},
+		{"paint paint", css.ContainNone, "none"},
+		{"strict paint", css.ContainNone, "none"},
+		{"bogus", css.ContainNone, "none"},
+	} {
+		if c := css.ParseContain(test.value); c != test.contain || c.String() != test.str {
+			t.Errorf("expected contain: %s to be %q, is %q", test.value, test.str, c)
+		}
+	}
+	if !css.ContainStrict.Has(css.ContainSize|css.ContainPaint) || css.ContainContent.Has(css.ContainSize) {
+		t.Errorf("expected strict to include size and paint, content not to include size")
+	}
+}
+
+func TestParseContentVisibility(t *testing.T) {
+	if cv := css.ParseContentVisibility("Hidden"); cv != css.ContentHidden || cv.String() != "hidden" {
+		t.Errorf("expected content-visibility hidden, is %s", cv)
+	}
+	if cv := css.ParseContentVisibility("collapse"); cv != css.ContentVisible {
+		t.Errorf("expected unknown content-visibility to result in visible, is %s", cv)
+	}
+	c := css.ContainmentT{Contain: css.ContainSize, ContentVisibility: css.ContentAuto}
+	if c.SkipsContents() || c.Effective() != css.ContainStrict {
+		t.Errorf("expected auto to add layout, style and paint containment, have %s", c.Effective())
+	}
+}
@@ -0,0 +1,240 @@
+package css
+
+import (
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+)
+
+// DecorationLine is a set of lines for CSS property text-decoration-line.
+type DecorationLine uint8
+
+// Flags for type DecorationLine. Lines may be combined, e.g.
+// `DecorationUnderline|DecorationOverline`.
+const (
+	DecorationNone        DecorationLine = 0x00 // CSS none (default)
+	DecorationUnderline   DecorationLine = 0x01 // CSS underline
+	DecorationOverline    DecorationLine = 0x02 // CSS overline
+	DecorationLineThrough DecorationLine = 0x04 // CSS line-through
+)
+
+var decorationLineStringMap map[string]DecorationLine = map[string]DecorationLine{
+	"underline":    DecorationUnderline,
+	"overline":     DecorationOverline,
+	"line-through": DecorationLineThrough,
+}
+
+// Contains returns true if all lines of l2 are set in l.
+func (l DecorationLine) Contains(l2 DecorationLine) bool {
+	return l&l2 == l2
+}
+
+// DecorationStyle is an enum type for CSS property text-decoration-style.
+type DecorationStyle uint8
+
+// Enum values for type DecorationStyle
+const (
+	DecorationSolid  DecorationStyle = iota // CSS solid (default)
+	DecorationDouble                        // CSS double
+	DecorationDotted                        // CSS dotted
+	DecorationDashed                        // CSS dashed
+	DecorationWavy                          // CSS wavy
+)
+
+var decorationStyleStringMap map[string]DecorationStyle = map[string]DecorationStyle{
+	"solid":  DecorationSolid,
+	"double": DecorationDouble,
+	"dotted": DecorationDotted,
+	"dashed": DecorationDashed,
+	"wavy":   DecorationWavy,
+}
+
+// TextDecorationT is an option type for CSS property text-decoration.
+type TextDecorationT struct {
+	color style.Property // empty for currentcolor
+	line  DecorationLine
+	style DecorationStyle
+	set   bool
+}
+
+/*
+type TextDecorationT
+	= Unset
+	| Decoration line style color
+*/
+
+// TextDecoration creates a text-decoration from its components. An empty
+// color denotes the current text color.
+func TextDecoration(line DecorationLine, dstyle DecorationStyle, color style.Property) TextDecorationT {
+	return TextDecorationT{line: line, style: dstyle, color: color, set: true}
+}
+
+// NoTextDecoration creates a text-decoration of value `none`.
+func NoTextDecoration() TextDecorationT {
+	return TextDecorationT{set: true}
+}
+
+// ParseTextDecoration returns an optional text-decoration type from a property
+// string. The property string is the value of shorthand property text-decoration,
+// i.e., a combination of line(s), style and color, in any order.
+// It will never return an error, even with illegal input, but instead will then
+// return an unset text-decoration.
+func ParseTextDecoration(p style.Property) TextDecorationT {
+	fields := strings.Fields(strings.ToLower(string(p)))
+	if len(fields) == 0 {
+		return TextDecorationT{}
+	}
+	td := NoTextDecoration()
+	var hasNone, hasStyle, hasColor, illegal bool
+	for _, f := range fields {
+		l, isLine := decorationLineStringMap[f]
+		s, isStyle := decorationStyleStringMap[f]
+		switch {
+		case isLine:
+			illegal = illegal || hasNone
+			td.line |= l
+		case f == "none":
+			illegal = illegal || hasNone || td.line != DecorationNone
+			hasNone = true
+		case isStyle:
+			illegal = illegal || hasStyle
+			td.style, hasStyle = s, true
+		default: // interpret anything else as a color
+			illegal = illegal || hasColor
+			if f != "currentcolor" {
+				td.color = style.Property(f)
+			}
+			hasColor = true
+		}
+	}
+	if illegal {
+		tracer().Debugf("text-decoration option from property '%s': illegal value", p)
+		return TextDecorationT{}
+	}
+	return td
+}
+
+// Line returns the decoration line(s) of td.
+func (td TextDecorationT) Line() DecorationLine {
+	return td.line
+}
+
+// Style returns the decoration style of td.
+func (td TextDecorationT) Style() DecorationStyle {
+	return td.style
+}
+
+// Color returns the color of td. An empty color denotes the current text color.
+func (td TextDecorationT) Color() style.Property {
+	return td.color
+}
+
+// ---------------------------------------------------------------------------
+
+func (td TextDecorationT) Match() *TDMatcher {
+	return &TDMatcher{td: td}
+}
+
+type TDMatcher struct {
+	td TextDecorationT
+}
+
+func (m *TDMatcher) Unset() *TDMatcher {
+	if !m.td.set {
+		return m
+	}
+	return nil
+}
+
+func (m *TDMatcher) None() *TDMatcher {
+	if m.td.set && m.td.line == DecorationNone {
+		return m
+	}
+	return nil
+}
+
+// Lines matches if all of the decoration lines in l are set.
+func (m *TDMatcher) Lines(l DecorationLine) *TDMatcher {
+	if m.td.set && m.td.line != DecorationNone && m.td.line.Contains(l) {
+		return m
+	}
+	return nil
+}
+
+// Decoration matches if any decoration line is set. Line, style and color are
+// extracted if the corresponding arguments are non-nil.
+func (m *TDMatcher) Decoration(l *DecorationLine, s *DecorationStyle, c *style.Property) *TDMatcher {
+	if !m.td.set || m.td.line == DecorationNone {
+		return nil
+	}
+	if l != nil {
+		*l = m.td.line
+	}
+	if s != nil {
+		*s = m.td.style
+	}
+	if c != nil {
+		*c = m.td.color
+	}
+	return m
+}
+
+// --- Expression matching ---------------------------------------------------
+
+type TextDecorationPatterns[T any] struct {
+	Unset      T
+	None       T
+	Decoration T
+	Default    T
+}
+
+func TextDecorationPattern[T any](td TextDecorationT) *TDMatchExpr[T] {
+	return &TDMatchExpr[T]{td: td}
+}
+
+// TDMatchExpr is part of pattern matching for TextDecorationT types and intended to be
+// instantiated using `TextDecorationPattern()` only.
+type TDMatchExpr[T any] struct {
+	td TextDecorationT
+}
+
+func (m *TDMatchExpr[T]) OneOf(patterns TextDecorationPatterns[T]) T {
+	switch {
+	case !m.td.set:
+		return patterns.Unset
+	case m.td.line == DecorationNone:
+		return patterns.None
+	default:
+		return patterns.Decoration
+	}
+}
+
+// With extracts line, style and color of a text-decoration.
+func (m *TDMatchExpr[T]) With(l *DecorationLine, s *DecorationStyle, c *style.Property) *TDMatchExpr[T] {
+	if l != nil {
+		*l = m.td.line
+	}
+	if s != nil {
+		*s = m.td.style
+	}
+	if c != nil {
+		*c = m.td.color
+	}
+	return m
+}
+
+func (m *TDMatchExpr[T]) Const(x T) T {
+	return x
+}
+
+// ---------------------------------------------------------------------------
+
+// IsUnset returns true if td is unset.
+func (td TextDecorationT) IsUnset() bool {
+	return !td.set
+}
+
+// IsNone returns true if td is set and does not draw any lines.
+func (td TextDecorationT) IsNone() bool {
+	return td.set && td.line == DecorationNone
+}
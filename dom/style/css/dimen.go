@@ -1,7 +1,9 @@
 package css
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -165,6 +167,7 @@ type DimenPatterns[T any] struct {
 	Inherit T
 	Initial T
 	Just    T
+	ViewRel T
 	Default T
 }
 
@@ -188,6 +191,8 @@ func (m *DMatchExpr[T]) OneOf(patterns DimenPatterns[T]) T {
 		return patterns.Initial
 	case m.dimen.flags&dimenInherit > 0:
 		return patterns.Inherit
+	case m.dimen.IsViewportRelative():
+		return patterns.ViewRel
 	}
 	return patterns.Default
 }
@@ -215,7 +220,7 @@ func (d DimenT) IsRelative() bool {
 
 // IsPercent returns true if d represents a percentage dimension (`%`).
 func (d DimenT) IsPercent() bool {
-	return d.flags&dimenPercent > 0
+	return d.flags&relativeMask == dimenPercent
 }
 
 // IsAbsolute returns true if d represents a valid absolute dimension.
@@ -233,6 +238,7 @@ var dimenPattern = regexp.MustCompile(`^([+\-]?[0-9]+)(%|[a-zA-Z]{2,4})?$`)
 //     15px
 //     80%
 //     -33rem
+//     50vw
 //
 func ParseDimen(s string) (DimenT, error) {
 	// tracer().Debugf("parse dimen string = '%s'", s)
@@ -319,3 +325,84 @@ var relUnitStringMap map[string]uint32 = map[string]uint32{
 	"vmax": dimenVMAX,
 	`%`:    dimenPercent,
 }
+
+// --- Marshaling ------------------------------------------------------------
+
+// String returns a dimension in CSS notation, with fixed dimensions in scaled
+// points, e.g. "65536sp", "50%" or "auto". Unset dimensions result in an
+// empty string.
+func (d DimenT) String() string {
+	switch d.flags {
+	case dimenUnset:
+		return ""
+	case dimenAbsolute:
+		return d.d.String()
+	case dimenAuto:
+		return "auto"
+	case dimenInherit:
+		return "inherit"
+	case dimenInitial:
+		return "initial"
+	case DimenContentMax:
+		return "max-content"
+	case DimenContentMin:
+		return "min-content"
+	case DimenContentFit:
+		return "fit-content"
+	}
+	if d.IsPercent() && d.percent != 0 {
+		return d.percent.String()
+	}
+	return fmt.Sprintf("%d%s", int32(d.d), d.UnitString())
+}
+
+// MarshalText encodes a dimension in CSS notation (see String).
+// Part of interface encoding.TextMarshaler.
+func (d DimenT) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes a dimension in CSS notation, as produced by MarshalText
+// or accepted by ParseDimen. Percentages are decoded as by Percentage.
+// Part of interface encoding.TextUnmarshaler.
+func (d *DimenT) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	switch s {
+	case "auto":
+		*d = Auto()
+	case "inherit":
+		*d = Inherit()
+	case "initial":
+		*d = Initial()
+	case "max-content":
+		*d = DimenT{flags: DimenContentMax}
+	case "min-content":
+		*d = DimenT{flags: DimenContentMin}
+	case "fit-content":
+		*d = DimenT{flags: DimenContentFit}
+	default:
+		dim, err := ParseDimen(s)
+		if err != nil {
+			return fmt.Errorf("cannot decode dimension %q: %w", s, err)
+		}
+		if dim.IsPercent() {
+			dim = Percentage(FromInt(int(dim.d)))
+		}
+		*d = dim
+	}
+	return nil
+}
+
+// MarshalJSON encodes a dimension as a JSON string in CSS notation.
+func (d DimenT) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON decodes a dimension from a JSON string in CSS notation.
+func (d *DimenT) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(s))
+}
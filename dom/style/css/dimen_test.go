@@ -1,6 +1,8 @@
 package css_test
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/npillmayer/fp/dom/style"
@@ -77,3 +79,83 @@ func TestDimenAuto(t *testing.T) {
 		t.Errorf("expected AUTO, have %v", x)
 	}
 }
+
+func TestDimenViewport(t *testing.T) {
+	vp := css.Viewport{W: 600 * dimen.PT, H: 800 * dimen.PT}
+	for _, x := range []struct {
+		s      string
+		unit   string
+		expect dimen.DU
+	}{
+		{"50vw", "vw", 300 * dimen.PT},
+		{"25vh", "vh", 200 * dimen.PT},
+		{"10vmin", "vmin", 60 * dimen.PT},
+		{"10VMAX", "vmax", 80 * dimen.PT},
+	} {
+		d, err := css.ParseDimen(x.s)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %v", x.s, err)
+		}
+		var unit string
+		if m := d.Match(); m.ViewRel(&unit) == nil || unit != x.unit {
+			t.Errorf("expected %q to be viewport-relative with unit %s, have %q", x.s, x.unit, unit)
+		}
+		if d.IsPercent() {
+			t.Errorf("expected %q not to be a percentage", x.s)
+		}
+		var du dimen.DU
+		if m := d.Resolve(vp).Match(); m.Just(&du) == nil || du != x.expect {
+			t.Errorf("expected %q to resolve to %v, have %v", x.s, x.expect, du)
+		}
+	}
+	em, _ := css.ParseDimen("2em")
+	if em.Resolve(vp) != em {
+		t.Errorf("expected em dimension to be unaffected by viewport")
+	}
+	vw, _ := css.ParseDimen("100vw")
+	x := css.DimenPattern[string](vw).OneOf(css.DimenPatterns[string]{
+		ViewRel: "VIEW",
+		Default: "NONE",
+	})
+	if x != "VIEW" {
+		t.Errorf("expected VIEW, have %v", x)
+	}
+}
+
+func TestDimenMarshal(t *testing.T) {
+	dims := []css.DimenT{
+		{},
+		css.JustDimen(dimen.PT * 10),
+		css.Auto(),
+		css.Inherit(),
+		css.Percentage(percent.FromInt(80)),
+	}
+	for _, d := range dims {
+		text, err := d.MarshalText()
+		if err != nil {
+			t.Fatalf("cannot marshal %#v: %v", d, err)
+		}
+		var e css.DimenT
+		if err = e.UnmarshalText(text); err != nil {
+			t.Fatalf("cannot unmarshal %q: %v", text, err)
+		}
+		if !reflect.DeepEqual(d, e) {
+			t.Errorf("expected text round trip of %q to preserve dimension, is %#v", text, e)
+		}
+		data, err := json.Marshal(d)
+		if err != nil {
+			t.Fatalf("cannot marshal %#v to JSON: %v", d, err)
+		}
+		e = css.DimenT{}
+		if err = json.Unmarshal(data, &e); err != nil {
+			t.Fatalf("cannot unmarshal JSON %s: %v", data, err)
+		}
+		if !reflect.DeepEqual(d, e) {
+			t.Errorf("expected JSON round trip of %s to preserve dimension, is %#v", data, e)
+		}
+	}
+	var d css.DimenT
+	if err := d.UnmarshalText([]byte("12xx")); err == nil {
+		t.Errorf("expected unmarshaling of '12xx' to fail, didn't")
+	}
+}
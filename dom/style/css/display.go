@@ -2,6 +2,7 @@ package css
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 )
 
@@ -147,3 +148,58 @@ func ParseDisplay(display string) (DisplayMode, error) {
 	}
 	return BlockMode, fmt.Errorf("Unknown display mode: %s", display)
 }
+
+// --- Marshaling ------------------------------------------------------------
+
+// displayKeywords are the values of CSS property "display" known to
+// ParseDisplay, in order of preference for encoding.
+var displayKeywords = []string{
+	"none", "block", "inline", "list-item", "inline-block", "table",
+	"inline-table", "block-inline",
+}
+
+// MarshalText encodes a display mode as a value of CSS property "display",
+// e.g. "inline-block". NoMode results in an empty string. Display modes which
+// do not correspond to a keyword known to ParseDisplay cannot be encoded.
+// Part of interface encoding.TextMarshaler.
+func (disp DisplayMode) MarshalText() ([]byte, error) {
+	if disp == NoMode {
+		return []byte{}, nil
+	}
+	for _, k := range displayKeywords {
+		if d, _ := ParseDisplay(k); d == disp {
+			return []byte(k), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot encode display mode %s", disp.FullString())
+}
+
+// UnmarshalText decodes a display mode from a value of CSS property "display"
+// (see ParseDisplay).
+// Part of interface encoding.TextUnmarshaler.
+func (disp *DisplayMode) UnmarshalText(text []byte) error {
+	d, err := ParseDisplay(string(bytes.TrimSpace(text)))
+	if err != nil {
+		return err
+	}
+	*disp = d
+	return nil
+}
+
+// MarshalJSON encodes a display mode as a JSON string (see MarshalText).
+func (disp DisplayMode) MarshalJSON() ([]byte, error) {
+	text, err := disp.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// UnmarshalJSON decodes a display mode from a JSON string (see UnmarshalText).
+func (disp *DisplayMode) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return disp.UnmarshalText([]byte(s))
+}
@@ -0,0 +1,201 @@
+package css
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+)
+
+// --- Environment variables -------------------------------------------------
+
+// EnvValue is the typed value of an environment variable, either a dimension
+// or a verbatim property value.
+type EnvValue struct {
+	dimen DimenT
+	text  style.Property
+}
+
+// EnvDimen creates an environment value holding a dimension.
+func EnvDimen(d DimenT) EnvValue {
+	return EnvValue{dimen: d}
+}
+
+// EnvProperty creates an environment value holding a verbatim property value,
+// e.g. a color or a keyword.
+func EnvProperty(p style.Property) EnvValue {
+	return EnvValue{text: p}
+}
+
+// Dimen returns the dimension held by an environment value, if any.
+func (v EnvValue) Dimen() (DimenT, bool) {
+	return v.dimen, v.text == style.NullStyle
+}
+
+// Property returns an environment value as a property value, to be substituted
+// for env(…). Dimensions are written in CSS notation (see DimenT.String).
+func (v EnvValue) Property() style.Property {
+	if v.text != style.NullStyle {
+		return v.text
+	}
+	return style.Property(v.dimen.String())
+}
+
+// EnvContext is the context for resolving environment variables, i.e.
+// references of the form
+//
+//     env(name)
+//     env(name, fallback)
+//
+// in property values. Environment variables allow page templates to parameterize
+// style sheets, e.g. for bleeds or for margins:
+//
+//     env := css.DefaultEnvContext()
+//     env["bleed"] = css.EnvDimen(css.JustDimen(3 * dimen.MM))
+//     p, err := env.Resolve("env(bleed, 0) 0")    // => "557313sp 0"
+//
+// Names of variables should be lower case, as style property values are
+// converted to lower case (see style.PropertyGroup).
+type EnvContext map[string]EnvValue
+
+// DefaultEnvContext returns an environment holding the variables defined by CSS,
+// i.e. safe-area-inset-top, -right, -bottom and -left. For paged media, the
+// safe area is the page area, thus all insets are zero.
+func DefaultEnvContext() EnvContext {
+	return EnvContext{
+		"safe-area-inset-top":    EnvDimen(JustDimen(0)),
+		"safe-area-inset-right":  EnvDimen(JustDimen(0)),
+		"safe-area-inset-bottom": EnvDimen(JustDimen(0)),
+		"safe-area-inset-left":   EnvDimen(JustDimen(0)),
+	}
+}
+
+// ErrUnknownEnvVariable is returned by Resolve for references to unknown
+// environment variables without a fallback.
+var ErrUnknownEnvVariable = errors.New("unknown environment variable")
+
+// Resolve substitutes every env(…) in a property value by the value of the
+// environment variable referenced, or by its fallback, if the variable is not
+// part of env. Fallbacks may contain env(…) themselves.
+//
+// If a variable is unknown and no fallback is given, Resolve returns an error
+// (ErrUnknownEnvVariable). As demanded by CSS, the property is then invalid at
+// computed-value time and should be treated as unset. A nil environment resolves
+// every reference to its fallback.
+func (env EnvContext) Resolve(p style.Property) (style.Property, error) {
+	s := string(p)
+	start := indexOfEnv(s)
+	if start < 0 {
+		return p, nil
+	}
+	var b strings.Builder
+	for start >= 0 {
+		b.WriteString(s[:start])
+		args, rest, err := envArguments(s[start+len("env("):])
+		if err != nil {
+			return p, err
+		}
+		name, fallback, hasFallback := strings.Cut(args, ",")
+		name = strings.TrimSpace(name)
+		if v, ok := env[name]; ok {
+			b.WriteString(string(v.Property()))
+		} else if hasFallback {
+			fb, err := env.Resolve(style.Property(strings.TrimSpace(fallback)))
+			if err != nil {
+				return p, err
+			}
+			b.WriteString(string(fb))
+		} else {
+			return p, fmt.Errorf("%w: %s", ErrUnknownEnvVariable, name)
+		}
+		s = rest
+		start = indexOfEnv(s)
+	}
+	b.WriteString(s)
+	return style.Property(b.String()), nil
+}
+
+// ResolveMap resolves env(…) for all properties of a property map (see Resolve).
+// Properties with unresolvable values are removed, i.e. they are treated as
+// unset.
+//
+// Property maps may share property groups, thus ResolveMap will never modify
+// pmap or one of its groups in place (compare style.PropertyMap.Merge). If a
+// group contains env(…), ResolveMap returns a new property map, holding a copy
+// of the group with values resolved and sharing all other groups with pmap.
+// Otherwise pmap is returned.
+func (env EnvContext) ResolveMap(pmap *style.PropertyMap) *style.PropertyMap {
+	if pmap == nil {
+		return nil
+	}
+	groups := pmap.Groups()
+	for i, group := range groups {
+		var cow *style.PropertyGroup // copy of group, created on first modification
+		for _, kv := range group.Properties() {
+			if indexOfEnv(string(kv.Value)) < 0 {
+				continue
+			}
+			if cow == nil {
+				cow = group.Clone()
+			}
+			if p, err := env.Resolve(kv.Value); err != nil {
+				tracer().Infof("property %s: %v", kv.Key, err)
+				cow.Remove(kv.Key)
+			} else {
+				cow.Set(kv.Key, p)
+			}
+		}
+		if cow != nil {
+			groups[i] = cow
+			pmap = nil // have to create a new property map
+		}
+	}
+	if pmap != nil {
+		return pmap
+	}
+	resolved := style.NewPropertyMap()
+	for _, group := range groups {
+		resolved = resolved.AddAllFromGroup(group, false)
+	}
+	return resolved
+}
+
+// indexOfEnv returns the position of the first occurrence of function env in s,
+// or -1.
+func indexOfEnv(s string) int {
+	offset := 0
+	for {
+		i := strings.Index(s[offset:], "env(")
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		if i == 0 || !isIdentChar(s[i-1]) { // not part of a longer identifier
+			return i
+		}
+		offset = i + len("env(")
+	}
+}
+
+// envArguments splits s at the closing parenthesis of env(…), returning the
+// arguments and the remainder of s after the parenthesis.
+func envArguments(s string) (string, string, error) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return s[:i], s[i+1:], nil
+			}
+			depth--
+		}
+	}
+	return "", "", errors.New("format error parsing env(): missing ')'")
+}
+
+func isIdentChar(c byte) bool {
+	return c == '-' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
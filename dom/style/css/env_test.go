@@ -0,0 +1,67 @@
+package css_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/tyse/core/dimen"
+)
+
+func TestEnv(t *testing.T) {
+	env := css.DefaultEnvContext()
+	env["bleed"] = css.EnvDimen(css.JustDimen(3 * dimen.MM))
+	env["mark-color"] = css.EnvProperty("red")
+	for _, test := range []struct {
+		p, resolved style.Property
+		err         bool
+	}{
+		{"10pt", "10pt", false},
+		{"env(safe-area-inset-top)", "0sp", false},
+		{"env(bleed, 0) 0", style.Property(css.JustDimen(3*dimen.MM).String() + " 0"), false},
+		{"env(mark-color)", "red", false},
+		{"env(unknown, 5pt)", "5pt", false},
+		{"env(unknown, env(mark-color)) env(x, calc(1pt + 2pt))", "red calc(1pt + 2pt)", false},
+		{"myenv(bleed)", "myenv(bleed)", false},
+		{"env(unknown)", "", true},
+		{"env(bleed", "", true},
+	} {
+		p, err := env.Resolve(test.p)
+		if (err != nil) != test.err {
+			t.Errorf("%q: unexpected error status: %v", test.p, err)
+		} else if !test.err && p != test.resolved {
+			t.Errorf("%q: expected %q, have %q", test.p, test.resolved, p)
+		}
+	}
+	if _, err := env.Resolve("env(unknown)"); !errors.Is(err, css.ErrUnknownEnvVariable) {
+		t.Errorf("expected error to be ErrUnknownEnvVariable, is %v", err)
+	}
+	if d, ok := env["bleed"].Dimen(); !ok || d != css.JustDimen(3*dimen.MM) {
+		t.Errorf("expected bleed to be a dimension of 3mm, is %v", d)
+	}
+	margins := style.NewPropertyGroup(style.PGMargins)
+	margins.Set("margin-top", "env(bleed)")
+	margins.Set("margin-left", "env(undefined)")
+	margins.Set("margin-right", "2pt")
+	shared := style.NewPropertyMap().AddAllFromGroup(margins, false)
+	pmap := env.ResolveMap(shared)
+	if p, _ := pmap.Property("margin-top"); p != env["bleed"].Property() {
+		t.Errorf("expected margin-top to be resolved to bleed, is %q", p)
+	}
+	if _, ok := pmap.Property("margin-left"); ok {
+		t.Errorf("expected unresolvable margin-left to be removed")
+	}
+	if p, _ := pmap.Property("margin-right"); p != "2pt" {
+		t.Errorf("expected margin-right to be unchanged, is %q", p)
+	}
+	if p, _ := shared.Property("margin-top"); p != "env(bleed)" || shared.Group(style.PGMargins) != margins {
+		t.Errorf("expected shared property map to be unchanged, margin-top is %q", p)
+	}
+	if p, _ := margins.Get("margin-left"); p != "env(undefined)" {
+		t.Errorf("expected shared property group to be unchanged, margin-left is %q", p)
+	}
+	if env.ResolveMap(pmap) != pmap {
+		t.Errorf("expected property map without env(…) to be returned as is")
+	}
+}
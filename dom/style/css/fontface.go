@@ -0,0 +1,323 @@
+package css
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/npillmayer/fp/dom/style"
+)
+
+// --- @font-face ------------------------------------------------------------
+
+// FontFace is a font declared by an @font-face rule. It describes where to
+// load the font from and which part of a font family it covers. Descriptors
+// missing from the rule are set to their initial values.
+type FontFace struct {
+	Family       string          // descriptor font-family, unquoted
+	Sources      []FontSource    // descriptor src, in order of preference
+	Weight       FontWeightRange // descriptor font-weight, default 400
+	Style        FontStyleRange  // descriptor font-style, default normal
+	UnicodeRange []UnicodeRange  // descriptor unicode-range, default U+0-10FFFF
+	Display      string          // descriptor font-display, default auto
+}
+
+// FontSource is an entry of descriptor src. Either URL or Local is set.
+type FontSource struct {
+	URL    string // location of a font file, from url(…)
+	Local  string // full name of a locally installed font, from local(…)
+	Format string // format hint, e.g. "woff2"; may be empty
+}
+
+func (src FontSource) String() string {
+	s := "local(" + strconv.Quote(src.Local) + ")"
+	if src.Local == "" {
+		s = "url(" + strconv.Quote(src.URL) + ")"
+	}
+	if src.Format != "" {
+		s += " format(" + strconv.Quote(src.Format) + ")"
+	}
+	return s
+}
+
+// FontWeightRange is the range of weights a font face covers. Variable fonts
+// may cover a range of weights, static fonts have Min = Max.
+type FontWeightRange struct {
+	Min, Max int
+}
+
+// Contains is a predicate wether weight w lies within the range.
+func (r FontWeightRange) Contains(w int) bool {
+	return w >= r.Min && w <= r.Max
+}
+
+// FontStyleRange is the style a font face covers. For Style "oblique", the
+// slant angles covered are given by From and To, in degrees.
+type FontStyleRange struct {
+	Style    string  // "normal", "italic" or "oblique"
+	From, To float64 // slant angles for oblique, in degrees
+}
+
+// UnicodeRange is a range of code points, Lo and Hi included.
+type UnicodeRange struct {
+	Lo, Hi rune
+}
+
+// Covers is a predicate wether a font face covers code point r, according to
+// its unicode-range descriptor.
+func (ff FontFace) Covers(r rune) bool {
+	for _, ur := range ff.UnicodeRange {
+		if r >= ur.Lo && r <= ur.Hi {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFontFace creates a font face from the descriptors of an @font-face
+// rule. Descriptors font-family and src are required, otherwise an error is
+// returned. Other descriptors with invalid values are ignored, as demanded by
+// CSS, i.e. they are set to their initial values.
+//
+//     @font-face {
+//         font-family: "Fira Sans";
+//         src: local("Fira Sans"), url(fira.woff2) format("woff2");
+//         font-weight: 300 700;
+//         unicode-range: U+0000-00FF, U+20AC;
+//     }
+func ParseFontFace(descriptors []style.KeyValue) (FontFace, error) {
+	ff := FontFace{
+		Weight:       FontWeightRange{400, 400},
+		Style:        FontStyleRange{Style: "normal"},
+		UnicodeRange: []UnicodeRange{{0, utf8.MaxRune}},
+		Display:      "auto",
+	}
+	for _, d := range descriptors {
+		value := strings.TrimSpace(string(d.Value))
+		var err error
+		switch strings.ToLower(d.Key) {
+		case "font-family":
+			ff.Family, err = parseFamilyName(value)
+		case "src":
+			ff.Sources, err = parseFontSources(value)
+		case "font-weight":
+			var w FontWeightRange
+			if w, err = parseFontWeightRange(value); err == nil {
+				ff.Weight = w
+			}
+		case "font-style":
+			var s FontStyleRange
+			if s, err = parseFontStyleRange(value); err == nil {
+				ff.Style = s
+			}
+		case "unicode-range":
+			var ur []UnicodeRange
+			if ur, err = parseUnicodeRanges(value); err == nil {
+				ff.UnicodeRange = ur
+			}
+		case "font-display":
+			switch v := strings.ToLower(value); v {
+			case "auto", "block", "swap", "fallback", "optional":
+				ff.Display = v
+			}
+		}
+		if err != nil {
+			tracer().Infof("@font-face: ignoring descriptor %s: %v", d.Key, err)
+		}
+	}
+	if ff.Family == "" {
+		return ff, errors.New("@font-face without font-family")
+	}
+	if len(ff.Sources) == 0 {
+		return ff, fmt.Errorf("@font-face for %q without src", ff.Family)
+	}
+	return ff, nil
+}
+
+// parseFamilyName parses a single family name, either quoted or as a
+// sequence of identifiers.
+func parseFamilyName(s string) (string, error) {
+	if name, ok := style.Unquote(s); ok {
+		return name, nil
+	}
+	if s == "" || strings.ContainsAny(s, `,"'()`) {
+		return "", fmt.Errorf("invalid family name %q", s)
+	}
+	return strings.Join(strings.Fields(s), " "), nil
+}
+
+// parseFontSources parses descriptor src, a comma-separated list of
+// `url(…) format(…)` and `local(…)`. Unknown entries are skipped.
+func parseFontSources(s string) ([]FontSource, error) {
+	var sources []FontSource
+	for _, entry := range style.SplitOutsideStrings(s, ',') {
+		var src FontSource
+		for rest := strings.TrimSpace(entry); rest != ""; rest = strings.TrimSpace(rest) {
+			name, arg, tail, ok := cutFunction(rest)
+			if !ok {
+				src = FontSource{}
+				break
+			}
+			switch strings.ToLower(name) {
+			case "url":
+				src.URL = arg
+			case "local":
+				src.Local, _ = parseFamilyName(arg)
+			case "format":
+				src.Format = strings.ToLower(arg)
+			}
+			rest = tail
+		}
+		if src.URL != "" || src.Local != "" {
+			sources = append(sources, src)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no valid font source in %q", s)
+	}
+	return sources, nil
+}
+
+// cutFunction splits off a functional notation `name(arg)` from the start of
+// s, returning the unquoted argument and the remainder of s.
+func cutFunction(s string) (name, arg, rest string, ok bool) {
+	open := strings.IndexByte(s, '(')
+	if open <= 0 {
+		return "", "", s, false
+	}
+	end := -1
+	for i := open + 1; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '"', '\'':
+			i = style.SkipString(s, i) - 1
+		case ')':
+			end = i
+		}
+	}
+	if end < 0 {
+		return "", "", s, false
+	}
+	name = strings.TrimSpace(s[:open])
+	arg = strings.TrimSpace(s[open+1 : end])
+	if a, quoted := style.Unquote(arg); quoted {
+		arg = a
+	}
+	return name, arg, s[end+1:], true
+}
+
+// parseFontWeightRange parses descriptor font-weight: normal, bold, a weight
+// or a range of two weights. Reversed ranges are swapped.
+func parseFontWeightRange(s string) (FontWeightRange, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 || len(fields) > 2 {
+		return FontWeightRange{}, fmt.Errorf("invalid font weight %q", s)
+	}
+	var w [2]int
+	for i, f := range fields {
+		switch f {
+		case "normal":
+			w[i] = 400
+		case "bold":
+			w[i] = 700
+		default:
+			n, err := strconv.ParseFloat(f, 64)
+			if err != nil || n < 1 || n > 1000 {
+				return FontWeightRange{}, fmt.Errorf("invalid font weight %q", s)
+			}
+			w[i] = int(n)
+		}
+	}
+	if len(fields) == 1 {
+		w[1] = w[0]
+	}
+	if w[0] > w[1] {
+		w[0], w[1] = w[1], w[0]
+	}
+	return FontWeightRange{w[0], w[1]}, nil
+}
+
+// parseFontStyleRange parses descriptor font-style: normal, italic, or
+// oblique with an optional angle or range of angles (default 14deg).
+func parseFontStyleRange(s string) (FontStyleRange, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 {
+		return FontStyleRange{}, errors.New("empty font style")
+	}
+	switch fields[0] {
+	case "normal", "italic":
+		if len(fields) == 1 {
+			return FontStyleRange{Style: fields[0]}, nil
+		}
+	case "oblique":
+		if len(fields) > 3 {
+			break
+		}
+		r := FontStyleRange{Style: "oblique", From: 14, To: 14}
+		var a [2]float64
+		for i, f := range fields[1:] {
+			deg, err := strconv.ParseFloat(strings.TrimSuffix(f, "deg"), 64)
+			if err != nil || !strings.HasSuffix(f, "deg") || deg < -90 || deg > 90 {
+				return FontStyleRange{}, fmt.Errorf("invalid oblique angle %q", f)
+			}
+			a[i] = deg
+		}
+		switch len(fields) {
+		case 2:
+			r.From, r.To = a[0], a[0]
+		case 3:
+			r.From, r.To = a[0], a[1]
+			if r.From > r.To {
+				r.From, r.To = r.To, r.From
+			}
+		}
+		return r, nil
+	}
+	return FontStyleRange{}, fmt.Errorf("invalid font style %q", s)
+}
+
+// parseUnicodeRanges parses descriptor unicode-range, a comma-separated list of
+// single code points (U+20AC), ranges (U+0-7F) and wildcard ranges (U+4??).
+func parseUnicodeRanges(s string) ([]UnicodeRange, error) {
+	var ranges []UnicodeRange
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.ToUpper(strings.TrimSpace(entry))
+		if !strings.HasPrefix(entry, "U+") {
+			return nil, fmt.Errorf("invalid unicode range %q", entry)
+		}
+		entry = entry[2:]
+		var ur UnicodeRange
+		var err error
+		if lo, hi, isRange := strings.Cut(entry, "-"); isRange {
+			ur.Lo, err = parseCodePoint(lo)
+			if err == nil {
+				ur.Hi, err = parseCodePoint(hi)
+			}
+		} else if strings.Contains(entry, "?") {
+			ur.Lo, err = parseCodePoint(strings.ReplaceAll(entry, "?", "0"))
+			if err == nil {
+				ur.Hi, err = parseCodePoint(strings.ReplaceAll(entry, "?", "F"))
+			}
+		} else {
+			ur.Lo, err = parseCodePoint(entry)
+			ur.Hi = ur.Lo
+		}
+		if err != nil || ur.Lo > ur.Hi {
+			return nil, fmt.Errorf("invalid unicode range U+%s", entry)
+		}
+		ranges = append(ranges, ur)
+	}
+	return ranges, nil
+}
+
+func parseCodePoint(hex string) (rune, error) {
+	if len(hex) == 0 || len(hex) > 6 {
+		return 0, errors.New("invalid code point")
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || n > utf8.MaxRune {
+		return 0, errors.New("invalid code point")
+	}
+	return rune(n), nil
+}
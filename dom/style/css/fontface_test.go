@@ -0,0 +1,65 @@
+package css_test
+
+import (
+	"testing"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+)
+
+func TestParseFontFace(t *testing.T) {
+	ff, err := css.ParseFontFace([]style.KeyValue{
+		{Key: "font-family", Value: `"Fira Sans"`},
+		{Key: "src", Value: `local("Fira Sans Light"), url("fira,light.woff2") format("woff2"), url(fira.ttf)`},
+		{Key: "font-weight", Value: "700 300"},
+		{Key: "font-style", Value: "oblique 20deg 10deg"},
+		{Key: "unicode-range", Value: "U+0-7F, U+4??, U+20AC"},
+		{Key: "font-display", Value: "swap"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ff.Family != "Fira Sans" || len(ff.Sources) != 3 {
+		t.Fatalf("expected 3 sources for Fira Sans, have %q with %v", ff.Family, ff.Sources)
+	}
+	if ff.Sources[0].Local != "Fira Sans Light" || ff.Sources[1].URL != "fira,light.woff2" ||
+		ff.Sources[1].Format != "woff2" || ff.Sources[2].URL != "fira.ttf" {
+		t.Errorf("unexpected sources %v", ff.Sources)
+	}
+	if ff.Weight != (css.FontWeightRange{Min: 300, Max: 700}) {
+		t.Errorf("expected reversed weight range to be swapped, have %v", ff.Weight)
+	}
+	if ff.Style.Style != "oblique" || ff.Style.From != 10 || ff.Style.To != 20 {
+		t.Errorf("expected oblique 10deg–20deg, have %v", ff.Style)
+	}
+	if !ff.Covers('A') || !ff.Covers(0x4FF) || !ff.Covers('€') || ff.Covers(0x500) {
+		t.Errorf("unexpected code point coverage for %v", ff.UnicodeRange)
+	}
+	if ff.Display != "swap" {
+		t.Errorf("expected font-display swap, have %q", ff.Display)
+	}
+}
+
+func TestParseFontFaceDefaults(t *testing.T) {
+	ff, err := css.ParseFontFace([]style.KeyValue{
+		{Key: "font-family", Value: "Inter  Display"},
+		{Key: "src", Value: "url(inter.woff)"},
+		{Key: "font-weight", Value: "heavy"},
+		{Key: "unicode-range", Value: "U+FFFFFFF"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ff.Family != "Inter Display" || ff.Weight.Min != 400 || ff.Weight.Max != 400 {
+		t.Errorf("expected invalid weight to default to 400, have %q %v", ff.Family, ff.Weight)
+	}
+	if ff.Style.Style != "normal" || !ff.Covers(0x10FFFF) {
+		t.Errorf("expected defaults for style and unicode-range, have %v %v", ff.Style, ff.UnicodeRange)
+	}
+	if _, err = css.ParseFontFace([]style.KeyValue{{Key: "font-family", Value: "X"}}); err == nil {
+		t.Errorf("expected @font-face without src to be refused")
+	}
+	if _, err = css.ParseFontFace([]style.KeyValue{{Key: "src", Value: "url(x.otf)"}}); err == nil {
+		t.Errorf("expected @font-face without font-family to be refused")
+	}
+}
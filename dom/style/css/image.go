@@ -0,0 +1,338 @@
+package css
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/tyse/core/dimen"
+	. "github.com/npillmayer/tyse/core/percent"
+)
+
+// --- Aspect ratio ----------------------------------------------------------
+
+// AspectRatioT is an option type for CSS property aspect-ratio.
+type AspectRatioT struct {
+	ratio float64 // width / height, 0 for none
+	auto  bool
+}
+
+// AutoAspectRatio returns the default aspect ratio `auto`: replaced elements
+// use their natural aspect ratio, other boxes have none.
+func AutoAspectRatio() AspectRatioT {
+	return AspectRatioT{auto: true}
+}
+
+// AspectRatio creates an aspect ratio of width / height.
+func AspectRatio(width, height float64) AspectRatioT {
+	if width <= 0 || height <= 0 {
+		return AspectRatioT{}
+	}
+	return AspectRatioT{ratio: width / height}
+}
+
+// ParseAspectRatio parses a property string for aspect-ratio. Valid values are
+//
+//     auto
+//     16 / 9
+//     1.5
+//     auto 4/3       (natural ratio for replaced elements, 4/3 otherwise)
+//
+// Degenerate ratios, i.e. ratios with a zero component, result in `auto`.
+func ParseAspectRatio(p style.Property) (AspectRatioT, error) {
+	s := strings.ToLower(strings.TrimSpace(string(p)))
+	if s == "" {
+		return AspectRatioT{}, errors.New("empty aspect ratio")
+	}
+	var ar AspectRatioT
+	fields := strings.Fields(strings.ReplaceAll(s, "/", " / "))
+	var nums []float64
+	slash := false
+	for _, f := range fields {
+		switch f {
+		case "auto":
+			if ar.auto {
+				return AspectRatioT{}, errors.New("format error parsing aspect ratio")
+			}
+			ar.auto = true
+		case "/":
+			if len(nums) != 1 || slash {
+				return AspectRatioT{}, errors.New("format error parsing aspect ratio")
+			}
+			slash = true
+		default:
+			n, err := strconv.ParseFloat(f, 64)
+			if err != nil || n < 0 || math.IsInf(n, 0) || len(nums) == 2 || (len(nums) == 1 && !slash) {
+				return AspectRatioT{}, errors.New("format error parsing aspect ratio")
+			}
+			nums = append(nums, n)
+		}
+	}
+	if slash && len(nums) != 2 {
+		return AspectRatioT{}, errors.New("format error parsing aspect ratio")
+	}
+	switch len(nums) {
+	case 1:
+		nums = append(nums, 1)
+	case 0:
+		return ar, nil
+	}
+	if nums[0] == 0 || nums[1] == 0 { // degenerate ratio
+		return AutoAspectRatio(), nil
+	}
+	ar.ratio = nums[0] / nums[1]
+	return ar, nil
+}
+
+// IsAuto returns true if replaced elements should use their natural aspect ratio.
+func (ar AspectRatioT) IsAuto() bool {
+	return ar.auto
+}
+
+// Ratio returns the preferred aspect ratio width / height, if any.
+func (ar AspectRatioT) Ratio() (float64, bool) {
+	return ar.ratio, ar.ratio > 0
+}
+
+// HeightFor returns the height of a box of the given width, if ar has a ratio.
+func (ar AspectRatioT) HeightFor(width dimen.DU) (dimen.DU, bool) {
+	if ar.ratio <= 0 {
+		return 0, false
+	}
+	return dimen.DU(math.Round(float64(width) / ar.ratio)), true
+}
+
+// WidthFor returns the width of a box of the given height, if ar has a ratio.
+func (ar AspectRatioT) WidthFor(height dimen.DU) (dimen.DU, bool) {
+	if ar.ratio <= 0 {
+		return 0, false
+	}
+	return dimen.DU(math.Round(float64(height) * ar.ratio)), true
+}
+
+func (ar AspectRatioT) String() string {
+	r := strconv.FormatFloat(ar.ratio, 'g', -1, 64)
+	switch {
+	case ar.auto && ar.ratio > 0:
+		return "auto " + r
+	case ar.ratio > 0:
+		return r
+	}
+	return "auto"
+}
+
+// --- Object fit ------------------------------------------------------------
+
+// ObjectFit is an enum type for CSS property object-fit.
+type ObjectFit uint8
+
+// Values for CSS property object-fit.
+const (
+	ObjectFitFill      ObjectFit = iota // stretch content to the box (default)
+	ObjectFitContain                    // scale content to fit into the box, keeping its ratio
+	ObjectFitCover                      // scale content to cover the box, keeping its ratio
+	ObjectFitNone                       // keep the natural size of the content
+	ObjectFitScaleDown                  // as none or contain, whichever is smaller
+)
+
+func (fit ObjectFit) String() string {
+	switch fit {
+	case ObjectFitContain:
+		return "contain"
+	case ObjectFitCover:
+		return "cover"
+	case ObjectFitNone:
+		return "none"
+	case ObjectFitScaleDown:
+		return "scale-down"
+	}
+	return "fill"
+}
+
+// ParseObjectFit returns the object-fit mode for a property string.
+// Unknown values result in ObjectFitFill.
+func ParseObjectFit(p style.Property) ObjectFit {
+	switch strings.ToLower(strings.TrimSpace(string(p))) {
+	case "contain":
+		return ObjectFitContain
+	case "cover":
+		return ObjectFitCover
+	case "none":
+		return ObjectFitNone
+	case "scale-down":
+		return ObjectFitScaleDown
+	}
+	return ObjectFitFill
+}
+
+// Fit returns the size of content with natural size w × h, placed into a box
+// of size boxW × boxH. Content without a natural size is stretched to the box.
+func (fit ObjectFit) Fit(w, h, boxW, boxH dimen.DU) (dimen.DU, dimen.DU) {
+	if fit == ObjectFitFill || w <= 0 || h <= 0 {
+		return boxW, boxH
+	}
+	scale := func(s float64) (dimen.DU, dimen.DU) {
+		return dimen.DU(math.Round(float64(w) * s)), dimen.DU(math.Round(float64(h) * s))
+	}
+	sx, sy := float64(boxW)/float64(w), float64(boxH)/float64(h)
+	switch fit {
+	case ObjectFitContain:
+		return scale(math.Min(sx, sy))
+	case ObjectFitCover:
+		return scale(math.Max(sx, sy))
+	case ObjectFitScaleDown:
+		return scale(math.Min(1, math.Min(sx, sy)))
+	}
+	return w, h
+}
+
+// --- Object position -------------------------------------------------------
+
+// ObjectPositionT is the position of content within its box, as set by CSS
+// property object-position. Offsets are either absolute or percentages of the
+// free space, i.e. of the difference between box size and content size.
+type ObjectPositionT struct {
+	X, Y DimenT
+}
+
+// CenteredObject returns the default object position `50% 50%`.
+func CenteredObject() ObjectPositionT {
+	return ObjectPositionT{X: Percentage(FromInt(50)), Y: Percentage(FromInt(50))}
+}
+
+// ParseObjectPosition parses a property string for object-position. Valid values
+// consist of one or two components, each one either a keyword (left, center,
+// right, top, bottom), a percentage or a length:
+//
+//     center
+//     right top
+//     25% 10pt
+//
+// A missing component defaults to `center`. Edge offsets (e.g. `right 10pt`)
+// are not supported.
+func ParseObjectPosition(p style.Property) (ObjectPositionT, error) {
+	fields := strings.Fields(strings.ToLower(string(p)))
+	if len(fields) == 0 || len(fields) > 2 {
+		return ObjectPositionT{}, errors.New("format error parsing object position")
+	}
+	pos := CenteredObject()
+	var axes []byte // 'x', 'y' or 'c' (center or non-keyword) per component
+	var dims []DimenT
+	for _, f := range fields {
+		switch f {
+		case "left":
+			axes, dims = append(axes, 'x'), append(dims, Percentage(FromInt(0)))
+		case "right":
+			axes, dims = append(axes, 'x'), append(dims, Percentage(FromInt(100)))
+		case "top":
+			axes, dims = append(axes, 'y'), append(dims, Percentage(FromInt(0)))
+		case "bottom":
+			axes, dims = append(axes, 'y'), append(dims, Percentage(FromInt(100)))
+		case "center":
+			axes, dims = append(axes, 'c'), append(dims, Percentage(FromInt(50)))
+		default:
+			d, err := parsePositionComponent(f)
+			if err != nil {
+				return ObjectPositionT{}, err
+			}
+			axes, dims = append(axes, 'c'), append(dims, d)
+		}
+	}
+	if len(dims) == 1 {
+		if axes[0] == 'y' {
+			pos.Y = dims[0]
+		} else {
+			pos.X = dims[0]
+		}
+		return pos, nil
+	}
+	switch {
+	case axes[0] == 'y' || axes[1] == 'x': // vertical keyword first, e.g. "top left"
+		if axes[0] == 'x' || axes[1] == 'y' {
+			return ObjectPositionT{}, errors.New("format error parsing object position")
+		}
+		pos.X, pos.Y = dims[1], dims[0]
+	default:
+		pos.X, pos.Y = dims[0], dims[1]
+	}
+	return pos, nil
+}
+
+// parsePositionComponent parses a percentage or a length.
+func parsePositionComponent(s string) (DimenT, error) {
+	if strings.HasSuffix(s, "%") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+		if err != nil {
+			return DimenT{}, errors.New("format error parsing object position")
+		}
+		return Percentage(FromInt(n)), nil
+	}
+	d, err := ParseDimen(s)
+	if err != nil || d.IsNone() {
+		return DimenT{}, errors.New("format error parsing object position")
+	}
+	return d, nil
+}
+
+// Offsets returns the offset of content of size w × h within a box of size
+// boxW × boxH. Offsets in units relative to fonts or the viewport cannot be
+// resolved here and result in 0.
+func (pos ObjectPositionT) Offsets(w, h, boxW, boxH dimen.DU) (dimen.DU, dimen.DU) {
+	return positionOffset(pos.X, boxW-w), positionOffset(pos.Y, boxH-h)
+}
+
+func positionOffset(d DimenT, free dimen.DU) dimen.DU {
+	switch {
+	case d.IsPercent():
+		return dimen.DU(math.Round(float64(free) * float64(d.percent) / float64(FromInt(100))))
+	case d.IsAbsolute():
+		return d.d
+	}
+	return 0
+}
+
+// --- Image rendering -------------------------------------------------------
+
+// ImageRendering is an enum type for CSS property image-rendering.
+type ImageRendering uint8
+
+// Values for CSS property image-rendering.
+const (
+	ImageRenderingAuto        ImageRendering = iota // up to the renderer (default)
+	ImageRenderingSmooth                            // smooth colors when scaling
+	ImageRenderingHighQuality                       // as smooth, preferring quality
+	ImageRenderingCrispEdges                        // preserve contrast and edges
+	ImageRenderingPixelated                         // nearest neighbour when scaling up
+)
+
+func (ir ImageRendering) String() string {
+	switch ir {
+	case ImageRenderingSmooth:
+		return "smooth"
+	case ImageRenderingHighQuality:
+		return "high-quality"
+	case ImageRenderingCrispEdges:
+		return "crisp-edges"
+	case ImageRenderingPixelated:
+		return "pixelated"
+	}
+	return "auto"
+}
+
+// ParseImageRendering returns the image-rendering mode for a property string.
+// Unknown values result in ImageRenderingAuto.
+func ParseImageRendering(p style.Property) ImageRendering {
+	switch strings.ToLower(strings.TrimSpace(string(p))) {
+	case "smooth":
+		return ImageRenderingSmooth
+	case "high-quality":
+		return ImageRenderingHighQuality
+	case "crisp-edges", "optimizespeed":
+		return ImageRenderingCrispEdges
+	case "pixelated":
+		return ImageRenderingPixelated
+	}
+	return ImageRenderingAuto
+}
@@ -0,0 +1,128 @@
+package css_test
+
+import (
+	"testing"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/tyse/core/dimen"
+)
+
+func TestAspectRatio(t *testing.T) {
+	for _, test := range []struct {
+		p     style.Property
+		auto  bool
+		ratio float64
+		err   bool
+	}{
+		{"auto", true, 0, false},
+		{"16 / 9", false, 16.0 / 9.0, false},
+		{"4/3", false, 4.0 / 3.0, false},
+		{"1.5", false, 1.5, false},
+		{"auto 2/1", true, 2, false},
+		{"2/1 auto", true, 2, false},
+		{"0/1", true, 0, false},
+		{"16 9", false, 0, true},
+		{"/9", false, 0, true},
+		{"-1", false, 0, true},
+		{"", false, 0, true},
+	} {
+		ar, err := css.ParseAspectRatio(test.p)
+		if (err != nil) != test.err {
+			t.Errorf("%q: unexpected error status: %v", test.p, err)
+			continue
+		}
+		r, _ := ar.Ratio()
+		if !test.err && (ar.IsAuto() != test.auto || r != test.ratio) {
+			t.Errorf("%q: expected auto=%v/ratio=%g, have %v/%g", test.p, test.auto, test.ratio, ar.IsAuto(), r)
+		}
+	}
+	ar, _ := css.ParseAspectRatio("16/9")
+	if h, ok := ar.HeightFor(160 * dimen.PT); !ok || h != 90*dimen.PT {
+		t.Errorf("expected height for 160pt to be 90pt, is %s", h)
+	}
+}
+
+func TestObjectFit(t *testing.T) {
+	if fit := css.ParseObjectFit("scale-down"); fit != css.ObjectFitScaleDown || fit.String() != "scale-down" {
+		t.Errorf("expected object-fit to be scale-down, is %s", fit)
+	}
+	if fit := css.ParseObjectFit("bogus"); fit != css.ObjectFitFill {
+		t.Errorf("expected unknown object-fit to result in fill, is %s", fit)
+	}
+	w, h, bw, bh := 400*dimen.PT, 200*dimen.PT, 100*dimen.PT, 100*dimen.PT
+	for _, test := range []struct {
+		fit  css.ObjectFit
+		w, h dimen.DU
+	}{
+		{css.ObjectFitFill, 100 * dimen.PT, 100 * dimen.PT},
+		{css.ObjectFitContain, 100 * dimen.PT, 50 * dimen.PT},
+		{css.ObjectFitCover, 200 * dimen.PT, 100 * dimen.PT},
+		{css.ObjectFitNone, 400 * dimen.PT, 200 * dimen.PT},
+		{css.ObjectFitScaleDown, 100 * dimen.PT, 50 * dimen.PT},
+	} {
+		if fw, fh := test.fit.Fit(w, h, bw, bh); fw != test.w || fh != test.h {
+			t.Errorf("%s: expected %s × %s, have %s × %s", test.fit, test.w, test.h, fw, fh)
+		}
+	}
+	if fw, fh := css.ObjectFitScaleDown.Fit(10*dimen.PT, 10*dimen.PT, bw, bh); fw != 10*dimen.PT || fh != 10*dimen.PT {
+		t.Errorf("expected scale-down not to scale up small content, have %s × %s", fw, fh)
+	}
+}
+
+func TestObjectPosition(t *testing.T) {
+	w, h, bw, bh := 60*dimen.PT, 20*dimen.PT, 100*dimen.PT, 100*dimen.PT
+	for _, test := range []struct {
+		p    style.Property
+		x, y dimen.DU
+		err  bool
+	}{
+		{"50% 50%", 20 * dimen.PT, 40 * dimen.PT, false},
+		{"center", 20 * dimen.PT, 40 * dimen.PT, false},
+		{"left top", 0, 0, false},
+		{"top left", 0, 0, false},
+		{"bottom", 20 * dimen.PT, 80 * dimen.PT, false},
+		{"right 10pt", 40 * dimen.PT, 10 * dimen.PT, false},
+		{"25% 100%", 10 * dimen.PT, 80 * dimen.PT, false},
+		{"left right", 0, 0, true},
+		{"left top 5pt", 0, 0, true},
+		{"wide", 0, 0, true},
+	} {
+		pos, err := css.ParseObjectPosition(test.p)
+		if (err != nil) != test.err {
+			t.Errorf("%q: unexpected error status: %v", test.p, err)
+			continue
+		}
+		if x, y := pos.Offsets(w, h, bw, bh); !test.err && (x != test.x || y != test.y) {
+			t.Errorf("%q: expected offsets %s/%s, have %s/%s", test.p, test.x, test.y, x, y)
+		}
+	}
+	for kw, pct := range map[style.Property]style.Property{
+		"left top": "0% 0%", "center": "50% 50%", "right bottom": "100% 100%",
+	} {
+		p1, _ := css.ParseObjectPosition(kw)
+		p2, _ := css.ParseObjectPosition(pct)
+		if p1 != p2 {
+			t.Errorf("expected %q to equal %q, have %v and %v", kw, pct, p1, p2)
+		}
+	}
+}
+
+func TestImageRendering(t *testing.T) {
+	if ir := css.ParseImageRendering("pixelated"); ir != css.ImageRenderingPixelated || ir.String() != "pixelated" {
+		t.Errorf("expected image-rendering to be pixelated, is %s", ir)
+	}
+	if style.GroupNameFromPropertyKey("object-fit") != style.PGImage {
+		t.Errorf("expected object-fit to belong to group %s", style.PGImage)
+	}
+	if !style.IsCascading("image-rendering") || style.IsCascading("object-position") {
+		t.Errorf("expected image-rendering only to be inherited")
+	}
+	defaults := style.InitializeDefaultPropertyValues(nil)
+	if p, _ := defaults.Property("aspect-ratio"); p != "auto" {
+		t.Errorf("expected default aspect-ratio to be auto, is %q", p)
+	}
+	if p, _ := defaults.Property("object-position"); p != "50% 50%" {
+		t.Errorf("expected default object-position to be centered, is %q", p)
+	}
+}
@@ -0,0 +1,185 @@
+package css
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+)
+
+// lineHeight is an enum type for the kinds of values of CSS property line-height.
+type lineHeight uint16
+
+// Enum values for type lineHeight
+const (
+	lineHeightUnset  lineHeight = iota
+	lineHeightNormal            // CSS normal (default)
+	lineHeightNumber            // unitless factor, multiplied by the font size
+	lineHeightDimen             // length or percentage
+)
+
+// LineHeightT is an option type for CSS property line-height.
+type LineHeightT struct {
+	dimen  DimenT
+	factor float64
+	kind   lineHeight
+}
+
+/*
+type LineHeightT
+	= Unset
+	| Normal
+	| Factor float64
+	| Dimen DimenT
+*/
+
+// NormalLineHeight creates a line-height of value `normal`.
+func NormalLineHeight() LineHeightT {
+	return LineHeightT{kind: lineHeightNormal}
+}
+
+// LineHeightFactor creates a line-height given as a unitless number, which
+// will be multiplied by the font size of an element.
+func LineHeightFactor(f float64) LineHeightT {
+	return LineHeightT{kind: lineHeightNumber, factor: f}
+}
+
+// LineHeightDimen creates a line-height given as a length or a percentage.
+func LineHeightDimen(d DimenT) LineHeightT {
+	return LineHeightT{kind: lineHeightDimen, dimen: d}
+}
+
+// ParseLineHeight returns an optional line-height type from a property string.
+// It will never return an error, even with illegal input, but instead will then
+// return an unset line-height.
+func ParseLineHeight(p style.Property) LineHeightT {
+	s := strings.ToLower(strings.TrimSpace(string(p)))
+	switch s {
+	case "":
+		return LineHeightT{}
+	case "normal":
+		return NormalLineHeight()
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if f < 0 {
+			return LineHeightT{}
+		}
+		return LineHeightFactor(f)
+	}
+	d, err := ParseDimen(s)
+	if err != nil || d.IsNone() {
+		tracer().Debugf("line-height option from property '%s': %v", p, err)
+		return LineHeightT{}
+	}
+	return LineHeightDimen(d)
+}
+
+// ---------------------------------------------------------------------------
+
+func (lh LineHeightT) Match() *LHMatcher {
+	return &LHMatcher{lh: lh}
+}
+
+type LHMatcher struct {
+	lh LineHeightT
+}
+
+func (m *LHMatcher) Unset() *LHMatcher {
+	if m.lh.kind == lineHeightUnset {
+		return m
+	}
+	return nil
+}
+
+func (m *LHMatcher) Normal() *LHMatcher {
+	if m.lh.kind == lineHeightNormal {
+		return m
+	}
+	return nil
+}
+
+func (m *LHMatcher) Factor(f *float64) *LHMatcher {
+	if m.lh.kind == lineHeightNumber {
+		if f != nil {
+			*f = m.lh.factor
+		}
+		return m
+	}
+	return nil
+}
+
+func (m *LHMatcher) Dimen(d *DimenT) *LHMatcher {
+	if m.lh.kind == lineHeightDimen {
+		if d != nil {
+			*d = m.lh.dimen
+		}
+		return m
+	}
+	return nil
+}
+
+// --- Expression matching ---------------------------------------------------
+
+type LineHeightPatterns[T any] struct {
+	Unset   T
+	Normal  T
+	Factor  T
+	Dimen   T
+	Default T
+}
+
+func LineHeightPattern[T any](lh LineHeightT) *LHMatchExpr[T] {
+	return &LHMatchExpr[T]{lh: lh}
+}
+
+// LHMatchExpr is part of pattern matching for LineHeightT types and intended to be
+// instantiated using `LineHeightPattern()` only.
+type LHMatchExpr[T any] struct {
+	lh LineHeightT
+}
+
+func (m *LHMatchExpr[T]) OneOf(patterns LineHeightPatterns[T]) T {
+	switch m.lh.kind {
+	case lineHeightUnset:
+		return patterns.Unset
+	case lineHeightNormal:
+		return patterns.Normal
+	case lineHeightNumber:
+		return patterns.Factor
+	case lineHeightDimen:
+		return patterns.Dimen
+	}
+	return patterns.Default
+}
+
+// WithFactor extracts the factor of a unitless line-height.
+func (m *LHMatchExpr[T]) WithFactor(f *float64) *LHMatchExpr[T] {
+	if f != nil {
+		*f = m.lh.factor
+	}
+	return m
+}
+
+// WithDimen extracts the dimension of a length or percentage line-height.
+func (m *LHMatchExpr[T]) WithDimen(d *DimenT) *LHMatchExpr[T] {
+	if d != nil {
+		*d = m.lh.dimen
+	}
+	return m
+}
+
+func (m *LHMatchExpr[T]) Const(x T) T {
+	return x
+}
+
+// ---------------------------------------------------------------------------
+
+// IsUnset returns true if lh is unset.
+func (lh LineHeightT) IsUnset() bool {
+	return lh.kind == lineHeightUnset
+}
+
+// IsNormal returns true if lh is `normal`.
+func (lh LineHeightT) IsNormal() bool {
+	return lh.kind == lineHeightNormal
+}
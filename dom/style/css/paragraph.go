@@ -0,0 +1,325 @@
+package css
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/styledtree"
+)
+
+// --- Text alignment --------------------------------------------------------
+
+// TextAlign is an enum type for CSS properties text-align and text-align-last.
+type TextAlign uint8
+
+// Values for CSS properties text-align and text-align-last.
+const (
+	TextAlignStart       TextAlign = iota // align to the start edge of the line (default)
+	TextAlignEnd                          // align to the end edge of the line
+	TextAlignLeft                         // align to the left edge of the line
+	TextAlignRight                        // align to the right edge of the line
+	TextAlignCenter                       // center within the line
+	TextAlignJustify                      // stretch to fill the line
+	TextAlignMatchParent                  // as the parent, with start and end resolved
+	TextAlignAuto                         // text-align-last only: as text-align, see ForLastLine
+)
+
+func (ta TextAlign) String() string {
+	switch ta {
+	case TextAlignEnd:
+		return "end"
+	case TextAlignLeft:
+		return "left"
+	case TextAlignRight:
+		return "right"
+	case TextAlignCenter:
+		return "center"
+	case TextAlignJustify:
+		return "justify"
+	case TextAlignMatchParent:
+		return "match-parent"
+	case TextAlignAuto:
+		return "auto"
+	}
+	return "start"
+}
+
+// ParseTextAlign returns the alignment for a property string of text-align.
+// Unknown values result in TextAlignStart.
+func ParseTextAlign(p style.Property) TextAlign {
+	switch strings.ToLower(strings.TrimSpace(string(p))) {
+	case "end":
+		return TextAlignEnd
+	case "left":
+		return TextAlignLeft
+	case "right":
+		return TextAlignRight
+	case "center":
+		return TextAlignCenter
+	case "justify":
+		return TextAlignJustify
+	case "match-parent":
+		return TextAlignMatchParent
+	}
+	return TextAlignStart
+}
+
+// ParseTextAlignLast returns the alignment for a property string of
+// text-align-last. Unknown values result in TextAlignAuto.
+func ParseTextAlignLast(p style.Property) TextAlign {
+	s := strings.ToLower(strings.TrimSpace(string(p)))
+	if s == "start" {
+		return TextAlignStart
+	}
+	if ta := ParseTextAlign(p); ta != TextAlignStart {
+		return ta
+	}
+	return TextAlignAuto
+}
+
+// Physical resolves the flow-relative alignments start and end to left or
+// right, depending on the direction of the text. Other alignments are
+// returned unchanged.
+func (ta TextAlign) Physical(rtl bool) TextAlign {
+	switch ta {
+	case TextAlignStart:
+		if rtl {
+			return TextAlignRight
+		}
+		return TextAlignLeft
+	case TextAlignEnd:
+		if rtl {
+			return TextAlignLeft
+		}
+		return TextAlignRight
+	}
+	return ta
+}
+
+// ForLastLine returns the alignment of the last line of a paragraph, i.e. of
+// the line before a forced line break, given the text-align-last alignment
+// last and the text-align alignment align. For last = auto, the last line is
+// aligned as the other lines, with justified lines aligned to the start edge.
+func (last TextAlign) ForLastLine(align TextAlign) TextAlign {
+	if last != TextAlignAuto {
+		return last
+	}
+	if align == TextAlignJustify {
+		return TextAlignStart
+	}
+	return align
+}
+
+// --- Text indent -----------------------------------------------------------
+
+// TextIndentT is the indentation of the first line of a paragraph, as set by
+// CSS property text-indent. Indent is a length or a percentage of the width of
+// the containing block.
+type TextIndentT struct {
+	Indent   DimenT
+	Hanging  bool // indent all lines but the first one
+	EachLine bool // indent the first line after each forced line break, too
+}
+
+// ParseTextIndent parses a property string for text-indent. Valid values are
+//
+//     2em
+//     5%
+//     3em hanging each-line
+//
+// An empty property results in an indentation of 0.
+func ParseTextIndent(p style.Property) (TextIndentT, error) {
+	ti := TextIndentT{Indent: JustDimen(0)}
+	dimenSeen := false
+	for _, f := range strings.Fields(strings.ToLower(string(p))) {
+		switch f {
+		case "hanging":
+			ti.Hanging = true
+		case "each-line":
+			ti.EachLine = true
+		default:
+			d, err := ParseDimen(f)
+			if err != nil || d.IsNone() || dimenSeen {
+				return TextIndentT{Indent: JustDimen(0)}, errors.New("format error parsing text indent")
+			}
+			ti.Indent, dimenSeen = d, true
+		}
+	}
+	if (ti.Hanging || ti.EachLine) && !dimenSeen {
+		return TextIndentT{Indent: JustDimen(0)}, errors.New("format error parsing text indent")
+	}
+	return ti, nil
+}
+
+// IndentsLine is true if a line of a paragraph is to be indented. first
+// denotes the first line of a paragraph, afterBreak a line following a forced
+// line break.
+func (ti TextIndentT) IndentsLine(first, afterBreak bool) bool {
+	starts := first || (ti.EachLine && afterBreak)
+	return starts != ti.Hanging
+}
+
+// --- Hyphenation -----------------------------------------------------------
+
+// Hyphens is an enum type for CSS property hyphens.
+type Hyphens uint8
+
+// Values for CSS property hyphens.
+const (
+	HyphensManual Hyphens = iota // break words at soft hyphens only (default)
+	HyphensNone                  // do not break words, not even at soft hyphens
+	HyphensAuto                  // break words at hyphenation points of the language
+)
+
+func (h Hyphens) String() string {
+	switch h {
+	case HyphensNone:
+		return "none"
+	case HyphensAuto:
+		return "auto"
+	}
+	return "manual"
+}
+
+// ParseHyphens returns the hyphenation mode for a property string.
+// Unknown values result in HyphensManual.
+func ParseHyphens(p style.Property) Hyphens {
+	switch strings.ToLower(strings.TrimSpace(string(p))) {
+	case "none":
+		return HyphensNone
+	case "auto":
+		return HyphensAuto
+	}
+	return HyphensManual
+}
+
+// DefaultHyphenateCharacter is the string shown at hyphenation points for
+// hyphenate-character `auto`, i.e. U+2010 HYPHEN.
+const DefaultHyphenateCharacter = "‐"
+
+// HyphenateCharacter returns the string to show at hyphenation points, as set
+// by CSS property hyphenate-character. Values other than `auto` are CSS
+// strings, which may contain escapes of hexadecimal code points:
+//
+//     auto       => "‐"
+//     "-"        => "-"
+//     "\2010"    => "‐"
+//
+// Malformed values result in DefaultHyphenateCharacter.
+func HyphenateCharacter(p style.Property) string {
+	s := strings.TrimSpace(string(p))
+	if len(s) < 2 || (s[0] != '"' && s[0] != '\'') || s[len(s)-1] != s[0] {
+		return DefaultHyphenateCharacter
+	}
+	s = s[1 : len(s)-1]
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		j := i + 1
+		for j < len(s) && j < i+7 && isHexDigit(s[j]) {
+			j++
+		}
+		if j == i+1 { // escaped character
+			b.WriteByte(s[j])
+			i = j
+			continue
+		}
+		r, _ := strconv.ParseUint(s[i+1:j], 16, 32)
+		b.WriteRune(rune(r))
+		if j < len(s) && s[j] == ' ' { // a single space terminates an escape
+			j++
+		}
+		i = j - 1
+	}
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// --- Tab size --------------------------------------------------------------
+
+// TabSizeT is the width of tab characters, as set by CSS property tab-size.
+// It is either a number of space characters or a length.
+type TabSizeT struct {
+	spaces float64
+	length DimenT
+}
+
+// TabSizeSpaces creates a tab size of n space characters.
+func TabSizeSpaces(n float64) TabSizeT {
+	return TabSizeT{spaces: n}
+}
+
+// ParseTabSize parses a property string for tab-size, which is either a
+// non-negative number of spaces or a length. An empty property results in the
+// default of 8 spaces.
+func ParseTabSize(p style.Property) (TabSizeT, error) {
+	s := strings.ToLower(strings.TrimSpace(string(p)))
+	if s == "" {
+		return TabSizeSpaces(8), nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		if n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+			return TabSizeSpaces(8), errors.New("format error parsing tab size")
+		}
+		return TabSizeSpaces(n), nil
+	}
+	d, err := ParseDimen(s)
+	if err != nil || d.IsNone() || d.IsPercent() {
+		return TabSizeSpaces(8), errors.New("format error parsing tab size")
+	}
+	return TabSizeT{length: d}, nil
+}
+
+// Spaces returns the number of space characters of a tab, if ts is not a length.
+func (ts TabSizeT) Spaces() (float64, bool) {
+	return ts.spaces, ts.length.IsNone()
+}
+
+// Length returns the width of a tab, if ts is a length.
+func (ts TabSizeT) Length() (DimenT, bool) {
+	return ts.length, !ts.length.IsNone()
+}
+
+func (ts TabSizeT) String() string {
+	if !ts.length.IsNone() {
+		return ts.length.String()
+	}
+	return strconv.FormatFloat(ts.spaces, 'g', -1, 64)
+}
+
+// --- Paragraph properties --------------------------------------------------
+
+// ParagraphT holds the properties of property group Paragraph, which control
+// breaking the text of a block into lines.
+type ParagraphT struct {
+	Align              TextAlign
+	AlignLast          TextAlign
+	Indent             TextIndentT
+	Hyphens            Hyphens
+	HyphenateCharacter string
+	TabSize            TabSizeT
+}
+
+// Paragraph resolves the paragraph properties of a styled node (see
+// ResolveProperty). Malformed values result in the defaults of the properties.
+func Paragraph(node *styledtree.StyNode) ParagraphT {
+	indent, _ := ParseTextIndent(ResolveProperty(node, "text-indent"))
+	tabs, _ := ParseTabSize(ResolveProperty(node, "tab-size"))
+	return ParagraphT{
+		Align:              ParseTextAlign(ResolveProperty(node, "text-align")),
+		AlignLast:          ParseTextAlignLast(ResolveProperty(node, "text-align-last")),
+		Indent:             indent,
+		Hyphens:            ParseHyphens(ResolveProperty(node, "hyphens")),
+		HyphenateCharacter: HyphenateCharacter(ResolveProperty(node, "hyphenate-character")),
+		TabSize:            tabs,
+	}
+}
@@ -0,0 +1,146 @@
+package css_test
+
+import (
+	"testing"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"golang.org/x/net/html"
+)
+
+func TestTextAlign(t *testing.T) {
+	if ta := css.ParseTextAlign("Justify"); ta != css.TextAlignJustify || ta.String() != "justify" {
+		t.Errorf("expected text-align to be justify, is %s", ta)
+	}
+	if ta := css.ParseTextAlign("auto"); ta != css.TextAlignStart {
+		t.Errorf("expected illegal text-align to result in start, is %s", ta)
+	}
+	if ta := css.ParseTextAlign("end").Physical(true); ta != css.TextAlignLeft {
+		t.Errorf("expected end to be left for right-to-left text, is %s", ta)
+	}
+	last := css.ParseTextAlignLast("")
+	if last != css.TextAlignAuto || last.ForLastLine(css.TextAlignJustify) != css.TextAlignStart ||
+		last.ForLastLine(css.TextAlignCenter) != css.TextAlignCenter {
+		t.Errorf("expected text-align-last auto to follow text-align, except for justify")
+	}
+	if last = css.ParseTextAlignLast("start"); last.ForLastLine(css.TextAlignRight) != css.TextAlignStart {
+		t.Errorf("expected text-align-last start to override text-align")
+	}
+}
+
+func TestTextIndent(t *testing.T) {
+	for _, test := range []struct {
+		p                 style.Property
+		indent            string
+		hanging, eachLine bool
+		err               bool
+	}{
+		{"", "0sp", false, false, false},
+		{"2em", "2em", false, false, false},
+		{"5%", "5%", false, false, false},
+		{"3em hanging each-line", "3em", true, true, false},
+		{"hanging 10em", "10em", true, false, false},
+		{"hanging", "0sp", false, false, true},
+		{"2em 3em", "0sp", false, false, true},
+	} {
+		ti, err := css.ParseTextIndent(test.p)
+		if (err != nil) != test.err {
+			t.Errorf("%q: expected error = %v, have %v", test.p, test.err, err)
+		}
+		if ti.Indent.String() != test.indent || ti.Hanging != test.hanging || ti.EachLine != test.eachLine {
+			t.Errorf("%q: expected indent %s (hanging=%v, each-line=%v), have %+v", test.p,
+				test.indent, test.hanging, test.eachLine, ti)
+		}
+	}
+	ti, _ := css.ParseTextIndent("1em hanging")
+	if ti.IndentsLine(true, false) || !ti.IndentsLine(false, true) {
+		t.Errorf("expected hanging indent to skip the first line only")
+	}
+}
+
+func TestHyphenation(t *testing.T) {
+	if h := css.ParseHyphens("auto"); h != css.HyphensAuto || h.String() != "auto" {
+		t.Errorf("expected hyphens to be auto, is %s", h)
+	}
+	if h := css.ParseHyphens("sometimes"); h != css.HyphensManual {
+		t.Errorf("expected illegal hyphens to result in manual, is %s", h)
+	}
+	for _, test := range []struct {
+		p style.Property
+		s string
+	}{
+		{"auto", css.DefaultHyphenateCharacter},
+		{`"-"`, "-"},
+		{`'\2010'`, "‐"},
+		{`"\ad x"`, "­x"},
+		{`"\""`, `"`},
+		{`"-`, css.DefaultHyphenateCharacter},
+	} {
+		if s := css.HyphenateCharacter(test.p); s != test.s {
+			t.Errorf("%s: expected hyphenate character %q, have %q", test.p, test.s, s)
+		}
+	}
+}
+
+func TestTabSize(t *testing.T) {
+	for _, test := range []struct {
+		p      style.Property
+		spaces float64
+		length string
+		err    bool
+	}{
+		{"4", 4, "", false},
+		{"2.5", 2.5, "", false},
+		{"", 8, "", false},
+		{"2ch", 0, "2ch", false},
+		{"-1", 8, "", true},
+		{"50%", 8, "", true},
+	} {
+		ts, err := css.ParseTabSize(test.p)
+		if (err != nil) != test.err {
+			t.Errorf("%q: expected error = %v, have %v", test.p, test.err, err)
+		}
+		if d, ok := ts.Length(); ok {
+			if d.String() != test.length {
+				t.Errorf("%q: expected tab size %s, have %s", test.p, test.length, d)
+			}
+		} else if n, _ := ts.Spaces(); n != test.spaces || test.length != "" {
+			t.Errorf("%q: expected tab size of %v spaces, have %s", test.p, test.spaces, ts)
+		}
+	}
+}
+
+func TestParagraph(t *testing.T) {
+	for _, key := range []string{"text-align", "text-align-last", "text-indent", "hyphens",
+		"hyphenate-character", "tab-size"} {
+		if style.GroupNameFromPropertyKey(key) != style.PGParagraph || !style.IsCascading(key) {
+			t.Errorf("expected %s to be an inherited property of group %s", key, style.PGParagraph)
+		}
+	}
+	root := styledtree.NewNodeForHTMLNode(&html.Node{Type: html.DocumentNode})
+	styledtree.Node(root).SetStyles(style.InitializeDefaultPropertyValues(nil))
+	div := styledtree.NewNodeForHTMLNode(&html.Node{Type: html.ElementNode, Data: "div"})
+	divpg := style.NewPropertyGroup(style.PGParagraph)
+	divpg.Set("text-align", "justify")
+	divpg.Set("hyphens", "auto")
+	styledtree.Node(div).SetStyles(style.NewPropertyMap().AddAllFromGroup(divpg, false))
+	p := styledtree.NewNodeForHTMLNode(&html.Node{Type: html.ElementNode, Data: "p"})
+	pg := style.NewPropertyGroup(style.PGParagraph)
+	pg.Set("text-indent", "2em")
+	pg.Parent = divpg // cascade, as set up by the CSSOM
+	styledtree.Node(p).SetStyles(style.NewPropertyMap().AddAllFromGroup(pg, false))
+	root.AddChild(div)
+	div.AddChild(p)
+	//
+	para := css.Paragraph(styledtree.Node(p))
+	if para.Align != css.TextAlignJustify || para.AlignLast != css.TextAlignAuto || para.Hyphens != css.HyphensAuto {
+		t.Errorf("expected paragraph to inherit justified text and auto hyphens, have %+v", para)
+	}
+	if para.Indent.Indent.String() != "2em" || para.HyphenateCharacter != css.DefaultHyphenateCharacter {
+		t.Errorf("expected paragraph to be indented by 2em, with default hyphen, have %+v", para)
+	}
+	if n, ok := para.TabSize.Spaces(); !ok || n != 8 {
+		t.Errorf("expected default tab size of 8 spaces, have %s", para.TabSize)
+	}
+}
@@ -1,6 +1,8 @@
 package css_test
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/npillmayer/fp/dom/style"
@@ -68,3 +70,64 @@ func TestPositionAuto(t *testing.T) {
 		t.Errorf("expected ABSOLUTE, have %v", x)
 	}
 }
+
+func TestPositionMarshal(t *testing.T) {
+	positions := []css.PositionT{
+		{},
+		css.Static(),
+		css.Relative(nil),
+		css.Absolute([]css.PositionOffset{
+			{Dim: css.JustDimen(dimen.PT), Dir: css.Top},
+			{Dim: css.Auto(), Dir: css.Left},
+		}),
+		css.Fixed(css.ZeroOffsets()),
+	}
+	for _, p := range positions {
+		text, err := p.MarshalText()
+		if err != nil {
+			t.Fatalf("cannot marshal %#v: %v", p, err)
+		}
+		var q css.PositionT
+		if err = q.UnmarshalText(text); err != nil {
+			t.Fatalf("cannot unmarshal %q: %v", text, err)
+		}
+		if !reflect.DeepEqual(p, q) {
+			t.Errorf("expected text round trip of %q to preserve position, is %#v", text, q)
+		}
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("cannot marshal %#v to JSON: %v", p, err)
+		}
+		q = css.PositionT{}
+		if err = json.Unmarshal(data, &q); err != nil {
+			t.Fatalf("cannot unmarshal JSON %s: %v", data, err)
+		}
+		if !reflect.DeepEqual(p, q) {
+			t.Errorf("expected JSON round trip of %s to preserve position, is %#v", data, q)
+		}
+	}
+	var p css.PositionT
+	if err := p.UnmarshalText([]byte("static 0sp 0sp 0sp 0sp")); err == nil {
+		t.Errorf("expected static position with offsets to be rejected, wasn't")
+	}
+}
+
+func TestDisplayModeMarshal(t *testing.T) {
+	for _, s := range []string{"", "none", "block", "inline", "list-item", "inline-block", "table"} {
+		var disp css.DisplayMode
+		if err := json.Unmarshal([]byte(`"`+s+`"`), &disp); err != nil {
+			t.Fatalf("cannot unmarshal display %q: %v", s, err)
+		}
+		text, err := disp.MarshalText()
+		if err != nil {
+			t.Fatalf("cannot marshal display mode %s: %v", disp.FullString(), err)
+		}
+		if string(text) != s {
+			t.Errorf("expected display mode to marshal to %q, is %q", s, text)
+		}
+	}
+	var disp css.DisplayMode
+	if err := disp.UnmarshalText([]byte("flex-grid")); err == nil {
+		t.Errorf("expected unmarshaling of 'flex-grid' to fail, didn't")
+	}
+}
@@ -1,6 +1,8 @@
 package css
 
 import (
+	"encoding/json"
+	"fmt"
 	"strings"
 
 	"github.com/npillmayer/fp/dom/style"
@@ -260,3 +262,147 @@ func (p PositionT) IsAbsolute() bool {
 func (p PositionT) IsFixed() bool {
 	return p.kind == positionFixed
 }
+
+// --- Marshaling ------------------------------------------------------------
+
+// String returns the kind of a position, followed by its offsets in the order
+// top, right, bottom, left, if any offset is set. Unset offsets are denoted
+// by "none", e.g.
+//
+//     relative 65536sp none none 0sp
+//
+// An unset position results in an empty string.
+func (p PositionT) String() string {
+	s := positionMap[p.kind]
+	if !p.hasOffsets() {
+		return s
+	}
+	var b strings.Builder
+	b.WriteString(s)
+	for _, o := range NormalizeOffsets(p.offsets) {
+		b.WriteByte(' ')
+		if o.Dim.IsNone() {
+			b.WriteString("none")
+		} else {
+			b.WriteString(o.Dim.String())
+		}
+	}
+	return b.String()
+}
+
+// hasOffsets is a predicate wether any of the offsets of p is set.
+func (p PositionT) hasOffsets() bool {
+	for _, o := range p.offsets {
+		if !o.Dim.IsNone() {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalText encodes a position (see String).
+// Part of interface encoding.TextMarshaler.
+func (p PositionT) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText decodes a position, as produced by MarshalText.
+// Part of interface encoding.TextUnmarshaler.
+func (p *PositionT) UnmarshalText(text []byte) error {
+	fields := strings.Fields(string(text))
+	if len(fields) == 0 {
+		*p = PositionT{}
+		return nil
+	}
+	kind, ok := positionStringMap[strings.ToLower(fields[0])]
+	if !ok {
+		return fmt.Errorf("cannot decode position %q", fields[0])
+	}
+	if kind == positionStatic && len(fields) > 1 {
+		return fmt.Errorf("static position cannot have offsets")
+	}
+	if len(fields) != 1 && len(fields) != 5 {
+		return fmt.Errorf("position needs 4 offsets, has %d", len(fields)-1)
+	}
+	var offsets []PositionOffset
+	for i, f := range fields[1:] {
+		var d DimenT
+		if err := d.UnmarshalText([]byte(f)); err != nil {
+			return err
+		}
+		offsets = append(offsets, PositionOffset{Dim: d, Dir: PosDir(i)})
+	}
+	*p = newPosition(kind, offsets)
+	return nil
+}
+
+// newPosition creates a position of a given kind, using the constructors for
+// the kinds.
+func newPosition(kind position, offsets []PositionOffset) PositionT {
+	switch kind {
+	case positionStatic:
+		return Static()
+	case positionRelative:
+		return Relative(offsets)
+	case positionAbsolute:
+		return Absolute(offsets)
+	case positionFixed:
+		return Fixed(offsets)
+	}
+	return PositionT{}
+}
+
+// positionJSON is the JSON representation of a position.
+type positionJSON struct {
+	Position string  `json:"position,omitempty"`
+	Top      *DimenT `json:"top,omitempty"`
+	Right    *DimenT `json:"right,omitempty"`
+	Bottom   *DimenT `json:"bottom,omitempty"`
+	Left     *DimenT `json:"left,omitempty"`
+}
+
+// MarshalJSON encodes a position as a JSON object, e.g.
+//
+//     { "position": "absolute", "top": "65536sp" }
+//
+// Unset offsets are omitted.
+func (p PositionT) MarshalJSON() ([]byte, error) {
+	pj := positionJSON{Position: positionMap[p.kind]}
+	if p.hasOffsets() {
+		dims := []**DimenT{&pj.Top, &pj.Right, &pj.Bottom, &pj.Left}
+		for i, o := range NormalizeOffsets(p.offsets) {
+			if !o.Dim.IsNone() {
+				d := o.Dim
+				*dims[i] = &d
+			}
+		}
+	}
+	return json.Marshal(pj)
+}
+
+// UnmarshalJSON decodes a position from a JSON object, as produced by MarshalJSON.
+func (p *PositionT) UnmarshalJSON(data []byte) error {
+	var pj positionJSON
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return err
+	}
+	if pj.Position == "" {
+		*p = PositionT{}
+		return nil
+	}
+	kind, ok := positionStringMap[strings.ToLower(pj.Position)]
+	if !ok {
+		return fmt.Errorf("cannot decode position %q", pj.Position)
+	}
+	var offsets []PositionOffset
+	for i, d := range []*DimenT{pj.Top, pj.Right, pj.Bottom, pj.Left} {
+		if d != nil {
+			offsets = append(offsets, PositionOffset{Dim: *d, Dir: PosDir(i)})
+		}
+	}
+	if kind == positionStatic && len(offsets) > 0 {
+		return fmt.Errorf("static position cannot have offsets")
+	}
+	*p = newPosition(kind, offsets)
+	return nil
+}
@@ -0,0 +1,183 @@
+package css_test
+
+import (
+	"testing"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/tyse/core/dimen"
+	"github.com/npillmayer/tyse/core/percent"
+	"golang.org/x/net/html"
+)
+
+func TestLineHeight(t *testing.T) {
+	var f float64
+	switch m := css.ParseLineHeight("1.5").Match(); m {
+	case m.Factor(&f):
+		if f != 1.5 {
+			t.Errorf("expected line-height factor 1.5, is %v", f)
+		}
+	default:
+		t.Errorf("expected line-height 1.5 to be a factor, isn't")
+	}
+	var d css.DimenT
+	var du dimen.DU
+	switch m := css.ParseLineHeight("14pt").Match(); m {
+	case m.Dimen(&d):
+		if d.Match().Just(&du) == nil || du != 14*dimen.PT {
+			t.Errorf("expected line-height to be 14pt, is %v", d)
+		}
+	default:
+		t.Errorf("expected line-height 14pt to be a dimension, isn't")
+	}
+	for _, test := range []struct {
+		p    style.Property
+		kind string
+	}{
+		{"normal", "normal"},
+		{"120%", "dimen"},
+		{"0", "factor"},
+		{"", "unset"},
+		{"-2", "unset"},
+		{"huge", "unset"},
+	} {
+		kind := css.LineHeightPattern[string](css.ParseLineHeight(test.p)).OneOf(css.LineHeightPatterns[string]{
+			Unset:  "unset",
+			Normal: "normal",
+			Factor: "factor",
+			Dimen:  "dimen",
+		})
+		if kind != test.kind {
+			t.Errorf("expected line-height %q to be of kind %s, is %s", test.p, test.kind, kind)
+		}
+	}
+}
+
+func TestVerticalAlign(t *testing.T) {
+	var k css.VAlign
+	switch m := css.ParseVerticalAlign("Text-Top").Match(); m {
+	case m.IsKeyword(css.VAlignBaseline):
+		t.Errorf("expected vertical-align text-top not to match baseline")
+	case m.Keyword(&k):
+		if k != css.VAlignTextTop {
+			t.Errorf("expected vertical-align keyword to be text-top, is %s", k)
+		}
+	default:
+		t.Errorf("expected vertical-align text-top to be a keyword, isn't")
+	}
+	var p percent.Percent
+	e := css.VerticalAlignPattern[bool](css.ParseVerticalAlign("-50%"))
+	var d css.DimenT
+	ok := e.OneOf(css.VerticalAlignPatterns[bool]{
+		Dimen:   e.WithDimen(&d).Const(true),
+		Default: false,
+	})
+	if !ok || d.Match().Percentage(&p) == nil {
+		t.Errorf("expected vertical-align -50%% to be a percentage, isn't: %#v", d)
+	}
+	if !css.ParseVerticalAlign("").IsBaseline() || !css.ParseVerticalAlign("baseline").IsBaseline() {
+		t.Errorf("expected default vertical-align to be baseline")
+	}
+	if !css.ParseVerticalAlign("somewhere").IsUnset() {
+		t.Errorf("expected illegal vertical-align to be unset")
+	}
+}
+
+func TestTextDecoration(t *testing.T) {
+	var l css.DecorationLine
+	var s css.DecorationStyle
+	var c style.Property
+	td := css.ParseTextDecoration("red wavy underline overline")
+	switch m := td.Match(); m {
+	case m.None():
+		t.Errorf("expected text-decoration not to be none")
+	case m.Decoration(&l, &s, &c):
+		if !l.Contains(css.DecorationUnderline|css.DecorationOverline) || l.Contains(css.DecorationLineThrough) {
+			t.Errorf("expected underline and overline, have %x", l)
+		}
+		if s != css.DecorationWavy || c != "red" {
+			t.Errorf("expected wavy red decoration, have %d %q", s, c)
+		}
+	default:
+		t.Errorf("expected text-decoration to be set, isn't")
+	}
+	for _, test := range []struct {
+		p    style.Property
+		kind string
+	}{
+		{"none", "none"},
+		{"line-through", "decoration"},
+		{"underline dotted", "decoration"},
+		{"", "unset"},
+		{"none underline", "unset"},
+		{"underline red blue", "unset"},
+	} {
+		kind := css.TextDecorationPattern[string](css.ParseTextDecoration(test.p)).OneOf(
+			css.TextDecorationPatterns[string]{
+				Unset:      "unset",
+				None:       "none",
+				Decoration: "decoration",
+			})
+		if kind != test.kind {
+			t.Errorf("expected text-decoration %q to be of kind %s, is %s", test.p, test.kind, kind)
+		}
+	}
+	if c := css.ParseTextDecoration("underline currentColor").Color(); c != style.NullStyle {
+		t.Errorf("expected currentcolor to result in empty color, is %q", c)
+	}
+}
+
+func TestSegmentString(t *testing.T) {
+	type seg = css.TextSegment
+	for _, test := range []struct {
+		text     string
+		ws       css.WhiteSpace
+		segments []seg
+	}{
+		{"Hello  \t world", css.WhiteSpaceNormal, []seg{{"Hello ", css.BreakAllowed}, {"world", css.NoBreak}}},
+		{"a\nb ", css.WhiteSpaceNormal, []seg{{"a ", css.BreakAllowed}, {"b ", css.BreakAllowed}}},
+		{"a  b\nc", css.WhiteSpaceNowrap, []seg{{"a b c", css.NoBreak}}},
+		{"a  b\r\n\nc", css.WhiteSpacePre, []seg{{"a  b", css.BreakMandatory}, {"", css.BreakMandatory},
+			{"c", css.NoBreak}}},
+		{"a  b\nc", css.WhiteSpacePreWrap, []seg{{"a  ", css.BreakAllowed}, {"b", css.BreakMandatory},
+			{"c", css.NoBreak}}},
+		{"a  b \n  c", css.WhiteSpacePreLine, []seg{{"a ", css.BreakAllowed}, {"b", css.BreakMandatory},
+			{"c", css.NoBreak}}},
+		{"", css.WhiteSpaceNormal, nil},
+	} {
+		segments := css.SegmentString(test.text, test.ws)
+		if len(segments) != len(test.segments) {
+			t.Errorf("white-space %s: expected %q to result in %v, have %v", test.ws, test.text,
+				test.segments, segments)
+			continue
+		}
+		for i, s := range segments {
+			if s != test.segments[i] {
+				t.Errorf("white-space %s: expected segment #%d of %q to be %v, is %v", test.ws, i,
+					test.text, test.segments[i], s)
+			}
+		}
+	}
+	if ws := css.ParseWhiteSpace("Pre-Wrap"); ws != css.WhiteSpacePreWrap {
+		t.Errorf("expected white-space pre-wrap, is %s", ws)
+	}
+}
+
+func TestSegmentText(t *testing.T) {
+	pre := &html.Node{Type: html.ElementNode, Data: "pre"}
+	text := &html.Node{Type: html.TextNode, Data: "x := 1\n  y"}
+	parent := styledtree.NewNodeForHTMLNode(pre)
+	group := style.NewPropertyGroup(style.PGText)
+	group.Set("white-space", "pre")
+	styledtree.Node(parent).SetStyles(style.NewPropertyMap().AddAllFromGroup(group, false))
+	child := styledtree.NewNodeForHTMLNode(text)
+	parent.AddChild(child)
+	segments := css.SegmentText(styledtree.Node(child))
+	if len(segments) != 2 || segments[0].Text != "x := 1" || segments[1].Text != "  y" {
+		t.Errorf("expected text of <pre> to preserve white space, have %v", segments)
+	}
+	if css.SegmentText(styledtree.Node(parent)) != nil {
+		t.Errorf("expected element node not to be segmented")
+	}
+}
@@ -0,0 +1,215 @@
+package css
+
+import (
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+)
+
+// VAlign is an enum type for the keyword values of CSS property vertical-align.
+type VAlign uint16
+
+// Enum values for type VAlign
+const (
+	VAlignBaseline   VAlign = iota // CSS baseline (default)
+	VAlignSub                      // CSS sub
+	VAlignSuper                    // CSS super
+	VAlignTextTop                  // CSS text-top
+	VAlignTextBottom               // CSS text-bottom
+	VAlignMiddle                   // CSS middle
+	VAlignTop                      // CSS top
+	VAlignBottom                   // CSS bottom
+)
+
+var valignMap map[VAlign]string = map[VAlign]string{
+	VAlignBaseline:   "baseline",
+	VAlignSub:        "sub",
+	VAlignSuper:      "super",
+	VAlignTextTop:    "text-top",
+	VAlignTextBottom: "text-bottom",
+	VAlignMiddle:     "middle",
+	VAlignTop:        "top",
+	VAlignBottom:     "bottom",
+}
+
+var valignStringMap map[string]VAlign = map[string]VAlign{
+	"baseline":    VAlignBaseline,
+	"sub":         VAlignSub,
+	"super":       VAlignSuper,
+	"text-top":    VAlignTextTop,
+	"text-bottom": VAlignTextBottom,
+	"middle":      VAlignMiddle,
+	"top":         VAlignTop,
+	"bottom":      VAlignBottom,
+}
+
+func (v VAlign) String() string {
+	if s, ok := valignMap[v]; ok {
+		return s
+	}
+	return "?"
+}
+
+// verticalAlign is an enum type for the kinds of values of CSS property vertical-align.
+type verticalAlign uint16
+
+const (
+	verticalAlignUnset   verticalAlign = iota
+	verticalAlignKeyword               // one of the VAlign keywords
+	verticalAlignDimen                 // length or percentage, relative to the baseline
+)
+
+// VerticalAlignT is an option type for CSS property vertical-align.
+type VerticalAlignT struct {
+	dimen   DimenT
+	keyword VAlign
+	kind    verticalAlign
+}
+
+/*
+type VerticalAlignT
+	= Unset
+	| Keyword VAlign
+	| Dimen DimenT
+*/
+
+// VerticalAlignKeyword creates a vertical-alignment from a keyword.
+func VerticalAlignKeyword(k VAlign) VerticalAlignT {
+	return VerticalAlignT{kind: verticalAlignKeyword, keyword: k}
+}
+
+// VerticalAlignDimen creates a vertical-alignment given as a length or a
+// percentage, which raises (positive) or lowers (negative) an element relative
+// to the baseline of its parent.
+func VerticalAlignDimen(d DimenT) VerticalAlignT {
+	return VerticalAlignT{kind: verticalAlignDimen, dimen: d}
+}
+
+// ParseVerticalAlign returns an optional vertical-alignment type from a property string.
+// It will never return an error, even with illegal input, but instead will then
+// return an unset vertical-alignment.
+func ParseVerticalAlign(p style.Property) VerticalAlignT {
+	s := strings.ToLower(strings.TrimSpace(string(p)))
+	if s == "" {
+		return VerticalAlignT{}
+	}
+	if k, ok := valignStringMap[s]; ok {
+		return VerticalAlignKeyword(k)
+	}
+	d, err := ParseDimen(s)
+	if err != nil || d.IsNone() {
+		tracer().Debugf("vertical-align option from property '%s': %v", p, err)
+		return VerticalAlignT{}
+	}
+	return VerticalAlignDimen(d)
+}
+
+// ---------------------------------------------------------------------------
+
+func (va VerticalAlignT) Match() *VAMatcher {
+	return &VAMatcher{va: va}
+}
+
+type VAMatcher struct {
+	va VerticalAlignT
+}
+
+func (m *VAMatcher) Unset() *VAMatcher {
+	if m.va.kind == verticalAlignUnset {
+		return m
+	}
+	return nil
+}
+
+// IsKeyword matches if the vertical-alignment is given as keyword k.
+func (m *VAMatcher) IsKeyword(k VAlign) *VAMatcher {
+	if m.va.kind == verticalAlignKeyword && m.va.keyword == k {
+		return m
+	}
+	return nil
+}
+
+func (m *VAMatcher) Keyword(k *VAlign) *VAMatcher {
+	if m.va.kind == verticalAlignKeyword {
+		if k != nil {
+			*k = m.va.keyword
+		}
+		return m
+	}
+	return nil
+}
+
+func (m *VAMatcher) Dimen(d *DimenT) *VAMatcher {
+	if m.va.kind == verticalAlignDimen {
+		if d != nil {
+			*d = m.va.dimen
+		}
+		return m
+	}
+	return nil
+}
+
+// --- Expression matching ---------------------------------------------------
+
+type VerticalAlignPatterns[T any] struct {
+	Unset   T
+	Keyword T
+	Dimen   T
+	Default T
+}
+
+func VerticalAlignPattern[T any](va VerticalAlignT) *VAMatchExpr[T] {
+	return &VAMatchExpr[T]{va: va}
+}
+
+// VAMatchExpr is part of pattern matching for VerticalAlignT types and intended to be
+// instantiated using `VerticalAlignPattern()` only.
+type VAMatchExpr[T any] struct {
+	va VerticalAlignT
+}
+
+func (m *VAMatchExpr[T]) OneOf(patterns VerticalAlignPatterns[T]) T {
+	switch m.va.kind {
+	case verticalAlignUnset:
+		return patterns.Unset
+	case verticalAlignKeyword:
+		return patterns.Keyword
+	case verticalAlignDimen:
+		return patterns.Dimen
+	}
+	return patterns.Default
+}
+
+// WithKeyword extracts the keyword of a vertical-alignment.
+func (m *VAMatchExpr[T]) WithKeyword(k *VAlign) *VAMatchExpr[T] {
+	if k != nil {
+		*k = m.va.keyword
+	}
+	return m
+}
+
+// WithDimen extracts the dimension of a length or percentage vertical-alignment.
+func (m *VAMatchExpr[T]) WithDimen(d *DimenT) *VAMatchExpr[T] {
+	if d != nil {
+		*d = m.va.dimen
+	}
+	return m
+}
+
+func (m *VAMatchExpr[T]) Const(x T) T {
+	return x
+}
+
+// ---------------------------------------------------------------------------
+
+// IsUnset returns true if va is unset.
+func (va VerticalAlignT) IsUnset() bool {
+	return va.kind == verticalAlignUnset
+}
+
+// IsBaseline returns true if va aligns to the baseline, either explicitly or
+// by default.
+func (va VerticalAlignT) IsBaseline() bool {
+	return va.kind == verticalAlignUnset ||
+		(va.kind == verticalAlignKeyword && va.keyword == VAlignBaseline)
+}
@@ -0,0 +1,57 @@
+package css
+
+import (
+	"github.com/npillmayer/tyse/core/dimen"
+)
+
+// Viewport is the context for resolving viewport-relative dimensions
+// (`vw`, `vh`, `vmin`, `vmax`). For paged output, W and H are the dimensions of
+// the page area.
+type Viewport struct {
+	W, H dimen.DU
+}
+
+// IsViewportRelative returns true if d is a dimension relative to the viewport,
+// i.e. one of `vw`, `vh`, `vmin` or `vmax`.
+func (d DimenT) IsViewportRelative() bool {
+	switch d.flags & relativeMask {
+	case dimenVW, dimenVH, dimenVMIN, dimenVMAX:
+		return true
+	}
+	return false
+}
+
+// Resolve resolves a viewport-relative dimension to a fixed dimension, using
+// the extent of viewport vp. Other dimensions are returned unchanged.
+//
+//     d, _ := ParseDimen("50vw")
+//     d.Resolve(Viewport{W: 600 * dimen.PT, H: 800 * dimen.PT})  // => Just(300pt)
+//
+func (d DimenT) Resolve(vp Viewport) DimenT {
+	var base dimen.DU
+	switch d.flags & relativeMask {
+	case dimenVW:
+		base = vp.W
+	case dimenVH:
+		base = vp.H
+	case dimenVMIN:
+		base = dimen.Min(vp.W, vp.H)
+	case dimenVMAX:
+		base = dimen.Max(vp.W, vp.H)
+	default:
+		return d
+	}
+	return JustDimen(d.d * base / 100)
+}
+
+// ViewRel matches viewport-relative dimensions. If unit is non-nil, it will be
+// set to the unit of the dimension.
+func (m *DMatcher) ViewRel(unit *string) *DMatcher {
+	if m.dimen.IsViewportRelative() {
+		if unit != nil {
+			*unit = m.dimen.UnitString()
+		}
+		return m
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package css
+
+import (
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"golang.org/x/net/html"
+)
+
+// WhiteSpace is an enum type for CSS property white-space.
+type WhiteSpace uint8
+
+// Values for CSS property white-space.
+const (
+	WhiteSpaceNormal  WhiteSpace = iota // collapse white space, wrap lines (default)
+	WhiteSpaceNowrap                    // collapse white space, do not wrap lines
+	WhiteSpacePre                       // preserve white space, do not wrap lines
+	WhiteSpacePreWrap                   // preserve white space, wrap lines
+	WhiteSpacePreLine                   // collapse spaces, preserve newlines, wrap lines
+)
+
+func (ws WhiteSpace) String() string {
+	switch ws {
+	case WhiteSpaceNowrap:
+		return "nowrap"
+	case WhiteSpacePre:
+		return "pre"
+	case WhiteSpacePreWrap:
+		return "pre-wrap"
+	case WhiteSpacePreLine:
+		return "pre-line"
+	}
+	return "normal"
+}
+
+// ParseWhiteSpace returns the white-space mode for a property string.
+// Unknown values result in WhiteSpaceNormal.
+func ParseWhiteSpace(p style.Property) WhiteSpace {
+	switch strings.ToLower(strings.TrimSpace(string(p))) {
+	case "nowrap":
+		return WhiteSpaceNowrap
+	case "pre":
+		return WhiteSpacePre
+	case "pre-wrap":
+		return WhiteSpacePreWrap
+	case "pre-line":
+		return WhiteSpacePreLine
+	}
+	return WhiteSpaceNormal
+}
+
+// CollapsesSpaces is true if sequences of spaces and tabs are collapsed into a
+// single space.
+func (ws WhiteSpace) CollapsesSpaces() bool {
+	return ws == WhiteSpaceNormal || ws == WhiteSpaceNowrap || ws == WhiteSpacePreLine
+}
+
+// PreservesNewlines is true if newlines in the text force line breaks.
+func (ws WhiteSpace) PreservesNewlines() bool {
+	return ws == WhiteSpacePre || ws == WhiteSpacePreWrap || ws == WhiteSpacePreLine
+}
+
+// Wraps is true if lines may be broken at white space.
+func (ws WhiteSpace) Wraps() bool {
+	return ws == WhiteSpaceNormal || ws == WhiteSpacePreWrap || ws == WhiteSpacePreLine
+}
+
+// --- Text segmentation -----------------------------------------------------
+
+// BreakKind denotes the kind of line break opportunity after a text segment.
+type BreakKind uint8
+
+// Kinds of line break opportunities.
+const (
+	NoBreak        BreakKind = iota // lines may not be broken after the segment
+	BreakAllowed                    // lines may be broken after the segment
+	BreakMandatory                  // a line break is forced after the segment
+)
+
+// TextSegment is a run of normalized text, followed by a line break opportunity.
+// The text of a segment includes trailing white space, if any, but not the
+// newline character of a mandatory break.
+type TextSegment struct {
+	Text  string
+	Break BreakKind
+}
+
+// SegmentText applies the computed value of property white-space to the
+// content of a text node, resulting in a list of normalized text segments,
+// each followed by a line break opportunity (see SegmentString).
+// If node is not a text node, nil is returned.
+//
+// Collapsing of white space across text nodes and removal of white space at
+// the start and end of lines is left to the paragraph builder.
+func SegmentText(node *styledtree.StyNode) []TextSegment {
+	if node == nil || node.HTMLNode() == nil || node.HTMLNode().Type != html.TextNode {
+		return nil
+	}
+	ws := ParseWhiteSpace(ResolveProperty(node, "white-space"))
+	return SegmentString(node.HTMLNode().Data, ws)
+}
+
+// SegmentString splits text into segments at line break opportunities, with
+// white space handled according to mode ws:
+//
+//     normal     sequences of white space collapse into a single space,
+//                lines may be broken after white space
+//     nowrap     as normal, but the text results in a single segment
+//     pre        white space is preserved, newlines force line breaks
+//     pre-wrap   as pre, and lines may be broken after white space
+//     pre-line   as normal, but newlines force line breaks
+//
+// Line endings "\r\n" and "\r" are treated as a newline. Forced line breaks
+// result in segments with a break of BreakMandatory, which may have empty text
+// for empty lines.
+func SegmentString(text string, ws WhiteSpace) []TextSegment {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	var segments []TextSegment
+	var b strings.Builder
+	emit := func(brk BreakKind) {
+		segments = append(segments, TextSegment{Text: b.String(), Break: brk})
+		b.Reset()
+	}
+	afterSpace, atLineStart := false, false
+	for _, r := range text {
+		if r == '\n' && ws.PreservesNewlines() {
+			s := b.String()
+			if ws.CollapsesSpaces() { // remove spaces before segment breaks
+				s = strings.TrimRight(s, " ")
+			}
+			b.Reset()
+			b.WriteString(s)
+			emit(BreakMandatory)
+			afterSpace, atLineStart = false, true
+			continue
+		}
+		if isWhiteSpace(r) {
+			if ws.CollapsesSpaces() {
+				if afterSpace || (atLineStart && ws == WhiteSpacePreLine) {
+					continue
+				}
+				r = ' '
+			}
+			b.WriteRune(r)
+			afterSpace = true
+			continue
+		}
+		if afterSpace && ws.Wraps() {
+			emit(BreakAllowed)
+		}
+		b.WriteRune(r)
+		afterSpace, atLineStart = false, false
+	}
+	if b.Len() > 0 {
+		if afterSpace && ws.Wraps() {
+			emit(BreakAllowed)
+		} else {
+			emit(NoBreak)
+		}
+	}
+	return segments
+}
+
+// isWhiteSpace is true for the document white space characters of CSS.
+func isWhiteSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\f'
+}
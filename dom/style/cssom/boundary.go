@@ -0,0 +1,97 @@
+package cssom
+
+import (
+	"golang.org/x/net/html"
+)
+
+// --- Style boundaries -------------------------------------------------
+
+// Attributes controlling style encapsulation.
+const (
+	// StyleBoundaryAttribute marks an element as a style boundary. Author rules
+	// from outside the boundary do not apply to the element's descendents.
+	StyleBoundaryAttribute = "data-style-boundary"
+	// PartAttribute exposes an element within a style boundary to the rules
+	// of the enclosing scope, similar to ::part for shadow DOM.
+	PartAttribute = "part"
+)
+
+// Elements marked with StyleBoundaryAttribute encapsulate the styles of their
+// sub-tree, similar to a shadow root. Book components like sidebars or
+// admonitions may thus be styled without rules of the surrounding document
+// leaking into them:
+//
+//     <aside class="sidebar" data-style-boundary>
+//        <p>not affected by author rules for p</p>
+//        <h5 part="title">affected by author rules for h5</h5>
+//     </aside>
+//
+// The scope of an element is its nearest ancestor marked as a style boundary,
+// or the document for elements outside of any boundary. Rules apply to an
+// element as follows:
+//
+//     - global (user-agent) and user style sheets apply everywhere
+//     - author and script style sheets added for the document scope (nil)
+//       apply to elements of the document scope only
+//     - style sheets added for a boundary element (see AddStylesForScope) apply
+//       to the boundary element and to the elements of its scope
+//     - elements carrying a PartAttribute additionally receive the rules of
+//       the scope enclosing their own scope
+//
+// The boundary element itself belongs to the enclosing scope, i.e. it is
+// styled by outer rules. Note that selectors are still matched against the
+// complete tree; boundaries restrict which style sheets are consulted, but not
+// which ancestors or siblings a selector may refer to.
+
+// isStyleBoundary is a predicate wether h is marked as a style boundary.
+func isStyleBoundary(h *html.Node) bool {
+	return hasAttribute(h, StyleBoundaryAttribute)
+}
+
+// isPart is a predicate wether h is exposed to the scope enclosing its own scope.
+func isPart(h *html.Node) bool {
+	return hasAttribute(h, PartAttribute)
+}
+
+func hasAttribute(h *html.Node, key string) bool {
+	if h == nil || h.Type != html.ElementNode {
+		return false
+	}
+	for _, attr := range h.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// styleScopeOf returns the nearest ancestor of h marked as a style boundary,
+// or the document root if h is not enclosed by any boundary.
+func (rt *rulesTreeType) styleScopeOf(h *html.Node) *html.Node {
+	if h == nil || h == rt.root {
+		return rt.root
+	}
+	for p := h.Parent; p != nil; p = p.Parent {
+		if isStyleBoundary(p) {
+			return p
+		}
+	}
+	return rt.root
+}
+
+// sheetsForScope returns the style sheets which apply to elements of scope.
+// For the document scope, sheets from outside any boundary are returned.
+// For a boundary, these are the sheets added for the boundary element,
+// together with global and user style sheets.
+func (rt *rulesTreeType) sheetsForScope(scope *html.Node) []stylesheetType {
+	if scope == rt.root {
+		return rt.StylesheetsForHTMLNode(rt.root)
+	}
+	var sheets []stylesheetType
+	for _, s := range rt.StylesheetsForHTMLNode(rt.root) {
+		if s.source == Global || s.source == User {
+			sheets = append(sheets, s)
+		}
+	}
+	return append(sheets, rt.StylesheetsForHTMLNode(scope)...)
+}
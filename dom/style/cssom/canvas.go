@@ -0,0 +1,98 @@
+package cssom
+
+import (
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// --- Propagation to the canvas ------------------------------------------
+
+// Some properties set for the root element or for <body> do not apply to the
+// element, but to the canvas, i.e. the surface the document is rendered on.
+// See https://www.w3.org/TR/css-backgrounds-3/#special-backgrounds and
+// https://www.w3.org/TR/css-overflow-3/#overflow-propagation.
+//
+// The canvas is represented by the styled node of the document node. After
+// propagation, the styles of the document node carry the background and the
+// overflow of the canvas, while the element the values have been propagated
+// from has its used value set to the initial value.
+
+// propagateToCanvas propagates background-color and overflow from <html> or
+// <body> to the styled node of the document. doc is the styled node for the
+// document. Fragments, i.e. styled trees without a document node, do not have
+// a canvas and are left untouched.
+func propagateToCanvas(doc *tree.Node[*styledtree.StyNode]) {
+	if doc == nil || doc.Payload.HTMLNode().Type != html.DocumentNode {
+		return
+	}
+	root := childElement(doc, atom.Html)
+	if root == nil {
+		return
+	}
+	body := childElement(root, atom.Body)
+	propagated := propagateFromRootOrBody(doc, root, body, "background-color", isTransparent)
+	propagated = propagateFromRootOrBody(doc, root, body, "overflow", isVisible) || propagated
+	if propagated { // this is part of styling, not a modification of styles
+		clearDirty(doc)
+	}
+}
+
+// propagateFromRootOrBody sets property key of the canvas to the value of the
+// root element. If the root element's value is initial (as tested by isInitial),
+// the value of <body> is propagated instead. The element the value has been
+// taken from is reset to the initial value. Returns true if a value has been
+// propagated.
+func propagateFromRootOrBody(canvas, root, body *tree.Node[*styledtree.StyNode], key string,
+	isInitial func(style.Property) bool) bool {
+	//
+	from := root
+	p, _ := root.Payload.Styles().Property(key)
+	if isInitial(p) && body != nil {
+		from = body
+		p, _ = body.Payload.Styles().Property(key)
+	}
+	if isInitial(p) {
+		return false
+	}
+	tracer().Debugf("propagating %s = %s from <%s> to canvas", key, p, from.Payload.HTMLNode().Data)
+	canvas.Payload.SetProperty(key, p, false)
+	from.Payload.SetProperty(key, initialValueFor[key], false)
+	return true
+}
+
+// initialValueFor holds the value an element is reset to after propagating a
+// property to the canvas.
+var initialValueFor = map[string]style.Property{
+	"background-color": "transparent",
+	"overflow":         "visible",
+}
+
+func isTransparent(p style.Property) bool {
+	return p == style.NullStyle || p == "transparent" || p == "default" || p.IsInitial() || p.IsUnset()
+}
+
+func isVisible(p style.Property) bool {
+	return p == style.NullStyle || p == "visible" || p.IsInitial() || p.IsUnset()
+}
+
+// childElement returns the first child of n for an HTML element a, or nil.
+func childElement(n *tree.Node[*styledtree.StyNode], a atom.Atom) *tree.Node[*styledtree.StyNode] {
+	for _, ch := range n.Children(true) {
+		h := ch.Payload.HTMLNode()
+		if h.Type == html.ElementNode && h.DataAtom == a && h.Namespace == "" {
+			return ch
+		}
+	}
+	return nil
+}
+
+// clearDirty resets the modification flags of n and its descendents.
+func clearDirty(n *tree.Node[*styledtree.StyNode]) {
+	n.Payload.ClearDirty()
+	for _, ch := range n.Children(true) {
+		clearDirty(ch)
+	}
+}
@@ -0,0 +1,26 @@
+package cssom
+
+import (
+	"golang.org/x/net/html"
+)
+
+// --- Comments ---------------------------------------------------------
+
+// SetPreserveComments sets whether comment nodes of the HTML parse tree are
+// kept in the styled tree. By default, only documents, elements and text are
+// represented by styled nodes. Clients which re-serialize a document or which
+// interpret processing hints hidden in comments may enable preserving. Comment
+// nodes do not receive styles and do not generate boxes.
+//
+// It must not be called concurrently with calls to Style(…).
+func (cssom *CSSOM) SetPreserveComments(preserve bool) {
+	cssom.preserveComments = preserve
+}
+
+// inDom is true if a styled node has to be created for HTML node h.
+func (cssom *CSSOM) inDom(h *html.Node) bool {
+	if h.Type == html.CommentNode {
+		return cssom.preserveComments
+	}
+	return isInDom(h.Type, h.DataAtom)
+}
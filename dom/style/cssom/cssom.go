@@ -6,9 +6,10 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 
-	"github.com/andybalholm/cascadia"
 	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
 	"github.com/npillmayer/fp/dom/styledtree"
 	"github.com/npillmayer/fp/tree"
 	"github.com/npillmayer/schuko/tracing"
@@ -26,37 +27,59 @@ type CSSOM struct {
 	rulesTree         *rulesTreeType               // style sheets
 	defaultProperties *style.PropertyMap           // "user agent" style properties
 	compoundSplitters []CompoundPropertiesSplitter // split up compound properties
+	stylable          *elementRegistry             // elements which receive styles
+	matching          MatchingMode                 // match selectors against styled tree or HTML
+	stages            Stages                       // stages of styling, see SetStages
+	pruneHidden       bool                         // do not style subtrees with display: none
+	dropWhitespace    bool                         // drop whitespace-only text nodes between blocks
+	preserveForeign   bool                         // do not style the content of SVG and MathML
+	preserveComments  bool                         // keep comment nodes in the styled tree
+	env               css.EnvContext               // environment variables for env(…), may be nil
 }
 
 // NewCSSOM creates an empty CSSOM.
 // Clients are allowed to supply a map of additional/custom CSS property values.
 // These may override values of the default ("user-agent") style sheet,
 // or introduce completely new styling properties.
-func NewCSSOM(additionalProperties []style.KeyValue) CSSOM {
-	cssom := CSSOM{}
+//
+// Configuring a CSSOM (adding style sheets, registering compound splitters, etc.)
+// must not happen concurrently with calls to Style(…). Calls to Style(…) may
+// run concurrently.
+func NewCSSOM(additionalProperties []style.KeyValue) *CSSOM {
+	cssom := &CSSOM{}
 	cssom.rulesTree = newRulesTree()
 	cssom.defaultProperties = style.InitializeDefaultPropertyValues(additionalProperties)
 	cssom.compoundSplitters = make([]CompoundPropertiesSplitter, 1)
 	cssom.compoundSplitters[0] = style.SplitCompoundProperty
+	cssom.stylable = newElementRegistry()
 	return cssom
 }
 
 // AddStylesForScope includes a stylesheet to a CSSOM and sets the scope for
 // the stylesheet. If a stylesheet for the scope already exists, the
-// styles are merged. css may be nil. If scope is nil then scope is the
-// root (i.e., top-level content element) of a future document.
+// styles are merged. css may be nil.
+//
+// If scope is nil or a document node, the scope is the document root of a
+// future document: the stylesheet applies to every element of the document,
+// including <html> and <body>, except for elements enclosed by a style
+// boundary. Otherwise scope has to be an element node, and the stylesheet
+// applies to this element only. In particular, scoping a stylesheet to <body>
+// does not style the descendents of <body>. If scope is marked as a style
+// boundary, the stylesheet applies to the elements enclosed by the boundary as
+// well (see StyleBoundaryAttribute).
 //
 // The stylsheet may not be nil.
 // source hints to where the stylesheet comes from.
 // Its value will affect the calculation of specifity for rules of this
-// stylesheet.
+// stylesheet. For rules of equal source and specifity, rules of stylesheets
+// added later win (see AddStylesForScopeAt).
 //
 // Inline-styles will be handled on the fly, generating "mini-stylesheets"
 // while walking the HTML parse tree. For `<style>`-elements, clients have to extract
 // the styles in advance and wrap them into stylesheets.
 //
-func (cssom CSSOM) AddStylesForScope(scope *html.Node, css StyleSheet, source PropertySource) error {
-	if scope != nil && scope.Type != html.ElementNode {
+func (cssom *CSSOM) AddStylesForScope(scope *html.Node, css StyleSheet, source PropertySource) error {
+	if scope != nil && scope.Type != html.ElementNode && scope.Type != html.DocumentNode {
 		return errors.New("Can style element nodes only")
 	}
 	if css == nil {
@@ -66,6 +89,15 @@ func (cssom CSSOM) AddStylesForScope(scope *html.Node, css StyleSheet, source Pr
 	return nil
 }
 
+// AddUserStyles includes a user style sheet to a CSSOM, i.e. a style sheet with
+// preferences of the reader. User style sheets apply to every element of a
+// document, including elements enclosed by a style boundary. Their rules
+// override the user-agent defaults, but are overridden by author rules, unless
+// they are marked as !important (see PropertySource).
+func (cssom *CSSOM) AddUserStyles(css StyleSheet) error {
+	return cssom.AddStylesForScope(nil, css, User)
+}
+
 // --- A rules tree -----------------------------------------------------
 
 // RulesTree holds the styling rules of a stylesheet.
@@ -74,9 +106,13 @@ func (cssom CSSOM) AddStylesForScope(scope *html.Node, css StyleSheet, source Pr
 // Optimize some day (see
 // https://hacks.mozilla.org/2017/08/inside-a-super-fast-css-engine-quantum-css-aka-stylo/).
 type rulesTreeType struct {
-	stylesheets *sync.Map                    // of type html.Node -> []stylesheetType
-	selectors   map[string]cascadia.Selector // cache of compiled selectors
-	source      PropertySource               // where do these rules come from?
+	stylesheets *sync.Map         // of type html.Node -> []stylesheetType
+	selectors   *sync.Map         // cache of compiled selectors, string -> cascadia.Selector or error
+	fontFaces   *sync.Map         // cache of @font-face rules, string -> css.FontFace or error
+	sheetcnt    *uint32           // number of stylesheets stored, used atomically
+	source      PropertySource    // where do these rules come from?
+	root        *html.Node        // symbolic node to key style sheets for the document root
+	diagnostics chan<- Diagnostic // report invalid selectors, may be nil
 }
 
 // ad-hoc container type for stylesheets and their origin.
@@ -84,21 +120,34 @@ type rulesTreeType struct {
 type stylesheetType struct {
 	stylesheet StyleSheet
 	source     PropertySource
+	ordinal    uint32 // sequence number of the stylesheet within the rules tree
 }
 
 func newRulesTree() *rulesTreeType {
 	rt := &rulesTreeType{}
 	rt.stylesheets = &sync.Map{}
-	rt.selectors = make(map[string]cascadia.Selector)
+	rt.selectors = &sync.Map{}
+	rt.fontFaces = &sync.Map{}
+	rt.sheetcnt = new(uint32)
+	rt.root = &html.Node{Data: "root"}
 	return rt
 }
 
+// scopeKey returns the node style sheets for scope h are stored for. Both nil
+// and document nodes denote the document root, which is represented by a
+// symbolic node private to the rules tree. Using a private node keeps the root
+// scopes of different CSSOMs apart.
+func (rt rulesTreeType) scopeKey(h *html.Node) *html.Node {
+	if h == nil || h.Type == html.DocumentNode {
+		return rt.root
+	}
+	return h
+}
+
 // StylesheetsForHTMLNode retrieves all style sheets registered for
-// an html node. If h is nil it is interpreted as the root scope.
+// an html node. If h is nil or a document node it is interpreted as the root scope.
 func (rt rulesTreeType) StylesheetsForHTMLNode(h *html.Node) []stylesheetType {
-	if h == nil {
-		h = rootElement
-	}
+	h = rt.scopeKey(h)
 	sheets, found := rt.stylesheets.Load(h)
 	if !found {
 		return nil
@@ -107,20 +156,19 @@ func (rt rulesTreeType) StylesheetsForHTMLNode(h *html.Node) []stylesheetType {
 }
 
 // StoreStylesheetForHTMLNode registers a style sheet for
-// an html node. If h is nil it is interpreted as the root scope.
+// an html node. If h is nil or a document node it is interpreted as the root scope.
 func (rt rulesTreeType) StoreStylesheetForHTMLNode(h *html.Node, sheet StyleSheet,
 	source PropertySource) {
 	//
-	if h == nil {
-		h = rootElement
-	}
+	h = rt.scopeKey(h)
+	ordinal := atomic.AddUint32(rt.sheetcnt, 1)
 	sheets := rt.StylesheetsForHTMLNode(h)
 	if sheets == nil {
 		tracer().Debugf("Adding first style sheet for HTML node %v", h)
-		rt.stylesheets.Store(h, []stylesheetType{{sheet, source}})
+		rt.stylesheets.Store(h, []stylesheetType{{sheet, source, ordinal}})
 	} else {
 		tracer().Debugf("Adding another style sheet for HTML node %v", h)
-		sheets = append(sheets, stylesheetType{sheet, source})
+		sheets = append(sheets, stylesheetType{sheet, source, ordinal})
 		rt.stylesheets.Store(h, sheets)
 	}
 }
@@ -159,7 +207,7 @@ type CompoundPropertiesSplitter func(string, style.Property) ([]style.KeyValue,
 
 // RegisterCompoundSplitter allows clients to handle additional compound
 // properties. See type CompoundPropertiesSplitter.
-func (cssom CSSOM) RegisterCompoundSplitter(splitter CompoundPropertiesSplitter) {
+func (cssom *CSSOM) RegisterCompoundSplitter(splitter CompoundPropertiesSplitter) {
 	if splitter != nil {
 		cssom.compoundSplitters = append(cssom.compoundSplitters, splitter)
 	}
@@ -170,35 +218,49 @@ func (cssom CSSOM) RegisterCompoundSplitter(splitter CompoundPropertiesSplitter)
 // PropertySource denotes where CSS properties come from and therewith determines
 // the specifity of properties. Properties may be defined at different places in HTML:
 // as a sytlesheet reference link, within a <script> element in the HTML file, or in an
-// attribute value.
+// attribute value. Moreover, readers may set preferences (e.g., larger fonts or high
+// contrast) with user style sheets.
 //
 // PropertySource affects the specifity of rules: attribute values bind the closest,
-// then come script elements within the HTML source, then external style sheets and
-// finally global (user-agent level) default properties.
+// then come script elements within the HTML source, then external style sheets,
+// then user style sheets and finally global (user-agent level) default properties.
+// For properties marked as !important, the order of origins is reversed: important
+// user-agent properties win over important user properties, which in turn win over
+// important properties of the author (in a style sheet, a <script> element or an
+// attribute). See https://www.w3.org/TR/css-cascade-4/#cascade-origin.
 type PropertySource uint8
 
 // Values for property sources, used when adding style sheets.
 const (
 	Global    PropertySource = iota + 1 // "browser" globals
+	User                                // reader preferences
 	Author                              // CSS author (stylesheet link)
 	Script                              // <script> element
 	Attribute                           // in an element's attribute(s)
 )
 
-// rootElement is a symbolic node to denote the body element of a future
-// HTML document. AddStylesFor(...) with nil as a scope will replace it
-// with this marker for scoping the complete document body.
-var rootElement = &html.Node{Data: "root"}
-
 // Internal helper for applying rules to an HTML node.
 // In a first step it holds all the rules matching for an HTML node.
 // In a second step it collects all the properties set in those rules,
 // then orderes them by specifity.
 type matchesList struct {
 	matchingRules   []Rule
+	ordinals        []ruleOrdinal    // source order of matching rules
+	sources         []PropertySource // origin of matching rules
 	propertiesTable []propertyPlusSpecifityType
 }
 
+// ruleOrdinal denotes the position of a rule in source order, across all
+// stylesheets of a CSSOM: the ordinal of the stylesheet (in order of addition)
+// is kept in the upper 32 bits, the index of the rule within the stylesheet
+// in the lower 32 bits. Rules with a higher ordinal override rules with an
+// equal specifity and a lower ordinal.
+type ruleOrdinal uint64
+
+func newRuleOrdinal(sheet uint32, rule int) ruleOrdinal {
+	return ruleOrdinal(sheet)<<32 | ruleOrdinal(uint32(rule))
+}
+
 // Rule-matchings are collected from more than one stylesheet. Matching
 // rules from these stylesheets will be merged to one list.
 func (matches *matchesList) mergeMatchesWith(m *matchesList) *matchesList {
@@ -206,9 +268,9 @@ func (matches *matchesList) mergeMatchesWith(m *matchesList) *matchesList {
 		return m
 	}
 	if m != nil {
-		for _, r := range m.matchingRules {
-			matches.matchingRules = append(matches.matchingRules, r)
-		}
+		matches.matchingRules = append(matches.matchingRules, m.matchingRules...)
+		matches.ordinals = append(matches.ordinals, m.ordinals...)
+		matches.sources = append(matches.sources, m.sources...)
 	}
 	return matches
 }
@@ -219,10 +281,18 @@ func (matches *matchesList) mergeMatchesWith(m *matchesList) *matchesList {
 // sorter
 type byHighestSpecifity []propertyPlusSpecifityType
 
-// make specifities sortable by highest sp.spec
-func (sp byHighestSpecifity) Len() int           { return len(sp) }
-func (sp byHighestSpecifity) Swap(i, j int)      { sp[i], sp[j] = sp[j], sp[i] }
-func (sp byHighestSpecifity) Less(i, j int) bool { return sp[i].spec > sp[j].spec }
+// make specifities sortable by highest sp.spec, then by latest source order
+func (sp byHighestSpecifity) Len() int      { return len(sp) }
+func (sp byHighestSpecifity) Swap(i, j int) { sp[i], sp[j] = sp[j], sp[i] }
+func (sp byHighestSpecifity) Less(i, j int) bool {
+	if sp[i].spec != sp[j].spec {
+		return sp[i].spec > sp[j].spec
+	}
+	if sp[i].ordinal != sp[j].ordinal {
+		return sp[i].ordinal > sp[j].ordinal
+	}
+	return !sp[i].derived && sp[j].derived
+}
 
 // This is a small helper to print out a table with rule-matches for a node.
 func (matches *matchesList) String() string {
@@ -241,46 +311,79 @@ func (matches *matchesList) String() string {
 //
 // Will return a slice of CSS rules matched for h.
 func (rt *rulesTreeType) FilterMatchesFor(h *html.Node) *matchesList {
+	return rt.filterMatches(h, h, nil)
+}
+
+// filterMatches is like FilterMatchesFor, but matches selectors against target
+// instead of h. target is either h itself or a node mirroring h within the
+// styled tree (see styledTreeMatcher). Scoped style sheets and presentation
+// attributes are always looked up for h. Style sheets are selected with respect
+// to style boundaries enclosing h. Matching is counted by counters, if non-nil.
+func (rt *rulesTreeType) filterMatches(h, target *html.Node, counters *styleCounters) *matchesList {
 	//list := &matchesList{}
-	matchingRules := make([]Rule, 0, 3)
-	sheets := rt.StylesheetsForHTMLNode(rootElement)
+	list := &matchesList{
+		matchingRules: make([]Rule, 0, 3),
+		ordinals:      make([]ruleOrdinal, 0, 3),
+		sources:       make([]PropertySource, 0, 3),
+	}
+	if presentation := getPresentationAttributes(h); presentation != nil {
+		// presentation attributes go first, giving them the lowest specifity
+		list.matchingRules = append(list.matchingRules, presentation)
+		list.ordinals = append(list.ordinals, 0)
+		list.sources = append(list.sources, Author)
+	}
+	scope := rt.styleScopeOf(h)
+	sheets := rt.sheetsForScope(scope)
+	if scope != rt.root && isPart(h) { // exposed to the enclosing scope
+		sheets = appendSheetsOnce(sheets, rt.sheetsForScope(rt.styleScopeOf(scope)))
+	}
+	sheets = appendSheetsOnce(sheets, rt.StylesheetsForHTMLNode(h))
 	for _, s := range sheets {
 		rules := s.stylesheet.Rules()
 		tracer().Debugf("Stylesheet has %d rules", len(rules))
-		for _, rule := range rules {
+		for rno, rule := range rules {
+			if atKeyword(rule) != "" { // at-rules do not apply to nodes
+				continue
+			}
 			tracer().Debugf("Now try to match for HTML = %v", h.Data)
-			if rt.matchRuleForHTMLNode(h, rule) {
-				matchingRules = append(matchingRules, rule)
+			if rt.matchRuleForHTMLNode(target, rule, counters) {
+				list.matchingRules = append(list.matchingRules, rule)
+				list.ordinals = append(list.ordinals, newRuleOrdinal(s.ordinal, rno))
+				list.sources = append(list.sources, s.source)
 			}
 		}
 	}
-	sheets = rt.StylesheetsForHTMLNode(h)
-	for _, s := range sheets {
-		for _, rule := range s.stylesheet.Rules() {
-			if rt.matchRuleForHTMLNode(h, rule) {
-				matchingRules = append(matchingRules, rule)
+	counters.inc(countMatched, len(list.matchingRules))
+	return list
+}
+
+// appendSheetsOnce appends style sheets to sheets, skipping the ones already present.
+func appendSheetsOnce(sheets, more []stylesheetType) []stylesheetType {
+	for _, m := range more {
+		present := false
+		for _, s := range sheets {
+			if s.ordinal == m.ordinal {
+				present = true
+				break
 			}
 		}
+		if !present {
+			sheets = append(sheets, m)
+		}
 	}
-	return &matchesList{matchingRules, nil}
+	return sheets
 }
 
-func (rt *rulesTreeType) matchRuleForHTMLNode(h *html.Node, rule Rule) bool {
+func (rt *rulesTreeType) matchRuleForHTMLNode(h *html.Node, rule Rule, counters *styleCounters) bool {
+	counters.inc(countAttempts, 1)
 	selectorString := rule.Selector()
 	if selectorString == "" { // style-attribute local for this HTML node
 		//matchingRules = append(matchingRules, rule)
 		return true
 	} // else try to match selector for this rule against HTML node
-	var sel cascadia.Selector
-	found := false
-	if sel, found = rt.selectors[selectorString]; !found {
-		var err error
-		sel, err = cascadia.Compile(selectorString)
-		if err != nil {
-			tracer().Errorf("CSS selector seems not to work: %s", selectorString)
-			return false
-		}
-		rt.selectors[selectorString] = sel
+	sel, ok := rt.compileSelector(rule, counters)
+	if !ok {
+		return false
 	}
 	if sel.Match(h) {
 		//list.matchingRules = append(list.matchingRules, rule)
@@ -295,9 +398,23 @@ func (rt *rulesTreeType) matchRuleForHTMLNode(h *html.Node, rule Rule) bool {
 // (e.g.,
 //     "margin" ⟹ "margin-top", "margin-right", ...
 // Finally all property entries are sorted by specifity of the enclosing rule.
+// For equal specifity, properties of rules later in source order win, i.e.,
+// rules from stylesheets added later, or later rules within a stylesheet.
+// Within a rule, properties derived from a compound property rank
+// fractionally lower than properties set explicitly, thus
+//     p { margin: 0; margin-top: 2em }
+// always results in margin-top = 2em, independent of declaration order.
 func (matches *matchesList) SortProperties(splitters []CompoundPropertiesSplitter) {
 	var proptable []propertyPlusSpecifityType
 	for rno, rule := range matches.matchingRules {
+		var ordinal ruleOrdinal
+		if rno < len(matches.ordinals) {
+			ordinal = matches.ordinals[rno]
+		}
+		source := Author
+		if rno < len(matches.sources) {
+			source = matches.sources[rno]
+		}
 		for _, propertyKey := range rule.Properties() {
 			value := style.Property(rule.Value(propertyKey))
 			props, err := splitCompoundProperty(splitters, propertyKey, value)
@@ -306,19 +423,25 @@ func (matches *matchesList) SortProperties(splitters []CompoundPropertiesSplitte
 				for _, kv := range props {
 					key := kv.Key
 					val := kv.Value
-					sp := propertyPlusSpecifityType{Author, rule, key, val, rule.IsImportant(propertyKey), 0}
-					sp.calcSpecifity(rno)
+					if err := style.ValidateProperty(key, val); err != nil {
+						tracer().Infof("dropping property %s: %v", key, err)
+						continue
+					}
+					sp := propertyPlusSpecifityType{source, rule, key, val, rule.IsImportant(propertyKey), 0, ordinal, true}
+					sp.calcSpecifity()
 					proptable = append(proptable, sp)
 				}
+			} else if err := style.ValidateProperty(propertyKey, value); err != nil {
+				tracer().Infof("dropping property %s: %v", propertyKey, err)
 			} else {
-				sp := propertyPlusSpecifityType{Author, rule, propertyKey, value, rule.IsImportant(propertyKey), 0}
-				sp.calcSpecifity(rno)
+				sp := propertyPlusSpecifityType{source, rule, propertyKey, value, rule.IsImportant(propertyKey), 0, ordinal, false}
+				sp.calcSpecifity()
 				proptable = append(proptable, sp)
 			}
 		}
 	}
 	if len(proptable) > 0 {
-		sort.Sort(byHighestSpecifity(proptable))
+		sort.Stable(byHighestSpecifity(proptable)) // keep declaration order within a rule
 		matches.propertiesTable = proptable
 	}
 	if tracer().GetTraceLevel() >= tracing.LevelDebug {
@@ -335,24 +458,27 @@ type propertyPlusSpecifityType struct {
 	propertyValue style.Property // raw string value
 	important     bool           // marked as !IMPORTANT ?
 	spec          uint32         // specifity value to calculate; higher is more
+	ordinal       ruleOrdinal    // source order of the rule, tie-breaker for equal specifity
+	derived       bool           // split off from a compound property
 }
 
 // CalcSpecifity calculates an approximation to the true W3C specifity.
 // https://www.smashingmagazine.com/2007/07/css-specificity-things-you-should-know/
 //
-// no is a sequence number for rules, ensuring that later rules override
-// previously defined rules / properties.
-func (sp *propertyPlusSpecifityType) calcSpecifity(no int) {
-	if sp.rule.IsImportant(sp.propertyKey) {
-		sp.spec = 99999 // max
-		return
-	}
-	sp.spec = uint32(sp.source-1) * 1000
+// The source of a property outweighs the selector, i.e. a property from a
+// style attribute wins over properties of any (non-important) author rule,
+// regardless of the number of IDs, classes or elements in the rule's selector.
+//
+// The specifity does not include the source order of rules. Later rules
+// override previously defined rules / properties of equal specifity by
+// their ordinal, see byHighestSpecifity.
+func (sp *propertyPlusSpecifityType) calcSpecifity() {
+	sp.spec = sp.source.cascadeLevel(sp.important) * sourceWeight
 	selectorstring := sp.rule.Selector()
 	// simple "parsing" = rough estimate...
 	// alternatively use code from cascadia or from
 	// https://godoc.org/github.com/ericchiang/css
-	sels := strings.Fields(selectorstring)
+	sels := strings.Fields(attributeSelectorsCollapsed(selectorstring))
 	var selcnt uint32
 	var idcnt uint32
 	var classcnt uint32
@@ -368,38 +494,74 @@ func (sp *propertyPlusSpecifityType) calcSpecifity(no int) {
 			idcnt++
 		}
 	}
-	sp.spec += selcnt*10 + classcnt*100 + idcnt*1000 + uint32(no)
+	sp.spec += selcnt*10 + classcnt*100 + idcnt*1000
+}
+
+// sourceWeight is the specifity a property gains per level of PropertySource.
+// It has to exceed the specifity of any realistic selector.
+const sourceWeight = 10000
+
+// cascadeLevel returns the rank of a property source in the cascade. Normal
+// properties rank in the order of the property sources. Important properties
+// rank above all normal properties, with the origins reversed: author level
+// sources (Author, Script, Attribute), then User, then Global.
+func (src PropertySource) cascadeLevel(important bool) uint32 {
+	if !important {
+		return uint32(src - 1)
+	}
+	const importantBase = uint32(Attribute) // above any normal property
+	switch src {
+	case Global:
+		return importantBase + 4
+	case User:
+		return importantBase + 3
+	}
+	return importantBase + uint32(src-Author) // Author, Script, Attribute
 }
 
 // --- Style Property Groups --------------------------------------------
 
-func (matches *matchesList) createStyleGroups(parent *tree.Node[*styledtree.StyNode]) *style.PropertyMap {
-	//
-	pmap := style.NewPropertyMap()
+// winners returns the declarations with the highest specifity per property,
+// in order of decreasing specifity. SortProperties must have been called before.
+func (matches *matchesList) winners() []Declaration {
+	decls := make([]Declaration, 0, len(matches.propertiesTable))
 	done := make(map[string]bool, len(matches.propertiesTable))
 	for _, pspec := range matches.propertiesTable { // for every specifity entry
 		if done[pspec.propertyKey] {
-			// already present in current properties map
 			// this must be from previous set with higher specifity
 			// => do nothing
-			break
+			continue
 		}
-		groupname := style.GroupNameFromPropertyKey(pspec.propertyKey)
+		decls = append(decls, Declaration{
+			Key:       pspec.propertyKey,
+			Value:     pspec.propertyValue,
+			Important: pspec.important,
+			Source:    pspec.source,
+		})
+		done[pspec.propertyKey] = true // remember we're done with this property
+	}
+	return decls
+}
+
+func createStyleGroups(parent *tree.Node[*styledtree.StyNode], decls []Declaration) *style.PropertyMap {
+	//
+	pmap := style.NewPropertyMap()
+	for _, decl := range decls {
+		groupname := style.GroupNameFromPropertyKey(decl.Key)
 		group := pmap.Group(groupname)
 		if group != nil {
-			group.Set(pspec.propertyKey, pspec.propertyValue)
+			group.Set(decl.Key, decl.Value)
 		} else {
 			tracer().Infof("parent is %s, searching for prop group %s", parent, groupname)
 			_, pg := findAncestorWithPropertyGroup(parent, groupname) // must succeed
 			if pg == nil {
 				panic(fmt.Sprintf("Cannot find ancestor with prop-group %s -- did you create global properties?", groupname))
 			}
-			group, isNew := pg.ForkOnProperty(pspec.propertyKey, pspec.propertyValue, true)
+			group, isNew := pg.ForkOnProperty(decl.Key, decl.Value, true)
 			if isNew { // a new property group has been created
 				pmap = pmap.AddAllFromGroup(group, true) // put it into the group map
 			}
 		}
-		done[pspec.propertyKey] = true // remember we're done with this property
 	}
 	if pmap.Size() == 0 { // no property groups created, no properties set
 		return nil
@@ -420,6 +582,9 @@ func setupStyledNodeTree(domRoot *html.Node, defaults *style.PropertyMap) *tree.
 	//
 	//rootNode := creator.StyleForHTMLNode(domRoot)
 	rootNode := styledtree.NewNodeForHTMLNode(domRoot)
+	// styled trees mirror HTML parse trees, thus removing a node must not leave
+	// an empty slot; nodes added later adopt the policy of the root
+	rootNode.SetChildSlotPolicy(tree.CompactChildren)
 	//creator.SetStyles(rootNode, defaults)
 	rootNode.Payload.SetStyles(defaults)
 	//tracer().Debugf("UA node has styles = %s", creator.ToStyler(rootNode).ComputedStyles())
@@ -468,7 +633,33 @@ func findAncestorWithPropertyGroup(sn *tree.Node[*styledtree.StyNode], group str
 // https://limpet.net/mbrubeck/2014/08/23/toy-layout-engine-4-style.html
 //
 // If either dom or creator are nil, no tree is returned (but an error).
-func (cssom CSSOM) Style(dom *html.Node) (*tree.Node[*styledtree.StyNode], error) {
+//
+// Every node of the styled tree is assigned a stable ID (see styledtree.NodeID),
+// numbered in document order, starting with the root node.
+//
+// If dom is a document node, background-color and overflow of the root element
+// (or of <body>) are propagated to the styled node of the document, which
+// represents the canvas the document is rendered on.
+//
+// Property groups with identical content and identical parent groups are shared
+// between nodes (see style.GroupInterner), thus clients must not modify property
+// groups of styled nodes in place.
+//
+// Nodes are styled by the stages of the CSSOM, see SetStages. If pruning of
+// hidden subtrees is enabled, nodes with display: none are kept as stubs
+// without children (see SetPruneHidden). Whitespace-only text nodes between
+// block-level elements may be dropped (see SetDropInterElementWhitespace).
+// Foreign-content subtrees may be kept as stubs (see SetPreserveForeignContent).
+// Comments are not part of the styled tree, unless SetPreserveComments is set.
+//
+// To collect performance counters for styling, use StyleWithStats(…).
+func (cssom *CSSOM) Style(dom *html.Node) (*tree.Node[*styledtree.StyNode], error) {
+	return cssom.style(dom, nil)
+}
+
+// style styles an HTML parse tree, see Style(…). Styling is counted by
+// counters, if non-nil.
+func (cssom *CSSOM) style(dom *html.Node, counters *styleCounters) (*tree.Node[*styledtree.StyNode], error) {
 	if dom == nil {
 		return nil, errors.New("Nothing to style: empty document")
 	}
@@ -480,17 +671,22 @@ func (cssom CSSOM) Style(dom *html.Node) (*tree.Node[*styledtree.StyNode], error
 	}
 	tracer().Debugf("--- Creating style nodes for HTML nodes ----")
 	styledRootNode := setupStyledNodeTree(dom, cssom.defaultProperties)
+	t := counters.now()
 	walker := tree.NewWalker(styledRootNode) // create a concurrent tree walker
 	createNodes := func(node *tree.Node[*styledtree.StyNode], parent *tree.Node[*styledtree.StyNode],
 		pos int) (*tree.Node[*styledtree.StyNode], error) {
 		//
-		return createStyledChildren(node, cssom.rulesTree) // provide closure with style creator
+		if cssom.isPreservedForeign(node) {
+			return nil, nil // keep foreign content verbatim
+		}
+		return cssom.createStyledChildren(node) // provide closure with style creator
 	}
 	future := walker.TopDown(createNodes).Promise() // build the style tree
 	if _, err := future(); err != nil {
 		tracer().Errorf("Error while creating styled tree: %v", err)
 		return nil, err
 	}
+	counters.lap(phaseBuild, t)
 	// TODO: Possibly do not sync after creating the nodes, but rather
 	// continue with styling as a walker.Filter(...).
 	// It then is possible for a child to overtake its parent, but this
@@ -500,21 +696,33 @@ func (cssom CSSOM) Style(dom *html.Node) (*tree.Node[*styledtree.StyNode], error
 	// a loss of space efficiency, but we may gain performance by
 	// overlapping the operations.
 	tracer().Debugf("--- Now styling newly created nodes --------")
+	var matcher *styledTreeMatcher // nil matcher matches against HTML nodes
+	if cssom.matching == MatchStyledTree {
+		matcher = newStyledTreeMatcher(styledRootNode)
+	}
+	interner := style.NewGroupInterner() // share identical property groups between siblings
+	run := cssom.newStyleRun(matcher, interner, counters)
 	walker = tree.NewWalker(styledRootNode)
 	createStyles := func(node *tree.Node[*styledtree.StyNode], parent *tree.Node[*styledtree.StyNode], pos int) (*tree.Node[*styledtree.StyNode], error) {
-		return createStylesForNode(node, cssom.rulesTree, cssom.compoundSplitters)
+		return run.styleNode(node)
 	}
 	future = walker.TopDown(createStyles).Promise() // build the style tree
 	if _, err := future(); err != nil {
 		tracer().Errorf("Error while creating style properties: %v", err)
 		return nil, err
 	}
+	counters.interned(interner.Stats())
+	propagateToCanvas(styledRootNode)
+	if cssom.dropWhitespace {
+		dropInterElementWhitespace(styledRootNode)
+	}
+	styledtree.NewNodeIndex().RegisterSubtree(styledRootNode) // assign node IDs in document order
 	return styledRootNode, nil
 }
 
 // Pre-condition: sn has been styled and points to an HTML node.
 // Now iterate through the HTML children and create styled nodes for each.
-func createStyledChildren(parent *tree.Node[*styledtree.StyNode], rulesTree *rulesTreeType) (*tree.Node[*styledtree.StyNode], error) {
+func (cssom *CSSOM) createStyledChildren(parent *tree.Node[*styledtree.StyNode]) (*tree.Node[*styledtree.StyNode], error) {
 	//
 	domnode := parent.Payload
 	//domnode := creator.ToStyler(parent)
@@ -525,14 +733,14 @@ func createStyledChildren(parent *tree.Node[*styledtree.StyNode], rulesTree *rul
 		for ch != nil {
 			if ch.DataAtom == atom.Style { // <style> element
 				tracer().Infof("<style> nodes have to be extracted in advance")
-			} else if isInDom(ch.Type, ch.DataAtom) {
+			} else if cssom.inDom(ch) {
 				//} else if isStylable(ch.DataAtom) {
 				//sn := creator.StyleForHTMLNode(ch)
 				sn := styledtree.NewNodeForHTMLNode(ch)
 				parent.AddChild(sn) // sn will be sent to next pipeline stage
-				if styleAttr := getStyleAttribute(ch); styleAttr != nil {
+				if styleAttr := getStyleAttribute(sn.Payload); styleAttr != nil {
 					// attach local style attributes
-					rulesTree.StoreStylesheetForHTMLNode(ch, styleAttr, Attribute)
+					cssom.rulesTree.StoreStylesheetForHTMLNode(ch, styleAttr, Attribute)
 				}
 			}
 			ch = ch.NextSibling
@@ -563,7 +771,7 @@ func isStylable(a atom.Atom) bool {
 		atom.Figure, atom.Footer, atom.Form, atom.Frame, atom.Hr,
 		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Html,
 		atom.I, atom.Img, atom.Input, atom.Li, atom.Main, atom.Math,
-		atom.Menu, atom.Menuitem, atom.Nav, atom.Ol, atom.Option,
+		atom.Menu, atom.Menuitem, atom.Nav, atom.Noscript, atom.Ol, atom.Option,
 		atom.P, atom.Picture, atom.Pre, atom.Poster, atom.Q, atom.S,
 		atom.Section, atom.Span, atom.Spacer, atom.Strong, atom.Summary,
 		atom.Svg, atom.Sup, atom.Table, atom.Td, atom.Tr, atom.Th,
@@ -573,30 +781,6 @@ func isStylable(a atom.Atom) bool {
 	return false
 }
 
-func createStylesForNode(node *tree.Node[*styledtree.StyNode], rulesTree *rulesTreeType,
-	splitters []CompoundPropertiesSplitter) (*tree.Node[*styledtree.StyNode], error) {
-	//
-	//styler := creator.ToStyler(node)
-	h := node.Payload.HTMLNode()
-	//h := styler.HTMLNode()
-	if h.Type == html.DocumentNode || h.Type == html.ElementNode {
-		if isStylable(h.DataAtom) {
-			matchlist := rulesTree.FilterMatchesFor(h)
-			if matchlist != nil && len(matchlist.matchingRules) != 0 {
-				matchlist.SortProperties(splitters)
-				pmap := matchlist.createStyleGroups(node.Parent())
-				tracer().Debugf("Setting styles for node %v =\n%s", node, pmap)
-				//creator.SetStyles(node, pmap)
-				node.Payload.SetStyles(pmap)
-			} else {
-				tracer().Debugf("Node %v matched no style rules", node)
-			}
-		}
-		return node, nil
-	}
-	return nil, nil
-}
-
 // --- Helpers ----------------------------------------------------------
 
 var errNoSuchCompoundProperty = errors.New("No such compound property")
@@ -675,13 +859,12 @@ func nodePath(node *html.Node) string {
 
 // --- Local pseudo rules for style-attributes --------------------------
 
-func getStyleAttribute(h *html.Node) *localPseudoStylesheetType {
-	if h != nil && h.Type == html.ElementNode {
-		for _, attr := range h.Attr {
-			if attr.Key == "style" {
-				return &localPseudoStylesheetType{newLocalPseudoRule(attr.Val)}
-			}
-		}
+// getStyleAttribute returns a pseudo stylesheet for the style attribute of a
+// styled node, or nil if the node has no inline style declarations. Parsing is
+// cached by the styled node (see StyNode.InlineStyle).
+func getStyleAttribute(sn *styledtree.StyNode) *localPseudoStylesheetType {
+	if decls := sn.InlineStyle(); len(decls) > 0 {
+		return &localPseudoStylesheetType{localPseudoRuleType(decls)}
 	}
 	return nil
 }
@@ -692,25 +875,6 @@ type localPseudoStylesheetType struct {
 
 type localPseudoRuleType []style.KeyValue
 
-func newLocalPseudoRule(styleAttr string) localPseudoRuleType {
-	styles := strings.Split(styleAttr, ";")
-	kv := make(localPseudoRuleType, 0, 3)
-	for _, st := range styles {
-		st = strings.TrimSpace(st)
-		if len(st) > 0 {
-			s := strings.Split(st, ":")
-			if len(s) < 2 {
-				tracer().Errorf("Skipping ill-formed style rule: %s", st)
-			} else {
-				k := strings.TrimSpace(s[0])
-				v := strings.TrimSpace(s[1])
-				kv = append(kv, style.KeyValue{Key: k, Value: style.Property(v)})
-			}
-		}
-	}
-	return kv
-}
-
 func (pseudorule localPseudoRuleType) Selector() string {
 	return ""
 }
@@ -735,6 +899,10 @@ func (pseudorule localPseudoRuleType) IsImportant(string) bool {
 	return false
 }
 
+func (pseudorule localPseudoRuleType) SourcePosition() SourcePosition {
+	return SourcePosition{}
+}
+
 func (pseudosheet *localPseudoStylesheetType) AppendRules(s StyleSheet) {
 	for _, r := range s.Rules() {
 		for _, k := range r.Properties() {
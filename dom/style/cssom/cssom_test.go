@@ -0,0 +1,1296 @@
+package cssom_test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aymerick/douceur/parser"
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/fp/dom/style/cssom"
+	"github.com/npillmayer/fp/dom/style/cssom/douceuradapter"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"github.com/npillmayer/schuko/schukonf/testconfig"
+	"github.com/npillmayer/schuko/tracing"
+	"github.com/npillmayer/schuko/tracing/gologadapter"
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+	"github.com/npillmayer/schuko/tracing/trace2go"
+	"golang.org/x/net/html"
+)
+
+var largecss = `
+p { margin-top: 5pt; }
+p.note { color: gray; }
+div > p { margin-bottom: 3pt; }
+#p7 { padding-left: 7pt; }
+span { color: red; }
+`
+
+// largeDocument creates an HTML document with n sections of paragraphs,
+// every one of them matching several selectors.
+func largeDocument(n int) string {
+	var b strings.Builder
+	b.WriteString("<html><body>\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "<div><p id=\"p%d\" class=\"note\">Para <span>%d</span></p><p>Text</p></div>\n", i, i)
+	}
+	b.WriteString("</body></html>\n")
+	return b.String()
+}
+
+// styleAndFind styles an HTML document with a single author style sheet and
+// returns the styled nodes of elements with a given tag.
+func styleAndFind(t *testing.T, doc, sheet, tag string) []*tree.Node[*styledtree.StyNode] {
+	t.Helper()
+	c, err := parser.Parse(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(c), cssom.Author)
+	h, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	styled, err := s.Style(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return findElements(styled, tag)
+}
+
+// findElements returns the styled nodes of elements with one of the given tags.
+func findElements(styled *tree.Node[*styledtree.StyNode], tags ...string) []*tree.Node[*styledtree.StyNode] {
+	nodes, _ := tree.NewWalker(styled).DescendentsWith(
+		func(n, _ *tree.Node[*styledtree.StyNode]) (*tree.Node[*styledtree.StyNode], error) {
+			h := n.Payload.HTMLNode()
+			if h.Type != html.ElementNode {
+				return nil, nil
+			}
+			for _, tag := range tags {
+				if h.Data == tag {
+					return n, nil
+				}
+			}
+			return nil, nil
+		}).Promise()()
+	return nodes
+}
+
+// Run with -race to check for concurrent access to internal caches. Several
+// documents are styled concurrently, using the same CSSOM. Tracers of the test
+// adapter are shared with other tests, thus the test uses tracers of its own.
+func TestStyleLargeDocument(t *testing.T) {
+	configureQuietTracing(t)
+	//
+	c, err := parser.Parse(largecss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(c), cssom.Author)
+	const docs = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, docs)
+	for i := 0; i < docs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- styleLargeDocument(s, 500)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// configureQuietTracing sets up Go log tracers, reporting errors only.
+func configureQuietTracing(t *testing.T) {
+	tracing.RegisterTraceAdapter("go", gologadapter.GetAdapter(), false)
+	conf := &testconfig.Conf{}
+	conf.Set("tracing", "go")
+	conf.Set("trace.tyse.dom", "Error")
+	conf.Set("trace.tyse.frame.tree", "Error")
+	if err := trace2go.ConfigureRoot(conf, "trace", trace2go.ReplaceTracers(true)); err != nil {
+		t.Error(err)
+	}
+	tracing.SetTraceSelector(trace2go.Selector())
+}
+
+func styleLargeDocument(s *cssom.CSSOM, n int) error {
+	h, err := html.Parse(strings.NewReader(largeDocument(n)))
+	if err != nil {
+		return err
+	}
+	styled, err := s.Style(h)
+	if err != nil {
+		return err
+	}
+	nodes, err := tree.NewWalker(styled).AllDescendents().Promise()()
+	if err != nil {
+		return err
+	}
+	var spans, styledSpans int
+	for _, node := range nodes {
+		if node.Payload.HTMLNode().Data != "span" {
+			continue
+		}
+		spans++
+		if p, _ := node.Payload.Styles().Property("color"); p == "red" {
+			styledSpans++
+		}
+	}
+	if spans != n || styledSpans != spans {
+		return fmt.Errorf("expected %d spans to be styled with color=red, have %d of %d", n, styledSpans, spans)
+	}
+	return nil
+}
+
+func TestRegisterCompoundSplitter(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	h, err := html.Parse(strings.NewReader(`<html><body><p>Hello</p></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := parser.Parse(`p { gap-all: 2pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(c), cssom.Author)
+	s.RegisterCompoundSplitter(func(key string, value style.Property) ([]style.KeyValue, error) {
+		if key != "gap-all" {
+			return nil, fmt.Errorf("not a gap property: %s", key)
+		}
+		return []style.KeyValue{{Key: "margin-top", Value: value}, {Key: "margin-bottom", Value: value}}, nil
+	})
+	styled, err := s.Style(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := findElements(styled, "p")
+	if len(nodes) != 1 {
+		t.Fatalf("expected to find 1 <p>, found %d", len(nodes))
+	}
+	if p, _ := nodes[0].Payload.Styles().Property("margin-bottom"); p != "2pt" {
+		t.Errorf("expected registered splitter to set margin-bottom=2pt, is %q", p)
+	}
+}
+
+func TestSourceOrderForEqualSpecifity(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	var rules strings.Builder
+	for i := 0; i < 12; i++ { // enough rules to exceed the weight of a selector
+		fmt.Fprintf(&rules, "p { margin-top: %dpt; }\n", i)
+	}
+	for _, test := range []struct {
+		sheets []string
+		color  style.Property
+	}{
+		{[]string{`p { color: red; }`, `p { color: green; }`}, "green"},
+		{[]string{`p { color: green; }`, `p { color: red; }`}, "red"},
+		{[]string{`p { color: red; } p { color: green; }`}, "green"},
+		{[]string{`body p { color: red; }`, rules.String() + `p { color: green; }`}, "red"},
+	} {
+		s := cssom.NewCSSOM(nil)
+		for _, sheet := range test.sheets {
+			c, err := parser.Parse(sheet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.AddStylesForScope(nil, douceuradapter.Wrap(c), cssom.Author)
+		}
+		h, err := html.Parse(strings.NewReader(`<html><body><p>Hello</p></body></html>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		styled, err := s.Style(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes := findElements(styled, "p")
+		if len(nodes) != 1 {
+			t.Fatalf("expected to find 1 <p>, found %d", len(nodes))
+		}
+		if c, _ := nodes[0].Payload.Styles().Property("color"); c != test.color {
+			t.Errorf("expected <p> to have color %s, has %q; style sheets = %v", test.color, c, test.sheets)
+		}
+	}
+}
+
+func TestCompoundPropertiesAgainstLonghands(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	for _, test := range []struct {
+		sheet  string
+		top    style.Property
+		bottom style.Property
+	}{
+		{`p { margin: 1pt; margin-top: 2em; }`, "2em", "1pt"},
+		{`p { margin-top: 2em; margin: 1pt; }`, "2em", "1pt"},
+		{`p { margin-top: 2em; } p { margin: 1pt; }`, "1pt", "1pt"},
+		{`p { margin: 1pt; } p { margin-top: 2em; }`, "2em", "1pt"},
+		{`p { margin: 1pt 2pt; margin-bottom: 3pt; }`, "1pt", "3pt"},
+	} {
+		nodes := styleAndFind(t, `<html><body><p>Hello</p></body></html>`, test.sheet, "p")
+		if len(nodes) != 1 {
+			t.Fatalf("expected to find 1 <p>, found %d", len(nodes))
+		}
+		styles := nodes[0].Payload.Styles()
+		if top, _ := styles.Property("margin-top"); top != test.top {
+			t.Errorf("expected margin-top = %s, have %q; style sheet = %s", test.top, top, test.sheet)
+		}
+		if bottom, _ := styles.Property("margin-bottom"); bottom != test.bottom {
+			t.Errorf("expected margin-bottom = %s, have %q; style sheet = %s", test.bottom, bottom, test.sheet)
+		}
+	}
+}
+
+func TestCascadeContinuesAfterOverriddenProperty(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	// color of the second rule is overridden by the first one, which must not
+	// stop the remaining properties of the second rule from being applied
+	nodes := styleAndFind(t, `<html><body><p class="x">Hello</p></body></html>`,
+		`p.x { color: red; } p { color: blue; margin-left: 2pt; padding-top: 3pt; }`, "p")
+	if len(nodes) != 1 {
+		t.Fatalf("expected to find 1 <p>, found %d", len(nodes))
+	}
+	styles := nodes[0].Payload.Styles()
+	for key, expected := range map[string]style.Property{
+		"color":       "red",
+		"margin-left": "2pt",
+		"padding-top": "3pt",
+	} {
+		if p, _ := styles.Property(key); p != expected {
+			t.Errorf("expected %s to be %q, is %q", key, expected, p)
+		}
+	}
+}
+
+func TestForkOnPropertyLinksToNearestGroup(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	// <svg fill=black stroke=none> → <g stroke=blue> → <circle fill=green>
+	svg := style.NewPropertyGroup(style.PGSvg)
+	svg.Set("fill", "black")
+	svg.Set("stroke", "none")
+	g, isNew := svg.ForkOnProperty("stroke", "blue", true)
+	if !isNew || g.Parent != svg {
+		t.Fatalf("expected group for <g> to be forked from group of <svg>")
+	}
+	circle, isNew := g.ForkOnProperty("fill", "green", true)
+	if !isNew || circle.Parent != g {
+		t.Fatalf("expected group for <circle> to link to group of <g>, not to the one containing fill")
+	}
+	if stroke, _ := circle.Cascade("stroke").Get("stroke"); stroke != "blue" {
+		t.Errorf("expected <circle> to inherit stroke=blue from <g>, is %q", stroke)
+	}
+	if same, isNew := g.ForkOnProperty("fill", "black", true); isNew || same != g {
+		t.Errorf("expected no new group for a value equal to the cascaded one")
+	}
+	if detached, _ := g.ForkOnProperty("fill", "green", false); detached.Parent != nil {
+		t.Errorf("expected non-cascading group to have no parent")
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	tracing.Select("tyse.dom").SetTraceLevel(tracing.LevelError)
+	//
+	sheet, err := parser.Parse(`p { margin-top: env(bleed, 1pt); margin-left: env(unknown); margin-right: 2pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := css.DefaultEnvContext()
+	env["bleed"] = css.EnvProperty("3pt")
+	paragraph := func(s *cssom.CSSOM) *style.PropertyMap {
+		h, _ := html.Parse(strings.NewReader(`<html><body><p>Hello</p></body></html>`))
+		styled, err := s.Style(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return findElements(styled, "p")[0].Payload.Styles()
+	}
+	s := cssom.NewCSSOM(nil)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(sheet), cssom.Author)
+	if top, _ := paragraph(s).Property("margin-top"); top != "env(bleed, 1pt)" {
+		t.Errorf("expected env(…) to be kept without an environment, margin-top is %q", top)
+	}
+	s.SetEnvironment(env)
+	e := cssom.NewEngine(nil)
+	e.SetEnvironment(env)
+	fromEngine := e.NewCSSOM()
+	fromEngine.AddStylesForScope(nil, douceuradapter.Wrap(sheet), cssom.Author)
+	for _, styles := range []*style.PropertyMap{paragraph(s), paragraph(fromEngine)} {
+		if top, _ := styles.Property("margin-top"); top != "3pt" {
+			t.Errorf("expected margin-top to be resolved to 3pt, is %q", top)
+		}
+		if left, ok := styles.Property("margin-left"); ok {
+			t.Errorf("expected unresolvable margin-left to be unset, is %q", left)
+		}
+		if right, _ := styles.Property("margin-right"); right != "2pt" {
+			t.Errorf("expected margin-right to be 2pt, is %q", right)
+		}
+	}
+}
+
+func TestMarginShorthand(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	nodes := styleAndFind(t, `<html><body><p>Hello</p></body></html>`, `p { margin: 1pt 2pt 3pt 4pt; }`, "p")
+	if len(nodes) != 1 {
+		t.Fatalf("expected to find 1 <p>, found %d", len(nodes))
+	}
+	styles := nodes[0].Payload.Styles()
+	for key, expected := range map[string]style.Property{
+		"margin-top":    "1pt",
+		"margin-right":  "2pt",
+		"margin-bottom": "3pt",
+		"margin-left":   "4pt",
+	} {
+		if p, _ := styles.Property(key); p != expected {
+			t.Errorf("expected %s to be %q, is %q", key, expected, p)
+		}
+	}
+	kv, err := style.SplitCompoundProperty("margin", "5pt")
+	if err != nil || len(kv) != 4 {
+		t.Errorf("expected margin to be split into 4 longhands, have %v (%v)", kv, err)
+	}
+}
+
+func TestStyleAttributeSpecifity(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	for _, test := range []struct {
+		sheet string
+		color style.Property
+		top   style.Property
+	}{
+		{`#x { color: red; }`, "green", "1pt"},
+		{`#b #x.note { color: red; margin-top: 2em; }`, "green", "1pt"},
+		{`#b #x, #x { color: red; } p#x { margin-top: 2em; }`, "green", "1pt"},
+		{`#x { color: red !important; }`, "red", "1pt"},
+	} {
+		nodes := styleAndFind(t,
+			`<html><body id="b"><p id="x" class="note" style="color: green; margin: 1pt">Hello</p></body></html>`,
+			test.sheet, "p")
+		if len(nodes) != 1 {
+			t.Fatalf("expected to find 1 <p>, found %d", len(nodes))
+		}
+		styles := nodes[0].Payload.Styles()
+		if color, _ := styles.Property("color"); color != test.color {
+			t.Errorf("expected color = %s, have %q; style sheet = %s", test.color, color, test.sheet)
+		}
+		if top, _ := styles.Property("margin-top"); top != test.top {
+			t.Errorf("expected margin-top = %s, have %q; style sheet = %s", test.top, top, test.sheet)
+		}
+	}
+}
+
+func TestAttributeSelectors(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	doc := `<html><body>
+<section id="s1" data-type="Chapter" epub:type="chapter bodymatter" lang="en-US" title="Hello World"></section>
+<section id="s2" data-type="chapter" type="A" class="x"></section>
+<svg id="s3" viewBox="0 0 10 10"></svg>
+</body></html>`
+	h, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elements := map[string]*html.Node{}
+	var collect func(n *html.Node)
+	collect = func(n *html.Node) {
+		for _, a := range n.Attr {
+			if a.Key == "id" {
+				elements[a.Val] = n
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(h)
+	for _, test := range []struct {
+		selector string
+		matches  string // ids of matching elements
+	}{
+		{`[data-type]`, "s1 s2"},
+		{`[data-type="chapter"]`, "s2"},
+		{`[data-type="chapter" i]`, "s1 s2"},
+		{`[data-type="CHAPTER" I]`, "s1 s2"},
+		{`[data-type="chapter" s]`, "s2"},
+		{`[ data-type = chapter i ]`, "s1 s2"},
+		{`[title~="World"]`, "s1"},
+		{`[title~="world" i]`, "s1"},
+		{`[title~="Hello World"]`, ""},
+		{`[lang|=en]`, "s1"},
+		{`[lang|="EN" i]`, "s1"},
+		{`[title^="Hell"]`, "s1"},
+		{`[title^="hell" i]`, "s1"},
+		{`[title$="World"]`, "s1"},
+		{`[title*="o W"]`, "s1"},
+		{`[title*="O w" i]`, "s1"},
+		{`[title*="O w"]`, ""},
+		{`[type="a"]`, "s2"}, // HTML defines 'type' as case-insensitive
+		{`[type="a" s]`, ""},
+		{`[epub|type]`, "s1"},
+		{`[epub|type~="chapter"]`, "s1"},
+		{`[epub|type~="Chapter" i]`, "s1"},
+		{`[epub|type~="Chapter"]`, ""},
+		{`[*|data-type="chapter"]`, "s2"},
+		{`[|data-type="chapter"]`, "s2"},
+		{`section[data-type="chapter" i].x`, "s2"},
+		{`body [data-type='chapter' i]`, "s1 s2"},
+		{`[data-type="chapter" i], svg[id]`, "s1 s2 s3"},
+	} {
+		sel, err := cssom.CompileSelector(test.selector)
+		if err != nil {
+			t.Errorf("selector %s does not compile: %v", test.selector, err)
+			continue
+		}
+		var matches []string
+		for _, id := range []string{"s1", "s2", "s3"} {
+			if sel.Match(elements[id]) {
+				matches = append(matches, id)
+			}
+		}
+		if m := strings.Join(matches, " "); m != test.matches {
+			t.Errorf("selector %s: expected to match [%s], matches [%s]", test.selector, test.matches, m)
+		}
+	}
+	for _, illegal := range []string{`[data-type`, `[="x"]`, `[a=]`, `[a="x" q]`, `[a="x]`} {
+		if _, err := cssom.CompileSelector(illegal); err == nil {
+			t.Errorf("expected selector %s not to compile", illegal)
+		}
+	}
+}
+
+func TestMatchAgainstStyledTree(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	doc := `<html><body><div><style>p { color: blue; }</style><p id="a">A</p><p id="b">B</p></div></body></html>`
+	for _, test := range []struct {
+		mode  cssom.MatchingMode
+		color style.Property // color of first <p>
+	}{
+		{cssom.MatchStyledTree, "red"}, // <style> is not part of the styled tree
+		{cssom.MatchHTMLTree, "green"},
+	} {
+		s := cssom.NewCSSOM(nil)
+		s.SetMatchingMode(test.mode)
+		c, err := parser.Parse(`p { color: green; } p:first-child { color: red; } div > p + p { color: blue; }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.AddStylesForScope(nil, douceuradapter.Wrap(c), cssom.Author)
+		h, err := html.Parse(strings.NewReader(doc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		styled, err := s.Style(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		colors := map[string]style.Property{}
+		nodes := findElements(styled, "p")
+		for _, n := range nodes {
+			id, _ := n.Payload.Attribute("id")
+			colors[id], _ = n.Payload.Styles().Property("color")
+		}
+		if colors["a"] != test.color || colors["b"] != "blue" {
+			t.Errorf("mode %d: expected paragraphs to have colors %s and blue, have %v", test.mode, test.color, colors)
+		}
+	}
+}
+
+func TestStyleBoundary(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	doc := `<html><body><p id="outer">A</p><aside id="box" data-style-boundary>
+	<p id="inner">B</p><h5 id="title" part="title">C</h5></aside></body></html>`
+	h, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var findAside func(n *html.Node) *html.Node
+	findAside = func(n *html.Node) *html.Node {
+		if n.Type == html.ElementNode && n.Data == "aside" {
+			return n
+		}
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			if a := findAside(ch); a != nil {
+				return a
+			}
+		}
+		return nil
+	}
+	outer, err := parser.Parse(`p { margin-top: 1pt; } h5 { margin-top: 2pt; } aside { margin-top: 3pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := parser.Parse(`p { margin-bottom: 5pt; } h5 { margin-bottom: 6pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(outer), cssom.Author)
+	if err := s.AddStylesForScope(findAside(h), douceuradapter.Wrap(inner), cssom.Author); err != nil {
+		t.Fatal(err)
+	}
+	styled, err := s.Style(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	margins := map[string][2]style.Property{}
+	tree.NewWalker(styled).DescendentsWith(
+		func(n, _ *tree.Node[*styledtree.StyNode]) (*tree.Node[*styledtree.StyNode], error) {
+			if id, ok := n.Payload.Attribute("id"); ok {
+				top, _ := n.Payload.Styles().Property("margin-top")
+				bottom, _ := n.Payload.Styles().Property("margin-bottom")
+				margins[id] = [2]style.Property{top, bottom}
+			}
+			return nil, nil
+		}).Promise()()
+	for id, m := range map[string][2]style.Property{
+		"outer": {"1pt", ""},    // document scope
+		"box":   {"3pt", ""},    // boundary belongs to document scope
+		"inner": {"", "5pt"},    // encapsulated
+		"title": {"2pt", "6pt"}, // exposed as part
+	} {
+		if (m[0] != "" && margins[id][0] != m[0]) || (m[0] == "" && margins[id][0] == "1pt") {
+			t.Errorf("expected #%s to have margin-top %q, has %q", id, m[0], margins[id][0])
+		}
+		if (m[1] != "" && margins[id][1] != m[1]) || (m[1] == "" && margins[id][1] == "5pt") {
+			t.Errorf("expected #%s to have margin-bottom %q, has %q", id, m[1], margins[id][1])
+		}
+	}
+}
+
+func TestEngineStyleDocuments(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	tracing.Select("tyse.dom").SetTraceLevel(tracing.LevelError)
+	tracing.Select("tyse.frame.tree").SetTraceLevel(tracing.LevelError)
+	//
+	house, err := parser.Parse(`p { margin-top: 4pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	screen, err := parser.Parse(`p { margin-top: 99pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chapter, err := parser.Parse(`p { margin-bottom: 2pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := cssom.NewEngine(nil)
+	engine.AddStyles(douceuradapter.Wrap(house), cssom.Global, "")
+	engine.AddStyles(douceuradapter.Wrap(screen), cssom.Global, "screen, tv")
+	const docs = 4
+	results := make([][2]style.Property, docs)
+	var wg sync.WaitGroup
+	for i := 0; i < docs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			h, err := html.Parse(strings.NewReader(`<html><body><p id="x" style="color: red">A</p></body></html>`))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			var sheets []cssom.StyleSheet
+			if i%2 == 1 {
+				sheets = append(sheets, douceuradapter.Wrap(chapter))
+			}
+			styled, err := engine.StyleDocument(h, sheets...)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			nodes := findElements(styled, "p")
+			if len(nodes) != 1 {
+				t.Errorf("expected to find paragraph in document %d", i)
+				return
+			}
+			top, _ := nodes[0].Payload.Styles().Property("margin-top")
+			bottom, _ := nodes[0].Payload.Styles().Property("margin-bottom")
+			results[i] = [2]style.Property{top, bottom}
+		}(i)
+	}
+	wg.Wait()
+	for i, r := range results {
+		if r[0] != "4pt" {
+			t.Errorf("expected document %d to use house styles for print, margin-top is %q", i, r[0])
+		}
+		if i%2 == 1 && r[1] != "2pt" {
+			t.Errorf("expected document %d to use chapter styles, margin-bottom is %q", i, r[1])
+		} else if i%2 == 0 && r[1] == "2pt" {
+			t.Errorf("expected chapter styles not to leak into document %d", i)
+		}
+	}
+	engine.SetMediaType("Screen")
+	s := engine.NewCSSOM()
+	h, _ := html.Parse(strings.NewReader(`<html><body><p id="x">A</p></body></html>`))
+	styled, err := s.Style(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var top style.Property
+	if nodes := findElements(styled, "p"); len(nodes) == 1 {
+		top, _ = nodes[0].Payload.Styles().Property("margin-top")
+	}
+	if top != "99pt" {
+		t.Errorf("expected screen styles to win for media type screen, margin-top is %q", top)
+	}
+	custom := func(s *cssom.CSSOM, element string) bool { // is a custom element styled?
+		h, _ := html.Parse(strings.NewReader(`<html><body><` + element + ` style="color: red">A</` + element + `></body></html>`))
+		styled, err := s.Style(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes := findElements(styled, element)
+		return len(nodes) == 1 && nodes[0].Payload.Styles() != nil
+	}
+	engine.RegisterStylableElement(cssom.NamespaceHTML, "x-note")
+	if custom(s, "x-note") {
+		t.Errorf("expected registration with the engine not to affect an earlier CSSOM")
+	}
+	s.RegisterStylableElement(cssom.NamespaceHTML, "x-box")
+	if later := engine.NewCSSOM(); !custom(later, "x-note") || custom(later, "x-box") {
+		t.Errorf("expected stylable elements of a CSSOM not to leak into the engine")
+	}
+}
+
+func TestRootScope(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	doc := `<html><body id="b"><p id="p">A</p></body></html>`
+	css, err := parser.Parse(`body { margin-top: 1pt; } p { margin-top: 2pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marginsFor := func(s *cssom.CSSOM, h *html.Node) map[string]style.Property {
+		styled, err := s.Style(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		margins := map[string]style.Property{}
+		tree.NewWalker(styled).DescendentsWith(
+			func(n, _ *tree.Node[*styledtree.StyNode]) (*tree.Node[*styledtree.StyNode], error) {
+				if id, ok := n.Payload.Attribute("id"); ok {
+					margins[id], _ = n.Payload.Styles().Property("margin-top")
+				}
+				return nil, nil
+			}).Promise()()
+		return margins
+	}
+	for _, scope := range []string{"nil", "document", "body"} {
+		h, _ := html.Parse(strings.NewReader(doc))
+		var scopeNode *html.Node
+		switch scope {
+		case "document":
+			scopeNode = h
+		case "body":
+			scopeNode = h.FirstChild.LastChild
+		}
+		s := cssom.NewCSSOM(nil)
+		if err := s.AddStylesForScope(scopeNode, douceuradapter.Wrap(css), cssom.Author); err != nil {
+			t.Fatal(err)
+		}
+		margins := marginsFor(s, h)
+		if margins["b"] != "1pt" {
+			t.Errorf("expected <body> to be styled for scope %s, margin-top is %q", scope, margins["b"])
+		}
+		if scope == "body" && margins["p"] == "2pt" {
+			t.Errorf("expected styles scoped to <body> not to apply to descendents")
+		} else if scope != "body" && margins["p"] != "2pt" {
+			t.Errorf("expected <p> to be styled for scope %s, margin-top is %q", scope, margins["p"])
+		}
+	}
+	// root scopes of different CSSOMs are independent, even if styling concurrently
+	other, err := parser.Parse(`p { margin-top: 9pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, s2 := cssom.NewCSSOM(nil), cssom.NewCSSOM(nil)
+	s1.AddStylesForScope(nil, douceuradapter.Wrap(css), cssom.Author)
+	s2.AddStylesForScope(nil, douceuradapter.Wrap(other), cssom.Author)
+	var wg sync.WaitGroup
+	results := make([]style.Property, 2)
+	for i, s := range []*cssom.CSSOM{s1, s2} {
+		wg.Add(1)
+		go func(i int, s *cssom.CSSOM) {
+			defer wg.Done()
+			h, _ := html.Parse(strings.NewReader(doc))
+			styled, err := s.Style(h)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			tree.NewWalker(styled).DescendentsWith(
+				func(n, _ *tree.Node[*styledtree.StyNode]) (*tree.Node[*styledtree.StyNode], error) {
+					if id, ok := n.Payload.Attribute("id"); ok && id == "p" {
+						results[i], _ = n.Payload.Styles().Property("margin-top")
+					}
+					return nil, nil
+				}).Promise()()
+		}(i, s)
+	}
+	wg.Wait()
+	if results[0] != "2pt" || results[1] != "9pt" {
+		t.Errorf("expected CSSOMs to apply their own root styles, have %v", results)
+	}
+}
+
+func TestRootSelector(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	css, err := parser.Parse(`:root { margin-top: 1pt; } p { margin-top: 2pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(css), cssom.Author)
+	h, _ := html.Parse(strings.NewReader(`<html id="h"><body id="b"><div id="d"><p id="p">A</p></div></body></html>`))
+	margins := func(styled *tree.Node[*styledtree.StyNode]) map[string]style.Property {
+		m := map[string]style.Property{}
+		tree.NewWalker(styled).TopDown(
+			func(n, _ *tree.Node[*styledtree.StyNode], _ int) (*tree.Node[*styledtree.StyNode], error) {
+				if id, ok := n.Payload.Attribute("id"); ok {
+					m[id], _ = n.Payload.Styles().Property("margin-top")
+				}
+				return nil, nil
+			}).Promise()()
+		return m
+	}
+	for _, mode := range []cssom.MatchingMode{cssom.MatchStyledTree, cssom.MatchHTMLTree} {
+		s.SetMatchingMode(mode)
+		styled, err := s.Style(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := margins(styled); m["h"] != "1pt" || m["b"] != "" || m["p"] != "2pt" {
+			t.Errorf("expected :root to match <html> only (mode %d), have %v", mode, m)
+		}
+	}
+	// styling a fragment, :root matches its topmost element
+	s.SetMatchingMode(cssom.MatchStyledTree)
+	div := h.FirstChild.LastChild.FirstChild
+	styled, err := s.Style(div)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := margins(styled); m["d"] != "1pt" || m["p"] != "2pt" {
+		t.Errorf("expected :root to match the top element of a fragment, have %v", m)
+	}
+}
+
+func TestCanvasPropagation(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	doc := `<html><body><p>A</p></body></html>`
+	for _, test := range []struct {
+		sheet                string
+		canvas, html, body   style.Property
+		overflow, bodyOverfl style.Property
+	}{
+		{`p { color: red; }`, "", "", "", "", ""},
+		{`body { background-color: green; }`, "green", "", "transparent", "", ""},
+		{`html { background-color: blue; } body { background-color: green; }`, "blue", "transparent", "green", "", ""},
+		{`body { overflow: hidden; }`, "", "", "", "hidden", "visible"},
+		{`html { overflow: scroll; } body { overflow: hidden; }`, "", "", "", "scroll", "hidden"},
+	} {
+		css, err := parser.Parse(test.sheet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := cssom.NewCSSOM(nil)
+		s.AddStylesForScope(nil, douceuradapter.Wrap(css), cssom.Author)
+		h, _ := html.Parse(strings.NewReader(doc))
+		styled, err := s.Style(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		htmlNode := styled.Children(true)[0]
+		bodyNode := htmlNode.Children(true)[1] // <head> is first child
+		canvas := styled.Payload
+		bg, _ := canvas.Styles().Property("background-color")
+		htmlBg, _ := htmlNode.Payload.Styles().Property("background-color")
+		bodyBg, _ := bodyNode.Payload.Styles().Property("background-color")
+		if bg != test.canvas || htmlBg != test.html || bodyBg != test.body {
+			t.Errorf("%s: expected backgrounds canvas/html/body = %q/%q/%q, have %q/%q/%q", test.sheet,
+				test.canvas, test.html, test.body, bg, htmlBg, bodyBg)
+		}
+		overflow, _ := canvas.Styles().Property("overflow")
+		bodyOverflow, _ := bodyNode.Payload.Styles().Property("overflow")
+		if overflow != test.overflow || bodyOverflow != test.bodyOverfl {
+			t.Errorf("%s: expected overflow canvas/body = %q/%q, have %q/%q", test.sheet,
+				test.overflow, test.bodyOverfl, overflow, bodyOverflow)
+		}
+		if canvas.IsDirty() || bodyNode.Payload.IsDirty() {
+			t.Errorf("%s: expected propagation not to mark nodes dirty", test.sheet)
+		}
+	}
+}
+
+func TestUserOrigin(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	tracing.Select("tyse.dom").SetTraceLevel(tracing.LevelError)
+	//
+	ua, err := parser.Parse(`p { padding-left: 1pt; margin-bottom: 1pt; padding-right: 8pt !important; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := parser.Parse(`p { padding-left: 5pt; margin-bottom: 5pt; padding-right: 20pt !important;
+		padding-top: 5pt !important; margin-top: 3pt !important; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	author, err := parser.Parse(`p { margin-bottom: 9pt; margin-top: 1pt; } #p { padding-top: 9pt !important; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(ua), cssom.Global)
+	if err := s.AddUserStyles(douceuradapter.Wrap(user)); err != nil {
+		t.Fatal(err)
+	}
+	s.AddStylesForScope(nil, douceuradapter.Wrap(author), cssom.Author)
+	h, _ := html.Parse(strings.NewReader(`<html><body><p id="p" style="margin-top: 2pt">A</p></body></html>`))
+	styled, err := s.Style(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := findElements(styled, "p")
+	if len(nodes) != 1 {
+		t.Fatalf("expected to find paragraph, found %d nodes", len(nodes))
+	}
+	for key, expected := range map[string]style.Property{
+		"padding-left":  "5pt", // user wins over user agent
+		"margin-bottom": "9pt", // author wins over user
+		"padding-top":   "5pt", // important user wins over important author
+		"margin-top":    "3pt", // important user wins over style attribute
+		"padding-right": "8pt", // important user agent wins over important user
+	} {
+		if p, _ := nodes[0].Payload.Styles().Property(key); p != expected {
+			t.Errorf("expected %s to be %q, is %q", key, expected, p)
+		}
+	}
+}
+
+type countingMatcher struct {
+	cssom.Matcher
+	count int32
+}
+
+func (m *countingMatcher) Match(run *cssom.StyleRun, node *tree.Node[*styledtree.StyNode]) []cssom.MatchedRule {
+	atomic.AddInt32(&m.count, 1)
+	return m.Matcher.Match(run, node)
+}
+
+type printCascader struct {
+	cssom.Cascader
+}
+
+func (c printCascader) Cascade(run *cssom.StyleRun, node *tree.Node[*styledtree.StyNode],
+	matches []cssom.MatchedRule) []cssom.Declaration {
+	//
+	decls := c.Cascader.Cascade(run, node, matches)
+	for i := range decls {
+		if decls[i].Key == "margin-top" {
+			decls[i].Value = "1pt"
+		}
+	}
+	return decls
+}
+
+func TestStages(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	tracing.Select("tyse.dom").SetTraceLevel(tracing.LevelError)
+	//
+	sheet, err := parser.Parse(`p { margin-top: 5pt; margin-bottom: 5pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(sheet), cssom.Author)
+	stages := s.Stages()
+	matcher := &countingMatcher{Matcher: stages.Match}
+	s.SetStages(cssom.Stages{Match: matcher, Cascade: printCascader{stages.Cascade}})
+	h, _ := html.Parse(strings.NewReader(`<html><body><p>A</p><p>B</p></body></html>`))
+	styled, err := s.Style(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if matcher.count != 4 { // html, body, p, p
+		t.Errorf("expected matcher to be called for 4 nodes, was called %d times", matcher.count)
+	}
+	nodes := findElements(styled, "p")
+	if len(nodes) != 2 {
+		t.Fatalf("expected to find 2 paragraphs, found %d nodes", len(nodes))
+	}
+	for _, n := range nodes {
+		if p, _ := n.Payload.Styles().Property("margin-top"); p != "1pt" {
+			t.Errorf("expected margin-top to be replaced by cascader, is %q", p)
+		}
+		if p, _ := n.Payload.Styles().Property("margin-bottom"); p != "5pt" {
+			t.Errorf("expected margin-bottom to be 5pt, is %q", p)
+		}
+	}
+}
+
+func TestPruneHidden(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	tracing.Select("tyse.dom").SetTraceLevel(tracing.LevelError)
+	//
+	sheet, err := parser.Parse(`.hidden { display: none; } p { margin-top: 5pt; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := `<html><body><div class="hidden"><p>A</p><p>B</p></div><p>C</p><p hidden><b>D</b></p></body></html>`
+	for _, prune := range []bool{false, true} {
+		s := cssom.NewCSSOM(nil)
+		s.AddStylesForScope(nil, douceuradapter.Wrap(sheet), cssom.Author)
+		stages := s.Stages()
+		matcher := &countingMatcher{Matcher: stages.Match}
+		s.SetStages(cssom.Stages{Match: matcher})
+		s.SetPruneHidden(prune)
+		h, _ := html.Parse(strings.NewReader(doc))
+		styled, err := s.Style(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes := findElements(styled, "div", "p")
+		// html, body, div, p, p, p, p, b – or – html, body, div, p, p
+		count, elements := 8, 5
+		if prune {
+			count, elements = 5, 3
+		}
+		if matcher.count != int32(count) {
+			t.Errorf("prune=%v: expected matcher to be called for %d nodes, was called %d times", prune, count, matcher.count)
+		}
+		if len(nodes) != elements {
+			t.Errorf("prune=%v: expected to find %d elements, found %d", prune, elements, len(nodes))
+		}
+		if prune {
+			for _, n := range nodes {
+				if h := n.Payload.HTMLNode(); h.Data == "div" && len(n.Children(true)) != 0 {
+					t.Errorf("expected hidden div to be a stub, has %d children", len(n.Children(true)))
+				}
+			}
+		}
+		visited := 0
+		err = s.StyleStream(h, func(n *tree.Node[*styledtree.StyNode], entering bool) error {
+			if h := n.Payload.HTMLNode(); entering && h.Type == html.ElementNode {
+				visited++
+			}
+			return nil
+		})
+		if count := map[bool]int{false: 9, true: 6}[prune]; err != nil || visited != count {
+			t.Errorf("prune=%v: expected stream to visit %d elements, visited %d (%v)", prune, count, visited, err)
+		}
+	}
+}
+
+func TestMalformedStyleSheet(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	diagnostics := make(chan cssom.Diagnostic, 10)
+	sheet := douceuradapter.Parse(`p { margin-top: 1pt; color red; margin-bottom: 2pt }
+{ color: blue }
+p[title { margin-left: 3pt; }
+}
+div { margin-right: 4pt;`, diagnostics)
+	s := cssom.NewCSSOM(nil)
+	s.SetDiagnostics(diagnostics)
+	s.AddStylesForScope(nil, sheet, cssom.Author)
+	h, _ := html.Parse(strings.NewReader(`<html><body><div><p>A</p><p>B</p><p>C</p></div></body></html>`))
+	styled, err := s.Style(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(diagnostics)
+	kinds := map[cssom.DiagnosticKind]int{}
+	for d := range diagnostics {
+		t.Logf("diagnostic: %s", d)
+		kinds[d.Kind]++
+	}
+	if kinds[cssom.InvalidDeclaration] != 1 || kinds[cssom.InvalidRule] != 2 || kinds[cssom.InvalidSelector] != 1 {
+		t.Errorf("expected 1 invalid declaration, 2 invalid rules and 1 invalid selector, have %v", kinds)
+	}
+	nodes := findElements(styled, "div", "p")
+	if len(nodes) != 4 {
+		t.Fatalf("expected to find 4 elements, found %d", len(nodes))
+	}
+	for _, n := range nodes {
+		expected := map[string]style.Property{"margin-top": "1pt", "margin-bottom": "2pt"}
+		if n.Payload.HTMLNode().Data == "div" {
+			expected = map[string]style.Property{"margin-right": "4pt"}
+		}
+		for key, value := range expected {
+			if p, _ := n.Payload.Styles().Property(key); p != value {
+				t.Errorf("expected %s of <%s> to be %s, is %q", key, n.Payload.HTMLNode().Data, value, p)
+			}
+		}
+	}
+}
+
+func TestStyleSheetOrder(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	//
+	type sheet struct {
+		css    string
+		source cssom.PropertySource
+		index  int // -1 to append
+	}
+	for _, test := range []struct {
+		sheets []sheet
+		color  style.Property
+	}{
+		{[]sheet{{`p { color: red; }`, cssom.Author, -1}, {`p { color: green; }`, cssom.Author, 0}}, "red"},
+		{[]sheet{{`p { color: red; }`, cssom.Author, -1}, {`p { color: green; }`, cssom.Author, 7}}, "green"},
+		{[]sheet{{`p { color: red; }`, cssom.Author, -1}, {`p { color: blue; }`, cssom.Author, -1},
+			{`p { color: green; }`, cssom.Author, 1}}, "blue"},
+		{[]sheet{{`p { color: green; }`, cssom.Script, -1}, {`p { color: red; }`, cssom.Author, -1}}, "green"},
+		{[]sheet{{`body p { color: green; }`, cssom.Author, -1}, {`p { color: red; }`, cssom.Author, -1}}, "green"},
+	} {
+		s := cssom.NewCSSOM(nil)
+		for _, sh := range test.sheets {
+			c, err := parser.Parse(sh.css)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = s.AddStylesForScopeAt(nil, douceuradapter.Wrap(c), sh.source, sh.index); err != nil {
+				t.Fatal(err)
+			}
+		}
+		h, _ := html.Parse(strings.NewReader(`<html><body><p>Hello</p></body></html>`))
+		styled, err := s.Style(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes := findElements(styled, "p")
+		if len(nodes) != 1 {
+			t.Fatalf("expected to find 1 <p>, found %d", len(nodes))
+		}
+		if c, _ := nodes[0].Payload.Styles().Property("color"); c != test.color {
+			t.Errorf("expected <p> to have color %s, has %q; style sheets = %v", test.color, c, test.sheets)
+		}
+	}
+	//
+	s := cssom.NewCSSOM(nil)
+	h, _ := html.Parse(strings.NewReader(`<html><body><p>Hello</p></body></html>`))
+	body := h.LastChild.LastChild
+	sheets := make([]cssom.StyleSheet, 3)
+	for i := range sheets {
+		c, _ := parser.Parse(fmt.Sprintf("p { margin-top: %dpt; }", i))
+		sheets[i] = douceuradapter.Wrap(c)
+	}
+	s.AddStylesForScope(nil, sheets[0], cssom.Author)
+	s.AddStylesForScope(body, sheets[1], cssom.Script)
+	s.AddStylesForScopeAt(nil, sheets[2], cssom.Author, 1)
+	list := s.ListStyleSheets()
+	if len(list) != 3 || list[0].StyleSheet != sheets[0] || list[1].StyleSheet != sheets[2] ||
+		list[2].StyleSheet != sheets[1] {
+		t.Fatalf("expected style sheets in order 0, 2, 1, have %v", list)
+	}
+	if list[0].Scope != nil || list[2].Scope != body || list[2].Source != cssom.Script {
+		t.Errorf("expected scopes and sources to be listed, have %v", list)
+	}
+	if err := s.AddStylesForScopeAt(nil, nil, cssom.Author, 0); err == nil {
+		t.Errorf("expected nil style sheet to be refused")
+	}
+}
+
+func TestStyleWithStats(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	tracing.Select("tyse.dom").SetTraceLevel(tracing.LevelError)
+	//
+	sheet, err := parser.Parse(`p { margin-top: 5pt; } .note { color: red; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(sheet), cssom.Author)
+	h, _ := html.Parse(strings.NewReader(`<html><body><p>A</p><p>B</p><p>C</p></body></html>`))
+	styled, stats, err := s.StyleWithStats(h)
+	if err != nil || styled == nil {
+		t.Fatalf("expected styled tree, got error %v", err)
+	}
+	t.Logf("stats = %s", stats)
+	if stats.Nodes == 0 || stats.MatchAttempts != 2*stats.Nodes {
+		t.Errorf("expected 2 match attempts per node, have %d for %d nodes", stats.MatchAttempts, stats.Nodes)
+	}
+	if stats.SelectorsCompiled != 2 || stats.SelectorsCompiled+stats.SelectorCacheHits != stats.MatchAttempts {
+		t.Errorf("expected 2 selectors to be compiled and cached afterwards, have %d compiled, %d hits",
+			stats.SelectorsCompiled, stats.SelectorCacheHits)
+	}
+	if stats.RulesMatched != 3 || stats.PropertiesCascaded != 3 {
+		t.Errorf("expected 3 matches and properties for 3 paragraphs, have %d matches, %d properties",
+			stats.RulesMatched, stats.PropertiesCascaded)
+	}
+	if stats.GroupsCreated < 3 || stats.GroupsShared < 2 {
+		t.Errorf("expected margins of paragraphs to be shared, have %d groups created, %d shared",
+			stats.GroupsCreated, stats.GroupsShared)
+	}
+	if stats.Elapsed <= 0 || stats.Match <= 0 {
+		t.Errorf("expected durations to be measured, have elapsed = %v, match = %v", stats.Elapsed, stats.Match)
+	}
+}
+
+func TestFontFaces(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	tracing.Select("tyse.dom").SetTraceLevel(tracing.LevelError)
+	//
+	sheet, err := parser.Parse(`
+	@font-face { font-family: "Fira Sans"; src: url(fira.woff2) format("woff2"); font-weight: 300 700; }
+	@font-face { font-family: Broken; }
+	p { color: blue; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	diagnostics := make(chan cssom.Diagnostic, 10)
+	s.SetDiagnostics(diagnostics)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(sheet), cssom.Author)
+	h, _ := html.Parse(strings.NewReader(`<html><body><p>Hello</p></body></html>`))
+	styled, err := s.Style(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := findElements(styled, "p")
+	if len(nodes) != 1 {
+		t.Fatalf("expected to find 1 <p>, found %d", len(nodes))
+	}
+	if c, _ := nodes[0].Payload.Styles().Property("color"); c != "blue" {
+		t.Errorf("expected @font-face not to interfere with styling, color is %q", c)
+	}
+	faces := s.FontFaces()
+	if len(faces) != 1 || faces[0].Family != "Fira Sans" || !faces[0].Weight.Contains(500) {
+		t.Fatalf("expected font face for Fira Sans 300–700, have %v", faces)
+	}
+	if len(diagnostics) != 1 {
+		t.Errorf("expected @font-face without src to be reported, have %d diagnostics", len(diagnostics))
+	}
+	if faces = s.FontFaces(); len(faces) != 1 {
+		t.Errorf("expected font faces to be found again, have %v", faces)
+	}
+	if len(diagnostics) != 1 {
+		t.Errorf("expected @font-face without src to be reported once, have %d diagnostics", len(diagnostics))
+	}
+}
+
+type positionMatcher struct {
+	cssom.Matcher
+	mx        sync.Mutex
+	positions map[string][]string // positions of rules matched, per element
+}
+
+func (m *positionMatcher) Match(run *cssom.StyleRun, node *tree.Node[*styledtree.StyNode]) []cssom.MatchedRule {
+	matches := m.Matcher.Match(run, node)
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	for _, match := range matches {
+		e := node.Payload.HTMLNode().Data
+		m.positions[e] = append(m.positions[e], match.Rule.SourcePosition().String())
+	}
+	return matches
+}
+
+func TestRuleSourcePositions(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	tracing.Select("tyse.dom").SetTraceLevel(tracing.LevelError)
+	//
+	sheet := douceuradapter.ParseWithURL("body { margin: 0 }\np { color: red }\n\np:bogus(1) { color: blue }",
+		"book.css", nil)
+	s := cssom.NewCSSOM(nil)
+	diagnostics := make(chan cssom.Diagnostic, 10)
+	s.SetDiagnostics(diagnostics)
+	s.AddStylesForScope(nil, sheet, cssom.Author)
+	matcher := &positionMatcher{Matcher: s.Stages().Match, positions: make(map[string][]string)}
+	s.SetStages(cssom.Stages{Match: matcher})
+	h, _ := html.Parse(strings.NewReader(`<html><body><p style="margin: 1pt">A</p></body></html>`))
+	if _, err := s.Style(h); err != nil {
+		t.Fatal(err)
+	}
+	if pos := matcher.positions["p"]; len(pos) != 2 || pos[0] != "book.css:2:1" || pos[1] != "-" {
+		t.Errorf("expected <p> to match rule at line 2 and its style attribute, have %v", pos)
+	}
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected invalid selector to be reported, have %d diagnostics", len(diagnostics))
+	}
+	if d := <-diagnostics; d.Kind != cssom.InvalidSelector || d.Pos.String() != "book.css:4:1" {
+		t.Errorf("expected invalid selector to be reported for line 4, have %s", d)
+	}
+}
+
+func TestPruneContentVisibility(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.dom")
+	defer teardown()
+	tracing.Select("tyse.dom").SetTraceLevel(tracing.LevelError)
+	//
+	sheet, err := parser.Parse(`section { content-visibility: hidden; contain: paint; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cssom.NewCSSOM(nil)
+	s.AddStylesForScope(nil, douceuradapter.Wrap(sheet), cssom.Author)
+	s.SetPruneHidden(true)
+	h, _ := html.Parse(strings.NewReader(`<html><body><section><p>A</p><p>B</p></section><p>C</p></body></html>`))
+	styled, err := s.Style(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := findElements(styled, "section", "p")
+	if len(nodes) != 2 {
+		t.Fatalf("expected to find section and 1 paragraph, found %d elements", len(nodes))
+	}
+	for _, n := range nodes {
+		if n.Payload.HTMLNode().Data != "section" {
+			continue
+		}
+		if len(n.Children(true)) != 0 {
+			t.Errorf("expected section to be a stub, has %d children", len(n.Children(true)))
+		}
+		c := css.Containment(n.Payload)
+		if !c.SkipsContents() || c.Contain != css.ContainPaint || c.Effective() != css.ContainStrict {
+			t.Errorf("expected section to contain paint and skip its contents, have %v/%v", c.Contain, c.ContentVisibility)
+		}
+	}
+}
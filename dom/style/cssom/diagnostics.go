@@ -0,0 +1,108 @@
+package cssom
+
+import (
+	"fmt"
+
+	"github.com/andybalholm/cascadia"
+)
+
+// --- Diagnostics ------------------------------------------------------
+
+// DiagnosticKind classifies constructs of a style sheet which have been
+// skipped as invalid.
+type DiagnosticKind uint8
+
+// Kinds of diagnostics.
+const (
+	InvalidRule        DiagnosticKind = iota // rule skipped, e.g. rule without selector
+	InvalidDeclaration                       // declaration skipped, e.g. missing ':'
+	InvalidSelector                          // rule skipped, as its selector does not compile
+)
+
+func (k DiagnosticKind) String() string {
+	switch k {
+	case InvalidRule:
+		return "invalid rule"
+	case InvalidDeclaration:
+		return "invalid declaration"
+	case InvalidSelector:
+		return "invalid selector"
+	}
+	return "unknown diagnostic"
+}
+
+// Diagnostic reports a construct of a style sheet which has been skipped.
+// CSS demands that user agents recover from malformed style sheets by
+// ignoring invalid declarations and rules and carrying on with the rest of
+// the style sheet. Skipping constructs silently makes errors in style sheets
+// hard to track down, thus they are reported as diagnostics.
+type Diagnostic struct {
+	Kind DiagnosticKind // kind of construct skipped
+	Text string         // the construct skipped, e.g. a selector
+	Err  error          // reason for skipping, may be nil
+	Pos  SourcePosition // position of the construct or of its rule, if known
+}
+
+func (d Diagnostic) String() string {
+	s := fmt.Sprintf("%s: %q", d.Kind, d.Text)
+	if d.Pos.Known() {
+		s = d.Pos.String() + ": " + s
+	}
+	if d.Err == nil {
+		return s
+	}
+	return fmt.Sprintf("%s: %v", s, d.Err)
+}
+
+// Report sends a diagnostic to a diagnostics channel. The channel may be nil,
+// in which case the diagnostic is traced only. Report does not block: if the
+// channel is not ready to receive, the diagnostic is dropped. Clients should
+// therefore use buffered channels for diagnostics.
+//
+// Report is intended to be used by implementations of StyleSheet (see package
+// douceuradapter) as well.
+func Report(diagnostics chan<- Diagnostic, d Diagnostic) {
+	tracer().Infof("CSS %s", d)
+	if diagnostics == nil {
+		return
+	}
+	select {
+	case diagnostics <- d:
+	default:
+		tracer().Errorf("Diagnostics channel blocked, dropping diagnostic")
+	}
+}
+
+// SetDiagnostics sets a channel to report skipped constructs of style sheets to,
+// e.g. rules with invalid selectors. Every invalid selector is reported once,
+// not once per node. A nil channel switches off reporting, which is the default.
+// See type Diagnostic.
+//
+// It must not be called concurrently with calls to Style(…).
+func (cssom *CSSOM) SetDiagnostics(diagnostics chan<- Diagnostic) {
+	cssom.rulesTree.diagnostics = diagnostics
+}
+
+// compileSelector returns the compiled selector for the selector of a rule,
+// using the cache of compiled selectors. Selectors which fail to compile are
+// cached as well, thus they are reported once (with the position of the first
+// rule found carrying it) and rules carrying them are skipped without further
+// ado. Returns false for invalid selectors.
+func (rt *rulesTreeType) compileSelector(rule Rule, counters *styleCounters) (cascadia.Selector, bool) {
+	selector := rule.Selector()
+	cached, found := rt.selectors.Load(selector)
+	if found {
+		counters.inc(countCacheHits, 1)
+	} else { // walker goroutines may compile the same selector concurrently
+		counters.inc(countCompiled, 1)
+		sel, err := CompileSelector(selector)
+		if err == nil {
+			cached, _ = rt.selectors.LoadOrStore(selector, sel)
+		} else if cached, found = rt.selectors.LoadOrStore(selector, err); !found {
+			Report(rt.diagnostics, Diagnostic{Kind: InvalidSelector, Text: selector, Err: err,
+				Pos: rule.SourcePosition()})
+		}
+	}
+	sel, ok := cached.(cascadia.Selector)
+	return sel, ok
+}
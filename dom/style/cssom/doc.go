@@ -43,6 +43,33 @@ CSS handling is de-coupled by introducing appropriate interfaces
 StyleSheet and Rule. Concrete implementations may be found in sub-packages
 of package style.
 
+Styles are created for a fixed set of HTML elements. Inline SVG is stylable
+as well, with SVG presentation attributes (e.g., fill="red") taking part in the
+cascade with the lowest author-level specifity. Clients may register
+additional elements or complete namespaces as stylable with
+RegisterStylableElement and RegisterStylableNamespace.
+
+Elements marked with a data-style-boundary attribute encapsulate their sub-tree:
+author rules of the document do not apply within the boundary, except for
+elements exposed with a part attribute. Style sheets for the component are
+added with the boundary element as their scope.
+
+Selectors are matched against the styled tree rather than against the HTML
+parse tree (see SetMatchingMode). Structural pseudo-classes like :first-child
+therefore respect the nodes actually present in the styled tree. :root
+matches the document element, or the topmost element if a fragment is styled.
+
+Backgrounds and overflow set for <html> or <body> are propagated to the canvas,
+which is represented by the styled node of the document.
+
+Documents sharing configuration and style sheets, e.g. the chapters of a book,
+should be styled using an Engine. An engine holds caches and settings shared
+between documents and may style documents concurrently.
+
+Malformed style sheets are handled as demanded by CSS: invalid declarations
+and rules are skipped, as are rules with selectors which do not compile.
+Skipped constructs are reported on a diagnostics channel (see SetDiagnostics).
+
 Further to consider:
 
    https://godoc.org/github.com/ericchiang/css
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/npillmayer/fp/dom/style/cssom"
 	"golang.org/x/net/html"
 )
 
@@ -29,3 +30,55 @@ func TestExtract1(t *testing.T) {
 		t.Error("Should extract 1 stylesheet")
 	}
 }
+
+func TestParseMalformed(t *testing.T) {
+	for _, test := range []struct {
+		css   string
+		rules int // number of rules kept
+		decls int // number of declarations kept
+		diags int // number of constructs skipped
+	}{
+		{`p { color: red; } div { margin: 0 }`, 2, 2, 0},
+		{`p { color red; margin: 0 }`, 1, 1, 1},
+		{`p { color: ; margin: 0 }`, 1, 1, 1},
+		{`{ color: red } p { margin: 0 }`, 1, 1, 1},
+		{`p { margin: 0 } } div { margin: 0 }`, 2, 2, 1},
+		{`p { background: url("a;b.png"); color red`, 1, 1, 1},
+		{`p { content: "}" ; margin: 0 } b { x }`, 2, 2, 1},
+	} {
+		diagnostics := make(chan cssom.Diagnostic, 10)
+		sheet := Parse(test.css, diagnostics)
+		close(diagnostics)
+		decls := 0
+		for _, r := range sheet.Rules() {
+			decls += len(r.Properties())
+		}
+		if len(sheet.Rules()) != test.rules || decls != test.decls || len(diagnostics) != test.diags {
+			t.Errorf("%q: expected %d rules, %d declarations and %d diagnostics, have %d, %d and %d",
+				test.css, test.rules, test.decls, test.diags, len(sheet.Rules()), decls, len(diagnostics))
+		}
+	}
+}
+
+func TestSourcePositions(t *testing.T) {
+	diagnostics := make(chan cssom.Diagnostic, 10)
+	sheet := ParseWithURL("p { color: red }\n  /* note */ div,\n  span { margin: 0 }\n\n{ color: blue }\n"+
+		"@media print { b { x: y } }", "book.css", diagnostics)
+	close(diagnostics)
+	rules := sheet.Rules()
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 rules, have %d", len(rules))
+	}
+	for i, pos := range []string{"book.css:1:1", "book.css:2:14", "book.css:6:1"} {
+		if p := rules[i].SourcePosition().String(); p != pos {
+			t.Errorf("expected rule %q at %s, is at %s", rules[i].Selector(), pos, p)
+		}
+	}
+	d := <-diagnostics
+	if d.Pos.Line != 5 || d.Pos.Column != 1 || !strings.HasPrefix(d.String(), "book.css:5:1: ") {
+		t.Errorf("expected diagnostic for missing selector at line 5, have %s", d)
+	}
+	if pos := Wrap(&sheet.css).Rules()[0].SourcePosition(); pos.Known() {
+		t.Errorf("expected positions of wrapped douceur style sheet to be unknown, is %s", pos)
+	}
+}
@@ -12,7 +12,6 @@ package douceuradapter
 
 import (
 	"github.com/aymerick/douceur/css"
-	"github.com/aymerick/douceur/parser"
 	"github.com/npillmayer/fp/dom/style"
 	"github.com/npillmayer/fp/dom/style/cssom"
 	"golang.org/x/net/html"
@@ -23,13 +22,16 @@ import (
 // For an explanation of the motivation behind this design, please refer
 // to documentation for interface cssom.StyleSheet.
 type CSSStyles struct {
-	css css.Stylesheet
+	css       css.Stylesheet
+	positions map[*css.Rule]cssom.SourcePosition // source positions of rules, if known
 }
 
 // Wrap a douceur.css.Stylesheet into CssStyles.
 // The stylesheet is now managed by the wrapper.
+// As douceur does not record source positions, the positions of the rules
+// of the style sheet are unknown. Use Parse to have positions recorded.
 func Wrap(css *css.Stylesheet) *CSSStyles {
-	sheet := &CSSStyles{*css}
+	sheet := &CSSStyles{css: *css}
 	return sheet
 }
 
@@ -48,6 +50,12 @@ func (sheet *CSSStyles) AppendRules(other cssom.StyleSheet) {
 	for _, r := range othercss.css.Rules { // append every rule from other
 		sheet.css.Rules = append(sheet.css.Rules, r)
 	}
+	for r, pos := range othercss.positions {
+		if sheet.positions == nil {
+			sheet.positions = make(map[*css.Rule]cssom.SourcePosition)
+		}
+		sheet.positions[r] = pos
+	}
 }
 
 // Rules returns all the rules of a stylesheet.
@@ -57,7 +65,11 @@ func (sheet *CSSStyles) Rules() []cssom.Rule {
 	rules := make([]cssom.Rule, len(sheet.css.Rules))
 	for i := range sheet.css.Rules {
 		r := sheet.css.Rules[i]
-		rules[i] = Rule(*r)
+		if pos, ok := sheet.positions[r]; ok {
+			rules[i] = positionedRule{Rule(*r), pos}
+		} else {
+			rules[i] = Rule(*r)
+		}
 	}
 	return rules
 }
@@ -105,32 +117,67 @@ func (r Rule) IsImportant(key string) bool {
 	return false
 }
 
+// AtKeyword returns the at-keyword of an at-rule, e.g. "@font-face", and an
+// empty string for qualified rules.
+func (r Rule) AtKeyword() string {
+	if r.Kind == css.AtRule {
+		return r.Name
+	}
+	return ""
+}
+
+// SourcePosition returns an unknown position, as douceur does not record
+// source positions. Rules of style sheets created by Parse know their position.
+func (r Rule) SourcePosition() cssom.SourcePosition {
+	return cssom.SourcePosition{}
+}
+
 var _ cssom.Rule = &Rule{}
+var _ cssom.AtRule = &Rule{}
+
+// positionedRule is a rule together with its position in the source text
+// of its style sheet.
+type positionedRule struct {
+	Rule
+	pos cssom.SourcePosition
+}
+
+// SourcePosition returns the position of the rule in the source text of its
+// style sheet.
+func (r positionedRule) SourcePosition() cssom.SourcePosition {
+	return r.pos
+}
 
 // ExtractStyleElements visits <head> and <body> elements in an HTML parse
 // tree and searches for embedded <style>s. It returns the content of
-// style-elements as style sheets.
+// style-elements as style sheets. Malformed CSS is handled as described
+// for Parse.
 func ExtractStyleElements(htmldoc *html.Node) []*CSSStyles {
+	return ExtractStyleElementsWithDiagnostics(htmldoc, nil)
+}
+
+// ExtractStyleElementsWithDiagnostics is like ExtractStyleElements, but reports
+// constructs of the style sheets skipped as invalid to diagnostics.
+func ExtractStyleElementsWithDiagnostics(htmldoc *html.Node, diagnostics chan<- cssom.Diagnostic) []*CSSStyles {
 	head := findElement(atom.Head, htmldoc)
 	body := findElement(atom.Body, htmldoc)
-	css := extractStyles(head)
-	css2 := extractStyles(body)
+	css := extractStyles(head, diagnostics)
+	css2 := extractStyles(body, diagnostics)
 	for _, c := range css2 {
 		css = append(css, c)
 	}
 	return css
 }
 
-func extractStyles(h *html.Node) []*CSSStyles {
+func extractStyles(h *html.Node, diagnostics chan<- cssom.Diagnostic) []*CSSStyles {
 	var css []*CSSStyles
+	if h == nil {
+		return css
+	}
 	ch := h.FirstChild
 	for ch != nil {
-		if ch.DataAtom == atom.Style {
-			c, err := parser.Parse(ch.FirstChild.Data)
-			if err != nil {
-				break
-			}
-			css = append(css, Wrap(c))
+		if ch.DataAtom == atom.Style && ch.FirstChild != nil {
+			css = append(css, Parse(ch.FirstChild.Data, diagnostics))
 		}
 		ch = ch.NextSibling
 	}
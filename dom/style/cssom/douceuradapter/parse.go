@@ -0,0 +1,225 @@
+package douceuradapter
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aymerick/douceur/css"
+	"github.com/aymerick/douceur/parser"
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/cssom"
+)
+
+// Parse parses a style sheet, recovering from malformed CSS as demanded by
+// the CSS syntax specification: invalid declarations and invalid rules are
+// skipped, and parsing carries on with the next declaration or rule.
+// Blocks left open at the end of the style sheet are closed. Malformed
+// at-rules, e.g. @media blocks containing invalid rules, are skipped as a
+// whole. Every construct skipped is reported to diagnostics, which may be nil
+// (see cssom.Report).
+//
+// Parse never fails, but the style sheet returned may be empty.
+//
+// Rules of the style sheet know their position within text (see
+// cssom.SourcePosition), and so do the diagnostics reported. Diagnostics for
+// declarations carry the position of their rule.
+func Parse(text string, diagnostics chan<- cssom.Diagnostic) *CSSStyles {
+	return ParseWithURL(text, "", diagnostics)
+}
+
+// ParseWithURL is like Parse, with url being the location the style sheet has
+// been loaded from. url is part of the source positions of rules and diagnostics.
+func ParseWithURL(text string, url string, diagnostics chan<- cssom.Diagnostic) *CSSStyles {
+	src := newSourceText(text, url)
+	sheet := css.NewStylesheet()
+	positions := make(map[*css.Rule]cssom.SourcePosition)
+	for _, chunk := range splitRules(src, diagnostics) {
+		pos := src.position(chunk.start + skipBlanks(chunk.text))
+		if strings.HasPrefix(strings.TrimSpace(chunk.text), "{") {
+			cssom.Report(diagnostics, cssom.Diagnostic{
+				Kind: cssom.InvalidRule,
+				Text: strings.TrimSpace(chunk.text),
+				Err:  errors.New("missing selector"),
+				Pos:  pos,
+			})
+		} else if part, err := parser.Parse(chunk.text); err == nil {
+			for _, rule := range validRules(part.Rules, pos, diagnostics) {
+				positions[rule] = pos
+				sheet.Rules = append(sheet.Rules, rule)
+			}
+		} else if rule := recoverRule(chunk.text, pos, diagnostics); rule != nil {
+			positions[rule] = pos
+			sheet.Rules = append(sheet.Rules, rule)
+		} else {
+			cssom.Report(diagnostics, cssom.Diagnostic{
+				Kind: cssom.InvalidRule,
+				Text: strings.TrimSpace(chunk.text),
+				Err:  err,
+				Pos:  pos,
+			})
+		}
+	}
+	styles := Wrap(sheet)
+	styles.positions = positions
+	return styles
+}
+
+// validRules removes declarations with an empty property or value from rules,
+// and rules of nested blocks, e.g. within @media. pos is the position of the
+// enclosing top-level rule.
+func validRules(rules []*css.Rule, pos cssom.SourcePosition, diagnostics chan<- cssom.Diagnostic) []*css.Rule {
+	for _, r := range rules {
+		decls := r.Declarations[:0]
+		for _, d := range r.Declarations {
+			if d.Property == "" || d.Value == "" {
+				cssom.Report(diagnostics, cssom.Diagnostic{
+					Kind: cssom.InvalidDeclaration,
+					Text: d.String(),
+					Err:  errors.New("empty property or value"),
+					Pos:  pos,
+				})
+				continue
+			}
+			decls = append(decls, d)
+		}
+		r.Declarations = decls
+		r.Rules = validRules(r.Rules, pos, diagnostics)
+	}
+	return rules
+}
+
+// recoverRule re-parses a qualified rule declaration by declaration, skipping
+// invalid declarations. Returns nil for at-rules.
+func recoverRule(chunk string, pos cssom.SourcePosition, diagnostics chan<- cssom.Diagnostic) *css.Rule {
+	brace := style.IndexOutsideStrings(chunk, '{', 0)
+	if brace < 0 || strings.HasPrefix(strings.TrimSpace(chunk), "@") {
+		return nil
+	}
+	prelude := strings.TrimSpace(chunk[:brace])
+	rule := css.NewRule(css.QualifiedRule)
+	rule.Prelude = prelude
+	for _, sel := range strings.Split(prelude, ",") {
+		rule.Selectors = append(rule.Selectors, strings.TrimSpace(sel))
+	}
+	body := strings.TrimSuffix(strings.TrimSpace(chunk[brace+1:]), "}")
+	for _, text := range style.SplitOutsideStrings(body, ';') {
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		decls, err := parser.ParseDeclarations(text + ";")
+		if err == nil && len(decls) != 1 {
+			err = errors.New("not a single declaration")
+		}
+		if err != nil {
+			cssom.Report(diagnostics, cssom.Diagnostic{Kind: cssom.InvalidDeclaration, Text: text, Err: err, Pos: pos})
+			continue
+		}
+		rule.Declarations = append(rule.Declarations, decls...)
+	}
+	rule.Declarations = validRules([]*css.Rule{rule}, pos, diagnostics)[0].Declarations
+	return rule
+}
+
+// chunk is the text of a top-level rule, starting at offset start of the
+// text of the style sheet.
+type chunk struct {
+	text  string
+	start int
+}
+
+// splitRules splits a style sheet into top-level rules, i.e. into statements
+// terminated by ';' (e.g. @import) and into blocks terminated by a balancing
+// '}'. Unbalanced closing braces are reported and dropped, blocks left open
+// at the end of the text are closed.
+func splitRules(src *sourceText, diagnostics chan<- cssom.Diagnostic) []chunk {
+	var chunks []chunk
+	text := src.text
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			i = style.SkipString(text, i) - 1
+		case '/':
+			if strings.HasPrefix(text[i:], "/*") {
+				if end := strings.Index(text[i+2:], "*/"); end >= 0 {
+					i += end + 3
+				} else {
+					i = len(text)
+				}
+			}
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				cssom.Report(diagnostics, cssom.Diagnostic{
+					Kind: cssom.InvalidRule,
+					Text: strings.TrimSpace(text[start : i+1]),
+					Err:  errors.New("unexpected '}'"),
+					Pos:  src.position(i),
+				})
+				start = i + 1
+				continue
+			}
+			if depth--; depth == 0 {
+				chunks = append(chunks, chunk{text[start : i+1], start})
+				start = i + 1
+			}
+		case ';':
+			if depth == 0 {
+				chunks = append(chunks, chunk{text[start : i+1], start})
+				start = i + 1
+			}
+		}
+	}
+	if rest := text[start:]; strings.TrimSpace(rest) != "" {
+		chunks = append(chunks, chunk{rest + strings.Repeat("}", depth), start})
+	}
+	return chunks
+}
+
+// skipBlanks returns the length of the white space and comments s starts with.
+func skipBlanks(s string) int {
+	i := 0
+	for i < len(s) {
+		if strings.HasPrefix(s[i:], "/*") {
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return len(s)
+			}
+			i += end + 4
+		} else if strings.IndexByte(" \t\n\r\f", s[i]) >= 0 {
+			i++
+		} else {
+			break
+		}
+	}
+	return i
+}
+
+// --- Source positions -------------------------------------------------
+
+// sourceText maps offsets into the text of a style sheet to source positions.
+type sourceText struct {
+	text  string
+	url   string
+	lines []int // offsets of the starts of lines
+}
+
+func newSourceText(text string, url string) *sourceText {
+	src := &sourceText{text: text, url: url, lines: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			src.lines = append(src.lines, i+1)
+		}
+	}
+	return src
+}
+
+// position returns the source position for an offset into the text.
+func (src *sourceText) position(offset int) cssom.SourcePosition {
+	line := sort.Search(len(src.lines), func(i int) bool { return src.lines[i] > offset })
+	col := utf8.RuneCountInString(src.text[src.lines[line-1]:offset]) + 1
+	return cssom.SourcePosition{URL: src.url, Line: line, Column: col}
+}
@@ -0,0 +1,252 @@
+package cssom
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+)
+
+// --- Styling engine ---------------------------------------------------
+
+// Engine holds the document-independent parts of styling, shared between
+// documents: compiled selectors, the user-agent default properties, compound
+// property splitters, stylable elements, the matching mode, the stages of
+// styling, the media type documents are styled for, and style sheets applying
+// to every document (e.g., user-agent or house styles, or user style sheets
+// with reader preferences).
+//
+// Books are usually made up of many documents, e.g. one per chapter. Styling
+// each of them with a CSSOM of its own re-does all of the setup and shares
+// nothing. An Engine creates a light-weight CSSOM per document instead (see
+// NewCSSOM), or styles documents in one go (see StyleDocument).
+//
+// All methods of Engine are safe for concurrent use. Changes of the
+// configuration do not affect CSSOMs created earlier.
+type Engine struct {
+	sync.RWMutex
+	selectors         *sync.Map                    // cache of compiled selectors, shared by all CSSOMs
+	defaultProperties *style.PropertyMap           // "user agent" style properties
+	compoundSplitters []CompoundPropertiesSplitter // split up compound properties
+	stylable          *elementRegistry             // elements which receive styles
+	matching          MatchingMode                 // match selectors against styled tree or HTML
+	stages            Stages                       // stages of styling
+	pruneHidden       bool                         // do not style subtrees with display: none
+	dropWhitespace    bool                         // drop whitespace-only text nodes between blocks
+	preserveForeign   bool                         // do not style the content of SVG and MathML
+	preserveComments  bool                         // keep comment nodes in the styled tree
+	env               css.EnvContext               // environment variables for env(…), may be nil
+	diagnostics       chan<- Diagnostic            // report invalid constructs of style sheets
+	media             string                       // media type to style documents for
+	sheets            []mediaStylesheet            // style sheets for every document
+}
+
+// mediaStylesheet is a style sheet restricted to a list of media types.
+type mediaStylesheet struct {
+	stylesheetType
+	media []string // media types, empty for all media
+}
+
+// NewEngine creates a styling engine without any style sheets. Clients are
+// allowed to supply a map of additional/custom CSS property values, as with
+// NewCSSOM. Documents are styled for media type "print".
+func NewEngine(additionalProperties []style.KeyValue) *Engine {
+	return &Engine{
+		selectors:         &sync.Map{},
+		defaultProperties: style.InitializeDefaultPropertyValues(additionalProperties),
+		compoundSplitters: []CompoundPropertiesSplitter{style.SplitCompoundProperty},
+		stylable:          newElementRegistry(),
+		media:             "print",
+	}
+}
+
+// SetMediaType sets the media type documents are styled for, e.g. "print" or
+// "screen". Style sheets added for other media types are ignored.
+func (e *Engine) SetMediaType(media string) {
+	e.Lock()
+	defer e.Unlock()
+	e.media = strings.ToLower(strings.TrimSpace(media))
+}
+
+// MediaType returns the media type documents are styled for.
+func (e *Engine) MediaType() string {
+	e.RLock()
+	defer e.RUnlock()
+	return e.media
+}
+
+// AddStyles includes a style sheet for every document styled by the engine.
+// media is a comma-separated list of media types the style sheet applies to,
+// as found in the media attribute of a <link> element. If media is empty or
+// contains "all", the style sheet applies to all media types.
+//
+// Style sheets of the engine are scoped to the document root and precede
+// style sheets added to a single document.
+func (e *Engine) AddStyles(css StyleSheet, source PropertySource, media string) error {
+	if css == nil {
+		return errors.New("Style sheet is nil")
+	}
+	var types []string
+	for _, m := range strings.Split(media, ",") {
+		if m = strings.ToLower(strings.TrimSpace(m)); m != "" {
+			types = append(types, m)
+		}
+	}
+	e.Lock()
+	defer e.Unlock()
+	sheet := stylesheetType{stylesheet: css, source: source}
+	e.sheets = append(e.sheets, mediaStylesheet{sheet, types})
+	return nil
+}
+
+// appliesTo is a predicate wether a style sheet applies to a media type.
+func (s mediaStylesheet) appliesTo(media string) bool {
+	if len(s.media) == 0 {
+		return true
+	}
+	for _, m := range s.media {
+		if m == "all" || m == media {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterCompoundSplitter allows clients to handle additional compound
+// properties. See type CompoundPropertiesSplitter.
+func (e *Engine) RegisterCompoundSplitter(splitter CompoundPropertiesSplitter) {
+	if splitter != nil {
+		e.Lock()
+		defer e.Unlock()
+		e.compoundSplitters = append(e.compoundSplitters, splitter)
+	}
+}
+
+// RegisterStylableNamespace tells the engine to create styles for all
+// elements of a namespace. See CSSOM.RegisterStylableNamespace.
+func (e *Engine) RegisterStylableNamespace(namespace string) {
+	e.stylable.registerNamespace(namespace)
+}
+
+// RegisterStylableElement tells the engine to create styles for an element.
+// See CSSOM.RegisterStylableElement.
+func (e *Engine) RegisterStylableElement(namespace string, element string) {
+	if namespace == NamespaceHTML {
+		element = strings.ToLower(element) // the HTML parser lower-cases element names
+	}
+	e.stylable.registerElement(namespace, element)
+}
+
+// SetMatchingMode sets the tree selectors are matched against during styling.
+// See MatchingMode.
+func (e *Engine) SetMatchingMode(mode MatchingMode) {
+	e.Lock()
+	defer e.Unlock()
+	e.matching = mode
+}
+
+// SetStages sets the stages of styling. See CSSOM.SetStages.
+func (e *Engine) SetStages(stages Stages) {
+	e.Lock()
+	defer e.Unlock()
+	e.stages = stages.withDefaults()
+}
+
+// SetPruneHidden sets whether subtrees with display: none are styled.
+// See CSSOM.SetPruneHidden.
+func (e *Engine) SetPruneHidden(prune bool) {
+	e.Lock()
+	defer e.Unlock()
+	e.pruneHidden = prune
+}
+
+// SetDropInterElementWhitespace sets whether whitespace-only text nodes between
+// block-level elements are dropped. See CSSOM.SetDropInterElementWhitespace.
+func (e *Engine) SetDropInterElementWhitespace(drop bool) {
+	e.Lock()
+	defer e.Unlock()
+	e.dropWhitespace = drop
+}
+
+// SetPreserveForeignContent sets whether inline SVG and MathML subtrees are
+// kept verbatim. See CSSOM.SetPreserveForeignContent.
+func (e *Engine) SetPreserveForeignContent(preserve bool) {
+	e.Lock()
+	defer e.Unlock()
+	e.preserveForeign = preserve
+}
+
+// SetPreserveComments sets whether comment nodes are kept in the styled tree.
+// See CSSOM.SetPreserveComments.
+func (e *Engine) SetPreserveComments(preserve bool) {
+	e.Lock()
+	defer e.Unlock()
+	e.preserveComments = preserve
+}
+
+// SetEnvironment sets the environment variables to substitute for env(…) in
+// property values. See CSSOM.SetEnvironment.
+func (e *Engine) SetEnvironment(env css.EnvContext) {
+	e.Lock()
+	defer e.Unlock()
+	e.env = env
+}
+
+// SetDiagnostics sets a channel to report skipped constructs of style sheets
+// to. As compiled selectors are shared between documents, an invalid selector
+// is reported once per engine. See CSSOM.SetDiagnostics.
+func (e *Engine) SetDiagnostics(diagnostics chan<- Diagnostic) {
+	e.Lock()
+	defer e.Unlock()
+	e.diagnostics = diagnostics
+}
+
+// NewCSSOM creates a CSSOM for a single document, sharing the caches and the
+// configuration of the engine. The engine's style sheets for its media type
+// are included, scoped to the document root. Style sheets and stylable elements
+// added to the CSSOM affect neither the engine nor other documents.
+func (e *Engine) NewCSSOM() *CSSOM {
+	e.RLock()
+	defer e.RUnlock()
+	cssom := &CSSOM{
+		rulesTree:         newRulesTree(),
+		defaultProperties: e.defaultProperties,
+		compoundSplitters: append([]CompoundPropertiesSplitter(nil), e.compoundSplitters...),
+		stylable:          e.stylable.clone(),
+		matching:          e.matching,
+		stages:            e.stages,
+		pruneHidden:       e.pruneHidden,
+		dropWhitespace:    e.dropWhitespace,
+		preserveForeign:   e.preserveForeign,
+		preserveComments:  e.preserveComments,
+		env:               e.env,
+	}
+	cssom.rulesTree.selectors = e.selectors
+	cssom.rulesTree.diagnostics = e.diagnostics
+	for _, s := range e.sheets {
+		if s.appliesTo(e.media) {
+			cssom.rulesTree.StoreStylesheetForHTMLNode(nil, s.stylesheet, s.source)
+		}
+	}
+	return cssom
+}
+
+// StyleDocument styles an HTML parse tree, using the style sheets of the engine
+// plus the author style sheets given, which are scoped to the document root.
+// See CSSOM.Style for a description of the resulting styled tree.
+//
+// StyleDocument may be called concurrently for different documents.
+func (e *Engine) StyleDocument(dom *html.Node, sheets ...StyleSheet) (*tree.Node[*styledtree.StyNode], error) {
+	cssom := e.NewCSSOM()
+	for _, css := range sheets {
+		if err := cssom.AddStylesForScope(nil, css, Author); err != nil {
+			return nil, err
+		}
+	}
+	return cssom.Style(dom)
+}
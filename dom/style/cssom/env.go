@@ -0,0 +1,23 @@
+package cssom
+
+import (
+	"github.com/npillmayer/fp/dom/style/css"
+)
+
+// --- Environment variables --------------------------------------------
+
+// SetEnvironment sets the environment variables to substitute for references
+// of the form env(name, fallback) in property values, e.g. for bleeds or
+// margins parameterized by page templates (see css.EnvContext). References are
+// resolved while styling, after the value-computing stage (see Stages), thus
+// computed styles do not contain env(…). Properties with unresolvable values
+// are treated as unset.
+//
+// A nil environment, which is the default, leaves env(…) in property values
+// unresolved. Clients wanting the variables defined by CSS only should set
+// css.DefaultEnvContext().
+//
+// It must not be called concurrently with calls to Style(…).
+func (cssom *CSSOM) SetEnvironment(env css.EnvContext) {
+	cssom.env = env
+}
@@ -0,0 +1,62 @@
+package cssom
+
+import (
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+)
+
+// --- @font-face -------------------------------------------------------
+
+// FontFaces returns the fonts declared by @font-face rules of the style
+// sheets of a CSSOM, in order of the style sheets (see ListStyleSheets) and
+// of the rules within a style sheet. For a given family, later font faces
+// take precedence over earlier ones covering the same weights, styles and
+// code points.
+//
+// Style sheets have to provide rules implementing AtRule for @font-face rules
+// to be recognized. @font-face rules missing font-family or a valid src are
+// skipped and reported as diagnostics (see SetDiagnostics). Every invalid rule
+// is reported once, not once per call. Font faces are collected from style
+// sheets of all scopes, as font names are global to a document.
+func (cssom *CSSOM) FontFaces() []css.FontFace {
+	var faces []css.FontFace
+	for _, s := range cssom.rulesTree.allStylesheets() {
+		for _, rule := range s.stylesheet.Rules() {
+			if !strings.EqualFold(atKeyword(rule), "@font-face") {
+				continue
+			}
+			if ff, ok := cssom.rulesTree.parseFontFace(rule); ok {
+				faces = append(faces, ff)
+			}
+		}
+	}
+	return faces
+}
+
+// parseFontFace returns the font face for an @font-face rule, using the cache
+// of font faces. Like selectors (see compileSelector), rules are cached by
+// their text, thus invalid rules are reported once (with the position of the
+// first rule found carrying it). Returns false for invalid rules.
+func (rt *rulesTreeType) parseFontFace(rule Rule) (css.FontFace, bool) {
+	props := rule.Properties()
+	descriptors := make([]style.KeyValue, len(props))
+	var key strings.Builder
+	for i, k := range props {
+		descriptors[i] = style.KeyValue{Key: k, Value: rule.Value(k)}
+		key.WriteString(k + ":" + string(descriptors[i].Value) + ";")
+	}
+	cached, found := rt.fontFaces.Load(key.String())
+	if !found {
+		ff, err := css.ParseFontFace(descriptors)
+		if err == nil {
+			cached, _ = rt.fontFaces.LoadOrStore(key.String(), ff)
+		} else if cached, found = rt.fontFaces.LoadOrStore(key.String(), err); !found {
+			Report(rt.diagnostics, Diagnostic{Kind: InvalidRule, Text: "@font-face", Err: err,
+				Pos: rule.SourcePosition()})
+		}
+	}
+	ff, ok := cached.(css.FontFace)
+	return ff, ok
+}
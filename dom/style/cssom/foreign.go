@@ -0,0 +1,28 @@
+package cssom
+
+import (
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+)
+
+// --- Foreign content --------------------------------------------------
+
+// SetPreserveForeignContent sets whether inline SVG and MathML subtrees are
+// kept verbatim. By default, elements from foreign namespaces are styled like
+// HTML elements. Renderers usually hand such content to a dedicated engine,
+// which interprets presentation attributes and its own layout rules, thus
+// styling the descendents of a foreign root is wasted effort. With preserving
+// enabled, the root element of a foreign subtree (see
+// styledtree.StyNode.ForeignContent) is styled, but no styled nodes are created
+// for its descendents. The HTML subtree of the root is left untouched.
+//
+// It must not be called concurrently with calls to Style(…).
+func (cssom *CSSOM) SetPreserveForeignContent(preserve bool) {
+	cssom.preserveForeign = preserve
+}
+
+// isPreservedForeign is true if the children of node are not to be styled,
+// as it is the root of a foreign subtree and preserving is enabled.
+func (cssom *CSSOM) isPreservedForeign(node *tree.Node[*styledtree.StyNode]) bool {
+	return cssom.preserveForeign && node.Payload.ForeignContent() != ""
+}
@@ -0,0 +1,96 @@
+package cssom
+
+import (
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+)
+
+// --- Matching selectors against the styled tree -------------------------
+
+// MatchingMode determines which tree selectors are matched against during
+// styling.
+type MatchingMode uint8
+
+// Matching modes for selectors, see SetMatchingMode.
+const (
+	// MatchStyledTree matches selectors against the structure of the styled
+	// tree. Structural pseudo-classes such as :first-child reflect the styled
+	// tree, i.e., they respect nodes which have been removed from or added to it.
+	// This is the default.
+	MatchStyledTree MatchingMode = iota
+	// MatchHTMLTree matches selectors against the HTML parse tree.
+	MatchHTMLTree
+)
+
+// SetMatchingMode sets the tree selectors are matched against during styling.
+// It must not be called concurrently with calls to Style(…).
+func (cssom *CSSOM) SetMatchingMode(mode MatchingMode) {
+	cssom.matching = mode
+}
+
+// styledTreeMatcher provides the nodes which selectors are matched against for
+// styled nodes. cascadia operates on *html.Node only, therefore the matcher
+// mirrors the styled tree with shadow HTML nodes. Shadow nodes share type, name,
+// namespace and attributes with the original HTML nodes, but are linked to
+// each other according to the structure of the styled tree.
+//
+// The mirror is created in one go, after the styled tree has been built and
+// before styles are matched. It is read-only afterwards and may be used by
+// concurrent styling walkers.
+type styledTreeMatcher struct {
+	shadows map[*styledtree.StyNode]*html.Node
+}
+
+// newStyledTreeMatcher creates a matcher for the styled tree rooted at root.
+// A nil root results in a matcher falling back to HTML nodes for every styled node.
+//
+// If root is an element, i.e. a fragment is styled, the mirror is given a
+// document node as its parent. Thus :root matches the topmost element of the
+// fragment, as it would for a document element.
+func newStyledTreeMatcher(root *tree.Node[*styledtree.StyNode]) *styledTreeMatcher {
+	m := &styledTreeMatcher{shadows: make(map[*styledtree.StyNode]*html.Node)}
+	if root != nil {
+		var doc *html.Node
+		if h := root.Payload.HTMLNode(); h != nil && h.Type == html.ElementNode {
+			doc = &html.Node{Type: html.DocumentNode}
+		}
+		m.mirror(root, doc)
+	}
+	return m
+}
+
+// mirror creates a shadow node for n and recursively for its children, and
+// appends it to parent (if non-nil).
+func (m *styledTreeMatcher) mirror(n *tree.Node[*styledtree.StyNode], parent *html.Node) {
+	h := n.Payload.HTMLNode()
+	if h == nil {
+		return
+	}
+	shadow := &html.Node{
+		Type:      h.Type,
+		DataAtom:  h.DataAtom,
+		Data:      h.Data,
+		Namespace: h.Namespace,
+		Attr:      h.Attr,
+	}
+	m.shadows[n.Payload] = shadow
+	if parent != nil {
+		parent.AppendChild(shadow)
+	}
+	for _, ch := range n.Children(true) {
+		m.mirror(ch, shadow)
+	}
+}
+
+// nodeFor returns the node to match selectors against for styled node n. If
+// n is not part of the mirrored styled tree (e.g., it has been generated after
+// the matcher had been created), the HTML node of n is returned.
+func (m *styledTreeMatcher) nodeFor(n *styledtree.StyNode) *html.Node {
+	if m != nil {
+		if shadow, ok := m.shadows[n]; ok {
+			return shadow
+		}
+	}
+	return n.HTMLNode()
+}
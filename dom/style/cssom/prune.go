@@ -0,0 +1,66 @@
+package cssom
+
+import (
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+)
+
+// --- Pruning of hidden subtrees ---------------------------------------
+
+// SetPruneHidden sets whether subtrees of nodes with display: none are styled.
+// Content with display: none does not generate boxes, thus matching and
+// styling it is wasted effort for clients which lay out a document. With
+// pruning enabled, a hidden node is styled, but its children are removed from
+// the styled tree, leaving the hidden node as a stub. Clients which need
+// hidden content, e.g. for text extraction, should keep pruning disabled,
+// which is the default.
+//
+// Nodes are hidden either by a style rule or by their user-agent default
+// (see style.DisplayPropertyForHTMLNode), e.g. for <head> or for elements
+// carrying attribute hidden. The contents of nodes with content-visibility:
+// hidden are pruned as well, as they do not generate boxes either (see
+// css.Containment). Unlike nodes with display: none, such a node still
+// generates a box of its own.
+//
+// It must not be called concurrently with calls to Style(…).
+func (cssom *CSSOM) SetPruneHidden(prune bool) {
+	cssom.pruneHidden = prune
+}
+
+// hidesContents is true if the contents of a styled node do not generate boxes,
+// i.e. if the node has display: none or content-visibility: hidden.
+func hidesContents(node *tree.Node[*styledtree.StyNode]) bool {
+	if displaysNone(node) {
+		return true
+	}
+	return node.Payload.HTMLNode().Type == html.ElementNode && css.Containment(node.Payload).SkipsContents()
+}
+
+// displaysNone is true if a styled node has display: none, either set by style
+// rules or as its user-agent default.
+func displaysNone(node *tree.Node[*styledtree.StyNode]) bool {
+	h := node.Payload.HTMLNode()
+	if h.Type != html.ElementNode {
+		return false
+	}
+	if pmap := node.Payload.Styles(); pmap != nil {
+		if p, ok := pmap.Property("display"); ok && !p.IsEmpty() && !p.IsCSSWideKeyword() {
+			return p == "none"
+		}
+	}
+	return style.DisplayPropertyForHTMLNode(h) == "none"
+}
+
+// pruneChildren removes all children of node from the styled tree.
+func pruneChildren(node *tree.Node[*styledtree.StyNode]) {
+	children := node.Children(true)
+	if len(children) > 0 {
+		tracer().Debugf("Pruning %d children of hidden node %v", len(children), node)
+	}
+	for _, ch := range children {
+		ch.Isolate()
+	}
+}
@@ -0,0 +1,265 @@
+package cssom
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+)
+
+// --- Selectors --------------------------------------------------------
+
+// CompileSelector compiles a CSS selector string into a cascadia selector.
+// Before handing the selector to cascadia, attribute selectors are normalized
+// to cover parts of the CSS Selectors Level 4 syntax which cascadia does not
+// support:
+//
+// ▪︎ Case-sensitivity flags `i` and `s`, e.g. `[data-type="chapter" i]`.
+//
+// ▪︎ Attribute values which HTML defines as case-insensitive (e.g., 'type' or
+// 'lang') are compared ignoring case, unless flag `s` is given.
+//
+// ▪︎ Namespace prefixes, e.g. `[epub|type~=chapter]`. As HTML has no notion of
+// namespace declarations, a prefix matches attributes with a qualified name,
+// such as `epub:type`, as found in HTMLBook or EPUB sources. `[*|attr]` and
+// `[|attr]` match attributes by their local name.
+//
+// Attributes of foreign content which the HTML parser splits into namespace
+// and key (e.g., `xlink:href` in inline SVG) are not matched by prefixed
+// attribute selectors. Neither are attributes of foreign content with mixed-case
+// names, such as `viewBox`, as cascadia compares attribute names in lowercase.
+func CompileSelector(selector string) (cascadia.Selector, error) {
+	normalized, err := normalizeAttributeSelectors(selector)
+	if err != nil {
+		return nil, err
+	}
+	return cascadia.Compile(normalized)
+}
+
+// caseInsensitiveAttributes are attributes of HTML elements whose values are
+// to be matched ASCII-case-insensitively by attribute selectors.
+// See https://html.spec.whatwg.org/multipage/semantics-other.html#case-sensitivity-of-selectors
+var caseInsensitiveAttributes = map[string]bool{
+	"accept": true, "accept-charset": true, "align": true, "alink": true,
+	"axis": true, "bgcolor": true, "charset": true, "checked": true,
+	"clear": true, "codetype": true, "color": true, "compact": true,
+	"declare": true, "defer": true, "dir": true, "direction": true,
+	"disabled": true, "enctype": true, "face": true, "frame": true,
+	"hreflang": true, "http-equiv": true, "lang": true, "language": true,
+	"link": true, "media": true, "method": true, "multiple": true,
+	"nohref": true, "noresize": true, "noshade": true, "nowrap": true,
+	"readonly": true, "rel": true, "rev": true, "rules": true,
+	"scope": true, "scrolling": true, "selected": true, "shape": true,
+	"target": true, "text": true, "type": true, "valign": true,
+	"valuetype": true, "vlink": true,
+}
+
+// normalizeAttributeSelectors rewrites all attribute selectors of selector
+// into a form understood by cascadia. Everything outside of attribute
+// selectors is copied unchanged. Selectors using cascadia's non-standard regular
+// expression operator `#=` are not touched at all.
+func normalizeAttributeSelectors(selector string) (string, error) {
+	if strings.Contains(selector, "#=") {
+		return selector, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(selector); {
+		switch c := selector[i]; c {
+		case '\\':
+			end := i + 2
+			if end > len(selector) {
+				end = len(selector)
+			}
+			b.WriteString(selector[i:end])
+			i = end
+		case '"', '\'':
+			end, err := scanString(selector, i)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(selector[i:end])
+			i = end
+		case '[':
+			attr, end, err := parseAttrSelector(selector, i)
+			if err != nil {
+				return "", fmt.Errorf("selector %q: %w", selector, err)
+			}
+			b.WriteString(attr.String())
+			i = end
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// attrSelector holds the components of an attribute selector
+// `[prefix|name op value flag]`.
+type attrSelector struct {
+	prefix    string // namespace prefix, "*" for any namespace
+	hasPrefix bool   // a prefix has been given, possibly empty
+	name      string // local name of the attribute, escapes preserved
+	op        string // operator, empty for presence tests
+	value     string // value, with quotes preserved
+	flag      byte   // case-sensitivity flag: 0, 'i' or 's'
+}
+
+// String returns attribute selector a in a form understood by cascadia.
+func (a attrSelector) String() string {
+	name := a.name
+	if a.hasPrefix && a.prefix != "" && a.prefix != "*" {
+		name = a.prefix + `\:` + name
+	}
+	if a.op == "" {
+		return "[" + name + "]"
+	}
+	insensitive := a.flag == 'i'
+	if a.flag == 0 && !a.hasPrefix {
+		insensitive = caseInsensitiveAttributes[strings.ToLower(a.name)]
+	}
+	if insensitive {
+		return "[" + name + a.op + a.value + " i]"
+	}
+	return "[" + name + a.op + a.value + "]"
+}
+
+// parseAttrSelector parses an attribute selector starting at s[start] == '['.
+// It returns the components of the attribute selector and the position
+// following the closing bracket.
+func parseAttrSelector(s string, start int) (attrSelector, int, error) {
+	a := attrSelector{}
+	i := skipSpace(s, start+1)
+	if i < len(s) && s[i] == '*' && i+1 < len(s) && s[i+1] == '|' {
+		a.prefix, a.hasPrefix = "*", true
+		i += 2
+	} else if i < len(s) && s[i] == '|' {
+		a.hasPrefix = true
+		i++
+	}
+	name, i := scanName(s, i)
+	if i < len(s) && s[i] == '|' && !a.hasPrefix && (i+1 >= len(s) || s[i+1] != '=') {
+		a.prefix, a.hasPrefix = name, true
+		name, i = scanName(s, i+1)
+	}
+	if name == "" {
+		return a, i, errors.New("expected attribute name")
+	}
+	a.name = name
+	i = skipSpace(s, i)
+	if i >= len(s) {
+		return a, i, errors.New("unexpected end of attribute selector")
+	}
+	if s[i] == ']' {
+		return a, i + 1, nil
+	}
+	switch {
+	case s[i] == '=':
+		a.op = "="
+	case i+1 < len(s) && s[i+1] == '=' && strings.IndexByte("~|^$*!", s[i]) >= 0:
+		a.op = s[i : i+2]
+	default:
+		return a, i, fmt.Errorf("unsupported attribute operator at %q", s[i:])
+	}
+	i = skipSpace(s, i+len(a.op))
+	if i >= len(s) {
+		return a, i, errors.New("expected attribute value")
+	}
+	valueStart := i
+	if s[i] == '"' || s[i] == '\'' {
+		end, err := scanString(s, i)
+		if err != nil {
+			return a, i, err
+		}
+		i = end
+	} else {
+		_, i = scanName(s, i)
+	}
+	if i == valueStart {
+		return a, i, errors.New("expected attribute value")
+	}
+	a.value = s[valueStart:i]
+	i = skipSpace(s, i)
+	if i < len(s) {
+		switch s[i] {
+		case 'i', 'I':
+			a.flag = 'i'
+			i = skipSpace(s, i+1)
+		case 's', 'S':
+			a.flag = 's'
+			i = skipSpace(s, i+1)
+		}
+	}
+	if i >= len(s) || s[i] != ']' {
+		return a, i, errors.New("expected ']' to close attribute selector")
+	}
+	return a, i + 1, nil
+}
+
+// scanName scans an identifier or name, starting at s[i]. Escapes are kept
+// as-is. Returns the name and the position following it.
+func scanName(s string, i int) (string, int) {
+	start := i
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i += 2
+		case c == '-' || c == '_' || c >= 0x80 ||
+			c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+			i++
+		default:
+			return s[start:i], i
+		}
+	}
+	return s[start:i], i
+}
+
+// scanString scans a quoted string, starting at the opening quote s[i].
+// Returns the position following the closing quote.
+func scanString(s string, i int) (int, error) {
+	quote := s[i]
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1, nil
+		}
+	}
+	return i, errors.New("unterminated string in selector")
+}
+
+func skipSpace(s string, i int) int {
+	for i < len(s) && strings.IndexByte(" \t\n\r\f", s[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+// attributeSelectorsCollapsed returns selector with the content of attribute
+// selectors removed, i.e. `a[title="x y"]` is turned into `a[]`. It is used
+// for estimating the specifity of a selector.
+func attributeSelectorsCollapsed(selector string) string {
+	if strings.IndexByte(selector, '[') < 0 {
+		return selector
+	}
+	var b strings.Builder
+	for i := 0; i < len(selector); {
+		if selector[i] != '[' {
+			b.WriteByte(selector[i])
+			i++
+			continue
+		}
+		b.WriteString("[]")
+		for i++; i < len(selector) && selector[i] != ']'; i++ {
+			if selector[i] == '"' || selector[i] == '\'' {
+				end, _ := scanString(selector, i)
+				i = end - 1
+			}
+		}
+		i++
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package cssom
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+
+	"golang.org/x/net/html"
+)
+
+// --- Order of style sheets --------------------------------------------
+
+// StyleSheetEntry describes a style sheet added to a CSSOM (see ListStyleSheets).
+type StyleSheetEntry struct {
+	Scope      *html.Node     // scope of the style sheet, nil for the document root
+	StyleSheet StyleSheet     // the style sheet
+	Source     PropertySource // origin of the style sheet
+}
+
+// AddStylesForScopeAt is like AddStylesForScope, but puts the style sheet at
+// position index within the order of all style sheets of the CSSOM (see
+// ListStyleSheets), shifting style sheets at later positions. Index 0 puts the
+// style sheet first, i.e. its rules are overridden by rules of equal
+// specifity from every other style sheet. A negative index or an index beyond
+// the last style sheet appends the style sheet, which is what
+// AddStylesForScope does.
+//
+// The order of style sheets is a tie-breaker for rules of equal source and
+// specifity only: a rule with a more specific selector wins regardless of the
+// order of style sheets, and so do rules from a source ranking higher in the
+// cascade. In particular, rules from <style> elements (Script) override rules
+// from linked style sheets (Author) of equal specifity. Clients wanting linked
+// style sheets and <style> elements to compete in document order have to add
+// both with the same source, in document order or at explicit positions.
+func (cssom *CSSOM) AddStylesForScopeAt(scope *html.Node, css StyleSheet, source PropertySource,
+	index int) error {
+	//
+	if scope != nil && scope.Type != html.ElementNode && scope.Type != html.DocumentNode {
+		return errors.New("Can style element nodes only")
+	}
+	if css == nil {
+		return errors.New("Style sheet is nil")
+	}
+	cssom.rulesTree.insertStylesheetForHTMLNode(scope, css, source, index)
+	return nil
+}
+
+// ListStyleSheets returns the style sheets added to a CSSOM, in order of
+// increasing precedence for rules of equal source and specifity. Unless
+// positioned explicitly with AddStylesForScopeAt, style sheets are listed in
+// the order they have been added, independent of their scope.
+func (cssom *CSSOM) ListStyleSheets() []StyleSheetEntry {
+	sheets := cssom.rulesTree.allStylesheets()
+	entries := make([]StyleSheetEntry, len(sheets))
+	for i, s := range sheets {
+		entries[i] = StyleSheetEntry{StyleSheet: s.stylesheet, Source: s.source}
+		if s.scope != cssom.rulesTree.root {
+			entries[i].Scope = s.scope
+		}
+	}
+	return entries
+}
+
+// scopedStylesheet is a style sheet together with the node it is stored for.
+type scopedStylesheet struct {
+	stylesheetType
+	scope *html.Node
+}
+
+// allStylesheets returns all style sheets of the rules tree, ordered by ordinal.
+func (rt *rulesTreeType) allStylesheets() []scopedStylesheet {
+	var all []scopedStylesheet
+	rt.stylesheets.Range(func(key, value interface{}) bool {
+		for _, s := range value.([]stylesheetType) {
+			all = append(all, scopedStylesheet{s, key.(*html.Node)})
+		}
+		return true
+	})
+	sort.Slice(all, func(i, j int) bool { return all[i].ordinal < all[j].ordinal })
+	return all
+}
+
+// insertStylesheetForHTMLNode registers a style sheet for an html node at
+// position index within the order of all style sheets. Ordinals of all style
+// sheets are re-assigned, thus it must not be called concurrently with styling.
+func (rt *rulesTreeType) insertStylesheetForHTMLNode(h *html.Node, sheet StyleSheet,
+	source PropertySource, index int) {
+	//
+	all := rt.allStylesheets()
+	if index < 0 || index >= len(all) {
+		rt.StoreStylesheetForHTMLNode(h, sheet, source)
+		return
+	}
+	tracer().Debugf("Inserting style sheet for HTML node %v at position %d", h, index)
+	all = append(all[:index+1], all[index:]...)
+	all[index] = scopedStylesheet{stylesheetType{sheet, source, 0}, rt.scopeKey(h)}
+	scopes := make(map[*html.Node][]stylesheetType)
+	for i, s := range all {
+		s.ordinal = uint32(i + 1)
+		scopes[s.scope] = append(scopes[s.scope], s.stylesheetType)
+	}
+	for scope, sheets := range scopes {
+		rt.stylesheets.Store(scope, sheets)
+	}
+	atomic.StoreUint32(rt.sheetcnt, uint32(len(all)))
+}
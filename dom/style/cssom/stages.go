@@ -0,0 +1,248 @@
+package cssom
+
+import (
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+)
+
+// --- Styling stages -----------------------------------------------------
+
+// Styling a node is done in four stages:
+//
+//     Match → Cascade → Inherit → ComputeValues
+//
+// Match collects the rules with selectors matching the node. Cascade extracts
+// the declarations of these rules and determines the winning declaration for
+// every property. Inherit creates the property map for the node, with property
+// groups relative to the groups of the node's ancestors. ComputeValues may
+// finally post-process the property map.
+//
+// Every stage is represented by an interface. Clients may replace or instrument
+// single stages (see SetStages), e.g. to swap the inheritance model, without
+// replacing the others. Stages are called by walker goroutines and therefore
+// have to be safe for concurrent use.
+
+// MatchedRule is a rule matching a node. Tools may use the position of the
+// rule (see Rule.SourcePosition) to refer to its definition.
+type MatchedRule struct {
+	Rule   Rule           // the rule matching the node
+	Source PropertySource // origin of the rule
+	Order  uint64         // position in source order; on equal specifity, higher wins
+}
+
+// Declaration is a property declaration which has won the cascade for a node.
+type Declaration struct {
+	Key       string         // atomic property key, compound properties are split up
+	Value     style.Property // specified value
+	Important bool           // declared !important
+	Source    PropertySource // origin of the declaration
+}
+
+// Matcher collects the rules matching a styled node.
+type Matcher interface {
+	Match(run *StyleRun, node *tree.Node[*styledtree.StyNode]) []MatchedRule
+}
+
+// Cascader determines the winning declarations from the rules matching a
+// styled node. Every property key must occur at most once in the result.
+type Cascader interface {
+	Cascade(run *StyleRun, node *tree.Node[*styledtree.StyNode], matches []MatchedRule) []Declaration
+}
+
+// Inheritor creates the property map of a styled node from the winning
+// declarations. Ancestors of node have already been styled. A nil property map
+// leaves node without local styles, i.e. every property is inherited or
+// defaulted from ancestors.
+type Inheritor interface {
+	Inherit(run *StyleRun, node *tree.Node[*styledtree.StyNode], decls []Declaration) *style.PropertyMap
+}
+
+// ValueComputer post-processes the property map of a styled node. pmap may be nil.
+type ValueComputer interface {
+	ComputeValues(run *StyleRun, node *tree.Node[*styledtree.StyNode], pmap *style.PropertyMap) *style.PropertyMap
+}
+
+// Stages holds the stages of styling. Nil stages are replaced by the
+// default stages of the CSSOM.
+type Stages struct {
+	Match   Matcher
+	Cascade Cascader
+	Inherit Inheritor
+	Compute ValueComputer
+}
+
+// DefaultStages returns the default stages of styling. The default value computer
+// leaves property maps as they are: values are computed lazily (see package css).
+func DefaultStages() Stages {
+	return Stages{
+		Match:   ruleMatcher{},
+		Cascade: specifityCascader{},
+		Inherit: groupInheritor{},
+		Compute: keepValues{},
+	}
+}
+
+// withDefaults returns s with nil stages replaced by default stages.
+func (s Stages) withDefaults() Stages {
+	d := DefaultStages()
+	if s.Match == nil {
+		s.Match = d.Match
+	}
+	if s.Cascade == nil {
+		s.Cascade = d.Cascade
+	}
+	if s.Inherit == nil {
+		s.Inherit = d.Inherit
+	}
+	if s.Compute == nil {
+		s.Compute = d.Compute
+	}
+	return s
+}
+
+// SetStages sets the stages of styling. Nil stages are replaced by the default
+// stages. To instrument a stage, wrap the stage returned by Stages().
+// It must not be called concurrently with calls to Style(…).
+func (cssom *CSSOM) SetStages(stages Stages) {
+	cssom.stages = stages.withDefaults()
+}
+
+// Stages returns the stages of styling currently in use.
+func (cssom *CSSOM) Stages() Stages {
+	return cssom.stages.withDefaults()
+}
+
+// StyleRun holds the state of a single run of styling, i.e. of a call to Style(…)
+// or to StyleStream(…). It is handed to every stage.
+type StyleRun struct {
+	cssom    *CSSOM
+	stages   Stages
+	matcher  *styledTreeMatcher   // nil matcher matches against HTML nodes
+	interner *style.GroupInterner // nil interner does not share groups
+	prune    bool                 // prune subtrees with display: none
+	env      css.EnvContext       // nil environment leaves env(…) unresolved
+	counters *styleCounters       // nil counters collect nothing
+}
+
+func (cssom *CSSOM) newStyleRun(matcher *styledTreeMatcher, interner *style.GroupInterner,
+	counters *styleCounters) *StyleRun {
+	//
+	return &StyleRun{
+		cssom:    cssom,
+		stages:   cssom.Stages(),
+		matcher:  matcher,
+		interner: interner,
+		prune:    cssom.pruneHidden,
+		env:      cssom.env,
+		counters: counters,
+	}
+}
+
+// CSSOM returns the CSSOM styling is done for.
+func (run *StyleRun) CSSOM() *CSSOM {
+	return run.cssom
+}
+
+// styleNode runs the stages for node and sets its styles. Nodes other than
+// documents and elements are not passed on to the next pipeline stage.
+// If pruning is enabled, the children of hidden nodes are removed.
+func (run *StyleRun) styleNode(node *tree.Node[*styledtree.StyNode]) (*tree.Node[*styledtree.StyNode], error) {
+	h := node.Payload.HTMLNode()
+	if h.Type != html.DocumentNode && h.Type != html.ElementNode {
+		return nil, nil
+	}
+	if !run.cssom.stylable.isStylable(h) {
+		if run.prune && hidesContents(node) {
+			pruneChildren(node)
+		}
+		return node, nil
+	}
+	run.counters.inc(countNodes, 1)
+	t := run.counters.now()
+	matches := run.stages.Match.Match(run, node)
+	if len(matches) == 0 {
+		tracer().Debugf("Node %v matched no style rules", node)
+	}
+	t = run.counters.lap(phaseMatch, t)
+	decls := run.stages.Cascade.Cascade(run, node, matches)
+	run.counters.inc(countCascaded, len(decls))
+	t = run.counters.lap(phaseCascade, t)
+	pmap := run.stages.Inherit.Inherit(run, node, decls)
+	t = run.counters.lap(phaseInherit, t)
+	pmap = run.stages.Compute.ComputeValues(run, node, pmap)
+	if run.env != nil {
+		pmap = run.env.ResolveMap(pmap)
+	}
+	run.counters.lap(phaseCompute, t)
+	if pmap != nil {
+		pmap = run.interner.InternMap(pmap)
+		tracer().Debugf("Setting styles for node %v =\n%s", node, pmap)
+		node.Payload.SetStyles(pmap)
+	}
+	if run.prune && hidesContents(node) {
+		pruneChildren(node)
+	}
+	return node, nil
+}
+
+// --- Default stages -----------------------------------------------------
+
+// ruleMatcher matches the rules of the style sheets in scope of a node,
+// including style attributes and presentation attributes.
+type ruleMatcher struct{}
+
+func (ruleMatcher) Match(run *StyleRun, node *tree.Node[*styledtree.StyNode]) []MatchedRule {
+	h := node.Payload.HTMLNode()
+	list := run.cssom.rulesTree.filterMatches(h, run.matcher.nodeFor(node.Payload), run.counters)
+	if list == nil || len(list.matchingRules) == 0 {
+		return nil
+	}
+	matches := make([]MatchedRule, len(list.matchingRules))
+	for i, rule := range list.matchingRules {
+		matches[i] = MatchedRule{Rule: rule, Source: list.sources[i], Order: uint64(list.ordinals[i])}
+	}
+	return matches
+}
+
+// specifityCascader orders declarations by origin, importance, specifity and
+// source order (see matchesList.SortProperties).
+type specifityCascader struct{}
+
+func (specifityCascader) Cascade(run *StyleRun, node *tree.Node[*styledtree.StyNode], matches []MatchedRule) []Declaration {
+	if len(matches) == 0 {
+		return nil
+	}
+	list := &matchesList{
+		matchingRules: make([]Rule, len(matches)),
+		ordinals:      make([]ruleOrdinal, len(matches)),
+		sources:       make([]PropertySource, len(matches)),
+	}
+	for i, m := range matches {
+		list.matchingRules[i] = m.Rule
+		list.ordinals[i] = ruleOrdinal(m.Order)
+		list.sources[i] = m.Source
+	}
+	list.SortProperties(run.cssom.compoundSplitters)
+	return list.winners()
+}
+
+// groupInheritor creates property groups for the declarations of a node. Groups
+// not present yet are forked off the nearest ancestor's group.
+type groupInheritor struct{}
+
+func (groupInheritor) Inherit(run *StyleRun, node *tree.Node[*styledtree.StyNode], decls []Declaration) *style.PropertyMap {
+	if len(decls) == 0 {
+		return nil
+	}
+	return createStyleGroups(node.Parent(), decls)
+}
+
+// keepValues leaves property maps untouched.
+type keepValues struct{}
+
+func (keepValues) ComputeValues(run *StyleRun, node *tree.Node[*styledtree.StyNode], pmap *style.PropertyMap) *style.PropertyMap {
+	return pmap
+}
@@ -0,0 +1,157 @@
+package cssom
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+)
+
+// --- Performance counters -----------------------------------------------
+
+// Stats holds performance counters of a single call to StyleWithStats.
+//
+// Durations of the styling stages are wall time summed up over all walker
+// goroutines, thus they may add up to more than Elapsed. Counters for
+// selectors and matches are collected by the default matcher only; custom
+// matchers (see SetStages) leave them at 0.
+type Stats struct {
+	Nodes              uint64        // number of nodes run through the styling stages
+	SelectorsCompiled  uint64        // selectors compiled, including invalid ones
+	SelectorCacheHits  uint64        // selectors found in the cache of compiled selectors
+	MatchAttempts      uint64        // rules tried against a node
+	RulesMatched       uint64        // rules matching a node, including style and presentation attributes
+	PropertiesCascaded uint64        // declarations winning the cascade
+	GroupsCreated      uint64        // property groups set for nodes, before sharing
+	GroupsShared       uint64        // property groups replaced by an identical group
+	Build              time.Duration // wall time for creating the styled nodes
+	Match              time.Duration // time spent in the Match stage
+	Cascade            time.Duration // time spent in the Cascade stage
+	Inherit            time.Duration // time spent in the Inherit stage
+	Compute            time.Duration // time spent in the ComputeValues stage
+	Elapsed            time.Duration // wall time of the complete call
+}
+
+// String returns a summary of the counters, suitable for debugging.
+func (s Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "styled %d nodes, elapsed %v:\n", s.Nodes, s.Elapsed)
+	fmt.Fprintf(&b, "selectors: %d compiled, %d cache hits\n", s.SelectorsCompiled, s.SelectorCacheHits)
+	fmt.Fprintf(&b, "rules:     %d attempts, %d matched\n", s.MatchAttempts, s.RulesMatched)
+	fmt.Fprintf(&b, "cascade:   %d properties\n", s.PropertiesCascaded)
+	fmt.Fprintf(&b, "groups:    %d created, %d shared\n", s.GroupsCreated, s.GroupsShared)
+	fmt.Fprintf(&b, "build %v | match %v | cascade %v | inherit %v | compute %v\n",
+		s.Build, s.Match, s.Cascade, s.Inherit, s.Compute)
+	return b.String()
+}
+
+// StyleWithStats styles an HTML parse tree, exactly like Style(…), and
+// additionally returns performance counters for the run:
+//
+//     stytree, stats, err := cssom.StyleWithStats(h)
+//     fmt.Println(stats)
+//
+// Style(…) does not collect counters and therefore does not suffer any overhead.
+func (cssom *CSSOM) StyleWithStats(dom *html.Node) (*tree.Node[*styledtree.StyNode], Stats, error) {
+	start := time.Now()
+	counters := &styleCounters{}
+	stytree, err := cssom.style(dom, counters)
+	stats := counters.stats()
+	stats.Elapsed = time.Since(start)
+	return stytree, stats, err
+}
+
+// Indexes of counters, see styleCounters.
+const (
+	countNodes = iota
+	countCompiled
+	countCacheHits
+	countAttempts
+	countMatched
+	countCascaded
+	countGroupsCreated
+	countGroupsShared
+	countersCount
+)
+
+// Indexes of timed phases, see styleCounters.
+const (
+	phaseBuild = iota
+	phaseMatch
+	phaseCascade
+	phaseInherit
+	phaseCompute
+	phasesCount
+)
+
+// styleCounters collects performance counters concurrently. A nil
+// styleCounters collects nothing.
+type styleCounters struct {
+	counts [countersCount]uint64 // used atomically
+	busy   [phasesCount]int64    // nanoseconds, used atomically
+}
+
+// inc adds n to counter number counter.
+func (c *styleCounters) inc(counter int, n int) {
+	if c == nil {
+		return
+	}
+	atomic.AddUint64(&c.counts[counter], uint64(n))
+}
+
+// now returns the current time, if c collects counters.
+func (c *styleCounters) now() time.Time {
+	if c == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// lap adds the time since start to phase number phase and returns the
+// current time, to be used as the start of the next phase.
+func (c *styleCounters) lap(phase int, start time.Time) time.Time {
+	if c == nil {
+		return start
+	}
+	now := time.Now()
+	atomic.AddInt64(&c.busy[phase], int64(now.Sub(start)))
+	return now
+}
+
+// interned adds the counters of a group interner.
+func (c *styleCounters) interned(st style.InternStats) {
+	c.inc(countGroupsCreated, st.Seen)
+	c.inc(countGroupsShared, st.Seen-st.Unique)
+}
+
+// stats returns the counters collected so far.
+func (c *styleCounters) stats() Stats {
+	var n [countersCount]uint64
+	var d [phasesCount]time.Duration
+	for i := range n {
+		n[i] = atomic.LoadUint64(&c.counts[i])
+	}
+	for i := range d {
+		d[i] = time.Duration(atomic.LoadInt64(&c.busy[i]))
+	}
+	return Stats{
+		Nodes:              n[countNodes],
+		SelectorsCompiled:  n[countCompiled],
+		SelectorCacheHits:  n[countCacheHits],
+		MatchAttempts:      n[countAttempts],
+		RulesMatched:       n[countMatched],
+		PropertiesCascaded: n[countCascaded],
+		GroupsCreated:      n[countGroupsCreated],
+		GroupsShared:       n[countGroupsShared],
+		Build:              d[phaseBuild],
+		Match:              d[phaseMatch],
+		Cascade:            d[phaseCascade],
+		Inherit:            d[phaseInherit],
+		Compute:            d[phaseCompute],
+	}
+}
@@ -0,0 +1,110 @@
+package cssom
+
+import (
+	"errors"
+
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// --- Streaming ----------------------------------------------------------
+
+// StyleVisitor is called by StyleStream for every styled node, once when
+// entering the node and once when leaving it.
+type StyleVisitor func(node *tree.Node[*styledtree.StyNode], entering bool) error
+
+// StyleStream styles an HTML parse tree node by node, in document order. Contrary
+// to Style(…), it does not build a styled tree for the complete document. Instead
+// it calls visit for every styled node (document, elements and text), once when
+// entering the node—with its styles already computed—and once when leaving it,
+// after all of its descendents have been visited. After leaving a node, the node
+// is detached from its parent and released. Thus, only the path from the
+// document node to the current node is held in memory, together with the
+// property groups referenced by it.
+//
+// During a call to visit, the node is connected to its ancestors, i.e. inherited
+// properties may be resolved. Clients must not hold on to nodes after visit has
+// returned for leaving them.
+//
+// The HTML parse tree is not streamed, as selectors may refer to siblings of
+// nodes. Selectors are always matched against the HTML parse tree, independent
+// of the matching mode of the CSSOM (see SetMatchingMode). Nodes are not assigned
+// IDs (see styledtree.NodeID), and property groups are not shared between
+// siblings (see style.GroupInterner). If pruning of hidden subtrees is enabled
+// (see SetPruneHidden), the descendents of nodes with display: none or
+// content-visibility: hidden are not visited. The same holds for the descendents of foreign-content roots, if
+// foreign content is preserved (see SetPreserveForeignContent).
+//
+// If visit returns an error, styling is aborted and the error is returned.
+func (cssom *CSSOM) StyleStream(dom *html.Node, visit StyleVisitor) error {
+	if dom == nil {
+		return errors.New("Nothing to style: empty document")
+	}
+	if visit == nil {
+		return errors.New("Cannot stream styles without a visitor")
+	}
+	docNode := setupStyledNodeTree(dom, cssom.defaultProperties)
+	return cssom.streamNode(docNode, visit)
+}
+
+// streamNode styles node, visits it, and then recursively creates, styles and
+// visits its children.
+func (cssom *CSSOM) streamNode(node *tree.Node[*styledtree.StyNode], visit StyleVisitor) error {
+	h := node.Payload.HTMLNode()
+	var attrSheet StyleSheet
+	if styleAttr := getStyleAttribute(node.Payload); styleAttr != nil {
+		attrSheet = styleAttr
+		cssom.rulesTree.StoreStylesheetForHTMLNode(h, attrSheet, Attribute)
+	}
+	_, err := cssom.newStyleRun(nil, nil, nil).styleNode(node)
+	if attrSheet != nil { // style attributes apply to h only, we may drop them now
+		cssom.rulesTree.dropStylesheetForHTMLNode(h, attrSheet)
+	}
+	if err != nil {
+		return err
+	}
+	if err = visit(node, true); err != nil {
+		return err
+	}
+	if cssom.pruneHidden && hidesContents(node) {
+		return visit(node, false) // hidden node is visited as a stub
+	}
+	if cssom.isPreservedForeign(node) {
+		return visit(node, false) // foreign content is visited as a stub
+	}
+	if h.Type == html.ElementNode || h.Type == html.DocumentNode {
+		for ch := h.FirstChild; ch != nil; ch = ch.NextSibling {
+			if ch.DataAtom == atom.Style || !cssom.inDom(ch) {
+				continue
+			}
+			sn := styledtree.NewNodeForHTMLNode(ch)
+			node.AddChild(sn)
+			err = cssom.streamNode(sn, visit)
+			sn.Isolate() // release the subtree
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return visit(node, false)
+}
+
+// dropStylesheetForHTMLNode removes a style sheet previously registered for an
+// HTML node. Other style sheets registered for h are kept.
+func (rt rulesTreeType) dropStylesheetForHTMLNode(h *html.Node, sheet StyleSheet) {
+	h = rt.scopeKey(h)
+	sheets := rt.StylesheetsForHTMLNode(h)
+	kept := make([]stylesheetType, 0, len(sheets))
+	for _, s := range sheets {
+		if s.stylesheet != sheet {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == 0 {
+		rt.stylesheets.Delete(h)
+	} else {
+		rt.stylesheets.Store(h, kept)
+	}
+}
@@ -1,6 +1,10 @@
 package cssom
 
-import "github.com/npillmayer/fp/dom/style"
+import (
+	"fmt"
+
+	"github.com/npillmayer/fp/dom/style"
+)
 
 // StyleSheet is an interface to abstract away a stylesheet-implementation.
 // In order to de-couple implementations of CSS-stylesheets from the
@@ -26,8 +30,52 @@ type StyleSheet interface {
 //
 // See interface StyleSheet.
 type Rule interface {
-	Selector() string            // the prelude / selectors of the rule
-	Properties() []string        // property keys, e.g. "margin-top"
-	Value(string) style.Property // property value for key, e.g. "15px"
-	IsImportant(string) bool     // is property key marked as important?
+	Selector() string               // the prelude / selectors of the rule
+	Properties() []string           // property keys, e.g. "margin-top"
+	Value(string) style.Property    // property value for key, e.g. "15px"
+	IsImportant(string) bool        // is property key marked as important?
+	SourcePosition() SourcePosition // position of the rule in its style sheet, may be unknown
+}
+
+// SourcePosition is the position of a rule within the source text of its
+// style sheet, enabling tools like editors to jump to the rule. Lines and
+// columns start at 1, columns count characters (not bytes). Line 0 denotes an
+// unknown position, e.g. for rules created from style attributes.
+type SourcePosition struct {
+	URL    string // location of the style sheet; empty for <style> elements and unnamed sheets
+	Line   int    // line of the start of the rule's prelude
+	Column int    // column of the start of the rule's prelude
+}
+
+// Known is a predicate wether a source position has been set.
+func (pos SourcePosition) Known() bool {
+	return pos.Line > 0
+}
+
+// String returns a source position in the usual format "url:line:column".
+func (pos SourcePosition) String() string {
+	if !pos.Known() {
+		return "-"
+	}
+	if pos.URL == "" {
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", pos.URL, pos.Line, pos.Column)
+}
+
+// AtRule may be implemented by rules to tell at-rules, e.g. @font-face or
+// @media, from qualified rules. At-rules never match nodes; the CSSOM
+// interprets some of them itself (see CSSOM.FontFaces). Rules not
+// implementing AtRule are treated as qualified rules.
+type AtRule interface {
+	Rule
+	AtKeyword() string // at-keyword including '@', e.g. "@font-face"; empty for qualified rules
+}
+
+// atKeyword returns the at-keyword of a rule, or "" for qualified rules.
+func atKeyword(rule Rule) string {
+	if at, ok := rule.(AtRule); ok {
+		return at.AtKeyword()
+	}
+	return ""
 }
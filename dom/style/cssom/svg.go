@@ -0,0 +1,150 @@
+package cssom
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/npillmayer/fp/dom/style"
+	"golang.org/x/net/html"
+)
+
+// --- Registry of stylable elements ------------------------------------
+
+// Namespaces for foreign content, as set by the HTML parser.
+const (
+	NamespaceHTML   = ""
+	NamespaceSVG    = "svg"
+	NamespaceMathML = "math"
+)
+
+// elementRegistry holds the elements which will receive styles.
+// HTML elements are recognized by a fixed set of atoms. Elements from foreign
+// namespaces (e.g., inline SVG) are registered either one by one or as a
+// complete namespace.
+type elementRegistry struct {
+	sync.RWMutex
+	namespaces map[string]bool            // all elements of a namespace are stylable
+	elements   map[string]map[string]bool // namespace → element name → stylable
+}
+
+func newElementRegistry() *elementRegistry {
+	reg := &elementRegistry{
+		namespaces: make(map[string]bool),
+		elements:   make(map[string]map[string]bool),
+	}
+	reg.namespaces[NamespaceSVG] = true // inline SVG is stylable by default
+	return reg
+}
+
+// clone returns a copy of a registry, which may be changed independently.
+func (reg *elementRegistry) clone() *elementRegistry {
+	reg.RLock()
+	defer reg.RUnlock()
+	c := &elementRegistry{
+		namespaces: make(map[string]bool, len(reg.namespaces)),
+		elements:   make(map[string]map[string]bool, len(reg.elements)),
+	}
+	for ns := range reg.namespaces {
+		c.namespaces[ns] = true
+	}
+	for ns, elements := range reg.elements {
+		c.elements[ns] = make(map[string]bool, len(elements))
+		for e := range elements {
+			c.elements[ns][e] = true
+		}
+	}
+	return c
+}
+
+func (reg *elementRegistry) registerNamespace(namespace string) {
+	reg.Lock()
+	defer reg.Unlock()
+	reg.namespaces[namespace] = true
+}
+
+func (reg *elementRegistry) registerElement(namespace string, element string) {
+	reg.Lock()
+	defer reg.Unlock()
+	if reg.elements[namespace] == nil {
+		reg.elements[namespace] = make(map[string]bool)
+	}
+	reg.elements[namespace][element] = true
+}
+
+// isStylable is a predicate wether styles should be created for an HTML node.
+func (reg *elementRegistry) isStylable(h *html.Node) bool {
+	if h.Namespace == NamespaceHTML && isStylable(h.DataAtom) {
+		return true
+	}
+	reg.RLock()
+	defer reg.RUnlock()
+	if reg.namespaces[h.Namespace] {
+		return true
+	}
+	return reg.elements[h.Namespace][h.Data]
+}
+
+// RegisterStylableNamespace tells the CSSOM to create styles for all
+// elements of a namespace. Namespaces are the ones set by the HTML parser
+// for foreign content, e.g. "svg" or "math". Inline SVG is stylable by
+// default.
+func (cssom *CSSOM) RegisterStylableNamespace(namespace string) {
+	cssom.stylable.registerNamespace(namespace)
+}
+
+// RegisterStylableElement tells the CSSOM to create styles for an element.
+// Use namespace NamespaceHTML for custom HTML elements, which otherwise
+// will not receive any styles.
+func (cssom *CSSOM) RegisterStylableElement(namespace string, element string) {
+	if namespace == NamespaceHTML {
+		element = strings.ToLower(element) // the HTML parser lower-cases element names
+	}
+	cssom.stylable.registerElement(namespace, element)
+}
+
+// --- SVG presentation attributes --------------------------------------
+
+// svgPresentationAttributes are SVG attributes which double as CSS properties.
+// See https://www.w3.org/TR/SVG2/styling.html#PresentationAttributes
+var svgPresentationAttributes = map[string]bool{
+	"color":            true,
+	"display":          true,
+	"fill":             true,
+	"fill-opacity":     true,
+	"fill-rule":        true,
+	"font-family":      true,
+	"font-size":        true,
+	"font-style":       true,
+	"font-weight":      true,
+	"opacity":          true,
+	"stop-color":       true,
+	"stop-opacity":     true,
+	"stroke":           true,
+	"stroke-dasharray": true,
+	"stroke-linecap":   true,
+	"stroke-linejoin":  true,
+	"stroke-opacity":   true,
+	"stroke-width":     true,
+	"text-anchor":      true,
+	"visibility":       true,
+}
+
+// getPresentationAttributes collects the presentation attributes of an SVG
+// element into a local pseudo rule. Presentation attributes have the lowest
+// author-level specifity, i.e., they are overridden by every other author rule.
+// Returns nil if h is not an SVG element or has no presentation attributes.
+func getPresentationAttributes(h *html.Node) Rule {
+	if h == nil || h.Type != html.ElementNode || h.Namespace != NamespaceSVG {
+		return nil
+	}
+	var rule localPseudoRuleType
+	for _, attr := range h.Attr {
+		if attr.Namespace == "" && svgPresentationAttributes[attr.Key] {
+			rule = append(rule, style.KeyValue{Key: attr.Key, Value: style.Property(attr.Val)})
+		}
+	}
+	if len(rule) == 0 {
+		return nil
+	}
+	return rule
+}
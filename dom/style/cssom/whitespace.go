@@ -0,0 +1,124 @@
+package cssom
+
+import (
+	"strings"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/dom/style/css"
+	"github.com/npillmayer/fp/dom/styledtree"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// --- Inter-element whitespace -----------------------------------------
+
+// SetDropInterElementWhitespace sets whether whitespace-only text nodes between
+// block-level elements are dropped from the styled tree. HTML sources are
+// usually indented, and the parser keeps every line break and indentation
+// between elements as a text node. For elements with a white-space value
+// of normal or nowrap, such whitespace collapses away during layout, thus
+// dropping it keeps the styled tree small. Dropping is off by default.
+//
+// A whitespace-only text node is dropped if
+//
+//     - the computed white-space of its parent is normal or nowrap, and it is
+//       not enclosed by a <pre>, <textarea>, <listing> or <xmp> element
+//     - its preceding and following siblings are block-level elements,
+//       or missing for a block-level parent
+//
+// Siblings with display: none are skipped when looking for neighbours, and text
+// nodes count as inline-level. Whitespace between inline-level content, as in
+// `<b>Hello</b> <i>World</i>`, separates words and is always kept.
+//
+// Whitespace is dropped after styling by Style(…), not by StyleStream(…).
+// Dropped text nodes are removed from the HTML parse tree as well.
+//
+// It must not be called concurrently with calls to Style(…).
+func (cssom *CSSOM) SetDropInterElementWhitespace(drop bool) {
+	cssom.dropWhitespace = drop
+}
+
+// dropInterElementWhitespace removes whitespace-only text nodes between
+// block-level boxes from a styled subtree, see SetDropInterElementWhitespace.
+func dropInterElementWhitespace(node *tree.Node[*styledtree.StyNode]) {
+	var drop []*tree.Node[*styledtree.StyNode]
+	collectInterElementWhitespace(node, false, &drop)
+	if len(drop) > 0 {
+		tracer().Debugf("Dropping %d whitespace-only text nodes", len(drop))
+	}
+	for _, ws := range drop {
+		styledtree.Node(ws.Parent()).RemoveSubtree(ws)
+	}
+}
+
+// collectInterElementWhitespace collects whitespace to drop from the subtree of
+// node. preformatted is true for nodes enclosed by elements preserving
+// whitespace by default.
+func collectInterElementWhitespace(node *tree.Node[*styledtree.StyNode], preformatted bool,
+	drop *[]*tree.Node[*styledtree.StyNode]) {
+	//
+	children := node.Children(true)
+	if len(children) == 0 {
+		return
+	}
+	switch node.Payload.HTMLNode().DataAtom {
+	case atom.Pre, atom.Textarea, atom.Listing, atom.Xmp:
+		preformatted = true
+	}
+	collapsing := false
+	if ws, err := css.GetComputedProperty(node.Payload, "white-space"); err == nil && !preformatted {
+		collapsing = ws == "normal" || ws == "nowrap"
+	}
+	blockParent := isBlockLevel(displayOf(node))
+	for i, ch := range children {
+		if collapsing && isWhitespaceText(ch) &&
+			blockBoundary(children, i, -1, blockParent) && blockBoundary(children, i, +1, blockParent) {
+			*drop = append(*drop, ch)
+			continue
+		}
+		collectInterElementWhitespace(ch, preformatted, drop)
+	}
+}
+
+// blockBoundary is true if the neighbour of children[i] in direction dir is a
+// block-level element, or if there is none and the parent is block-level.
+func blockBoundary(children []*tree.Node[*styledtree.StyNode], i, dir int, blockParent bool) bool {
+	for j := i + dir; j >= 0 && j < len(children); j += dir {
+		switch children[j].Payload.HTMLNode().Type {
+		case html.TextNode:
+			return false
+		case html.CommentNode:
+			continue // comments do not separate text from blocks
+		}
+		if d := displayOf(children[j]); d != "none" {
+			return isBlockLevel(d)
+		}
+	}
+	return blockParent
+}
+
+// displayOf returns the computed display property of a styled node.
+func displayOf(node *tree.Node[*styledtree.StyNode]) style.Property {
+	h := node.Payload.HTMLNode()
+	if h.Type == html.DocumentNode {
+		return "block"
+	}
+	d, err := css.GetComputedProperty(node.Payload, "display")
+	if err != nil || d.IsEmpty() {
+		return style.DisplayPropertyForHTMLNode(h)
+	}
+	return d
+}
+
+// isBlockLevel is true for display values generating block-level boxes. Values
+// of the form "block-inline" denote block-level boxes with inline content.
+func isBlockLevel(display style.Property) bool {
+	d := string(display)
+	return d != "none" && d != "contents" && !strings.HasPrefix(d, "inline")
+}
+
+func isWhitespaceText(node *tree.Node[*styledtree.StyNode]) bool {
+	h := node.Payload.HTMLNode()
+	return h.Type == html.TextNode && strings.Trim(h.Data, " \t\n\r\f") == ""
+}
@@ -0,0 +1,253 @@
+package style
+
+/*
+License
+
+Governed by a 3-Clause BSD license. License file may be found in the root
+folder of this module.
+
+Copyright © 2017–2022 Norbert Pillmayer <norbert@pillmayer.com>
+
+*/
+
+import (
+	"sort"
+	"strings"
+)
+
+// --- Parsing of CSS declarations ---------------------------------------
+
+// ParseDeclarations parses a list of CSS declarations, as found in a style
+// attribute, e.g.
+//
+//     margin: 10pt 0; background: url("a;b.png")
+//
+// Declarations are separated by semicolons outside of quotes and parentheses.
+// Keys are lower-cased, and white space around keys and values is trimmed.
+// Ill-formed declarations, i.e. declarations without a colon or without a
+// key, are skipped.
+func ParseDeclarations(text string) []KeyValue {
+	var decls []KeyValue
+	for _, decl := range SplitOutsideStrings(text, ';') {
+		decl = strings.TrimSpace(decl)
+		if decl == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(decl, ":")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !ok || k == "" {
+			tracer().Errorf("Skipping ill-formed style declaration: %s", decl)
+			continue
+		}
+		decls = append(decls, KeyValue{Key: k, Value: Property(strings.TrimSpace(v))})
+	}
+	return decls
+}
+
+// SplitOutsideStrings splits s at every occurence of separator c which is
+// neither part of a string nor enclosed in parentheses, e.g. within url(…).
+func SplitOutsideStrings(s string, c byte) []string {
+	var parts []string
+	start := 0
+	for i := IndexOutsideStrings(s, c, 0); i >= 0; i = IndexOutsideStrings(s, c, start) {
+		parts = append(parts, s[start:i])
+		start = i + 1
+	}
+	return append(parts, s[start:])
+}
+
+// IndexOutsideStrings returns the position of the first occurence of c in s,
+// starting at from, which is neither part of a string nor enclosed in
+// parentheses. Returns -1 if there is none.
+func IndexOutsideStrings(s string, c byte, from int) int {
+	parens := 0
+	for i := from; i < len(s); i++ {
+		switch s[i] {
+		case c:
+			if parens == 0 {
+				return i
+			}
+		case '"', '\'':
+			i = SkipString(s, i) - 1
+		case '(':
+			parens++
+		case ')':
+			if parens > 0 {
+				parens--
+			}
+		}
+	}
+	return -1
+}
+
+// SkipString returns the position following a quoted string starting at s[i],
+// or len(s) for unterminated strings.
+func SkipString(s string, i int) int {
+	quote := s[i]
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// Unquote removes the quotes from a CSS string, unescaping escaped quotes.
+// Returns false if s is not quoted.
+func Unquote(s string) (string, bool) {
+	if len(s) < 2 || (s[0] != '"' && s[0] != '\'') || s[len(s)-1] != s[0] {
+		return s, false
+	}
+	return strings.ReplaceAll(s[1:len(s)-1], `\`+s[:1], s[:1]), true
+}
+
+// --- Serialization to CSS text ----------------------------------------
+
+// CssText serializes the properties of a property map to CSS declarations,
+// e.g.
+//
+//     margin: 10pt 0; color: red;
+//
+// Only properties set locally are serialized, i.e., no cascading is performed.
+// Longhand properties are re-combined into canonical shorthands where possible.
+// Groups are serialized in the order of their names. Within a group, shorthands
+// come first, followed by the remaining properties in the order of their keys.
+// A nil or empty property map results in an empty string.
+func (pmap *PropertyMap) CssText() string {
+	var b strings.Builder
+	for _, g := range pmap.Groups() {
+		if t := g.CssText(); t != "" {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(t)
+		}
+	}
+	return b.String()
+}
+
+// CssText serializes the properties of a property group to CSS declarations.
+// Longhand properties are re-combined into canonical shorthands where possible.
+// Parent groups are not considered. Empty properties are omitted.
+//
+// See PropertyMap.CssText.
+func (pg *PropertyGroup) CssText() string {
+	if pg == nil || pg.len() == 0 {
+		return ""
+	}
+	props := make(map[string]Property, pg.len())
+	pg.each(func(k string, v Property) {
+		if !v.IsEmpty() {
+			props[k] = v
+		}
+	})
+	var decls []KeyValue
+	decls = combineBorder(props, decls)
+	for _, sh := range shorthands {
+		decls = combineShorthand(props, sh.key, sh.longhands, decls)
+	}
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		decls = append(decls, KeyValue{k, props[k]})
+	}
+	var b strings.Builder
+	for i, kv := range decls {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(kv.Key)
+		b.WriteString(": ")
+		b.WriteString(kv.Value.String())
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+// shorthands lists the shorthand properties we are able to re-combine from
+// four longhands. Longhands are given in the order CSS expects the values for
+// the shorthand.
+var shorthands = []struct {
+	key       string
+	longhands [4]string
+}{
+	{"margin", fourLonghands("margin", "", fourDirs)},
+	{"padding", fourLonghands("padding", "", fourDirs)},
+	{"border-color", fourLonghands("border", "color", fourDirs)},
+	{"border-style", fourLonghands("border", "style", fourDirs)},
+	{"border-width", fourLonghands("border", "width", fourDirs)},
+	{"border-radius", fourLonghands("border", "radius", fourCorners)},
+}
+
+func fourLonghands(pre string, suf string, dirs [4]string) [4]string {
+	var keys [4]string
+	for i, d := range dirs {
+		keys[i] = p(pre, suf, d)
+	}
+	return keys
+}
+
+// combineShorthand appends a shorthand declaration to decls, if all four
+// longhands are present in props. The longhands are removed from props.
+func combineShorthand(props map[string]Property, key string, longhands [4]string,
+	decls []KeyValue) []KeyValue {
+	//
+	var v [4]Property
+	for i, k := range longhands {
+		var ok bool
+		if v[i], ok = props[k]; !ok {
+			return decls
+		}
+	}
+	for _, k := range longhands {
+		delete(props, k)
+	}
+	return append(decls, KeyValue{key, Property(strings.Join(minimizeFour(v), " "))})
+}
+
+// minimizeFour is the inverse of the distribution performed by feazeCompound4:
+// it returns the shortest list of values which expands to v.
+func minimizeFour(v [4]Property) []string {
+	s := []string{v[0].String(), v[1].String(), v[2].String(), v[3].String()}
+	if v[3] != v[1] {
+		return s
+	}
+	if v[2] != v[0] {
+		return s[:3]
+	}
+	if v[1] != v[0] {
+		return s[:2]
+	}
+	return s[:1]
+}
+
+// combineBorder appends a "border" shorthand declaration to decls, if width,
+// style and color are each uniform for all four sides. The longhands are
+// removed from props.
+func combineBorder(props map[string]Property, decls []KeyValue) []KeyValue {
+	var values []string
+	for _, suf := range []string{"width", "style", "color"} {
+		v, ok := props[p("border", suf, fourDirs[0])]
+		if !ok {
+			return decls
+		}
+		for _, d := range fourDirs[1:] {
+			if w, ok := props[p("border", suf, d)]; !ok || w != v {
+				return decls
+			}
+		}
+		values = append(values, v.String())
+	}
+	for _, suf := range []string{"width", "style", "color"} {
+		for _, d := range fourDirs {
+			delete(props, p("border", suf, d))
+		}
+	}
+	return append(decls, KeyValue{"border", Property(strings.Join(values, " "))})
+}
@@ -18,6 +18,9 @@ var nonInherited = map[string]string{
 	"border-bottom-color": "default",
 	"flow-from":           "none",
 	"flow-into":           "none",
+	"overflow":            "visible",
+	"contain":             "none",
+	"content-visibility":  "visible",
 }
 
 var isDimension = map[string]string{
@@ -75,33 +78,24 @@ func GetUserAgentDefaultProperty(node *html.Node, key string) Property {
 	return p
 }
 
-// DisplayPropertyForHTMLNode returns the default `display` CSS property for an HTML node.
-func DisplayPropertyForHTMLNode(node *html.Node) Property {
-	if node == nil {
-		return "none"
-	}
-	if node.Type == html.DocumentNode {
-		return "block"
+// InitialValue returns the initial value of a CSS property, as defined by the
+// CSS specification, independent of any HTML element. Contrary to
+// GetUserAgentDefaultProperty, the initial value of "display" is "inline" for
+// every element.
+//
+// Returns NullStyle for properties without a built-in initial value; for those the
+// default style properties at the root of the styled tree hold the initial value.
+func InitialValue(key string) Property {
+	if key == "display" {
+		return "inline"
 	}
-	if node.Type != html.ElementNode {
-		tracer().Debugf("cannot get display-property for non-element")
-		return "none"
+	if dim, ok := isDimension[key]; ok {
+		return Property(dim)
 	}
-	switch node.Data {
-	case "head":
-		return "none"
-	case "p":
-		return "block-inline"
-	case "html", "aside", "body", "div", "h1", "h2", "h3",
-		"h4", "h5", "h6", "it", "ol", "section",
-		"ul":
-		return "block"
-	case "i", "b", "span", "strong":
-		return "inline"
+	if p, ok := nonInherited[key]; ok {
+		return Property(p)
 	}
-	tracer().Infof("unknown HTML element %s/%d will be set to display: block",
-		node.Data, node.Type)
-	return "block"
+	return NullStyle
 }
 
 // InitializeDefaultPropertyValues creates an internal data structure to
@@ -117,6 +111,16 @@ func InitializeDefaultPropertyValues(additionalProps []KeyValue) *PropertyMap {
 	}
 	m[PGX] = x
 
+	for _, ns := range PropertyNamespaces() { // groups for custom properties
+		if m[ns.Group] == nil {
+			m[ns.Group] = NewPropertyGroup(ns.Group)
+			m[ns.Group].Parent = root
+		}
+		for _, kv := range ns.Defaults {
+			m[ns.Group].Set(kv.Key, kv.Value)
+		}
+	}
+
 	margins := NewPropertyGroup(PGMargins)
 	margins.Set("margin-top", "0")
 	margins.Set("margin-left", "0")
@@ -160,6 +164,7 @@ func InitializeDefaultPropertyValues(additionalProps []KeyValue) *PropertyMap {
 	dimension.Set("min-height", "none")
 	dimension.Set("max-width", "none")
 	dimension.Set("max-height", "none")
+	dimension.Set("aspect-ratio", "auto")
 	dimension.Parent = root
 	m[PGDimension] = dimension
 
@@ -174,6 +179,9 @@ func InitializeDefaultPropertyValues(additionalProps []KeyValue) *PropertyMap {
 	display.Set("float", "none")
 	display.Set("visibility", "visible")
 	display.Set("position", "static")
+	display.Set("overflow", "visible")
+	display.Set("contain", "none")
+	display.Set("content-visibility", "visible")
 	display.Parent = root
 	m[PGDisplay] = display
 
@@ -190,10 +198,41 @@ func InitializeDefaultPropertyValues(additionalProps []KeyValue) *PropertyMap {
 	text.Set("letter-spacing", "normal")
 	text.Set("word-break", "normal")
 	text.Set("overflow-wrap", "normal")
-	text.Set("hyphens", "manual")
 	text.Parent = root
 	m[PGText] = text
 
+	paragraph := NewPropertyGroup(PGParagraph)
+	paragraph.Set("text-align", "start")
+	paragraph.Set("text-align-last", "auto")
+	paragraph.Set("text-indent", "0")
+	paragraph.Set("hyphens", "manual")
+	paragraph.Set("hyphenate-character", "auto")
+	paragraph.Set("tab-size", "8")
+	paragraph.Parent = root
+	m[PGParagraph] = paragraph
+
+	svg := NewPropertyGroup(PGSvg)
+	svg.Set("fill", "black")
+	svg.Set("fill-opacity", "1")
+	svg.Set("fill-rule", "nonzero")
+	svg.Set("stroke", "none")
+	svg.Set("stroke-width", "1")
+	svg.Set("stroke-opacity", "1")
+	svg.Set("stroke-linecap", "butt")
+	svg.Set("stroke-linejoin", "miter")
+	svg.Set("stroke-dasharray", "none")
+	svg.Set("stop-color", "black")
+	svg.Set("stop-opacity", "1")
+	svg.Parent = root
+	m[PGSvg] = svg
+
+	image := NewPropertyGroup(PGImage)
+	image.Set("object-fit", "fill")
+	image.Set("object-position", "50% 50%")
+	image.Set("image-rendering", "auto")
+	image.Parent = root
+	m[PGImage] = image
+
 	/*
 	   type DisplayStyle struct {
 	   	Display    uint8 // https://www.tutorialrepublic.com/css-reference/css-display-property.php
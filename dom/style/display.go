@@ -0,0 +1,126 @@
+package style
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// --- User-agent defaults for property "display" -----------------------
+
+// displayRegistry maps HTML elements and HTMLBook data-types to their
+// user-agent default for property "display".
+type displayRegistry struct {
+	sync.RWMutex
+	elements  map[string]Property // element name → display
+	dataTypes map[string]Property // value of attribute data-type → display
+}
+
+var uaDisplay = &displayRegistry{
+	elements:  make(map[string]Property),
+	dataTypes: make(map[string]Property),
+}
+
+func init() {
+	for display, elements := range map[Property][]string{
+		"none": {"area", "base", "basefont", "datalist", "head", "link", "meta",
+			"noembed", "noframes", "param", "rp", "script", "style", "template", "title"},
+		"block": {"html", "body", "address", "article", "aside", "blockquote", "center",
+			"dd", "details", "dialog", "dir", "div", "dl", "dt", "fieldset", "figcaption",
+			"figure", "footer", "form", "frame", "frameset", "h1", "h2", "h3", "h4", "h5",
+			"h6", "header", "hgroup", "hr", "legend", "listing", "main", "menu", "nav",
+			"ol", "optgroup", "option", "plaintext", "pre", "search", "section", "summary",
+			"ul", "xmp",
+			// table-internal display modes are not supported yet
+			"caption", "col", "colgroup", "tbody", "td", "tfoot", "th", "thead", "tr"},
+		"block-inline": {"p"}, // block containing inline content
+		"inline-block": {"button", "input", "meter", "progress", "select", "textarea"},
+		"list-item":    {"li"},
+		"table":        {"table"},
+	} {
+		for _, e := range elements {
+			uaDisplay.elements[e] = display
+		}
+	}
+	// HTMLBook, see https://oreillymedia.github.io/HTMLBook/
+	for display, dataTypes := range map[Property][]string{
+		"none": {"index-term"},
+		"block": {"book", "part", "chapter", "preface", "appendix", "afterword",
+			"colophon", "conclusion", "dedication", "foreword", "glossary",
+			"introduction", "acknowledgments", "bibliography", "index", "halftitlepage",
+			"titlepage", "copyright-page", "toc", "sect1", "sect2", "sect3", "sect4",
+			"sect5", "sidebar", "note", "warning", "tip", "caution", "important",
+			"example", "equation", "footnotes"},
+		"inline": {"footnote", "footnoteref", "xref"},
+	} {
+		for _, dt := range dataTypes {
+			uaDisplay.dataTypes[dt] = display
+		}
+	}
+}
+
+// RegisterDisplayForElement sets the user-agent default for property "display"
+// of an HTML element, replacing a previous setting. Embedders may use it for
+// custom elements, which otherwise display inline, as demanded by CSS.
+//
+// Defaults have to be registered before documents are styled.
+func RegisterDisplayForElement(element string, display Property) {
+	uaDisplay.Lock()
+	defer uaDisplay.Unlock()
+	uaDisplay.elements[strings.ToLower(element)] = display
+}
+
+// RegisterDisplayForDataType sets the user-agent default for property "display"
+// of elements with an HTMLBook data-type attribute, e.g. data-type="sidebar",
+// replacing a previous setting. Data-types take precedence over element names.
+//
+// Defaults have to be registered before documents are styled.
+func RegisterDisplayForDataType(dataType string, display Property) {
+	uaDisplay.Lock()
+	defer uaDisplay.Unlock()
+	uaDisplay.dataTypes[dataType] = display
+}
+
+// DisplayPropertyForHTMLNode returns the default `display` CSS property for an HTML node.
+//
+// Elements carrying a `hidden` attribute are not displayed. Otherwise the display
+// mode registered for the element's data-type attribute, if any, wins over the
+// display mode registered for the element. Unknown elements and elements of
+// foreign content (e.g., SVG) display inline.
+func DisplayPropertyForHTMLNode(node *html.Node) Property {
+	if node == nil {
+		return "none"
+	}
+	if node.Type == html.DocumentNode {
+		return "block"
+	}
+	if node.Type != html.ElementNode {
+		tracer().Debugf("cannot get display-property for non-element")
+		return "none"
+	}
+	var dataType string
+	for _, attr := range node.Attr {
+		if attr.Namespace != "" {
+			continue
+		}
+		switch attr.Key {
+		case "hidden":
+			return "none"
+		case "data-type":
+			dataType = attr.Val
+		}
+	}
+	uaDisplay.RLock()
+	defer uaDisplay.RUnlock()
+	if display, ok := uaDisplay.dataTypes[dataType]; ok && dataType != "" {
+		return display
+	}
+	if node.Namespace != "" {
+		return "inline"
+	}
+	if display, ok := uaDisplay.elements[node.Data]; ok {
+		return display
+	}
+	return "inline"
+}
@@ -0,0 +1,116 @@
+package style
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// --- Custom Property Namespaces ---------------------------------------
+
+// PropertyNamespace describes a family of custom or vendor-specific properties,
+// identified by a common key prefix, e.g. "-tyse-" or "x-". Properties of a
+// namespace are held in a property group of their own, instead of ending up
+// in the catch-all group "X".
+//
+// If Validate is non-nil, it is called for every value set for a property of
+// the namespace during styling. Values for which Validate returns an error are
+// dropped.
+type PropertyNamespace struct {
+	Prefix    string                                 // key prefix, e.g. "-tyse-"
+	Group     string                                 // name of the property group
+	Inherited bool                                   // properties of the namespace are inherited
+	Defaults  []KeyValue                             // initial values for properties of the namespace
+	Validate  func(key string, value Property) error // optional validation of values
+}
+
+type namespaceRegistry struct {
+	sync.RWMutex
+	namespaces []PropertyNamespace
+}
+
+var propertyNamespaces = &namespaceRegistry{}
+
+// RegisterPropertyNamespace registers a namespace for custom properties. Keys of
+// properties are matched against the namespace prefixes, with the longest
+// prefix winning. Properties known to this package, such as "margin-top", never
+// belong to a namespace.
+//
+// Namespaces must be registered before a CSSOM is created, as property groups
+// for namespaces are set up during initialization of default property values
+// (see InitializeDefaultPropertyValues).
+//
+// Returns an error if either prefix or group is empty, if group is the name of a
+// standard property group, or if prefix has already been registered.
+func RegisterPropertyNamespace(ns PropertyNamespace) error {
+	if ns.Prefix == "" || ns.Group == "" {
+		return fmt.Errorf("property namespace must have a prefix and a group name")
+	}
+	switch ns.Group {
+	case PGMargins, PGPadding, PGBorder, PGDimension, PGDisplay, PGRegion, PGColor,
+		PGText, PGParagraph, PGSvg, PGImage, PGX:
+		return fmt.Errorf("property group %s is a standard group", ns.Group)
+	}
+	propertyNamespaces.Lock()
+	defer propertyNamespaces.Unlock()
+	for _, other := range propertyNamespaces.namespaces {
+		if other.Prefix == ns.Prefix {
+			return fmt.Errorf("property namespace %s already registered", ns.Prefix)
+		}
+	}
+	propertyNamespaces.namespaces = append(propertyNamespaces.namespaces, ns)
+	return nil
+}
+
+// UnregisterPropertyNamespace removes the namespace with the given prefix.
+// Returns false if no namespace has been registered for prefix.
+func UnregisterPropertyNamespace(prefix string) bool {
+	propertyNamespaces.Lock()
+	defer propertyNamespaces.Unlock()
+	for i, ns := range propertyNamespaces.namespaces {
+		if ns.Prefix == prefix {
+			propertyNamespaces.namespaces = append(propertyNamespaces.namespaces[:i],
+				propertyNamespaces.namespaces[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PropertyNamespaces returns all registered property namespaces.
+func PropertyNamespaces() []PropertyNamespace {
+	propertyNamespaces.RLock()
+	defer propertyNamespaces.RUnlock()
+	return append([]PropertyNamespace(nil), propertyNamespaces.namespaces...)
+}
+
+// PropertyNamespaceFor returns the namespace a property key belongs to, if any.
+func PropertyNamespaceFor(key string) (PropertyNamespace, bool) {
+	if _, known := groupNameFromPropertyKey[key]; known {
+		return PropertyNamespace{}, false
+	}
+	propertyNamespaces.RLock()
+	defer propertyNamespaces.RUnlock()
+	var match PropertyNamespace
+	found := false
+	for _, ns := range propertyNamespaces.namespaces {
+		if strings.HasPrefix(key, ns.Prefix) && len(ns.Prefix) > len(match.Prefix) {
+			match, found = ns, true
+		}
+	}
+	return match, found
+}
+
+// ValidateProperty checks a property value with the validation callback of the
+// namespace key belongs to. Properties outside of namespaces and properties
+// of namespaces without a validation callback are always valid, as are the
+// CSS-wide keywords "initial", "inherit", "unset" and "revert".
+func ValidateProperty(key string, value Property) error {
+	if value.IsCSSWideKeyword() {
+		return nil
+	}
+	if ns, ok := PropertyNamespaceFor(key); ok && ns.Validate != nil {
+		return ns.Validate(key, value)
+	}
+	return nil
+}
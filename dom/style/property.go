@@ -12,6 +12,7 @@ Copyright © 2017–2022 Norbert Pillmayer <norbert@pillmayer.com>
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/npillmayer/schuko/tracing"
@@ -48,6 +49,26 @@ func (p Property) IsInherit() bool {
 	return p == "inherit"
 }
 
+// IsUnset denotes if a property is of inheritence-type "unset"
+func (p Property) IsUnset() bool {
+	return p == "unset"
+}
+
+// IsRevert denotes if a property is of inheritence-type "revert"
+func (p Property) IsRevert() bool {
+	return p == "revert"
+}
+
+// IsCSSWideKeyword is true for the keywords every CSS property accepts, i.e.
+// "initial", "inherit", "unset" and "revert".
+func (p Property) IsCSSWideKeyword() bool {
+	switch p {
+	case "initial", "inherit", "unset", "revert":
+		return true
+	}
+	return false
+}
+
 // IsEmpty checks wether a property is empty, i.e. the null-string.
 func (p Property) IsEmpty() bool {
 	return p == ""
@@ -61,7 +82,8 @@ type KeyValue struct {
 
 // --- CSS Property Groups ----------------------------------------------
 //
-// Caching is currently not implemented.
+// Property groups with identical content may be shared between nodes, see
+// GroupInterner.
 
 // PropertyGroup is a collection of propertes sharing a common topic.
 // CSS knows a whole lot of properties. We split them up into organisatorial
@@ -70,9 +92,9 @@ type KeyValue struct {
 // The mapping of property into groups is documented with
 // GroupNameFromPropertyKey[...].
 type PropertyGroup struct {
-	name      string
-	Parent    *PropertyGroup
-	propsDict map[string]Property
+	name   string
+	Parent *PropertyGroup
+	store  StyleStore // created on first write, see StoreBackendInUse
 }
 
 // NewPropertyGroup creates a new empty property group, given its name.
@@ -91,29 +113,27 @@ func (pg *PropertyGroup) Name() string {
 // Stringer for property groups; used for debugging.
 func (pg *PropertyGroup) String() string {
 	s := "[" + pg.name + "] =\n"
-	for k, v := range pg.propsDict {
+	pg.each(func(k string, v Property) {
 		s += fmt.Sprintf("  %s = %s\n", k, v)
-	}
+	})
 	return s
 }
 
 // Properties returns all properties of a group.
 func (pg *PropertyGroup) Properties() []KeyValue {
-	i := 0
-	r := make([]KeyValue, len(pg.propsDict))
-	for k, v := range pg.propsDict {
-		r[i] = KeyValue{k, v}
-		i++
-	}
+	r := make([]KeyValue, 0, pg.len())
+	pg.each(func(k string, v Property) {
+		r = append(r, KeyValue{k, v})
+	})
 	return r
 }
 
 // IsSet is a predicated wether a property is set within this group.
 func (pg *PropertyGroup) IsSet(key string) bool {
-	if pg.propsDict == nil {
+	if pg.store == nil {
 		return false
 	}
-	v, ok := pg.propsDict[key]
+	v, ok := pg.store.Get(key)
 	return ok && !v.IsEmpty()
 }
 
@@ -121,11 +141,10 @@ func (pg *PropertyGroup) IsSet(key string) bool {
 //
 // Style property values are always converted to lower case.
 func (pg *PropertyGroup) Get(key string) (Property, bool) {
-	if pg.propsDict == nil {
+	if pg.store == nil {
 		return NullStyle, false
 	}
-	p, ok := pg.propsDict[key]
-	return p, ok
+	return pg.store.Get(key)
 }
 
 // Set a property's value. Overwrites an existing value, if present.
@@ -133,52 +152,96 @@ func (pg *PropertyGroup) Get(key string) (Property, bool) {
 // Style property values are always converted to lower case.
 func (pg *PropertyGroup) Set(key string, p Property) {
 	p = Property(strings.ToLower(string(p)))
-	if pg.propsDict == nil {
-		pg.propsDict = make(map[string]Property)
+	if pg.store == nil {
+		pg.store = NewStyleStore(StoreBackendInUse())
 	}
-	pg.propsDict[key] = p
+	pg.store.Set(key, p)
 }
 
 // Add a property's value. Does not overwrite an existing value, i.e., does nothing
 // if a value is already set.
 func (pg *PropertyGroup) Add(key string, p Property) {
-	if pg.propsDict == nil {
-		pg.propsDict = make(map[string]Property)
+	if pg.store == nil {
+		pg.store = NewStyleStore(StoreBackendInUse())
+	}
+	if _, exists := pg.store.Get(key); !exists {
+		pg.store.Set(key, p)
 	}
-	_, exists := pg.propsDict[key]
-	if !exists {
-		pg.propsDict[key] = p
+}
+
+// Remove deletes a property from a group, returning its former value, if any.
+func (pg *PropertyGroup) Remove(key string) (Property, bool) {
+	if pg.store == nil {
+		return NullStyle, false
 	}
+	return pg.store.Remove(key)
 }
 
 // ForkOnProperty creates a new PropertyGroup, pre-filled with a given property.
-// If 'cascade' is true, the new PropertyGroup will be
-// linking to the ancesting PropertyGroup containing this property.
+// If 'cascade' is true, the new PropertyGroup will be linking to pg, thus
+// cascading to every ancestor group, not only to the one containing this
+// property. If the cascaded value equals p, no new group is created.
+//
+// Linking to pg keeps the inherited values of intermediate groups: a group
+// forked on "fill" from the group of an SVG <g stroke=...> has to cascade
+// "stroke" to <g>, not to the (older) group where "fill" has been set.
 func (pg *PropertyGroup) ForkOnProperty(key string, p Property, cascade bool) (*PropertyGroup, bool) {
-	var ancestor *PropertyGroup
+	var parent *PropertyGroup
 	if cascade {
-		ancestor = pg.Cascade(key)
+		ancestor := pg.Cascade(key)
 		if ancestor != nil {
 			p2, _ := ancestor.Get(key)
 			if p2 == p {
 				return pg, false
 			}
 		}
+		parent = pg
 	}
 	npg := NewPropertyGroup(pg.name)
-	npg.Parent = ancestor
-	//npg.signature = pg.signature
+	npg.Parent = parent
 	npg.Set(key, p)
 	return npg, true
 }
 
+// Clone creates a copy of a property group. The copy links to the same
+// parent group as pg and uses the same storage backend.
+func (pg *PropertyGroup) Clone() *PropertyGroup {
+	npg := NewPropertyGroup(pg.name)
+	npg.Parent = pg.Parent
+	if pg.store != nil {
+		npg.store = pg.store.Clone()
+	}
+	return npg
+}
+
+// each calls f for every property of a group, in no particular order.
+func (pg *PropertyGroup) each(f func(string, Property)) {
+	if pg.store != nil {
+		pg.store.Each(f)
+	}
+}
+
+// len returns the number of properties of a group.
+func (pg *PropertyGroup) len() int {
+	if pg.store == nil {
+		return 0
+	}
+	return pg.store.Len()
+}
+
 // Cascade finds the ancesting PropertyGroup containing the given property-key.
+// For custom properties of a namespace without an initial value, the topmost
+// ancestor is returned.
 func (pg *PropertyGroup) Cascade(key string) *PropertyGroup {
-	it := pg
+	it, top := pg, pg
 	for it != nil && !it.IsSet(key) { // stopper is default partial
+		top = it
 		it = it.Parent
 	}
 	if it == nil {
+		if _, ok := PropertyNamespaceFor(key); ok {
+			return top
+		}
 		panic(fmt.Sprintf("styling: no property group %s found with key '%s'", pg.name, key))
 	}
 	return it
@@ -189,10 +252,15 @@ func (pg *PropertyGroup) Cascade(key string) *PropertyGroup {
 // Example:
 //    GroupNameFromPropertyKey("margin-top") => "Margins"
 //
-// Unknown style property keys will return a group name of "X".
+// Keys of custom properties return the group of their namespace (see
+// RegisterPropertyNamespace). Other unknown style property keys will return
+// a group name of "X".
 func GroupNameFromPropertyKey(key string) string {
 	groupname, found := groupNameFromPropertyKey[key]
 	if !found {
+		if ns, ok := PropertyNamespaceFor(key); ok {
+			return ns.Group
+		}
 		groupname = "X"
 	}
 	return groupname
@@ -208,6 +276,9 @@ const (
 	PGRegion    = "Region"
 	PGColor     = "Color"
 	PGText      = "Text"
+	PGParagraph = "Paragraph"
+	PGSvg       = "SVG"
+	PGImage     = "Image"
 	PGX         = "X"
 )
 
@@ -242,10 +313,14 @@ var groupNameFromPropertyKey = map[string]string{
 	"min-height":                 "Dimension",
 	"max-width":                  "Dimension",
 	"max-height":                 "Dimension",
+	"aspect-ratio":               "Dimension",
 	"display":                    PGDisplay, // Display
 	"float":                      PGDisplay,
 	"visibility":                 PGDisplay,
 	"position":                   PGDisplay,
+	"overflow":                   PGDisplay,
+	"contain":                    PGDisplay,
+	"content-visibility":         PGDisplay,
 	"flow-into":                  PGRegion,
 	"flow-from":                  PGRegion,
 	"color":                      PGColor,
@@ -256,6 +331,26 @@ var groupNameFromPropertyKey = map[string]string{
 	"letter-spacing":             PGText,
 	"word-break":                 PGText,
 	"word-wrap":                  PGText,
+	"text-align":                 PGParagraph, // Paragraph
+	"text-align-last":            PGParagraph,
+	"text-indent":                PGParagraph,
+	"hyphens":                    PGParagraph,
+	"hyphenate-character":        PGParagraph,
+	"tab-size":                   PGParagraph,
+	"fill":                       PGSvg, // SVG
+	"fill-opacity":               PGSvg,
+	"fill-rule":                  PGSvg,
+	"stroke":                     PGSvg,
+	"stroke-width":               PGSvg,
+	"stroke-opacity":             PGSvg,
+	"stroke-linecap":             PGSvg,
+	"stroke-linejoin":            PGSvg,
+	"stroke-dasharray":           PGSvg,
+	"stop-color":                 PGSvg,
+	"stop-opacity":               PGSvg,
+	"object-fit":                 PGImage, // Image
+	"object-position":            PGImage,
+	"image-rendering":            PGImage,
 }
 
 // IsCascading returns wether the standard behaviour for a propery is to be
@@ -269,12 +364,64 @@ func IsCascading(key string) bool {
 		return true
 	case "letter-spacing", "line-height", "quotes", "visibility", "white-space":
 		return true
-	case "word-spacing", "word-break", "word-wrap":
+	case "word-spacing", "word-break", "word-wrap", "image-rendering":
+		return true
+	case "text-align", "text-align-last", "text-indent", "hyphens", "hyphenate-character", "tab-size":
 		return true
 	}
+	if strings.HasPrefix(key, "fill") || strings.HasPrefix(key, "stroke") {
+		return true // SVG painting properties are inherited
+	}
+	if ns, ok := PropertyNamespaceFor(key); ok {
+		return ns.Inherited
+	}
 	return false
 }
 
+// Longhands returns the individual properties a shorthand property sets, or nil
+// if key is not a shorthand property. Not all of the shorthands recognized by
+// Longhands can be split up by SplitCompoundProperty, e.g. "font".
+func Longhands(key string) []string {
+	return longhands[key]
+}
+
+// longhands maps shorthand properties to the individual properties they set.
+var longhands = map[string][]string{
+	"margin":        fourKeys("margin", "", fourDirs),
+	"padding":       fourKeys("padding", "", fourDirs),
+	"border-color":  fourKeys("border", "color", fourDirs),
+	"border-style":  fourKeys("border", "style", fourDirs),
+	"border-width":  fourKeys("border", "width", fourDirs),
+	"border-radius": fourKeys("border", "radius", fourCorners),
+	"border":        borderLonghands(fourDirs[:]...),
+	"border-top":    borderLonghands("top"),
+	"border-right":  borderLonghands("right"),
+	"border-bottom": borderLonghands("bottom"),
+	"border-left":   borderLonghands("left"),
+	"font": {"font-style", "font-variant", "font-weight", "font-stretch", "font-size",
+		"line-height", "font-family"},
+	"background": {"background-color", "background-image", "background-repeat",
+		"background-attachment", "background-position", "background-size",
+		"background-origin", "background-clip"},
+}
+
+// fourKeys returns the four longhands of a shorthand as a slice.
+func fourKeys(pre string, suf string, dirs [4]string) []string {
+	keys := fourLonghands(pre, suf, dirs)
+	return keys[:]
+}
+
+// borderLonghands returns the width, style and color properties of borders.
+func borderLonghands(sides ...string) []string {
+	keys := make([]string, 0, 3*len(sides))
+	for _, side := range sides {
+		for _, suf := range []string{"width", "style", "color"} {
+			keys = append(keys, p("border", suf, side))
+		}
+	}
+	return keys
+}
+
 // SplitCompoundProperty splits up a shortcut property into its individual
 // components. Returns a slice of key-value pairs representing the
 // individual (fine grained) style properties.
@@ -290,7 +437,7 @@ func IsCascading(key string) bool {
 func SplitCompoundProperty(key string, value Property) ([]KeyValue, error) {
 	fields := strings.Fields(value.String())
 	switch key {
-	case "margins":
+	case "margin":
 		return feazeCompound4("margin", "", fourDirs, fields)
 	case "padding":
 		return feazeCompound4("padding", "", fourDirs, fields)
@@ -301,7 +448,10 @@ func SplitCompoundProperty(key string, value Property) ([]KeyValue, error) {
 	case "border-style":
 		return feazeCompound4("border", "style", fourDirs, fields)
 	case "border-radius":
-		return feazeCompound4("border", "style", fourCorners, fields)
+		if strings.Contains(value.String(), "/") { // elliptical corners are not supported
+			break
+		}
+		return feazeCompound4("border", "radius", fourCorners, fields)
 	}
 	return nil, fmt.Errorf("not recognized as compound property: %s", key)
 }
@@ -337,7 +487,7 @@ func feazeCompound4(pre string, suf string, dirs [4]string, fields []string) ([]
 }
 
 var fourDirs = [4]string{"top", "right", "bottom", "left"}
-var fourCorners = [4]string{"top-right", "bottom-right", "bottom-left", "top-left"}
+var fourCorners = [4]string{"top-left", "top-right", "bottom-right", "bottom-left"}
 
 func p(prefix string, suffix string, tag string) string {
 	if suffix == "" {
@@ -390,6 +540,19 @@ func (pmap *PropertyMap) Group(groupname string) *PropertyGroup {
 	return group
 }
 
+// Groups returns all property groups of a property map, sorted by group name.
+func (pmap *PropertyMap) Groups() []*PropertyGroup {
+	if pmap == nil {
+		return nil
+	}
+	groups := make([]*PropertyGroup, 0, len(pmap.m))
+	for _, g := range pmap.m {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups
+}
+
 // Property returns a style property value, together with an indicator
 // wether it has been found in the properties map.
 // No cascading is performed
@@ -419,12 +582,100 @@ func (pmap *PropertyMap) AddAllFromGroup(group *PropertyGroup, overwrite bool) *
 	if g == nil {
 		pmap.m[group.name] = group
 	} else {
-		for k, v := range group.propsDict {
+		group.each(func(k string, v Property) {
 			if overwrite {
 				g.Set(k, v)
 			} else {
 				g.Add(k, v)
 			}
+		})
+	}
+	return pmap
+}
+
+// MergePolicy decides which value wins if two property maps are merged and
+// both of them set a property. Use one of OverwriteAll, KeepExisting or
+// HigherSpecificityWins(…).
+type MergePolicy struct {
+	kind               mergeKind
+	existing, incoming Specificities
+}
+
+type mergeKind uint8
+
+const (
+	mergeOverwrite mergeKind = iota
+	mergeKeep
+	mergeSpecificity
+)
+
+// Specificities holds the specifity of the properties of a property map,
+// indexed by property key. Missing keys have a specifity of 0.
+type Specificities map[string]uint32
+
+var (
+	// OverwriteAll lets properties of the incoming map win.
+	OverwriteAll = MergePolicy{kind: mergeOverwrite}
+	// KeepExisting lets properties of the receiving map win.
+	KeepExisting = MergePolicy{kind: mergeKeep}
+)
+
+// HigherSpecificityWins creates a merge policy which lets the property with
+// the higher specifity win. For equal specifity, the incoming property wins,
+// as does a later CSS rule.
+func HigherSpecificityWins(existing, incoming Specificities) MergePolicy {
+	return MergePolicy{kind: mergeSpecificity, existing: existing, incoming: incoming}
+}
+
+func (policy MergePolicy) overwrites(key string) bool {
+	switch policy.kind {
+	case mergeKeep:
+		return false
+	case mergeSpecificity:
+		return policy.incoming[key] >= policy.existing[key]
+	}
+	return true
+}
+
+// Merge transfers all style properties from other into a property map.
+// Properties set in both maps are resolved by policy. Empty properties of
+// other are ignored.
+//
+// Property maps may share property groups, thus Merge will never modify
+// a property group in place. Instead, a modified group is replaced by a
+// copy, linking to the same parent group. Groups not present in pmap are
+// shared with other.
+func (pmap *PropertyMap) Merge(other *PropertyMap, policy MergePolicy) *PropertyMap {
+	if pmap == nil {
+		pmap = NewPropertyMap()
+	}
+	if other == nil {
+		return pmap
+	}
+	if pmap.m == nil {
+		pmap.m = make(map[string]*PropertyGroup, len(other.m))
+	}
+	for name, group := range other.m {
+		g := pmap.m[name]
+		if g == nil {
+			pmap.m[name] = group
+			continue
+		}
+		var cow *PropertyGroup // copy of g, created on first modification
+		group.each(func(k string, v Property) {
+			if v.IsEmpty() {
+				return
+			}
+			if old, ok := g.Get(k); ok && (old == v || !old.IsEmpty() && !policy.overwrites(k)) {
+				return
+			}
+			if cow == nil {
+				cow = g.Clone()
+			}
+			cow.Set(k, v)
+		})
+		if cow != nil {
+			pmap.m[name] = cow
 		}
 	}
 	return pmap
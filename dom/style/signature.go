@@ -0,0 +1,120 @@
+package style
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// --- Structural sharing of property groups ----------------------------
+
+// Signature returns a hash of the content of a property group, i.e. of its name
+// and its properties. The parent group is not included. Groups with equal
+// content have equal signatures, but equal signatures do not guarantee equal
+// content.
+func (pg *PropertyGroup) Signature() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(pg.name))
+	props := pg.Properties()
+	sort.Slice(props, func(i, j int) bool { return props[i].Key < props[j].Key })
+	for _, kv := range props {
+		h.Write([]byte{0})
+		h.Write([]byte(kv.Key))
+		h.Write([]byte{'='})
+		h.Write([]byte(kv.Value))
+	}
+	return h.Sum64()
+}
+
+// SameContent is a predicate wether two property groups have the same name, the
+// same properties and link to the same parent group.
+func (pg *PropertyGroup) SameContent(other *PropertyGroup) bool {
+	if pg == other {
+		return true
+	}
+	if pg == nil || other == nil || pg.name != other.name || pg.Parent != other.Parent {
+		return false
+	}
+	if pg.len() != other.len() {
+		return false
+	}
+	same := true
+	pg.each(func(k string, v Property) {
+		if w, ok := other.Get(k); !ok || w != v {
+			same = false
+		}
+	})
+	return same
+}
+
+// GroupInterner de-duplicates property groups. Styling will create a new
+// property group for every node setting a property, even if a sibling carries
+// a group with identical content (think of consecutive paragraphs with
+// identical margins). Interning replaces such a group by the first one seen
+// with the same content and the same parent group.
+//
+// Interned groups are shared between property maps and must not be modified
+// in place. An interner may be used concurrently.
+type GroupInterner struct {
+	mx     sync.Mutex
+	groups map[internKey][]*PropertyGroup
+	stats  InternStats
+}
+
+type internKey struct {
+	parent    *PropertyGroup
+	signature uint64
+}
+
+// InternStats counts the property groups handed to an interner.
+type InternStats struct {
+	Seen   int // number of groups handed to Intern
+	Unique int // number of distinct groups kept
+}
+
+// NewGroupInterner creates an empty interner.
+func NewGroupInterner() *GroupInterner {
+	return &GroupInterner{groups: make(map[internKey][]*PropertyGroup)}
+}
+
+// Intern returns a group with the same content as pg. If such a group has been
+// interned before, it is returned instead of pg. If gi is nil, pg is returned.
+func (gi *GroupInterner) Intern(pg *PropertyGroup) *PropertyGroup {
+	if gi == nil || pg == nil {
+		return pg
+	}
+	key := internKey{pg.Parent, pg.Signature()}
+	gi.mx.Lock()
+	defer gi.mx.Unlock()
+	gi.stats.Seen++
+	for _, g := range gi.groups[key] {
+		if g.SameContent(pg) {
+			return g
+		}
+	}
+	gi.groups[key] = append(gi.groups[key], pg)
+	gi.stats.Unique++
+	return pg
+}
+
+// InternMap interns all property groups of a property map. Groups are replaced
+// in pmap, which is returned for convenience.
+func (gi *GroupInterner) InternMap(pmap *PropertyMap) *PropertyMap {
+	if gi == nil || pmap == nil {
+		return pmap
+	}
+	for name, g := range pmap.m {
+		pmap.m[name] = gi.Intern(g)
+	}
+	return pmap
+}
+
+// Stats returns the number of groups seen and kept by gi.
+func (gi *GroupInterner) Stats() InternStats {
+	if gi == nil {
+		return InternStats{}
+	}
+	gi.mx.Lock()
+	defer gi.mx.Unlock()
+	return gi.stats
+}
@@ -0,0 +1,249 @@
+package style
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// --- Storage backends for property groups -----------------------------
+
+// StyleStore is the storage for the property values of a property group.
+// Clients of this package access properties through PropertyMap and
+// PropertyGroup, which delegate to a StyleStore. This package provides two
+// backends (see StoreBackend):
+//
+//     MapBackend        a map with string keys (default)
+//     CompactBackend    an array of values, sorted by property IDs
+//
+// Styling creates a property group for nearly every node of a document,
+// thus the storage of groups dominates the memory used by a styled tree.
+// The compact backend trades a bit of lookup speed for memory.
+//
+// Stores are not safe for concurrent modification.
+type StyleStore interface {
+	Get(key string) (Property, bool)     // get a property value
+	Set(key string, p Property)          // set a property value, overwriting an existing one
+	Remove(key string) (Property, bool)  // remove a property, returning its former value
+	Len() int                            // number of properties stored
+	Each(f func(key string, p Property)) // call f for every property stored
+	Clone() StyleStore                   // create a copy using the same backend
+}
+
+// StoreBackend selects an implementation of StyleStore.
+type StoreBackend int32
+
+// Backends for property storage.
+const (
+	MapBackend     StoreBackend = iota // properties are held in maps with string keys
+	CompactBackend                     // properties are held in arrays indexed by property IDs
+)
+
+var storeBackend int32 // StoreBackend used for new property groups
+
+// SetStoreBackend selects the backend for property groups created from now on.
+// Existing groups keep their backend, as do copies of them. Usually clients
+// select a backend once, before creating a CSSOM.
+func SetStoreBackend(b StoreBackend) {
+	atomic.StoreInt32(&storeBackend, int32(b))
+}
+
+// StoreBackendInUse returns the backend for new property groups.
+func StoreBackendInUse() StoreBackend {
+	return StoreBackend(atomic.LoadInt32(&storeBackend))
+}
+
+// NewStyleStore creates an empty property store for a backend.
+func NewStyleStore(b StoreBackend) StyleStore {
+	if b == CompactBackend {
+		return &compactStore{}
+	}
+	return &mapStore{}
+}
+
+// --- Property IDs -----------------------------------------------------------
+
+// PropertyID is a small integer identifying a property key. IDs of properties
+// known to this package are assigned at initialization time, other keys (e.g.,
+// custom properties) receive an ID when first stored in a compact store.
+type PropertyID uint16
+
+type propertyIDRegistry struct {
+	sync.RWMutex
+	ids  map[string]PropertyID
+	keys []string
+}
+
+var propertyIDs = newPropertyIDRegistry()
+
+func newPropertyIDRegistry() *propertyIDRegistry {
+	reg := &propertyIDRegistry{ids: make(map[string]PropertyID)}
+	keys := make([]string, 0, len(groupNameFromPropertyKey))
+	for k := range groupNameFromPropertyKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // IDs should not depend on map iteration order
+	for _, k := range keys {
+		reg.ids[k] = PropertyID(len(reg.keys))
+		reg.keys = append(reg.keys, k)
+	}
+	return reg
+}
+
+// PropertyIDFor returns the ID of a property key, assigning a new ID for an
+// unknown key.
+func PropertyIDFor(key string) PropertyID {
+	if id, ok := lookupPropertyID(key); ok {
+		return id
+	}
+	propertyIDs.Lock()
+	defer propertyIDs.Unlock()
+	if id, ok := propertyIDs.ids[key]; ok {
+		return id
+	}
+	id := PropertyID(len(propertyIDs.keys))
+	propertyIDs.ids[key] = id
+	propertyIDs.keys = append(propertyIDs.keys, key)
+	return id
+}
+
+// lookupPropertyID returns the ID of a property key, if one has been assigned.
+func lookupPropertyID(key string) (PropertyID, bool) {
+	propertyIDs.RLock()
+	defer propertyIDs.RUnlock()
+	id, ok := propertyIDs.ids[key]
+	return id, ok
+}
+
+// Key returns the property key for an ID.
+func (id PropertyID) Key() string {
+	propertyIDs.RLock()
+	defer propertyIDs.RUnlock()
+	if int(id) < len(propertyIDs.keys) {
+		return propertyIDs.keys[id]
+	}
+	return ""
+}
+
+// --- Map backend ------------------------------------------------------------
+
+type mapStore struct {
+	m map[string]Property
+}
+
+func (s *mapStore) Get(key string) (Property, bool) {
+	p, ok := s.m[key]
+	return p, ok
+}
+
+func (s *mapStore) Set(key string, p Property) {
+	if s.m == nil {
+		s.m = make(map[string]Property)
+	}
+	s.m[key] = p
+}
+
+func (s *mapStore) Remove(key string) (Property, bool) {
+	p, ok := s.m[key]
+	delete(s.m, key)
+	return p, ok
+}
+
+func (s *mapStore) Len() int {
+	return len(s.m)
+}
+
+func (s *mapStore) Each(f func(string, Property)) {
+	for k, v := range s.m {
+		f(k, v)
+	}
+}
+
+func (s *mapStore) Clone() StyleStore {
+	c := &mapStore{}
+	if s.m != nil {
+		c.m = make(map[string]Property, len(s.m))
+		for k, v := range s.m {
+			c.m[k] = v
+		}
+	}
+	return c
+}
+
+// --- Compact backend --------------------------------------------------------
+
+// compactStore holds properties in an array, sorted by property ID. Groups
+// hold a handful of properties at most, thus a binary search is cheap and
+// there is no per-entry overhead of a hash map.
+type compactStore struct {
+	entries []compactEntry
+}
+
+type compactEntry struct {
+	id    PropertyID
+	value Property
+}
+
+// find returns the position of id in the entries, and wether it is present.
+func (s *compactStore) find(id PropertyID) (int, bool) {
+	i := sort.Search(len(s.entries), func(i int) bool {
+		return s.entries[i].id >= id
+	})
+	return i, i < len(s.entries) && s.entries[i].id == id
+}
+
+func (s *compactStore) Get(key string) (Property, bool) {
+	id, ok := lookupPropertyID(key)
+	if !ok {
+		return NullStyle, false
+	}
+	if i, found := s.find(id); found {
+		return s.entries[i].value, true
+	}
+	return NullStyle, false
+}
+
+func (s *compactStore) Set(key string, p Property) {
+	id := PropertyIDFor(key)
+	i, found := s.find(id)
+	if found {
+		s.entries[i].value = p
+		return
+	}
+	s.entries = append(s.entries, compactEntry{})
+	copy(s.entries[i+1:], s.entries[i:])
+	s.entries[i] = compactEntry{id: id, value: p}
+}
+
+func (s *compactStore) Remove(key string) (Property, bool) {
+	id, ok := lookupPropertyID(key)
+	if !ok {
+		return NullStyle, false
+	}
+	i, found := s.find(id)
+	if !found {
+		return NullStyle, false
+	}
+	p := s.entries[i].value
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	return p, true
+}
+
+func (s *compactStore) Len() int {
+	return len(s.entries)
+}
+
+func (s *compactStore) Each(f func(string, Property)) {
+	for _, e := range s.entries {
+		f(e.id.Key(), e.value)
+	}
+}
+
+func (s *compactStore) Clone() StyleStore {
+	c := &compactStore{}
+	if len(s.entries) > 0 {
+		c.entries = make([]compactEntry, len(s.entries))
+		copy(c.entries, s.entries)
+	}
+	return c
+}
@@ -0,0 +1,424 @@
+package styledtree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/tree"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// --- Binary encoding -------------------------------------------------------
+
+// The binary format starts with a header of encodingMagic and encodingVersion,
+// followed by four sections. Numbers are written as unsigned varints, strings
+// as indices into the string table.
+//
+//     strings     count, then for each string: length, bytes
+//     groups      count, then for each group: name, parent+1, count, key/value pairs
+//     maps        count, then for each map: count, group indices
+//     nodes       pre-order, for each node: type, atom, data, namespace,
+//                 attributes, map+1, node ID, important keys, dirty flag,
+//                 number of children
+//
+// Groups are written before groups linking to them, thus every parent
+// reference points backwards.
+const (
+	encodingMagic   = "STY"
+	encodingVersion = 1
+)
+
+// ErrCorruptEncoding is returned by Decode for input which is not a valid
+// encoding of a styled tree.
+var ErrCorruptEncoding = errors.New("corrupt encoding of styled tree")
+
+// Encode writes a styled tree to w in a compact binary format, suitable for
+// handing a styled document to another process, e.g. from a styling service to
+// a layout process (see Decode).
+//
+// The encoding covers the HTML nodes linked to the styled nodes, i.e. the HTML
+// structure of the styled tree, and the property maps of the nodes. Property
+// maps and property groups shared between nodes are encoded once, and remain
+// shared after decoding. Parent groups of property groups are part of the
+// encoding as well, including groups of the user-agent defaults. HTML nodes
+// without a styled counterpart (e.g., comments or <style> elements) are not
+// encoded.
+func Encode(w io.Writer, root *tree.Node[*StyNode]) error {
+	if root == nil || root.Payload == nil {
+		return errors.New("cannot encode empty styled tree")
+	}
+	enc := newEncoder()
+	enc.collect(root)
+	bw := bufio.NewWriter(w)
+	enc.w = bw
+	enc.writeTables()
+	enc.writeNode(root)
+	if enc.err != nil {
+		return enc.err
+	}
+	return bw.Flush()
+}
+
+type encoder struct {
+	w       *bufio.Writer
+	err     error // first write error
+	strings map[string]uint64
+	strtab  []string
+	groups  map[*style.PropertyGroup]uint64
+	grptab  []*style.PropertyGroup
+	maps    map[*style.PropertyMap]uint64
+	maptab  []*style.PropertyMap
+	buf     [binary.MaxVarintLen64]byte
+}
+
+func newEncoder() *encoder {
+	return &encoder{
+		strings: make(map[string]uint64),
+		groups:  make(map[*style.PropertyGroup]uint64),
+		maps:    make(map[*style.PropertyMap]uint64),
+	}
+}
+
+// collect fills the tables of strings, groups and property maps for the
+// subtree of n.
+func (enc *encoder) collect(n *tree.Node[*StyNode]) {
+	sn := n.Payload
+	if h := sn.htmlNode; h != nil {
+		enc.str(h.DataAtom.String())
+		enc.str(h.Data)
+		enc.str(h.Namespace)
+		for _, a := range h.Attr {
+			enc.str(a.Namespace)
+			enc.str(a.Key)
+			enc.str(a.Val)
+		}
+	}
+	if pmap := sn.computedStyles; pmap != nil {
+		if _, ok := enc.maps[pmap]; !ok {
+			for _, g := range pmap.Groups() {
+				enc.group(g)
+			}
+			enc.maps[pmap] = uint64(len(enc.maptab))
+			enc.maptab = append(enc.maptab, pmap)
+		}
+	}
+	for _, key := range importantKeys(sn) {
+		enc.str(key)
+	}
+	for _, ch := range n.Children(true) {
+		enc.collect(ch)
+	}
+}
+
+// group adds g to the table of groups, after its parent groups.
+func (enc *encoder) group(g *style.PropertyGroup) uint64 {
+	if inx, ok := enc.groups[g]; ok {
+		return inx
+	}
+	if g.Parent != nil {
+		enc.group(g.Parent)
+	}
+	enc.str(g.Name())
+	for _, kv := range sortedProperties(g) {
+		enc.str(kv.Key)
+		enc.str(string(kv.Value))
+	}
+	inx := uint64(len(enc.grptab))
+	enc.groups[g] = inx
+	enc.grptab = append(enc.grptab, g)
+	return inx
+}
+
+// str adds s to the string table and returns its index.
+func (enc *encoder) str(s string) uint64 {
+	if inx, ok := enc.strings[s]; ok {
+		return inx
+	}
+	inx := uint64(len(enc.strtab))
+	enc.strings[s] = inx
+	enc.strtab = append(enc.strtab, s)
+	return inx
+}
+
+func (enc *encoder) writeTables() {
+	enc.write([]byte(encodingMagic))
+	enc.uint(encodingVersion)
+	enc.uint(uint64(len(enc.strtab)))
+	for _, s := range enc.strtab {
+		enc.uint(uint64(len(s)))
+		enc.write([]byte(s))
+	}
+	enc.uint(uint64(len(enc.grptab)))
+	for _, g := range enc.grptab {
+		enc.uint(enc.strings[g.Name()])
+		if g.Parent == nil {
+			enc.uint(0)
+		} else {
+			enc.uint(enc.groups[g.Parent] + 1)
+		}
+		props := sortedProperties(g)
+		enc.uint(uint64(len(props)))
+		for _, kv := range props {
+			enc.uint(enc.strings[kv.Key])
+			enc.uint(enc.strings[string(kv.Value)])
+		}
+	}
+	enc.uint(uint64(len(enc.maptab)))
+	for _, pmap := range enc.maptab {
+		groups := pmap.Groups()
+		enc.uint(uint64(len(groups)))
+		for _, g := range groups {
+			enc.uint(enc.groups[g])
+		}
+	}
+}
+
+func (enc *encoder) writeNode(n *tree.Node[*StyNode]) {
+	sn := n.Payload
+	h := sn.htmlNode
+	if h == nil {
+		h = &html.Node{}
+	}
+	enc.uint(uint64(h.Type))
+	enc.uint(enc.strings[h.DataAtom.String()])
+	enc.uint(enc.strings[h.Data])
+	enc.uint(enc.strings[h.Namespace])
+	enc.uint(uint64(len(h.Attr)))
+	for _, a := range h.Attr {
+		enc.uint(enc.strings[a.Namespace])
+		enc.uint(enc.strings[a.Key])
+		enc.uint(enc.strings[a.Val])
+	}
+	if sn.computedStyles == nil {
+		enc.uint(0)
+	} else {
+		enc.uint(enc.maps[sn.computedStyles] + 1)
+	}
+	enc.uint(uint64(sn.id))
+	keys := importantKeys(sn)
+	enc.uint(uint64(len(keys)))
+	for _, key := range keys {
+		enc.uint(enc.strings[key])
+	}
+	if sn.dirty {
+		enc.uint(1)
+	} else {
+		enc.uint(0)
+	}
+	children := n.Children(true)
+	enc.uint(uint64(len(children)))
+	for _, ch := range children {
+		enc.writeNode(ch)
+	}
+}
+
+// sortedProperties returns the properties of a group sorted by key, making the
+// encoding of a styled tree deterministic.
+func sortedProperties(g *style.PropertyGroup) []style.KeyValue {
+	props := g.Properties()
+	sort.Slice(props, func(i, j int) bool { return props[i].Key < props[j].Key })
+	return props
+}
+
+func importantKeys(sn *StyNode) []string {
+	keys := make([]string, 0, len(sn.important))
+	for key := range sn.important {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (enc *encoder) uint(x uint64) {
+	l := binary.PutUvarint(enc.buf[:], x)
+	enc.write(enc.buf[:l])
+}
+
+func (enc *encoder) write(b []byte) {
+	if enc.err == nil {
+		_, enc.err = enc.w.Write(b)
+	}
+}
+
+// Decode reads a styled tree from r, which has been written by Encode. The HTML
+// nodes of the styled tree are re-created and linked into an HTML parse tree in
+// parallel to the styled tree. Node IDs are preserved: if the encoded tree has
+// been registered with a node index, the decoded tree is registered with a new
+// node index, using the same IDs.
+//
+// Decode returns ErrCorruptEncoding if r does not hold a valid encoding.
+func Decode(r io.Reader) (*tree.Node[*StyNode], error) {
+	dec := &decoder{r: bufio.NewReader(r)}
+	magic := make([]byte, len(encodingMagic))
+	if _, err := io.ReadFull(dec.r, magic); err != nil || string(magic) != encodingMagic {
+		return nil, ErrCorruptEncoding
+	}
+	if dec.uint() != encodingVersion {
+		return nil, errors.New("unsupported version of styled tree encoding")
+	}
+	dec.readTables()
+	root := dec.readNode(nil, 0)
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if dec.index != nil {
+		dec.index.root = root
+	}
+	return root, nil
+}
+
+// maxDepth limits the nesting of nodes accepted by Decode.
+const maxDepth = 10000
+
+type decoder struct {
+	r      *bufio.Reader
+	err    error // first read error
+	strtab []string
+	grptab []*style.PropertyGroup
+	maptab []*style.PropertyMap
+	index  *NodeIndex // created for the first node with an ID
+}
+
+func (dec *decoder) readTables() {
+	// tables grow while reading, as counts of corrupt input may be arbitrary
+	for n := dec.count(); n > 0 && dec.err == nil; n-- {
+		l := dec.count()
+		b, err := io.ReadAll(io.LimitReader(dec.r, int64(l)))
+		if err != nil || len(b) != l {
+			dec.fail()
+			return
+		}
+		dec.strtab = append(dec.strtab, string(b))
+	}
+	for n := dec.count(); n > 0 && dec.err == nil; n-- {
+		g := style.NewPropertyGroup(dec.str())
+		if parent := dec.uint(); parent > 0 {
+			if parent > uint64(len(dec.grptab)) {
+				dec.fail()
+				return
+			}
+			g.Parent = dec.grptab[parent-1]
+		}
+		for props := dec.count(); props > 0 && dec.err == nil; props-- {
+			key := dec.str()
+			g.Set(key, style.Property(dec.str()))
+		}
+		dec.grptab = append(dec.grptab, g)
+	}
+	for n := dec.count(); n > 0 && dec.err == nil; n-- {
+		pmap := style.NewPropertyMap()
+		for groups := dec.count(); groups > 0 && dec.err == nil; groups-- {
+			inx := dec.uint()
+			if inx >= uint64(len(dec.grptab)) {
+				dec.fail()
+				return
+			}
+			pmap = pmap.AddAllFromGroup(dec.grptab[inx], false)
+		}
+		dec.maptab = append(dec.maptab, pmap)
+	}
+}
+
+func (dec *decoder) readNode(parent *html.Node, depth int) *tree.Node[*StyNode] {
+	if dec.err != nil {
+		return nil
+	}
+	if depth > maxDepth {
+		dec.fail()
+		return nil
+	}
+	h := &html.Node{Type: html.NodeType(dec.uint())}
+	h.DataAtom = atom.Lookup([]byte(dec.str()))
+	h.Data = dec.str()
+	h.Namespace = dec.str()
+	for attrs := dec.count(); attrs > 0 && dec.err == nil; attrs-- {
+		h.Attr = append(h.Attr, html.Attribute{Namespace: dec.str(), Key: dec.str(), Val: dec.str()})
+	}
+	n := NewNodeForHTMLNode(h)
+	sn := n.Payload
+	if inx := dec.uint(); inx > 0 {
+		if inx > uint64(len(dec.maptab)) {
+			dec.fail()
+			return nil
+		}
+		sn.computedStyles = dec.maptab[inx-1]
+	}
+	if id := NodeID(dec.uint()); id != NoNodeID && dec.err == nil {
+		dec.register(sn, id)
+	}
+	for keys := dec.count(); keys > 0 && dec.err == nil; keys-- {
+		if sn.important == nil {
+			sn.important = make(map[string]bool)
+		}
+		sn.important[dec.str()] = true
+	}
+	sn.dirty = dec.uint() != 0
+	if parent != nil {
+		parent.AppendChild(h)
+	}
+	for children := dec.count(); children > 0 && dec.err == nil; children-- {
+		if ch := dec.readNode(h, depth+1); ch != nil {
+			n.AddChild(ch)
+		}
+	}
+	return n
+}
+
+// register adds sn to the node index of the decoded tree, keeping its ID.
+func (dec *decoder) register(sn *StyNode, id NodeID) {
+	if dec.index == nil {
+		dec.index = NewNodeIndex()
+	}
+	if _, dup := dec.index.nodes[id]; dup {
+		dec.fail()
+		return
+	}
+	sn.id, sn.index = id, dec.index
+	dec.index.nodes[id] = sn
+	if id > dec.index.last {
+		dec.index.last = id
+	}
+}
+
+func (dec *decoder) uint() uint64 {
+	if dec.err != nil {
+		return 0
+	}
+	x, err := binary.ReadUvarint(dec.r)
+	if err != nil {
+		dec.fail()
+	}
+	return x
+}
+
+// count reads a number of items to follow. Counts are limited, but may still be
+// much larger than the input, thus callers must not allocate space for items in
+// advance, but rather grow their storage as items are read.
+func (dec *decoder) count() int {
+	x := dec.uint()
+	if x > 1<<24 {
+		dec.fail()
+		return 0
+	}
+	return int(x)
+}
+
+func (dec *decoder) str() string {
+	inx := dec.uint()
+	if inx >= uint64(len(dec.strtab)) {
+		dec.fail()
+		return ""
+	}
+	return dec.strtab[inx]
+}
+
+func (dec *decoder) fail() {
+	if dec.err == nil {
+		dec.err = ErrCorruptEncoding
+	}
+}
@@ -0,0 +1,157 @@
+package styledtree
+
+import (
+	"sync"
+
+	"github.com/npillmayer/fp/persistent/btree"
+	"github.com/npillmayer/fp/tree"
+)
+
+// NodeID is a compact identifier for a styled node. IDs are unique within a
+// styled tree and remain stable for the lifetime of the tree, thus clients may
+// use them to refer to nodes without holding on to Go pointers, e.g., as keys
+// for caches or for inter-process communication.
+//
+// The zero value NoNodeID denotes a node without an ID.
+type NodeID uint64
+
+// NoNodeID is the ID of nodes which are not registered with a NodeIndex.
+const NoNodeID NodeID = 0
+
+// NodeIndex assigns IDs to the nodes of a styled tree and supports lookup of
+// nodes by ID. A NodeIndex is safe for concurrent use.
+type NodeIndex struct {
+	sync.RWMutex
+	last      NodeID
+	nodes     map[NodeID]*StyNode
+	root      *tree.Node[*StyNode] // first subtree registered, i.e. the styled tree
+	positions *documentOrder       // nil if positions have not been computed yet
+	data      interface{}          // client data attached to the document, see SetData
+}
+
+// NewNodeIndex creates an empty node index.
+func NewNodeIndex() *NodeIndex {
+	return &NodeIndex{nodes: make(map[NodeID]*StyNode)}
+}
+
+// ID returns the ID of a styled node, or NoNodeID if sn is not registered with
+// a node index.
+func (sn *StyNode) ID() NodeID {
+	if sn == nil {
+		return NoNodeID
+	}
+	return sn.id
+}
+
+// Index returns the node index sn is registered with, if any.
+func (sn *StyNode) Index() *NodeIndex {
+	if sn == nil {
+		return nil
+	}
+	return sn.index
+}
+
+// RegisterSubtree assigns IDs to n and its descendents, in document order. Nodes
+// already registered with ix keep their IDs. Nodes registered with a different
+// index are removed from it and get a new ID.
+//
+// The first subtree registered with ix is considered to be the styled tree
+// (see Position).
+func (ix *NodeIndex) RegisterSubtree(n *tree.Node[*StyNode]) {
+	if ix == nil || n == nil || n.Payload == nil {
+		return
+	}
+	ix.Lock()
+	if ix.root == nil {
+		ix.root = n
+	}
+	ix.register(n)
+	ix.inserted(n)
+	ix.Unlock()
+}
+
+func (ix *NodeIndex) register(n *tree.Node[*StyNode]) {
+	sn := n.Payload
+	if sn.index == ix {
+		ix.removed(sn) // sn has been moved within the tree
+	} else {
+		sn.index.Unregister(sn)
+		ix.last++
+		sn.id, sn.index = ix.last, ix
+		ix.nodes[sn.id] = sn
+	}
+	for _, ch := range n.Children(true) {
+		ix.register(ch)
+	}
+}
+
+// Unregister removes sn from the index and clears its ID.
+func (ix *NodeIndex) Unregister(sn *StyNode) {
+	if ix == nil || sn == nil || sn.index != ix {
+		return
+	}
+	ix.Lock()
+	delete(ix.nodes, sn.id)
+	ix.removed(sn)
+	if ix.positions != nil {
+		ix.positions.byID = ix.positions.byID.WithDeleted(btree.K(sn.id))
+	}
+	ix.Unlock()
+	sn.id, sn.index = NoNodeID, nil
+}
+
+// Lookup returns the styled node registered for id. Nodes which have been
+// taken out of the styled tree without unregistering them, e.g. by isolating
+// them, are unregistered by Lookup and are not found.
+func (ix *NodeIndex) Lookup(id NodeID) (*StyNode, bool) {
+	if ix == nil {
+		return nil, false
+	}
+	ix.RLock()
+	sn, ok := ix.nodes[id]
+	root := ix.root
+	ix.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	for n := &sn.Node; n != root && root != nil; n = n.Parent() {
+		if n == nil { // sn is detached from the styled tree
+			ix.Unregister(sn)
+			return nil, false
+		}
+	}
+	return sn, true
+}
+
+// Len returns the number of nodes registered with ix.
+func (ix *NodeIndex) Len() int {
+	if ix == nil {
+		return 0
+	}
+	ix.RLock()
+	defer ix.RUnlock()
+	return len(ix.nodes)
+}
+
+// SetData attaches client data to ix. As all the nodes of a styled tree are
+// registered with the same index, clients may use it to keep document-level
+// information, e.g. settings the document has been created with, without
+// holding on to the root of the tree. A previous value is replaced.
+func (ix *NodeIndex) SetData(data interface{}) {
+	if ix == nil {
+		return
+	}
+	ix.Lock()
+	ix.data = data
+	ix.Unlock()
+}
+
+// Data returns the client data attached to ix by SetData, or nil.
+func (ix *NodeIndex) Data() interface{} {
+	if ix == nil {
+		return nil
+	}
+	ix.RLock()
+	defer ix.RUnlock()
+	return ix.data
+}
@@ -2,6 +2,7 @@ package styledtree
 
 import (
 	"strings"
+	"sync"
 
 	"github.com/npillmayer/fp/dom/style"
 	"github.com/npillmayer/fp/tree"
@@ -13,6 +14,11 @@ type StyNode struct {
 	tree.Node[*StyNode] // we build on top of general purpose tree
 	htmlNode            *html.Node
 	computedStyles      *style.PropertyMap
+	id                  NodeID          // stable ID, if registered with an index
+	index               *NodeIndex      // index the node is registered with
+	important           map[string]bool // properties set as important by SetProperty
+	dirty               bool            // styles have been modified after styling
+	attrs               attributeCache  // parsed class and style attributes
 }
 
 func (sn *StyNode) String() string {
@@ -24,6 +30,8 @@ func (sn *StyNode) String() string {
 		return "[" + h.Data + "]"
 	case html.TextNode:
 		return "[#text:" + shortText(h) + "]"
+	case html.CommentNode:
+		return "[#comment]"
 	}
 	return "[styled node]"
 }
@@ -93,6 +101,340 @@ func (sn *StyNode) GetPropertyValue(key string, pmap *style.PropertyMap) style.P
 	return style.NullStyle
 }
 
+// ForeignContent returns the namespace of the HTML parser ("svg" or "math") if
+// sn is the root element of a foreign-content subtree, i.e. an inline <svg> or
+// <math> element within HTML content. For all other nodes, including elements
+// nested within foreign content, an empty string is returned.
+//
+// Renderers may delegate foreign-content subtrees to a dedicated engine. If the
+// document has been styled with foreign content preserved, the styled node of
+// a foreign root has no children; its content is found in the HTML subtree.
+func (sn *StyNode) ForeignContent() string {
+	h := sn.HTMLNode()
+	if h == nil || h.Type != html.ElementNode || h.Namespace == "" {
+		return ""
+	}
+	if h.Parent != nil && h.Parent.Type == html.ElementNode && h.Parent.Namespace == h.Namespace {
+		return ""
+	}
+	return h.Namespace
+}
+
+// --- Attributes ------------------------------------------------------------
+
+var _ tree.Attributes = &StyNode{}
+
+// Attribute returns the value of an attribute of the underlying HTML node.
+// Part of interface tree.Attributes.
+func (sn *StyNode) Attribute(key string) (string, bool) {
+	if sn == nil || sn.htmlNode == nil {
+		return "", false
+	}
+	for _, a := range sn.htmlNode.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// SetAttribute sets the value of an attribute of the underlying HTML node.
+// If the attribute is not present, it will be created.
+// Part of interface tree.Attributes.
+func (sn *StyNode) SetAttribute(key, value string) {
+	if sn == nil || sn.htmlNode == nil {
+		return
+	}
+	sn.attrs.invalidate(key)
+	for i, a := range sn.htmlNode.Attr {
+		if a.Namespace == "" && a.Key == key {
+			sn.htmlNode.Attr[i].Val = value
+			return
+		}
+	}
+	sn.htmlNode.Attr = append(sn.htmlNode.Attr, html.Attribute{Key: key, Val: value})
+}
+
+// ClassList returns the classes of the node, as given by its class attribute.
+// Classes are split at white space, duplicates are removed. The list is
+// parsed once and cached until the class attribute is modified with
+// SetAttribute. Clients must not modify the list.
+func (sn *StyNode) ClassList() []string {
+	if sn == nil {
+		return nil
+	}
+	sn.attrs.Lock()
+	defer sn.attrs.Unlock()
+	if !sn.attrs.hasClasses {
+		classAttr, _ := sn.Attribute("class")
+		sn.attrs.classes = tokenizeClasses(classAttr)
+		sn.attrs.hasClasses = true
+	}
+	return sn.attrs.classes
+}
+
+// HasClass is a predicate wether class is in the class list of the node.
+func (sn *StyNode) HasClass(class string) bool {
+	for _, c := range sn.ClassList() {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// InlineStyle returns the declarations of the style attribute of the node
+// (see style.ParseDeclarations). The declarations are parsed once and cached
+// until the style attribute is modified with SetAttribute. Clients must not
+// modify the declarations.
+func (sn *StyNode) InlineStyle() []style.KeyValue {
+	if sn == nil || sn.htmlNode == nil || sn.htmlNode.Type != html.ElementNode {
+		return nil
+	}
+	sn.attrs.Lock()
+	defer sn.attrs.Unlock()
+	if !sn.attrs.hasInline {
+		if styleAttr, ok := sn.Attribute("style"); ok {
+			sn.attrs.inline = style.ParseDeclarations(styleAttr)
+		}
+		sn.attrs.hasInline = true
+	}
+	return sn.attrs.inline
+}
+
+// attributeCache holds parsed values of the class and style attributes of a
+// styled node. Modifying the attributes of the HTML node directly, i.e. without
+// calling SetAttribute, leaves stale values in the cache.
+type attributeCache struct {
+	sync.Mutex
+	classes    []string         // tokenized class attribute
+	inline     []style.KeyValue // parsed style attribute
+	hasClasses bool             // classes are valid
+	hasInline  bool             // inline is valid
+}
+
+// invalidate drops the cached value for attribute key, if any.
+func (c *attributeCache) invalidate(key string) {
+	c.Lock()
+	defer c.Unlock()
+	switch key {
+	case "class":
+		c.classes, c.hasClasses = nil, false
+	case "style":
+		c.inline, c.hasInline = nil, false
+	}
+}
+
+// tokenizeClasses splits a class attribute at white space, dropping duplicates.
+func tokenizeClasses(classAttr string) []string {
+	fields := strings.Fields(classAttr)
+	classes := fields[:0]
+	for _, f := range fields {
+		dup := false
+		for _, c := range classes {
+			if c == f {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			classes = append(classes, f)
+		}
+	}
+	if len(classes) == 0 {
+		return nil
+	}
+	return classes
+}
+
+// --- Cloning and adoption --------------------------------------------------
+
+// CloneSubtree creates a copy of a styled node. If deep is set, all styled
+// descendents are copied as well, otherwise the copy is a single node without
+// children.
+//
+// The underlying HTML nodes are copied, too, and linked in parallel to the
+// styled nodes. HTML nodes without a styled counterpart (e.g., comments or
+// <style> elements) are not part of the copy. Property groups are shared
+// between original and copy. Copies have no ID until they are adopted into a
+// styled tree.
+func (sn *StyNode) CloneSubtree(deep bool) *tree.Node[*StyNode] {
+	if sn == nil {
+		return nil
+	}
+	h := cloneHTMLNode(sn.htmlNode)
+	clone := NewNodeForHTMLNode(h)
+	clone.Payload.computedStyles = shallowCopyOfStyles(sn.computedStyles)
+	if deep {
+		for _, ch := range sn.Children(true) {
+			chclone := ch.Payload.CloneSubtree(true)
+			if h != nil && chclone.Payload.htmlNode != nil {
+				h.AppendChild(chclone.Payload.htmlNode)
+			}
+			clone.AddChild(chclone)
+		}
+	}
+	return clone
+}
+
+// AdoptSubtree re-parents the styled subtree n into the styled tree of sn,
+// appending n as the last child of sn. n may be part of a different styled
+// document; it is removed from its old parent (both in the styled tree and in
+// the HTML parse tree).
+//
+// The style context of the adopted subtree is re-computed: property groups
+// of the subtree will be copied and re-linked to cascade to property groups of
+// the new ancestors. The old document remains unaffected by this.
+//
+// Nodes adopted from a different styled tree are assigned new IDs from the
+// node index of sn (see NodeIndex).
+func (sn *StyNode) AdoptSubtree(n *tree.Node[*StyNode]) {
+	if sn == nil || n == nil || n.Payload == nil {
+		return
+	}
+	n.Isolate()
+	if h := n.Payload.htmlNode; h != nil {
+		if h.Parent != nil {
+			h.Parent.RemoveChild(h)
+		}
+		if sn.htmlNode != nil {
+			sn.htmlNode.AppendChild(h)
+		}
+	}
+	sn.AddChild(n)
+	relinkStyles(n)
+	if sn.index != nil {
+		sn.index.RegisterSubtree(n)
+	} else {
+		unregisterSubtree(n)
+	}
+}
+
+// RemoveSubtree removes the styled subtree n, a child of sn, from the styled
+// tree as well as from the HTML parse tree. The nodes of the subtree are
+// unregistered from their node index, i.e. they lose their IDs. RemoveSubtree
+// returns false if n is not a child of sn.
+func (sn *StyNode) RemoveSubtree(n *tree.Node[*StyNode]) bool {
+	if sn == nil || n == nil || n.Payload == nil || n.Parent() != &sn.Node {
+		return false
+	}
+	unregisterSubtree(n) // before isolating, to keep positions of nodes following
+	n.Isolate()
+	if h := n.Payload.htmlNode; h != nil && h.Parent != nil {
+		h.Parent.RemoveChild(h)
+	}
+	return true
+}
+
+// unregisterSubtree removes n and its descendents from their node index.
+func unregisterSubtree(n *tree.Node[*StyNode]) {
+	n.Payload.index.Unregister(n.Payload)
+	for _, ch := range n.Children(true) {
+		unregisterSubtree(ch)
+	}
+}
+
+// Normalize puts the styled subtree of sn into a normalized form, as defined by
+// the W3C DOM: text nodes are merged with adjacent text nodes and empty text
+// nodes are removed. Changes are applied to the styled tree as well as to the
+// HTML parse tree. Text nodes are adjacent if they are adjacent in the styled
+// tree, i.e. HTML nodes without a styled counterpart (e.g., comments) do not
+// separate text nodes; they will follow the merged text node.
+//
+// Normalize returns the number of text nodes removed. Removed nodes are
+// unregistered from their node index.
+func (sn *StyNode) Normalize() int {
+	if sn == nil {
+		return 0
+	}
+	removed := 0
+	var prev *StyNode // preceding text node
+	for _, ch := range sn.Children(true) {
+		chsn := ch.Payload
+		h := chsn.htmlNode
+		if h == nil || h.Type != html.TextNode {
+			prev = nil
+			removed += chsn.Normalize()
+			continue
+		}
+		if h.Data != "" && prev == nil {
+			prev = chsn
+			continue
+		}
+		if prev != nil {
+			prev.htmlNode.Data += h.Data
+		}
+		if h.Parent != nil {
+			h.Parent.RemoveChild(h)
+		}
+		ch.Isolate()
+		chsn.index.Unregister(chsn)
+		removed++
+	}
+	return removed
+}
+
+// relinkStyles walks a subtree top-down and re-links the property groups of
+// every node to the nearest property groups of the node's ancestors.
+func relinkStyles(n *tree.Node[*StyNode]) {
+	sn := n.Payload
+	if pmap := sn.computedStyles; pmap != nil {
+		relinked := style.NewPropertyMap()
+		for _, group := range pmap.Groups() {
+			g := group.Clone()
+			g.Parent = ancestorGroup(n.Parent(), g.Name())
+			relinked = relinked.AddAllFromGroup(g, true)
+		}
+		sn.computedStyles = relinked
+	}
+	for _, ch := range n.Children(true) {
+		relinkStyles(ch)
+	}
+}
+
+// ancestorGroup finds the nearest property group with a given name, starting
+// the search at n and proceeding upwards.
+func ancestorGroup(n *tree.Node[*StyNode], groupname string) *style.PropertyGroup {
+	for n != nil {
+		if n.Payload != nil {
+			if g := n.Payload.computedStyles.Group(groupname); g != nil {
+				return g
+			}
+		}
+		n = n.Parent()
+	}
+	return nil
+}
+
+func shallowCopyOfStyles(pmap *style.PropertyMap) *style.PropertyMap {
+	if pmap == nil {
+		return nil
+	}
+	c := style.NewPropertyMap()
+	for _, group := range pmap.Groups() {
+		c = c.AddAllFromGroup(group, false)
+	}
+	return c
+}
+
+// cloneHTMLNode copies an HTML node without linking it into a parse tree.
+func cloneHTMLNode(h *html.Node) *html.Node {
+	if h == nil {
+		return nil
+	}
+	c := &html.Node{
+		Type:      h.Type,
+		DataAtom:  h.DataAtom,
+		Data:      h.Data,
+		Namespace: h.Namespace,
+	}
+	if h.Attr != nil {
+		c.Attr = make([]html.Attribute, len(h.Attr))
+		copy(c.Attr, h.Attr)
+	}
+	return c
+}
+
 // --- Helpers ---------------------------------------------------------------
 
 // Creator returns a style-creator for use in CSSOM.
@@ -0,0 +1,247 @@
+package styledtree
+
+import (
+	"github.com/npillmayer/fp/persistent/btree"
+	"github.com/npillmayer/fp/tree"
+)
+
+// --- Document order ---------------------------------------------------
+
+// documentOrder indexes the nodes of a styled tree by document position, i.e.
+// by their ordinal in a depth-first pre-order traversal, starting with 0 for
+// the root.
+//
+// Positions are dense, thus inserting or removing nodes shifts the positions of
+// all nodes following. Positions preceding the first node affected by a
+// modification stay valid, and the positions following are re-computed lazily,
+// on the first query for one of them.
+type documentOrder struct {
+	byPosition btree.Tree // position → *StyNode
+	byID       btree.Tree // NodeID → position
+	valid      int        // positions below valid are up to date
+	complete   bool       // all the positions are up to date
+}
+
+func emptyDocumentOrder() *documentOrder {
+	return &documentOrder{byPosition: btree.Immutable(), byID: btree.Immutable()}
+}
+
+// invalidateFrom marks the positions from pos on as stale.
+func (order *documentOrder) invalidateFrom(pos int) {
+	if pos < order.valid {
+		order.valid = pos
+	}
+	order.complete = false
+}
+
+// position returns the document position of sn, if it is up to date.
+func (order documentOrder) position(sn *StyNode) (int, bool) {
+	p, ok := order.byID.Find(btree.K(sn.id))
+	if !ok || p.(int) >= order.valid {
+		return -1, false
+	}
+	if at, ok := order.byPosition.Find(btree.K(p.(int))); !ok || at.(*StyNode) != sn {
+		return -1, false
+	}
+	return p.(int), true
+}
+
+// orderUpTo returns the document order of ix, with at least the positions below
+// pos up to date. Stale positions are re-computed, if necessary. As the trees of
+// a documentOrder are persistent, the order returned is a snapshot.
+func (ix *NodeIndex) orderUpTo(pos int) documentOrder {
+	ix.RLock()
+	if order := ix.positions; order != nil && (order.complete || pos <= order.valid) {
+		defer ix.RUnlock()
+		return *order
+	}
+	ix.RUnlock()
+	ix.Lock()
+	defer ix.Unlock()
+	ix.updateOrder()
+	return *ix.positions
+}
+
+// updateOrder re-computes the stale positions of ix, i.e. the positions of the
+// nodes following the last node with a valid position. ix has to be locked.
+func (ix *NodeIndex) updateOrder() {
+	if ix.positions == nil {
+		ix.positions = emptyDocumentOrder()
+	}
+	order := ix.positions
+	if order.complete {
+		return
+	}
+	pos, end := order.valid, order.byPosition.Len()
+	visit := func(n *tree.Node[*StyNode]) {
+		if sn := n.Payload; sn != nil && sn.index == ix {
+			order.byPosition = order.byPosition.With(btree.K(pos), sn)
+			order.byID = order.byID.With(btree.K(sn.id), pos)
+			pos++
+		}
+	}
+	var last *tree.Node[*StyNode]
+	if pos > 0 {
+		sn, _ := order.byPosition.Find(btree.K(pos - 1))
+		last = &sn.(*StyNode).Node
+	}
+	if last == nil || !visitFollowing(ix.root, last, visit) { // re-compute all positions
+		*order = *emptyDocumentOrder()
+		pos, end = 0, 0
+		visitSubtree(ix.root, visit)
+	}
+	for p := pos; p < end; p++ { // remove positions beyond the end of the document
+		order.byPosition = order.byPosition.WithDeleted(btree.K(p))
+	}
+	order.valid, order.complete = pos, true
+}
+
+// visitSubtree calls visit for n and its descendents, in document order.
+func visitSubtree(n *tree.Node[*StyNode], visit func(*tree.Node[*StyNode])) {
+	if n == nil {
+		return
+	}
+	visit(n)
+	for _, ch := range n.Children(true) {
+		visitSubtree(ch, visit)
+	}
+}
+
+// visitFollowing calls visit for the nodes of the tree rooted at root which
+// follow node n in document order. It returns false if n is not part of the
+// tree.
+func visitFollowing(root, n *tree.Node[*StyNode], visit func(*tree.Node[*StyNode])) bool {
+	var path []*tree.Node[*StyNode] // path from n up to root
+	for a := n; a != root; a = a.Parent() {
+		if a == nil {
+			return false
+		}
+		path = append(path, a)
+	}
+	for _, ch := range n.Children(true) {
+		visitSubtree(ch, visit)
+	}
+	for _, a := range path { // following siblings of n and of its ancestors
+		parent := a.Parent()
+		siblings := parent.Children(false)
+		for _, sibling := range siblings[parent.IndexOfChild(a)+1:] {
+			visitSubtree(sibling, visit)
+		}
+	}
+	return true
+}
+
+// precedingNode returns the last node preceding n in document order which is
+// registered with ix, or nil.
+func (ix *NodeIndex) precedingNode(n *tree.Node[*StyNode]) *tree.Node[*StyNode] {
+	for {
+		parent := n.Parent()
+		if parent == nil || n == ix.root {
+			return nil
+		}
+		pred := parent
+		for i := parent.IndexOfChild(n) - 1; i >= 0; i-- {
+			if ch, ok := parent.Child(i); ok {
+				pred = lastDescendant(ch)
+				break
+			}
+		}
+		if pred.Payload != nil && pred.Payload.index == ix {
+			return pred
+		}
+		n = pred
+	}
+}
+
+// lastDescendant returns the last node of the subtree of n in document order.
+func lastDescendant(n *tree.Node[*StyNode]) *tree.Node[*StyNode] {
+	for {
+		children := n.Children(true)
+		if len(children) == 0 {
+			return n
+		}
+		n = children[len(children)-1]
+	}
+}
+
+// inserted marks the positions of ix as stale, starting at the position of
+// n, which has just been inserted into the styled tree. ix has to be locked.
+func (ix *NodeIndex) inserted(n *tree.Node[*StyNode]) {
+	if ix.positions == nil {
+		return
+	}
+	if pred := ix.precedingNode(n); pred != nil {
+		if pos, ok := ix.positions.position(pred.Payload); ok {
+			ix.positions.invalidateFrom(pos + 1)
+		} else {
+			ix.positions.invalidateFrom(ix.positions.valid) // n follows stale positions
+		}
+		return
+	}
+	ix.positions.invalidateFrom(0)
+}
+
+// removed marks the positions of ix as stale, starting at the position of
+// sn, which is about to be removed from the styled tree or moved within it.
+// ix has to be locked.
+func (ix *NodeIndex) removed(sn *StyNode) {
+	if ix.positions == nil {
+		return
+	}
+	if pos, ok := ix.positions.byID.Find(btree.K(sn.id)); ok {
+		ix.positions.invalidateFrom(pos.(int))
+	}
+}
+
+// Position returns the document position of sn, i.e. its ordinal in a
+// depth-first pre-order traversal of the styled tree, starting with 0 for the
+// first node registered with ix. Nodes not registered with ix do not have a
+// position.
+//
+// Positions are computed on the first call to Position, NodeAt or Range, which
+// takes O(n log n) time for a tree of n nodes. Lookups then take O(log n) time.
+// Positions are dense, thus registering or unregistering nodes (e.g., by
+// AdoptSubtree or Normalize) shifts the positions of all the nodes following.
+// Only these positions are re-computed, on the next query for one of them.
+// Appending content to the end of a document is therefore cheap, whereas
+// clients interleaving modifications at the start of a document with queries
+// should batch their modifications.
+func (ix *NodeIndex) Position(sn *StyNode) (int, bool) {
+	if ix == nil || sn == nil || sn.index != ix {
+		return -1, false
+	}
+	if pos, ok := ix.orderUpTo(0).position(sn); ok {
+		return pos, true
+	}
+	ix.Lock()
+	ix.updateOrder()
+	order := *ix.positions
+	ix.Unlock()
+	return order.position(sn)
+}
+
+// NodeAt returns the node at a document position (see Position).
+func (ix *NodeIndex) NodeAt(pos int) (*StyNode, bool) {
+	if ix == nil || pos < 0 {
+		return nil, false
+	}
+	sn, ok := ix.orderUpTo(pos + 1).byPosition.Find(btree.K(pos))
+	if !ok {
+		return nil, false
+	}
+	return sn.(*StyNode), true
+}
+
+// Range returns the nodes with document positions from ≤ position < to, in
+// document order.
+func (ix *NodeIndex) Range(from, to int) []*StyNode {
+	if ix == nil || from >= to {
+		return nil
+	}
+	entries := ix.orderUpTo(to).byPosition.Entries(btree.K(from), btree.K(to))
+	nodes := make([]*StyNode, len(entries))
+	for i, e := range entries {
+		nodes[i] = e.Value.(*StyNode)
+	}
+	return nodes
+}
@@ -0,0 +1,137 @@
+package styledtree
+
+import (
+	"github.com/npillmayer/fp/dom/style"
+	"github.com/npillmayer/fp/tree"
+)
+
+// --- Modification of styles ------------------------------------------------
+
+// SetProperty sets a style property of a styled node, overwriting the value
+// computed during styling. If important is set, the property is flagged as
+// important (see PropertyIsImportant).
+//
+// Property groups may be shared between nodes, thus they are never modified
+// in place. Instead, the node receives a modified copy of the group, and
+// descendents cascading to the original group are re-linked to the copy.
+// The node and re-linked descendents are marked dirty.
+func (sn *StyNode) SetProperty(key string, value style.Property, important bool) {
+	if sn == nil {
+		return
+	}
+	sn.modifyGroup(key, func(g *style.PropertyGroup) bool {
+		g.Set(key, value)
+		return true
+	})
+	if important {
+		if sn.important == nil {
+			sn.important = make(map[string]bool)
+		}
+		sn.important[key] = true
+	} else {
+		delete(sn.important, key)
+	}
+}
+
+// RemoveProperty removes a style property from a styled node, returning its
+// former value. After removal, the property cascades to the styles of the
+// node's ancestors or falls back to its default. If the property is not set
+// for sn, nothing is modified and NullStyle is returned.
+func (sn *StyNode) RemoveProperty(key string) style.Property {
+	if sn == nil {
+		return style.NullStyle
+	}
+	var old style.Property = style.NullStyle
+	sn.modifyGroup(key, func(g *style.PropertyGroup) bool {
+		p, ok := g.Remove(key)
+		old = p
+		return ok
+	})
+	delete(sn.important, key)
+	return old
+}
+
+// PropertyIsImportant is a predicate wether a property has been set as
+// important by SetProperty.
+func (sn *StyNode) PropertyIsImportant(key string) bool {
+	return sn != nil && sn.important[key]
+}
+
+// IsDirty is a predicate wether the styles of a node have been modified after
+// styling, either directly or by modification of a group the node cascades to.
+func (sn *StyNode) IsDirty() bool {
+	return sn != nil && sn.dirty
+}
+
+// MarkDirty flags the styles of a node as modified.
+func (sn *StyNode) MarkDirty() {
+	if sn != nil {
+		sn.dirty = true
+	}
+}
+
+// ClearDirty resets the modification flag of a node, usually after clients
+// have processed the modified styles.
+func (sn *StyNode) ClearDirty() {
+	if sn != nil {
+		sn.dirty = false
+	}
+}
+
+// modifyGroup calls f with a copy of the property group for key, creating a
+// new group if sn has none. If f reports a modification, the copy replaces the
+// group of sn.
+func (sn *StyNode) modifyGroup(key string, f func(*style.PropertyGroup) bool) {
+	groupname := style.GroupNameFromPropertyKey(key)
+	old := sn.computedStyles.Group(groupname)
+	var cow *style.PropertyGroup
+	if old == nil {
+		old = ancestorGroup(sn.Parent(), groupname)
+		cow = style.NewPropertyGroup(groupname)
+		cow.Parent = old
+	} else {
+		cow = old.Clone()
+	}
+	if !f(cow) {
+		return
+	}
+	sn.computedStyles = withGroup(sn.computedStyles, cow)
+	relinkDescendents(&sn.Node, old, cow)
+	sn.dirty = true
+	sn.InvalidateHash()
+}
+
+// relinkDescendents replaces descendent groups of n linking to group old by
+// copies linking to group g. Descendents linking to a group which has been
+// replaced this way are re-linked in turn.
+func relinkDescendents(n *tree.Node[*StyNode], old, g *style.PropertyGroup) {
+	for _, ch := range n.Children(true) {
+		sn := ch.Payload
+		chg := sn.computedStyles.Group(g.Name())
+		if chg == nil {
+			relinkDescendents(ch, old, g) // search downwards for nodes with group
+			continue
+		}
+		if chg.Parent == old {
+			cow := chg.Clone()
+			cow.Parent = g
+			sn.computedStyles = withGroup(sn.computedStyles, cow)
+			sn.dirty = true
+			sn.InvalidateHash()
+			relinkDescendents(ch, chg, cow)
+		}
+	}
+}
+
+// withGroup returns a copy of pmap with group g replacing the group of the
+// same name. Property maps may be shared between nodes, thus pmap is left
+// unmodified.
+func withGroup(pmap *style.PropertyMap, g *style.PropertyGroup) *style.PropertyMap {
+	c := style.NewPropertyMap()
+	for _, group := range pmap.Groups() {
+		if group.Name() != g.Name() {
+			c = c.AddAllFromGroup(group, false)
+		}
+	}
+	return c.AddAllFromGroup(g, false)
+}
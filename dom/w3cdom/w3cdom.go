@@ -24,11 +24,24 @@ import (
 	"golang.org/x/net/html"
 )
 
+// Namespace URIs of elements and attributes.
+const (
+	HTMLNamespace   = "http://www.w3.org/1999/xhtml"
+	SVGNamespace    = "http://www.w3.org/2000/svg"
+	MathMLNamespace = "http://www.w3.org/1998/Math/MathML"
+	XLinkNamespace  = "http://www.w3.org/1999/xlink"
+	XMLNamespace    = "http://www.w3.org/XML/1998/namespace"
+	XMLNSNamespace  = "http://www.w3.org/2000/xmlns/"
+)
+
 // Node represents W3C-type Node
 type Node interface {
 	NodeType() html.NodeType        // type of the underlying HTML node (ElementNode, TextNode, etc.)
 	NodeName() string               // node name output depends on the node's type
 	NodeValue() string              // node value output depends on the node's type
+	NamespaceURI() string           // namespace URI of an element or attribute, empty for other nodes
+	LocalName() string              // name of an element or attribute without its prefix
+	Prefix() string                 // namespace prefix of an element or attribute, if any
 	HasAttributes() bool            // check for existence of attributes
 	ParentNode() Node               // get the parent node, if any
 	HasChildNodes() bool            // check for existende of sub-nodes
@@ -39,13 +52,29 @@ type Node interface {
 	Attributes() NamedNodeMap       // get all attributes of a node
 	ComputedStyles() ComputedStyles // get computed CSS styles
 	TextContent() (string, error)   // get text from node and all descendents
+	Normalize()                     // merge adjacent text nodes, remove empty ones
 }
 
-// NodeList represents W3C-type NodeList
+// NodeList represents W3C-type NodeList. Node lists are either live, i.e.
+// reflecting changes of the DOM, or static snapshots.
 type NodeList interface {
 	Length() int
 	Item(int) Node
 	String() string
+	ForEach(func(int, Node)) // call a function for every node of the list
+	Iter() NodeIterator      // get an iterator over the nodes of the list
+}
+
+// NodeIterator is a cursor over the nodes of a NodeList. Use it like this:
+//
+//     it := list.Iter()
+//     for it.Next() {
+//         fmt.Printf("node #%d = %v\n", it.Index(), it.Node())
+//     }
+type NodeIterator interface {
+	Next() bool // move to the next node; false if there are no more nodes
+	Index() int // index of the current node
+	Node() Node // the current node
 }
 
 // Attr represents W3C-type Attr
@@ -59,7 +88,8 @@ type Attr interface {
 type NamedNodeMap interface {
 	Length() int
 	Item(int) Attr
-	GetNamedItem(string) Attr
+	GetNamedItem(string) Attr                           // get an attribute by its qualified name
+	GetNamedItemNS(namespaceURI, localName string) Attr // get an attribute by namespace and local name
 }
 
 // ComputedStyles represents a CSS style
@@ -67,3 +97,13 @@ type ComputedStyles interface {
 	GetPropertyValue(string) style.Property
 	Styles() *style.PropertyMap
 }
+
+// StyleDeclaration represents a W3C-type CSSStyleDeclaration, i.e. a mutable
+// view of the styles of a node. Modifications write through to the node's
+// styles.
+type StyleDeclaration interface {
+	ComputedStyles
+	GetPropertyPriority(string) string                                  // "important" or ""
+	SetProperty(key string, value style.Property, important bool) error // set a property
+	RemoveProperty(string) style.Property                               // remove a property, returning its old value
+}
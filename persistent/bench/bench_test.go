@@ -0,0 +1,40 @@
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/npillmayer/schuko/tracing"
+)
+
+// sizes are the numbers of elements of the structures under test.
+var sizes = []int{1 << 10, 1 << 16}
+
+// quiet silences tracing of the packages under test.
+func quiet() {
+	for _, key := range []string{"persistent.btree", "persistent.vector",
+		"persistent.tree", "tyse.frame.tree"} {
+		tracing.Select(key).SetTraceLevel(tracing.LevelError)
+	}
+}
+
+// forSizes runs benchmark f as a sub-benchmark for each of the sizes.
+func forSizes(b *testing.B, f func(b *testing.B, n int)) {
+	quiet()
+	for _, n := range sizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			f(b, n)
+		})
+	}
+}
+
+// randomKeys returns a reproducible permutation of 0…n-1.
+func randomKeys(n int) []int {
+	return rand.New(rand.NewSource(42)).Perm(n)
+}
+
+// sink keeps results alive, preventing the compiler from optimizing
+// benchmarked operations away.
+var sink interface{}
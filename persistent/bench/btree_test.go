@@ -0,0 +1,148 @@
+package bench
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/npillmayer/fp/persistent/btree"
+)
+
+// --- B-tree vs. map plus sorted keys --------------------------------------
+
+// Insert benchmarks start over with an empty structure after n insertions,
+// thus measuring the average costs of an insertion into a structure of up to
+// n entries.
+
+func buildBTree(keys []int) btree.Tree {
+	tree := btree.Immutable(btree.Degree(16))
+	for _, k := range keys {
+		tree = tree.With(btree.K(k), k)
+	}
+	return tree
+}
+
+func buildMap(keys []int) map[int]int {
+	m := make(map[int]int)
+	for _, k := range keys {
+		m[k] = k
+	}
+	return m
+}
+
+func BenchmarkBTreeInsert(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		keys := randomKeys(n)
+		var tree btree.Tree
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if i%n == 0 {
+				tree = btree.Immutable(btree.Degree(16))
+			}
+			tree = tree.With(btree.K(keys[i%n]), i)
+		}
+		sink = tree
+	})
+}
+
+func BenchmarkMapInsert(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		keys := randomKeys(n)
+		var m map[int]int
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if i%n == 0 {
+				m = make(map[int]int)
+			}
+			m[keys[i%n]] = i
+		}
+		sink = m
+	})
+}
+
+func BenchmarkBTreeLookup(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		keys := randomKeys(n)
+		tree := buildBTree(keys)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sink, _ = tree.Find(btree.K(keys[i%n]))
+		}
+	})
+}
+
+func BenchmarkMapLookup(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		keys := randomKeys(n)
+		m := buildMap(keys)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sink = m[keys[i%n]]
+		}
+	})
+}
+
+// Iterating in key order comes for free with a B-tree, whereas keys of a map
+// have to be sorted first.
+
+func BenchmarkBTreeIterate(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		tree := buildBTree(randomKeys(n))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sum := 0
+			for it := tree.Iterate(); it.Next(); {
+				sum += it.Value().(int)
+			}
+			sink = sum
+		}
+	})
+}
+
+func BenchmarkMapIterate(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		m := buildMap(randomKeys(n))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			keys := make([]int, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Ints(keys)
+			sum := 0
+			for _, k := range keys {
+				sum += m[k]
+			}
+			sink = sum
+		}
+	})
+}
+
+// Snapshots keep the previous version of a structure when modifying a single
+// entry. For a B-tree, this is what With does anyway. A map has to be cloned.
+
+func BenchmarkBTreeSnapshot(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		keys := randomKeys(n)
+		tree := buildBTree(keys)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sink = tree.With(btree.K(keys[i%n]), -1)
+		}
+	})
+}
+
+func BenchmarkMapSnapshot(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		keys := randomKeys(n)
+		m := buildMap(keys)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			snapshot := make(map[int]int, len(m))
+			for k, v := range m {
+				snapshot[k] = v
+			}
+			snapshot[keys[i%n]] = -1
+			sink = snapshot
+		}
+	})
+}
@@ -0,0 +1,42 @@
+/*
+Package bench holds benchmarks comparing the persistent data structures of this
+module with their mutable counterparts:
+
+   btree.Tree         vs. map plus sorting of keys
+   vector.Vector      vs. slice
+   persistent tree    vs. mutable tree (package fp/tree)
+
+Each pair is measured for the same set of workloads:
+
+   Insert      add elements one at a time
+   Lookup      find an element by key, index or path
+   Iterate     visit all elements, in order
+   Snapshot    modify a single element, keeping the previous version intact
+
+Run the suite with
+
+   go test -run xxx -bench . -benchmem ./persistent/bench
+
+to see timings and allocation counts per operation. Benchmarks are parameterized
+by the number of elements in a structure, reflected in the benchmark names.
+
+As a rule of thumb, B-trees and vectors pay for copy-on-write with a constant
+factor on Insert and Lookup, compared to maps and slices, and with additional
+allocations for every modification. The persistent tree does not need locks
+and is faster to read than the mutable tree. Persistent structures pay off as
+soon as versions of a structure have to be kept around (Snapshot), which for a
+mutable structure means copying it as a whole, with costs growing linearly with
+its size. Clients which never look at previous versions and do not share
+structures between goroutines are better off using maps and slices.
+
+This package does not contain any code apart from benchmarks.
+
+License
+
+Governed by a 3-Clause BSD license. License file may be found in the root
+folder of this module.
+
+Copyright © 2022 Norbert Pillmayer <norbert@pillmayer.com>
+
+*/
+package bench
@@ -0,0 +1,219 @@
+package bench
+
+import (
+	"testing"
+
+	ptree "github.com/npillmayer/fp/persistent/tree"
+	"github.com/npillmayer/fp/tree"
+)
+
+// --- Persistent tree vs. mutable tree -------------------------------------
+
+// Trees under test are complete trees with a fan-out of 4, with nodes numbered
+// breadth-first: the children of node i are nodes 4i+1 … 4i+4.
+const fanout = 4
+
+// pathTo returns the child indices leading from the root to node i.
+func pathTo(i int) []int {
+	if i == 0 {
+		return nil
+	}
+	return append(pathTo((i-1)/fanout), (i-1)%fanout)
+}
+
+// pathsTo returns the paths to the nodes with the given numbers.
+func pathsTo(nodes []int) [][]int {
+	paths := make([][]int, len(nodes))
+	for i, n := range nodes {
+		paths[i] = pathTo(n)
+	}
+	return paths
+}
+
+// leaves returns the numbers of the leaf nodes of a tree of n nodes.
+func leaves(n int) []int {
+	var l []int
+	for i := 0; i < n; i++ {
+		if fanout*i+1 >= n {
+			l = append(l, i)
+		}
+	}
+	return l
+}
+
+// buildPersistentTree builds a tree bottom-up, as adding a child to a node of
+// a persistent tree creates a new incarnation of the node.
+func buildPersistentTree(n int) *ptree.Node[int] {
+	nodes := make([]*ptree.Node[int], n)
+	for i := n - 1; i >= 0; i-- {
+		nodes[i] = persistentNode(nodes, i)
+	}
+	return nodes[0]
+}
+
+// persistentNode creates node i and attaches its children, which have to be
+// present in nodes.
+func persistentNode(nodes []*ptree.Node[int], i int) *ptree.Node[int] {
+	node := ptree.NewNode(i)
+	for c := fanout*i + 1; c <= fanout*i+fanout && c < len(nodes); c++ {
+		node = node.AddChild(nodes[c])
+	}
+	return node
+}
+
+func buildMutableTree(n int) *tree.Node[int] {
+	nodes := make([]*tree.Node[int], n)
+	for i := 0; i < n; i++ {
+		nodes[i] = tree.NewNode(i)
+		if i > 0 {
+			nodes[(i-1)/fanout].AddChild(nodes[i])
+		}
+	}
+	return nodes[0]
+}
+
+func BenchmarkPersistentTreeInsert(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		nodes := make([]*ptree.Node[int], n)
+		for i := 0; i < b.N; i++ {
+			k := n - 1 - i%n
+			nodes[k] = persistentNode(nodes, k)
+		}
+		sink = nodes[0]
+	})
+}
+
+func BenchmarkMutableTreeInsert(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		nodes := make([]*tree.Node[int], n)
+		for i := 0; i < b.N; i++ {
+			k := i % n
+			nodes[k] = tree.NewNode(k)
+			if k > 0 {
+				nodes[(k-1)/fanout].AddChild(nodes[k])
+			}
+		}
+		sink = nodes[0]
+	})
+}
+
+func BenchmarkPersistentTreeLookup(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		paths := pathsTo(randomKeys(n))
+		root := buildPersistentTree(n)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			node := root
+			for _, ch := range paths[i%n] {
+				node, _ = node.Child(ch)
+			}
+			sink = node
+		}
+	})
+}
+
+func BenchmarkMutableTreeLookup(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		paths := pathsTo(randomKeys(n))
+		root := buildMutableTree(n)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			node := root
+			for _, ch := range paths[i%n] {
+				node, _ = node.Child(ch)
+			}
+			sink = node
+		}
+	})
+}
+
+func sumPersistentTree(node *ptree.Node[int]) int {
+	sum := node.Payload
+	for i := 0; i < node.ChildCount(); i++ {
+		if ch, ok := node.Child(i); ok {
+			sum += sumPersistentTree(ch)
+		}
+	}
+	return sum
+}
+
+func sumMutableTree(node *tree.Node[int]) int {
+	sum := node.Payload
+	for i := 0; i < node.ChildCount(); i++ {
+		if ch, ok := node.Child(i); ok {
+			sum += sumMutableTree(ch)
+		}
+	}
+	return sum
+}
+
+func BenchmarkPersistentTreeIterate(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		root := buildPersistentTree(n)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sink = sumPersistentTree(root)
+		}
+	})
+}
+
+func BenchmarkMutableTreeIterate(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		root := buildMutableTree(n)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sink = sumMutableTree(root)
+		}
+	})
+}
+
+// Snapshots keep the previous version of a tree when replacing a single leaf.
+// For a persistent tree, the path from the root to the leaf is copied. A
+// mutable tree has to be copied as a whole.
+
+func BenchmarkPersistentTreeSnapshot(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		paths := pathsTo(leaves(n))
+		root := buildPersistentTree(n)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			path := paths[i%len(paths)]
+			ancestors := make([]*ptree.Node[int], len(path))
+			node := root
+			for d, ch := range path {
+				ancestors[d] = node
+				node, _ = node.Child(ch)
+			}
+			node = ptree.NewNode(-1)
+			for d := len(path) - 1; d >= 0; d-- {
+				node = ancestors[d].ReplaceChild(path[d], node)
+			}
+			sink = node
+		}
+	})
+}
+
+func cloneMutableTree(node *tree.Node[int]) *tree.Node[int] {
+	clone := tree.NewNode(node.Payload)
+	for _, ch := range node.Children(true) {
+		clone.AddChild(cloneMutableTree(ch))
+	}
+	return clone
+}
+
+func BenchmarkMutableTreeSnapshot(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		paths := pathsTo(leaves(n))
+		root := buildMutableTree(n)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			snapshot := cloneMutableTree(root)
+			node := snapshot
+			for _, ch := range paths[i%len(paths)] {
+				node, _ = node.Child(ch)
+			}
+			node.Payload = -1
+			sink = snapshot
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package bench
+
+import (
+	"testing"
+
+	"github.com/npillmayer/fp/persistent/vector"
+)
+
+// --- Vector vs. slice -----------------------------------------------------
+
+func buildSlice(n int) []int {
+	slice := make([]int, n)
+	for i := range slice {
+		slice[i] = i
+	}
+	return slice
+}
+
+func BenchmarkVectorInsert(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		var v vector.Vector[int]
+		for i := 0; i < b.N; i++ {
+			if i%n == 0 {
+				v = vector.Immutable[int]()
+			}
+			v = v.Push(i)
+		}
+		sink = v
+	})
+}
+
+func BenchmarkSliceInsert(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		var slice []int
+		for i := 0; i < b.N; i++ {
+			if i%n == 0 {
+				slice = nil
+			}
+			slice = append(slice, i)
+		}
+		sink = slice
+	})
+}
+
+func BenchmarkVectorLookup(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		keys := randomKeys(n)
+		v := vector.From(buildSlice(n))
+		b.ResetTimer()
+		sum := 0
+		for i := 0; i < b.N; i++ {
+			sum += v.Get(keys[i%n])
+		}
+		sink = sum
+	})
+}
+
+func BenchmarkSliceLookup(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		keys := randomKeys(n)
+		slice := buildSlice(n)
+		b.ResetTimer()
+		sum := 0
+		for i := 0; i < b.N; i++ {
+			sum += slice[keys[i%n]]
+		}
+		sink = sum
+	})
+}
+
+func BenchmarkVectorIterate(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		v := vector.From(buildSlice(n))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sum := 0
+			for it := v.Iterate(); it.Next(); {
+				sum += it.Value()
+			}
+			sink = sum
+		}
+	})
+}
+
+func BenchmarkSliceIterate(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		slice := buildSlice(n)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sum := 0
+			for _, x := range slice {
+				sum += x
+			}
+			sink = sum
+		}
+	})
+}
+
+// Snapshots keep the previous version of a structure when modifying a single
+// element. For a vector, this is what Set does anyway. A slice has to be copied.
+
+func BenchmarkVectorSnapshot(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		keys := randomKeys(n)
+		v := vector.From(buildSlice(n))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sink = v.Set(keys[i%n], -1)
+		}
+	})
+}
+
+func BenchmarkSliceSnapshot(b *testing.B) {
+	forSizes(b, func(b *testing.B, n int) {
+		keys := randomKeys(n)
+		slice := buildSlice(n)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			snapshot := make([]int, len(slice))
+			copy(snapshot, slice)
+			snapshot[keys[i%n]] = -1
+			sink = snapshot
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package btree
+
+import "sync"
+
+// --- Node arena ------------------------------------------------------------
+
+const defaultArenaChunkSize = 1024
+
+// NodeArena is an option to allocate tree nodes from an arena, instead of allocating
+// every node separately. The arena hands out nodes from chunks of chunkSize nodes
+// each (a chunkSize ≤ 0 selects a default of 1024). Nodes created during a
+// modification, but not being part of the resulting tree (e.g., an overfull node
+// which has been split), are put on a free-list and re-used for subsequent
+// modifications.
+//
+// Use it like this:
+//
+//     tree := btree.Immutable(btree.NodeArena(4096))
+//
+// The arena is shared by all incarnations derived from tree. The trade-off is as
+// follows: for trees with millions of items, the number of heap objects drops
+// considerably, which relieves the garbage collector from tracking and scanning
+// them. On the other hand, a chunk is garbage collected as a whole, i.e. only after
+// none of its nodes is referenced any more, by no incarnation of the tree.
+// Moreover, the arena has to be guarded by a mutex, which costs throughput of
+// single modifications, especially for concurrent modifications of incarnations
+// sharing an arena. Trees with a short life-span will usually fare better without
+// an arena. See the benchmarks in arena_test.go.
+func NodeArena(chunkSize int) Option {
+	return func(tree Tree) Tree {
+		tree.arena = newNodeArena(chunkSize)
+		return tree
+	}
+}
+
+// nodeArena allocates nodes from chunks of nodes, preferring nodes from a
+// free-list of released nodes. A nil arena allocates every node from the heap.
+type nodeArena struct {
+	sync.Mutex
+	chunkSize int
+	chunk     []xnode  // remainder of the current chunk
+	free      []*xnode // released nodes
+}
+
+func newNodeArena(chunkSize int) *nodeArena {
+	if chunkSize <= 0 {
+		chunkSize = defaultArenaChunkSize
+	}
+	return &nodeArena{chunkSize: chunkSize}
+}
+
+// node returns a pointer to a copy of n, allocated from the arena.
+// The item count of the copy is re-calculated from n's children.
+func (a *nodeArena) node(n xnode) *xnode {
+	n.recount()
+	if a == nil {
+		return &n
+	}
+	a.Lock()
+	defer a.Unlock()
+	var p *xnode
+	if l := len(a.free); l > 0 {
+		p = a.free[l-1]
+		a.free = a.free[:l-1]
+	} else {
+		if len(a.chunk) == 0 {
+			a.chunk = make([]xnode, a.chunkSize)
+		}
+		p = &a.chunk[0]
+		a.chunk = a.chunk[1:]
+	}
+	*p = n
+	return p
+}
+
+// release puts a transient node onto the free-list. Clients must make sure that
+// n is not referenced by any incarnation of a tree, i.e. only nodes which have
+// been created during the current modification may be released.
+func (a *nodeArena) release(n *xnode) {
+	if a == nil || n == nil {
+		return
+	}
+	*n = xnode{} // do not retain items and children
+	a.Lock()
+	a.free = append(a.free, n)
+	a.Unlock()
+}
@@ -0,0 +1,88 @@
+package btree
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/npillmayer/schuko/tracing"
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+)
+
+func TestArenaReusesReleasedNodes(t *testing.T) {
+	a := newNodeArena(4)
+	n := a.node(xnode{items: []xitem{{1, "1"}}})
+	a.release(n)
+	if n.items != nil {
+		t.Errorf("expected released node to be cleared, is %v", n)
+	}
+	if m := a.node(xnode{}); m != n {
+		t.Errorf("expected arena to re-use released node")
+	}
+	var nilArena *nodeArena
+	if nilArena.node(xnode{}) == nil {
+		t.Errorf("expected nil arena to allocate from heap")
+	}
+	nilArena.release(n) // must not panic
+}
+
+func TestArenaTreeKeepsIncarnations(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	keys := rand.New(rand.NewSource(42)).Perm(500)
+	tree := Immutable(NodeArena(16))
+	var versions []Tree
+	for _, k := range keys {
+		tree = tree.With(K(k), T(k))
+		versions = append(versions, tree)
+	}
+	for _, k := range keys[:400] { // deletions trigger re-balancing and release of nodes
+		tree = tree.WithDeleted(K(k))
+		tree = tree.With(K(1000+k), T(k))
+	}
+	for i, v := range versions { // all incarnations have to be unaffected
+		if l := len(v.Keys()); l != i+1 {
+			t.Fatalf("expected incarnation #%d to have %d keys, has %d", i, i+1, l)
+		}
+	}
+	if l := len(tree.Keys()); l != 500 {
+		t.Errorf("expected tree to have 500 keys, has %d", l)
+	}
+	for _, k := range keys[400:] {
+		if v, found := tree.Find(K(k)); !found || v != T(k) {
+			t.Errorf("expected to find %d in tree, found %v", k, v)
+		}
+	}
+	remaining := tree.Keys()
+	for i := 1; i < len(remaining); i++ {
+		if remaining[i] <= remaining[i-1] {
+			t.Fatalf("expected keys in ascending order, have %v", remaining)
+		}
+	}
+}
+
+// Benchmarks for inserting into trees with and without a node arena. Run with
+//
+//     go test -bench Insert -benchmem ./persistent/btree
+//
+// to compare allocations per operation.
+
+func benchmarkInsert(b *testing.B, opts ...Option) {
+	tracer().SetTraceLevel(tracing.LevelError)
+	keys := rand.New(rand.NewSource(42)).Perm(b.N)
+	tree := Immutable(opts...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for _, k := range keys {
+		tree = tree.With(K(k), T(nil))
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	benchmarkInsert(b, Degree(16))
+}
+
+func BenchmarkInsertWithArena(b *testing.B) {
+	benchmarkInsert(b, Degree(16), NodeArena(0))
+}
@@ -0,0 +1,7 @@
+//go:build debug
+
+package btree
+
+// debugAssertions lets failed consistency checks panic, even for trees created
+// with option Recover.
+const debugAssertions = true
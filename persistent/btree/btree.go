@@ -1,5 +1,7 @@
 package btree
 
+import "math"
+
 /*
 Remarks:
 --------
@@ -29,6 +31,10 @@ type Tree struct {
 	depth         uint
 	lowWaterMark  uint
 	highWaterMark uint
+	cmp           keyOrder    // optional ordering of keys, nil for natural order
+	eq            valueEq     // optional equality of values, nil for no comparison
+	arena         *nodeArena  // optional arena for node allocation
+	report        func(error) // recover from inconsistencies, see option Recover
 }
 
 // Immutable constructs a B-tree with options, if you need any.
@@ -68,6 +74,42 @@ func Degree(n int) Option {
 	}
 }
 
+// Compare is an option to order keys by a comparator instead of their natural
+// ordering. cmp(a, b) has to return a negative number for a < b, 0 for a = b and
+// a positive number for a > b, and has to be a strict weak ordering. Keys for
+// which cmp returns 0 are treated as identical, i.e. they denote the same entry
+// of the tree. Replacing the value of an entry keeps the key inserted first.
+//
+// Use it to support collation or composite keys, e.g., to order keys in
+// descending order:
+//
+//     tree := btree.Immutable(Compare(func(a, b K) int { return int(b - a) }))
+//
+// A tree and all of its incarnations have to use the same comparator.
+func Compare(cmp func(a, b K) int) Option {
+	return func(tree Tree) Tree {
+		tree.cmp = cmp
+		return tree
+	}
+}
+
+// Eq is an option to let the tree compare values. If a key is re-inserted with
+// a value equal to the one already associated with it, as reported by eq, the
+// tree is returned unchanged instead of creating a new incarnation.
+//
+// Without this option values are never compared, thus the tree may hold
+// values of arbitrary type, including uncomparable ones like slices or maps.
+// For comparable values, use it like this:
+//
+//     tree := btree.Immutable(Eq(func(a, b T) bool { return a == b }))
+//
+func Eq(eq func(a, b T) bool) Option {
+	return func(tree Tree) Tree {
+		tree.eq = eq
+		return tree
+	}
+}
+
 // --- API -------------------------------------------------------------------
 
 // Find locates a key in a tree, if present, and returns the value associated with the key.
@@ -86,14 +128,64 @@ func (tree Tree) Find(key K) (T, bool) {
 // If an entry for key is already present in tree, the associated value will be replaced
 // (in a new incarnation of the tree, nevertheless).
 func (tree Tree) With(key K, value T) Tree {
+	return tree.recovering(func() Tree {
+		return tree.with(key, value)
+	})
+}
+
+func (tree Tree) with(key K, value T) Tree {
 	var path slotPath = make([]slot, tree.depth)
 	var found bool
 	if found, path = tree.findKeyAndPath(key, path); found {
-		if path.last().item().value == value {
+		if tree.eq.equal(path.last().item().value, value) {
 			return tree // no need for modification
 		}
 		return tree.replacing(key, value, path) // otherwise copy with replaced value
 	}
+	return tree.inserting(key, value, path)
+}
+
+// WithUpdated returns a copy of a tree where the value associated with key is
+// replaced by the result of calling f with the current value. If key is not
+// present in tree, f is called with the zero value for type T and exists=false,
+// and the result of f is inserted.
+//
+// This is a single-pass alternative to calling Find followed by With, e.g.,
+// for incrementing counters:
+//
+//     tree = tree.WithUpdated(key, func(old T, exists bool) T {
+//         if !exists {
+//             return 1
+//         }
+//         return old.(int) + 1
+//     })
+//
+func (tree Tree) WithUpdated(key K, f func(old T, exists bool) T) Tree {
+	return tree.recovering(func() Tree {
+		return tree.withUpdated(key, f)
+	})
+}
+
+func (tree Tree) withUpdated(key K, f func(old T, exists bool) T) Tree {
+	var path slotPath = make([]slot, tree.depth)
+	var found bool
+	var old T
+	if found, path = tree.findKeyAndPath(key, path); found {
+		old = path.last().item().value
+	}
+	value := f(old, found)
+	if found {
+		if tree.eq.equal(old, value) {
+			return tree // no need for modification
+		}
+		return tree.replacing(key, value, path)
+	}
+	return tree.inserting(key, value, path)
+}
+
+// inserting returns a copy of a tree with a new item for key. path is the
+// slot path to the leaf where key has to be inserted, as found by findKeyAndPath.
+func (tree Tree) inserting(key K, value T, path slotPath) Tree {
 	tracer().Debugf("insert: slot path = %s", path)
 	item := xitem{key, value}
 	if tree.root == nil { // virgin tree => insert first node and return
@@ -103,20 +195,28 @@ func (tree Tree) With(key K, value T) Tree {
 	assertThat(leafSlot.node.isLeaf(), "attempt to insert item at non-leaf")
 	cow := leafSlot.node.withInsertedItem(item, leafSlot.index) // copy-on-write
 	tracer().Debugf("insert: created copy of (leaf + key@%d) = %s", leafSlot.index, cow)
-	newRoot := path.dropLast().foldR(splitAndClone(tree.highWaterMark),
-		slot{node: &cow, index: leafSlot.index},
+	newRoot := path.dropLast().foldR(splitAndClone(tree.highWaterMark, tree.cmp, tree.arena),
+		slot{node: tree.arena.node(cow), index: leafSlot.index},
 	)
 	tracer().Debugf("insert: new root = %s", newRoot)
+	newTree := tree.shallowClone()
 	if newRoot.node.overfull(tree.highWaterMark) {
-		newRoot = xnode{}.splitChild(newRoot)
-		tree.depth++ // miss-use of tree for intermediate storage of new depth
+		newRoot = xnode{}.splitChild(newRoot, tree.cmp, tree.arena)
+		newTree.depth++
 	}
-	return tree.shallowCloneWithRoot(*newRoot.node)
+	newTree.root = newRoot.node
+	return newTree
 }
 
-// With returns a copy of a tree with key deleted, if present, together with its associated value.
-// If key is not found, tree is returned unchanged.
+// WithDeleted returns a copy of a tree with key deleted, if present, together with its
+// associated value. If key is not found, tree is returned unchanged.
 func (tree Tree) WithDeleted(key K) Tree {
+	return tree.recovering(func() Tree {
+		return tree.withDeleted(key)
+	})
+}
+
+func (tree Tree) withDeleted(key K) Tree {
 	var path slotPath = make([]slot, tree.depth)
 	var found bool
 	if found, path = tree.findKeyAndPath(key, path); !found {
@@ -129,7 +229,7 @@ func (tree Tree) WithDeleted(key K) Tree {
 	if del.node.isLeaf() {
 		cow := del.node.withDeletedItem(del.index) // copy-on-write
 		tracer().Debugf("created copy of leaf w/out deleted item: %v", cow.items)
-		leafSlot = slot{node: &cow, index: del.index}
+		leafSlot = slot{node: tree.arena.node(cow), index: del.index}
 	} else { // for inner node:
 		// swap item with rightmost item of left subtree or leftmost item of right subtree
 		cow := del.node.clone()                                            // cow is clone of inner node
@@ -139,26 +239,126 @@ func (tree Tree) WithDeleted(key K) Tree {
 		l := leafPath.last()                                               //
 		cowLeaf = l.node.withDeletedItem(l.index)                          // remove stolen item from leaf
 		path = leafPath                                                    // continue with path from root to leaf
-		leafSlot = slot{node: &cowLeaf, index: l.index}                    // leaf to start balancing
+		leafSlot = slot{node: tree.arena.node(cowLeaf), index: l.index}    // leaf to start balancing
 	}
 	// balance from leaf-node upwards, starting at the leaf where we deleted an item
 	tracer().Debugf("after delete: path = %v", path)
-	newRoot := path.dropLast().foldR(balance(tree.lowWaterMark),
+	newRoot := path.dropLast().foldR(balance(tree.lowWaterMark, tree.arena),
 		leafSlot,
 	)
 	tracer().Debugf("deletion: new root = %s", newRoot)
-	newTree := tree.shallowCloneWithRoot(*newRoot.node)
+	newTree := tree.shallowClone()
+	newTree.root = newRoot.node
 	switch { // catch border cases where root is empty after deletion
-	case newRoot.len() == 0 && newRoot.node.children[0] != nil:
-		newTree.root = newRoot.node.children[0]
-		newTree.depth--
 	case newRoot.len() == 0 && newRoot.node.isLeaf():
 		newTree.root = nil
 		newTree.depth = 0
+		tree.arena.release(newRoot.node)
+	case newRoot.len() == 0 && newRoot.node.children[0] != nil:
+		newTree.root = newRoot.node.children[0]
+		newTree.depth--
+		tree.arena.release(newRoot.node)
 	}
 	return newTree
 }
 
+// --- Order statistics ------------------------------------------------------
+
+// Len returns the number of items in a tree.
+func (tree Tree) Len() int {
+	if tree.root == nil {
+		return 0
+	}
+	return tree.root.count
+}
+
+// Select returns the k-th smallest key of a tree (counting from 0), together with
+// its associated value. k has to be in the range 0 ≤ k < tree.Len(), otherwise
+// Select panics.
+//
+// Nodes keep track of the number of items in their sub-tree, therefore Select
+// runs in time proportional to the depth of the tree.
+func (tree Tree) Select(k int) (K, T) {
+	assertThat(k >= 0 && k < tree.Len(), "index out of range for Select")
+	node := tree.root
+	for !node.isLeaf() {
+		i := 0
+		for ; i < len(node.items); i++ {
+			c := node.children[i].count
+			if k < c {
+				break // k-th item is in child i
+			}
+			if k == c {
+				return node.items[i].key, node.items[i].value
+			}
+			k -= c + 1 // skip child i and item i
+		}
+		node = node.children[i]
+	}
+	return node.items[k].key, node.items[k].value
+}
+
+// Rank returns the number of keys in a tree which are smaller than key. If key is
+// present in the tree, this is the index of key for Select, i.e.
+//
+//     k, _ := tree.Select(tree.Rank(key))   // k == key
+//
+// Rank runs in time proportional to the depth of the tree.
+func (tree Tree) Rank(key K) int {
+	if tree.root == nil {
+		return 0
+	}
+	rank := 0
+	node := tree.root
+	for {
+		found, index := node.findSlot(key, tree.cmp)
+		rank += index // items left of index are smaller than key
+		if node.isLeaf() {
+			return rank
+		}
+		for _, ch := range node.children[:index] {
+			rank += ch.count
+		}
+		if found {
+			return rank + node.children[index].count
+		}
+		node = node.children[index]
+	}
+}
+
+// CountRange returns the number of keys of a tree with from ≤ key < to, i.e. the
+// number of entries Entries(from, to) would return. CountRange does not visit
+// the entries, but uses the item counts of nodes, thus it runs in time
+// proportional to the depth of the tree.
+func (tree Tree) CountRange(from, to K) int {
+	if n := tree.Rank(to) - tree.Rank(from); n > 0 {
+		return n
+	}
+	return 0
+}
+
+// ApproxQuantile returns the key at quantile q of a tree, for 0 ≤ q ≤ 1, using
+// the nearest rank. Keys are not interpolated, thus for q = 0.5 and a tree of
+// keys 1, 2, 3, 4, ApproxQuantile returns either 2 or 3 rather than 2.5.
+// Values of q out of range are clamped. ApproxQuantile returns false for an
+// empty tree.
+//
+// Like Select, ApproxQuantile runs in time proportional to the depth of the tree.
+func (tree Tree) ApproxQuantile(q float64) (K, bool) {
+	n := tree.Len()
+	if n == 0 {
+		var zero K
+		return zero, false
+	}
+	if q < 0 || math.IsNaN(q) {
+		q = 0
+	} else if q > 1 {
+		q = 1
+	}
+	k, _ := tree.Select(int(math.Round(q * float64(n-1))))
+	return k, true
+}
+
 // --- Ext -------------------------------------------------------------------
 
 // TreeExtension represents a B-tree as a tree and exposes some of its tree properties.
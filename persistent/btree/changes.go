@@ -0,0 +1,186 @@
+package btree
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// --- Changes between incarnations ------------------------------------------
+
+// ChangeSet lists the keys which differ between two tree incarnations, each in
+// key order.
+type ChangeSet struct {
+	Added    []K // keys present in tree b only
+	Removed  []K // keys present in tree a only
+	Modified []K // keys present in both trees, associated with different values
+	Compared int // number of entries compared, i.e. not skipped as shared
+}
+
+// Empty is a predicate wether a change set lists no changes.
+func (cs ChangeSet) Empty() bool {
+	return len(cs.Added) == 0 && len(cs.Removed) == 0 && len(cs.Modified) == 0
+}
+
+func (cs ChangeSet) String() string {
+	return fmt.Sprintf("added %v, removed %v, modified %v (%d entries compared)",
+		cs.Added, cs.Removed, cs.Modified, cs.Compared)
+}
+
+// Changes reports the keys added, removed and modified when going from tree a to
+// tree b. It is intended for invalidating caches, e.g. of layout results keyed by
+// document positions:
+//
+//     b := a.With(key, value).WithDeleted(other)
+//     cs := btree.Changes(a, b)   // cs.Added or cs.Modified = [key], cs.Removed = [other]
+//
+// Subtrees shared between a and b are skipped without visiting their entries,
+// thus for incarnations derived from one another, Changes is proportional to
+// the number of nodes copied rather than to the size of the trees. For trees
+// sharing no structure, all entries of both trees are compared.
+//
+// Values are compared with the equality of tree a (see option Eq). Without it,
+// values of comparable types are compared with ==, and values of other types
+// are reported as modified. Both trees have to use the same key order.
+func Changes(a, b Tree) ChangeSet {
+	var cs ChangeSet
+	sa, sb := newDiffStream(a.root), newDiffStream(b.root)
+	for {
+		hA, okA := sa.peek()
+		hB, okB := sb.peek()
+		switch {
+		case !okA && !okB:
+			return cs
+		case !okA:
+			sb.expandOrNext(hB, func(item *xitem) { cs.Added = append(cs.Added, item.key) })
+			continue
+		case !okB:
+			sa.expandOrNext(hA, func(item *xitem) { cs.Removed = append(cs.Removed, item.key) })
+			continue
+		}
+		if hA.subtree != nil && hA.subtree == hB.subtree { // shared
+			sa.next()
+			sb.next()
+			continue
+		}
+		if hA.subtree != nil || hB.subtree != nil {
+			// descend into the taller subtree, or into both if of equal height
+			if hA.subtree != nil && hA.height >= hB.height {
+				sa.expand(hA)
+			}
+			if hB.subtree != nil && hB.height >= hA.height {
+				sb.expand(hB)
+			}
+			continue
+		}
+		cs.Compared++
+		switch c := a.cmp.compare(hA.item.key, hB.item.key); {
+		case c < 0:
+			cs.Removed = append(cs.Removed, hA.item.key)
+			sa.next()
+		case c > 0:
+			cs.Added = append(cs.Added, hB.item.key)
+			sb.next()
+		default:
+			if !sameValue(a.eq, hA.item.value, hB.item.value) {
+				cs.Modified = append(cs.Modified, hA.item.key)
+			}
+			sa.next()
+			sb.next()
+		}
+	}
+}
+
+// sameValue compares values with eq, if present, or with == otherwise.
+// Values of uncomparable types are never the same without eq.
+func sameValue(eq valueEq, x, y T) bool {
+	if eq != nil {
+		return eq(x, y)
+	}
+	if x == nil || y == nil {
+		return x == y
+	}
+	if !reflect.TypeOf(x).Comparable() || !reflect.TypeOf(y).Comparable() {
+		return false
+	}
+	return x == y
+}
+
+// diffStream presents the entries of a tree in key order, with subtrees
+// interleaved: every subtree is presented before its entries, which allows
+// skipping it as a whole.
+type diffStream struct {
+	stack []diffFrame
+}
+
+// diffFrame is a position within a node: for inner nodes, even positions 2i
+// denote child i and odd positions 2i+1 denote item i; for leafs, position i
+// denotes item i.
+type diffFrame struct {
+	node   *xnode
+	pos    int
+	height int // height of the node, with leafs having height 1
+}
+
+// diffHead is the head of a diffStream, either a subtree or an item.
+type diffHead struct {
+	subtree *xnode
+	height  int // height of subtree
+	item    *xitem
+}
+
+func newDiffStream(root *xnode) *diffStream {
+	s := &diffStream{}
+	if root == nil {
+		return s
+	}
+	height := 1
+	for node := root; !node.isLeaf(); node = node.children[0] {
+		height++
+	}
+	// a pseudo-node holding the root as its single child, which makes the root a
+	// subtree to be compared
+	s.stack = append(s.stack, diffFrame{node: &xnode{children: []*xnode{root}}, height: height + 1})
+	return s
+}
+
+// peek returns the head of the stream, or false if the stream is exhausted.
+func (s *diffStream) peek() (diffHead, bool) {
+	for len(s.stack) > 0 {
+		f := s.stack[len(s.stack)-1]
+		if f.node.isLeaf() {
+			if f.pos < len(f.node.items) {
+				return diffHead{item: &f.node.items[f.pos]}, true
+			}
+		} else if f.pos <= 2*len(f.node.items) {
+			if f.pos%2 == 0 {
+				return diffHead{subtree: f.node.children[f.pos/2], height: f.height - 1}, true
+			}
+			return diffHead{item: &f.node.items[f.pos/2]}, true
+		}
+		s.stack = s.stack[:len(s.stack)-1]
+	}
+	return diffHead{}, false
+}
+
+// next skips the head of the stream.
+func (s *diffStream) next() {
+	s.stack[len(s.stack)-1].pos++
+}
+
+// expand replaces a subtree head by the contents of the subtree.
+func (s *diffStream) expand(h diffHead) {
+	s.next()
+	if h.subtree != nil {
+		s.stack = append(s.stack, diffFrame{node: h.subtree, height: h.height})
+	}
+}
+
+// expandOrNext expands a subtree head, or hands an item head to f and skips it.
+func (s *diffStream) expandOrNext(h diffHead, f func(*xitem)) {
+	if h.subtree != nil {
+		s.expand(h)
+		return
+	}
+	f(h.item)
+	s.next()
+}
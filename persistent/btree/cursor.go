@@ -0,0 +1,282 @@
+package btree
+
+// --- Cursor ----------------------------------------------------------------
+
+// Cursor is a position within a tree incarnation, which may be moved in both
+// directions and re-positioned by key or by rank. Use it like this:
+//
+//     c := tree.Cursor()
+//     if c.SeekGE(key) && c.Prev() {   // step back to the entry before key
+//         fmt.Printf("%v -> %v\n", c.Key(), c.Value())
+//     }
+//     tree = tree.With(key, value)
+//     c.Reseek(tree)                    // continue with the new incarnation
+//
+// Other than an Iterator, a Cursor is positioned at an entry after a successful
+// call of any of its methods, i.e. a fresh cursor has to be positioned with
+// First, Last, SeekGE, SeekLE or SeekRank. As a convenience, Next on a fresh
+// cursor moves to the first entry, and Prev to the last entry.
+//
+// Stepping beyond either end of the tree leaves the cursor unpositioned. Stepping
+// back in the opposite direction re-enters the tree at the end it has been left.
+//
+// As trees are immutable, a cursor is not affected by “modifications” of the
+// tree it has been created for. Re-seeking a new incarnation of a tree takes time
+// proportional to the depth of the tree.
+type Cursor struct {
+	tree Tree
+	path slotPath // path to the current item; top slot denotes the current item
+	edge int8     // if unpositioned: -1 before first, +1 after last, 0 fresh
+}
+
+// Cursor returns an unpositioned cursor for a tree.
+func (tree Tree) Cursor() *Cursor {
+	return &Cursor{tree: tree, path: make([]slot, 0, tree.depth+1)}
+}
+
+// Valid returns true if the cursor is positioned at an entry.
+func (c *Cursor) Valid() bool {
+	return c != nil && len(c.path) > 0
+}
+
+// Key returns the key of the current entry.
+// It is illegal to call Key if the cursor is not valid.
+func (c *Cursor) Key() K {
+	return c.path.last().item().key
+}
+
+// Value returns the value of the current entry.
+// It is illegal to call Value if the cursor is not valid.
+func (c *Cursor) Value() T {
+	return c.path.last().item().value
+}
+
+// Tree returns the tree incarnation the cursor operates on.
+func (c *Cursor) Tree() Tree {
+	return c.tree
+}
+
+// First moves the cursor to the entry with the smallest key. It returns false
+// for an empty tree.
+func (c *Cursor) First() bool {
+	c.path = c.path[:0]
+	for node := c.tree.root; node != nil; node = node.children[0] {
+		c.path = append(c.path, slot{node: node, index: 0})
+		if node.isLeaf() {
+			break
+		}
+	}
+	return c.settle(1, -1)
+}
+
+// Last moves the cursor to the entry with the largest key. It returns false
+// for an empty tree.
+func (c *Cursor) Last() bool {
+	c.path = c.path[:0]
+	if c.tree.root != nil {
+		c.descendRightmost(c.tree.root)
+	}
+	return c.settle(-1, 1)
+}
+
+// Next moves the cursor to the next entry in key order. It returns false if
+// there is none, leaving the cursor after the last entry.
+func (c *Cursor) Next() bool {
+	if c == nil {
+		return false
+	}
+	if len(c.path) == 0 {
+		if c.edge > 0 {
+			return false
+		}
+		return c.First()
+	}
+	top := &c.path[len(c.path)-1]
+	if !top.node.isLeaf() { // continue with the leftmost entry of the right subtree
+		top.index++ // index now denotes the child descended into
+		for node := top.node.children[top.index]; ; node = node.children[0] {
+			c.path = append(c.path, slot{node: node, index: 0})
+			if node.isLeaf() {
+				break
+			}
+		}
+		return c.settle(1, 1)
+	}
+	top.index++
+	return c.settle(1, 1)
+}
+
+// Prev moves the cursor to the previous entry in key order. It returns false if
+// there is none, leaving the cursor before the first entry.
+func (c *Cursor) Prev() bool {
+	if c == nil {
+		return false
+	}
+	if len(c.path) == 0 {
+		if c.edge < 0 {
+			return false
+		}
+		return c.Last()
+	}
+	top := &c.path[len(c.path)-1]
+	if !top.node.isLeaf() { // continue with the rightmost entry of the left subtree
+		c.descendRightmost(top.node.children[top.index])
+		return c.settle(-1, -1)
+	}
+	top.index--
+	return c.settle(-1, -1)
+}
+
+// SeekGE moves the cursor to the entry with the smallest key ≥ key. It returns
+// false if there is none, leaving the cursor after the last entry.
+func (c *Cursor) SeekGE(key K) bool {
+	if !c.seek(key) {
+		return c.settle(1, 1)
+	}
+	return true
+}
+
+// SeekLE moves the cursor to the entry with the largest key ≤ key. It returns
+// false if there is none, leaving the cursor before the first entry.
+func (c *Cursor) SeekLE(key K) bool {
+	if !c.seek(key) {
+		c.path[len(c.path)-1].index-- // items[index-1] is the largest key < key
+		return c.settle(-1, -1)
+	}
+	return true
+}
+
+// seek descends the tree, searching for key. It returns true if key has been
+// found. Otherwise the path ends in a leaf slot at the insertion point of key.
+func (c *Cursor) seek(key K) bool {
+	c.path = c.path[:0]
+	if c.tree.root == nil {
+		c.path = append(c.path, slot{node: &xnode{}}) // dummy leaf, settles to unpositioned
+		return false
+	}
+	node := c.tree.root
+	for {
+		found, index := node.findSlot(key, c.tree.cmp)
+		c.path = append(c.path, slot{node: node, index: index})
+		if found {
+			return true
+		}
+		if node.isLeaf() {
+			return false
+		}
+		node = node.children[index]
+	}
+}
+
+// SeekRank moves the cursor to the entry at position k in key order, counting
+// from 0 (see Select). It returns false if k is out of range, leaving the cursor
+// before the first entry (k < 0) or after the last entry.
+func (c *Cursor) SeekRank(k int) bool {
+	c.path = c.path[:0]
+	if k < 0 || k >= c.tree.Len() {
+		c.edge = 1
+		if k < 0 {
+			c.edge = -1
+		}
+		return false
+	}
+	node := c.tree.root
+	for !node.isLeaf() {
+		i := 0
+		for ; i < len(node.items); i++ {
+			cnt := node.children[i].count
+			if k < cnt {
+				break // k-th item is in child i
+			}
+			if k == cnt {
+				c.path = append(c.path, slot{node: node, index: i})
+				return true
+			}
+			k -= cnt + 1 // skip child i and item i
+		}
+		c.path = append(c.path, slot{node: node, index: i})
+		node = node.children[i]
+	}
+	c.path = append(c.path, slot{node: node, index: k})
+	return true
+}
+
+// Rank returns the position of the current entry in key order, counting from 0.
+// For an unpositioned cursor, Rank returns -1 before the first entry and the
+// number of entries after the last entry.
+func (c *Cursor) Rank() int {
+	if len(c.path) == 0 {
+		if c.edge < 0 {
+			return -1
+		}
+		return c.tree.Len()
+	}
+	rank := 0
+	for i, s := range c.path {
+		rank += s.index // items left of s.index precede the current entry
+		if s.node.isLeaf() {
+			continue
+		}
+		children := s.node.children[:s.index]
+		if i == len(c.path)-1 { // current item: its left subtree precedes it
+			children = s.node.children[:s.index+1]
+		}
+		for _, ch := range children {
+			rank += ch.count
+		}
+	}
+	return rank
+}
+
+// Reseek switches the cursor to another incarnation of its tree, usually a
+// “modified” copy, and moves it to the entry with the current key. If the key
+// is not present in tree, the cursor moves to the next entry, as with SeekGE.
+// Unpositioned cursors stay unpositioned. Reseek returns true if the cursor is
+// positioned at an entry.
+//
+// To keep the position by rank instead, e.g. for a rope, use
+//
+//     r := c.Rank()
+//     c.Reseek(tree)
+//     c.SeekRank(r)
+//
+func (c *Cursor) Reseek(tree Tree) bool {
+	if len(c.path) == 0 {
+		c.tree = tree
+		return false
+	}
+	key := c.Key()
+	c.tree = tree
+	return c.SeekGE(key)
+}
+
+// descendRightmost walks down the rightmost path of the subtree starting at node.
+// Slots of inner nodes denote the rightmost child.
+func (c *Cursor) descendRightmost(node *xnode) {
+	for !node.isLeaf() {
+		c.path = append(c.path, slot{node: node, index: len(node.items)})
+		node = node.children[len(node.items)]
+	}
+	c.path = append(c.path, slot{node: node, index: len(node.items) - 1})
+}
+
+// settle pops slots from the path which do not point to an item. With dir > 0
+// (moving forward), slots past the last item are popped; the slot of the parent
+// node then points to the next item. With dir < 0 (moving backward), slots
+// before the first item are popped, and the slot of the parent node is moved to
+// the item left of the child. If the path runs empty, the cursor is unpositioned
+// at edge. Returns true if the cursor is positioned at an entry.
+func (c *Cursor) settle(dir int, edge int8) bool {
+	for len(c.path) > 0 {
+		top := &c.path[len(c.path)-1]
+		if top.index >= 0 && top.index < len(top.node.items) {
+			return true
+		}
+		c.path = c.path[:len(c.path)-1]
+		if dir < 0 && len(c.path) > 0 {
+			c.path[len(c.path)-1].index--
+		}
+	}
+	c.edge = edge
+	return false
+}
@@ -9,6 +9,15 @@ is shared between original and copy, transparently to clients.
 
 Immutable trees are inherently concurrency-safe.
 
+For large static key sets, trees may be written to a file and opened as a
+memory-mapped read-only tree (see WriteMapped and MappedTree), which offers the
+same API for finding and iterating entries. Damaged files and files written
+with a different key order are rejected with an error when they are opened.
+
+Failed internal consistency checks panic by default. Trees created with option
+Recover, as well as WithOK and WithDeletedOK, turn them into errors and leave
+the tree in its previous incarnation. Builds with tag 'debug' always panic.
+
 Status
 
 Awaiting Go 1.18 with generics.
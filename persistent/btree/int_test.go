@@ -40,12 +40,13 @@ func TestInternalNodeSlice(t *testing.T) {
 	var keys = []K{1, 2, 3, 4, 5}
 	cap := ceiling(len(keys))
 	node.items = make([]xitem, len(keys), cap)
-	node.children = make([]*xnode, len(keys), cap)
+	node.children = make([]*xnode, len(keys)+1, cap)
 	grandson := &xnode{}
 	for i := 0; i < len(keys); i++ {
 		node.items[i] = xitem{key: keys[i], value: strconv.Itoa(int(keys[i]))}
 		node.children[i] = grandson
 	}
+	node.children[len(keys)] = grandson
 	var slices = []struct{ f, t, l int }{ // from, to, length
 		{f: 0, t: 0, l: 0},
 		{f: 0, t: 2, l: 2},
@@ -61,8 +62,12 @@ func TestInternalNodeSlice(t *testing.T) {
 			t.Logf("node = %s, slice(%d,%d) = %s", node, x.f, x.t, s)
 			t.Errorf("%d: expected items slice of length = %d, have %d", i, x.l, len(s.items))
 		}
-		if len(s.children) != x.l {
-			t.Errorf("%d: expected children slice of length = %d, have %d", i, x.l, len(s.items))
+		children := 0 // empty slices are empty nodes
+		if x.l > 0 {
+			children = x.l + 1 // inner nodes have one more child than items
+		}
+		if len(s.children) != children {
+			t.Errorf("%d: expected children slice of length = %d, have %d", i, children, len(s.children))
 		}
 	}
 }
@@ -107,6 +112,101 @@ func TestInternalNodeInsert(t *testing.T) {
 	}
 }
 
+func TestInternalInnerNodeInsert(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	defer teardown()
+	//
+	inner := xnode{items: []xitem{{key: 7}}, children: []*xnode{{}, {}}}
+	c0, c1 := inner.children[0], inner.children[1]
+	inner = inner.withInsertedItem(xitem{key: 3}, 0)
+	if len(inner.children) != 3 || inner.children[0] != c0 || inner.children[1] != nil || inner.children[2] != c1 {
+		t.Errorf("expected children of inner node to be [c0, nil, c1], are %v", inner.children)
+	}
+	inner = inner.withInsertedItem(xitem{key: 9}, 2)
+	if len(inner.children) != 4 || inner.children[2] != c1 || inner.children[3] != nil {
+		t.Errorf("expected children of inner node to be [c0, nil, c1, nil], are %v", inner.children)
+	}
+}
+
+func TestInternalInnerNodeSlice(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	defer teardown()
+	//
+	node := xnode{}
+	children := make([]*xnode, 6)
+	for i := range children {
+		children[i] = &xnode{}
+	}
+	for i := 0; i < 5; i++ {
+		node.items = append(node.items, xitem{key: K(i + 1)})
+	}
+	node.children = children
+	s := node.slice(1, 3) // items 2, 3
+	if len(s.items) != 2 || s.items[0].key != 2 || s.items[1].key != 3 {
+		t.Fatalf("expected slice(1,3) to hold items 2 and 3, is %s", s)
+	}
+	if len(s.children) != 3 || s.children[0] != children[1] || s.children[1] != children[2] ||
+		s.children[2] != children[3] {
+		t.Errorf("expected slice(1,3) to hold children #1…#3, are %v", s.children)
+	}
+	s = node.slice(3, -1) // items 4, 5
+	if len(s.children) != 3 || s.children[2] != children[5] {
+		t.Errorf("expected slice(3,-1) to hold children #3…#5, are %v", s.children)
+	}
+}
+
+func TestInternalSplitLeafRoot(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	defer teardown()
+	//
+	leaf := (&xnode{}).add(1, 2, 3, 4, 5)
+	root := xnode{}.splitChild(slot{node: leaf, index: 0}, nil, nil)
+	if len(root.node.items) != 1 || root.node.items[0].key != 3 {
+		t.Fatalf("expected new root to hold median 3, is %s", root.node)
+	}
+	if len(root.node.children) != 2 || root.node.children[0] == nil || root.node.children[1] == nil {
+		t.Fatalf("expected new root to have 2 children, has %v", root.node.children)
+	}
+	if l, r := root.node.children[0], root.node.children[1]; len(l.items) != 2 || len(r.items) != 2 {
+		t.Errorf("expected siblings of 2 items each, are %s and %s", l, r)
+	}
+}
+
+func TestInternalRotateRight(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	defer teardown()
+	//
+	// leafs: (10 20) with children (1 2 3) (11 12 13) (21)
+	a, b, c := (&xnode{}).add(1, 2, 3), (&xnode{}).add(11, 12, 13), (&xnode{}).add(21)
+	parent := (&xnode{}).add(10, 20)
+	parent.children = []*xnode{a, b, c}
+	p := slot{node: parent, index: 2}
+	rotated := p.rotateRight(slot{node: b, index: 1}, slot{node: c, index: 2}, nil)
+	n := rotated.node
+	if len(n.items) != 2 || n.items[0].key != 10 || n.items[1].key != 13 {
+		t.Fatalf("expected parent items to be (10 13), are %s", n)
+	}
+	if n.children[0] != a || len(n.children[1].items) != 2 || len(n.children[2].items) != 2 ||
+		n.children[2].items[0].key != 20 {
+		t.Errorf("expected children (1 2 3) (11 12) (20 21), are %v", n.children)
+	}
+	if parent.items[1].key != 20 || len(b.items) != 3 || len(c.items) != 1 {
+		t.Errorf("expected original nodes to be unchanged")
+	}
+	//
+	// inner siblings: separator 20 between (11 12 13) with 4 children and (21) with 2
+	bs := []*xnode{{}, {}, {}, {}}
+	cs := []*xnode{{}, {}}
+	b.children, c.children = bs, cs
+	n = p.rotateRight(slot{node: b, index: 1}, slot{node: c, index: 2}, nil).node
+	if ch := n.children[2].children; len(ch) != 3 || ch[0] != bs[3] || ch[1] != cs[0] || ch[2] != cs[1] {
+		t.Errorf("expected rightmost child of left sibling to move to right sibling, children are %v", ch)
+	}
+	if ch := n.children[1].children; len(ch) != 3 || ch[2] != bs[2] {
+		t.Errorf("expected left sibling to keep 3 children, are %v", ch)
+	}
+}
+
 func TestInternalNodeReplaceValue(t *testing.T) {
 	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
 	defer teardown()
@@ -181,25 +281,25 @@ func TestInternalFindSlot(t *testing.T) {
 	defer teardown()
 	//
 	node := (&xnode{}).add(1, 2, 3, 4, 5, 6, 7, 8, 9)
-	found, at := node.findSlot(7)
+	found, at := node.findSlot(7, nil)
 	if !found || at != 6 {
 		t.Logf("found = %v, at = %d", found, at)
 		t.Error("1: expected findSlot to find 7 at position 6, didn't")
 	}
 	node = (&xnode{}).add(1, 2, 3, 4, 5, 6, 8, 9)
-	found, at = node.findSlot(7)
+	found, at = node.findSlot(7, nil)
 	if found || at != 6 {
 		t.Logf("found = %v, at = %d", found, at)
 		t.Error("2: expected findSlot to find empty slot for 7 at position 6, didn't")
 	}
 	node = &xnode{}
-	found, at = node.findSlot(7)
+	found, at = node.findSlot(7, nil)
 	if found || at != 0 {
 		t.Logf("found = %v, at = %d", found, at)
 		t.Error("3: expected empty.findSlot to find empty slot for 7 at position 0, didn't")
 	}
 	node = (&xnode{}).add(1, 2, 3, 4, 5, 6)
-	found, at = node.findSlot(7)
+	found, at = node.findSlot(7, nil)
 	if found || at != 6 {
 		t.Logf("found = %v, at = %d", found, at)
 		t.Error("4: expected findSlot to find empty slot for 7 at final position 6, didn't")
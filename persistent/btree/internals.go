@@ -30,14 +30,21 @@ type xitem struct {
 
 // xnode is a type for tree nodes, either an internal node or a leaf.
 // For leafs, children will be nil.
+//
+// count is the number of items in the sub-tree rooted at the node. It is set
+// whenever a node is linked into a tree (see nodeArena.node), thus has to be
+// considered stale for transient nodes.
 type xnode struct {
 	items    []xitem
 	children []*xnode
+	count    int
 }
 
 // --- Tree ------------------------------------------------------------------
 
-func (tree Tree) shallowCloneWithRoot(node xnode) Tree {
+// shallowClone returns a copy of tree without a root, keeping depth, water marks,
+// key order, value equality and arena.
+func (tree Tree) shallowClone() Tree {
 	var newTree Tree
 	newTree.depth = tree.depth
 	newTree.lowWaterMark, newTree.highWaterMark = tree.lowWaterMark, tree.highWaterMark
@@ -45,12 +52,21 @@ func (tree Tree) shallowCloneWithRoot(node xnode) Tree {
 		newTree.lowWaterMark = defaultLowWaterMark
 		newTree.highWaterMark = defaultHighWaterMark
 	}
-	newTree.root = &node
+	newTree.cmp = tree.cmp
+	newTree.eq = tree.eq
+	newTree.arena = tree.arena
+	newTree.report = tree.report
+	return newTree
+}
+
+func (tree Tree) shallowCloneWithRoot(node xnode) Tree {
+	newTree := tree.shallowClone()
+	newTree.root = tree.arena.node(node)
 	return newTree
 }
 
 func (tree Tree) withDepth(d uint) Tree {
-	t := tree.shallowCloneWithRoot(xnode{})
+	t := tree.shallowClone()
 	t.root = tree.root
 	t.depth = d
 	return t
@@ -65,7 +81,7 @@ func (tree Tree) findKeyAndPath(key K, pathBuf slotPath) (found bool, path slotP
 	var node *xnode = tree.root // walking nodes, start search at the top
 	for !node.isLeaf() {
 		tracer().Debugf("finding inner node = %v", node)
-		found, index = node.findSlot(key)
+		found, index = node.findSlot(key, tree.cmp)
 		path = append(path, slot{node: node, index: index})
 		if found {
 			return // we have an exact match
@@ -73,7 +89,7 @@ func (tree Tree) findKeyAndPath(key K, pathBuf slotPath) (found bool, path slotP
 		node = node.children[index]
 	}
 	tracer().Debugf("finding leaf node %v", node)
-	found, index = node.findSlot(key)
+	found, index = node.findSlot(key, tree.cmp)
 	path = append(path, slot{node: node, index: index})
 	tracer().Debugf("slot path for key = %v -> %s", key, path)
 	return
@@ -83,11 +99,12 @@ func (tree Tree) replacing(key K, value T, path slotPath) (newTree Tree) {
 	assertThat(len(path) > 0, "cannot replace item without path")
 	tracer().Debugf("replace: slot path = %s", path)
 	hit := path[len(path)-1] // slot where `key` lives
-	item := xitem{key: key, value: value}
+	item := xitem{key: hit.item().key, value: value} // keep key, which may differ for custom key orders
 	cow := hit.node.withReplacedValue(item, hit.index)
 	tracer().Debugf("created copy of node for replacement: %#v", cow)
-	newRoot := path.dropLast().foldR(cloneSeam, slot{node: &cow, index: hit.index})
+	newRoot := path.dropLast().foldR(cloneSeam(tree.arena), slot{node: tree.arena.node(cow), index: hit.index})
 	tracer().Debugf("replace: top = %s", newRoot)
+	newTree = tree.shallowClone() // keep depth, water marks, key order and arena
 	newTree.root = newRoot.node
 	return
 }
@@ -159,8 +176,8 @@ func (node xnode) withInsertedItem(item xitem, at int) xnode {
 	cow.items = append(cow.items[:at], item)
 	cow.items = append(cow.items, node.items[at:]...)
 	if !cow.isLeaf() {
-		cow.children = append(cow.children[:at+1], nil) // insert placeholder
-		cow.children = append(cow.children, node.children[at:]...)
+		cow.children = append(cow.children[:at+1], nil) // insert placeholder right of item
+		cow.children = append(cow.children, node.children[at+1:]...)
 	}
 	return cow
 }
@@ -224,15 +241,15 @@ func (node xnode) cloneWithCapacity(cap int) xnode {
 	return n
 }
 
-// asNonLeaf asserts that a node is not a leaf. Returns a copy with an empty children-slice
-// allocated, if none present.
+// asNonLeaf asserts that a node is not a leaf. Returns a copy with a children-slice of
+// empty child links allocated, if none present.
 func (node xnode) asNonLeaf() xnode {
 	if !node.isLeaf() {
 		return node
 	}
 	return xnode{
 		items:    node.items,
-		children: make([]*xnode, 0, cap(node.items)),
+		children: make([]*xnode, len(node.items)+1, max(cap(node.items), len(node.items)+1)),
 	}
 }
 
@@ -247,9 +264,9 @@ func (node xnode) slice(from, to int) xnode {
 	size := to - from
 	s := xnode{items: make([]xitem, size, ceiling(size))}
 	copy(s.items, node.items[from:to])
-	if len(node.children) > 0 {
-		s.children = make([]*xnode, size, ceiling(size))
-		copy(s.children, node.children[from:to])
+	if len(node.children) > 0 { // inner nodes hold one more child than items
+		s.children = make([]*xnode, size+1, ceiling(size))
+		copy(s.children, node.children[from:to+1])
 	}
 	return s
 }
@@ -266,16 +283,60 @@ func (node xnode) underfull(lowWater uint) bool {
 	return len(node.items) < int(lowWater)
 }
 
-// findSlot searches a key within the items of node.
+// recount sets the item count of node from its items and the counts of its
+// children. Children have to be linked already.
+func (node *xnode) recount() {
+	node.count = len(node.items)
+	for _, ch := range node.children {
+		if ch != nil {
+			node.count += ch.count
+		}
+	}
+}
+
+// findSlot searches a key within the items of node, with keys ordered by cmp.
 // Returns the correct index for key, and found=true, if found exactly.
-func (node *xnode) findSlot(key K) (bool, int) {
+func (node *xnode) findSlot(key K, cmp keyOrder) (bool, int) {
 	items, itemcnt := node.items, len(node.items)
 	k := key
+	if cmp == nil { // natural ordering of keys
+		slotinx := sort.Search(itemcnt, func(i int) bool {
+			return items[i].key >= k // sort.Search will find the smallest i for which this is true
+		})
+		//tracer().Debugf("slot index ∈ %v = %d", items, slotinx)
+		return slotinx < itemcnt && k == items[slotinx].key, slotinx
+	}
 	slotinx := sort.Search(itemcnt, func(i int) bool {
-		return items[i].key >= k // sort.Search will find the smallest i for which this is true
+		return cmp(items[i].key, k) >= 0
 	})
-	//tracer().Debugf("slot index ∈ %v = %d", items, slotinx)
-	return slotinx < itemcnt && k == items[slotinx].key, slotinx
+	return slotinx < itemcnt && cmp(items[slotinx].key, k) == 0, slotinx
+}
+
+// valueEq is an equality predicate for values (see option Eq). A nil valueEq
+// never reports values as equal.
+type valueEq func(a, b T) bool
+
+func (eq valueEq) equal(a, b T) bool {
+	return eq != nil && eq(a, b)
+}
+
+// keyOrder is a comparator for keys (see option Compare). A nil keyOrder
+// denotes the natural ordering of keys.
+type keyOrder func(a, b K) int
+
+// compare compares keys a and b, returning a negative number for a < b, 0 for
+// a = b and a positive number for a > b.
+func (cmp keyOrder) compare(a, b K) int {
+	if cmp != nil {
+		return cmp(a, b)
+	}
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return +1
+	}
+	return 0
 }
 
 // --- Splitting and balancing -----------------------------------------------
@@ -299,63 +360,72 @@ in incarnations of the tree sharing most of the nodes.
 // Returns a modified copy of node with 2 new children, where the left one substitues a child of node.
 //
 // It's legal to pass in xnode{} as node (in order to create a new Tree.root).
+// The overfull child has to be a transient node and will be released to arena a.
 //
-func (node xnode) splitChild(ch slot) slot {
+func (node xnode) splitChild(ch slot, cmp keyOrder, a *nodeArena) slot {
 	child := ch.node
 	half := len(child.items) / 2
 	miditem := child.items[half] // find the median item to split at
 	siblingL := child.slice(0, half)
 	siblingR := child.slice(half+1, -1)
 	tracer().Debugf("split: med = %v, len(L) = %d, len(R) = %d", miditem, len(siblingL.items), len(siblingR.items))
-	found, index := node.findSlot(miditem.key)
+	found, index := node.findSlot(miditem.key, cmp)
 	assertThat(!found, "internal inconsistency: child has same key as parent (during split)")
 	cow := node.withInsertedItem(miditem, index).asNonLeaf()
 	tracer().Debugf("split: parent is now %s", cow)
-	cow.children[index] = &siblingL
-	cow.children[index+1] = &siblingR
-	return slot{node: &cow, index: index}
+	cow.children[index] = a.node(siblingL)
+	cow.children[index+1] = a.node(siblingR)
+	a.release(child) // child has been replaced by siblings
+	return slot{node: a.node(cow), index: index}
 }
 
-func cloneSeam(parent, child slot) slot {
-	tracer().Debugf("seam: parent = %s, child = %s", parent, child)
-	cowParent := parent.node.clone()
-	cowParent.children[parent.index] = child.node
-	return slot{node: &cowParent, index: parent.index}
+// cloneSeam returns a function to clone a parent node, linking it to a (new) child.
+func cloneSeam(a *nodeArena) func(slot, slot) slot {
+	return func(parent, child slot) slot {
+		tracer().Debugf("seam: parent = %s, child = %s", parent, child)
+		cowParent := parent.node.clone()
+		cowParent.children[parent.index] = child.node
+		return slot{node: a.node(cowParent), index: parent.index}
+	}
 }
 
-func splitAndClone(highWaterMark uint) func(slot, slot) slot {
+func splitAndClone(highWaterMark uint, cmp keyOrder, a *nodeArena) func(slot, slot) slot {
+	seam := cloneSeam(a)
 	return func(parent, child slot) slot {
 		tracer().Debugf("split&propagate: parent = %s, child = %s", parent, child)
 		if child.node.overfull(highWaterMark) {
 			tracer().Debugf("child is overfull: %v", child)
-			return parent.node.splitChild(child)
+			return parent.node.splitChild(child, cmp, a)
 		}
-		return cloneSeam(parent, child)
+		return seam(parent, child)
 	}
 }
 
-func balance(lowWaterMark uint) func(slot, slot) slot {
+func balance(lowWaterMark uint, a *nodeArena) func(slot, slot) slot {
+	seam := cloneSeam(a)
 	return func(parent, child slot) slot {
 		tracer().Debugf("balance: parent = %s, child = %s", parent, child)
 		if child.node.underfull(lowWaterMark) {
 			tracer().Debugf("child is underfull: %v", child)
-			return parent.balance(child, lowWaterMark)
+			newParent := parent.balance(child, lowWaterMark, a)
+			a.release(child.node) // child has been replaced by a clone
+			return newParent
 		}
-		return cloneSeam(parent, child)
+		return seam(parent, child)
 	}
 }
 
-func (parent slot) balance(child slot, lowWaterMark uint) slot {
+func (parent slot) balance(child slot, lowWaterMark uint, a *nodeArena) slot {
 	assertThat(len(parent.node.children) > 0, "attempt to balance parent w/ zero children")
 	if !parent.leftSibling(child).underfull(lowWaterMark + 1) {
 		// steal item from left sibling ⇒ rotate right
-		return parent.rotateRight(parent.leftSibling(child), child)
+		return parent.rotateRight(parent.leftSibling(child), child, a)
 	} else if !parent.rightSibling(child).underfull(lowWaterMark + 1) {
 		// steal item from right sibling ⇒ rotate left
-		return parent.rotateLeft(child, parent.rightSibling(child))
+		return parent.rotateLeft(child, parent.rightSibling(child), a)
 	}
 	// steal item from parent and merge with a sibling
-	return parent.merge(parent.siblings2(child))
+	return parent.merge(parent.siblings2(child), a)
 }
 
 // merge steals an item from parent and merges child with a sibling.
@@ -363,14 +433,14 @@ func (parent slot) balance(child slot, lowWaterMark uint) slot {
 //
 // siblings is the pair of slots to merge. child is one of this pair, and we need it to
 // know which item of the parent to extract.
-func (parent slot) merge(mi mergeinfo) slot {
+func (parent slot) merge(mi mergeinfo, a *nodeArena) slot {
 	assertThat(parent.len() > 0, "attempt to extract an item from an empty parent node")
 	assertThat(parent.node == mi.parent.node, "internal inconsistency")
 	tracer().Debugf("merge: parent = %s", mi.parent)
 	tracer().Debugf("       sibling L = %s", mi.left)
 	tracer().Debugf("       sibling R = %s", mi.right)
 	cow := parent.node.withDeletedItem(mi.parent.index)
-	newParent := slot{node: &cow, index: mi.parent.index}
+	newParent := slot{node: a.node(cow), index: mi.parent.index}
 	//lsbl, rsbl := siblings[0], siblings[1] // rsbl may be slot{}, i.e. empty
 	lsbl, rsbl := mi.left, mi.right // mi.right may be slot{}, i.e. empty
 	cap := lsbl.len() + rsbl.len() + 1
@@ -380,34 +450,38 @@ func (parent slot) merge(mi mergeinfo) slot {
 	cowch.items = append(cowch.items, rsbl.items()...)
 	if !cowch.isLeaf() && rsbl.len() > 0 {
 		cowch.children = append(cowch.children, rsbl.node.children...)
-		assertThat(len(cowch.children) == lsbl.len()+1, "internal inconsistency")
+		assertThat(len(cowch.children) == len(cowch.items)+1, "internal inconsistency")
 	}
-	cow.children[mi.parent.index] = &cowch // link new parent to new child
+	cow.children[mi.parent.index] = a.node(cowch) // link new parent to new child
+	newParent.node.recount()
 	return newParent
 }
 
-func (parent slot) rotateRight(lsbl, rsbl slot) slot {
+func (parent slot) rotateRight(lsbl, rsbl slot, a *nodeArena) slot {
 	cow := parent.node.clone()
-	newParent := slot{node: &cow, index: parent.index}
+	newParent := slot{node: a.node(cow), index: parent.index}
+	sep := slot{node: newParent.node, index: parent.index - 1} // item between siblings
 	// cut rightmost item from left sibling
 	cowlsbl, lsblxitem, grandChild := lsbl.node.withCutRight()
 	// replace parent item with item from left sibling
-	parentxitem := newParent.replaceItem(lsblxitem)
+	parentxitem := sep.replaceItem(lsblxitem)
 	// insert parent item as leftmost item in child
 	cowrsbl := rsbl.node.withInsertedItem(parentxitem, 0)
 	if !cowrsbl.isLeaf() {
 		assertThat(len(cowlsbl.children) == len(cowlsbl.items)+1, "insertion logic failed")
+		cowrsbl.children[1] = cowrsbl.children[0] // placeholder is right of inserted item
 		cowrsbl.children[0] = grandChild
 	}
 	// link new children of parent/cow
-	cow.children[parent.index] = &cowlsbl
-	cow.children[parent.index+1] = &cowrsbl
+	cow.children[sep.index] = a.node(cowlsbl)
+	cow.children[sep.index+1] = a.node(cowrsbl)
+	newParent.node.recount()
 	return newParent
 }
 
-func (parent slot) rotateLeft(lsbl, rsbl slot) slot {
+func (parent slot) rotateLeft(lsbl, rsbl slot, a *nodeArena) slot {
 	cow := parent.node.clone()
-	newParent := slot{node: &cow, index: parent.index}
+	newParent := slot{node: a.node(cow), index: parent.index}
 	// cut leftmost item from right sibling
 	cowrsbl, rsblxitem, grandChild := rsbl.node.withCutLeft()
 	// replace parent item with item from right sibling
@@ -419,8 +493,9 @@ func (parent slot) rotateLeft(lsbl, rsbl slot) slot {
 		cowlsbl.children[len(cowlsbl.items)] = grandChild
 	}
 	// link new children of parent/cow
-	cow.children[parent.index] = &cowlsbl
-	cow.children[parent.index+1] = &cowrsbl
+	cow.children[parent.index] = a.node(cowlsbl)
+	cow.children[parent.index+1] = a.node(cowrsbl)
+	newParent.node.recount()
 	return newParent
 }
 
@@ -485,7 +560,7 @@ func (s slot) findSucc(pathBuf slotPath) (bool, slotPath) {
 func assertThat(that bool, msg string, msgargs ...interface{}) {
 	if !that {
 		msg = fmt.Sprintf("btree: "+msg, msgargs...)
-		panic(msg)
+		panic(inconsistency{msg})
 	}
 }
 
@@ -0,0 +1,271 @@
+package btree
+
+// --- Iteration -------------------------------------------------------------
+
+// Iterator is a cursor which walks the entries of a tree incarnation in key order.
+// Use it like this:
+//
+//     it := tree.Iterate()
+//     for it.Next() {
+//         fmt.Printf("%v -> %v\n", it.Key(), it.Value())
+//     }
+//
+// As trees are immutable, an iterator is not affected by “modifications” of
+// the tree it has been created for.
+//
+// Iterators created by IterateReverse or IterateDownFrom walk the entries in
+// descending key order. Iterators of a MappedTree behave the same.
+type Iterator struct {
+	path    slotPath    // path to the current item; top slot denotes the current item
+	started bool        // has Next() been called at least once?
+	reverse bool        // iterate in descending key order?
+	mapped  *MappedTree // tree of a mapped iterator, path is unused
+	pos     int         // index of the current entry of a mapped iterator
+}
+
+// Iterate returns an iterator positioned before the entry with the smallest key.
+func (tree Tree) Iterate() *Iterator {
+	it := &Iterator{path: make([]slot, 0, tree.depth)}
+	if tree.root != nil {
+		it.descendLeftmost(tree.root)
+	}
+	return it
+}
+
+// IterateFrom returns an iterator positioned before the entry with the smallest
+// key ≥ from.
+func (tree Tree) IterateFrom(from K) *Iterator {
+	it := &Iterator{path: make([]slot, 0, tree.depth)}
+	if tree.root == nil {
+		return it
+	}
+	node := tree.root
+	for {
+		found, index := node.findSlot(from, tree.cmp)
+		it.path = append(it.path, slot{node: node, index: index})
+		if found || node.isLeaf() {
+			break
+		}
+		node = node.children[index]
+	}
+	it.skipExhausted()
+	return it
+}
+
+// IterateReverse returns an iterator positioned after the entry with the largest
+// key. The iterator walks the entries in descending key order.
+func (tree Tree) IterateReverse() *Iterator {
+	it := &Iterator{path: make([]slot, 0, tree.depth), reverse: true}
+	if tree.root != nil {
+		it.descendRightmost(tree.root)
+	}
+	return it
+}
+
+// IterateDownFrom returns an iterator positioned after the entry with the largest
+// key ≤ from. The iterator walks the entries in descending key order.
+//
+// To find the last entry before a position p, use it like this:
+//
+//     if it := tree.IterateDownFrom(p-1); it.Next() {
+//         fmt.Printf("%v -> %v\n", it.Key(), it.Value())
+//     }
+//
+func (tree Tree) IterateDownFrom(from K) *Iterator {
+	it := &Iterator{path: make([]slot, 0, tree.depth), reverse: true}
+	if tree.root == nil {
+		return it
+	}
+	node := tree.root
+	for {
+		found, index := node.findSlot(from, tree.cmp)
+		if found {
+			it.path = append(it.path, slot{node: node, index: index})
+			break
+		}
+		// items[index-1] is the largest key < from; for inner nodes it will be
+		// visited after the subtree left of items[index]
+		it.path = append(it.path, slot{node: node, index: index - 1})
+		if node.isLeaf() {
+			break
+		}
+		node = node.children[index]
+	}
+	it.skipExhausted()
+	return it
+}
+
+// Next moves the iterator to the next entry. It returns false if there are no
+// more entries.
+func (it *Iterator) Next() bool {
+	if it != nil && it.mapped != nil {
+		return it.nextMapped()
+	}
+	if it == nil || len(it.path) == 0 {
+		return false
+	}
+	if !it.started { // first call: iterator is already positioned at first entry
+		it.started = true
+		return true
+	}
+	top := &it.path[len(it.path)-1]
+	if it.reverse {
+		top.index--
+		if !top.node.isLeaf() { // continue with the rightmost entry of the left subtree
+			it.descendRightmost(top.node.children[top.index+1])
+			return true
+		}
+		it.skipExhausted()
+		return len(it.path) > 0
+	}
+	top.index++
+	if !top.node.isLeaf() { // continue with the leftmost entry of the right subtree
+		it.descendLeftmost(top.node.children[top.index])
+		return true
+	}
+	it.skipExhausted()
+	return len(it.path) > 0
+}
+
+// Key returns the key of the current entry.
+// It is illegal to call Key if Next has not returned true.
+func (it *Iterator) Key() K {
+	if it.mapped != nil {
+		return it.mapped.key(it.pos)
+	}
+	return it.path.last().item().key
+}
+
+// Value returns the value of the current entry.
+// It is illegal to call Value if Next has not returned true.
+//
+// For iterators of a MappedTree, a value which cannot be decoded is reported
+// (see MappedTree) and returned as nil.
+func (it *Iterator) Value() T {
+	value, err := it.ValueOK()
+	if err != nil {
+		it.mapped.reportError(err)
+	}
+	return value
+}
+
+// ValueOK is like Value, but returns an error for a value of a MappedTree which
+// cannot be decoded (see MappedTree.FindOK). For in-memory trees, the error is
+// always nil.
+func (it *Iterator) ValueOK() (T, error) {
+	if it.mapped != nil {
+		return it.mapped.value(it.pos)
+	}
+	return it.path.last().item().value, nil
+}
+
+// nextMapped moves a mapped iterator to the next entry.
+func (it *Iterator) nextMapped() bool {
+	if it.reverse {
+		if it.pos > 0 {
+			it.pos--
+			return true
+		}
+		it.pos = -1
+		return false
+	}
+	if it.pos < it.mapped.Len()-1 {
+		it.pos++
+		return true
+	}
+	it.pos = it.mapped.Len()
+	return false
+}
+
+// descendLeftmost walks down the leftmost path of the subtree starting at node.
+func (it *Iterator) descendLeftmost(node *xnode) {
+	for node != nil {
+		it.path = append(it.path, slot{node: node, index: 0})
+		if node.isLeaf() {
+			break
+		}
+		node = node.children[0]
+	}
+	it.skipExhausted()
+}
+
+// descendRightmost walks down the rightmost path of the subtree starting at node.
+// For inner nodes, the slot points to the last item, which will be visited after
+// the rightmost child.
+func (it *Iterator) descendRightmost(node *xnode) {
+	for node != nil {
+		it.path = append(it.path, slot{node: node, index: len(node.items) - 1})
+		if node.isLeaf() {
+			break
+		}
+		node = node.children[len(node.items)]
+	}
+	it.skipExhausted()
+}
+
+// skipExhausted pops slots from the path which do not point to an item, i.e.,
+// we've already visited all the items of the node.
+func (it *Iterator) skipExhausted() {
+	for len(it.path) > 0 {
+		top := it.path[len(it.path)-1]
+		if top.index >= 0 && top.index < len(top.node.items) {
+			return
+		}
+		it.path = it.path[:len(it.path)-1]
+	}
+}
+
+// --- Convenience -----------------------------------------------------------
+
+// Entry is a key/value pair of a tree.
+type Entry struct {
+	Key   K
+	Value T
+}
+
+// Keys returns all keys of a tree in key order.
+func (tree Tree) Keys() []K {
+	keys := make([]K, 0, 16)
+	for it := tree.Iterate(); it.Next(); {
+		keys = append(keys, it.Key())
+	}
+	return keys
+}
+
+// Values returns all values of a tree, in the order of their keys.
+func (tree Tree) Values() []T {
+	values := make([]T, 0, 16)
+	for it := tree.Iterate(); it.Next(); {
+		values = append(values, it.Value())
+	}
+	return values
+}
+
+// Thaw returns the entries of a tree as a map, the transient counterpart of a
+// tree (see package persistent). Changes to the map do not affect the tree.
+func (tree Tree) Thaw() map[K]T {
+	m := make(map[K]T, tree.Len())
+	for it := tree.Iterate(); it.Next(); {
+		m[it.Key()] = it.Value()
+	}
+	return m
+}
+
+// Entries returns the entries of a tree with from ≤ key < to, in key order.
+func (tree Tree) Entries(from, to K) []Entry {
+	var entries []Entry
+	for it := tree.IterateFrom(from); it.Next() && tree.cmp.compare(it.Key(), to) < 0; {
+		entries = append(entries, Entry{it.Key(), it.Value()})
+	}
+	return entries
+}
+
+// DescendRange returns the entries of a tree with hi ≥ key > lo, in descending
+// key order. Only the entries within the range are visited.
+func (tree Tree) DescendRange(hi, lo K) []Entry {
+	var entries []Entry
+	for it := tree.IterateDownFrom(hi); it.Next() && tree.cmp.compare(it.Key(), lo) > 0; {
+		entries = append(entries, Entry{it.Key(), it.Value()})
+	}
+	return entries
+}
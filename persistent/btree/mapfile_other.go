@@ -0,0 +1,21 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package btree
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the contents of a file into memory, for platforms without
+// support for memory-mapping.
+func mapFile(f *os.File) (data []byte, unmap func([]byte) error, err error) {
+	data, err = io.ReadAll(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) < mappedHeaderSize {
+		return nil, nil, ErrMappedFormat
+	}
+	return data, func([]byte) error { return nil }, nil
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package btree
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps the contents of a file into memory, read-only. The mapping
+// stays valid after the file has been closed, until it is released by unmap.
+func mapFile(f *os.File) (data []byte, unmap func([]byte) error, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := info.Size()
+	if size < mappedHeaderSize || size != int64(int(size)) {
+		return nil, nil, ErrMappedFormat
+	}
+	data, err = syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, syscall.Munmap, nil
+}
@@ -0,0 +1,372 @@
+package btree
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// --- Memory-mapped read-only trees ------------------------------------------
+
+// ReadOnly is the ordered-map interface shared by in-memory trees and
+// memory-mapped trees (see MappedTree).
+type ReadOnly interface {
+	Find(key K) (T, bool)
+	Len() int
+	Iterate() *Iterator
+	IterateFrom(from K) *Iterator
+	IterateReverse() *Iterator
+	IterateDownFrom(from K) *Iterator
+}
+
+var _ ReadOnly = Tree{}
+var _ ReadOnly = (*MappedTree)(nil)
+
+// ValueCodec converts values of a tree to bytes and back, for storing them in a
+// file for a MappedTree. Decode is handed a slice of the mapped file, which
+// becomes invalid when the tree is closed; values must therefore not retain it.
+// Decode returns an error for bytes it cannot convert, e.g. of a damaged file.
+type ValueCodec struct {
+	Encode func(value T) ([]byte, error)
+	Decode func(b []byte) (T, error)
+}
+
+// StringValues is a codec for trees with values of type string.
+var StringValues = ValueCodec{
+	Encode: func(value T) ([]byte, error) {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("value %v is not a string", value)
+		}
+		return []byte(s), nil
+	},
+	Decode: func(b []byte) (T, error) {
+		return string(b), nil // copies b
+	},
+}
+
+// IntValues is a codec for trees with values of type int, e.g. glyph indexes.
+var IntValues = ValueCodec{
+	Encode: func(value T) ([]byte, error) {
+		n, ok := value.(int)
+		if !ok {
+			return nil, fmt.Errorf("value %v is not an int", value)
+		}
+		b := make([]byte, binary.MaxVarintLen64)
+		return b[:binary.PutVarint(b, int64(n))], nil
+	},
+	Decode: func(b []byte) (T, error) {
+		n, l := binary.Varint(b)
+		if l <= 0 || l != len(b) || n != int64(int(n)) {
+			return nil, ErrMappedFormat
+		}
+		return int(n), nil
+	},
+}
+
+// ErrMappedFormat is returned by OpenMapped for files which have not been
+// written by WriteMapped, or which have been truncated or corrupted. Errors for
+// values of a MappedTree which cannot be decoded wrap ErrMappedFormat.
+var ErrMappedFormat = errors.New("btree: not a mapped tree file")
+
+// ErrMappedOrder is returned by OpenMapped if the key order of a file does not
+// match the key order requested by the client (see option Compare).
+var ErrMappedOrder = errors.New("btree: key order of mapped tree does not match")
+
+// Layout of a mapped tree file, with all numbers little-endian:
+//
+//     magic    "FPBT"
+//     version  uint32
+//     count    uint64            number of entries n
+//     order    uint32            key order, natural or custom (see option Compare)
+//     keys     n × int64         in key order
+//     offsets  (n+1) × uint64    start of value i within values, end of values
+//     values   bytes             encoded values
+//
+var mappedMagic = [4]byte{'F', 'P', 'B', 'T'}
+
+const mappedVersion = 2
+const mappedHeaderSize = 20
+
+// Key orders of mapped tree files.
+const (
+	mappedNaturalOrder uint32 = iota // keys in natural order
+	mappedCustomOrder                // keys ordered by a comparator (see option Compare)
+)
+
+// WriteMapped writes the entries of a tree to w, in the format read by
+// OpenMapped. Values are encoded with codec. The tree is usually built in
+// memory once, e.g. by a tool preparing a dictionary, and opened as a
+// MappedTree afterwards:
+//
+//     f, _ := os.Create("exceptions.bt")
+//     err := btree.WriteMapped(f, tree, btree.StringValues)
+//     …
+//     mt, err := btree.OpenMapped("exceptions.bt", btree.StringValues)
+//     defer mt.Close()
+//     value, found := mt.Find(42)
+//
+func WriteMapped(w io.Writer, tree Tree, codec ValueCodec) error {
+	n := tree.Len()
+	values := make([][]byte, 0, n)
+	keys := make([]K, 0, n)
+	for it := tree.Iterate(); it.Next(); {
+		b, err := codec.Encode(it.Value())
+		if err != nil {
+			return err
+		}
+		keys = append(keys, it.Key())
+		values = append(values, b)
+	}
+	bw := bufio.NewWriter(w)
+	var buf [8]byte
+	put := func(x uint64) {
+		binary.LittleEndian.PutUint64(buf[:], x)
+		bw.Write(buf[:]) // errors are sticky, see Flush
+	}
+	bw.Write(mappedMagic[:])
+	binary.LittleEndian.PutUint32(buf[:4], mappedVersion)
+	bw.Write(buf[:4])
+	put(uint64(len(keys)))
+	order := mappedNaturalOrder
+	if tree.cmp != nil {
+		order = mappedCustomOrder
+	}
+	binary.LittleEndian.PutUint32(buf[:4], order)
+	bw.Write(buf[:4])
+	for _, key := range keys {
+		put(uint64(key))
+	}
+	offset := uint64(0)
+	for _, b := range values {
+		put(offset)
+		offset += uint64(len(b))
+	}
+	put(offset)
+	for _, b := range values {
+		bw.Write(b)
+	}
+	return bw.Flush()
+}
+
+// MappedTree is a read-only tree backed by a memory-mapped file, written by
+// WriteMapped. It is intended for large static key sets, e.g. hyphenation
+// exception dictionaries or glyph indexes, which would occupy a lot of memory
+// as an in-memory tree: entries are paged in from the file by the operating
+// system when they are accessed. On platforms without memory-mapping the file
+// is read into memory.
+//
+// Keys are searched by binary search. A MappedTree offers the read-only API of
+// Tree (see ReadOnly), including iterators, and is safe for concurrent use
+// until it is closed.
+//
+// Values are decoded on access. Find and Iterator.Value treat values which
+// cannot be decoded as missing. The error is traced and reported to the
+// function given with option Recover, if any. Use FindOK and Iterator.ValueOK
+// to receive these errors instead.
+type MappedTree struct {
+	data    []byte      // the mapped file
+	count   int         // number of entries
+	keys    []byte      // key section of data
+	offsets []byte      // offset section of data
+	values  []byte      // value section of data
+	cmp     keyOrder    // optional ordering of keys, nil for natural order
+	codec   ValueCodec  // decoding of values
+	report  func(error) // report values which cannot be decoded, see option Recover
+	unmap   func([]byte) error
+}
+
+// OpenMapped opens a file written by WriteMapped as a read-only tree. Values
+// are decoded with codec, which has to match the codec the file has been
+// written with. If the tree has been written with a custom key order, option
+// Compare with the same order has to be given, otherwise ErrMappedOrder is
+// returned. Keys are checked to ascend in the key order of the tree, which
+// pages in the key section of the file once. Option Recover is respected as
+// well (see MappedTree), other options are ignored.
+//
+// Clients have to call Close to release the mapping.
+func OpenMapped(path string, codec ValueCodec, opts ...Option) (*MappedTree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, unmap, err := mapFile(f)
+	if err != nil {
+		return nil, err
+	}
+	options := Immutable(opts...)
+	mt, err := newMappedTree(data, codec, options.cmp)
+	if err != nil {
+		unmap(data)
+		return nil, err
+	}
+	mt.unmap = unmap
+	mt.report = options.report
+	tracer().Debugf("opened mapped tree %s with %d entries", path, mt.count)
+	return mt, nil
+}
+
+// newMappedTree checks the structure and the key order of the data of a mapped
+// tree file and sets up the sections of a tree.
+func newMappedTree(data []byte, codec ValueCodec, cmp keyOrder) (*MappedTree, error) {
+	if len(data) < mappedHeaderSize || string(data[:4]) != string(mappedMagic[:]) {
+		return nil, ErrMappedFormat
+	}
+	if v := binary.LittleEndian.Uint32(data[4:8]); v != mappedVersion {
+		return nil, fmt.Errorf("btree: unsupported mapped tree version %d", v)
+	}
+	count := binary.LittleEndian.Uint64(data[8:16])
+	// keys and offsets need 16 bytes per entry, plus the offset of the end of values
+	if len(data) < mappedHeaderSize+8 || count > uint64(len(data)-mappedHeaderSize-8)/16 {
+		return nil, ErrMappedFormat
+	}
+	n := int(count)
+	mt := &MappedTree{data: data, count: n, cmp: cmp, codec: codec}
+	mt.keys = data[mappedHeaderSize : mappedHeaderSize+8*n]
+	mt.offsets = data[mappedHeaderSize+8*n : mappedHeaderSize+16*n+8]
+	mt.values = data[mappedHeaderSize+16*n+8:]
+	var last uint64
+	for i := 0; i <= n; i++ { // offsets have to ascend, starting at 0
+		off := mt.offset(i)
+		if off < last || (i == 0 && off != 0) {
+			return nil, ErrMappedFormat
+		}
+		last = off
+	}
+	if last != uint64(len(mt.values)) {
+		return nil, ErrMappedFormat
+	}
+	return mt, mt.checkOrder(binary.LittleEndian.Uint32(data[16:20]))
+}
+
+// checkOrder checks that the key order of a file matches the key order of mt
+// and that keys are ascending.
+func (mt *MappedTree) checkOrder(order uint32) error {
+	switch {
+	case order != mappedNaturalOrder && order != mappedCustomOrder:
+		return ErrMappedFormat
+	case (order == mappedCustomOrder) != (mt.cmp != nil):
+		return ErrMappedOrder
+	}
+	for i := 1; i < mt.count; i++ {
+		if mt.cmp.compare(mt.key(i-1), mt.key(i)) >= 0 {
+			if mt.cmp == nil {
+				return ErrMappedFormat
+			}
+			return ErrMappedOrder // comparator differs from the one of the file
+		}
+	}
+	return nil
+}
+
+// Close releases the mapping of a tree. Afterwards, the tree and its iterators
+// must not be used any more.
+func (mt *MappedTree) Close() error {
+	if mt == nil || mt.data == nil {
+		return nil
+	}
+	data, unmap := mt.data, mt.unmap
+	*mt = MappedTree{}
+	if unmap == nil {
+		return nil
+	}
+	return unmap(data)
+}
+
+// Len returns the number of entries of a tree.
+func (mt *MappedTree) Len() int {
+	if mt == nil {
+		return 0
+	}
+	return mt.count
+}
+
+// Find returns the value associated with key, if present. A value which cannot
+// be decoded is reported (see MappedTree) and treated as missing.
+func (mt *MappedTree) Find(key K) (T, bool) {
+	value, found, err := mt.FindOK(key)
+	if err != nil {
+		mt.reportError(err)
+		return nil, false
+	}
+	return value, found
+}
+
+// FindOK is like Find, but returns an error wrapping ErrMappedFormat, or the
+// error of the codec, if the value associated with key cannot be decoded.
+func (mt *MappedTree) FindOK(key K) (T, bool, error) {
+	i := mt.search(key)
+	if i < mt.Len() && mt.cmp.compare(mt.key(i), key) == 0 {
+		value, err := mt.value(i)
+		return value, err == nil, err
+	}
+	return nil, false, nil
+}
+
+// Iterate returns an iterator positioned before the entry with the smallest key.
+func (mt *MappedTree) Iterate() *Iterator {
+	return &Iterator{mapped: mt, pos: -1}
+}
+
+// IterateFrom returns an iterator positioned before the entry with the smallest
+// key ≥ from.
+func (mt *MappedTree) IterateFrom(from K) *Iterator {
+	return &Iterator{mapped: mt, pos: mt.search(from) - 1}
+}
+
+// IterateReverse returns an iterator positioned after the entry with the largest
+// key. The iterator walks the entries in descending key order.
+func (mt *MappedTree) IterateReverse() *Iterator {
+	return &Iterator{mapped: mt, pos: mt.Len(), reverse: true}
+}
+
+// IterateDownFrom returns an iterator positioned after the entry with the largest
+// key ≤ from. The iterator walks the entries in descending key order.
+func (mt *MappedTree) IterateDownFrom(from K) *Iterator {
+	i := mt.search(from)
+	if i < mt.Len() && mt.cmp.compare(mt.key(i), from) == 0 {
+		i++
+	}
+	return &Iterator{mapped: mt, pos: i, reverse: true}
+}
+
+// search returns the index of the first entry with a key ≥ key.
+func (mt *MappedTree) search(key K) int {
+	return sort.Search(mt.Len(), func(i int) bool {
+		return mt.cmp.compare(mt.key(i), key) >= 0
+	})
+}
+
+func (mt *MappedTree) key(i int) K {
+	return K(int64(binary.LittleEndian.Uint64(mt.keys[8*i:])))
+}
+
+func (mt *MappedTree) offset(i int) uint64 {
+	return binary.LittleEndian.Uint64(mt.offsets[8*i:])
+}
+
+func (mt *MappedTree) value(i int) (T, error) {
+	from, to := mt.offset(i), mt.offset(i+1)
+	if from > to || to > uint64(len(mt.values)) { // file has been modified while mapped
+		return nil, fmt.Errorf("btree: value of key %d: %w", mt.key(i), ErrMappedFormat)
+	}
+	value, err := mt.codec.Decode(mt.values[from:to:to])
+	if err != nil {
+		return nil, fmt.Errorf("btree: value of key %d: %w", mt.key(i), err)
+	}
+	return value, nil
+}
+
+// reportError reports an error for a value which cannot be decoded to the
+// function given with option Recover.
+func (mt *MappedTree) reportError(err error) {
+	tracer().Errorf("mapped tree: %v", err)
+	if mt.report != nil {
+		mt.report(err)
+	}
+}
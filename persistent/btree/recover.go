@@ -0,0 +1,103 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// --- Recovering from internal inconsistencies ------------------------------
+
+// ErrInconsistency is the error reported for a failed internal consistency
+// check of a tree, which hints at a bug in package btree or at a tree which has
+// been corrupted, e.g. by modifying values shared with other incarnations.
+// Errors returned by WithOK and WithDeletedOK, and reported for trees created
+// with option Recover, wrap ErrInconsistency.
+var ErrInconsistency = errors.New("btree: internal inconsistency")
+
+// inconsistency is the value assertThat panics with.
+type inconsistency struct {
+	msg string
+}
+
+func (e inconsistency) Error() string {
+	return e.msg
+}
+
+func (e inconsistency) Unwrap() error {
+	return ErrInconsistency
+}
+
+// Recover is an option to let modifications of a tree (With, WithUpdated and
+// WithDeleted) recover from failed internal consistency checks, instead of
+// panicking. If a check fails, the tree is returned unchanged, i.e. in its
+// previous valid incarnation, and report is called with an error wrapping
+// ErrInconsistency. report may be nil.
+//
+// Use it for long-running processes like servers, which must not be taken down
+// by a single document:
+//
+//     tree := btree.Immutable(Recover(func(err error) {
+//         log.Printf("dropping modification: %v", err)
+//     }))
+//
+// Panics of client functions, e.g. of comparators, are not recovered. If the
+// package is built with tag 'debug', inconsistencies always panic, regardless
+// of this option.
+func Recover(report func(err error)) Option {
+	return func(tree Tree) Tree {
+		if report == nil {
+			report = func(error) {}
+		}
+		tree.report = report
+		return tree
+	}
+}
+
+// WithOK is like With, but returns tree unchanged together with an error
+// wrapping ErrInconsistency, if an internal consistency check fails.
+func (tree Tree) WithOK(key K, value T) (Tree, error) {
+	return tree.catching(func() Tree {
+		return tree.with(key, value)
+	})
+}
+
+// WithDeletedOK is like WithDeleted, but returns tree unchanged together with an
+// error wrapping ErrInconsistency, if an internal consistency check fails.
+func (tree Tree) WithDeletedOK(key K) (Tree, error) {
+	return tree.catching(func() Tree {
+		return tree.withDeleted(key)
+	})
+}
+
+// recovering performs modify, reporting and recovering from inconsistencies if
+// tree has been created with option Recover.
+func (tree Tree) recovering(modify func() Tree) Tree {
+	if tree.report == nil {
+		return modify()
+	}
+	t, err := tree.catching(modify)
+	if err != nil {
+		tree.report(err)
+	}
+	return t
+}
+
+// catching performs modify and converts a panic caused by a failed consistency
+// check into an error. In this case, tree is returned unchanged. Other panics
+// are passed on, as are all panics for builds with tag 'debug'.
+func (tree Tree) catching(modify func() Tree) (result Tree, err error) {
+	if debugAssertions {
+		return modify(), nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(inconsistency)
+			if !ok {
+				panic(r)
+			}
+			tracer().Errorf("recovered from %v", e)
+			result, err = tree, fmt.Errorf("%w", e)
+		}
+	}()
+	return modify(), nil
+}
@@ -1,8 +1,17 @@
 package btree
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/npillmayer/schuko/tracing"
@@ -232,6 +241,24 @@ func TestTreeDeleteInsertedKeyFromLeaf(t *testing.T) {
 		t.Errorf("different trees after insert+delete; expected to be equal")
 	}
 }
+func TestTreeDeleteLastItem(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	tree := Tree{}.With(7, "7")
+	empty := tree.WithDeleted(7)
+	if empty.root != nil || empty.depth != 0 || empty.Len() != 0 {
+		t.Errorf("expected tree without items to have no root, has %s", empty.root)
+	}
+	if v, ok := tree.Find(7); !ok || v != "7" {
+		t.Errorf("expected original tree to keep item 7")
+	}
+	if empty = empty.With(3, "3"); empty.Len() != 1 || empty.depth != 1 {
+		t.Errorf("expected emptied tree to be usable, has %d items", empty.Len())
+	}
+}
+
 func TestTreeDeleteAndMerge(t *testing.T) {
 	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
 	tracer().SetTraceLevel(tracing.LevelError)
@@ -277,6 +304,699 @@ func TestTreeDeleteInnerItem(t *testing.T) {
 	//t.Logf("tree =\n%s", printTree(tree))
 }
 
+func TestTreeIterate(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	tree := createTreeForTest()
+	keys := tree.Keys()
+	if fmt.Sprint(keys) != "[0 1 2 3 4 5 6 8 9]" {
+		t.Errorf("expected keys of test tree to be [0…9] without 7, are %v", keys)
+	}
+	values := tree.Values()
+	if len(values) != 9 || values[8] != T("9") {
+		t.Errorf("expected 9 values in key order, have %v", values)
+	}
+	entries := tree.Entries(5, 9)
+	if len(entries) != 3 || entries[0].Key != 5 || entries[1].Key != 6 || entries[2].Key != 8 {
+		t.Errorf("expected entries for keys 5, 6, 8, have %v", entries)
+	}
+	if e := tree.Entries(7, 8); len(e) != 0 {
+		t.Errorf("expected no entries for 7 ≤ key < 8, have %v", e)
+	}
+	if k := (Tree{}).Keys(); len(k) != 0 {
+		t.Errorf("expected empty tree to have no keys, has %v", k)
+	}
+}
+
+func TestTreeIterateAfterInserts(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	tree := Immutable()
+	for _, k := range []K{50, 10, 90, 30, 70, 20, 80, 40, 60, 0, 100, 55, 65, 15} {
+		tree = tree.With(k, T(int(k)))
+	}
+	prev := K(-1)
+	n := 0
+	for it := tree.Iterate(); it.Next(); n++ {
+		if it.Key() <= prev {
+			t.Fatalf("expected keys in ascending order, have %d after %d", it.Key(), prev)
+		}
+		prev = it.Key()
+	}
+	if n != 14 {
+		t.Errorf("expected to iterate over 14 entries, did %d", n)
+	}
+	entries := tree.Entries(52, 70)
+	if fmt.Sprint(entries) != "[{55 55} {60 60} {65 65}]" {
+		t.Errorf("expected entries for 52 ≤ key < 70, have %v", entries)
+	}
+}
+
+func TestTreeIterateReverse(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	tree := createTreeForTest()
+	var keys []K
+	for it := tree.IterateReverse(); it.Next(); {
+		keys = append(keys, it.Key())
+	}
+	if fmt.Sprint(keys) != "[9 8 6 5 4 3 2 1 0]" {
+		t.Errorf("expected keys in descending order, are %v", keys)
+	}
+	entries := tree.DescendRange(8, 4)
+	if fmt.Sprint(entries) != "[{8 8} {6 6} {5 5}]" {
+		t.Errorf("expected entries for keys 8, 6, 5, have %v", entries)
+	}
+	if it := tree.IterateDownFrom(7); !it.Next() || it.Key() != 6 {
+		t.Errorf("expected last key before 7 to be 6")
+	}
+	if e := tree.DescendRange(-1, -10); len(e) != 0 {
+		t.Errorf("expected no entries below smallest key, have %v", e)
+	}
+	if (Tree{}).IterateReverse().Next() || (Tree{}).IterateDownFrom(5).Next() {
+		t.Errorf("expected reverse iterators of empty tree to be exhausted")
+	}
+	for _, degree := range []int{3, 4, 7} { // exercise inner nodes of several tree depths
+		tree := Immutable(Degree(degree))
+		for k := 0; k < 500; k += 2 {
+			tree = tree.With(K(k), T(k))
+		}
+		for hi := -1; hi <= 500; hi += 7 {
+			lo := hi - 45
+			var expected []Entry
+			for k := hi; k > lo; k-- {
+				if k >= 0 && k < 500 && k%2 == 0 {
+					expected = append(expected, Entry{K(k), T(k)})
+				}
+			}
+			if e := tree.DescendRange(K(hi), K(lo)); fmt.Sprint(e) != fmt.Sprint(expected) {
+				t.Fatalf("degree %d: expected entries %d ≥ key > %d to be %v, have %v", degree, hi, lo, expected, e)
+			}
+		}
+		n := 0
+		for it := tree.IterateReverse(); it.Next(); n++ {
+			if it.Key() != K(498-2*n) {
+				t.Fatalf("degree %d: expected key #%d to be %d, is %d", degree, n, 498-2*n, it.Key())
+			}
+		}
+		if n != 250 {
+			t.Errorf("degree %d: expected to iterate over 250 entries, did %d", degree, n)
+		}
+	}
+}
+
+func TestTreeWithUpdated(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	count := func(old T, exists bool) T {
+		if !exists {
+			return 1
+		}
+		return old.(int) + 1
+	}
+	tree := Immutable(Eq(func(a, b T) bool { return a == b }))
+	for _, k := range []K{3, 1, 3, 2, 3, 1, 5, 8, 13, 21, 34, 55, 89} {
+		tree = tree.WithUpdated(k, count)
+	}
+	for k, n := range map[K]int{1: 2, 2: 1, 3: 3, 89: 1} {
+		if v, ok := tree.Find(k); !ok || v != T(n) {
+			t.Errorf("expected count for key %d to be %d, is %v", k, n, v)
+		}
+	}
+	if len(tree.Keys()) != 10 {
+		t.Errorf("expected 10 keys, have %v", tree.Keys())
+	}
+	prev := tree
+	tree = tree.WithUpdated(3, func(old T, exists bool) T { return old })
+	if tree.root != prev.root {
+		t.Errorf("expected unchanged value not to create a new incarnation of the tree")
+	}
+	if prev.WithUpdated(1, count).depth != prev.depth {
+		t.Errorf("expected depth of tree to be unchanged after replacing a value")
+	}
+	if v, _ := prev.Find(1); v != T(2) {
+		t.Errorf("expected previous incarnation of the tree to be unchanged, value is %v", v)
+	}
+}
+
+func TestTreeOrderStatistics(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	tree := createTreeForTest()
+	if k, v := tree.Select(6); k != 6 || v != T("6") {
+		t.Errorf("expected Select(6) to return key 6, have %d", k)
+	}
+	if k, _ := tree.Select(7); k != 8 {
+		t.Errorf("expected Select(7) to return key 8, have %d", k)
+	}
+	if r := tree.Rank(7); r != 7 {
+		t.Errorf("expected rank of missing key 7 to be 7, is %d", r)
+	}
+	if r := tree.Rank(5); r != 5 {
+		t.Errorf("expected rank of key 5 to be 5, is %d", r)
+	}
+	if (Tree{}).Len() != 0 || (Tree{}).Rank(1) != 0 {
+		t.Errorf("expected empty tree to have length 0 and rank 0 for every key")
+	}
+	//
+	rnd := rand.New(rand.NewSource(7))
+	tree = Immutable(NodeArena(16))
+	present := map[K]bool{}
+	for i := 0; i < 2000; i++ {
+		k := K(rnd.Intn(500) * 2) // even keys only
+		if rnd.Intn(3) == 0 {
+			tree = tree.WithDeleted(k)
+			delete(present, k)
+		} else {
+			tree = tree.With(k, T(int(k)))
+			present[k] = true
+		}
+	}
+	keys := make([]int, 0, len(present))
+	for k := range present {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+	if tree.Len() != len(keys) {
+		t.Fatalf("expected tree to contain %d items, has %d", len(keys), tree.Len())
+	}
+	for i, k := range keys {
+		if key, v := tree.Select(i); key != K(k) || v != T(k) {
+			t.Fatalf("expected Select(%d) to return %d, have %d", i, k, key)
+		}
+		if r := tree.Rank(K(k)); r != i {
+			t.Fatalf("expected rank of key %d to be %d, is %d", k, i, r)
+		}
+		if r := tree.Rank(K(k + 1)); r != i+1 { // odd keys are never present
+			t.Fatalf("expected rank of missing key %d to be %d, is %d", k+1, i+1, r)
+		}
+	}
+}
+
+func TestTreeCompare(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	descending := Compare(func(a, b K) int { return int(b - a) })
+	tree := Immutable(Degree(3), descending)
+	for _, k := range rand.New(rand.NewSource(3)).Perm(200) {
+		tree = tree.With(K(k), T(k))
+	}
+	for k := 0; k < 200; k += 3 {
+		tree = tree.WithDeleted(K(k))
+	}
+	keys := tree.Keys()
+	if len(keys) != tree.Len() || !sort.SliceIsSorted(keys, func(i, j int) bool { return keys[i] > keys[j] }) {
+		t.Fatalf("expected keys in descending order, have %v", keys)
+	}
+	if v, found := tree.Find(5); !found || v != T(5) {
+		t.Errorf("expected to find key 5, have %v", v)
+	}
+	if k, _ := tree.Select(0); k != 199 {
+		t.Errorf("expected Select(0) to return the largest key 199, have %d", k)
+	}
+	if r := tree.Rank(195); r != 3 { // 199, 197, 196 rank before 195
+		t.Errorf("expected rank of 195 to be 3, is %d", r)
+	}
+	if entries := tree.Entries(10, 5); len(entries) != 3 || entries[0].Key != 10 {
+		t.Errorf("expected entries 10, 8, 7 for range [10, 5), have %v", entries)
+	}
+	// composite keys: major part in upper bits, ignoring the lower 8 bits
+	major := Compare(func(a, b K) int { return int(a>>8) - int(b>>8) })
+	tree = Immutable(major).With(1<<8|1, "a").With(2<<8|7, "b").With(1<<8|9, "c")
+	if tree.Len() != 2 {
+		t.Errorf("expected keys with equal major part to denote the same entry, have %v", tree.Keys())
+	}
+	if v, _ := tree.Find(1<<8 | 42); v != T("c") {
+		t.Errorf("expected to find value 'c' for major key 1, have %v", v)
+	}
+	if k, _ := tree.Select(0); k != 1<<8|1 {
+		t.Errorf("expected replacement to keep the first key inserted, have %x", k)
+	}
+}
+
+func TestTreeEq(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	tree := Immutable().With(1, []int{1}).With(1, []int{1, 2}) // uncomparable values must not panic
+	tree = tree.WithUpdated(1, func(old T, exists bool) T {
+		return append(old.([]int), 3)
+	})
+	if v, _ := tree.Find(1); len(v.([]int)) != 3 {
+		t.Errorf("expected value to be replaced by [1 2 3], is %v", v)
+	}
+	eq := Eq(func(a, b T) bool { return a == b })
+	tree = Immutable(eq).With(1, "a").With(2, "b")
+	if same := tree.With(2, "b"); same.root != tree.root {
+		t.Errorf("expected re-inserting an equal value to leave the tree unchanged")
+	}
+	if other := tree.With(2, "c"); other.root == tree.root {
+		t.Errorf("expected a different value to create a new incarnation of the tree")
+	}
+	if v, _ := tree.With(3, "x").With(3, "x").Find(3); v != T("x") {
+		t.Errorf("expected Eq option to be retained by new incarnations, have %v", v)
+	}
+}
+
+func TestTreeSharing(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	a := Immutable()
+	for i := 0; i < 1000; i++ {
+		a = a.With(K(i*2), i)
+	}
+	r := Sharing(a, a)
+	if r.UniqueNodesA != 0 || r.UniqueNodesB != 0 || r.SharedItems != a.Len() {
+		t.Errorf("expected tree to share everything with itself, have %s", r)
+	}
+	b := a.With(501, "new")
+	r = Sharing(a, b)
+	t.Logf("sharing = %s", r)
+	if r.SharedItems+r.UniqueItemsA != a.Len() || r.SharedItems+r.UniqueItemsB != b.Len() {
+		t.Errorf("expected items to add up to %d|%d, have %s", a.Len(), b.Len(), r)
+	}
+	if r.UniqueNodesA == 0 || r.UniqueNodesA > int(a.depth)+1 {
+		t.Errorf("expected path of %d nodes to be copied, have %d unique nodes", a.depth+1, r.UniqueNodesA)
+	}
+	if r.SharedNodes <= r.UniqueNodesB || r.SharedBytes <= r.UniqueBytesB {
+		t.Errorf("expected most of the structure to be shared, have %s", r)
+	}
+	r = Sharing(Tree{}, b)
+	if r.SharedNodes != 0 || r.UniqueItemsB != b.Len() {
+		t.Errorf("expected empty tree to share nothing, have %s", r)
+	}
+}
+
+func TestTreeCursor(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	c := Immutable().Cursor()
+	if c.First() || c.Next() || c.SeekGE(1) || c.SeekLE(1) || c.SeekRank(0) {
+		t.Errorf("expected cursor on empty tree to be unpositioned")
+	}
+	tree := Immutable()
+	for i := 0; i < 500; i++ {
+		tree = tree.With(K(i*2), i)
+	}
+	c = tree.Cursor()
+	n := 0
+	for c.Next() {
+		if c.Key() != K(n*2) || c.Rank() != n {
+			t.Fatalf("expected key %d at rank %d, have key %v at rank %d", n*2, n, c.Key(), c.Rank())
+		}
+		n++
+	}
+	if n != tree.Len() || c.Rank() != tree.Len() {
+		t.Errorf("expected to step over %d entries, stepped over %d", tree.Len(), n)
+	}
+	for c.Prev() {
+		n--
+		if c.Key() != K(n*2) || c.Rank() != n {
+			t.Fatalf("expected key %d at rank %d, have key %v at rank %d", n*2, n, c.Key(), c.Rank())
+		}
+	}
+	if n != 0 || c.Rank() != -1 || c.Prev() {
+		t.Errorf("expected cursor to be before first entry, is at %d", n)
+	}
+	if !c.SeekGE(301) || c.Key() != 302 || !c.Prev() || c.Key() != 300 {
+		t.Errorf("expected SeekGE(301) to find 302, and its predecessor 300")
+	}
+	if !c.SeekLE(301) || c.Key() != 300 || !c.Next() || c.Key() != 302 {
+		t.Errorf("expected SeekLE(301) to find 300, and its successor 302")
+	}
+	if c.SeekGE(999) || !c.Prev() || c.Key() != 998 {
+		t.Errorf("expected SeekGE beyond the last key to leave cursor after last entry")
+	}
+	if c.SeekLE(-1) || !c.Next() || c.Key() != 0 {
+		t.Errorf("expected SeekLE before the first key to leave cursor before first entry")
+	}
+	if !c.SeekRank(123) || c.Key() != 246 || !c.Last() || c.Key() != 998 {
+		t.Errorf("expected SeekRank(123) to find key 246")
+	}
+	c.SeekGE(400)
+	tree = tree.With(399, "new").WithDeleted(400)
+	if !c.Reseek(tree) || c.Key() != 402 || !c.Prev() || c.Key() != 399 {
+		t.Errorf("expected re-seek to move to 402 in new incarnation")
+	}
+}
+
+func TestTreeCountRange(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	tree := Immutable()
+	for i := 0; i < 1000; i++ {
+		tree = tree.With(K(i*2), i) // even keys 0 … 1998
+	}
+	for _, test := range []struct {
+		from, to K
+		count    int
+	}{
+		{0, 2000, 1000},
+		{10, 20, 5},
+		{11, 21, 5},
+		{-5, 1, 1},
+		{1998, 5000, 1},
+		{20, 10, 0},
+		{3000, 4000, 0},
+	} {
+		if n := tree.CountRange(test.from, test.to); n != test.count || n != len(tree.Entries(test.from, test.to)) {
+			t.Errorf("expected %d keys in [%d, %d), have %d", test.count, test.from, test.to, n)
+		}
+	}
+	for _, test := range []struct {
+		q   float64
+		key K
+	}{
+		{0, 0}, {1, 1998}, {0.5, 1000}, {0.25, 500}, {-1, 0}, {2, 1998},
+	} {
+		if k, ok := tree.ApproxQuantile(test.q); !ok || k != test.key {
+			t.Errorf("expected quantile %g to be %d, is %d", test.q, test.key, k)
+		}
+	}
+	if _, ok := (Tree{}).ApproxQuantile(0.5); ok || (Tree{}).CountRange(0, 10) != 0 {
+		t.Errorf("expected empty tree to have no quantiles and no keys in range")
+	}
+}
+
+func TestTreeChanges(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	a := Immutable()
+	for i := 0; i < 1000; i++ {
+		a = a.With(K(i*2), i)
+	}
+	if cs := Changes(a, a); !cs.Empty() || cs.Compared != 0 {
+		t.Errorf("expected tree to be unchanged against itself, have %s", cs)
+	}
+	b := a.With(501, "new").With(1000, "modified").WithDeleted(1200).With(1202, 601)
+	cs := Changes(a, b)
+	t.Logf("changes = %s", cs)
+	if len(cs.Added) != 1 || cs.Added[0] != 501 || len(cs.Removed) != 1 || cs.Removed[0] != 1200 ||
+		len(cs.Modified) != 1 || cs.Modified[0] != 1000 {
+		t.Errorf("expected 501 to be added, 1200 removed and 1000 modified, have %s", cs)
+	}
+	if cs.Compared == 0 || cs.Compared > a.Len()/4 {
+		t.Errorf("expected shared subtrees to be skipped, compared %d entries", cs.Compared)
+	}
+	if cs = Changes(b, a); len(cs.Added) != 1 || cs.Added[0] != 1200 || cs.Removed[0] != 501 {
+		t.Errorf("expected changes to be reversed, have %s", cs)
+	}
+	c := Immutable()
+	for i := 999; i >= 0; i-- { // same content, no shared structure
+		c = c.With(K(i*2), i)
+	}
+	if cs = Changes(a, c); !cs.Empty() || cs.Compared != a.Len() {
+		t.Errorf("expected trees with equal content to be unchanged, have %s", cs)
+	}
+	if cs = Changes(Tree{}, a); len(cs.Added) != a.Len() || cs.Added[10] != 20 || len(cs.Removed) != 0 {
+		t.Errorf("expected all keys to be added to an empty tree")
+	}
+	if cs = Changes(a.With(4, []int{2}), a.With(4, []int{2})); len(cs.Modified) != 1 {
+		t.Errorf("expected uncomparable values to be reported as modified, have %s", cs)
+	}
+}
+
+func TestTreeMapped(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	tree := Immutable(Compare(func(a, b K) int { return int(b - a) })) // descending order
+	for i := 0; i < 500; i++ {
+		tree = tree.With(K(i*2-100), strconv.Itoa(i))
+	}
+	path := filepath.Join(t.TempDir(), "tree.bt")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteMapped(f, tree, StringValues); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	mt, err := OpenMapped(path, StringValues, Compare(func(a, b K) int { return int(b - a) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mt.Close()
+	if mt.Len() != tree.Len() {
+		t.Errorf("expected mapped tree to have %d entries, has %d", tree.Len(), mt.Len())
+	}
+	if v, ok := mt.Find(-100); !ok || v != "0" {
+		t.Errorf("expected key -100 to be associated with \"0\", is %v", v)
+	}
+	if _, ok := mt.Find(1); ok {
+		t.Errorf("expected key 1 not to be found")
+	}
+	same := func(name string, a, b *Iterator) {
+		n := 0
+		for a.Next() {
+			if !b.Next() || a.Key() != b.Key() || a.Value() != b.Value() {
+				t.Fatalf("%s: mapped iterator differs from tree iterator at entry %d", name, n)
+			}
+			n++
+		}
+		if b.Next() {
+			t.Errorf("%s: mapped iterator has more entries than tree iterator (%d)", name, n)
+		}
+	}
+	var ro ReadOnly = mt
+	same("Iterate", tree.Iterate(), ro.Iterate())
+	same("IterateFrom", tree.IterateFrom(51), ro.IterateFrom(51))
+	same("IterateReverse", tree.IterateReverse(), ro.IterateReverse())
+	same("IterateDownFrom", tree.IterateDownFrom(50), ro.IterateDownFrom(50))
+	same("IterateDownFrom", tree.IterateDownFrom(-1000), ro.IterateDownFrom(-1000))
+	//
+	if err = WriteMapped(io.Discard, tree.With(7, 7), StringValues); err == nil {
+		t.Errorf("expected non-string value to be rejected")
+	}
+	var buf bytes.Buffer
+	if err = WriteMapped(&buf, Immutable().With(1, 10).With(2, -20), IntValues); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ints, err := OpenMapped(path, IntValues)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := ints.Find(2); !ok || v != -20 {
+		t.Errorf("expected key 2 to be associated with -20, is %v", v)
+	}
+	ints.Close()
+	if err = os.WriteFile(path, buf.Bytes()[:buf.Len()-1], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenMapped(path, IntValues); err != ErrMappedFormat {
+		t.Errorf("expected truncated file to be rejected, error is %v", err)
+	}
+}
+
+func TestTreeMappedCorrupt(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	path := filepath.Join(t.TempDir(), "corrupt.bt")
+	open := func(data []byte) error {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mt, err := OpenMapped(path, IntValues)
+		if err == nil {
+			mt.Close()
+		}
+		return err
+	}
+	var buf bytes.Buffer
+	if err := WriteMapped(&buf, Immutable(), IntValues); err != nil {
+		t.Fatal(err)
+	}
+	if err := open(buf.Bytes()); err != nil {
+		t.Errorf("expected empty tree to be accepted, error is %v", err)
+	}
+	buf.Reset()
+	if err := WriteMapped(&buf, Immutable().With(1, 10).With(2, -20).With(3, 300), IntValues); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+	for n := 0; n < len(valid); n++ {
+		if err := open(valid[:n]); err != ErrMappedFormat {
+			t.Errorf("expected file truncated to %d bytes to be rejected, error is %v", n, err)
+		}
+	}
+	modified := func(f func(data []byte)) []byte {
+		data := append([]byte(nil), valid...)
+		f(data)
+		return data
+	}
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"header only", modified(func(d []byte) { binary.LittleEndian.PutUint64(d[8:], 0) })[:mappedHeaderSize]},
+		{"keys and offsets without end offset", valid[:mappedHeaderSize+16*3]},
+		{"bad magic", modified(func(d []byte) { d[0] = 'X' })},
+		{"huge count", modified(func(d []byte) { binary.LittleEndian.PutUint64(d[8:], 1<<62) })},
+		{"count too large", modified(func(d []byte) { binary.LittleEndian.PutUint64(d[8:], 4) })},
+		{"offsets descending", modified(func(d []byte) { binary.LittleEndian.PutUint64(d[mappedHeaderSize+24+8:], 100) })},
+		{"first offset not 0", modified(func(d []byte) { binary.LittleEndian.PutUint64(d[mappedHeaderSize+24:], 1) })},
+		{"unknown key order", modified(func(d []byte) { d[16] = 7 })},
+		{"keys descending", modified(func(d []byte) { binary.LittleEndian.PutUint64(d[mappedHeaderSize:], 5) })},
+	} {
+		if err := open(c.data); err != ErrMappedFormat {
+			t.Errorf("%s: expected file to be rejected, error is %v", c.name, err)
+		}
+	}
+	if err := open(modified(func(d []byte) { d[4] = 99 })); err == nil || err == ErrMappedFormat {
+		t.Errorf("expected unsupported version to be reported, error is %v", err)
+	}
+	// values are checked when they are accessed
+	if err := os.WriteFile(path, modified(func(d []byte) { d[len(d)-4] = 0x80 }), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var reported []error
+	mt, err := OpenMapped(path, IntValues, Recover(func(err error) { reported = append(reported, err) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mt.Close()
+	if _, _, err := mt.FindOK(1); !errors.Is(err, ErrMappedFormat) {
+		t.Errorf("expected damaged value to be reported by FindOK, error is %v", err)
+	}
+	if v, ok := mt.Find(1); ok || v != nil || len(reported) != 1 {
+		t.Errorf("expected damaged value to be reported and treated as missing, is %v", v)
+	}
+	if v, ok := mt.Find(2); !ok || v != -20 {
+		t.Errorf("expected key 2 to be associated with -20, is %v", v)
+	}
+	it := mt.Iterate()
+	if !it.Next() || it.Value() != nil || len(reported) != 2 {
+		t.Errorf("expected iterator to report damaged value")
+	}
+	if _, err := it.ValueOK(); !errors.Is(err, ErrMappedFormat) {
+		t.Errorf("expected damaged value to be reported by ValueOK, error is %v", err)
+	}
+}
+
+func TestTreeMappedOrder(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	descending := Compare(func(a, b K) int { return int(b - a) })
+	ascending := Compare(func(a, b K) int { return int(a - b) })
+	path := filepath.Join(t.TempDir(), "order.bt")
+	write := func(tree Tree) {
+		var buf bytes.Buffer
+		if err := WriteMapped(&buf, tree.With(1, 10).With(2, 20).With(3, 30), IntValues); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	open := func(opts ...Option) error {
+		mt, err := OpenMapped(path, IntValues, opts...)
+		if err == nil {
+			mt.Close()
+		}
+		return err
+	}
+	write(Immutable(descending))
+	if err := open(descending); err != nil {
+		t.Errorf("expected file to be opened with its key order, error is %v", err)
+	}
+	if err := open(); err != ErrMappedOrder {
+		t.Errorf("expected custom order to be required, error is %v", err)
+	}
+	if err := open(ascending); err != ErrMappedOrder {
+		t.Errorf("expected different comparator to be rejected, error is %v", err)
+	}
+	write(Immutable())
+	if err := open(); err != nil {
+		t.Errorf("expected file to be opened with natural order, error is %v", err)
+	}
+	if err := open(ascending); err != ErrMappedOrder {
+		t.Errorf("expected comparator to be rejected for natural order, error is %v", err)
+	}
+}
+
+func TestTreeRecover(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	if debugAssertions {
+		t.Skip("inconsistencies always panic for builds with tag 'debug'")
+	}
+	var reported []error
+	tree := Immutable(Recover(func(err error) { reported = append(reported, err) }))
+	for i := 0; tree.depth < 2; i++ {
+		tree = tree.With(K(i), i)
+	}
+	corrupt := func(tree Tree) Tree { // tree.depth too low => path buffer too short for deletion
+		tree.depth--
+		return tree
+	}
+	key := tree.root.items[0].key // deleting a key of an inner node needs a path to a leaf
+	bad := corrupt(tree)
+	result := bad.WithDeleted(key)
+	if len(reported) != 1 || !errors.Is(reported[0], ErrInconsistency) {
+		t.Fatalf("expected 1 inconsistency to be reported, have %v", reported)
+	}
+	if result.root != bad.root || result.Len() != tree.Len() {
+		t.Errorf("expected tree to be left unchanged after inconsistency")
+	}
+	if _, found := result.Find(key); !found {
+		t.Errorf("expected key %d to still be present", key)
+	}
+	if ok := result.WithDeleted(key + 1); ok.Len() != tree.Len()-1 {
+		t.Errorf("expected modifications without inconsistencies to succeed")
+	}
+	//
+	plain := Immutable()
+	for i := 0; plain.depth < 2; i++ {
+		plain = plain.With(K(i), i)
+	}
+	bad = corrupt(plain)
+	result, err := bad.WithDeletedOK(key)
+	if !errors.Is(err, ErrInconsistency) || result.root != bad.root {
+		t.Errorf("expected WithDeletedOK to return error and unchanged tree, error is %v", err)
+	}
+	if result, err = plain.WithOK(1000, 1000); err != nil || result.Len() != plain.Len()+1 {
+		t.Errorf("expected WithOK to insert new key, error is %v", err)
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected inconsistency to panic for tree without option Recover")
+		}
+	}()
+	bad.WithDeleted(key)
+}
+
 /*
 func TestTreeExtFind(t *testing.T) {
 	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
@@ -311,6 +1031,9 @@ func createTreeForTest() Tree { // tree with values 0…9, without 7
 	child2.add(6, 8, 9) // 7 is missing
 	root.children = append(root.children, child2)
 
+	for _, node := range []*xnode{child0, child1, child2, root} {
+		node.recount()
+	}
 	//return newTreeWithRoot(root, minItems)
 	return Tree{
 		root:          root,
@@ -349,3 +1072,47 @@ func ppt(p tp.Tree, node *xnode) {
 		ppt(branch, ch)
 	}
 }
+
+func TestVersions(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.btree")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	versions := NewVersions()
+	if _, ok := versions.Get("head"); ok {
+		t.Errorf("expected empty registry not to contain a head version")
+	}
+	base := Immutable().With(1, "one")
+	versions.Publish("base", base)
+	versions.Publish("head", base)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(k K) { // writer
+			defer wg.Done()
+			versions.Update("head", func(tree Tree) Tree {
+				return tree.With(k, T(int(k)))
+			})
+		}(K(i + 10))
+		go func() { // reader
+			defer wg.Done()
+			if tree, ok := versions.Get("base"); !ok || len(tree.Keys()) != 1 {
+				t.Errorf("expected base version to be unaffected by writers")
+			}
+		}()
+	}
+	wg.Wait()
+	head, _ := versions.Get("head")
+	if n := len(head.Keys()); n != 11 {
+		t.Errorf("expected head version to contain 11 keys, has %d", n)
+	}
+	if fmt.Sprint(versions.Labels()) != "[base head]" {
+		t.Errorf("expected labels [base head], have %v", versions.Labels())
+	}
+	if !versions.Drop("base") || versions.Drop("base") {
+		t.Errorf("expected base to be dropped exactly once")
+	}
+	if len(base.Keys()) != 1 {
+		t.Errorf("expected dropped tree to be still usable")
+	}
+}
@@ -0,0 +1,85 @@
+package btree
+
+import (
+	"sort"
+	"sync"
+)
+
+// --- Versions --------------------------------------------------------------
+
+// Versions is a registry of named tree incarnations. As trees are immutable,
+// readers may Get a version and work with it for as long as they like, while
+// a writer creates new incarnations and publishes them under the same label
+// (MVCC-style). Use it like this:
+//
+//     versions := btree.NewVersions()
+//     versions.Publish("head", tree)
+//     …
+//     versions.Update("head", func(t btree.Tree) btree.Tree {
+//         return t.With(key, value)
+//     })
+//
+// All operations of Versions are concurrency-safe.
+type Versions struct {
+	lock  sync.RWMutex
+	trees map[string]Tree
+}
+
+// NewVersions creates an empty registry of tree versions.
+func NewVersions() *Versions {
+	return &Versions{trees: make(map[string]Tree)}
+}
+
+// Publish registers tree under label, replacing a tree previously published for
+// label. It returns the replaced tree together with an indicator wether there
+// has been one.
+func (v *Versions) Publish(label string, tree Tree) (Tree, bool) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	prev, ok := v.trees[label]
+	v.trees[label] = tree
+	return prev, ok
+}
+
+// Get returns the tree published under label. If no tree has been published
+// for label, an empty tree is returned, together with found=false.
+func (v *Versions) Get(label string) (Tree, bool) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	tree, ok := v.trees[label]
+	return tree, ok
+}
+
+// Drop removes label from the registry. Readers which already got the tree
+// are not affected. Returns false if label has not been published.
+func (v *Versions) Drop(label string) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	_, ok := v.trees[label]
+	delete(v.trees, label)
+	return ok
+}
+
+// Update atomically replaces the tree published under label by the result of
+// f, which is called with the current tree (or an empty tree, if label has
+// not been published). Concurrent updates are serialized, thus f must not
+// call other methods of v. Returns the tree published.
+func (v *Versions) Update(label string, f func(Tree) Tree) Tree {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	tree := f(v.trees[label])
+	v.trees[label] = tree
+	return tree
+}
+
+// Labels returns all labels in use, in lexicographical order.
+func (v *Versions) Labels() []string {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	labels := make([]string, 0, len(v.trees))
+	for l := range v.trees {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	return labels
+}
@@ -10,6 +10,11 @@ structural sharing, which means that if two data structures are mostly copies of
 most of the memory they take up will be shared between them. This implies that making copies
 of an immutable data structure is relatively cheap in terms of space- and time-complexity.
 
+Every persistent structure has a mutable (transient) counterpart: slices for vectors, maps for
+B-trees and mutable trees (package fp/tree) for persistent trees. Interfaces Persistent and
+Transient let generic utilities, e.g. serializers or test harnesses, convert between both
+uniformly.
+
 License
 
 Governed by a 3-Clause BSD license. License file may be found in the root
@@ -0,0 +1,144 @@
+package persistent
+
+import (
+	"sort"
+
+	"github.com/npillmayer/fp/persistent/btree"
+	"github.com/npillmayer/fp/persistent/tree"
+	"github.com/npillmayer/fp/persistent/vector"
+	mutable "github.com/npillmayer/fp/tree"
+)
+
+// --- Persistent and transient structures -----------------------------------
+
+// Persistent is implemented by the immutable persistent structures of this
+// module, which may be converted into a mutable (transient) counterpart of
+// type M:
+//
+//     vector.Vector[T]    Thaw() []T
+//     btree.Tree          Thaw() map[btree.K]btree.T
+//     *tree.Node[T]       Thaw() *mutable.Node[T]     (package fp/tree)
+//
+// Thawing copies the structure, thus modifications of the transient structure
+// never affect the persistent one.
+type Persistent[M any] interface {
+	Thaw() M
+}
+
+// Transient is implemented by mutable counterparts of persistent structures,
+// which may be converted into a persistent structure of type P. Mutable
+// counterparts are plain Go types, thus this package defines types with a
+// Freeze method for them: Slice, Map and MutableTree.
+type Transient[P any] interface {
+	Freeze() P
+}
+
+// Slice is the transient counterpart of a vector.
+type Slice[T any] []T
+
+// Freeze creates a vector holding the elements of a slice.
+func (s Slice[T]) Freeze() vector.Vector[T] {
+	return vector.From([]T(s))
+}
+
+// Map is the transient counterpart of a B-tree.
+type Map map[btree.K]btree.T
+
+// Freeze creates a B-tree holding the entries of a map, with default options.
+// Use BTreeFromMap to create a tree with options.
+func (m Map) Freeze() btree.Tree {
+	return BTreeFromMap(m)
+}
+
+// MutableTree is the transient counterpart of a persistent tree. Convert a
+// mutable tree node m (package fp/tree) like this:
+//
+//     frozen := (*persistent.MutableTree[T])(m).Freeze()
+//
+type MutableTree[T comparable] mutable.Node[T]
+
+// Freeze converts a mutable subtree into a persistent tree, see tree.Freeze.
+func (m *MutableTree[T]) Freeze() *tree.Node[T] {
+	return tree.Freeze((*mutable.Node[T])(m))
+}
+
+// --- Conversion helpers ----------------------------------------------------
+
+// VectorFromSlice creates a vector holding the elements of a slice.
+func VectorFromSlice[T any](s []T, opts ...vector.Option) vector.Vector[T] {
+	return vector.From(s, opts...)
+}
+
+// SliceFromVector returns the elements of a vector as a slice.
+func SliceFromVector[T any](v vector.Vector[T]) []T {
+	return v.ToSlice()
+}
+
+// BTreeFromMap creates a B-tree holding the entries of a map. Entries are
+// inserted in ascending order of keys, thus the structure of the tree does not
+// depend on the iteration order of the map.
+func BTreeFromMap(m map[btree.K]btree.T, opts ...btree.Option) btree.Tree {
+	keys := make([]btree.K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	t := btree.Immutable(opts...)
+	for _, k := range keys {
+		t = t.With(k, m[k])
+	}
+	return t
+}
+
+// MapFromBTree returns the entries of a B-tree as a map.
+func MapFromBTree(t btree.Tree) map[btree.K]btree.T {
+	return t.Thaw()
+}
+
+// Nested is a plain representation of a tree, e.g. for serializers or for
+// writing down expected trees in tests:
+//
+//     n := &persistent.Nested[int]{Payload: 1, Children: []*persistent.Nested[int]{
+//         {Payload: 2}, nil, {Payload: 3},
+//     }}
+//
+// Nil children denote empty positions.
+type Nested[T comparable] struct {
+	Payload  T
+	Children []*Nested[T]
+}
+
+// TreeFromNested creates a persistent tree from its nested representation.
+// Empty positions at the end of a list of children are dropped, as with
+// tree.Thaw.
+func TreeFromNested[T comparable](n *Nested[T]) *tree.Node[T] {
+	if n == nil {
+		return nil
+	}
+	return tree.Freeze(mutableFromNested(n))
+}
+
+func mutableFromNested[T comparable](n *Nested[T]) *mutable.Node[T] {
+	m := mutable.NewNode(n.Payload)
+	for i, ch := range n.Children {
+		if ch != nil {
+			m.SetChildAt(i, mutableFromNested(ch))
+		}
+	}
+	return m
+}
+
+// NestedFromTree returns the nested representation of a persistent tree.
+func NestedFromTree[T comparable](node *tree.Node[T]) *Nested[T] {
+	if node == nil {
+		return nil
+	}
+	n := &Nested[T]{Payload: node.Payload}
+	if node.ChildCount() > 0 {
+		n.Children = make([]*Nested[T], node.ChildCount())
+		for i, ch := range node.Children(false) {
+			n.Children[i] = NestedFromTree(ch)
+		}
+	}
+	return n
+}
@@ -0,0 +1,49 @@
+package persistent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/npillmayer/fp/persistent/btree"
+	"github.com/npillmayer/fp/persistent/tree"
+	"github.com/npillmayer/fp/persistent/vector"
+	mutable "github.com/npillmayer/fp/tree"
+)
+
+var (
+	_ Persistent[[]int]               = vector.Vector[int]{}
+	_ Persistent[map[btree.K]btree.T] = btree.Tree{}
+	_ Persistent[*mutable.Node[int]]  = (*tree.Node[int])(nil)
+	_ Transient[vector.Vector[int]]   = Slice[int]{}
+	_ Transient[btree.Tree]           = Map{}
+	_ Transient[*tree.Node[int]]      = (*MutableTree[int])(nil)
+)
+
+func TestConversions(t *testing.T) {
+	v := VectorFromSlice([]int{1, 2, 3})
+	if s := SliceFromVector(Slice[int](v.Thaw()).Freeze()); !reflect.DeepEqual(s, []int{1, 2, 3}) {
+		t.Errorf("expected vector to survive roundtrip, have %v", s)
+	}
+	m := map[btree.K]btree.T{3: "c", 1: "a", 2: "b"}
+	bt := BTreeFromMap(m, btree.Degree(4))
+	if keys := bt.Keys(); !reflect.DeepEqual(keys, []btree.K{1, 2, 3}) {
+		t.Errorf("expected keys 1, 2, 3, have %v", keys)
+	}
+	if back := MapFromBTree(Map(bt.Thaw()).Freeze()); !reflect.DeepEqual(back, m) {
+		t.Errorf("expected map to survive roundtrip, have %v", back)
+	}
+	nested := &Nested[int]{Payload: 1, Children: []*Nested[int]{
+		{Payload: 2, Children: []*Nested[int]{{Payload: 4}}}, nil, {Payload: 3},
+	}}
+	root := TreeFromNested(nested)
+	if root.Rank != 4 || root.ChildCount() != 3 {
+		t.Fatalf("expected tree of 4 nodes with 3 child positions, have rank %d", root.Rank)
+	}
+	frozen := (*MutableTree[int])(root.Thaw()).Freeze()
+	if back := NestedFromTree(frozen); !reflect.DeepEqual(back, nested) {
+		t.Errorf("expected nested tree to survive roundtrip, have %+v", back)
+	}
+	if TreeFromNested[int](nil) != nil || NestedFromTree[int](nil) != nil {
+		t.Errorf("expected nil trees to convert to nil")
+	}
+}
@@ -0,0 +1,69 @@
+package tree
+
+import (
+	mutable "github.com/npillmayer/fp/tree"
+)
+
+// --- Bridge to mutable trees -----------------------------------------------
+
+// Freeze converts a subtree of a mutable tree (package fp/tree) into a persistent
+// tree. Payloads are preserved, i.e. copied by value (payloads of pointer type
+// will be shared between both trees). Positions of children are preserved,
+// including empty positions. The root of the persistent tree has no parent,
+// even if m is not the root of its tree.
+//
+// A typical use is to style a document as a mutable tree and to hand an
+// immutable snapshot of it to layout. Freeze builds the persistent tree in a
+// single pass, creating exactly one node per node of the subtree; building
+// it with AddChild would copy every node once per child added.
+//
+// The mutable subtree must not be modified concurrently with Freeze.
+func Freeze[T comparable](m *mutable.Node[T]) *Node[T] {
+	if m == nil {
+		return nil
+	}
+	return freeze(m, &cowTag{})
+}
+
+// freeze creates a node tagged with cow, which may be modified in place while
+// adding its children. The tag is dropped afterwards, making the node immutable.
+func freeze[T comparable](m *mutable.Node[T], cow *cowTag) *Node[T] {
+	node := NewNode(m.LoadPayload())
+	node.cow = cow
+	for _, ch := range m.Children(false) {
+		if ch == nil {
+			node = node.add(nil, cow) // keep empty positions
+			continue
+		}
+		node = node.add(freeze(ch, cow), cow)
+	}
+	node.cow = nil
+	return node
+}
+
+// Thaw converts a persistent subtree into a mutable tree (package fp/tree),
+// creating fresh mutable nodes. Payloads are preserved, i.e. copied by value.
+// Positions of children are preserved, except for empty positions at the end of
+// a list of children, which the mutable tree does not store. The root of the
+// mutable tree has no parent.
+//
+// Thaw(Freeze(m)) creates a copy of the mutable subtree m.
+func Thaw[T comparable](node *Node[T]) *mutable.Node[T] {
+	if node == nil {
+		return nil
+	}
+	m := mutable.NewNode(node.Payload)
+	for i, ch := range node.children {
+		if ch != nil {
+			m.SetChildAt(i, Thaw(ch))
+		}
+	}
+	return m
+}
+
+// Thaw converts a persistent subtree into a mutable tree, the transient
+// counterpart of a persistent tree (see package persistent). It is the same
+// as calling Thaw(node).
+func (node *Node[T]) Thaw() *mutable.Node[T] {
+	return Thaw(node)
+}
@@ -40,6 +40,25 @@ Filter functions:
 More operations will follow as I get experience from using the tree in
 more real life contexts.
 
+Mutable Trees
+
+Subtrees of the mutable tree of package fp/tree may be converted into persistent
+trees and back:
+
+   Freeze(node)                 // persistent copy of a mutable subtree
+   Thaw(node)                   // mutable copy of a persistent subtree
+
+Zipper
+
+Nodes of persistent trees are shared between incarnations of a tree, hence a
+node may have more than one parent. Parent links of nodes are deprecated.
+Persistent trees are navigated and edited with a zipper, i.e. a Location:
+
+   NewLocation(root)            // focus on the root of a tree
+   Up(), Down(), Left(), Right() // move the focus
+   Modify(f), SetPayload(p)     // replace the node in focus
+   Root()                       // root of the edited incarnation of the tree
+
 License
 
 Governed by a 3-Clause BSD license. License file may be found in the root
@@ -21,21 +21,21 @@ type cowTag struct{} // just a thing with an identity
 type Node[T comparable] struct {
 	parent   *Node[T] // parent node of this node
 	children chvec[T] // children nodes
-	Rank     uint32   // rank is used for preserving sequence
+	Rank     uint32   // rank = number of nodes in the subtree rooted at this node
 	Payload  T        // nodes may carry a payload of arbitrary type
 	cow      *cowTag  // tag held during transient/mutable handling
 }
 
 // NewNode creates a new tree node with a given payload.
 func NewNode[T comparable](payload T) *Node[T] {
-	return &Node[T]{Payload: payload}
+	return &Node[T]{Payload: payload, Rank: 1}
 }
 
-// clone creates a copy of a node. Children are not copied.
+// clone creates a copy of a node. Children are not copied. The copy is not
+// linked to a parent, as it is not yet part of any incarnation of the tree.
 func (node Node[T]) clone(children []*Node[T]) Node[T] {
 	return Node[T]{
 		Payload:  node.Payload,
-		parent:   node.parent,
 		Rank:     node.Rank,
 		children: node.children.clone(),
 		cow:      node.cow,
@@ -59,14 +59,10 @@ func (node *Node[T]) AddChild(ch *Node[T]) *Node[T] {
 }
 
 func (node *Node[T]) add(ch *Node[T], cow *cowTag) *Node[T] {
-	var n *Node[T] = node
-	if needcopy(node, cow) {
-		newnode := node.clone(node.children)
-		n = &newnode
-	}
+	n := node.copyOnWrite(cow)
 	n.children = n.children.appendChild(ch)
 	if ch != nil {
-		n.children[len(n.children)-1].parent = node
+		n.adopt(ch)
 	}
 	return n
 }
@@ -84,15 +80,13 @@ func (node *Node[T]) ReplaceChild(i int, ch *Node[T]) *Node[T] {
 }
 
 func (node *Node[T]) replaceChild(i int, ch *Node[T], cow *cowTag) *Node[T] {
-	var n *Node[T] = node
-	if needcopy(node, cow) {
-		newnode := node.clone(node.children)
-		n = &newnode
+	n := node.copyOnWrite(cow)
+	if old := n.children.child(i); old != nil {
+		n.Rank -= old.Rank
 	}
 	n.children = n.children.replaceChild(i, ch)
 	if ch != nil {
-		//n.children[i].parent = node
-		ch.parent = node
+		n.adopt(ch)
 	}
 	return n
 }
@@ -110,33 +104,82 @@ func (node *Node[T]) InsertChild(i int, ch *Node[T]) *Node[T] {
 }
 
 func (node *Node[T]) insertChild(i int, ch *Node[T], cow *cowTag) *Node[T] {
-	var n *Node[T] = node
-	if needcopy(node, cow) {
-		newnode := node.clone(node.children)
-		n = &newnode
-	}
+	n := node.copyOnWrite(cow)
 	n.children = n.children.insertChildAt(i, ch)
 	if ch != nil {
-		//n.children[i].parent = node
-		ch.parent = node
+		n.adopt(ch)
 	}
 	return n
 }
 
+// copyOnWrite returns node itself, if it may be modified in place, or a copy
+// of node otherwise. The children of a copy are shared with node and keep
+// their parent links, which refer to node's incarnation of the tree.
+func (node *Node[T]) copyOnWrite(cow *cowTag) *Node[T] {
+	if !needcopy(node, cow) {
+		return node
+	}
+	newnode := node.clone(node.children)
+	return &newnode
+}
+
+// adopt accounts for a new child ch of node. ch is linked to node as its parent
+// only if it is not yet part of a tree; children shared with other incarnations
+// of the tree stay linked to the incarnation they have been attached to first.
+func (node *Node[T]) adopt(ch *Node[T]) {
+	if ch.parent == nil {
+		ch.parent = node
+	}
+	node.Rank += ch.Rank
+}
+
 // Parent returns the parent node or nil (for the root of the tree).
+//
+// Nodes are shared between incarnations of a tree, thus a node may have a
+// different parent in every incarnation. The parent link refers to the
+// incarnation the node has been attached to first, which is not necessarily
+// the one at hand.
+//
+// Deprecated: Use a Location to navigate persistent trees. Parent links
+// will be removed in a future version.
 func (node *Node[T]) Parent() *Node[T] {
 	return node.parent
 }
 
 // Isolate removes a node from its parent.
 // Isolate returns the isolated node.
+//
+// Isolate modifies the parent in place. The ranks of the parent and its
+// ancestors are adjusted accordingly. The parent is the one the node is
+// linked to (see Parent), which is not necessarily part of the incarnation of
+// the tree at hand. Use Detached to get a parent-less copy of a node instead,
+// leaving the tree unchanged.
+//
+// Deprecated: Isolate modifies nodes which may be shared with other
+// incarnations of the tree. Use Location.Modify to edit persistent trees.
 func (node *Node[T]) Isolate() *Node[T] {
 	if node != nil && node.parent != nil {
 		node.parent.children.remove(node)
+		for p := node.parent; p != nil; p = p.parent {
+			p.Rank -= node.Rank
+		}
+		node.parent = nil
 	}
 	return node
 }
 
+// Detached returns a copy of node which is not linked to a parent, and may
+// therefore be attached to another parent. The copy shares its children with
+// node. The tree node is part of is left unchanged, as it may be shared with
+// other incarnations of the tree; use WithReplacedSubtree(node, nil) to get an
+// incarnation without node.
+func (node *Node[T]) Detached() *Node[T] {
+	if node == nil || node.parent == nil {
+		return node
+	}
+	return node.copyOnWrite(nil)
+}
+
 // ChildCount returns the number of children-nodes for a node
 // (concurrency-safe).
 func (node *Node[T]) ChildCount() int {
@@ -175,6 +218,133 @@ func (node *Node[T]) IndexOfChild(ch *Node[T]) int {
 	return -1
 }
 
+// NthDescendant returns the node at position i within the subtree rooted at node,
+// in document order (depth-first, parents before their children). node itself
+// is at position 0, the last node of the subtree at position node.Rank-1.
+//
+// NthDescendant relies on the ranks of nodes and takes time proportional to the
+// depth of the subtree times the number of children per node.
+func (node *Node[T]) NthDescendant(i int) (*Node[T], bool) {
+	if node == nil || i < 0 || i >= int(node.Rank) {
+		return nil, false
+	}
+	n := node
+	for i > 0 {
+		i-- // skip n itself
+		var next *Node[T]
+		for _, ch := range n.children {
+			if ch == nil {
+				continue
+			}
+			if i < int(ch.Rank) {
+				next = ch
+				break
+			}
+			i -= int(ch.Rank)
+		}
+		if next == nil { // ranks are inconsistent
+			return nil, false
+		}
+		n = next
+	}
+	return n, true
+}
+
+// IndexOf returns the position of d within the subtree rooted at node, in
+// document order (see NthDescendant). If d is not part of the subtree,
+// IndexOf returns -1. IndexOf follows parent links if they lead to node and
+// searches the subtree otherwise; Location.Index does not need to search.
+func (node *Node[T]) IndexOf(d *Node[T]) int {
+	ancestors, path, ok := node.pathTo(d)
+	if !ok {
+		return -1
+	}
+	index := 0
+	for k, p := range ancestors {
+		for _, ch := range p.children[:path[k]] {
+			if ch != nil {
+				index += int(ch.Rank)
+			}
+		}
+		index++ // count p itself
+	}
+	return index
+}
+
+// pathTo finds the ancestors of target within the subtree rooted at node,
+// bottom up, together with the positions of the path's nodes within their
+// parents. Parent links are tried first, as they are cheap to follow, but they
+// may refer to a different incarnation of the tree. If they do not lead to node,
+// the subtree is searched depth-first.
+func (node *Node[T]) pathTo(target *Node[T]) ([]*Node[T], []int, bool) {
+	if node == nil || target == nil {
+		return nil, nil, false
+	}
+	var ancestors []*Node[T]
+	var path []int
+	for n := target; n != node; n = n.parent {
+		p := n.parent
+		if p == nil {
+			return node.searchPathTo(target)
+		}
+		i := p.IndexOfChild(n)
+		if i < 0 { // parent link does not belong to this incarnation
+			return node.searchPathTo(target)
+		}
+		ancestors = append(ancestors, p)
+		path = append(path, i)
+	}
+	return ancestors, path, true
+}
+
+// searchPathTo is the fallback of pathTo, searching the subtree rooted at node
+// for target.
+func (node *Node[T]) searchPathTo(target *Node[T]) ([]*Node[T], []int, bool) {
+	if node == target {
+		return nil, nil, true
+	}
+	for i, ch := range node.children {
+		if ch == nil {
+			continue
+		}
+		if ancestors, path, ok := ch.searchPathTo(target); ok {
+			return append(ancestors, node), append(path, i), true
+		}
+	}
+	return nil, nil, false
+}
+
+// WithReplacedSubtree returns a new incarnation of the tree rooted at node, in
+// which the subtree rooted at target is replaced by replacement. Only the
+// ancestors of target are copied, every other node is shared between both
+// incarnations. Ranks of the copied ancestors are adjusted. replacement may be
+// nil, leaving an empty position in the parent of target.
+//
+// This is the basic operation for incremental updates of trees, e.g. for
+// re-layouting a single paragraph: the old incarnation remains intact and may
+// be compared to the new one, or be modified itself.
+//
+// If target is not part of the tree rooted at node, WithReplacedSubtree returns
+// node unchanged and false. WithReplacedSubtree takes time proportional to the
+// depth of target times the number of children per ancestor, if the parent
+// links of target lead to node, and to the size of the tree otherwise (see
+// IndexOf). Clients having navigated to target with a Location should use
+// Location.Modify instead.
+func (node *Node[T]) WithReplacedSubtree(target, replacement *Node[T]) (*Node[T], bool) {
+	ancestors, path, ok := node.pathTo(target)
+	if !ok {
+		return node, false
+	}
+	if len(path) == 0 { // target is the root
+		return replacement, true
+	}
+	ch := replacement
+	for k, p := range ancestors {
+		ch = p.replaceChild(path[k], ch, nil)
+	}
+	return ch, true
+}
+
 // --- Slices of concurrency-safe sets of children ----------------------
 
 type chvec[T comparable] []*Node[T]
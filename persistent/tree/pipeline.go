@@ -241,6 +241,7 @@ type pipelineState struct {
 	errors     chan error     // collector channel for error messages
 	stages     []stage        // chain of stages/filters
 	running    bool           // is this pipeline processing?
+	setupErr   error          // first setup error flagged, see poison
 }
 
 func newPipelineState() *pipelineState {
@@ -248,6 +249,22 @@ func newPipelineState() *pipelineState {
 	return state
 }
 
+// poison flags a setup error for a walk. Only the first setup error is kept.
+func (pstate *pipelineState) poison(err error) {
+	pstate.mx.Lock()
+	defer pstate.mx.Unlock()
+	if pstate.setupErr == nil {
+		pstate.setupErr = err
+	}
+}
+
+// poisoned returns the first setup error flagged for a walk, or nil.
+func (pstate *pipelineState) poisoned() error {
+	pstate.mx.RLock()
+	defer pstate.mx.RUnlock()
+	return pstate.setupErr
+}
+
 func (pstate *pipelineState) appendStage(s stage) {
 	pstate.stages = append(pstate.stages, s)
 }
@@ -403,13 +420,13 @@ func waitForCompletion[T comparable](results <-chan nodePackage[T], errch <-chan
 	for node, serial := range m { // extract unique results into slices
 		selection = append(selection, node) // collect unique return values
 		serials = append(serials, serial)
-		// resultSlices is a helper struct for sorting
-		// it implements the Sort interface
-		if len(selection) > 0 && selection[0].Rank > 0 { // if rank is unset: no sorting possible
-			sort.Sort(resultSlices[T]{selection, serials})
-		}
-		// after this, serials are discarded
 	}
+	// resultSlices is a helper struct for sorting
+	// it implements the Sort interface
+	if len(selection) > 0 && selection[0].Rank > 0 { // if rank is unset: no sorting possible
+		sort.Sort(resultSlices[T]{selection, serials})
+	}
+	// after this, serials are discarded
 	// Get last error from error channel
 	var lasterror error
 	for err := range errch {
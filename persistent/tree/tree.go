@@ -125,6 +125,15 @@ func (w *Walker[S, T]) startProcessing() {
 	}
 }
 
+// setupFailed flags a setup error for the walk of w and returns w, thus
+// continuing the DSL expression chain. The promise of the walk will return the
+// first setup error flagged.
+func (w *Walker[S, T]) setupFailed(err error) *Walker[S, T] {
+	tracer().Errorf(err.Error())
+	w.pipe.state.poison(err)
+	return w
+}
+
 // Promise is a future synchronisation point.
 // Walkers may decide to perform certain tasks asynchronously.
 // Clients will not receive the resulting node list immediately, but
@@ -141,6 +150,13 @@ func (w *Walker[S, T]) Promise() func() ([]*Node[T], error) {
 			return nil, ErrEmptyTree
 		}
 	}
+	state := w.pipe.state
+	if w.pipe.empty() { // no filters => nothing will be processed
+		w.promising = true
+		return func() ([]*Node[T], error) {
+			return nil, state.poisoned()
+		}
+	}
 	// drain the result channel and the error channel
 	w.promising = true // will block calls to establish new filters
 	errch := w.pipe.state.errors
@@ -156,6 +172,9 @@ func (w *Walker[S, T]) Promise() func() ([]*Node[T], error) {
 	// TODO : sort results
 	return func() ([]*Node[T], error) {
 		<-signal
+		if err := state.poisoned(); err != nil {
+			return selection, err
+		}
 		return selection, lasterror
 	}
 }
@@ -380,12 +399,100 @@ func clientFilter[T comparable](node *Node[T], isBuffered bool, udata userdata,
 	userfunc := udata.filterlocal.(Predicate[T])
 	serial := udata.serial
 	n, err := userfunc(node, node)
-	if n != nil && err != nil {
+	if n != nil && err == nil {
 		push(n, serial) // forward filtered node to next pipeline stage
 	}
 	return err
 }
 
+// --- Attributes ------------------------------------------------------------
+
+// Attributes is an interface for node payloads which carry key-value attributes.
+// Payload types may implement it to be usable with walker filters AttributeIs
+// and SetAttribute. An example would be styled nodes, wrapping the attributes of
+// HTML nodes.
+type Attributes interface {
+	Attribute(key string) (string, bool) // get an attribute value, if present
+	SetAttribute(key, value string)      // set an attribute value
+}
+
+// ErrNoAttributes is flagged if a filter operates on attributes of a node
+// whose payload does not implement interface Attributes.
+var ErrNoAttributes = errors.New("node payload does not carry attributes")
+
+// attributesOf returns the attributes of a node's payload, if it implements
+// interface Attributes, or nil otherwise.
+func attributesOf[T comparable](node *Node[T]) Attributes {
+	if attrs, ok := interface{}(node.Payload).(Attributes); ok {
+		return attrs
+	}
+	return nil
+}
+
+// attributeFilterData is filter-local data for attribute filters.
+type attributeFilterData struct {
+	key, value string
+}
+
+// AttributeIs filters for nodes with a given attribute value. Nodes with
+// a payload which does not implement interface Attributes are not selected.
+//
+// If w is nil, AttributeIs will return nil.
+func (w *Walker[S, T]) AttributeIs(key string, value string) *Walker[S, T] {
+	return w.appendAttributeFilter(attributeIs[T], key, value)
+}
+
+// appendAttributeFilter appends a filter for an attribute task to the pipeline
+// of w. An empty attribute key is flagged as ErrInvalidFilter.
+func (w *Walker[S, T]) appendAttributeFilter(task workerTask[T, T], key, value string) *Walker[S, T] {
+	if w == nil {
+		return nil
+	}
+	if key == "" {
+		return w.setupFailed(ErrInvalidFilter)
+	}
+	newW, err := appendFilterForTask(w, task, attributeFilterData{key, value}, 0)
+	if err != nil {
+		return w.setupFailed(err)
+	}
+	return newW
+}
+
+func attributeIs[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
+	pushBuf func(*Node[T], interface{}, uint32)) error {
+	//
+	data := udata.filterlocal.(attributeFilterData)
+	if attrs := attributesOf(node); attrs != nil {
+		if v, ok := attrs.Attribute(data.key); ok && v == data.value {
+			push(node, udata.serial) // forward node to next pipeline stage
+		}
+	}
+	return nil
+}
+
+// SetAttribute sets an attribute value for all nodes of the selection.
+// Nodes are forwarded to the next pipeline stage.
+// If the payload of a node does not implement interface Attributes,
+// ErrNoAttributes is flagged.
+//
+// If w is nil, SetAttribute will return nil.
+func (w *Walker[S, T]) SetAttribute(key string, value string) *Walker[S, T] {
+	return w.appendAttributeFilter(setAttribute[T], key, value)
+}
+
+func setAttribute[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
+	pushBuf func(*Node[T], interface{}, uint32)) error {
+	//
+	attrs := attributesOf(node)
+	if attrs == nil {
+		return ErrNoAttributes
+	}
+	data := udata.filterlocal.(attributeFilterData)
+	attrs.SetAttribute(data.key, data.value)
+	push(node, udata.serial) // forward node to next pipeline stage
+	return nil
+}
+
 // Action is a function type to operate on tree nodes.
 // Resulting nodes will be pushed to the next pipeline stage, if
 // no error occured.
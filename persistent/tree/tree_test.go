@@ -3,9 +3,11 @@ package tree
 import (
 	"fmt"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
+	mutable "github.com/npillmayer/fp/tree"
 	"github.com/npillmayer/schuko/schukonf/testconfig"
 	"github.com/npillmayer/schuko/tracing"
 	"github.com/npillmayer/schuko/tracing/gologadapter"
@@ -251,7 +253,7 @@ func TestBottomUp1(t *testing.T) {
 	//
 	root, n2, n3, n4 := NewNode(3), NewNode(2), NewNode(1), NewNode(1)
 	n2 = n2.AddChild(n3)
-	root = root.AddChild(n2).AddChild(n4)
+	root = withChildren(root, n2, n4) // link n2 and n4 to the same incarnation of root
 	i := 0
 	nodevals := make([]int, 4)
 	myaction := func(n *Node[int], parent *Node[int], position int) (*Node[int], error) {
@@ -285,7 +287,7 @@ func TestBottomUp2(t *testing.T) {
 	//
 	root, n2, n3, n4 := NewNode(3), NewNode(2), NewNode(1), NewNode(1)
 	n2 = n2.AddChild(n3)
-	root = root.AddChild(n2).AddChild(n4)
+	root = withChildren(root, n2, n4) // link n2 and n4 to the same incarnation of root
 	i := 0
 	nodevals := make([]int, 6)
 	myaction := func(n *Node[int], parent *Node[int], position int) (*Node[int], error) {
@@ -319,15 +321,18 @@ func TestRank(t *testing.T) {
 	//
 	root, n2, n3, n4 := NewNode(3), NewNode(2), NewNode(1), NewNode(1)
 	n2 = n2.AddChild(n3)
-	root = root.AddChild(n2).AddChild(n4)
+	root = withChildren(root, n2, n4) // link n2 and n4 to the same incarnation of root
 	t.Logf(printTree(root))
+	if root.Rank != 4 || n2.Rank != 2 { // ranks are maintained on insertion
+		t.Errorf("Rank of root node should be 4, is %d", root.Rank)
+		t.Errorf("Rank of node n2 should be 2, is %d", n2.Rank)
+	}
 	future := NewWalker(root).DescendentsWith(NodeIsLeaf[int]()).BottomUp(CalcRank[int]).Promise()
 	nodes, err := future() // will block until walking is finished
 	if err != nil {
 		t.Error(err)
 	}
 	t.Logf(printTree(root))
-	root = nodes[0]
 	t.Logf("%v", nodes)
 	if root.Rank != 4 || n2.Rank != 2 {
 		t.Errorf("Rank of root node should be 4, is %d", root.Rank)
@@ -349,9 +354,9 @@ func TestSerial1(t *testing.T) {
 	//
 	root, n2, n3, n4 := NewNode(6), NewNode(2), NewNode(1), NewNode(5)
 	n5, n6 := NewNode(3), NewNode(4)
-	root.AddChild(n2).AddChild(n4)
-	n2.AddChild(n3)
-	n4.AddChild(n5).AddChild(n6)
+	n2 = n2.AddChild(n3)
+	n4 = n4.AddChild(n5).AddChild(n6)
+	root = root.AddChild(n2).AddChild(n4)
 	// calculate rank for each node
 	NewWalker(root).DescendentsWith(NodeIsLeaf[int]()).BottomUp(CalcRank[int]).Promise()()
 	if root.Rank != 6 {
@@ -377,8 +382,405 @@ func TestSerial1(t *testing.T) {
 	checkRuntime(t, n)
 }
 
+func TestDocumentOrder(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.tree")
+	defer teardown()
+	//
+	// Build a tree:
+	//                 (root:0)
+	//          (n1:1)----+----(n3:3)
+	//  (n2:2)----+        (n4:4)-+--(n5:5)
+	//
+	root, n1, n2, n3 := NewNode(0), NewNode(1), NewNode(2), NewNode(3)
+	n4, n5 := NewNode(4), NewNode(5)
+	n1 = n1.AddChild(n2)
+	n3 = n3.AddChild(n4).AddChild(n5)
+	root = root.AddChild(n1).AddChild(n3)
+	if root.Rank != 6 || n3.Rank != 3 {
+		t.Fatalf("expected ranks 6 and 3, have %d and %d", root.Rank, n3.Rank)
+	}
+	for i := 0; i < 6; i++ {
+		n, ok := root.NthDescendant(i)
+		if !ok || n.Payload != i {
+			t.Errorf("expected descendant #%d to have payload %d, is %v", i, i, n)
+		} else if root.IndexOf(n) != i {
+			t.Errorf("expected index of %v to be %d, is %d", n, i, root.IndexOf(n))
+		}
+	}
+	if _, ok := root.NthDescendant(6); ok {
+		t.Errorf("expected descendant #6 not to exist")
+	}
+	if n3.IndexOf(n2) != -1 {
+		t.Errorf("expected n2 not to be found in subtree of n3")
+	}
+	n6 := NewNode(6).AddChild(NewNode(7))
+	root = root.ReplaceChild(0, n6)
+	if root.Rank != 6 {
+		t.Errorf("expected rank 6 after replacing child, is %d", root.Rank)
+	}
+	root = root.InsertChild(1, NewNode(8))
+	if n, _ := root.NthDescendant(3); root.Rank != 7 || n.Payload != 8 {
+		t.Errorf("expected rank 7 and node #3 to be 8 after insertion, are %d and %v", root.Rank, n)
+	}
+	detached := n4.Detached()
+	if root.Rank != 7 || n3.Rank != 3 || detached.Parent() != nil || detached.Payload != 4 {
+		t.Errorf("expected detaching to leave ranks 7 and 3 unchanged, are %d and %d", root.Rank, n3.Rank)
+	}
+	if n4.Parent() == nil || root.IndexOf(n4) != 5 {
+		t.Errorf("expected n4 to remain part of the tree at index 5, is at %d", root.IndexOf(n4))
+	}
+	n9, n10 := NewNode(9), NewNode(10)
+	top := withChildren(NewNode(0), withChildren(NewNode(1), n9), n10) // link parents to this incarnation
+	if n9.Isolate(); top.Rank != 3 || n9.Parent() != nil || top.IndexOf(n9) != -1 {
+		t.Errorf("expected isolating to remove n9 from its parent, rank is %d", top.Rank)
+	}
+}
+
+func TestOldIncarnations(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.tree")
+	defer teardown()
+	//
+	// (0 (1 2 3) (4 5))
+	n1 := withChildren(NewNode(1), NewNode(2), NewNode(3))
+	n4 := NewNode(4).AddChild(NewNode(5))
+	v1 := withChildren(NewNode(0), n1, n4)
+	n2, _ := n1.Child(0)
+	n5, _ := n4.Child(0)
+	v2 := v1.AddChild(NewNode(6))
+	if n1.Parent() != v1 || n4.Parent() != v1 {
+		t.Errorf("expected children of v1 to stay linked to v1")
+	}
+	if v1.IndexOf(n5) != 5 || v2.IndexOf(n5) != 5 || v2.IndexOf(n2) != 2 {
+		t.Errorf("expected n5 at index 5 in both incarnations, is at %d and %d", v1.IndexOf(n5), v2.IndexOf(n5))
+	}
+	v3, ok := v1.WithReplacedSubtree(n2, NewNode(7))
+	if !ok {
+		t.Fatalf("expected v1 to be editable after v2 has been derived from it")
+	}
+	v4, ok := v1.WithReplacedSubtree(n5, NewNode(8).AddChild(NewNode(9)))
+	if !ok {
+		t.Fatalf("expected v1 to be editable after v3 has been derived from it")
+	}
+	if n5.Parent() != n4 {
+		t.Errorf("expected n5 to stay linked to n4, is linked to %v", n5.Parent())
+	}
+	v5, ok := v3.WithReplacedSubtree(n5, nil)
+	if !ok {
+		t.Fatalf("expected to find n5 in v3, although its parent link refers to v1")
+	}
+	for _, c := range []struct {
+		root     *Node[int]
+		payloads []int
+	}{
+		{v1, []int{0, 1, 2, 3, 4, 5}},
+		{v2, []int{0, 1, 2, 3, 4, 5, 6}},
+		{v3, []int{0, 1, 7, 3, 4, 5}},
+		{v4, []int{0, 1, 2, 3, 4, 8, 9}},
+		{v5, []int{0, 1, 7, 3, 4}},
+	} {
+		if int(c.root.Rank) != len(c.payloads) {
+			t.Errorf("expected incarnation to have rank %d, has %d", len(c.payloads), c.root.Rank)
+		}
+		for i, payload := range c.payloads {
+			if n, ok := c.root.NthDescendant(i); !ok || n.Payload != payload {
+				t.Errorf("expected descendant #%d to be %d, is %v", i, payload, n)
+			}
+		}
+		if r := Validate(c.root); !r.OK() {
+			t.Errorf("expected incarnation to be valid, is: %s", r)
+		}
+	}
+}
+
+func TestFreezeAndThaw(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.tree")
+	defer teardown()
+	//
+	// mutable tree: (0 (1 2 _ 3) (4))
+	m := mutable.NewNode(0)
+	m1, m4 := mutable.NewNode(1), mutable.NewNode(4)
+	m1.AddChild(mutable.NewNode(2)).SetChildAt(2, mutable.NewNode(3))
+	m.AddChild(m1).AddChild(m4)
+	//
+	frozen := Freeze(m)
+	if frozen.Rank != 5 {
+		t.Fatalf("expected frozen tree to have rank 5, has %d", frozen.Rank)
+	}
+	for i, payload := range []int{0, 1, 2, 3, 4} {
+		if n, ok := frozen.NthDescendant(i); !ok || n.Payload != payload {
+			t.Errorf("expected descendant #%d of frozen tree to be %d, is %v", i, payload, n)
+		}
+	}
+	f1, _ := frozen.Child(0)
+	if f1.ChildCount() != 3 || f1.Parent() != frozen {
+		t.Errorf("expected frozen node 1 to keep 3 child positions and to be linked to root")
+	}
+	if ch, _ := f1.Child(1); ch != nil {
+		t.Errorf("expected empty position to be preserved, is %v", ch)
+	}
+	m4.AddChild(mutable.NewNode(5)) // modifying the mutable tree does not affect the frozen one
+	if frozen.Rank != 5 {
+		t.Errorf("expected frozen tree to be unaffected by modification of mutable tree")
+	}
+	modified := frozen.AddChild(NewNode(6)) // modifying the frozen tree creates a copy
+	if frozen.ChildCount() != 2 || modified.ChildCount() != 3 {
+		t.Errorf("expected frozen tree to be immutable")
+	}
+	//
+	thawed := Thaw(modified)
+	if thawed.ChildCount() != 3 || thawed.Parent() != nil {
+		t.Fatalf("expected thawed root to have 3 children and no parent")
+	}
+	th1, _ := thawed.Child(0)
+	if th1 == m1 || th1.LoadPayload() != 1 {
+		t.Errorf("expected thawed tree to consist of fresh nodes")
+	}
+	if ch, ok := th1.Child(2); !ok || ch.Payload != 3 || ch.Parent() != th1 {
+		t.Errorf("expected thawed node 3 at position 2, is %v", ch)
+	}
+	if Freeze[int](nil) != nil || Thaw[int](nil) != nil {
+		t.Errorf("expected nil to be frozen and thawed to nil")
+	}
+}
+
+func TestWithReplacedSubtree(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.tree")
+	defer teardown()
+	//
+	// (0 (1 (2 3)) (4 5))
+	m := mutable.NewNode(0)
+	m1, m2, m4 := mutable.NewNode(1), mutable.NewNode(2), mutable.NewNode(4)
+	m2.AddChild(mutable.NewNode(3))
+	m1.AddChild(m2)
+	m4.AddChild(mutable.NewNode(5))
+	m.AddChild(m1).AddChild(m4)
+	root := Freeze(m)
+	n1, _ := root.Child(0)
+	n4, _ := root.Child(1)
+	n2, _ := n1.Child(0)
+	replacement := NewNode(6).AddChild(NewNode(7)).AddChild(NewNode(8))
+	newRoot, ok := root.WithReplacedSubtree(n2, replacement)
+	if !ok || newRoot == root {
+		t.Fatalf("expected new incarnation of root")
+	}
+	if root.Rank != 6 || newRoot.Rank != 7 {
+		t.Errorf("expected ranks 6 → 7, have %d → %d", root.Rank, newRoot.Rank)
+	}
+	for i, payload := range []int{0, 1, 6, 7, 8, 4, 5} {
+		if n, ok := newRoot.NthDescendant(i); !ok || n.Payload != payload {
+			t.Errorf("expected descendant #%d of new root to be %d, is %v", i, payload, n)
+		}
+	}
+	if ch, _ := newRoot.Child(1); ch != n4 {
+		t.Errorf("expected subtree (4 5) to be shared")
+	}
+	if ch, _ := newRoot.Child(0); ch == n1 || ch.Rank != 4 {
+		t.Errorf("expected ancestor 1 to be copied, with rank 4")
+	}
+	if ch, _ := n1.Child(0); ch != n2 || n1.Rank != 3 {
+		t.Errorf("expected old incarnation to be unchanged")
+	}
+	if _, ok := newRoot.WithReplacedSubtree(NewNode(9), nil); ok {
+		t.Errorf("expected foreign node not to be replaced")
+	}
+	if r, ok := newRoot.WithReplacedSubtree(newRoot, n4); !ok || r != n4 {
+		t.Errorf("expected replacement of root to return replacement")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.tree")
+	defer teardown()
+	//
+	// (0 (1 2 _ 3) (4))
+	m := mutable.NewNode(0)
+	m1 := mutable.NewNode(1)
+	m1.AddChild(mutable.NewNode(2)).SetChildAt(2, mutable.NewNode(3))
+	m.AddChild(m1).AddChild(mutable.NewNode(4))
+	root := Freeze(m)
+	if r := Validate(root); !r.OK() || r.Nodes != 5 {
+		t.Fatalf("expected frozen tree to be valid, is: %s", r)
+	}
+	n1, _ := root.Child(0)
+	newRoot, _ := root.WithReplacedSubtree(n1, NewNode(5).AddChild(NewNode(6)))
+	if r := Validate(root); !r.OK() {
+		t.Errorf("expected old incarnation to be valid, is: %s", r)
+	}
+	if r := Validate(newRoot); !r.OK() || r.Nodes != 4 {
+		t.Errorf("expected new incarnation to be valid, is: %s", r)
+	}
+	//
+	n4, _ := root.Child(1)
+	n4.Rank = 2
+	n4.cow = &cowTag{}
+	n2, _ := n1.Child(0)
+	n2.parent = nil
+	r := Validate(root)
+	kinds := map[mutable.ViolationKind]int{}
+	for _, v := range r.Violations {
+		kinds[v.Kind]++
+	}
+	if kinds[mutable.PendingCowTag] != 1 || kinds[mutable.BrokenParentLink] != 1 ||
+		kinds[mutable.InconsistentRank] != 1 {
+		t.Errorf("expected cow tag, broken link and inconsistent rank, have: %s", r)
+	}
+	n2.children = n2.children.appendChild(root)
+	if r := Validate(root); len(r.Violations) != 5 || r.Violations[2].Kind != mutable.Cycle {
+		t.Errorf("expected cycle to be detected, have: %s", r)
+	}
+}
+
+func TestLocation(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.tree")
+	defer teardown()
+	//
+	// (0 (1 2 _ 3) (4 5)), with subtree (4 5) shared by two parents
+	shared := NewNode(4).AddChild(NewNode(5))
+	n1 := NewNode(1).AddChild(NewNode(2)).InsertChild(2, NewNode(3))
+	root := NewNode(0).AddChild(n1).AddChild(shared)
+	other := NewNode(9).AddChild(shared) // shared stays linked to root
+	loc, ok := NewLocation(root).DownAt(1)
+	if !ok || loc.Node() != shared || loc.Index() != 4 {
+		t.Fatalf("expected to find shared subtree at index 4, have %v", loc.Node())
+	}
+	if up, _ := loc.Up(); up.Node() != root {
+		t.Errorf("expected to navigate up to root, not to the parent linked last")
+	}
+	loc, _ = NewLocation(root).Down()
+	loc, _ = loc.Down()
+	if loc, ok = loc.Right(); !ok || loc.Node().Payload != 3 || loc.Depth() != 2 || loc.Index() != 3 {
+		t.Fatalf("expected Right to skip empty position and find 3 at index 3, is %v", loc.Node())
+	}
+	if _, ok = loc.Right(); ok {
+		t.Errorf("expected 3 to be the rightmost child")
+	}
+	loc = loc.SetPayload(7)
+	loc, _ = loc.Left()
+	loc = loc.Modify(func(n *Node[int]) *Node[int] {
+		return NewNode(6).AddChild(NewNode(8))
+	})
+	newRoot := loc.Root()
+	if newRoot == root || root.Rank != 6 || newRoot.Rank != 7 {
+		t.Fatalf("expected new incarnation of rank 7, have ranks %d → %d", root.Rank, newRoot.Rank)
+	}
+	for i, payload := range []int{0, 1, 6, 8, 7, 4, 5} {
+		if n, ok := newRoot.NthDescendant(i); !ok || n.Payload != payload {
+			t.Errorf("expected descendant #%d of new root to be %d, is %v", i, payload, n)
+		}
+	}
+	if ch, _ := newRoot.Child(1); ch != shared {
+		t.Errorf("expected subtree (4 5) to be shared")
+	}
+	if ch, _ := n1.Child(0); ch.Payload != 2 || n1.Rank != 3 || other.Rank != 3 {
+		t.Errorf("expected old incarnation to be unchanged")
+	}
+	if r := NewLocation(root).Root(); r != root {
+		t.Errorf("expected Root without edits to return original root")
+	}
+}
+
+func TestWalkerVerbs(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.tree")
+	defer teardown()
+	//
+	n := checkRuntime(t, -1)
+	node1, node2, node3, node4 := NewNode(1), NewNode(2), NewNode(3), NewNode(4)
+	node2 = node2.AddChild(node3) // tree: (1)-->(2)-->(3)
+	node1 = node1.AddChild(node2) //          \->(4)
+	node1 = node1.AddChild(node4)
+	isEven := func(test, node *Node[int]) (*Node[int], error) {
+		if test.Payload%2 == 0 {
+			return test, nil
+		}
+		return nil, nil
+	}
+	identity := func(n, parent *Node[int], position int) (*Node[int], error) {
+		return n, nil
+	}
+	for _, test := range []struct {
+		verb     string
+		walk     func() *Walker[int, int]
+		expected []int
+	}{
+		{"DescendentsWith", func() *Walker[int, int] { return NewWalker(node1).DescendentsWith(NodeIsLeaf[int]()) }, []int{3, 4}},
+		{"AllDescendents", func() *Walker[int, int] { return NewWalker(node1).AllDescendents() }, []int{2, 3, 4}},
+		{"Filter", func() *Walker[int, int] { return NewWalker(node1).AllDescendents().Filter(isEven) }, []int{2, 4}},
+		{"TopDown", func() *Walker[int, int] { return NewWalker(node1).TopDown(identity) }, []int{1, 2, 3, 4}},
+	} {
+		nodes, err := test.walk().Promise()()
+		if err != nil {
+			t.Errorf("%s: %v", test.verb, err)
+		}
+		if len(nodes) != len(test.expected) || !checkNodes[int](nodes, test.expected...) {
+			t.Errorf("%s: expected nodes %v, have %v", test.verb, test.expected, nodes)
+		}
+	}
+	checkRuntime(t, n)
+}
+
+func TestAttributes(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.tree")
+	defer teardown()
+	//
+	n := checkRuntime(t, -1)
+	para1 := NewNode(&attrPayload{attrs: map[string]string{"class": "para"}})
+	para2 := NewNode(&attrPayload{attrs: map[string]string{"class": "para"}})
+	root := withChildren(NewNode(&attrPayload{attrs: map[string]string{"class": "chapter"}}),
+		para1, para2)
+	nodes, err := NewWalker(root).AllDescendents().AttributeIs("class", "para").
+		SetAttribute("lang", "en").Promise()()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(nodes) != 2 {
+		t.Errorf("expected 2 paragraphs to be selected, have %d", len(nodes))
+	}
+	for _, p := range []*Node[*attrPayload]{para1, para2} {
+		if v, ok := p.Payload.Attribute("lang"); !ok || v != "en" {
+			t.Errorf("expected attribute lang=en to be set, is %q", v)
+		}
+	}
+	if _, ok := root.Payload.Attribute("lang"); ok {
+		t.Errorf("expected root not to be selected")
+	}
+	_, err = NewWalker(NewNode(1)).SetAttribute("lang", "en").Promise()()
+	if err != ErrNoAttributes {
+		t.Errorf("expected ErrNoAttributes for int payload, have %v", err)
+	}
+	nodes, err = NewWalker(root).AttributeIs("", "para").Promise()()
+	if err != ErrInvalidFilter {
+		t.Errorf("expected ErrInvalidFilter for empty attribute key, have %v", err)
+	}
+	if len(nodes) != 0 {
+		t.Errorf("expected invalid filter to select no nodes, have %d", len(nodes))
+	}
+	_, err = NewWalker(root).AllDescendents().SetAttribute("", "en").Promise()()
+	if err != ErrInvalidFilter {
+		t.Errorf("expected ErrInvalidFilter for empty attribute key, have %v", err)
+	}
+	checkRuntime(t, n)
+}
+
 // ----------------------------------------------------------------------
 
+type attrPayload struct {
+	sync.Mutex
+	attrs map[string]string
+}
+
+func (p *attrPayload) Attribute(key string) (string, bool) {
+	p.Lock()
+	defer p.Unlock()
+	v, ok := p.attrs[key]
+	return v, ok
+}
+
+func (p *attrPayload) SetAttribute(key, value string) {
+	p.Lock()
+	defer p.Unlock()
+	p.attrs[key] = value
+}
+
 // Helper to check if result nodes are the expected ones.
 func checkNodes[T comparable](nodes []*Node[int], vals ...int) bool {
 	var found bool
@@ -427,6 +829,18 @@ func configureGoTracing(t *testing.T) {
 	tracer().Debugf("testing: DEBUG ok")
 }
 
+// withChildren adds children to a fresh node in place, linking all of them to
+// the same incarnation of node (AddChild creates an incarnation per child).
+func withChildren[T comparable](node *Node[T], children ...*Node[T]) *Node[T] {
+	cow := &cowTag{}
+	node.cow = cow
+	for _, ch := range children {
+		node = node.add(ch, cow)
+	}
+	node.cow = nil
+	return node
+}
+
 // --- Print tree ------------------------------------------------------------
 
 func printTree[T comparable](t *Node[T]) string {
@@ -447,7 +861,7 @@ func printNode[T comparable](printer tp.Tree, node *Node[T]) {
 	}
 	branch := printer.AddBranch(node.String())
 	for _, ch := range node.children {
-		assertThat(ch.parent == node, "dangling child %v", ch)
+		assertThat(ch == nil || (ch.parent != nil && ch.parent.IndexOfChild(ch) >= 0), "dangling child %v", ch)
 		printNode(branch, ch)
 	}
 }
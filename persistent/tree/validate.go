@@ -0,0 +1,70 @@
+package tree
+
+import (
+	mutable "github.com/npillmayer/fp/tree"
+)
+
+// --- Validation of tree invariants -----------------------------------------
+
+// Validate checks the invariants of the persistent tree rooted at root:
+//
+//     - every child links back to a parent holding it as a child
+//     - no node is its own ancestor
+//     - the rank of every node is the number of nodes of its subtree
+//     - no node carries a cow tag, i.e. no transient operation is pending
+//
+// Nodes are shared between incarnations of a tree, and parent links refer to
+// the incarnation a node has been attached to first (see Node.Parent). A child
+// may therefore link to a parent outside of the tree at hand, but never to a
+// node which does not hold it as a child. For the same reason nodes reachable
+// on more than one path are not reported.
+//
+// Validate is intended to catch corruption early, e.g. in tests. root may be a
+// subtree of a larger tree; its parent link is not checked. The report is of
+// the same type as for mutable trees (package fp/tree).
+func Validate[T comparable](root *Node[T]) mutable.ValidationReport[*Node[T]] {
+	var report mutable.ValidationReport[*Node[T]]
+	if root == nil {
+		return report
+	}
+	v := validator[T]{
+		report: &report,
+		onPath: make(map[*Node[T]]bool),
+	}
+	v.validate(root)
+	return report
+}
+
+type validator[T comparable] struct {
+	report *mutable.ValidationReport[*Node[T]]
+	onPath map[*Node[T]]bool // ancestors of the current node
+}
+
+// validate checks node and its subtree, returning the number of nodes of the
+// subtree.
+func (v validator[T]) validate(node *Node[T]) uint32 {
+	v.onPath[node] = true
+	defer delete(v.onPath, node)
+	v.report.Nodes++
+	if node.cow != nil {
+		v.report.Add(mutable.PendingCowTag, node, "node is tagged for in-place modification")
+	}
+	size := uint32(1)
+	for i, ch := range node.children {
+		if ch == nil {
+			continue
+		}
+		if ch.parent == nil || (ch.parent != node && ch.parent.IndexOfChild(ch) < 0) {
+			v.report.Add(mutable.BrokenParentLink, ch, "child #%d of %v links to parent %v", i, node, ch.parent)
+		}
+		if v.onPath[ch] {
+			v.report.Add(mutable.Cycle, ch, "child #%d of %v is its ancestor", i, node)
+			continue
+		}
+		size += v.validate(ch)
+	}
+	if node.Rank != size {
+		v.report.Add(mutable.InconsistentRank, node, "rank is %d, subtree has %d nodes", node.Rank, size)
+	}
+	return size
+}
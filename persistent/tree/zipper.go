@@ -0,0 +1,207 @@
+package tree
+
+// --- Zipper -----------------------------------------------------------------
+
+// Location is a focus on a node of a persistent tree, in the sense of a zipper
+// (see https://en.wikipedia.org/wiki/Zipper_(data_structure)). It is the
+// sanctioned way to navigate and edit persistent trees.
+//
+// Nodes of a persistent tree are shared between incarnations of the tree, and
+// a shared node may have more than one parent. A parent link of a node can
+// therefore refer to a single incarnation only. A Location instead remembers
+// the path it has taken from the root of the tree, thus navigating up always
+// leads to the parent within the incarnation at hand.
+//
+// Locations are values and are never modified. Edits produce a new Location,
+// leaving all the nodes of the tree untouched. Ancestors of an edited node are
+// copied as the edit is zipped up, either by navigating up or by calling Root:
+//
+//     loc, _ := NewLocation(root).Down()      // first child of root
+//     loc, _ = loc.Right()                    // second child of root
+//     loc = loc.SetPayload("B")
+//     newRoot := loc.Root()                   // root still holds the old child
+//
+// The nodes copied are connected to their children as with other modifications
+// of persistent trees (see Node.Parent), but a Location does not rely on parent
+// links.
+type Location[T comparable] struct {
+	focus   *Node[T]  // the node in focus
+	path    *crumb[T] // the way back to the root, nil for the root
+	changed bool      // the node in focus has been replaced
+}
+
+// crumb is a step taken from a parent node down to one of its children.
+type crumb[T comparable] struct {
+	parent  *Node[T]  // the parent as it has been when stepping down
+	index   int       // position of the child stepped down to
+	changed bool      // the parent has been replaced
+	up      *crumb[T] // step to the parent
+}
+
+// NewLocation returns a location focusing on root. If root is nil, the
+// location returned is invalid.
+func NewLocation[T comparable](root *Node[T]) Location[T] {
+	return Location[T]{focus: root}
+}
+
+// Node returns the node in focus.
+func (loc Location[T]) Node() *Node[T] {
+	return loc.focus
+}
+
+// IsRoot is a predicate wether the node in focus is the root of the tree.
+func (loc Location[T]) IsRoot() bool {
+	return loc.path == nil
+}
+
+// Depth returns the depth of the node in focus, with the root at depth 0.
+func (loc Location[T]) Depth() int {
+	d := 0
+	for c := loc.path; c != nil; c = c.up {
+		d++
+	}
+	return d
+}
+
+// Index returns the position of the node in focus within the tree, in
+// document order (see Node.NthDescendant). It is the replacement of
+// Node.IndexOf, but does not rely on parent links.
+func (loc Location[T]) Index() int {
+	index := 0
+	for c := loc.path; c != nil; c = c.up {
+		for _, ch := range c.parent.children[:c.index] {
+			if ch != nil {
+				index += int(ch.Rank)
+			}
+		}
+		index++ // count the parent itself
+	}
+	return index
+}
+
+// Up moves the focus to the parent of the node in focus. If the node in focus
+// has been replaced, the parent is copied, holding the replacement as its
+// child. Returns false for the root.
+func (loc Location[T]) Up() (Location[T], bool) {
+	if loc.path == nil {
+		return loc, false
+	}
+	c := loc.path
+	parent := c.parent
+	if loc.changed {
+		parent = parent.replaceChild(c.index, loc.focus, nil)
+	}
+	return Location[T]{focus: parent, path: c.up, changed: c.changed || loc.changed}, true
+}
+
+// Down moves the focus to the first child of the node in focus, skipping empty
+// positions. Returns false for leaves.
+func (loc Location[T]) Down() (Location[T], bool) {
+	if loc.focus == nil {
+		return loc, false
+	}
+	for i, ch := range loc.focus.children {
+		if ch != nil {
+			return loc.down(i, ch), true
+		}
+	}
+	return loc, false
+}
+
+// DownAt moves the focus to the child at position i of the node in focus (see
+// Node.Child). Returns false if there is no child at position i.
+func (loc Location[T]) DownAt(i int) (Location[T], bool) {
+	if loc.focus == nil {
+		return loc, false
+	}
+	ch, ok := loc.focus.Child(i)
+	if !ok {
+		return loc, false
+	}
+	return loc.down(i, ch), true
+}
+
+func (loc Location[T]) down(i int, ch *Node[T]) Location[T] {
+	return Location[T]{
+		focus: ch,
+		path:  &crumb[T]{parent: loc.focus, index: i, changed: loc.changed, up: loc.path},
+	}
+}
+
+// Left moves the focus to the nearest sibling left of the node in focus,
+// skipping empty positions. Returns false if there is none.
+func (loc Location[T]) Left() (Location[T], bool) {
+	if loc.path == nil {
+		return loc, false
+	}
+	for i := loc.path.index - 1; i >= 0; i-- {
+		if loc.path.parent.children[i] != nil {
+			return loc.sibling(i), true
+		}
+	}
+	return loc, false
+}
+
+// Right moves the focus to the nearest sibling right of the node in focus,
+// skipping empty positions. Returns false if there is none.
+func (loc Location[T]) Right() (Location[T], bool) {
+	if loc.path == nil {
+		return loc, false
+	}
+	siblings := loc.path.parent.children
+	for i := loc.path.index + 1; i < len(siblings); i++ {
+		if siblings[i] != nil {
+			return loc.sibling(i), true
+		}
+	}
+	return loc, false
+}
+
+// sibling moves the focus to the child at position i of the parent, which must
+// exist. Edits of the node in focus are zipped into the parent.
+func (loc Location[T]) sibling(i int) Location[T] {
+	parent, _ := loc.Up()
+	return parent.down(i, parent.focus.children[i])
+}
+
+// Modify replaces the node in focus by the result of f, applied to the node in
+// focus. f must not modify the node handed to it, but rather return a new node
+// (e.g., a node created with NewNode, or the result of AddChild and other
+// modifications of persistent nodes). If f returns nil, the location is
+// returned unchanged.
+func (loc Location[T]) Modify(f func(*Node[T]) *Node[T]) Location[T] {
+	if loc.focus == nil {
+		return loc
+	}
+	n := f(loc.focus)
+	if n == nil {
+		tracer().Errorf("refusing to replace %v by nil", loc.focus)
+		return loc
+	}
+	if n == loc.focus {
+		return loc
+	}
+	return Location[T]{focus: n, path: loc.path, changed: true}
+}
+
+// SetPayload replaces the node in focus by a copy carrying payload p. The
+// children of the node in focus are shared with the copy.
+func (loc Location[T]) SetPayload(p T) Location[T] {
+	return loc.Modify(func(n *Node[T]) *Node[T] {
+		c := n.copyOnWrite(nil)
+		c.Payload = p
+		return c
+	})
+}
+
+// Root zips up all edits and returns the root of the resulting incarnation of
+// the tree. If no edits have been made, the original root is returned.
+func (loc Location[T]) Root() *Node[T] {
+	for {
+		up, ok := loc.Up()
+		if !ok {
+			return loc.focus
+		}
+		loc = up
+	}
+}
@@ -0,0 +1,102 @@
+package vector
+
+import "sync"
+
+// --- Node arena ------------------------------------------------------------
+
+const defaultArenaChunkSize = 1024
+
+// NodeArena is an option to allocate the nodes of the underlying tree from an
+// arena, instead of allocating every node separately. The arena hands out nodes,
+// leaf arrays and child-link arrays from chunks, each holding chunkSize entries
+// (a chunkSize ≤ 0 selects a default of 1024).
+//
+// Use it like this:
+//
+//     vec := vector.Immutable[int](vector.NodeArena(4096))
+//
+// The arena is shared by all incarnations derived from vec. The trade-off is as
+// follows: for vectors with millions of elements, the number of heap objects
+// drops considerably (for From(…) by more than two orders of magnitude), which
+// relieves the garbage collector from tracking and scanning them. On the other
+// hand, a chunk is garbage collected as a whole, i.e. only after none of its
+// entries is referenced any more, by no incarnation of the vector. Moreover, the
+// arena has to be guarded by a mutex, which costs throughput of single
+// modifications, especially for concurrent modifications of incarnations sharing
+// an arena. Vectors with a short life-span will usually fare better without an
+// arena. See the benchmarks in arena_test.go.
+//
+// Contrary to B-trees, modifications of vectors do not create transient nodes,
+// therefore the arena for vectors does not maintain a free-list.
+func NodeArena(chunkSize int) Option {
+	conf := func(p props) props {
+		if chunkSize <= 0 {
+			chunkSize = defaultArenaChunkSize
+		}
+		p.arenaChunkSize = chunkSize
+		return p
+	}
+	return Option{config: conf}
+}
+
+// nodeArena allocates nodes and arrays from chunks. A nil arena allocates
+// from the heap.
+type nodeArena[T any] struct {
+	sync.Mutex
+	chunkSize int
+	nodes     []vnode[T]  // remainder of the current chunk of nodes
+	leafs     []T         // remainder of the current chunk of leaf entries
+	children  []*vnode[T] // remainder of the current chunk of child links
+}
+
+func newNodeArena[T any](chunkSize int) *nodeArena[T] {
+	if chunkSize <= 0 {
+		return nil
+	}
+	return &nodeArena[T]{chunkSize: chunkSize}
+}
+
+// node returns an empty node.
+func (a *nodeArena[T]) node() *vnode[T] {
+	if a == nil {
+		return &vnode[T]{}
+	}
+	a.Lock()
+	defer a.Unlock()
+	if len(a.nodes) == 0 {
+		a.nodes = make([]vnode[T], a.chunkSize)
+	}
+	n := &a.nodes[0]
+	a.nodes = a.nodes[1:]
+	return n
+}
+
+// leafArray returns an array of n zero elements, with capacity n+ext.
+func (a *nodeArena[T]) leafArray(n, ext int) []T {
+	if a == nil || n+ext > a.chunkSize {
+		return make([]T, n, n+ext)
+	}
+	a.Lock()
+	defer a.Unlock()
+	if len(a.leafs) < n+ext {
+		a.leafs = make([]T, a.chunkSize)
+	}
+	l := a.leafs[:n:n+ext]
+	a.leafs = a.leafs[n+ext:]
+	return l
+}
+
+// childArray returns an array of n nil child links, with capacity n+ext.
+func (a *nodeArena[T]) childArray(n, ext int) []*vnode[T] {
+	if a == nil || n+ext > a.chunkSize {
+		return make([]*vnode[T], n, n+ext)
+	}
+	a.Lock()
+	defer a.Unlock()
+	if len(a.children) < n+ext {
+		a.children = make([]*vnode[T], a.chunkSize)
+	}
+	c := a.children[:n:n+ext]
+	a.children = a.children[n+ext:]
+	return c
+}
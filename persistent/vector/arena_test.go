@@ -0,0 +1,113 @@
+package vector
+
+import (
+	"testing"
+
+	"github.com/npillmayer/schuko/tracing"
+	"github.com/npillmayer/schuko/tracing/gotestingadapter"
+)
+
+func TestArenaAllocation(t *testing.T) {
+	a := newNodeArena[int](8)
+	l := a.leafArray(3, 1)
+	if len(l) != 3 || cap(l) != 4 {
+		t.Errorf("expected leaf array with len=3 and cap=4, have %d|%d", len(l), cap(l))
+	}
+	_ = append(l, 1) // must not overwrite the next leaf array
+	m := a.leafArray(4, 0)
+	if m[0] != 0 {
+		t.Errorf("expected leaf arrays not to overlap, have %v", m)
+	}
+	if c := a.childArray(9, 0); len(c) != 9 {
+		t.Errorf("expected oversized child array to be allocated from the heap")
+	}
+	if newNodeArena[int](0) != nil {
+		t.Errorf("expected no arena for chunk size 0")
+	}
+}
+
+func TestArenaVector(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	for _, opts := range [][]Option{
+		{NodeArena(0)},
+		{NodeArena(5), DegreeExponent(2)},
+		{DegreeExponent(5), NodeArena(64)},
+	} {
+		v := Immutable[int](opts...)
+		if v.arena == nil {
+			t.Fatalf("expected vector to have an arena")
+		}
+		var versions []Vector[int]
+		for i := 0; i < 3000; i++ {
+			v = v.Push(i)
+			versions = append(versions, v)
+		}
+		w := v
+		for i := 0; i < 3000; i += 7 {
+			w = w.Set(i, -i)
+		}
+		for i := 0; i < 1000; i++ {
+			w = w.Pop()
+		}
+		for i, version := range versions { // all incarnations have to be unaffected
+			if version.Len() != i+1 || version.Get(i) != i || version.Get(i/2) != i/2 {
+				t.Fatalf("expected incarnation #%d to be unaffected by modifications", i)
+			}
+		}
+		if w.Len() != 2000 || w.Get(7) != -7 || w.Get(8) != 8 {
+			t.Errorf("expected modified vector to have 2000 elements, starting with -7 at 7")
+		}
+		if w.arena != v.arena {
+			t.Errorf("expected incarnations to share an arena")
+		}
+	}
+	u := From([]int{1, 2, 3, 4, 5, 6, 7, 8, 9}, NodeArena(16))
+	if u.Get(8) != 9 || u.arena == nil {
+		t.Errorf("expected From() to create vector with an arena")
+	}
+}
+
+// Benchmarks for pushing onto vectors with and without a node arena. Run with
+//
+//     go test -bench Push -benchmem ./persistent/vector
+//
+// to compare allocations per operation.
+
+func benchmarkPush(b *testing.B, opts ...Option) {
+	tracer().SetTraceLevel(tracing.LevelError)
+	v := Immutable[int](opts...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v = v.Push(i)
+	}
+}
+
+func BenchmarkPush(b *testing.B) {
+	benchmarkPush(b, DegreeExponent(5))
+}
+
+func BenchmarkPushWithArena(b *testing.B) {
+	benchmarkPush(b, DegreeExponent(5), NodeArena(0))
+}
+
+func benchmarkFrom(b *testing.B, opts ...Option) {
+	tracer().SetTraceLevel(tracing.LevelError)
+	slice := make([]int, 1<<20)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		From(slice, opts...)
+	}
+}
+
+func BenchmarkFrom(b *testing.B) {
+	benchmarkFrom(b)
+}
+
+func BenchmarkFromWithArena(b *testing.B) {
+	benchmarkFrom(b, NodeArena(0))
+}
@@ -16,18 +16,16 @@ type props struct {
 	degree uint32 // degree is always 2^bits
 	mask   uint32 // mask is degree - 1, i.e. a bit pattern with trailing 1s of length 'bits'
 	shift  uint32 // we do not store h(v), but rather bits*h(v)
-
+	//
+	arenaChunkSize int // chunk size for an arena, 0 for no arena
 }
 
 func (p props) init() props {
 	if p.bits > 0 {
 		return p
 	}
-	return props{
-		bits:   bits,
-		degree: degree,
-		mask:   mask,
-	}
+	p.bits, p.degree, p.mask = bits, degree, mask
+	return p
 }
 
 func (p props) withShift(shift uint32) props {
@@ -40,31 +38,34 @@ type vnode[T any] struct {
 	leafs    []T
 }
 
-func emptyNode[T any](k uint32) *vnode[T] {
-	return &vnode[T]{
-		children: make([]*vnode[T], int(k)),
-	}
+func emptyNode[T any](a *nodeArena[T], k uint32) *vnode[T] {
+	n := a.node()
+	n.children = a.childArray(int(k), 0)
+	return n
 }
-func newLeaf[T any](tail []T) *vnode[T] {
-	l := make([]T, len(tail))
+
+func newLeaf[T any](a *nodeArena[T], tail []T) *vnode[T] {
+	l := a.leafArray(len(tail), 0)
 	if tail != nil {
 		copy(l, tail)
 	}
-	return &vnode[T]{leafs: l}
+	n := a.node()
+	n.leafs = l
+	return n
 }
 
-func (node vnode[T]) clone(extend bool) *vnode[T] {
+func (node vnode[T]) clone(a *nodeArena[T], extend bool) *vnode[T] {
 	ext := 0
 	if extend {
 		ext = 1
 	}
-	n := &vnode[T]{}
+	n := a.node()
 	if node.leafs != nil {
-		n.leafs = make([]T, len(node.leafs), len(node.leafs)+ext)
+		n.leafs = a.leafArray(len(node.leafs), ext)
 		copy(n.leafs, node.leafs)
 	}
 	if node.children != nil {
-		n.children = make([]*vnode[T], len(node.children), len(node.children)+ext)
+		n.children = a.childArray(len(node.children), ext)
 		copy(n.children, node.children)
 	}
 	return n
@@ -79,17 +80,23 @@ func cloneTail[T any](tail []T, l int) []T {
 	return newTail
 }
 
-func newPath[T any](levels, bits, k uint32, tail []T) *vnode[T] {
+func newPath[T any](a *nodeArena[T], levels, bits, k uint32, tail []T) *vnode[T] {
 	//assertThat(levels > 0, "levels must be > 0 to create path, is %d", levels)
 	// topNode := emptyNode[T](k)
 	// topNode.children[0] =
-	topNode := newLeaf(tail)
 	tracer().Debugf("pushing down tail %v", tail)
+	return pathTo(a, levels, bits, k, newLeaf(a, tail))
+}
+
+// pathTo creates a path of intermediate nodes down to leaf, with leaf being the
+// leftmost descendent of the topmost node.
+func pathTo[T any](a *nodeArena[T], levels, bits, k uint32, leaf *vnode[T]) *vnode[T] {
+	topNode := leaf
 	tracer().Debugf("levels = %d, bits = %d", levels, bits)
 	for level := levels; level > 0; level -= bits {
 		tracer().Debugf("creating intermediate node at level %d", level)
 		tracer().Debugf("level = %d, bits = %d", level, bits)
-		newTop := emptyNode[T](k)
+		newTop := emptyNode(a, k)
 		newTop.children[0] = topNode
 		topNode = newTop
 	}
@@ -122,6 +129,20 @@ func (node vnode[T]) String() string {
 	return b.String()
 }
 
+// buildTrie creates a (sub-)trie of height shift/bits, holding all the
+// elements. len(elements) has to be a multiple of k.
+func buildTrie[T any](a *nodeArena[T], elements []T, shift, bits, k uint32) *vnode[T] {
+	if shift == 0 {
+		return newLeaf(a, elements)
+	}
+	node := emptyNode(a, k)
+	chunk := 1 << shift // number of elements per child
+	for c := 0; c*chunk < len(elements); c++ {
+		node.children[c] = buildTrie(a, elements[c*chunk:min((c+1)*chunk, len(elements))], shift-bits, bits, k)
+	}
+	return node
+}
+
 // ---------------------------------------------------------------------------
 
 func assertThat(that bool, msg string, msgargs ...interface{}) {
@@ -137,3 +158,17 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+func min32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,62 @@
+package vector
+
+// --- Iteration -------------------------------------------------------------
+
+// Iterator is a cursor which walks the elements of a vector incarnation, either
+// front to back or back to front. Use it like this:
+//
+//     it := vec.IterateReverse()
+//     for it.Next() {
+//         fmt.Printf("vec[%d] = %v\n", it.Index(), it.Value())
+//     }
+//
+// As vectors are immutable, an iterator is not affected by “modifications” of
+// the vector it has been created for.
+type Iterator[T any] struct {
+	v     Vector[T]
+	next  int    // index of the next element
+	step  int    // +1 or -1
+	leaf  []T    // cached leaf array holding the current element
+	base  uint32 // index of leaf[0]
+	index int    // index of the current element
+}
+
+// Iterate returns an iterator, walking the elements of v from the first to the last.
+func (v Vector[T]) Iterate() *Iterator[T] {
+	v.props = v.props.init()
+	return &Iterator[T]{v: v, next: 0, step: 1, index: -1}
+}
+
+// IterateReverse returns an iterator, walking the elements of v from the last
+// to the first.
+func (v Vector[T]) IterateReverse() *Iterator[T] {
+	v.props = v.props.init()
+	return &Iterator[T]{v: v, next: v.Len() - 1, step: -1, index: -1}
+}
+
+// Next moves the iterator to the next element. It returns false if there are no
+// more elements.
+func (it *Iterator[T]) Next() bool {
+	if it == nil || it.next < 0 || it.next >= it.v.Len() {
+		return false
+	}
+	i := uint32(it.next)
+	if it.leaf == nil || i < it.base || i >= it.base+uint32(len(it.leaf)) {
+		it.leaf, it.base = it.v.leafFor(i) // crossing leaf boundary
+	}
+	it.index = it.next
+	it.next += it.step
+	return true
+}
+
+// Index returns the index of the current element.
+// It is illegal to call Index if Next has not returned true.
+func (it *Iterator[T]) Index() int {
+	return it.index
+}
+
+// Value returns the current element.
+// It is illegal to call Value if Next has not returned true.
+func (it *Iterator[T]) Value() T {
+	return it.leaf[uint32(it.index)-it.base]
+}
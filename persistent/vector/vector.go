@@ -1,6 +1,7 @@
 package vector
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/npillmayer/fp/maybe"
@@ -11,6 +12,7 @@ type Vector[T any] struct {
 	length uint32
 	tail   []T
 	root   *vnode[T]
+	arena  *nodeArena[T] // optional arena for node allocation
 }
 
 func Immutable[T any](opts ...Option) Vector[T] {
@@ -18,9 +20,43 @@ func Immutable[T any](opts ...Option) Vector[T] {
 	for _, option := range opts {
 		v.props = option.config(v.props)
 	}
+	v.arena = newNodeArena[T](v.arenaChunkSize)
 	return v
 }
 
+// From creates a vector holding the elements of a slice, in order. Leaf nodes
+// are filled directly, which is much faster than pushing elements one by one.
+// The slice is copied, i.e., clients may modify it afterwards.
+func From[T any](slice []T, opts ...Option) Vector[T] {
+	v := Immutable[T](opts...)
+	v.props = v.props.init()
+	if len(slice) == 0 {
+		return v
+	}
+	v.length = uint32(len(slice))
+	trieSize := v.tailOffset()
+	v.tail = cloneTail(slice[trieSize:], len(slice)-int(trieSize))
+	if trieSize == 0 {
+		return v
+	}
+	// find the height of the trie, as Push would have grown it
+	leafCount := trieSize >> v.bits
+	for v.shift = 0; leafCount > 1<<v.shift; v.shift += v.bits {
+	}
+	v.root = buildTrie(v.arena, slice[:trieSize], v.shift, v.bits, v.degree)
+	return v
+}
+
+// FromChan creates a vector holding the elements received from a channel, in
+// order of arrival. It returns as soon as the channel is closed.
+func FromChan[T any](ch <-chan T, opts ...Option) Vector[T] {
+	var elements []T
+	for x := range ch {
+		elements = append(elements, x)
+	}
+	return From(elements, opts...)
+}
+
 // Option is a type to help initializing vectors at creation time.
 type Option struct {
 	config func(props) props
@@ -41,7 +77,7 @@ func DegreeExponent(n int) Option {
 		} else if n > 5 {
 			n = 5
 		}
-		p = props{bits: uint32(n)}
+		p.bits = uint32(n)
 		p.degree = 1 << p.bits
 		p.mask = p.degree - 1
 		return p
@@ -55,45 +91,250 @@ func (v Vector[T]) Len() int {
 	return int(v.length)
 }
 
+// First returns the first element of a vector, or Nothing if the vector is empty.
+func (v Vector[T]) First() maybe.Maybe[T] {
+	if v.length == 0 {
+		return maybe.Nothing[T]()
+	}
+	return maybe.Just(v.Get(0))
+}
+
+// Last returns the last element of a vector, or Nothing if the vector is empty.
+// After popping the last element of the tail, the tail is re-filled from the
+// trie, therefore the last element is always found in constant time.
 func (v Vector[T]) Last() maybe.Maybe[T] {
-	if len(v.tail) == 0 {
+	if v.length == 0 {
 		return maybe.Nothing[T]()
 	}
-	return maybe.Just(v.tail[len(v.tail)-1])
+	return maybe.Just(v.Get(int(v.length) - 1))
+}
+
+// ToSlice returns the elements of a vector as a slice. Elements are copied leaf
+// by leaf.
+func (v Vector[T]) ToSlice() []T {
+	if v.length == 0 {
+		return []T{}
+	}
+	v.props = v.props.init()
+	slice := make([]T, 0, v.length)
+	for i := uint32(0); i < v.tailOffset(); i += v.degree {
+		leaf, _ := v.leafFor(i)
+		slice = append(slice, leaf...)
+	}
+	return append(slice, v.tail...)
 }
 
+// Thaw returns the elements of a vector as a mutable slice, the transient
+// counterpart of a vector (see package persistent). It is the same as ToSlice.
+func (v Vector[T]) Thaw() []T {
+	return v.ToSlice()
+}
+
+// ErrIndexOutOfRange is returned by the non-panicking variants of vector
+// operations (GetOK, SetOK, PopOK) for indexes outside of a vector.
+var ErrIndexOutOfRange = errors.New("persistent.vector: index out of range")
+
+// Get returns the element at index i. It panics if i is out of range; use GetOK
+// to check the index without panicking.
 func (v Vector[T]) Get(i int) T {
 	assertThat(i >= 0 && uint32(i) < v.length, fmt.Sprintf("vector index out of bounds: %d with length %d", i, v.length))
+	return v.GetUnchecked(i)
+}
+
+// GetOK returns the element at index i, or ErrIndexOutOfRange if i is out of
+// range.
+func (v Vector[T]) GetOK(i int) (T, error) {
+	if err := v.checkIndex(i); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v.GetUnchecked(i), nil
+}
+
+// GetUnchecked returns the element at index i without checking the index
+// first. It is the fast path for hot loops, where the index is known to lie
+// within the vector, e.g.
+//
+//     for i := 0; i < v.Len(); i++ {
+//         sum += v.GetUnchecked(i)
+//     }
+//
+// For an index out of range, GetUnchecked will either panic with a runtime
+// error or return an arbitrary element.
+func (v Vector[T]) GetUnchecked(i int) T {
 	v.props = v.props.init()
-	if uint32(i) >= v.tailOffset() {
-		return v.tail[uint32(i)&v.mask]
+	leaf, _ := v.leafFor(uint32(i))
+	return leaf[uint32(i)&v.mask]
+}
+
+// checkIndex returns ErrIndexOutOfRange, wrapped with the details, if i is not a
+// valid index of v.
+func (v Vector[T]) checkIndex(i int) error {
+	if i < 0 || uint32(i) >= v.length {
+		return fmt.Errorf("%w: %d with length %d", ErrIndexOutOfRange, i, v.length)
+	}
+	return nil
+}
+
+// leafFor returns the leaf array holding the element at index i, together with the
+// index of the leaf's first element. v.props have to be initialized.
+func (v Vector[T]) leafFor(i uint32) ([]T, uint32) {
+	if i >= v.tailOffset() && len(v.tail) > 0 {
+		return v.tail, v.tailOffset()
 	}
 	node := v.root
 	for level := v.shift; level > 0; level -= v.bits {
-		node = node.children[(uint32(i)>>level)&v.mask]
+		node = node.children[(i>>level)&v.mask]
 	}
-	return node.leafs[uint32(i)&v.mask]
+	return node.leafs, i &^ v.mask
 }
 
+// Set returns a copy of v with the element at index i replaced by value. It
+// panics if i is out of range; use SetOK to check the index without panicking.
 func (v Vector[T]) Set(i int, value T) Vector[T] {
 	assertThat(i >= 0 && uint32(i) < v.length, fmt.Sprintf("vector index out of bounds: %d with length %d", i, v.length))
 	v.props = v.props.init()
 	if uint32(i) >= v.tailOffset() {
 		newTail := cloneTail(v.tail, len(v.tail))
 		newTail[uint32(i)&v.mask] = value
-		return Vector[T]{length: v.length, props: v.props, root: v.root, tail: newTail}
+		return Vector[T]{length: v.length, props: v.props, root: v.root, tail: newTail, arena: v.arena}
 	}
-	newRoot := v.root.clone(false)
+	newRoot := v.root.clone(v.arena, false)
 	node := newRoot
 	for level := v.shift; level > 0; level -= v.bits {
 		subidx := (uint32(i) >> level) & v.mask
 		child := node.children[subidx]
-		child = child.clone(false)
+		child = child.clone(v.arena, false)
 		node.children[subidx] = child
 		node = child
 	}
 	node.leafs[uint32(i)&v.mask] = value
-	return Vector[T]{length: v.length, props: v.props, root: newRoot, tail: v.tail}
+	return Vector[T]{length: v.length, props: v.props, root: newRoot, tail: v.tail, arena: v.arena}
+}
+
+// SetOK is like Set, but returns v unchanged together with ErrIndexOutOfRange
+// if i is out of range.
+func (v Vector[T]) SetOK(i int, value T) (Vector[T], error) {
+	if err := v.checkIndex(i); err != nil {
+		return v, err
+	}
+	return v.Set(i, value), nil
+}
+
+// Update replaces the element at index i by f applied to it. As with Set, only the
+// path from the root to the leaf holding the element is copied.
+func (v Vector[T]) Update(i int, f func(T) T) Vector[T] {
+	assertThat(i >= 0 && uint32(i) < v.length, fmt.Sprintf("vector index out of bounds: %d with length %d", i, v.length))
+	v.props = v.props.init()
+	if uint32(i) >= v.tailOffset() {
+		newTail := cloneTail(v.tail, len(v.tail))
+		newTail[uint32(i)&v.mask] = f(newTail[uint32(i)&v.mask])
+		return Vector[T]{length: v.length, props: v.props, root: v.root, tail: newTail, arena: v.arena}
+	}
+	newRoot := v.root.clone(v.arena, false)
+	node := newRoot
+	for level := v.shift; level > 0; level -= v.bits {
+		subidx := (uint32(i) >> level) & v.mask
+		child := node.children[subidx]
+		child = child.clone(v.arena, false)
+		node.children[subidx] = child
+		node = child
+	}
+	node.leafs[uint32(i)&v.mask] = f(node.leafs[uint32(i)&v.mask])
+	return Vector[T]{length: v.length, props: v.props, root: newRoot, tail: v.tail, arena: v.arena}
+}
+
+// SetRange overwrites the elements starting at index i with values, i.e. element
+// i+k is set to values[k]. The range has to lie within the vector. Every node
+// touched by the range is copied only once, and leafs are filled chunk by chunk,
+// which is much faster than calling Set for each element.
+func (v Vector[T]) SetRange(i int, values []T) Vector[T] {
+	assertThat(i >= 0 && i+len(values) <= int(v.length),
+		fmt.Sprintf("vector range out of bounds: [%d…%d) with length %d", i, i+len(values), v.length))
+	if len(values) == 0 {
+		return v
+	}
+	v.props = v.props.init()
+	from, to := uint32(i), uint32(i+len(values))
+	newRoot, newTail := v.root, v.tail
+	if off := v.tailOffset(); from < off {
+		newRoot = v.setRangeIn(v.root, v.shift, from, min32(to, off), values, from)
+	}
+	if off := v.tailOffset(); to > off {
+		newTail = cloneTail(v.tail, len(v.tail))
+		lo := max32(from, off)
+		copy(newTail[lo-off:], values[lo-from:to-from])
+	}
+	return Vector[T]{length: v.length, props: v.props, root: newRoot, tail: newTail, arena: v.arena}
+}
+
+// setRangeIn copies node, which is located at the given level, and overwrites the
+// elements in [lo…hi) with the corresponding values, where values[0] is the
+// element at index start. Children outside of [lo…hi) are shared.
+func (v Vector[T]) setRangeIn(node *vnode[T], level, lo, hi uint32, values []T, start uint32) *vnode[T] {
+	n := node.clone(v.arena, false)
+	if level == 0 {
+		copy(n.leafs[lo&v.mask:], values[lo-start:hi-start])
+		return n
+	}
+	span := uint32(1) << level // number of elements per child
+	for c := lo; c < hi; c = (c &^ (span - 1)) + span {
+		subidx := (c >> level) & v.mask
+		chi := min32(hi, (c&^(span-1))+span)
+		n.children[subidx] = v.setRangeIn(n.children[subidx], level-v.bits, c, chi, values, start)
+	}
+	return n
+}
+
+// Insert inserts value at index i, shifting the elements from i onwards up by one.
+// i may be equal to the length of v, in which case Insert is the same as Push.
+// The nodes before index i are shared. If i is located in the tail, which is the
+// common case for small vectors, only the tail and at most one path of the trie
+// are copied. Otherwise, as the trie is not relaxed, every leaf covering the
+// shifted elements has to be copied (once).
+func (v Vector[T]) Insert(i int, value T) Vector[T] {
+	assertThat(i >= 0 && uint32(i) <= v.length, fmt.Sprintf("vector index out of bounds: %d with length %d", i, v.length))
+	if uint32(i) == v.length {
+		return v.Push(value)
+	}
+	v.props = v.props.init()
+	last, _ := v.leafFor(v.length - 1)
+	overflow := last[(v.length-1)&v.mask] // last element is pushed out at the end
+	shifted := make([]T, 1, v.length-uint32(i))
+	shifted[0] = value
+	shifted = v.appendRange(shifted, uint32(i), v.length-1)
+	return v.SetRange(i, shifted).Push(overflow)
+}
+
+// appendRange appends the elements in [from…to) to slice, leaf by leaf.
+// v.props have to be initialized.
+func (v Vector[T]) appendRange(slice []T, from, to uint32) []T {
+	for from < to {
+		leaf, base := v.leafFor(from)
+		end := min32(to-base, uint32(len(leaf)))
+		slice = append(slice, leaf[from-base:end]...)
+		from = base + end
+	}
+	return slice
+}
+
+// SortedInsert inserts x into v, which is expected to be sorted according to less,
+// such that the result is sorted as well. x is placed after all elements equal to
+// it, thus repeated insertion is stable. The position is found by binary search,
+// then x is inserted with Insert.
+func SortedInsert[T any](v Vector[T], x T, less func(a, b T) bool) Vector[T] {
+	v.props = v.props.init()
+	lo, hi := uint32(0), v.length
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		leaf, base := v.leafFor(mid)
+		if less(x, leaf[mid-base]) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return v.Insert(int(lo), x)
 }
 
 func (v Vector[T]) Push(value T) Vector[T] {
@@ -102,66 +343,127 @@ func (v Vector[T]) Push(value T) Vector[T] {
 		tracer().Debugf("tail not full, appending %v to %v", value, v.tail)
 		newTail := cloneTail(v.tail, len(v.tail)+1)
 		newTail[len(newTail)-1] = value
-		return Vector[T]{length: v.length + 1, props: v.props, root: v.root, tail: newTail}
+		return Vector[T]{length: v.length + 1, props: v.props, root: v.root, tail: newTail, arena: v.arena}
 	}
 	// tail is full ⇒ have to move tail into tree
 	newTail := []T{value}
 	assertThat(v.length >= v.degree, "inconsistency: vector.length expected to be > degree")
 	if v.length == v.degree { // if old size = degree ⇒ tail becomes new root
 		assertThat(v.root == nil, "inconsistency: vector.root expected to be nil")
-		leaf := newLeaf(v.tail)
-		return Vector[T]{length: v.length + 1, props: v.props.withShift(0), root: leaf, tail: newTail}
+		leaf := newLeaf(v.arena, v.tail)
+		return Vector[T]{length: v.length + 1, props: v.props.withShift(0), root: leaf, tail: newTail, arena: v.arena}
 	}
 	// check for root is full ⇒ increment shift
-	newRoot := &vnode[T]{}
 	s := v.shift
 	if (v.length >> v.bits) > (1 << v.shift) {
 		s += v.bits
-		newRoot = emptyNode[T](v.degree)
+		newRoot := emptyNode(v.arena, v.degree)
 		newRoot.children[0] = v.root
-		newRoot.children[1] = newPath(v.shift, v.bits, v.degree, v.tail)
+		newRoot.children[1] = newPath(v.arena, v.shift, v.bits, v.degree, v.tail)
 		tracer().Debugf("created new vector tail %v", newTail)
-		v = Vector[T]{length: v.length + 1, props: v.props.withShift(s), root: newRoot, tail: newTail}
+		v = Vector[T]{length: v.length + 1, props: v.props.withShift(s), root: newRoot, tail: newTail, arena: v.arena}
 		return v
 	}
 	// still space in root
-	newRoot = v.pushLeaf(v.length - 1)
-	return Vector[T]{length: v.length + 1, props: v.props, root: newRoot, tail: newTail}
+	newRoot := v.pushLeaf(v.length - 1)
+	return Vector[T]{length: v.length + 1, props: v.props, root: newRoot, tail: newTail, arena: v.arena}
 }
 
 func (v Vector[T]) pushLeaf(i uint32) *vnode[T] {
-	newRoot := v.root.clone(false)
+	return v.insertLeaf(i, newLeaf(v.arena, v.tail))
+}
+
+// insertLeaf copies the path from the root to the position of index i and
+// links leaf at this position, creating intermediate nodes as needed.
+func (v Vector[T]) insertLeaf(i uint32, leaf *vnode[T]) *vnode[T] {
+	newRoot := v.root.clone(v.arena, false)
 	node := newRoot
-	for level := v.shift; level > 0; level -= bits {
+	for level := v.shift; level > v.bits; level -= v.bits {
 		subidx := (i >> level) & v.mask
 		child := node.children[subidx]
 		if child == nil {
-			node.children[subidx] = newPath(level-5, v.bits, v.degree, v.tail)
+			node.children[subidx] = pathTo(v.arena, level-v.bits, v.bits, v.degree, leaf)
 			return newRoot
 		}
-		child = child.clone(false)
+		child = child.clone(v.arena, false)
 		node.children[subidx] = child
 		node = child
 	}
-	node.children[(i>>5)&v.mask] = newLeaf(v.tail)
+	node.children[(i>>v.bits)&v.mask] = leaf
 	return newRoot
 }
 
+// AppendAll appends the elements of vectors vs to v, in order. Appending is done
+// chunk by chunk instead of element by element: whenever the length of the
+// result is a multiple of the degree of v, a leaf of a source vector is taken
+// over as a whole, sharing its array instead of copying it. Appending many
+// vectors with lengths of multiples of the degree, e.g. runs of a paragraph,
+// thus copies the elements of the tails only.
+//
+// Vectors of different degrees may be appended, but leafs of different size
+// have to be copied.
+func (v Vector[T]) AppendAll(vs ...Vector[T]) Vector[T] {
+	v.props = v.props.init()
+	for _, u := range vs {
+		u.props = u.props.init()
+		for i := uint32(0); i < u.length; {
+			leaf, base := u.leafFor(i)
+			chunk := leaf[i-base:]
+			if free := (v.degree - v.length&v.mask) & v.mask; free == 0 { // tail full or empty
+				chunk = chunk[:min(len(chunk), int(v.degree))]
+				v = v.appendLeaf(chunk)
+			} else { // fill up tail
+				chunk = chunk[:min(len(chunk), int(free))]
+				newTail := cloneTail(v.tail, len(v.tail)+len(chunk))
+				copy(newTail[len(v.tail):], chunk)
+				v = Vector[T]{length: v.length + uint32(len(chunk)), props: v.props, root: v.root, tail: newTail, arena: v.arena}
+			}
+			i += uint32(len(chunk))
+		}
+	}
+	return v
+}
+
+// appendLeaf appends a chunk of at most degree elements to v, which has to
+// have a length of a multiple of the degree. The full tail of v moves into the
+// trie and chunk becomes the new tail. Neither of them are copied, as leaf
+// arrays are never modified in place. v.props have to be initialized.
+func (v Vector[T]) appendLeaf(chunk []T) Vector[T] {
+	length := v.length + uint32(len(chunk))
+	if v.length == 0 {
+		return Vector[T]{length: length, props: v.props.withShift(0), tail: chunk, arena: v.arena}
+	}
+	leaf := v.arena.node()
+	leaf.leafs = v.tail
+	if v.length == v.degree { // tail becomes new root
+		return Vector[T]{length: length, props: v.props.withShift(0), root: leaf, tail: chunk, arena: v.arena}
+	}
+	if (v.length >> v.bits) > (1 << v.shift) { // root is full
+		newRoot := emptyNode(v.arena, v.degree)
+		newRoot.children[0] = v.root
+		newRoot.children[1] = pathTo(v.arena, v.shift, v.bits, v.degree, leaf)
+		return Vector[T]{length: length, props: v.props.withShift(v.shift + v.bits), root: newRoot, tail: chunk, arena: v.arena}
+	}
+	return Vector[T]{length: length, props: v.props, root: v.insertLeaf(v.length-1, leaf), tail: chunk, arena: v.arena}
+}
+
+// Pop returns a copy of v with the last element removed. It panics if v is
+// empty; use PopOK to avoid panicking.
 func (v Vector[T]) Pop() Vector[T] {
 	assertThat(v.length > 0, "attempt to remove item from empty vector")
 	v.props = v.props.init()
 	if v.length == 1 {
-		v = Vector[T]{props: v.props}
+		v = Vector[T]{props: v.props, arena: v.arena}
 		v.shift = 0
 		return v
 	}
 	if ((v.length - 1) & v.mask) > 0 {
 		newTail := cloneTail(v.tail, len(v.tail)-1)
-		return Vector[T]{length: v.length - 1, props: v.props, root: v.root, tail: newTail}
+		return Vector[T]{length: v.length - 1, props: v.props, root: v.root, tail: newTail, arena: v.arena}
 	}
 	newTrieSize := v.length - v.degree - 1 // new trie size minus length of tail
 	if newTrieSize == 0 {                  // root vanishes into tail
-		v = Vector[T]{length: v.degree, props: v.props, root: nil, tail: v.root.leafs}
+		v = Vector[T]{length: v.degree, props: v.props, root: nil, tail: v.root.leafs, arena: v.arena}
 		v.shift = 0
 		return v
 	}
@@ -171,15 +473,24 @@ func (v Vector[T]) Pop() Vector[T] {
 	return v.popTrie()
 }
 
+// PopOK is like Pop, but returns v unchanged together with ErrIndexOutOfRange
+// if v is empty.
+func (v Vector[T]) PopOK() (Vector[T], error) {
+	if v.length == 0 {
+		return v, fmt.Errorf("%w: cannot pop from empty vector", ErrIndexOutOfRange)
+	}
+	return v.Pop(), nil
+}
+
 func (v Vector[T]) lowerTrie() Vector[T] {
 	lowerShift := v.shift - v.bits
 	newRoot := v.root.children[0]
 	// find new tail
 	node := v.root.children[1]
-	for level := lowerShift; level > 0; level -= bits {
+	for level := lowerShift; level > 0; level -= v.bits {
 		node = node.children[0]
 	}
-	v = Vector[T]{length: v.length - 1, props: v.props, root: newRoot, tail: node.leafs}
+	v = Vector[T]{length: v.length - 1, props: v.props, root: newRoot, tail: node.leafs, arena: v.arena}
 	v.shift = lowerShift
 	return v
 }
@@ -188,9 +499,9 @@ func (v Vector[T]) popTrie() Vector[T] {
 	newTrieSize := v.length - v.degree - 1
 	forkPoint := newTrieSize ^ (newTrieSize - 1) // where does the node-path fork?
 	var forked bool
-	newRoot := v.root.clone(false)
+	newRoot := v.root.clone(v.arena, false)
 	node := newRoot
-	for level := v.shift; level > 0; level -= bits {
+	for level := v.shift; level > 0; level -= v.bits {
 		subidx := (newTrieSize >> level) & v.mask
 		child := node.children[subidx]
 		switch {
@@ -201,12 +512,12 @@ func (v Vector[T]) popTrie() Vector[T] {
 			node.children[subidx] = nil
 			node = child
 		default:
-			child = child.clone(false)
+			child = child.clone(v.arena, false)
 			node.children[subidx] = child
 			node = child
 		}
 	}
-	v = Vector[T]{length: v.length - 1, props: v.props, root: newRoot, tail: node.leafs}
+	v = Vector[T]{length: v.length - 1, props: v.props, root: newRoot, tail: node.leafs, arena: v.arena}
 	return v
 }
 
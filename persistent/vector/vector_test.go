@@ -1,9 +1,12 @@
 package vector
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"testing"
 
+	"github.com/npillmayer/schuko/tracing"
 	"github.com/npillmayer/schuko/tracing/gotestingadapter"
 	tp "github.com/xlab/treeprint"
 )
@@ -116,6 +119,350 @@ func TestVectorPop(t *testing.T) {
 	}
 }
 
+func TestVectorDeepTries(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	for bits := 1; bits <= 4; bits++ { // tries with more than 2 levels for non-default degrees
+		v := Immutable[int](DegreeExponent(bits))
+		for i := 0; i < 1000; i++ {
+			v = v.Push(i)
+		}
+		for i := 0; i < 1000; i++ {
+			if v.Get(i) != i {
+				t.Fatalf("bits=%d: expected element #%d to be %d, is %d", bits, i, i, v.Get(i))
+			}
+		}
+		for l := 999; l > 0; l-- {
+			v = v.Pop()
+			if v.Len() != l || v.Get(l-1) != l-1 || v.Get(l/2) != l/2 {
+				t.Fatalf("bits=%d: expected vector of length %d to end with %d after pop", bits, l, l-1)
+			}
+		}
+	}
+}
+
+func TestVectorFirstLast(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	defer teardown()
+	//
+	v := Immutable[int](DegreeExponent(1))
+	if x := v.First().WithDefault(99); x != 99 {
+		t.Error("expected empty vector to have first element of 'nothing', didn't")
+	}
+	v = v.Push(77).Push(78).Push(79).Push(80).Push(81)
+	if x := v.First().WithDefault(99); x != 77 {
+		t.Logf(printVec(v))
+		t.Errorf("expected first element to be 77, is %d", x)
+	}
+	if x := v.Last().WithDefault(99); x != 81 {
+		t.Logf(printVec(v))
+		t.Errorf("expected last element to be 81, is %d", x)
+	}
+	v = v.Pop() // tail is re-filled from the trie
+	if x := v.Last().WithDefault(99); x != 80 {
+		t.Logf(printVec(v))
+		t.Errorf("expected last element from trie to be 80, is %d", x)
+	}
+	for v.Len() > 1 {
+		v = v.Pop()
+	}
+	if x, y := v.First().WithDefault(99), v.Last().WithDefault(99); x != 77 || y != 77 {
+		t.Errorf("expected first and last element of single element vector to be 77, are %d and %d", x, y)
+	}
+	w := From([]int{1, 2, 3, 4, 5, 6, 7, 8}, DegreeExponent(1)) // completely filled leafs
+	if x, y := w.First().WithDefault(99), w.Last().WithDefault(99); x != 1 || y != 8 {
+		t.Errorf("expected first and last element of vector from slice to be 1 and 8, are %d and %d", x, y)
+	}
+}
+
+func TestVectorIterate(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	defer teardown()
+	//
+	v := Immutable[int](DegreeExponent(1))
+	for i := 0; i < 7; i++ {
+		v = v.Push(i * 10)
+	}
+	var fwd, bwd []int
+	for it := v.Iterate(); it.Next(); {
+		if it.Value() != v.Get(it.Index()) {
+			t.Errorf("expected value at index %d to be %d, is %d", it.Index(), v.Get(it.Index()), it.Value())
+		}
+		fwd = append(fwd, it.Value())
+	}
+	for it := v.IterateReverse(); it.Next(); {
+		bwd = append(bwd, it.Value())
+	}
+	if fmt.Sprint(fwd) != "[0 10 20 30 40 50 60]" {
+		t.Errorf("unexpected forward iteration: %v", fwd)
+	}
+	if fmt.Sprint(bwd) != "[60 50 40 30 20 10 0]" {
+		t.Errorf("unexpected reverse iteration: %v", bwd)
+	}
+	if (Vector[int]{}).IterateReverse().Next() {
+		t.Errorf("expected reverse iterator of empty vector to be exhausted")
+	}
+}
+
+func TestVectorFromSlice(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	for _, n := range []int{0, 1, 8, 9, 16, 17, 64, 65, 100, 513, 5000} {
+		slice := make([]int, n)
+		for i := range slice {
+			slice[i] = i
+		}
+		v := From(slice)
+		if v.Len() != n {
+			t.Fatalf("expected vector of length %d, is %d", n, v.Len())
+		}
+		for i := 0; i < n; i++ {
+			if x := v.Get(i); x != i {
+				t.Fatalf("n=%d: expected element #%d to be %d, is %d", n, i, i, x)
+			}
+		}
+		if s := v.ToSlice(); fmt.Sprint(s) != fmt.Sprint(slice) {
+			t.Errorf("n=%d: expected ToSlice() to reproduce input slice, is %v", n, s)
+		}
+		if n > 0 && v.Pop().Len() != n-1 {
+			t.Errorf("n=%d: expected vector to be pop-able", n)
+		}
+	}
+	w := Immutable[int]()
+	slice := make([]int, 0, 24)
+	for i := 0; i < 24; i++ {
+		w = w.Push(i)
+		slice = append(slice, i)
+		if v := From(slice); v.shift != w.shift || fmt.Sprint(v.ToSlice()) != fmt.Sprint(w.ToSlice()) {
+			t.Fatalf("length %d: expected From() to create same vector as Push()", i+1)
+		}
+	}
+	v := From(slice[:16]).Push(16)
+	if x := v.Get(16); x != 16 {
+		t.Errorf("expected push onto vector created by From() to work, element is %d", x)
+	}
+}
+
+func TestVectorFromChan(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	defer teardown()
+	//
+	ch := make(chan string)
+	go func() {
+		for _, s := range []string{"a", "b", "c"} {
+			ch <- s
+		}
+		close(ch)
+	}()
+	v := FromChan(ch)
+	if s := v.ToSlice(); fmt.Sprint(s) != "[a b c]" {
+		t.Errorf("expected vector to contain [a b c], is %v", s)
+	}
+	if s := (Vector[int]{}).ToSlice(); s == nil || len(s) != 0 {
+		t.Errorf("expected empty vector to result in empty slice, is %#v", s)
+	}
+}
+
+func TestVectorUpdate(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	v := From([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19})
+	w := v.Update(3, func(x int) int { return x * 10 }).Update(18, func(x int) int { return -x })
+	if x := w.Get(3); x != 30 {
+		t.Errorf("expected element #3 to be updated to 30, is %d", x)
+	}
+	if x := w.Get(18); x != -18 {
+		t.Errorf("expected element #18 in tail to be updated to -18, is %d", x)
+	}
+	if v.Get(3) != 3 || v.Get(18) != 18 {
+		t.Errorf("expected original vector to be unchanged, is %v", v.ToSlice())
+	}
+}
+
+func TestVectorSetRange(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	const n = 300
+	slice := make([]int, n)
+	for i := range slice {
+		slice[i] = i
+	}
+	v := From(slice)
+	for _, r := range [][2]int{{0, 0}, {0, 1}, {5, 3}, {7, 10}, {0, 64}, {60, 100}, {250, 50}, {295, 5}, {0, n}} {
+		values := make([]int, r[1])
+		for k := range values {
+			values[k] = -(r[0] + k)
+		}
+		w := v.SetRange(r[0], values)
+		for i := 0; i < n; i++ {
+			expected := i
+			if i >= r[0] && i < r[0]+r[1] {
+				expected = -i
+			}
+			if x := w.Get(i); x != expected {
+				t.Fatalf("range %v: expected element #%d to be %d, is %d", r, i, expected, x)
+			}
+		}
+	}
+	if s := v.ToSlice(); fmt.Sprint(s) != fmt.Sprint(slice) {
+		t.Errorf("expected original vector to be unchanged by SetRange")
+	}
+}
+
+func TestVectorSortedInsert(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	less := func(a, b int) bool { return a < b }
+	v := Immutable[int](DegreeExponent(2))
+	var snapshots []Vector[int]
+	var inserted []int
+	for i := 0; i < 100; i++ {
+		snapshots = append(snapshots, v)
+		x := (i * 37) % 101
+		inserted = append(inserted, x)
+		v = SortedInsert(v, x, less)
+	}
+	snapshots = append(snapshots, v)
+	for n, snap := range snapshots { // every incarnation holds its own elements, sorted
+		expected := append([]int(nil), inserted[:n]...)
+		sort.Ints(expected)
+		if s := fmt.Sprint(snap.ToSlice()); s != fmt.Sprint(expected) {
+			t.Fatalf("expected incarnation #%d to be %v, is %s", n, expected, s)
+		}
+	}
+	// inserting into the tail copies the tail only
+	w := From([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, DegreeExponent(2))
+	u := w.Insert(9, 42)
+	if u.root != w.root {
+		t.Errorf("expected insertion into the tail to share the trie")
+	}
+	if s := fmt.Sprint(u.ToSlice()); s != "[0 1 2 3 4 5 6 7 8 42 9]" {
+		t.Errorf("expected [0 1 2 3 4 5 6 7 8 42 9], have %s", s)
+	}
+	if s := fmt.Sprint(w.ToSlice()); s != "[0 1 2 3 4 5 6 7 8 9]" {
+		t.Errorf("expected original vector to be unchanged, have %s", s)
+	}
+	// inserting into the trie shares the leafs before the insertion point
+	u = w.Insert(5, 42)
+	l1, _ := w.leafFor(0)
+	l2, _ := u.leafFor(0)
+	if &l1[0] != &l2[0] {
+		t.Errorf("expected leafs before the insertion point to be shared")
+	}
+	if s := fmt.Sprint(u.ToSlice()); s != "[0 1 2 3 4 42 5 6 7 8 9]" {
+		t.Errorf("expected [0 1 2 3 4 42 5 6 7 8 9], have %s", s)
+	}
+	if s := fmt.Sprint(w.ToSlice()); s != "[0 1 2 3 4 5 6 7 8 9]" {
+		t.Errorf("expected original vector to be unchanged, have %s", s)
+	}
+	w = From([]int{1, 3, 3, 5})
+	w = SortedInsert(w, 3, less).Insert(0, 0)
+	if s := fmt.Sprint(w.ToSlice()); s != "[0 1 3 3 3 5]" {
+		t.Errorf("expected [0 1 3 3 3 5], have %s", s)
+	}
+}
+
+func TestVectorAppendAll(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	tracer().SetTraceLevel(tracing.LevelError)
+	defer teardown()
+	//
+	runs := func(lengths ...int) ([]Vector[int], []int) {
+		var vs []Vector[int]
+		var all []int
+		for _, l := range lengths {
+			run := make([]int, l)
+			for i := range run {
+				run[i] = len(all) + i
+			}
+			all = append(all, run...)
+			vs = append(vs, From(run))
+		}
+		return vs, all
+	}
+	for _, lengths := range [][]int{{}, {0, 0}, {5}, {8, 8, 8}, {3, 5, 1, 7}, {16, 3, 64, 0, 9}, {100, 200, 13, 300}} {
+		vs, all := runs(lengths...)
+		v := Immutable[int]().AppendAll(vs...)
+		if v.Len() != len(all) || fmt.Sprint(v.ToSlice()) != fmt.Sprint(all) {
+			t.Fatalf("runs %v: expected %d elements in order, have %v", lengths, len(all), v.ToSlice())
+		}
+		for i := range all {
+			if x := v.Get(i); x != i {
+				t.Fatalf("runs %v: expected element #%d to be %d, is %d", lengths, i, i, x)
+			}
+		}
+		// the result has to behave like a vector built by pushes
+		w := v.Push(-1).Push(-2).Pop()
+		if w.Len() != len(all)+1 || w.Last().WithDefault(0) != -1 {
+			t.Errorf("runs %v: expected -1 to be last element after push and pop, have %v", lengths, w.ToSlice())
+		}
+		for range all {
+			w = w.Pop()
+		}
+		if s := fmt.Sprint(w.ToSlice()); len(all) > 0 && s != "[0]" {
+			t.Errorf("runs %v: expected [0] after popping, have %s", lengths, s)
+		}
+	}
+	// full leafs of aligned runs are shared
+	vs, all := runs(16, 16)
+	v := From(all[:8]).AppendAll(vs[1])
+	leaf, _ := v.leafFor(8)
+	source, _ := vs[1].leafFor(0)
+	if &leaf[0] != &source[0] {
+		t.Errorf("expected leaf of appended vector to be shared")
+	}
+	if v.Set(8, 0); vs[1].Get(0) != 16 {
+		t.Errorf("expected source vector to be unchanged by Set")
+	}
+	// vectors of different degree
+	u := From(all, DegreeExponent(2)).AppendAll(From(all, DegreeExponent(5)), From(all[:3]))
+	expected := append(append(append([]int{}, all...), all...), all[:3]...)
+	if fmt.Sprint(u.ToSlice()) != fmt.Sprint(expected) {
+		t.Errorf("expected vectors of different degrees to be appended, have %v", u.ToSlice())
+	}
+}
+
+func TestVectorCheckedAccess(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "persistent.vector")
+	defer teardown()
+	//
+	v := From([]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, DegreeExponent(2))
+	for i := 0; i < v.Len(); i++ {
+		if x, err := v.GetOK(i); err != nil || x != i+1 || v.GetUnchecked(i) != x {
+			t.Errorf("expected element %d to be %d, is %d (err = %v)", i, i+1, x, err)
+		}
+	}
+	for _, i := range []int{-1, 10, 100} {
+		if _, err := v.GetOK(i); !errors.Is(err, ErrIndexOutOfRange) {
+			t.Errorf("expected GetOK(%d) to fail with index out of range, error is %v", i, err)
+		}
+		if w, err := v.SetOK(i, 0); !errors.Is(err, ErrIndexOutOfRange) || w.Len() != v.Len() {
+			t.Errorf("expected SetOK(%d) to fail and leave vector unchanged, error is %v", i, err)
+		}
+	}
+	w, err := v.SetOK(9, 99)
+	if err != nil || w.Get(9) != 99 || v.Get(9) != 10 {
+		t.Errorf("expected SetOK to set a copy, have %d and original %d (err = %v)", w.Get(9), v.Get(9), err)
+	}
+	w = Immutable[int]().Push(1)
+	if w, err = w.PopOK(); err != nil || w.Len() != 0 {
+		t.Errorf("expected to pop last element, length is %d (err = %v)", w.Len(), err)
+	}
+	if _, err = w.PopOK(); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Errorf("expected PopOK of empty vector to fail, error is %v", err)
+	}
+}
+
 // --- Print vector tree -----------------------------------------------------
 
 func printVec[T any](v Vector[T]) string {
@@ -28,7 +28,10 @@ Navigation functions:
    Parent()                     // find parent for all selected nodes
    AncestorWith(predicate)      // find ancestor with a given predicate
    DescendentsWith(predicate)   // find descendets with a given predicate
+   FirstMatch(predicate)        // find a single node, stopping the walk early
    TopDown(action)              // traverse all nodes top down (breadth first)
+   TopDownVisit(visitor)        // like TopDown, with depth and ancestors of nodes
+   TopDownDF(action)            // traverse all nodes depth first, results in document order
 
 Filter functions:
 
@@ -36,6 +39,19 @@ Filter functions:
    SetAttribute(key, value)     // set an attribute value for nodes
    Filter(userfunc)             // apply a user-provided filter function
 
+Comparing trees:
+
+   Zip(a, b, match)             // walk two trees in lockstep, reporting differences
+
+Instrumentation:
+
+   Instrument(observer)         // collect metrics per filter stage, call tracing hooks
+   Metrics()                    // retrieve metrics after the promise has resolved
+
+Execution:
+
+   RunSequential()              // walk synchronously, in reproducible order
+
 More operations will follow as I get experience from using the tree in
 more real life contexts.
 
@@ -57,3 +73,9 @@ import (
 func tracer() tracing.Trace {
 	return tracing.Select("tyse.frame.tree")
 }
+
+// tracingDebug is true if tracing is set to level Debug or finer. Hot code paths
+// check it before formatting trace messages, to avoid allocations.
+func tracingDebug() bool {
+	return tracer().GetTraceLevel() >= tracing.LevelDebug
+}
@@ -0,0 +1,57 @@
+package tree
+
+import "sync/atomic"
+
+// --- Subtree hashing ------------------------------------------------------
+
+// HashSubtree computes a Merkle-style hash for the subtree starting at node:
+// the hash of a node combines the hash of its payload, as computed by
+// hashPayload, with the hashes of all of its children, in order. Equal subtrees
+// will have equal hashes, enabling clients to skip the processing of unchanged
+// subtrees or to cheaply test trees for (probable) equality.
+//
+// Hashes are cached within the nodes and invalidated by modifications of
+// the tree structure (AddChild, SetChildAt, InsertChildAt, Isolate) and by
+// SwapPayload and UpdatePayload. As payloads may be changed without the tree
+// noticing, clients have to call InvalidateHash for a node after modifying its
+// payload by other means. Clients should
+// consistently use the same hashPayload function for a tree, as a cached
+// hash is returned without calling hashPayload.
+//
+// HashSubtree may be called concurrently, but not concurrently with
+// modifications of the subtree. Payloads are read with LoadPayload.
+func (node *Node[T]) HashSubtree(hashPayload func(T) uint64) uint64 {
+	if node == nil {
+		return 0
+	}
+	if h := atomic.LoadUint64(&node.hash); h != 0 {
+		return h
+	}
+	h := hashCombine(0x84222325cbf29ce4, hashPayload(node.LoadPayload()))
+	for _, ch := range node.Children(false) {
+		if ch == nil {
+			h = hashCombine(h, 0) // empty positions are significant
+			continue
+		}
+		h = hashCombine(h, ch.HashSubtree(hashPayload))
+	}
+	if h == 0 {
+		h = 1 // 0 denotes an invalid hash
+	}
+	atomic.StoreUint64(&node.hash, h)
+	return h
+}
+
+// InvalidateHash clears the cached subtree hash of node and of all of its
+// ancestors. Clients have to call it after modifying the payload of a node.
+func (node *Node[T]) InvalidateHash() {
+	for n := node; n != nil; n = n.parent {
+		atomic.StoreUint64(&n.hash, 0)
+	}
+}
+
+// hashCombine mixes a hash value x into a hash h.
+func hashCombine(h, x uint64) uint64 {
+	h ^= x + 0x9e3779b97f4a7c15 + (h << 6) + (h >> 2)
+	return h
+}
@@ -0,0 +1,246 @@
+package tree
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrAlreadyProcessing is thrown if a client tries to instrument a Walker or
+// attach user data to it, but the Walker already has filters, i.e. is already
+// processing nodes. It is a setup error (see ErrSetup).
+var ErrAlreadyProcessing error = setupError("walker is already processing; configure it before adding filters")
+
+// StageMetrics holds metrics for a single stage of a Walker's pipeline, i.e.
+// for an operation like DescendentsWith(…).
+type StageMetrics struct {
+	Name      string        // name of the Walker operation, e.g. "TopDown"
+	Processed uint64        // number of tasks performed, including re-scheduled nodes
+	Emitted   uint64        // number of result nodes handed to the next stage
+	Buffered  uint64        // number of nodes re-scheduled on the stage's buffer queue
+	Errors    uint64        // number of tasks which returned an error
+	HighWater int           // maximum number of nodes waiting for the stage
+	Busy      time.Duration // wall time spent in tasks, summed up over all workers
+	Elapsed   time.Duration // wall time from start of the first to end of the last task
+}
+
+// Metrics holds the metrics of an instrumented Walker. Stages are listed in
+// pipeline order.
+type Metrics struct {
+	Stages  []StageMetrics
+	Elapsed time.Duration // wall time from start of processing until all stages drained
+}
+
+// String returns a table of metrics per stage, suitable for debugging.
+func (m *Metrics) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pipeline of %d stages, elapsed %v:\n", len(m.Stages), m.Elapsed)
+	b.WriteString("# |       Stage      | Processed | Emitted | Buffered | Errors | High | Busy / Elapsed\n")
+	for i, s := range m.Stages {
+		fmt.Fprintf(&b, "%d | %16s | %9d | %7d | %8d | %6d | %4d | %v / %v\n", i, s.Name,
+			s.Processed, s.Emitted, s.Buffered, s.Errors, s.HighWater, s.Busy, s.Elapsed)
+	}
+	return b.String()
+}
+
+// Observer holds hooks to be called by an instrumented Walker. Both hooks are
+// optional.
+//
+// StartTask is called whenever a worker of stage number stage is about to perform
+// a task for the node with the given serial. The function returned by StartTask,
+// if non-nil, is called as soon as the task has finished. Hooks are called
+// concurrently from several goroutines.
+//
+// Finished is called once, as soon as the pipeline has drained, with the final
+// metrics of the pipeline. The Promise of the Walker will not resolve before
+// Finished returns.
+//
+// The hooks allow integration with tracing frameworks like OpenTelemetry:
+//
+//     obs := &tree.Observer{
+//         StartTask: func(stage int, name string, serial uint32) func(error) {
+//             _, span := otelTracer.Start(ctx, name)
+//             return func(err error) {
+//                 if err != nil {
+//                     span.RecordError(err)
+//                 }
+//                 span.End()
+//             }
+//         },
+//     }
+//     w := tree.NewWalker(root).Instrument(obs)
+type Observer struct {
+	StartTask func(stage int, name string, serial uint32) func(err error)
+	Finished  func(Metrics)
+}
+
+// Instrument switches on collecting metrics for w. Metrics may be retrieved by
+// calling Metrics() after the Promise has resolved. obs may be nil, in which case
+// metrics are collected without calling any hooks.
+//
+// Instrument has to be called before any filter is added, i.e. directly after
+// NewWalker(…). Otherwise, ErrAlreadyProcessing is reported as an error.
+// Walkers which have not been instrumented do not suffer any overhead.
+//
+// If w is nil, Instrument will return nil.
+func (w *Walker[S, T]) Instrument(obs *Observer) *Walker[S, T] {
+	if w == nil {
+		return nil
+	}
+	if !w.pipe.empty() {
+		return w.setupFailed(ErrAlreadyProcessing)
+	}
+	w.pipe.state.mx.Lock()
+	w.pipe.state.instr = &instrumentation{observer: obs}
+	w.pipe.state.mx.Unlock()
+	return w
+}
+
+// Metrics returns the metrics collected for the pipeline of an instrumented
+// Walker, or nil if w has not been instrumented. Metrics are final after the
+// Promise of w has resolved. Calling Metrics earlier is legal and returns a
+// snapshot of the metrics collected so far.
+func (w *Walker[S, T]) Metrics() *Metrics {
+	if w == nil {
+		return nil
+	}
+	w.pipe.state.mx.RLock()
+	instr := w.pipe.state.instr
+	w.pipe.state.mx.RUnlock()
+	if instr == nil {
+		return nil
+	}
+	return instr.metrics()
+}
+
+// --- Collecting metrics -----------------------------------------------
+
+// instrumentation holds the metrics of a pipeline. A nil instrumentation
+// collects nothing.
+type instrumentation struct {
+	mx       sync.Mutex
+	observer *Observer
+	stages   []*stageStats
+	started  time.Time
+	finished time.Time
+}
+
+// addStage creates the statistics for a new stage of the pipeline.
+func (instr *instrumentation) addStage(name string) *stageStats {
+	instr.mx.Lock()
+	defer instr.mx.Unlock()
+	s := &stageStats{index: len(instr.stages), name: name, observer: instr.observer}
+	instr.stages = append(instr.stages, s)
+	return s
+}
+
+func (instr *instrumentation) start() {
+	if instr == nil {
+		return
+	}
+	instr.mx.Lock()
+	instr.started = time.Now()
+	instr.mx.Unlock()
+}
+
+// finish is called as soon as all work packages of a pipeline are done.
+func (instr *instrumentation) finish() {
+	if instr == nil {
+		return
+	}
+	instr.mx.Lock()
+	instr.finished = time.Now()
+	instr.mx.Unlock()
+	if instr.observer != nil && instr.observer.Finished != nil {
+		instr.observer.Finished(*instr.metrics())
+	}
+}
+
+func (instr *instrumentation) metrics() *Metrics {
+	instr.mx.Lock()
+	defer instr.mx.Unlock()
+	m := &Metrics{Stages: make([]StageMetrics, len(instr.stages))}
+	if !instr.finished.IsZero() {
+		m.Elapsed = instr.finished.Sub(instr.started)
+	} else if !instr.started.IsZero() {
+		m.Elapsed = time.Since(instr.started)
+	}
+	for i, s := range instr.stages {
+		m.Stages[i] = s.metrics()
+	}
+	return m
+}
+
+// stageStats collects the metrics of a single pipeline stage. Fields are
+// updated concurrently by the workers of the stage and are accessed atomically.
+type stageStats struct {
+	processed uint64 // 64-bit fields first, for alignment of atomic access
+	emitted   uint64
+	buffered  uint64
+	errors    uint64
+	highWater int64
+	busy      int64 // nanoseconds
+	first     int64 // start of first task, in nanoseconds since the epoch
+	last      int64 // end of last task, in nanoseconds since the epoch
+	index     int
+	name      string
+	observer  *Observer
+}
+
+// taskTiming is handed from startTask to finishTask.
+type taskTiming struct {
+	start time.Time
+	done  func(error)
+}
+
+// startTask is called by a worker before it performs a task. queued is the number
+// of nodes currently waiting for the stage.
+func (s *stageStats) startTask(serial uint32, queued int) taskTiming {
+	t := taskTiming{start: time.Now()}
+	atomic.CompareAndSwapInt64(&s.first, 0, t.start.UnixNano())
+	for hw := atomic.LoadInt64(&s.highWater); int64(queued) > hw; hw = atomic.LoadInt64(&s.highWater) {
+		if atomic.CompareAndSwapInt64(&s.highWater, hw, int64(queued)) {
+			break
+		}
+	}
+	if s.observer != nil && s.observer.StartTask != nil {
+		t.done = s.observer.StartTask(s.index, s.name, serial)
+	}
+	return t
+}
+
+// finishTask is called by a worker after it performed a task.
+func (s *stageStats) finishTask(t taskTiming, err error) {
+	end := time.Now()
+	atomic.AddUint64(&s.processed, 1)
+	if err != nil {
+		atomic.AddUint64(&s.errors, 1)
+	}
+	atomic.AddInt64(&s.busy, int64(end.Sub(t.start)))
+	for last := atomic.LoadInt64(&s.last); end.UnixNano() > last; last = atomic.LoadInt64(&s.last) {
+		if atomic.CompareAndSwapInt64(&s.last, last, end.UnixNano()) {
+			break
+		}
+	}
+	if t.done != nil {
+		t.done(err)
+	}
+}
+
+func (s *stageStats) metrics() StageMetrics {
+	m := StageMetrics{
+		Name:      s.name,
+		Processed: atomic.LoadUint64(&s.processed),
+		Emitted:   atomic.LoadUint64(&s.emitted),
+		Buffered:  atomic.LoadUint64(&s.buffered),
+		Errors:    atomic.LoadUint64(&s.errors),
+		HighWater: int(atomic.LoadInt64(&s.highWater)),
+		Busy:      time.Duration(atomic.LoadInt64(&s.busy)),
+	}
+	if first, last := atomic.LoadInt64(&s.first), atomic.LoadInt64(&s.last); first > 0 && last > first {
+		m.Elapsed = time.Duration(last - first)
+	}
+	return m
+}
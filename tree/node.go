@@ -13,22 +13,30 @@ Copyright © 2017–2022 Norbert Pillmayer <norbert@pillmayer.com>
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"unsafe"
 )
 
 /*
 We manage a tree of mutable nodes. Each nodes carries a payload of type parameter T.
 Nodes maintain a slice of children.
 
+Documents are dominated by leaves, e.g. text nodes, which will never have children.
+The slice of children is therefore allocated with the first child of a node, keeping
+leaf nodes small (see kids).
+
 In the future, we may move to immutable nodes to reduce lock contention, but first let's get
 some experience with this one.
 */
 
 // Node is the base type our tree is built of.
 type Node[T comparable] struct {
-	parent   *Node[T]         // parent node of this node
-	children childrenSlice[T] // mutex-protected slice of children nodes
-	Payload  T                // nodes may carry a payload of arbitrary type
-	Rank     uint32           // rank is used for preserving sequence
+	hash     uint64         // cached subtree hash, 0 if invalid; first for 64-bit alignment
+	parent   *Node[T]       // parent node of this node
+	children unsafe.Pointer // *childrenSlice[T], allocated with the first child
+	Payload  T              // nodes may carry a payload of arbitrary type
+	Rank     uint32         // rank is used for preserving sequence
+	policy   uint32         // ChildSlotPolicy for the children, accessed atomically
 }
 
 // NewNode creates a new tree node with a given payload.
@@ -37,17 +45,90 @@ func NewNode[T comparable](payload T) *Node[T] {
 }
 
 func (node *Node[T]) String() string {
-	return fmt.Sprintf("(Node #ch=%d %v)", node.ChildCount(), node.Payload)
+	return fmt.Sprintf("(Node #ch=%d %v)", node.ChildCount(), node.LoadPayload())
+}
+
+// --- Synchronized payload access --------------------------------------
+
+// Accessing field Payload directly is not synchronized. This is fine as long as
+// a node's payload is written by a single goroutine only, e.g. while building a
+// tree. Filter stages of pipelines, however, run concurrently and may process
+// the same node at the same time. They should use the methods below to read and
+// modify payloads, which are safe to call concurrently with each other (but not
+// with direct writes to Payload).
+//
+// Payload access is synchronized by a fixed set of locks shared by all nodes,
+// instead of a lock per node, which would enlarge every leaf of a tree.
+
+// payloadLocks synchronize payload access, see payloadLock.
+var payloadLocks [64]sync.Mutex
+
+// payloadLock returns the lock synchronizing the payload of node. Nodes are
+// assigned to locks by their address.
+func (node *Node[T]) payloadLock() *sync.Mutex {
+	return &payloadLocks[(uintptr(unsafe.Pointer(node))>>4)%uintptr(len(payloadLocks))]
+}
+
+// LoadPayload returns the payload of node (concurrency-safe).
+func (node *Node[T]) LoadPayload() T {
+	mx := node.payloadLock()
+	mx.Lock()
+	defer mx.Unlock()
+	return node.Payload
+}
+
+// SwapPayload sets the payload of node to new, if the current payload equals old.
+// It returns true if the payload has been replaced.
+// If so, the cached subtree hash of node is invalidated.
+//
+// This operation is concurrency-safe.
+func (node *Node[T]) SwapPayload(old, new T) bool {
+	mx := node.payloadLock()
+	mx.Lock()
+	swapped := node.Payload == old
+	if swapped {
+		node.Payload = new
+	}
+	mx.Unlock()
+	if swapped {
+		node.InvalidateHash()
+	}
+	return swapped
+}
+
+// UpdatePayload atomically replaces the payload of node by the result of f,
+// applied to the current payload, and returns the new payload. f is called
+// while holding a lock on the payload, which may be shared with other nodes,
+// and must not call LoadPayload, SwapPayload or UpdatePayload for any node.
+// The cached subtree hash of node is invalidated.
+//
+// This operation is concurrency-safe.
+func (node *Node[T]) UpdatePayload(f func(T) T) T {
+	mx := node.payloadLock()
+	mx.Lock()
+	p := f(node.Payload)
+	node.Payload = p
+	mx.Unlock()
+	node.InvalidateHash()
+	return p
 }
 
 // AddChild inserts a new child node into the tree.
 // The newly inserted node is connected to this node as its parent.
 // It returns the parent node to allow for chaining.
 //
+// Inserting node itself or one of its ancestors as a child would create a
+// cycle, making traversals of the tree hang. AddChild, SetChildAt and
+// InsertChildAt refuse to do this and leave the tree unchanged. Clients not
+// sure about the origin of ch should call CheckChild beforehand, which
+// returns ErrCycle for these cases.
+//
 // This operation is concurrency-safe.
 func (node *Node[T]) AddChild(ch *Node[T]) *Node[T] {
-	if ch != nil {
-		node.children.addChild(ch, node)
+	if ch != nil && !node.refusesChild(ch) {
+		ch.adoptPolicyOf(node)
+		node.ensureKids().addChild(ch, node)
+		node.InvalidateHash()
 	}
 	return node
 }
@@ -55,13 +136,17 @@ func (node *Node[T]) AddChild(ch *Node[T]) *Node[T] {
 // SetChildAt inserts a new child node into the tree.
 // The newly inserted node is connected to this node as its parent.
 // The child is set at a given position in relation to other children,
-// replacing the child at position i if it exists.
+// replacing the child at position i if it exists. If i is beyond the last
+// child, the gap is filled with empty slots, or, if node's children are
+// compact, the child is appended (see ChildSlotPolicy).
 // It returns the parent node to allow for chaining.
 //
 // This operation is concurrency-safe.
 func (node *Node[T]) SetChildAt(i int, ch *Node[T]) *Node[T] {
-	if ch != nil {
-		node.children.setChild(i, ch, node)
+	if ch != nil && !node.refusesChild(ch) {
+		ch.adoptPolicyOf(node)
+		node.ensureKids().setChild(i, ch, node)
+		node.InvalidateHash()
 	}
 	return node
 }
@@ -69,54 +154,91 @@ func (node *Node[T]) SetChildAt(i int, ch *Node[T]) *Node[T] {
 // InsertChildAt inserts a new child node into the tree.
 // The newly inserted node is connected to this node as its parent.
 // The child is set at a given position in relation to other children,
-// shifting children at later positions.
+// shifting children at later positions. Positions beyond the last child are
+// handled as with SetChildAt.
 // It returns the parent node to allow for chaining.
 //
 // This operation is concurrency-safe.
 func (node *Node[T]) InsertChildAt(i int, ch *Node[T]) *Node[T] {
-	if ch != nil {
-		node.children.insertChildAt(i, ch, node)
+	if ch != nil && !node.refusesChild(ch) {
+		ch.adoptPolicyOf(node)
+		node.ensureKids().insertChildAt(i, ch, node)
+		node.InvalidateHash()
 	}
 	return node
 }
 
+// CheckChild returns ErrCycle if inserting ch as a child of node would create a
+// cycle, i.e. if ch is node itself or one of its ancestors, and nil otherwise.
+// Checking is cheap, as it is linear in the depth of node.
+func (node *Node[T]) CheckChild(ch *Node[T]) error {
+	for anc := node; anc != nil; anc = anc.parent {
+		if anc == ch {
+			return ErrCycle
+		}
+	}
+	return nil
+}
+
+// refusesChild is a predicate wether inserting ch as a child of node would
+// create a cycle (see CheckChild). Refusals are traced as errors.
+func (node *Node[T]) refusesChild(ch *Node[T]) bool {
+	if err := node.CheckChild(ch); err != nil {
+		tracer().Errorf("refusing to insert %v as a child of %v: %v", ch, node, err)
+		return true
+	}
+	return false
+}
+
 // Parent returns the parent node or nil (for the root of the tree).
 func (node *Node[T]) Parent() *Node[T] {
 	return node.parent
 }
 
-// Isolate removes a node from its parent.
+// Isolate removes a node from its parent, leaving an empty slot in the parent's
+// list of children, or, if the parent's children are compact, shifting later
+// children down by one position (see ChildSlotPolicy).
 // Isolate returns the isolated node.
 func (node *Node[T]) Isolate() *Node[T] {
 	if node != nil && node.parent != nil {
-		node.parent.children.remove(node)
+		parent := node.parent
+		parent.kids().remove(node, parent)
+		parent.InvalidateHash()
 	}
 	return node
 }
 
-// ChildCount returns the number of children-nodes for a node
+// ChildCount returns the number of child slots of a node, including empty ones
 // (concurrency-safe).
 func (node *Node[T]) ChildCount() int {
-	return node.children.length()
+	return node.kids().length()
 }
 
 // Child is a concurrency-safe way to get a children-node of a node.
 func (node *Node[T]) Child(n int) (*Node[T], bool) {
-	if n < 0 || node.children.length() <= n {
-		return nil, false
-	}
-	ch := node.children.child(n)
+	ch := node.kids().child(n)
 	return ch, ch != nil
 }
 
+// ChildrenVersion returns a counter of modifications of the list of children
+// of node. It changes whenever a child is added, replaced or removed, thus
+// clients may use it to detect if information derived from the children is
+// stale (concurrency-safe).
+func (node *Node[T]) ChildrenVersion() uint64 {
+	return node.kids().modifications()
+}
+
 // Children returns a slice with all children of a node.
-// If omitNilChildren is set, empty children aren't included in the slice
+// If omitNilChildren is set, empty children aren't included in the slice.
+// Note that for sparse child lists, indices into the compacted slice are not
+// positions of children in the sense of Child, SetChildAt or IndexOfChild.
+// Use ChildSlots to get the non-empty children together with their positions.
 func (node *Node[T]) Children(omitNilChildren bool) []*Node[T] {
-	return node.children.asSlice(omitNilChildren)
+	return node.kids().asSlice(omitNilChildren)
 }
 
-// IndexOfChild returns the index of a child within the list of children
-// of its parent. ch may not be nil.
+// IndexOfChild returns the position of a child within the list of children
+// of its parent, including empty slots. ch may not be nil.
 func (node *Node[T]) IndexOfChild(ch *Node[T]) int {
 	if node.ChildCount() > 0 {
 		children := node.Children(false)
@@ -129,14 +251,193 @@ func (node *Node[T]) IndexOfChild(ch *Node[T]) int {
 	return -1
 }
 
+// --- Child slots ------------------------------------------------------
+
+// ChildSlotPolicy determines how the positions of children of a node are
+// maintained.
+//
+// With SparseChildren (the default), positions of children are stable:
+// SetChildAt and InsertChildAt beyond the last child leave empty (nil) slots,
+// and Isolate leaves an empty slot where the node has been. Clients may thus
+// address children by position, e.g. as columns of a table row, but have to
+// take care of empty slots.
+//
+// With CompactChildren, lists of children never contain empty slots. Children
+// set or inserted beyond the last child are appended, and Isolate shifts later
+// children down by one position. Positions of children are always the indices
+// of Children(true).
+//
+// The policy is selected per tree: setting it for a node (usually the root)
+// applies it to the whole subtree, and nodes inserted into a tree adopt the
+// policy of their new parent.
+type ChildSlotPolicy uint8
+
+// Policies for lists of children, see ChildSlotPolicy.
+const (
+	SparseChildren  ChildSlotPolicy = iota // positions are stable, empty slots possible
+	CompactChildren                        // no empty slots, positions may shift
+)
+
+// ChildSlot is a non-empty position within the list of children of a node.
+type ChildSlot[T comparable] struct {
+	Index int      // position of the child, as used for Child, SetChildAt and IndexOfChild
+	Node  *Node[T] // the child node
+}
+
+// SetChildSlotPolicy sets the policy for lists of children for node and all of
+// its descendents. Switching to CompactChildren removes empty slots.
+// It returns node to allow for chaining.
+//
+// This operation is concurrency-safe, but should not be called concurrently
+// with modifications of the subtree.
+func (node *Node[T]) SetChildSlotPolicy(policy ChildSlotPolicy) *Node[T] {
+	if node != nil {
+		node.setChildSlotPolicy(policy)
+		node.InvalidateHash()
+	}
+	return node
+}
+
+// ChildSlotPolicy returns the policy for the list of children of node.
+func (node *Node[T]) ChildSlotPolicy() ChildSlotPolicy {
+	return ChildSlotPolicy(atomic.LoadUint32(&node.policy))
+}
+
+func (node *Node[T]) setChildSlotPolicy(policy ChildSlotPolicy) {
+	for _, ch := range node.withPolicy(policy) {
+		ch.setChildSlotPolicy(policy)
+	}
+}
+
+// withPolicy sets the policy for the children of node, compacting the slice of
+// children if necessary, and returns the children.
+func (node *Node[T]) withPolicy(policy ChildSlotPolicy) []*Node[T] {
+	chs := node.kids()
+	if chs == nil {
+		atomic.StoreUint32(&node.policy, uint32(policy))
+		return nil
+	}
+	chs.Lock()
+	defer chs.Unlock()
+	atomic.StoreUint32(&node.policy, uint32(policy))
+	if policy == CompactChildren {
+		chs.slice = compacted(chs.slice)
+		chs.version++
+	}
+	return append([]*Node[T](nil), chs.slice...)
+}
+
+// adoptPolicyOf applies the policy of parent to node, if it differs.
+func (node *Node[T]) adoptPolicyOf(parent *Node[T]) {
+	if policy := parent.ChildSlotPolicy(); policy != node.ChildSlotPolicy() {
+		node.setChildSlotPolicy(policy)
+	}
+}
+
+// ChildSlots returns the non-empty slots of the list of children of node, in
+// order of position.
+func (node *Node[T]) ChildSlots() []ChildSlot[T] {
+	return node.kids().slots()
+}
+
 // --- Slices of concurrency-safe sets of children ----------------------
 
+// childrenSlice is the list of children of a node. It is allocated with the
+// first child of a node and is nil for nodes which never had children. All of
+// the query methods accept a nil list, behaving like an empty list.
+//
+// Most inner nodes of a document have just a few children. The first of them
+// are stored in an array allocated together with the list, saving the
+// allocations of growing the slice one child at a time.
 type childrenSlice[T comparable] struct {
 	sync.RWMutex
-	slice []*Node[T]
+	slice   []*Node[T]
+	inline  [inlineChildren]*Node[T] // initial backing array of slice
+	version uint64                   // incremented with every modification of slice
+}
+
+// Number of children stored without allocating a separate backing array.
+const inlineChildren = 4
+
+// kids returns the list of children of node, which is nil if node never had
+// any children (concurrency-safe).
+func (node *Node[T]) kids() *childrenSlice[T] {
+	return (*childrenSlice[T])(atomic.LoadPointer(&node.children))
+}
+
+// ensureKids returns the list of children of node, allocating it if node
+// never had any children (concurrency-safe).
+func (node *Node[T]) ensureKids() *childrenSlice[T] {
+	if chs := node.kids(); chs != nil {
+		return chs
+	}
+	chs := &childrenSlice[T]{}
+	chs.slice = chs.inline[:0]
+	if atomic.CompareAndSwapPointer(&node.children, nil, unsafe.Pointer(chs)) {
+		return chs
+	}
+	return node.kids() // another goroutine has been faster
+}
+
+// compacted removes nil entries from slice, in place.
+func compacted[T comparable](slice []*Node[T]) []*Node[T] {
+	n := 0
+	for _, ch := range slice {
+		if ch != nil {
+			slice[n] = ch
+			n++
+		}
+	}
+	for i := n; i < len(slice); i++ {
+		slice[i] = nil // do not retain removed nodes
+	}
+	return slice[:n]
+}
+
+func (chs *childrenSlice[T]) slots() []ChildSlot[T] {
+	if chs == nil {
+		return nil
+	}
+	chs.RLock()
+	defer chs.RUnlock()
+	slots := make([]ChildSlot[T], 0, len(chs.slice))
+	for i, ch := range chs.slice {
+		if ch != nil {
+			slots = append(slots, ChildSlot[T]{Index: i, Node: ch})
+		}
+	}
+	return slots
+}
+
+// occupied returns the number of non-empty slots.
+func (chs *childrenSlice[T]) occupied() int {
+	if chs == nil {
+		return 0
+	}
+	chs.RLock()
+	defer chs.RUnlock()
+	n := 0
+	for _, ch := range chs.slice {
+		if ch != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (chs *childrenSlice[T]) modifications() uint64 {
+	if chs == nil {
+		return 0
+	}
+	chs.RLock()
+	defer chs.RUnlock()
+	return chs.version
 }
 
 func (chs *childrenSlice[T]) length() int {
+	if chs == nil {
+		return 0
+	}
 	chs.RLock()
 	defer chs.RUnlock()
 	return len(chs.slice)
@@ -149,6 +450,7 @@ func (chs *childrenSlice[T]) addChild(child *Node[T], parent *Node[T]) {
 	chs.Lock()
 	defer chs.Unlock()
 	chs.slice = append(chs.slice, child)
+	chs.version++
 	child.parent = parent
 }
 
@@ -159,10 +461,14 @@ func (chs *childrenSlice[T]) setChild(i int, child *Node[T], parent *Node[T]) {
 	chs.Lock()
 	defer chs.Unlock()
 	if len(chs.slice) <= i {
+		if parent.ChildSlotPolicy() == CompactChildren {
+			i = len(chs.slice)
+		}
 		l := len(chs.slice)
 		chs.slice = append(chs.slice, make([]*Node[T], i-l+1)...)
 	}
 	chs.slice[i] = child
+	chs.version++
 	child.parent = parent
 }
 
@@ -173,6 +479,9 @@ func (chs *childrenSlice[T]) insertChildAt(i int, child *Node[T], parent *Node[T
 	chs.Lock()
 	defer chs.Unlock()
 	if len(chs.slice) <= i {
+		if parent.ChildSlotPolicy() == CompactChildren {
+			i = len(chs.slice)
+		}
 		l := len(chs.slice)
 		chs.slice = append(chs.slice, make([]*Node[T], i-l+1)...)
 	} else {
@@ -180,15 +489,26 @@ func (chs *childrenSlice[T]) insertChildAt(i int, child *Node[T], parent *Node[T
 		copy(chs.slice[i+1:], chs.slice[i:]) // shift i+1..n
 	}
 	chs.slice[i] = child
+	chs.version++
 	child.parent = parent
 }
 
-func (chs *childrenSlice[T]) remove(node *Node[T]) {
+func (chs *childrenSlice[T]) remove(node *Node[T], parent *Node[T]) {
+	if chs == nil {
+		return
+	}
 	chs.Lock()
 	defer chs.Unlock()
 	for i, ch := range chs.slice {
 		if ch == node {
-			chs.slice[i] = nil
+			if parent.ChildSlotPolicy() == CompactChildren {
+				copy(chs.slice[i:], chs.slice[i+1:])
+				chs.slice[len(chs.slice)-1] = nil
+				chs.slice = chs.slice[:len(chs.slice)-1]
+			} else {
+				chs.slice[i] = nil
+			}
+			chs.version++
 			node.parent = nil
 			break
 		}
@@ -196,18 +516,24 @@ func (chs *childrenSlice[T]) remove(node *Node[T]) {
 }
 
 func (chs *childrenSlice[T]) child(n int) *Node[T] {
-	if chs.length() == 0 || n < 0 || n >= chs.length() {
+	if chs == nil {
 		return nil
 	}
 	chs.RLock()
 	defer chs.RUnlock()
+	if n < 0 || n >= len(chs.slice) {
+		return nil
+	}
 	return chs.slice[n]
 }
 
 func (chs *childrenSlice[T]) asSlice(omitNilCh bool) []*Node[T] {
+	if chs == nil {
+		return nil
+	}
 	chs.RLock()
 	defer chs.RUnlock()
-	children := make([]*Node[T], 0, chs.length())
+	children := make([]*Node[T], 0, len(chs.slice))
 	for _, ch := range chs.slice {
 		if ch != nil || !omitNilCh {
 			children = append(children, ch)
@@ -15,6 +15,7 @@ import (
 	"runtime"
 	"sort"
 	"sync"
+	"sync/atomic"
 )
 
 // Tree operations will be carried out by concurrent worker goroutines.
@@ -43,8 +44,12 @@ const (
 	maxWorkerCount int = 10
 )
 
-// Maxmimum length of internal buffer channel for a filter.
-const maxBufferLength int = 128
+// Default capacities of the channel connecting a filter to the next stage and
+// of the buffer queue of a filter, see Walker.BufferSizes.
+const (
+	defaultResultsLength int = 3
+	defaultBufferLength  int = 256
+)
 
 // Workers will be tasked a series of workerTasks.
 //
@@ -71,16 +76,20 @@ type stage interface {
 // filters will perform concurrently.
 type filter[S, T comparable] struct {
 	results    chan<- nodePackage[T] // results of this filter (pipeline stage)
-	queue      chan nodePackage[S]   // helper queue if necessary
+	reslen     int                   // capacity of the results channel
+	queue      *bufferQueue[S]       // helper queue if necessary
 	task       workerTask[S, T]      // the task this filter performs
 	filterdata interface{}           // user-provided information needed to perform task
 	env        *filterenv[S]         // connection to outside world
+	name       string                // name of the Walker operation
+	stats      *stageStats           // metrics of this stage, if instrumented
+	next       func(nodePackage[T])  // successor stage of a sequential walk (see RunSequential)
 }
 
 func (f *filter[S, T]) Shutdown() {
 	close(f.results)
 	if f.queue != nil {
-		close(f.queue)
+		f.queue.close()
 	}
 }
 
@@ -90,6 +99,14 @@ func (f *filter[S, T]) Shutdown() {
 // 'nodelocal' lets clients store arbitrary user data together with the node.
 // It will be set to 'nil' as soon as the nodepackage is transferred to the next stage,
 // i.e., this type is local to a pipeline-stage/filter.
+//
+// Node packages are small values, copied into channels and into the ring buffers
+// of buffer queues, thus they are never allocated on the heap and are not pooled.
+// Heap allocations for node-local data are pooled where they occur for every
+// node (see parentAndPosition).
+//
+// A package without a node is a marker for a serial dropped by a stage of an
+// ordered walk (see pushDropped).
 type nodePackage[T comparable] struct {
 	node      *Node[T]    // tree node
 	nodelocal interface{} // arbitrary user data
@@ -103,6 +120,15 @@ type filterenv[T comparable] struct {
 	input        <-chan nodePackage[T] // work to do for this filter, connected to predecessor
 	errors       chan<- error          // where errors are reported to
 	queuecounter *sync.WaitGroup       // counter for overall work load
+	cancelled    *int32                // set if remaining work is to be skipped, used atomically
+	lasterror    *error                // where errors of a sequential walk are reported to
+	ordered      bool                  // input carries serials in document order (see TopDownDF)
+}
+
+// isCancelled is true if the pipeline has been cancelled, e.g. by FirstMatch.
+// Workers drop their remaining work packages without performing their task.
+func (env *filterenv[T]) isCancelled() bool {
+	return atomic.LoadInt32(env.cancelled) != 0
 }
 
 // userdata is a container managed by the pipeline mechanism. It will contain
@@ -119,16 +145,14 @@ type userdata struct {
 
 // newFilter creates a new pipeline stage, i.e. a filter fed from an input
 // channel (workload). the filter is expected to put processed nodes into an
-// output channel (results).
+// output channel (results). If buflen > 0, the filter gets a buffer queue with
+// a capacity of buflen.
 //
 // Errors are reported to an error channel.
 func newFilter[S, T comparable](task workerTask[S, T], filterdata interface{}, buflen int) *filter[S, T] {
-	f := &filter[S, T]{}
+	f := &filter[S, T]{reslen: defaultResultsLength}
 	if buflen > 0 {
-		if buflen > maxBufferLength {
-			buflen = maxBufferLength
-		}
-		f.queue = make(chan nodePackage[S], buflen)
+		f.queue = newBufferQueue[S](buflen)
 	}
 	f.task = task
 	f.filterdata = filterdata
@@ -139,14 +163,17 @@ func newFilter[S, T comparable](task workerTask[S, T], filterdata interface{}, b
 // Sets an environment for a filter an gets the results-channel in return.
 func (f *filter[S, T]) start(env *filterenv[S]) chan nodePackage[T] {
 	f.env = env
-	res := make(chan nodePackage[T], 3) // output channel has to be in place before workers start
-	f.results = res                     // be careful to set write-only for the filter
+	res := make(chan nodePackage[T], f.reslen) // output channel has to be in place before workers start
+	f.results = res                            // be careful to set write-only for the filter
 	n := runtime.NumCPU()
 	if n > maxWorkerCount {
 		n = maxWorkerCount
 	} else if n < minWorkerCount {
 		n = minWorkerCount
 	}
+	if f.queue != nil {
+		f.queue.workers = n // before workers start pushing
+	}
 	for i := 0; i < n; i++ {
 		wno := i + 1
 		if f.queue == nil {
@@ -166,19 +193,45 @@ func filterWorker[S, T comparable](f *filter[S, T], wno int) {
 	//  defer func() {
 	//	log.Printf("finished worker #%d\n", wno) // for debugging
 	//}()
+	var emitted bool // has the current workpackage yielded a result?
 	push := func(node *Node[T], serial uint32) { // worker will use this to hand result to next stage
+		emitted = true
 		f.pushResult(node, serial)
 	}
 	for inNode := range f.env.input { // get workpackages until drained
+		if f.env.isCancelled() {
+			f.env.queuecounter.Done() // drop workpackage
+			continue
+		}
 		node := inNode.node
 		serial := inNode.serial
+		if node == nil { // marker for a dropped serial
+			if f.env.ordered {
+				f.pushDropped(serial)
+			}
+			f.env.queuecounter.Done()
+			continue
+		}
 		udata := userdata{f.filterdata, nil, serial}
-		err := f.task(node, false, udata, push, nil) // perform task on workpackage
+		emitted = false
+		var err error
+		if f.stats == nil {
+			err = f.task(node, false, udata, push, nil) // perform task on workpackage
+		} else {
+			t := f.stats.startTask(serial, len(f.env.input))
+			err = f.task(node, false, udata, push, nil)
+			f.stats.finishTask(t, err)
+		}
 		if err != nil {
 			f.env.errors <- err // signal error to caller
 		}
-		qid := fmt.Sprintf("[#%p]", f.env.queuecounter)
-		tracer().Debugf("filter stage %d finished -1 task for %v | %d in %s", wno, node, serial, qid)
+		if !emitted && f.env.ordered {
+			f.pushDropped(serial)
+		}
+		if tracingDebug() {
+			qid := fmt.Sprintf("[#%p]", f.env.queuecounter)
+			tracer().Debugf("filter stage %d finished -1 task for %v | %d in %s", wno, node, serial, qid)
+		}
 		f.env.queuecounter.Done() // worker has finished a workpackage
 	}
 }
@@ -187,60 +240,209 @@ func filterWorker[S, T comparable](f *filter[S, T], wno int) {
 // queue, the 'buffer queue'. This buffer queue may be used to re-schedule nodes
 // until they are completely processed.
 func filterWorkerWithQueue[S, T comparable](f *filter[S, T], wno int) {
+	var emitted bool // has the current workpackage yielded a result or further work?
 	push := func(node *Node[T], serial uint32) { // worker will use this to hand result to next stage
+		emitted = true
 		f.pushResult(node, serial)
 	}
 	pushBuf := func(sup *Node[S], udata interface{}, serial uint32) { // worker will use this to queue work internally
+		emitted = true
 		f.pushBuffer(sup, udata, serial)
 	}
 	var buffered bool
 	var node *Node[S]
 	var udata userdata
 	for {
-		select { // get upstream workpackages and buffered workpackages until drained
-		case inNode := <-f.env.input:
-			node = inNode.node
-			udata.serial = inNode.serial
-			udata.nodelocal = nil
-			udata.filterlocal = f.filterdata
-			buffered = false
-		case supdata := <-f.queue:
+		if supdata, ok := f.queue.pop(); ok { // buffered workpackages go first
 			node = supdata.node
 			udata.filterlocal = f.filterdata
 			udata.nodelocal = supdata.nodelocal
 			udata.serial = supdata.serial
 			buffered = true
+		} else {
+			select { // wait for upstream workpackages or buffered workpackages until drained
+			case inNode, ok := <-f.env.input:
+				if !ok {
+					return // no more work to do
+				}
+				node = inNode.node
+				udata.serial = inNode.serial
+				udata.nodelocal = nil
+				udata.filterlocal = f.filterdata
+				buffered = false
+			case _, ok := <-f.queue.signal:
+				if !ok {
+					return // no more work to do
+				}
+				continue // another worker may have been faster
+			}
+		}
+		if f.env.isCancelled() {
+			f.env.queuecounter.Done() // drop workpackage
+			continue
 		}
-		if node != nil {
-			err := f.task(node, buffered, udata, push, pushBuf) // perform filter task
-			if err != nil {
-				f.env.errors <- err // signal error to caller
+		if node == nil { // marker for a dropped serial
+			if f.env.ordered {
+				f.pushDropped(udata.serial)
 			}
+			f.env.queuecounter.Done()
+			continue
+		}
+		emitted = false
+		var err error
+		if f.stats == nil {
+			err = f.task(node, buffered, udata, push, pushBuf) // perform filter task
+		} else {
+			t := f.stats.startTask(udata.serial, len(f.env.input)+f.queue.length())
+			err = f.task(node, buffered, udata, push, pushBuf)
+			f.stats.finishTask(t, err)
+		}
+		if err != nil {
+			f.env.errors <- err // signal error to caller
+		}
+		if !emitted && f.env.ordered {
+			f.pushDropped(udata.serial)
+		}
+		if tracingDebug() {
 			qid := fmt.Sprintf("[#%p]", f.env.queuecounter)
 			tracer().Debugf("filter stage %d finished -1 buffered task for %v | %d in %s", wno, node, udata.serial, qid)
-			f.env.queuecounter.Done() // worker has finished a workpackage
-		} else {
-			break // no more work to do
 		}
+		f.env.queuecounter.Done() // worker has finished a workpackage
+	}
+}
+
+// bufferQueue is the buffer queue of a filter. Workers of a filter consume
+// work packages from their buffer queue and push new ones to it. The queue is
+// a ring buffer with a capacity: a worker pushing a package onto a full queue
+// blocks until another worker has taken a package off the queue. As the
+// workers of a filter are the only consumers of the queue, the last worker
+// not yet blocked must not block, too. Its package is queued beyond the
+// capacity, growing the ring buffer as needed.
+//
+// Workers waiting for work are woken up by the signal channel, which is closed
+// when the filter shuts down.
+type bufferQueue[T comparable] struct {
+	mx       sync.Mutex
+	room     *sync.Cond       // signalled if a work package has been taken off the queue
+	ring     []nodePackage[T] // ring buffer of work packages
+	head     int              // index of the first work package in ring
+	count    int              // number of work packages in ring
+	capacity int              // number of work packages before pushing blocks
+	workers  int              // number of workers consuming the queue
+	blocked  int              // number of workers blocked in push
+	signal   chan struct{}    // non-empty if work packages may be available
+}
+
+// Initial size of the ring buffer of a buffer queue, which grows up to the
+// capacity of the queue.
+const initialRingSize int = 8
+
+func newBufferQueue[T comparable](capacity int) *bufferQueue[T] {
+	size := capacity
+	if size > initialRingSize {
+		size = initialRingSize
+	}
+	q := &bufferQueue[T]{
+		ring:     make([]nodePackage[T], size),
+		capacity: capacity,
+		workers:  1,
+		signal:   make(chan struct{}, 1),
 	}
+	q.room = sync.NewCond(&q.mx)
+	return q
+}
+
+// push appends a work package to the queue. If the queue is full, push blocks
+// until another worker takes a work package off the queue, unless all other
+// workers are blocked in push already.
+func (q *bufferQueue[T]) push(pkg nodePackage[T]) {
+	q.mx.Lock()
+	for q.count >= q.capacity && q.blocked+1 < q.workers {
+		q.blocked++
+		q.room.Wait()
+		q.blocked--
+	}
+	if q.count == len(q.ring) { // ring is full => grow
+		ring := make([]nodePackage[T], 2*len(q.ring)+1)
+		n := copy(ring, q.ring[q.head:])
+		copy(ring[n:], q.ring[:q.head])
+		q.ring, q.head = ring, 0
+	}
+	q.ring[(q.head+q.count)%len(q.ring)] = pkg
+	q.count++
+	q.mx.Unlock()
+	q.notify()
+}
+
+// pop removes the first work package from the queue, if any.
+func (q *bufferQueue[T]) pop() (nodePackage[T], bool) {
+	q.mx.Lock()
+	if q.count == 0 {
+		q.mx.Unlock()
+		return nodePackage[T]{}, false
+	}
+	pkg := q.ring[q.head]
+	q.ring[q.head] = nodePackage[T]{} // do not retain the node
+	q.head = (q.head + 1) % len(q.ring)
+	q.count--
+	more := q.count > 0
+	if q.blocked > 0 {
+		q.room.Signal() // make room for a blocked worker
+	}
+	q.mx.Unlock()
+	if more {
+		q.notify() // wake up another worker
+	}
+	return pkg, true
+}
+
+// notify signals waiting workers that work is available. A single pending
+// signal suffices, as every worker popping a package passes the signal on.
+func (q *bufferQueue[T]) notify() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *bufferQueue[T]) length() int {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	return q.count
+}
+
+func (q *bufferQueue[T]) close() {
+	close(q.signal)
 }
 
 // pipeline is a chain of filters to perform tasks on Nodes.
 // Filters, i.e., pipeline stages are connected by channels.
 type pipeline[S, T comparable] struct {
-	input   chan nodePackage[S] // initial workload
-	results chan nodePackage[T] // where final output of this pipeline goes to
-	state   *pipelineState      // mutable state all incarnations of a pipeline refer to
+	input   chan nodePackage[S]        // initial workload
+	results chan nodePackage[T]        // where final output of this pipeline goes to
+	state   *pipelineState             // mutable state all incarnations of a pipeline refer to
+	connect func(func(nodePackage[T])) // sets the successor of the final stage of a sequential walk
 }
 
 // pipelineState is the mutable part of a pipeline, shared by all incarnations of a
 // pipeline. This is necessary for synchronization.
 type pipelineState struct {
-	mx         sync.RWMutex   // to sychronize access to various fields
-	queuecount sync.WaitGroup // overall count of work packages
-	errors     chan error     // collector channel for error messages
-	stages     []stage        // chain of stages/filters
-	running    bool           // is this pipeline processing?
+	mx         sync.RWMutex     // to sychronize access to various fields
+	queuecount sync.WaitGroup   // overall count of work packages
+	errors     chan error       // collector channel for error messages
+	stages     []stage          // chain of stages/filters
+	running    bool             // is this pipeline processing?
+	ordered    bool             // results carry serials in document order (see TopDownDF)
+	instr      *instrumentation // metrics and hooks, if instrumented
+	udata      interface{}      // client data attached to a walk
+	maxDepth   int              // maximum depth of traversals, 0 for no limit (see MaxDepth)
+	reslen     int              // capacity of channels between stages, 0 for default (see BufferSizes)
+	buflen     int              // capacity of buffer queues, 0 for default (see BufferSizes)
+	cancelled  int32            // remaining work is skipped, used atomically (see FirstMatch)
+	setupErr   error            // first setup error flagged, see poison
+	sequential bool             // stages run synchronously, without goroutines (see RunSequential)
+	head       interface{}      // entry func(nodePackage[S]) of the first stage of a sequential walk
+	lasterror  error            // last error of a sequential walk
 }
 
 func newPipelineState() *pipelineState {
@@ -248,6 +450,22 @@ func newPipelineState() *pipelineState {
 	return state
 }
 
+// poison flags a setup error for a walk. Only the first setup error is kept.
+func (pstate *pipelineState) poison(err error) {
+	pstate.mx.Lock()
+	defer pstate.mx.Unlock()
+	if pstate.setupErr == nil {
+		pstate.setupErr = err
+	}
+}
+
+// poisoned returns the first setup error flagged for a walk, or nil.
+func (pstate *pipelineState) poisoned() error {
+	pstate.mx.RLock()
+	defer pstate.mx.RUnlock()
+	return pstate.setupErr
+}
+
 func (pstate *pipelineState) appendStage(s stage) {
 	pstate.stages = append(pstate.stages, s)
 }
@@ -280,44 +498,53 @@ func (pipe *pipeline[S, T]) empty() bool {
 	return len(pipe.state.stages) == 0
 }
 
-// pushResult puts a node on the results channel of a filter stage (non-blocking).
-// It is used by filter workers to communicate a result to the next stage
-// of a pipeline.
+// pushResult puts a node on the results channel of a filter stage. It is used
+// by filter workers to communicate a result to the next stage of a pipeline.
+//
+// If the results channel is full, pushResult blocks until the next stage has
+// taken a node off the channel. This is safe, as results flow downstream only:
+// the final stage is drained by the promise of the pipeline. Blocking throttles
+// stages which produce results faster than the next stage is able to process
+// them.
 func (f *filter[S, T]) pushResult(node *Node[T], serial uint32) {
-	qid := fmt.Sprintf("[#%p]", f.env.queuecounter)
-	tracer().Debugf("filter stage pushes +1 result %v | %d to %s", node, serial, qid)
-	f.env.queuecounter.Add(1)
-	written := true
-	select { // try to send it synchronously without blocking
-	case f.results <- nodePackage[T]{node, nil, serial}:
-	default:
-		written = false
+	if tracingDebug() {
+		qid := fmt.Sprintf("[#%p]", f.env.queuecounter)
+		tracer().Debugf("filter stage pushes +1 result %v | %d to %s", node, serial, qid)
 	}
-	if !written { // nope, we'll have to go async
-		go func(node *Node[T], serial uint32) {
-			f.results <- nodePackage[T]{node, nil, serial}
-		}(node, serial)
+	if f.stats != nil {
+		atomic.AddUint64(&f.stats.emitted, 1)
 	}
+	f.env.queuecounter.Add(1)
+	f.results <- nodePackage[T]{node, nil, serial}
 }
 
-// pushBuffer puts a node on the buffer queue of a filter
-// (non-blocking).
+// pushDropped puts a marker for a serial on the results channel of a filter
+// stage, if a work package of an ordered walk has not yielded a result. It
+// tells consumers waiting for results in order (see Stream) not to wait for
+// a result with this serial. Subsequent stages forward markers unchanged, up to
+// a stage numbering its results itself (see TopDownDF).
+func (f *filter[S, T]) pushDropped(serial uint32) {
+	if tracingDebug() {
+		qid := fmt.Sprintf("[#%p]", f.env.queuecounter)
+		tracer().Debugf("filter stage pushes +1 marker for dropped serial %d to %s", serial, qid)
+	}
+	f.env.queuecounter.Add(1)
+	f.results <- nodePackage[T]{nil, nil, serial}
+}
+
+// pushBuffer puts a node on the buffer queue of a filter. If the buffer queue
+// is full, pushBuffer blocks until another worker of the filter has taken a
+// node off the queue (see bufferQueue).
 func (f *filter[S, T]) pushBuffer(node *Node[S], udata interface{}, serial uint32) {
-	nodesup := nodePackage[S]{node, udata, serial}
-	qid := fmt.Sprintf("[#%p]", f.env.queuecounter)
-	tracer().Debugf("filter stage buffers +1 node %v | %d to %s", node, serial, qid)
-	f.env.queuecounter.Add(1) // overall workload increases
-	written := true
-	select { // try to send it synchronously without blocking
-	case f.queue <- nodesup:
-	default:
-		written = false
+	if tracingDebug() {
+		qid := fmt.Sprintf("[#%p]", f.env.queuecounter)
+		tracer().Debugf("filter stage buffers +1 node %v | %d to %s", node, serial, qid)
 	}
-	if !written { // nope, we'll have to go async
-		go func(sup nodePackage[S]) {
-			f.queue <- sup
-		}(nodesup)
+	if f.stats != nil {
+		atomic.AddUint64(&f.stats.buffered, 1)
 	}
+	f.env.queuecounter.Add(1) // overall workload increases
+	f.queue.push(nodePackage[S]{node, udata, serial})
 }
 
 // appendFilter appends a filter to a pipeline, i.e. as the last stage of
@@ -333,7 +560,26 @@ func AppendFilter[S, T, U comparable](pipe *pipeline[S, T], f *filter[T, U]) *pi
 	env := &filterenv[T]{} // now set the environment for the filter
 	env.errors = pipe.state.errors
 	env.queuecounter = &pipe.state.queuecount
-	env.input = pipe.results       // current output is input to new filter stage
+	env.cancelled = &pipe.state.cancelled
+	env.ordered = pipe.state.ordered
+	env.input = pipe.results // current output is input to new filter stage
+	if instr := pipe.state.instr; instr != nil {
+		f.stats = instr.addStage(f.name)
+	}
+	if pipe.state.sequential { // connect stages by calls instead of channels
+		env.lasterror = &pipe.state.lasterror
+		f.env = env
+		if pipe.connect == nil {
+			pipe.state.head = f.runSequential
+		} else {
+			pipe.connect(f.runSequential)
+		}
+		newpipe.connect = func(next func(nodePackage[U])) { f.next = next }
+		return newpipe
+	}
+	if pipe.state.reslen > 0 {
+		f.reslen = pipe.state.reslen
+	}
 	newpipe.results = f.start(env) // remember new final output
 	return newpipe
 }
@@ -350,10 +596,12 @@ func (pipe *pipeline[S, T]) startProcessing() {
 	defer pipe.state.mx.Unlock()
 	if !pipe.state.running {
 		pipe.state.running = true
+		pipe.state.instr.start()
 		go func() { // cleanup function
 			qid := fmt.Sprintf("[%p]", &pipe.state.queuecount)
 			tracer().Debugf("started waiting for empty node queue %s ...", qid)
 			pipe.state.queuecount.Wait() // wait for empty queues
+			pipe.state.instr.finish()    // before results channel is closed, i.e. before promise resolves
 			tracer().Debugf("shutting down...")
 			close(pipe.state.errors)
 			close(pipe.input)
@@ -369,8 +617,10 @@ func (pipe *pipeline[S, T]) startProcessing() {
 
 // pushSync synchronously puts a node on the input channel of a pipeline.
 func (pipe *pipeline[S, T]) pushSync(node *Node[S], serial uint32) {
-	qid := fmt.Sprintf("[#%p]", &pipe.state.queuecount)
-	tracer().Debugf("pipeline sync start pushes +1 node %v | %d to %s", node, serial, qid)
+	if tracingDebug() {
+		qid := fmt.Sprintf("[#%p]", &pipe.state.queuecount)
+		tracer().Debugf("pipeline sync start pushes +1 node %v | %d to %s", node, serial, qid)
+	}
 	pipe.state.queuecount.Add(1)
 	pipe.input <- nodePackage[S]{node, nil, serial} // input q is buffered
 }
@@ -389,27 +639,35 @@ func (pipe *pipeline[S, T]) pushAsync(node *Node[S], serial uint32) {
 // It will receive the results of the final filter stage of the pipeline
 // and collect them into a slice of Nodes. The slice will be a set, i.e.
 // not contain duplicate Nodes.
-func waitForCompletion[T comparable](results <-chan nodePackage[T], errch <-chan error, counter *sync.WaitGroup) ([]*Node[T], error) {
+//
+// If ordered is set, or if ranks have been calculated for the nodes, the
+// nodes are sorted by their serials.
+func waitForCompletion[T comparable](results <-chan nodePackage[T], errch <-chan error, counter *sync.WaitGroup,
+	ordered bool) ([]*Node[T], error) {
 	// Collect all results from the pipeline
 	var selection []*Node[T]       // slice of nodes -> return value
 	var serials []uint32           // slice of serial numbers for ordering
 	m := make(map[*Node[T]]uint32) // intermediate map to suppress duplicates
 	for nodepkg := range results { // drain results channel
-		m[nodepkg.node] = nodepkg.serial // remember last serial for node (may be random)
-		qid := fmt.Sprintf("[#%p]", counter)
-		tracer().Debugf("extracted -1 result from %s", qid)
+		if nodepkg.node != nil { // skip markers for dropped serials
+			m[nodepkg.node] = nodepkg.serial // remember last serial for node (may be random)
+		}
+		if tracingDebug() {
+			qid := fmt.Sprintf("[#%p]", counter)
+			tracer().Debugf("extracted -1 result from %s", qid)
+		}
 		counter.Done() // we removed a value => count down
 	}
 	for node, serial := range m { // extract unique results into slices
 		selection = append(selection, node) // collect unique return values
 		serials = append(serials, serial)
-		// resultSlices is a helper struct for sorting
-		// it implements the Sort interface
-		if len(selection) > 0 && selection[0].Rank > 0 { // if rank is unset: no sorting possible
-			sort.Sort(resultSlices[T]{selection, serials})
-		}
-		// after this, serials are discarded
 	}
+	// resultSlices is a helper struct for sorting
+	// it implements the Sort interface
+	if len(selection) > 0 && (ordered || selection[0].Rank > 0) { // if rank is unset: no sorting possible
+		sort.Sort(resultSlices[T]{selection, serials})
+	}
+	// after this, serials are discarded
 	// Get last error from error channel
 	var lasterror error
 	for err := range errch {
@@ -0,0 +1,132 @@
+package tree
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// RunSequential selects a synchronous execution engine for the walk of w.
+// Walker operations are performed exactly as for concurrent walks, but without
+// goroutines: the initial node is handed through the stages of the pipeline by
+// plain function calls, each stage processing the nodes it schedules
+// internally (e.g., the children of nodes for TopDown) in FIFO order. Nodes are
+// thus visited in the same order every time a walk is performed, and panics
+// in client functions show the complete call chain in their stack trace.
+//
+// Sequential walks are intended for unit tests and for small trees, where
+// reproducible results are more important than concurrency:
+//
+//     nodes, err := NewWalker(root).RunSequential().TopDown(action).Promise()()
+//
+// The walk is performed when Promise (or Stream or FirstMatch) is called,
+// blocking the caller until the walk is done. Results of walks without a
+// defined order (see Promise) are returned in order of arrival.
+//
+// RunSequential has to be called before any filter is added, i.e. directly
+// after NewWalker(…). Otherwise, ErrAlreadyProcessing is reported as an error.
+//
+// If w is nil, RunSequential will return nil.
+func (w *Walker[S, T]) RunSequential() *Walker[S, T] {
+	if w == nil {
+		return nil
+	}
+	if !w.pipe.empty() {
+		return w.setupFailed(ErrAlreadyProcessing)
+	}
+	w.pipe.state.mx.Lock()
+	w.pipe.state.sequential = true
+	w.pipe.state.mx.Unlock()
+	return w
+}
+
+// sequential is a predicate wether the walk of w runs without goroutines.
+func (w *Walker[S, T]) sequential() bool {
+	w.pipe.state.mx.RLock()
+	defer w.pipe.state.mx.RUnlock()
+	return w.pipe.state.sequential
+}
+
+// walkSequential performs a sequential walk and returns its results, with
+// duplicates removed. It returns the last error occured, with a setup error
+// taking precedence.
+func (w *Walker[S, T]) walkSequential() ([]*Node[T], error) {
+	state := w.pipe.state
+	var results []nodePackage[T]
+	w.pipe.connect(func(nodepkg nodePackage[T]) {
+		results = append(results, nodepkg)
+	})
+	state.instr.start()
+	state.head.(func(nodePackage[S]))(nodePackage[S]{w.initial, nil, 0})
+	state.instr.finish()
+	selection := sequentialResults(results, state.ordered)
+	if err := state.poisoned(); err != nil {
+		return selection, err
+	}
+	return selection, state.lasterror
+}
+
+// sequentialResults collects the nodes of results into a set, in order of
+// arrival. As with waitForCompletion, the nodes are sorted by their serials
+// if ordered is set or if ranks have been calculated for the nodes.
+func sequentialResults[T comparable](results []nodePackage[T], ordered bool) []*Node[T] {
+	var rs resultSlices[T]
+	index := make(map[*Node[T]]int) // suppress duplicates
+	for _, nodepkg := range results {
+		if i, dup := index[nodepkg.node]; dup {
+			rs.serials[i] = nodepkg.serial // remember last serial for node
+			continue
+		}
+		index[nodepkg.node] = len(rs.nodes)
+		rs.nodes = append(rs.nodes, nodepkg.node)
+		rs.serials = append(rs.serials, nodepkg.serial)
+	}
+	if len(rs.nodes) > 0 && (ordered || rs.nodes[0].Rank > 0) {
+		sort.Stable(rs)
+	}
+	return rs.nodes
+}
+
+// runSequential performs the task of a filter for a work package, and
+// afterwards for all the work packages the task buffers, in FIFO order.
+// Results are handed to the next stage immediately, i.e. the next stage
+// processes a result before this stage continues.
+func (f *filter[S, T]) runSequential(nodepkg nodePackage[S]) {
+	var queue []nodePackage[S]
+	push := func(node *Node[T], serial uint32) {
+		if f.stats != nil {
+			atomic.AddUint64(&f.stats.emitted, 1)
+		}
+		f.next(nodePackage[T]{node, nil, serial})
+	}
+	var pushBuf func(*Node[S], interface{}, uint32)
+	if f.queue != nil { // tasks without a buffer queue get nil, as with filterWorker
+		pushBuf = func(node *Node[S], udata interface{}, serial uint32) {
+			if f.stats != nil {
+				atomic.AddUint64(&f.stats.buffered, 1)
+			}
+			queue = append(queue, nodePackage[S]{node, udata, serial})
+		}
+	}
+	buffered := false
+	for {
+		if !f.env.isCancelled() {
+			udata := userdata{f.filterdata, nodepkg.nodelocal, nodepkg.serial}
+			var err error
+			if f.stats == nil {
+				err = f.task(nodepkg.node, buffered, udata, push, pushBuf)
+			} else {
+				t := f.stats.startTask(nodepkg.serial, len(queue))
+				err = f.task(nodepkg.node, buffered, udata, push, pushBuf)
+				f.stats.finishTask(t, err)
+			}
+			if err != nil {
+				*f.env.lasterror = err
+			}
+		}
+		if len(queue) == 0 {
+			return
+		}
+		nodepkg, queue = queue[0], queue[1:]
+		buffered = true
+	}
+}
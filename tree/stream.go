@@ -0,0 +1,144 @@
+package tree
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// Stream is an alternative to Promise, delivering the resulting nodes of a walk
+// on a channel while the walk is still in progress. Clients may thus start
+// processing results, e.g. build an index, without waiting for the complete
+// walk to finish.
+//
+// For ordered walks (see TopDownDF), results are delivered in document order,
+// each one as soon as all of its predecessors have been delivered or dropped by
+// later pipeline stages. For all other walks, results are delivered in order of
+// arrival, without any guarantee of order, even if the nodes of the tree carry
+// ranks (see CalcRank). Use Promise to receive these results sorted.
+//
+// Results are delivered once, even if the pipeline yields them multiple times.
+// The node channel is closed when the walk is done. Afterwards, the error
+// channel delivers the error of the walk, if any, and is closed. Clients have
+// to drain the node channel, as the walk will block otherwise.
+//
+// For sequential walks (see RunSequential), Stream performs the walk before
+// returning, and the channels deliver the results as Promise would.
+//
+// As with Promise, no filters may be added to w after calling Stream.
+func (w *Walker[S, T]) Stream() (<-chan *Node[T], <-chan error) {
+	nodes := make(chan *Node[T])
+	errs := make(chan error, 1)
+	if w == nil {
+		close(nodes)
+		errs <- ErrEmptyTree
+		close(errs)
+		return nodes, errs
+	}
+	state := w.pipe.state
+	w.promising = true  // will block calls to establish new filters
+	if w.pipe.empty() { // no filters => nothing will be processed
+		close(nodes)
+		if err := state.poisoned(); err != nil {
+			errs <- err
+		}
+		close(errs)
+		return nodes, errs
+	}
+	if w.sequential() {
+		selection, err := w.walkSequential()
+		results := make(chan *Node[T], len(selection))
+		for _, node := range selection {
+			results <- node
+		}
+		close(results)
+		if err != nil {
+			errs <- err
+		}
+		close(errs)
+		return results, errs
+	}
+	state.mx.RLock()
+	ordered := state.ordered
+	state.mx.RUnlock()
+	go func() {
+		defer close(errs)
+		streamResults(w.pipe.results, &state.queuecount, ordered, nodes)
+		var lasterror error
+		for err := range state.errors { // get last error from error channel
+			if err != nil {
+				lasterror = err
+			}
+		}
+		if err := state.poisoned(); err != nil {
+			lasterror = err
+		}
+		if lasterror != nil {
+			errs <- lasterror
+		}
+	}()
+	return nodes, errs
+}
+
+// streamResults drains the results channel of a pipeline and sends results to
+// out. For ordered walks, results are re-ordered by serial; markers for dropped
+// serials (nodes of nil) are not sent, but release the results waiting for them.
+// It closes out after the results channel has been closed.
+func streamResults[T comparable](results <-chan nodePackage[T], counter *sync.WaitGroup, ordered bool,
+	out chan<- *Node[T]) {
+	//
+	defer close(out)
+	seen := make(map[*Node[T]]struct{}) // suppress duplicates
+	var pending pendingResults[T]       // results and markers waiting for their predecessors
+	next := uint32(1)                   // serial of the next result of an ordered walk
+	for nodepkg := range results {
+		counter.Done() // we removed a value => count down
+		if nodepkg.node != nil {
+			if _, dup := seen[nodepkg.node]; dup {
+				continue
+			}
+			seen[nodepkg.node] = struct{}{}
+		}
+		if !ordered {
+			if nodepkg.node != nil {
+				out <- nodepkg.node // no order defined
+			}
+			continue
+		}
+		heap.Push(&pending, nodepkg)
+		// release results with consecutive serials, and results with serials already
+		// passed, e.g. from stages yielding more than one result per serial
+		for len(pending) > 0 && pending[0].serial <= next {
+			nodepkg := heap.Pop(&pending).(nodePackage[T])
+			if nodepkg.node != nil {
+				out <- nodepkg.node
+			}
+			if nodepkg.serial == next {
+				next++
+			}
+		}
+	}
+	for len(pending) > 0 { // flush remaining results
+		if nodepkg := heap.Pop(&pending).(nodePackage[T]); nodepkg.node != nil {
+			out <- nodepkg.node
+		}
+	}
+}
+
+// pendingResults is a min-heap of results of an ordered walk, keyed by serial.
+// It implements heap.Interface.
+type pendingResults[T comparable] []nodePackage[T]
+
+func (pr pendingResults[T]) Len() int           { return len(pr) }
+func (pr pendingResults[T]) Less(i, j int) bool { return pr[i].serial < pr[j].serial }
+func (pr pendingResults[T]) Swap(i, j int)      { pr[i], pr[j] = pr[j], pr[i] }
+
+func (pr *pendingResults[T]) Push(x interface{}) {
+	*pr = append(*pr, x.(nodePackage[T]))
+}
+
+func (pr *pendingResults[T]) Pop() interface{} {
+	old := *pr
+	nodepkg := old[len(old)-1]
+	*pr = old[:len(old)-1]
+	return nodepkg
+}
@@ -12,19 +12,49 @@ Copyright © 2017–2021 Norbert Pillmayer <norbert@pillmayer.com>
 
 import (
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
+// ErrSetup matches all errors flagged for malformed Walker expressions, e.g.
+// for filters with nil predicates or for filters added after Promise() has been
+// called. Clients may distinguish setup errors from errors occuring during
+// traversal of a tree with
+//
+//     if errors.Is(err, tree.ErrSetup) { … }
+//
+// Errors of predicates and actions, as well as MaxDepthError, are traversal errors.
+var ErrSetup = errors.New("walker expression is malformed")
+
+// setupError is the type of errors matching ErrSetup.
+type setupError string
+
+func (e setupError) Error() string {
+	return string(e)
+}
+
+// Is makes setup errors match ErrSetup.
+func (e setupError) Is(target error) bool {
+	return target == ErrSetup
+}
+
 // ErrInvalidFilter is thrown if a pipeline filter step is defunct.
-var ErrInvalidFilter = errors.New("filter stage is invalid")
+// It is a setup error (see ErrSetup).
+var ErrInvalidFilter error = setupError("filter stage is invalid")
 
 // ErrEmptyTree is thrown if a Walker is called with an empty tree. Refer to
 // the documentation of NewWalker() for details about this scenario.
-var ErrEmptyTree = errors.New("cannot walk empty tree")
+// It is a setup error (see ErrSetup).
+var ErrEmptyTree error = setupError("cannot walk empty tree")
+
+// ErrCycle is returned by CheckChild if a node is to be inserted as a child of
+// itself or of one of its descendents.
+var ErrCycle = errors.New("node would become its own ancestor")
 
 // ErrNoMoreFiltersAccepted is thrown if a client already called Promise(), but tried to
-// re-use a walker with another filter.
-var ErrNoMoreFiltersAccepted = errors.New("in promise mode; will not accept new filters; use a new walker")
+// re-use a walker with another filter. It is a setup error (see ErrSetup).
+var ErrNoMoreFiltersAccepted error = setupError("in promise mode; will not accept new filters; use a new walker")
 
 // Walker holds information for operating on trees: finding nodes and
 // doing work on them. Clients usually create a Walker for a (sub-)tree
@@ -53,6 +83,9 @@ var ErrNoMoreFiltersAccepted = errors.New("in promise mode; will not accept new
 // return a non-empty set of nodes. Firstly, they need to check for errors,
 // and secondly without fetching the (possibly empty) result set by calling
 // the promise, the Walker may leak goroutines.
+//
+// Walker operations do not panic for malformed expressions. Instead, the first
+// setup error poisons the walk, and the promise will return it (see ErrSetup).
 type Walker[S, T comparable] struct {
 	*sync.Mutex
 	initial   *Node[S]        // initial node of (sub-)tree
@@ -90,15 +123,24 @@ func NewWalker[T comparable](initial *Node[T]) *Walker[T, T] {
 
 // appendFilterForTask will create a new filter for a task and append
 // that filter at the end of the pipeline. If processing has not
-// been started yet, it will be started.
-func appendFilterForTask[S, T, U comparable](w *Walker[S, T], task workerTask[T, U], udata interface{},
-	buflen int) (*Walker[S, U], error) {
+// been started yet, it will be started. name is the name of the Walker
+// operation, used for instrumentation only.
+func appendFilterForTask[S, T, U comparable](w *Walker[S, T], name string, task workerTask[T, U],
+	udata interface{}, buflen int) (*Walker[S, U], error) {
 	//
 	if w.promising {
 		return nil, ErrNoMoreFiltersAccepted
 	}
+	if buflen > 0 {
+		w.pipe.state.mx.RLock()
+		if w.pipe.state.buflen > 0 {
+			buflen = w.pipe.state.buflen
+		}
+		w.pipe.state.mx.RUnlock()
+	}
 	newFilter := newFilter(task, udata, buflen)
-	if w.pipe.empty() { // quick check, may be false positive when in if-block
+	newFilter.name = name
+	if w.pipe.empty() && !w.sequential() { // quick check, may be false positive when in if-block
 		// now we know the new filter might be the first one
 		w.startProcessing() // this will check again, and startup if pipe empty
 	}
@@ -108,6 +150,15 @@ func appendFilterForTask[S, T, U comparable](w *Walker[S, T], task workerTask[T,
 	return newW, nil
 }
 
+// setupFailed flags a setup error for the walk of w and returns w, thus
+// continuing the DSL expression chain. The promise of the walk will return the
+// first setup error flagged.
+func (w *Walker[S, T]) setupFailed(err error) *Walker[S, T] {
+	tracer().Errorf(err.Error())
+	w.pipe.state.poison(err)
+	return w
+}
+
 // startProcessing should be called as soon as the first filter is inserted
 // into the pipeline. It will put the initial tree node onto the front input
 // channel.
@@ -134,6 +185,12 @@ func (w *Walker[S, T]) startProcessing() {
 // a possible error value. Calling the Promise will block until all
 // concurrent operations on the tree nodes have finished, i.e. it
 // is a synchronization point.
+//
+// If a setup error has been flagged for the walk, the promise returns it, taking
+// precedence over errors occuring during traversal (see ErrSetup).
+//
+// For sequential walks (see RunSequential), Promise performs the walk before
+// returning.
 func (w *Walker[S, T]) Promise() func() ([]*Node[T], error) {
 	if w == nil {
 		// empty Walker => wrap nil set and an error
@@ -141,21 +198,40 @@ func (w *Walker[S, T]) Promise() func() ([]*Node[T], error) {
 			return nil, ErrEmptyTree
 		}
 	}
-	// drain the result channel and the error channel
+	state := w.pipe.state
+	if w.pipe.empty() { // no filters => nothing will be processed
+		w.promising = true
+		return func() ([]*Node[T], error) {
+			return nil, state.poisoned()
+		}
+	}
 	w.promising = true // will block calls to establish new filters
+	if w.sequential() {
+		selection, lasterror := w.walkSequential()
+		return func() ([]*Node[T], error) {
+			return selection, lasterror
+		}
+	}
+	// drain the result channel and the error channel
 	errch := w.pipe.state.errors
 	results := w.pipe.results
 	counter := &w.pipe.state.queuecount
+	w.pipe.state.mx.RLock()
+	ordered := w.pipe.state.ordered
+	w.pipe.state.mx.RUnlock()
 	signal := make(chan struct{}, 1)
 	var selection []*Node[T]
 	var lasterror error
 	go func() {
 		defer close(signal)
-		selection, lasterror = waitForCompletion(results, errch, counter)
+		selection, lasterror = waitForCompletion(results, errch, counter, ordered)
 	}()
 	// TODO : sort results
 	return func() ([]*Node[T], error) {
 		<-signal
+		if err := state.poisoned(); err != nil {
+			return selection, err
+		}
 		return selection, lasterror
 	}
 }
@@ -176,16 +252,192 @@ func Whatever[T comparable]() Predicate[T] {
 	}
 }
 
-// NodeIsLeaf is a predicate to match leafs of a tree.
+// NodeIsLeaf is a predicate to match leafs of a tree, i.e. nodes without
+// children. Empty child slots do not count as children.
 func NodeIsLeaf[T comparable]() Predicate[T] {
 	return func(test *Node[T], node *Node[T]) (match *Node[T], err error) {
-		if test.ChildCount() == 0 {
+		if test.kids().occupied() == 0 {
 			return test, nil
 		}
 		return nil, nil
 	}
 }
 
+// --- Per-walk user data ----------------------------------------------------
+
+// DataPredicate is a variant of Predicate, which additionally receives the user
+// data of the walk it is used in (see WithUserData). Use Walker.Bind to turn it
+// into a Predicate.
+type DataPredicate[T comparable] func(test *Node[T], node *Node[T], udata interface{}) (match *Node[T], err error)
+
+// WithUserData attaches arbitrary client data to a walk. The data is shared by
+// all filters of the Walker's pipeline and may be accessed by predicates,
+// either by calling UserData or by binding a DataPredicate to the Walker.
+// This way, predicates may be defined once and re-used for different walks.
+//
+// WithUserData has to be called before any filter is added, i.e. directly
+// after NewWalker(…). Otherwise, ErrAlreadyProcessing is reported as an error.
+//
+// If w is nil, WithUserData will return nil.
+func (w *Walker[S, T]) WithUserData(udata interface{}) *Walker[S, T] {
+	if w == nil {
+		return nil
+	}
+	if !w.pipe.empty() {
+		return w.setupFailed(ErrAlreadyProcessing)
+	}
+	w.pipe.state.mx.Lock()
+	w.pipe.state.udata = udata
+	w.pipe.state.mx.Unlock()
+	return w
+}
+
+// UserData returns the client data attached to a walk, or nil.
+func (w *Walker[S, T]) UserData() interface{} {
+	if w == nil {
+		return nil
+	}
+	w.pipe.state.mx.RLock()
+	defer w.pipe.state.mx.RUnlock()
+	return w.pipe.state.udata
+}
+
+// Bind creates a predicate calling p with the user data of w.
+//
+//     isLevel := func(test, node *tree.Node[int], udata interface{}) (*tree.Node[int], error) {
+//         if test.Payload == udata.(int) {
+//             return test, nil
+//         }
+//         return nil, nil
+//     }
+//     w := tree.NewWalker(root).WithUserData(3)
+//     nodes, err := w.DescendentsWith(w.Bind(isLevel)).Promise()()
+//
+// If p is nil, Bind will return nil.
+func (w *Walker[S, T]) Bind(p DataPredicate[T]) Predicate[T] {
+	if p == nil {
+		return nil
+	}
+	return func(test *Node[T], node *Node[T]) (*Node[T], error) {
+		return p(test, node, w.UserData())
+	}
+}
+
+// MaxDepth limits the depth of traversals of a walk. Walks which would visit
+// nodes more than max levels below (or above, for AncestorWith) the nodes they
+// start with are aborted, and a MaxDepthError is reported. This protects
+// pipelines against degenerate or malformed trees, which would otherwise keep
+// the pipeline busy for an indefinite time. max <= 0 means no limit, which is
+// the default.
+//
+// MaxDepth applies to DescendentsWith, AllDescendents, FirstMatch, TopDown,
+// TopDownDF, TopDownVisit and AncestorWith.
+//
+// MaxDepth has to be called before any filter is added, i.e. directly
+// after NewWalker(…). Otherwise, ErrAlreadyProcessing is reported as an error.
+//
+// If w is nil, MaxDepth will return nil.
+func (w *Walker[S, T]) MaxDepth(max int) *Walker[S, T] {
+	if w == nil {
+		return nil
+	}
+	if !w.pipe.empty() {
+		return w.setupFailed(ErrAlreadyProcessing)
+	}
+	if max < 0 {
+		max = 0
+	}
+	w.pipe.state.mx.Lock()
+	w.pipe.state.maxDepth = max
+	w.pipe.state.mx.Unlock()
+	return w
+}
+
+// BufferSizes sets the capacities of the internal queues of the pipeline of a
+// walk. results is the capacity of the channels connecting the stages (Walker
+// operations) of the pipeline, buffer is the capacity of the buffer queues
+// stages use to schedule nodes internally, e.g. the children of nodes for
+// TopDown. Values <= 0 select the defaults.
+//
+// A stage producing results faster than the next stage processes them blocks
+// when the channel to the next stage is full, thus larger channels trade memory
+// for less contention. Likewise, a worker of a stage scheduling a node on a full
+// buffer queue blocks until another worker of the stage has taken a node off the
+// queue. Only if all other workers of the stage are blocked this way, the queue
+// grows beyond its capacity, as the stage would deadlock otherwise.
+//
+// BufferSizes has to be called before any filter is added, i.e. directly
+// after NewWalker(…). Otherwise, ErrAlreadyProcessing is reported as an error.
+//
+// If w is nil, BufferSizes will return nil.
+func (w *Walker[S, T]) BufferSizes(results, buffer int) *Walker[S, T] {
+	if w == nil {
+		return nil
+	}
+	if !w.pipe.empty() {
+		return w.setupFailed(ErrAlreadyProcessing)
+	}
+	if results < 0 {
+		results = 0
+	}
+	if buffer < 0 {
+		buffer = 0
+	}
+	w.pipe.state.mx.Lock()
+	w.pipe.state.reslen, w.pipe.state.buflen = results, buffer
+	w.pipe.state.mx.Unlock()
+	return w
+}
+
+// MaxDepthError is reported if a walk has been aborted because it exceeded
+// the maximum depth set with MaxDepth.
+type MaxDepthError struct {
+	MaxDepth int    // depth limit of the walk
+	Stage    string // name of the Walker operation which exceeded the limit
+}
+
+func (e *MaxDepthError) Error() string {
+	return fmt.Sprintf("%s exceeded maximum tree depth of %d", e.Stage, e.MaxDepth)
+}
+
+// depthGuard enforces the depth limit of a walk for a filter. If the limit is
+// exceeded, the pipeline is cancelled.
+type depthGuard struct {
+	max       int    // maximum depth, 0 for no limit
+	stage     string // name of the Walker operation
+	cancelled *int32 // cancellation flag of the pipeline
+}
+
+func newDepthGuard[S, T comparable](w *Walker[S, T], stage string) depthGuard {
+	w.pipe.state.mx.RLock()
+	defer w.pipe.state.mx.RUnlock()
+	return depthGuard{max: w.pipe.state.maxDepth, stage: stage, cancelled: &w.pipe.state.cancelled}
+}
+
+// active is true if depth has to be tracked.
+func (g depthGuard) active() bool {
+	return g.max > 0
+}
+
+// check returns a MaxDepthError if depth exceeds the limit, and cancels the
+// pipeline.
+func (g depthGuard) check(depth int) error {
+	if g.max > 0 && depth > g.max {
+		atomic.StoreInt32(g.cancelled, 1)
+		return &MaxDepthError{MaxDepth: g.max, Stage: g.stage}
+	}
+	return nil
+}
+
+// childDepth is the depth to hand over to the children of a node at depth,
+// or 0 if depth is not tracked.
+func (g depthGuard) childDepth(depth int) int {
+	if g.active() {
+		return depth + 1
+	}
+	return 0
+}
+
 // TraverseAll is a predicate to match nothing (see type Predicate).
 // It is useful to traverse a whole tree.
 /*
@@ -203,11 +455,10 @@ func (w *Walker[S, T]) Parent() *Walker[S, T] {
 	if w == nil {
 		return nil
 	}
-	newW, err := appendFilterForTask(w, parent[T], nil, 0)
+	newW, err := appendFilterForTask(w, "Parent", parent[T], nil, 0)
 	//if err := w.appendFilterForTask(parent[T], nil, 0); err != nil {
 	if err != nil {
-		tracer().Errorf(err.Error())
-		panic(err)
+		return w.setupFailed(err)
 	}
 	return newW
 }
@@ -234,18 +485,23 @@ func (w *Walker[S, T]) AncestorWith(predicate Predicate[T]) *Walker[S, T] {
 		return nil
 	}
 	if predicate == nil {
-		w.pipe.state.errors <- ErrInvalidFilter
-		return w
+		return w.setupFailed(ErrInvalidFilter)
 	}
-	newW, err := appendFilterForTask(w, ancestorWith[T], predicate, 0)
+	data := ancestorWithData[T]{predicate: predicate, guard: newDepthGuard(w, "AncestorWith")}
+	newW, err := appendFilterForTask(w, "AncestorWith", ancestorWith[T], data, 0)
 	//err := w.appendFilterForTask(ancestorWith[T], predicate, 0) // hook in this filter
 	if err != nil {
-		tracer().Errorf(err.Error())
-		panic(err)
+		return w.setupFailed(err)
 	}
 	return newW
 }
 
+// ancestorWithData is filter-local data for AncestorWith.
+type ancestorWithData[T comparable] struct {
+	predicate Predicate[T]
+	guard     depthGuard
+}
+
 // ancestorWith searches iteratively for an ancestor node matching a predicate.
 // node is at least the parent of the start node or nil.
 func ancestorWith[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
@@ -254,11 +510,14 @@ func ancestorWith[T comparable](node *Node[T], isBuffered bool, udata userdata,
 	if node == nil {
 		return nil
 	}
-	predicate := udata.filterlocal.(Predicate[T])
+	data := udata.filterlocal.(ancestorWithData[T])
 	anc := node.Parent()
 	serial := udata.serial
-	for anc != nil {
-		matchedNode, err := predicate(anc, node)
+	for depth := 1; anc != nil; depth++ {
+		if err := data.guard.check(depth); err != nil {
+			return err
+		}
+		matchedNode, err := data.predicate(anc, node)
 		if err != nil {
 			return err
 		}
@@ -280,50 +539,80 @@ func (w *Walker[S, T]) DescendentsWith(predicate Predicate[T]) *Walker[S, T] {
 		return nil
 	}
 	if predicate == nil {
-		w.pipe.state.errors <- ErrInvalidFilter
-		return w
+		return w.setupFailed(ErrInvalidFilter)
 	}
 	//err := w.appendFilterForTask(descendentsWith[T], predicate, 5) // need a helper queue
-	newW, err := appendFilterForTask(w, descendentsWith[T], predicate, 5)
-	if err != nil { // this should never happen here
-		tracer().Errorf(err.Error())
-		panic(err) // for debugging as long as this is unstable
+	data := descendentsWithData[T]{predicate: predicate, guard: newDepthGuard(w, "DescendentsWith")}
+	newW, err := appendFilterForTask(w, "DescendentsWith", descendentsWith[T], data, defaultBufferLength)
+	if err != nil {
+		return w.setupFailed(err)
 	}
 	return newW
 }
 
+// descendentsWithData is filter-local data for DescendentsWith.
+type descendentsWithData[T comparable] struct {
+	predicate Predicate[T]
+	guard     depthGuard
+}
+
 func descendentsWith[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
 	pushBuf func(*Node[T], interface{}, uint32)) error {
 	//
+	data := udata.filterlocal.(descendentsWithData[T])
 	if isBuffered {
-		predicate := udata.filterlocal.(Predicate[T])
-		matchedNode, err := predicate(node, nil) // currently no origin node availabe
+		depth, _ := udata.nodelocal.(int)
+		if err := data.guard.check(depth); err != nil {
+			return err
+		}
+		matchedNode, err := data.predicate(node, nil) // currently no origin node availabe
 		serial := udata.serial
 		if serial == 0 {
 			serial = node.Rank
 		}
-		tracer().Debugf("Predicate for node %s returned: %v, err=%v", node, matchedNode, err)
+		if tracingDebug() {
+			tracer().Debugf("Predicate for node %s returned: %v, err=%v", node, matchedNode, err)
+		}
 		if err != nil {
 			return err // do not descend further
 		}
 		if matchedNode != nil {
 			push(matchedNode, serial) // found one, put on output channel for next pipeline stage
 		}
-		revisitChildrenOf(node, serial, pushBuf)
+		revisitChildrenOf(node, serial, data.guard.childDepth(depth), false, pushBuf)
 	} else {
 		serial := udata.serial
-		revisitChildrenOf(node, serial, pushBuf)
+		revisitChildrenOf(node, serial, data.guard.childDepth(0), false, pushBuf)
 	}
 	return nil
 }
 
-func revisitChildrenOf[T comparable](node *Node[T], serial uint32, pushBuf func(*Node[T], interface{}, uint32)) {
-	chcnt := node.ChildCount()
-	for position := 0; position < chcnt; position++ {
-		if ch, ok := node.Child(position); ok {
-			pp := parentAndPosition[T]{node, position}
-			chSerial := node.calcChildSerial(serial, ch, position)
-			pushBuf(ch, pp, chSerial)
+// revisitChildrenOf puts the children of node onto the buffer queue of a filter.
+// If withPosition is set, every child carries its parent, position and depth as
+// node-local data. Otherwise node-local data is the depth of the children, or nil
+// if depth is 0, i.e. not tracked.
+func revisitChildrenOf[T comparable](node *Node[T], serial uint32, depth int, withPosition bool,
+	pushBuf func(*Node[T], interface{}, uint32)) {
+	//
+	children := node.Children(false) // snapshot, to avoid locking for every child
+	var ranks uint32                 // sum of ranks of children right of position
+	for _, ch := range children {
+		if ch != nil {
+			ranks += ch.Rank
+		}
+	}
+	for position, ch := range children {
+		if ch == nil {
+			continue
+		}
+		ranks -= ch.Rank
+		chSerial := serial - 1 - ranks // same as calcChildSerial, but in linear time
+		if withPosition {
+			pushBuf(ch, newParentAndPosition(node, position, depth), chSerial)
+		} else if depth > 0 {
+			pushBuf(ch, depth, chSerial)
+		} else {
+			pushBuf(ch, nil, chSerial)
 		}
 	}
 }
@@ -348,6 +637,84 @@ func (w *Walker[S, T]) AllDescendents() *Walker[S, T] {
 	return w.DescendentsWith(Whatever[T]())
 }
 
+// FirstMatch searches the current nodes and their descendents for a node
+// matching a predicate. As soon as a match has been found, the walk is
+// cancelled, i.e. outstanding work of all filter stages of the pipeline is
+// dropped. This is useful for queries which are known to match at most one
+// node, like finding an element by its ID.
+//
+// FirstMatch has to be the final link of the DSL expression chain. It returns
+// a promise for a single node, which is nil if no node matches. Nodes are
+// searched concurrently, thus if more than one node matches, it is unspecified
+// which one of them is returned.
+//
+// If w is nil, the promise will return nil and ErrEmptyTree.
+func (w *Walker[S, T]) FirstMatch(predicate Predicate[T]) func() (*Node[T], error) {
+	if w == nil {
+		return func() (*Node[T], error) {
+			return nil, ErrEmptyTree
+		}
+	}
+	if predicate == nil {
+		w.setupFailed(ErrInvalidFilter)
+		predicate = func(*Node[T], *Node[T]) (*Node[T], error) { return nil, nil }
+	}
+	data := firstMatchData[T]{
+		predicate: predicate,
+		cancelled: &w.pipe.state.cancelled,
+		guard:     newDepthGuard(w, "FirstMatch"),
+	}
+	newW, err := appendFilterForTask(w, "FirstMatch", firstMatch[T], data, defaultBufferLength)
+	if err != nil {
+		w.setupFailed(err)
+		return func() (*Node[T], error) {
+			return nil, err
+		}
+	}
+	promise := newW.Promise()
+	return func() (*Node[T], error) {
+		nodes, err := promise()
+		if len(nodes) == 0 {
+			return nil, err
+		}
+		return nodes[0], err
+	}
+}
+
+// firstMatchData is filter-local data for FirstMatch.
+type firstMatchData[T comparable] struct {
+	predicate Predicate[T]
+	cancelled *int32 // cancellation flag of the pipeline
+	guard     depthGuard
+}
+
+// firstMatch tests a node and, if it does not match, queues its children.
+// The first match found cancels the pipeline and is the only one emitted.
+func firstMatch[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
+	pushBuf func(*Node[T], interface{}, uint32)) error {
+	//
+	data := udata.filterlocal.(firstMatchData[T])
+	if atomic.LoadInt32(data.cancelled) != 0 {
+		return nil
+	}
+	depth, _ := udata.nodelocal.(int)
+	if err := data.guard.check(depth); err != nil {
+		return err
+	}
+	matchedNode, err := data.predicate(node, nil)
+	if err != nil {
+		return err // do not descend further
+	}
+	if matchedNode != nil {
+		if atomic.CompareAndSwapInt32(data.cancelled, 0, 1) {
+			push(matchedNode, udata.serial)
+		}
+		return nil
+	}
+	revisitChildrenOf(node, udata.serial, data.guard.childDepth(depth), false, pushBuf)
+	return nil
+}
+
 // Filter calls a client-provided function on each node of the selection.
 // The user function should return the input node if it is accepted and
 // nil otherwise.
@@ -359,14 +726,12 @@ func (w *Walker[S, T]) Filter(f Predicate[T]) *Walker[S, T] {
 		return nil
 	}
 	if f == nil {
-		w.pipe.state.errors <- ErrInvalidFilter
-		return w
+		return w.setupFailed(ErrInvalidFilter)
 	}
 	//err := w.appendFilterForTask(clientFilter[T], f, 0) // hook in this filter
-	newW, err := appendFilterForTask(w, clientFilter[T], f, 0)
+	newW, err := appendFilterForTask(w, "Filter", clientFilter[T], f, 0)
 	if err != nil {
-		tracer().Errorf(err.Error())
-		panic(err)
+		return w.setupFailed(err)
 	}
 	return newW
 }
@@ -378,12 +743,104 @@ func clientFilter[T comparable](node *Node[T], isBuffered bool, udata userdata,
 	userfunc := udata.filterlocal.(Predicate[T])
 	serial := udata.serial
 	n, err := userfunc(node, node)
-	if n != nil && err != nil {
+	if n != nil && err == nil {
 		push(n, serial) // forward filtered node to next pipeline stage
 	}
 	return err
 }
 
+// --- Attributes ------------------------------------------------------------
+
+// Attributes is an interface for node payloads which carry key-value attributes.
+// Payload types may implement it to be usable with walker filters AttributeIs
+// and SetAttribute. An example would be styled nodes, wrapping the attributes of
+// HTML nodes.
+type Attributes interface {
+	Attribute(key string) (string, bool) // get an attribute value, if present
+	SetAttribute(key, value string)      // set an attribute value
+}
+
+// ErrNoAttributes is flagged if a filter operates on attributes of a node
+// whose payload does not implement interface Attributes.
+var ErrNoAttributes = errors.New("node payload does not carry attributes")
+
+// attributesOf returns the attributes of a node's payload, if it implements
+// interface Attributes, or nil otherwise.
+func attributesOf[T comparable](node *Node[T]) Attributes {
+	if attrs, ok := interface{}(node.LoadPayload()).(Attributes); ok {
+		return attrs
+	}
+	return nil
+}
+
+// attributeFilterData is filter-local data for attribute filters.
+type attributeFilterData struct {
+	key, value string
+}
+
+// AttributeIs filters for nodes with a given attribute value. Nodes with
+// a payload which does not implement interface Attributes are not selected.
+//
+// If w is nil, AttributeIs will return nil.
+func (w *Walker[S, T]) AttributeIs(key string, value string) *Walker[S, T] {
+	if w == nil {
+		return nil
+	}
+	if key == "" {
+		return w.setupFailed(ErrInvalidFilter)
+	}
+	newW, err := appendFilterForTask(w, "AttributeIs", attributeIs[T], attributeFilterData{key, value}, 0)
+	if err != nil {
+		return w.setupFailed(err)
+	}
+	return newW
+}
+
+func attributeIs[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
+	pushBuf func(*Node[T], interface{}, uint32)) error {
+	//
+	data := udata.filterlocal.(attributeFilterData)
+	if attrs := attributesOf(node); attrs != nil {
+		if v, ok := attrs.Attribute(data.key); ok && v == data.value {
+			push(node, udata.serial) // forward node to next pipeline stage
+		}
+	}
+	return nil
+}
+
+// SetAttribute sets an attribute value for all nodes of the selection.
+// Nodes are forwarded to the next pipeline stage.
+// If the payload of a node does not implement interface Attributes,
+// ErrNoAttributes is flagged.
+//
+// If w is nil, SetAttribute will return nil.
+func (w *Walker[S, T]) SetAttribute(key string, value string) *Walker[S, T] {
+	if w == nil {
+		return nil
+	}
+	if key == "" {
+		return w.setupFailed(ErrInvalidFilter)
+	}
+	newW, err := appendFilterForTask(w, "SetAttribute", setAttribute[T], attributeFilterData{key, value}, 0)
+	if err != nil {
+		return w.setupFailed(err)
+	}
+	return newW
+}
+
+func setAttribute[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
+	pushBuf func(*Node[T], interface{}, uint32)) error {
+	//
+	attrs := attributesOf(node)
+	if attrs == nil {
+		return ErrNoAttributes
+	}
+	data := udata.filterlocal.(attributeFilterData)
+	attrs.SetAttribute(data.key, data.value)
+	push(node, udata.serial) // forward node to next pipeline stage
+	return nil
+}
+
 // Action is a function type to operate on tree nodes.
 // Resulting nodes will be pushed to the next pipeline stage, if
 // no error occured.
@@ -402,48 +859,77 @@ func (w *Walker[S, T]) TopDown(action Action[T]) *Walker[S, T] {
 		return nil
 	}
 	if action == nil {
-		w.pipe.state.errors <- ErrInvalidFilter
-		return w
+		return w.setupFailed(ErrInvalidFilter)
 	}
 	//err := w.appendFilterForTask(topDown[T], action, 5) // need a helper queue
-	newW, err := appendFilterForTask(w, topDown[T], action, 5)
+	data := topDownFilterData[T]{action: action, guard: newDepthGuard(w, "TopDown")}
+	newW, err := appendFilterForTask(w, "TopDown", topDown[T], data, defaultBufferLength)
 	if err != nil {
-		tracer().Errorf(err.Error())
-		panic(err) // TODO for debugging purposes until more mature
+		return w.setupFailed(err)
 	}
 	return newW
 }
 
+// topDownFilterData is filter-local data for TopDown.
+type topDownFilterData[T comparable] struct {
+	action Action[T]
+	guard  depthGuard
+}
+
 // ad-hoc container
 type parentAndPosition[T comparable] struct {
 	parent   *Node[T]
 	position int
+	depth    int // depth of the node, relative to the start node(s)
+}
+
+// Containers for parent and position are allocated for every node visited
+// by TopDown, therefore we recycle them.
+var parentAndPositionPool sync.Pool
+
+func newParentAndPosition[T comparable](parent *Node[T], position int, depth int) *parentAndPosition[T] {
+	pp, ok := parentAndPositionPool.Get().(*parentAndPosition[T])
+	if !ok { // pool is empty or holds containers for a different node type
+		pp = &parentAndPosition[T]{}
+	}
+	pp.parent, pp.position, pp.depth = parent, position, depth
+	return pp
+}
+
+func (pp *parentAndPosition[T]) release() {
+	pp.parent = nil
+	parentAndPositionPool.Put(pp)
 }
 
 func topDown[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
 	pushBuf func(*Node[T], interface{}, uint32)) error {
 	//
 	if isBuffered { // node was received from buffer queue
-		action := udata.filterlocal.(Action[T])
+		data := udata.filterlocal.(topDownFilterData[T])
 		var parent *Node[T]
-		var position int
-		if udata.nodelocal != nil {
-			parent = udata.nodelocal.(parentAndPosition[T]).parent
-			position = udata.nodelocal.(parentAndPosition[T]).position
+		var position, depth int
+		if pp, ok := udata.nodelocal.(*parentAndPosition[T]); ok {
+			parent, position, depth = pp.parent, pp.position, pp.depth
+			pp.release()
+		}
+		if err := data.guard.check(depth); err != nil {
+			return err
 		}
 		serial := udata.serial
 		if serial == 0 {
 			serial = node.Rank
 		}
-		result, err := action(node, parent, position)
-		tracer().Debugf("Action for node %s returned: %v, err=%v", node, result, err)
+		result, err := data.action(node, parent, position)
+		if tracingDebug() {
+			tracer().Debugf("Action for node %s returned: %v, err=%v", node, result, err)
+		}
 		if err != nil {
 			return err // do not descend further
 		}
 		if result != nil {
 			push(result, serial) // result -> next pipeline stage
 		}
-		revisitChildrenOf(node, serial, pushBuf) // hand over node as parent
+		revisitChildrenOf(node, serial, depth+1, true, pushBuf) // hand over node as parent
 	} else {
 		serial := udata.serial
 		pushBuf(node, nil, serial) // simply move incoming nodes over to buffer queue
@@ -451,6 +937,234 @@ func topDown[T comparable](node *Node[T], isBuffered bool, udata userdata, push
 	return nil
 }
 
+type topDownDFFilterData[T comparable] struct {
+	action Action[T]
+	guard  depthGuard
+	mx     sync.Mutex // serializes traversals of subtrees
+	serial uint32     // serial number of the last result, protected by mx
+}
+
+// TopDownDF traverses a tree starting at (and including) the root node, in
+// strict depth-first pre-order. Other than with TopDown, results are guaranteed
+// to appear in document order: parents precede their children, and siblings
+// appear in the order of their index. The order is kept by the result of the
+// Promise, as long as subsequent pipeline stages do not re-order nodes.
+//
+// To guarantee the order, the nodes of a subtree are processed sequentially.
+// If TopDownDF receives more than one node from a previous pipeline stage
+// (e.g., from DescendentsWith), subtrees are processed one at a time, and the
+// results of each subtree are kept together. The order is guaranteed within
+// each subtree only; subtrees may be processed in any order.
+//
+// If the action function returns an error for a node,
+// descending the branch below this node is aborted.
+//
+// If w is nil, TopDownDF will return nil.
+func (w *Walker[S, T]) TopDownDF(action Action[T]) *Walker[S, T] {
+	if w == nil {
+		return nil
+	}
+	if action == nil {
+		return w.setupFailed(ErrInvalidFilter)
+	}
+	filterdata := &topDownDFFilterData[T]{action: action, guard: newDepthGuard(w, "TopDownDF")}
+	w.pipe.state.mx.Lock()
+	ordered := w.pipe.state.ordered
+	w.pipe.state.ordered = false // serials of previous stages end here (see pushDropped)
+	w.pipe.state.mx.Unlock()
+	newW, err := appendFilterForTask(w, "TopDownDF", topDownDF[T], filterdata, 0)
+	w.pipe.state.mx.Lock()
+	w.pipe.state.ordered = ordered || err == nil // only after the filter has been accepted
+	w.pipe.state.mx.Unlock()
+	if err != nil {
+		return w.setupFailed(err)
+	}
+	return newW
+}
+
+func topDownDF[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
+	pushBuf func(*Node[T], interface{}, uint32)) error {
+	//
+	data := udata.filterlocal.(*topDownDFFilterData[T])
+	data.mx.Lock()
+	defer data.mx.Unlock()
+	var parent *Node[T]
+	var position int
+	if parent = node.Parent(); parent != nil {
+		position = parent.IndexOfChild(node)
+	}
+	return data.visit(node, parent, position, 0, push)
+}
+
+// visit calls the action for node and recursively for its children.
+// Returns the last error an action returned.
+func (data *topDownDFFilterData[T]) visit(node, parent *Node[T], position int, depth int,
+	push func(*Node[T], uint32)) error {
+	//
+	if err := data.guard.check(depth); err != nil {
+		return err
+	}
+	result, err := data.action(node, parent, position)
+	if tracingDebug() {
+		tracer().Debugf("Action for node %s returned: %v, err=%v", node, result, err)
+	}
+	if err != nil {
+		return err // do not descend further
+	}
+	if result != nil {
+		data.serial++
+		push(result, data.serial) // result -> next pipeline stage
+	}
+	var lasterr error
+	for i, ch := range node.Children(false) {
+		if ch == nil {
+			continue
+		}
+		if err := data.visit(ch, node, i, depth+1, push); err != nil {
+			if _, ok := err.(*MaxDepthError); ok {
+				return err // walk has been cancelled
+			}
+			lasterr = err
+		}
+	}
+	return lasterr
+}
+
+// ErrSkipChildren may be returned by a Visitor to signal that the children of
+// the current node should not be visited. It is not reported as an error.
+var ErrSkipChildren = errors.New("skip children of node")
+
+// ErrStopWalk may be returned by a Visitor to signal that the traversal should
+// stop. Nodes already queued for visiting will be dropped. It is not reported as
+// an error.
+//
+// As traversal is performed concurrently, a small number of nodes in other
+// branches of the tree may still be visited after ErrStopWalk has been returned.
+var ErrStopWalk = errors.New("stop walking the tree")
+
+// VisitContext holds information about the position of a node within the
+// (sub-)tree a Walker is traversing. Contexts of nodes share their ancestors'
+// contexts, so the ancestry of a node is never re-computed from the tree.
+type VisitContext[T comparable] struct {
+	up       *VisitContext[T] // context of parent node
+	node     *Node[T]         // node this context is for
+	Position int              // position of node within its parent's children
+	Depth    int              // depth of node, relative to the start node(s) of the traversal
+}
+
+// Parent returns the parent node of the node visited, or nil for a start node.
+func (ctx *VisitContext[T]) Parent() *Node[T] {
+	if ctx == nil || ctx.up == nil {
+		return nil
+	}
+	return ctx.up.node
+}
+
+// Ancestors returns the path of ancestors of the node visited, starting with
+// the start node of the traversal and ending with the node's parent.
+func (ctx *VisitContext[T]) Ancestors() []*Node[T] {
+	if ctx == nil || ctx.Depth == 0 {
+		return nil
+	}
+	path := make([]*Node[T], ctx.Depth)
+	for c := ctx.up; c != nil; c = c.up {
+		path[c.Depth] = c.node
+	}
+	return path
+}
+
+// Visitor is a function type to operate on tree nodes, receiving a context for
+// each node. Resulting nodes will be pushed to the next pipeline stage, if
+// no error occured. A visitor may return ErrSkipChildren or ErrStopWalk to
+// control the traversal.
+type Visitor[T comparable] func(n *Node[T], ctx *VisitContext[T]) (*Node[T], error)
+
+type visitorFilterData[T comparable] struct {
+	visitor Visitor[T]
+	guard   depthGuard
+	stopped int32 // set atomically if a visitor returned ErrStopWalk
+}
+
+// TopDownVisit traverses a tree starting at (and including) the root node,
+// calling a visitor for each node. It is a variant of TopDown, where
+// the visitor receives a context with the depth and the ancestors of the node.
+// The traversal guarantees that parents are always processed before
+// their children.
+//
+// If the visitor function returns an error for a node,
+// descending the branch below this node is aborted.
+//
+// If w is nil, TopDownVisit will return nil.
+func (w *Walker[S, T]) TopDownVisit(visitor Visitor[T]) *Walker[S, T] {
+	if w == nil {
+		return nil
+	}
+	if visitor == nil {
+		return w.setupFailed(ErrInvalidFilter)
+	}
+	filterdata := &visitorFilterData[T]{visitor: visitor, guard: newDepthGuard(w, "TopDownVisit")}
+	newW, err := appendFilterForTask(w, "TopDownVisit", topDownVisit[T], filterdata, defaultBufferLength)
+	if err != nil {
+		return w.setupFailed(err)
+	}
+	return newW
+}
+
+func topDownVisit[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
+	pushBuf func(*Node[T], interface{}, uint32)) error {
+	//
+	if !isBuffered {
+		pushBuf(node, nil, udata.serial) // simply move incoming nodes over to buffer queue
+		return nil
+	}
+	data := udata.filterlocal.(*visitorFilterData[T])
+	if atomic.LoadInt32(&data.stopped) != 0 {
+		return nil // drop node
+	}
+	ctx, _ := udata.nodelocal.(*VisitContext[T])
+	if ctx == nil {
+		ctx = &VisitContext[T]{node: node}
+	}
+	if err := data.guard.check(ctx.Depth); err != nil {
+		return err
+	}
+	serial := udata.serial
+	if serial == 0 {
+		serial = node.Rank
+	}
+	result, err := data.visitor(node, ctx)
+	if tracingDebug() {
+		tracer().Debugf("Visitor for node %s returned: %v, err=%v", node, result, err)
+	}
+	switch err {
+	case nil:
+	case ErrSkipChildren:
+		if result != nil {
+			push(result, serial)
+		}
+		return nil
+	case ErrStopWalk:
+		atomic.StoreInt32(&data.stopped, 1)
+		if result != nil {
+			push(result, serial)
+		}
+		return nil
+	default:
+		return err // do not descend further
+	}
+	if result != nil {
+		push(result, serial) // result -> next pipeline stage
+	}
+	chcnt := node.ChildCount()
+	for position := 0; position < chcnt; position++ {
+		if ch, ok := node.Child(position); ok {
+			chctx := &VisitContext[T]{up: ctx, node: ch, Position: position, Depth: ctx.Depth + 1}
+			pushBuf(ch, chctx, node.calcChildSerial(serial, ch, position))
+		}
+	}
+	return nil
+}
+
 type bottomUpFilterData[T comparable] struct {
 	action       Action[T]
 	childrenDict *rankMap[T]
@@ -470,18 +1184,16 @@ func (w *Walker[S, T]) BottomUp(action Action[T]) *Walker[S, T] {
 		return nil
 	}
 	if action == nil {
-		w.pipe.state.errors <- ErrInvalidFilter
-		return w
+		return w.setupFailed(ErrInvalidFilter)
 	}
 	filterdata := &bottomUpFilterData[T]{
 		action:       action,
 		childrenDict: newRankMap[T](),
 	}
 	//err := w.appendFilterForTask(bottomUp[T], filterdata, 5) // need a helper queue
-	newW, err := appendFilterForTask(w, bottomUp[T], filterdata, 5)
+	newW, err := appendFilterForTask(w, "BottomUp", bottomUp[T], filterdata, defaultBufferLength)
 	if err != nil {
-		tracer().Errorf(err.Error())
-		panic(err) // TODO for debugging purposes until more mature
+		return w.setupFailed(err)
 	}
 	return newW
 }
@@ -489,12 +1201,12 @@ func (w *Walker[S, T]) BottomUp(action Action[T]) *Walker[S, T] {
 func bottomUp[T comparable](node *Node[T], isBuffered bool, udata userdata, push func(*Node[T], uint32),
 	pushBuf func(*Node[T], interface{}, uint32)) error {
 	//
-	if node.ChildCount() > 0 { // check if all children have been processed
+	if chcnt := node.kids().occupied(); chcnt > 0 { // check if all children have been processed
 		var bUpFilterData *bottomUpFilterData[T]
 		bUpFilterData = udata.filterlocal.(*bottomUpFilterData[T])
 		tracer().Debugf("bottom up filter data = %v", bUpFilterData)
 		childCounter := bUpFilterData.childrenDict
-		if int(childCounter.Get(node)) < node.ChildCount() {
+		if int(childCounter.Get(node)) < chcnt { // empty slots are never processed
 			return nil
 		} // else drop this node until last child processed
 	}
@@ -1,8 +1,11 @@
 package tree
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -365,8 +368,974 @@ func TestSerial1(t *testing.T) {
 	checkRuntime(t, n)
 }
 
+func TestTopDownVisit(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	//
+	n := checkRuntime(t, -1)
+	// Build a tree:
+	//                 (root:1)
+	//          (n2:2)----+----(n4:4)
+	//  (n3:3)----+              +----(n5:5)
+	//
+	root, n2, n3, n4, n5 := NewNode(1), NewNode(2), NewNode(3), NewNode(4), NewNode(5)
+	root.AddChild(n2).AddChild(n4)
+	n2.AddChild(n3)
+	n4.AddChild(n5)
+	var mx sync.Mutex
+	depths := make(map[int]int)
+	visitor := func(n *Node[int], ctx *VisitContext[int]) (*Node[int], error) {
+		mx.Lock()
+		defer mx.Unlock()
+		depths[n.Payload] = ctx.Depth
+		if n.Payload == 3 {
+			anc := ctx.Ancestors()
+			if len(anc) != 2 || anc[0] != root || anc[1] != n2 || ctx.Parent() != n2 {
+				t.Errorf("expected ancestors of (3) to be [(1) (2)], are %v", anc)
+			}
+		}
+		if n.Payload == 4 {
+			return n, ErrSkipChildren
+		}
+		return n, nil
+	}
+	nodes, err := NewWalker(root).TopDownVisit(visitor).Promise()()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(nodes) != 4 {
+		t.Errorf("expected 4 nodes to be visited, have %d", len(nodes))
+	}
+	if depths[1] != 0 || depths[2] != 1 || depths[3] != 2 || depths[4] != 1 {
+		t.Errorf("unexpected depths of nodes: %v", depths)
+	}
+	if _, ok := depths[5]; ok {
+		t.Errorf("expected children of (4) to be skipped")
+	}
+	checkRuntime(t, n)
+}
+
+func TestTopDownVisitStop(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	//
+	n := checkRuntime(t, -1)
+	// Build a chain of nodes (0)→(1)→…→(9); stopping at (3) must leave the
+	// nodes below unvisited, as they are queued only after their parents.
+	root := NewNode(0)
+	for p, i := root, 1; i < 10; i++ {
+		ch := NewNode(i)
+		p.AddChild(ch)
+		p = ch
+	}
+	var visited int32
+	visitor := func(n *Node[int], ctx *VisitContext[int]) (*Node[int], error) {
+		atomic.AddInt32(&visited, 1)
+		if n.Payload == 3 {
+			return n, ErrStopWalk
+		}
+		return n, nil
+	}
+	nodes, err := NewWalker(root).TopDownVisit(visitor).Promise()()
+	if err != nil {
+		t.Errorf("expected stopping a walk not to be reported as an error, is %v", err)
+	}
+	if visited != 4 || len(nodes) != 4 {
+		t.Errorf("expected walk to stop after 4 nodes, visited %d, result has %d", visited, len(nodes))
+	}
+	checkRuntime(t, n)
+}
+
+func TestAttributes(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	//
+	n := checkRuntime(t, -1)
+	root := NewNode(&attrPayload{attrs: map[string]string{"class": "chapter"}})
+	para1 := NewNode(&attrPayload{attrs: map[string]string{"class": "para"}})
+	para2 := NewNode(&attrPayload{attrs: map[string]string{"class": "para"}})
+	root.AddChild(para1).AddChild(para2)
+	nodes, err := NewWalker(root).AllDescendents().AttributeIs("class", "para").
+		SetAttribute("lang", "en").Promise()()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(nodes) != 2 {
+		t.Errorf("expected 2 paragraphs to be selected, have %d", len(nodes))
+	}
+	for _, p := range []*Node[*attrPayload]{para1, para2} {
+		if v, ok := p.Payload.Attribute("lang"); !ok || v != "en" {
+			t.Errorf("expected attribute lang=en to be set, is %q", v)
+		}
+	}
+	if _, ok := root.Payload.Attribute("lang"); ok {
+		t.Errorf("expected root not to be selected")
+	}
+	_, err = NewWalker(NewNode(1)).SetAttribute("lang", "en").Promise()()
+	if err != ErrNoAttributes {
+		t.Errorf("expected ErrNoAttributes for int payload, have %v", err)
+	}
+	checkRuntime(t, n)
+}
+
+func TestZip(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	//
+	// a:  1 → (2 → (4, 5), 3)
+	// b:  1 → (2 → (5, 6), 7, 3)
+	a, b := NewNode(1), NewNode(1)
+	a2, b2 := NewNode(2), NewNode(2)
+	a.AddChild(a2).AddChild(NewNode(3))
+	a2.AddChild(NewNode(4)).AddChild(NewNode(5))
+	b.AddChild(b2).AddChild(NewNode(7)).AddChild(NewNode(3))
+	b2.AddChild(NewNode(5)).AddChild(NewNode(6))
+	zipped := Zip(a, b, nil)
+	expected := []struct {
+		op  ZipOp
+		val int
+	}{
+		{ZipPair, 1}, {ZipPair, 2}, {ZipDeletion, 4}, {ZipPair, 5}, {ZipInsertion, 6},
+		{ZipInsertion, 7}, {ZipPair, 3},
+	}
+	if len(zipped) != len(expected) {
+		t.Fatalf("expected %d entries, have %d: %v", len(expected), len(zipped), zipped)
+	}
+	for i, z := range zipped {
+		n := z.A
+		if z.Op == ZipInsertion {
+			n = z.B
+		}
+		if z.Op != expected[i].op || n.Payload != expected[i].val {
+			t.Errorf("expected entry #%d to be %s of %d, is %s of %d", i, expected[i].op,
+				expected[i].val, z.Op, n.Payload)
+		}
+		if z.Op == ZipPair && z.A.Payload != z.B.Payload {
+			t.Errorf("expected entry #%d to pair equal nodes, is %v/%v", i, z.A, z.B)
+		}
+	}
+	if z := zipped[5]; z.Position != 1 {
+		t.Errorf("expected insertion of 7 at position 1, is %d", z.Position)
+	}
+	zipped = Zip(a, NewNode(9), nil)
+	if len(zipped) != 2 || zipped[0].Op != ZipDeletion || zipped[1].Op != ZipInsertion {
+		t.Errorf("expected roots not matching to result in deletion + insertion, have %v", zipped)
+	}
+	if zipped = Zip(nil, b, nil); len(zipped) != 1 || zipped[0].Op != ZipInsertion {
+		t.Errorf("expected nil tree a to result in a single insertion, have %v", zipped)
+	}
+}
+
+func TestHashSubtree(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	//
+	calls := 0
+	hashInt := func(n int) uint64 {
+		calls++
+		return uint64(n)
+	}
+	a, b := buildBenchTree(100, 3), buildBenchTree(100, 3)
+	ha, hb := a.HashSubtree(hashInt), b.HashSubtree(hashInt)
+	if ha != hb {
+		t.Errorf("expected equal trees to have equal hashes, have %x and %x", ha, hb)
+	}
+	calls = 0
+	if a.HashSubtree(hashInt) != ha || calls != 0 {
+		t.Errorf("expected hash to be cached, hash function has been called %d times", calls)
+	}
+	leaf := a
+	for leaf.ChildCount() > 0 {
+		leaf, _ = leaf.Child(0)
+	}
+	leaf.AddChild(NewNode(999))
+	if h := a.HashSubtree(hashInt); h == ha {
+		t.Errorf("expected adding a leaf to change the hash of the root")
+	}
+	if calls == 0 || calls > 10 {
+		t.Errorf("expected hashes to be re-computed for the path to the new leaf only, have %d calls", calls)
+	}
+	ch, _ := leaf.Child(0)
+	ch.Isolate()
+	if h := a.HashSubtree(hashInt); h == ha {
+		t.Errorf("expected hash to reflect the empty child position left by Isolate()")
+	}
+	ch, _ = b.Child(1)
+	ch.Payload = 77
+	ch.InvalidateHash()
+	if h := b.HashSubtree(hashInt); h == hb {
+		t.Errorf("expected changed payload to change the hash of the root")
+	}
+}
+
+func TestTopDownDF(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	//
+	n := checkRuntime(t, -1)
+	// Build a tree with payloads in pre-order:
+	//                 (root:0)
+	//          (n1:1)----+----(n4:4)
+	//  (n2:2)----+----(n3:3)  +----(n5:5)----(n6:6)
+	//
+	nodes := make([]*Node[int], 7)
+	for i := range nodes {
+		nodes[i] = NewNode(i)
+	}
+	nodes[0].AddChild(nodes[1]).AddChild(nodes[4])
+	nodes[1].AddChild(nodes[2]).AddChild(nodes[3])
+	nodes[4].AddChild(nodes[5])
+	nodes[5].AddChild(nodes[6])
+	var visited []int
+	myaction := func(n *Node[int], parent *Node[int], position int) (*Node[int], error) {
+		if n != nodes[0] && parent.Payload >= n.Payload {
+			t.Errorf("parent of node %d is %v", n.Payload, parent)
+		}
+		visited = append(visited, n.Payload)
+		return n, nil
+	}
+	result, err := NewWalker(nodes[0]).TopDownDF(myaction).Promise()()
+	if err != nil {
+		t.Error(err)
+	}
+	if fmt.Sprint(visited) != "[0 1 2 3 4 5 6]" {
+		t.Errorf("expected nodes to be visited in pre-order, order is %v", visited)
+	}
+	var payloads []int
+	for _, r := range result {
+		payloads = append(payloads, r.Payload)
+	}
+	if fmt.Sprint(payloads) != "[0 1 2 3 4 5 6]" {
+		t.Errorf("expected result in pre-order, is %v", payloads)
+	}
+	skip4 := func(n *Node[int], parent *Node[int], position int) (*Node[int], error) {
+		if n.Payload == 4 {
+			return nil, errors.New("skip")
+		}
+		return n, nil
+	}
+	result, err = NewWalker(nodes[0]).TopDownDF(skip4).Promise()()
+	if err == nil || len(result) != 4 {
+		t.Errorf("expected branch below node 4 to be skipped, result is %v, err = %v", result, err)
+	}
+	w := NewWalker(nodes[0]).AllDescendents()
+	promise := w.Promise()
+	w.TopDownDF(myaction) // rejected, as the walk is already promised
+	w.pipe.state.mx.RLock()
+	if w.pipe.state.ordered {
+		t.Errorf("expected rejected TopDownDF not to flag the walk as ordered")
+	}
+	w.pipe.state.mx.RUnlock()
+	promise()
+	checkRuntime(t, n)
+}
+
+func TestWalkerMetrics(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	n := checkRuntime(t, -1)
+	node1, node2, node3, node4 := NewNode(1), NewNode(2), NewNode(3), NewNode(4)
+	node1.AddChild(node2)
+	node2.AddChild(node3)
+	node1.AddChild(node4)
+	var mx sync.Mutex
+	started, done := 0, 0
+	var final *Metrics
+	obs := &Observer{
+		StartTask: func(stage int, name string, serial uint32) func(error) {
+			mx.Lock()
+			defer mx.Unlock()
+			started++
+			return func(error) {
+				mx.Lock()
+				defer mx.Unlock()
+				done++
+			}
+		},
+		Finished: func(m Metrics) {
+			final = &m
+		},
+	}
+	w := NewWalker(node1).Instrument(obs).AllDescendents().Parent()
+	nodes, err := w.Promise()()
+	if err != nil {
+		t.Error(err)
+	}
+	if len(nodes) != 2 || !checkNodes[int](nodes, 1, 2) {
+		t.Errorf("expected parents (1) and (2), nodes = %v", nodes)
+	}
+	m := w.Metrics()
+	if m == nil || len(m.Stages) != 2 {
+		t.Fatalf("expected metrics for 2 stages, have %v", m)
+	}
+	t.Logf("%s", m)
+	if m.Stages[0].Name != "DescendentsWith" || m.Stages[1].Name != "Parent" {
+		t.Errorf("expected stages to be named after walker operations, are %q and %q",
+			m.Stages[0].Name, m.Stages[1].Name)
+	}
+	if m.Stages[0].Emitted != 3 || m.Stages[1].Processed != 3 || m.Stages[1].Emitted != 3 {
+		t.Errorf("expected 3 nodes to flow from DescendentsWith through Parent")
+	}
+	processed := int(m.Stages[0].Processed + m.Stages[1].Processed)
+	if started != processed || done != processed {
+		t.Errorf("expected hooks to be called for %d tasks, called %d|%d times", processed, started, done)
+	}
+	if final == nil || final.Stages[1].Processed != 3 {
+		t.Errorf("expected Finished hook to be called with final metrics")
+	}
+	if m.Elapsed <= 0 || m.Stages[0].Busy <= 0 {
+		t.Errorf("expected wall times to be measured")
+	}
+	if NewWalker(node1).Metrics() != nil {
+		t.Errorf("expected walker without instrumentation to have no metrics")
+	}
+	late := NewWalker(node1).AllDescendents().Instrument(nil)
+	if _, err := late.Promise()(); err != ErrAlreadyProcessing {
+		t.Errorf("expected late instrumentation to be reported, err = %v", err)
+	}
+	checkRuntime(t, n)
+}
+
+func TestWalkerVerbs(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	n := checkRuntime(t, -1)
+	node1, node2, node3, node4 := NewNode(1), NewNode(2), NewNode(3), NewNode(4)
+	node1.AddChild(node2) // tree: (1)-->(2)-->(3)
+	node2.AddChild(node3) //          \->(4)
+	node1.AddChild(node4)
+	isEven := func(test, node *Node[int]) (*Node[int], error) {
+		if test.Payload%2 == 0 {
+			return test, nil
+		}
+		return nil, nil
+	}
+	identity := func(n, parent *Node[int], position int) (*Node[int], error) {
+		return n, nil
+	}
+	for _, test := range []struct {
+		verb     string
+		walk     func() *Walker[int, int]
+		expected []int
+	}{
+		{"Parent", func() *Walker[int, int] { return NewWalker(node3).Parent() }, []int{2}},
+		{"AncestorWith", func() *Walker[int, int] { return NewWalker(node3).AncestorWith(isEven) }, []int{2}},
+		{"DescendentsWith", func() *Walker[int, int] { return NewWalker(node1).DescendentsWith(NodeIsLeaf[int]()) }, []int{3, 4}},
+		{"AllDescendents", func() *Walker[int, int] { return NewWalker(node1).AllDescendents() }, []int{2, 3, 4}},
+		{"Filter", func() *Walker[int, int] { return NewWalker(node1).AllDescendents().Filter(isEven) }, []int{2, 4}},
+		{"TopDown", func() *Walker[int, int] { return NewWalker(node1).TopDown(identity) }, []int{1, 2, 3, 4}},
+		{"TopDownDF", func() *Walker[int, int] { return NewWalker(node1).TopDownDF(identity) }, []int{1, 2, 3, 4}},
+	} {
+		nodes, err := test.walk().Promise()()
+		if err != nil {
+			t.Errorf("%s: %v", test.verb, err)
+		}
+		if len(nodes) != len(test.expected) || !checkNodes[int](nodes, test.expected...) {
+			t.Errorf("%s: expected nodes %v, have %v", test.verb, test.expected, nodes)
+		}
+	}
+	checkRuntime(t, n)
+}
+
+func TestWalkerUserData(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	n := checkRuntime(t, -1)
+	node1, node2, node3 := NewNode(1), NewNode(2), NewNode(3)
+	node1.AddChild(node2)
+	node1.AddChild(node3)
+	greaterThan := func(test, node *Node[int], udata interface{}) (*Node[int], error) {
+		if test.Payload > udata.(int) {
+			return test, nil
+		}
+		return nil, nil
+	}
+	for _, limit := range []int{1, 2} {
+		w := NewWalker(node1).WithUserData(limit)
+		if w.UserData() != limit {
+			t.Errorf("expected walker to carry user data %d, has %v", limit, w.UserData())
+		}
+		nodes, err := w.DescendentsWith(w.Bind(greaterThan)).Promise()()
+		if err != nil {
+			t.Error(err)
+		}
+		if len(nodes) != 3-limit {
+			t.Errorf("expected %d nodes greater than %d, have %v", 3-limit, limit, nodes)
+		}
+	}
+	late := NewWalker(node1).AllDescendents().WithUserData(0)
+	if _, err := late.Promise()(); err != ErrAlreadyProcessing {
+		t.Errorf("expected late user data to be reported, err = %v", err)
+	}
+	checkRuntime(t, n)
+}
+
+func TestPayloadUpdates(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	root := NewNode(0)
+	node := NewNode(1)
+	root.AddChild(node)
+	hashInt := func(n int) uint64 { return uint64(n) }
+	h := root.HashSubtree(hashInt)
+	if node.SwapPayload(7, 8) {
+		t.Errorf("expected swap to fail for non-matching old payload")
+	}
+	if !node.SwapPayload(1, 2) || node.LoadPayload() != 2 {
+		t.Errorf("expected payload to be swapped to 2, is %d", node.LoadPayload())
+	}
+	if root.HashSubtree(hashInt) == h {
+		t.Errorf("expected swapped payload to invalidate hash of root")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				node.UpdatePayload(func(p int) int { return p + 1 })
+			}
+		}()
+	}
+	wg.Wait()
+	if node.LoadPayload() != 1002 {
+		t.Errorf("expected 1000 concurrent updates to result in payload 1002, is %d", node.LoadPayload())
+	}
+}
+
+func TestFirstMatch(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	n := checkRuntime(t, -1)
+	const size = 20000
+	root := buildBenchTree(size, 4)
+	var tested int32
+	payloadIs := func(x int) Predicate[int] {
+		return func(test *Node[int], node *Node[int]) (*Node[int], error) {
+			atomic.AddInt32(&tested, 1)
+			if test.Payload == x {
+				return test, nil
+			}
+			return nil, nil
+		}
+	}
+	node, err := NewWalker(root).FirstMatch(payloadIs(5))()
+	if err != nil || node == nil || node.Payload != 5 {
+		t.Fatalf("expected to find node 5, have %v, err = %v", node, err)
+	}
+	if cnt := atomic.LoadInt32(&tested); cnt >= size {
+		t.Errorf("expected walk to stop early, has tested %d nodes", cnt)
+	}
+	if node, _ = NewWalker(root).FirstMatch(payloadIs(0))(); node != root {
+		t.Errorf("expected start node to be tested, have %v", node)
+	}
+	if node, err = NewWalker(root).FirstMatch(payloadIs(-1))(); node != nil || err != nil {
+		t.Errorf("expected no match, have %v, err = %v", node, err)
+	}
+	var w *Walker[int, int]
+	if _, err = w.FirstMatch(payloadIs(1))(); err != ErrEmptyTree {
+		t.Errorf("expected nil walker to report empty tree, err = %v", err)
+	}
+	checkRuntime(t, n)
+}
+
+func TestCycleRefused(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	root, a, b := NewNode(0), NewNode(1), NewNode(2)
+	root.AddChild(a)
+	a.AddChild(b)
+	for _, anc := range []*Node[int]{root, a, b} {
+		if err := b.CheckChild(anc); err != ErrCycle {
+			t.Errorf("expected ErrCycle for inserting %v below b, have %v", anc, err)
+		}
+	}
+	if err := b.CheckChild(NewNode(3)); err != nil {
+		t.Errorf("expected fresh node to be accepted as a child, have %v", err)
+	}
+	b.AddChild(root)
+	b.InsertChildAt(0, a)
+	b.SetChildAt(1, b)
+	if b.ChildCount() != 0 {
+		t.Errorf("expected insertion of ancestors to be refused, b has %d children", b.ChildCount())
+	}
+	if root.Parent() != nil || a.Parent() != root {
+		t.Errorf("expected parents to be unchanged")
+	}
+	nodes, err := NewWalker(root).AllDescendents().Promise()()
+	if err != nil || len(nodes) != 2 {
+		t.Errorf("expected 2 descendents of root, have %d, err = %v", len(nodes), err)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	n := checkRuntime(t, -1)
+	root := NewNode(0) // build a chain of 10 nodes
+	leaf := root
+	for i := 1; i < 10; i++ {
+		ch := NewNode(i)
+		leaf.AddChild(ch)
+		leaf = ch
+	}
+	nodes, err := NewWalker(root).MaxDepth(9).AllDescendents().Promise()()
+	if err != nil || len(nodes) != 9 {
+		t.Errorf("expected walk within depth limit to find 9 nodes, have %d, err = %v", len(nodes), err)
+	}
+	noop := func(n *Node[int], parent *Node[int], position int) (*Node[int], error) {
+		return n, nil
+	}
+	isNone := func(test *Node[int], node *Node[int]) (*Node[int], error) {
+		return nil, nil
+	}
+	promises := map[string]func() ([]*Node[int], error){
+		"DescendentsWith": NewWalker(root).MaxDepth(3).AllDescendents().Promise(),
+		"TopDown":         NewWalker(root).MaxDepth(3).TopDown(noop).Promise(),
+		"TopDownDF":       NewWalker(root).MaxDepth(3).TopDownDF(noop).Promise(),
+		"TopDownVisit": NewWalker(root).MaxDepth(3).TopDownVisit(
+			func(n *Node[int], ctx *VisitContext[int]) (*Node[int], error) {
+				return n, nil
+			}).Promise(),
+		"AncestorWith": NewWalker(leaf).MaxDepth(3).AncestorWith(isNone).Promise(),
+	}
+	for stage, promise := range promises {
+		_, err = promise()
+		var derr *MaxDepthError
+		if !errors.As(err, &derr) || derr.MaxDepth != 3 || derr.Stage != stage {
+			t.Errorf("expected %s to exceed depth limit, err = %v", stage, err)
+		}
+	}
+	if _, err = NewWalker(root).MaxDepth(3).FirstMatch(isNone)(); err == nil {
+		t.Errorf("expected FirstMatch to exceed depth limit")
+	}
+	late := NewWalker(root).AllDescendents().MaxDepth(3)
+	if _, err = late.Promise()(); err != ErrAlreadyProcessing {
+		t.Errorf("expected late depth limit to be reported, err = %v", err)
+	}
+	checkRuntime(t, n)
+}
+
+func TestChildSlotPolicy(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	checkRuntime(t, -1)
+	root, a, b := NewNode(0), NewNode(1), NewNode(2)
+	root.SetChildAt(2, a).AddChild(b) // sparse: slots 0 and 1 stay empty
+	if root.ChildCount() != 4 || root.IndexOfChild(b) != 3 {
+		t.Errorf("expected b at position 3 of 4, is at %d of %d", root.IndexOfChild(b), root.ChildCount())
+	}
+	if slots := root.ChildSlots(); len(slots) != 2 || slots[0].Index != 2 || slots[0].Node != a {
+		t.Errorf("expected slots to carry positions of children, have %v", slots)
+	}
+	a.AddChild(NewNode(3))
+	_, err := NewWalker(root).DescendentsWith(NodeIsLeaf[int]()).BottomUp(CalcRank[int]).Promise()()
+	if err != nil || root.Rank != 4 {
+		t.Errorf("expected bottom-up walk to skip empty slots, root rank = %d, err = %v", root.Rank, err)
+	}
+	a.Isolate()
+	if root.ChildCount() != 4 || root.IndexOfChild(b) != 3 {
+		t.Errorf("expected positions of sparse children to be stable")
+	}
+	// switching to compact child lists removes empty slots
+	root.SetChildSlotPolicy(CompactChildren)
+	if root.ChildCount() != 1 || root.IndexOfChild(b) != 0 {
+		t.Errorf("expected compacted children, b at %d of %d", root.IndexOfChild(b), root.ChildCount())
+	}
+	c := NewNode(4).AddChild(NewNode(5))
+	root.SetChildAt(7, c).InsertChildAt(0, a)
+	if root.ChildCount() != 3 || root.IndexOfChild(c) != 2 {
+		t.Errorf("expected c to be appended, is at %d of %d", root.IndexOfChild(c), root.ChildCount())
+	}
+	if c.ChildSlotPolicy() != CompactChildren || a.ChildSlotPolicy() != CompactChildren {
+		t.Errorf("expected inserted nodes to adopt the policy of the tree")
+	}
+	a.Isolate()
+	if root.ChildCount() != 2 || root.IndexOfChild(c) != 1 {
+		t.Errorf("expected compact children to shift, c is at %d of %d", root.IndexOfChild(c), root.ChildCount())
+	}
+	zipped := Zip(root, NewNode(0).AddChild(NewNode(4)), nil)
+	if len(zipped) != 4 || zipped[1].Op != ZipDeletion || zipped[1].Position != 0 {
+		t.Errorf("expected deletion of b at position 0, have %v", zipped)
+	}
+}
+
+func TestChildrenVersion(t *testing.T) {
+	root, a, b := NewNode(0), NewNode(1), NewNode(2)
+	if root.ChildrenVersion() != 0 {
+		t.Errorf("expected node without children to be at version 0")
+	}
+	versions := []uint64{root.ChildrenVersion()}
+	root.AddChild(a)
+	versions = append(versions, root.ChildrenVersion())
+	root.InsertChildAt(0, b)
+	versions = append(versions, root.ChildrenVersion())
+	root.SetChildAt(1, NewNode(3))
+	versions = append(versions, root.ChildrenVersion())
+	b.Isolate()
+	versions = append(versions, root.ChildrenVersion())
+	for i := 1; i < len(versions); i++ {
+		if versions[i] == versions[i-1] {
+			t.Errorf("expected modification #%d to change the version of the children", i)
+		}
+	}
+	if root.Payload = 5; root.ChildrenVersion() != versions[len(versions)-1] {
+		t.Errorf("expected version of children to be independent of the payload")
+	}
+}
+
+func TestPipelineBackpressure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping stress test in short mode")
+	}
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	n0 := checkRuntime(t, -1)
+	const size = 1000000
+	root := buildBenchTree(size, 1000) // pathological fan-out
+	var visited, maxGoroutines int64
+	sample := func(n *Node[int], parent *Node[int], position int) (*Node[int], error) {
+		if atomic.AddInt64(&visited, 1)%1024 == 0 {
+			if g := int64(runtime.NumGoroutine()); g > atomic.LoadInt64(&maxGoroutines) {
+				atomic.StoreInt64(&maxGoroutines, g)
+			}
+		}
+		if n.Payload%1000 == 0 {
+			return n, nil
+		}
+		return nil, nil
+	}
+	even := func(n, _ *Node[int]) (*Node[int], error) {
+		if n.Payload%2000 == 0 {
+			return n, nil
+		}
+		return nil, nil
+	}
+	nodes, err := NewWalker(root).BufferSizes(1, 1).TopDown(sample).Filter(even).Promise()()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visited != size || len(nodes) != size/2000 {
+		t.Errorf("expected %d nodes visited and %d results, have %d and %d", size, size/2000, visited, len(nodes))
+	}
+	if maxGoroutines > int64(n0+4*maxWorkerCount) {
+		t.Errorf("expected number of goroutines to be bounded, have %d (%d before walk)", maxGoroutines, n0)
+	}
+	t.Logf("at most %d goroutines alive during walk", maxGoroutines)
+}
+
+func TestBufferQueueCapacity(t *testing.T) {
+	q := newBufferQueue[int](2)
+	q.workers = 2
+	q.push(nodePackage[int]{serial: 1})
+	q.push(nodePackage[int]{serial: 2})
+	pushed := make(chan struct{})
+	go func() {
+		q.push(nodePackage[int]{serial: 3}) // queue is full => blocks
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatalf("expected push to block on a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.push(nodePackage[int]{serial: 4}) // the other worker is blocked => must not block
+	if q.length() != 3 {
+		t.Errorf("expected queue to grow beyond capacity for the last worker, length is %d", q.length())
+	}
+	for _, serial := range []uint32{1, 2} { // make room below capacity
+		if pkg, ok := q.pop(); !ok || pkg.serial != serial {
+			t.Fatalf("expected to pop package #%d, have %v", serial, pkg)
+		}
+	}
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected blocked push to proceed after pop")
+	}
+	for _, serial := range []uint32{4, 3} {
+		if pkg, ok := q.pop(); !ok || pkg.serial != serial {
+			t.Errorf("expected to pop package #%d, have %v", serial, pkg)
+		}
+	}
+}
+
+func TestSetupErrors(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	n := checkRuntime(t, -1)
+	root, a := NewNode(0), NewNode(1)
+	root.AddChild(a)
+	if _, err := NewWalker(root).DescendentsWith(nil).Promise()(); err != ErrInvalidFilter || !errors.Is(err, ErrSetup) {
+		t.Errorf("expected invalid filter to be reported as setup error, err = %v", err)
+	}
+	if _, err := NewWalker(root).AllDescendents().Filter(nil).Promise()(); !errors.Is(err, ErrSetup) {
+		t.Errorf("expected nil filter to poison the walk, err = %v", err)
+	}
+	if _, err := NewWalker(root).FirstMatch(nil)(); err != ErrInvalidFilter {
+		t.Errorf("expected nil predicate for FirstMatch to be reported, err = %v", err)
+	}
+	w := NewWalker(root).AllDescendents()
+	if nodes, err := w.Promise()(); err != nil || len(nodes) != 1 {
+		t.Fatalf("expected walk to find 1 node, have %d, err = %v", len(nodes), err)
+	}
+	if late := w.Parent(); late == nil {
+		t.Errorf("expected late filter to continue the expression chain")
+	} else if _, err := late.Promise()(); err != ErrNoMoreFiltersAccepted {
+		t.Errorf("expected late filter to be refused, err = %v", err)
+	}
+	errFailed := errors.New("failed")
+	failing := func(test, node *Node[int]) (*Node[int], error) {
+		return nil, errFailed
+	}
+	if _, err := NewWalker(root).DescendentsWith(failing).Promise()(); err != errFailed || errors.Is(err, ErrSetup) {
+		t.Errorf("expected predicate error to be reported as traversal error, err = %v", err)
+	}
+	checkRuntime(t, n)
+}
+
+func TestStream(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	n := checkRuntime(t, -1)
+	nodes := make([]*Node[int], 7) // tree of TestTopDownDF, payloads in pre-order
+	for i := range nodes {
+		nodes[i] = NewNode(i)
+	}
+	nodes[0].AddChild(nodes[1]).AddChild(nodes[4])
+	nodes[1].AddChild(nodes[2]).AddChild(nodes[3])
+	nodes[4].AddChild(nodes[5])
+	nodes[5].AddChild(nodes[6])
+	identity := func(n *Node[int], parent *Node[int], position int) (*Node[int], error) {
+		return n, nil
+	}
+	results, errs := NewWalker(nodes[0]).TopDownDF(identity).Filter(
+		func(n, _ *Node[int]) (*Node[int], error) {
+			if n.Payload == 3 {
+				return nil, nil // leaves a gap in the serials
+			}
+			return n, nil
+		}).Stream()
+	var payloads []int
+	for r := range results {
+		payloads = append(payloads, r.Payload)
+	}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+	if fmt.Sprint(payloads) != "[0 1 2 4 5 6]" {
+		t.Errorf("expected streamed results in pre-order, are %v", payloads)
+	}
+	delivered := make(chan struct{}) // closed as soon as node 4 has been streamed
+	stalled := false
+	waiting := func(n *Node[int], parent *Node[int], position int) (*Node[int], error) {
+		if n.Payload == 6 { // hold back the walk until node 4 has been delivered
+			select {
+			case <-delivered:
+			case <-time.After(5 * time.Second):
+				stalled = true
+			}
+		}
+		return n, nil
+	}
+	results, errs = NewWalker(nodes[0]).TopDownDF(waiting).Filter(
+		func(n, _ *Node[int]) (*Node[int], error) {
+			if n.Payload == 3 {
+				return nil, nil
+			}
+			return n, nil
+		}).Stream()
+	payloads = payloads[:0]
+	for r := range results {
+		payloads = append(payloads, r.Payload)
+		if r.Payload == 4 {
+			close(delivered)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+	if stalled || fmt.Sprint(payloads) != "[0 1 2 4 5 6]" {
+		t.Errorf("expected results after a dropped one to be streamed during the walk, are %v", payloads)
+	}
+	NewWalker(nodes[0]).DescendentsWith(NodeIsLeaf[int]()).BottomUp(CalcRank[int]).Promise()()
+	first := make(chan struct{}) // closed as soon as the first result has been streamed
+	stalled = false
+	results, errs = NewWalker(nodes[0]).DescendentsWith( // no order defined, despite ranks
+		func(n, _ *Node[int]) (*Node[int], error) {
+			if n.Payload == 6 { // hold back the walk until a result has been delivered
+				select {
+				case <-first:
+				case <-time.After(5 * time.Second):
+					stalled = true
+				}
+			}
+			return n, nil
+		}).Stream()
+	count := 0
+	for range results {
+		if count++; count == 1 {
+			close(first)
+		}
+	}
+	if err := <-errs; err != nil || count != 6 || stalled {
+		t.Errorf("expected 6 descendents to be streamed during the walk, have %d, err = %v", count, err)
+	}
+	results, errs = NewWalker(nodes[0]).Filter(nil).Stream()
+	if _, ok := <-results; ok {
+		t.Errorf("expected no results for malformed walker")
+	}
+	if err := <-errs; !errors.Is(err, ErrSetup) {
+		t.Errorf("expected setup error, have %v", err)
+	}
+	var w *Walker[int, int]
+	results, errs = w.Stream()
+	if _, ok := <-results; ok || <-errs != ErrEmptyTree {
+		t.Errorf("expected nil walker to stream ErrEmptyTree")
+	}
+	checkRuntime(t, n)
+}
+
+func TestValidate(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	tracer().SetTraceLevel(tracing.LevelError)
+	//
+	// (0 (1 2 _ 3) (4))
+	root, n1, n2, n4 := NewNode(0), NewNode(1), NewNode(2), NewNode(4)
+	n1.AddChild(n2).SetChildAt(2, NewNode(3))
+	root.AddChild(n1).AddChild(n4)
+	if r := Validate(root); !r.OK() || r.Nodes != 5 {
+		t.Fatalf("expected tree without ranks to be valid, is: %s", r)
+	}
+	_, err := NewWalker(root).DescendentsWith(NodeIsLeaf[int]()).BottomUp(CalcRank[int]).Promise()()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := Validate(root); !r.OK() {
+		t.Fatalf("expected tree with ranks to be valid, is: %s", r)
+	}
+	//
+	n4.Rank = 2
+	n2.parent = root
+	n4.policy = uint32(CompactChildren)
+	r := Validate(root)
+	kinds := map[ViolationKind]int{}
+	for _, v := range r.Violations {
+		kinds[v.Kind]++
+	}
+	if len(r.Violations) != 3 || kinds[InconsistentRank] != 1 || kinds[BrokenParentLink] != 1 ||
+		kinds[SlotPolicyMismatch] != 1 {
+		t.Errorf("expected broken link, slot policy mismatch and inconsistent rank, have: %s", r)
+	}
+	n4.Rank, n2.parent, n4.policy = 1, n1, uint32(root.ChildSlotPolicy())
+	n4.ensureKids().slice = append(n4.kids().slice, n2, root)
+	r = Validate(root)
+	if len(r.Violations) != 4 || r.Violations[1].Kind != DuplicateNode || r.Violations[3].Kind != Cycle {
+		t.Errorf("expected duplicate node and cycle to be detected, have: %s", r)
+	}
+}
+
+func TestRunSequential(t *testing.T) {
+	teardown := gotestingadapter.QuickConfig(t, "tyse.frame.tree")
+	defer teardown()
+	//
+	// Build a tree:
+	//                 (1)
+	//          (2)-----+-----(3)
+	//    (4)----+----(5)      +----(6)
+	//
+	root, n2, n3, n4, n5, n6 := NewNode(1), NewNode(2), NewNode(3), NewNode(4), NewNode(5), NewNode(6)
+	root.AddChild(n2).AddChild(n3)
+	n2.AddChild(n4).AddChild(n5)
+	n3.AddChild(n6)
+	var visited []int
+	record := func(n *Node[int], parent *Node[int], position int) (*Node[int], error) {
+		visited = append(visited, n.Payload)
+		return n, nil
+	}
+	nodes, err := NewWalker(root).RunSequential().TopDown(record).Promise()()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(visited) != "[1 2 3 4 5 6]" || len(nodes) != 6 || nodes[5] != n6 {
+		t.Errorf("expected breadth first visitation order [1 2 3 4 5 6], have %v", visited)
+	}
+	visited = nil
+	_, err = NewWalker(root).RunSequential().DescendentsWith(NodeIsLeaf[int]()).BottomUp(record).Promise()()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(visited) != "[4 5 2 6 3 1]" {
+		t.Errorf("expected bottom up visitation order [4 5 2 6 3 1], have %v", visited)
+	}
+	match, err := NewWalker(root).RunSequential().FirstMatch(func(n, _ *Node[int]) (*Node[int], error) {
+		if n.Payload%2 == 1 && n.Payload > 1 {
+			return n, nil
+		}
+		return nil, nil
+	})()
+	if err != nil || match != n3 {
+		t.Errorf("expected first match to be node 3, is %v", match)
+	}
+	// TopDown starts a concurrent walk before RunSequential fails, thus the
+	// action must be safe for concurrent use. The promise waits for the walk.
+	var mx sync.Mutex
+	calls := 0
+	count := func(n *Node[int], parent *Node[int], position int) (*Node[int], error) {
+		mx.Lock()
+		defer mx.Unlock()
+		calls++
+		return n, nil
+	}
+	_, err = NewWalker(root).TopDown(count).RunSequential().Promise()()
+	if !errors.Is(err, ErrAlreadyProcessing) {
+		t.Errorf("expected RunSequential after filters to fail, error is %v", err)
+	}
+}
+
 // ----------------------------------------------------------------------
 
+type attrPayload struct {
+	sync.Mutex
+	attrs map[string]string
+}
+
+func (p *attrPayload) Attribute(key string) (string, bool) {
+	p.Lock()
+	defer p.Unlock()
+	v, ok := p.attrs[key]
+	return v, ok
+}
+
+func (p *attrPayload) SetAttribute(key, value string) {
+	p.Lock()
+	defer p.Unlock()
+	p.attrs[key] = value
+}
+
 // Helper to check if result nodes are the expected ones.
 func checkNodes[T comparable](nodes []*Node[int], vals ...int) bool {
 	var found bool
@@ -0,0 +1,154 @@
+package tree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --- Validation of tree invariants ------------------------------------
+
+// ViolationKind classifies violations of tree invariants found by Validate.
+type ViolationKind uint8
+
+// Kinds of violations of tree invariants.
+const (
+	BrokenParentLink   ViolationKind = iota // child does not link back to its parent
+	Cycle                                   // node is its own ancestor
+	DuplicateNode                           // node is reachable on more than one path
+	InconsistentRank                        // rank differs from the size of the subtree
+	SlotPolicyMismatch                      // list of children does not follow the slot policy
+	PendingCowTag                           // transient tag left over (persistent trees only)
+)
+
+func (k ViolationKind) String() string {
+	switch k {
+	case BrokenParentLink:
+		return "broken parent link"
+	case Cycle:
+		return "cycle"
+	case DuplicateNode:
+		return "duplicate node"
+	case InconsistentRank:
+		return "inconsistent rank"
+	case SlotPolicyMismatch:
+		return "slot policy mismatch"
+	case PendingCowTag:
+		return "pending cow tag"
+	}
+	return "unknown violation"
+}
+
+// Violation is a violation of a tree invariant at a node. N is the type of
+// node references, which allows sharing violations with persistent trees
+// (package fp/persistent/tree).
+type Violation[N any] struct {
+	Kind    ViolationKind
+	Node    N      // node violating the invariant
+	Message string // details, suitable for debugging
+}
+
+// ValidationReport is the result of validating a tree.
+type ValidationReport[N any] struct {
+	Nodes      int            // number of nodes checked
+	Violations []Violation[N] // violations found, in document order
+}
+
+// OK is a predicate wether a tree is free of violations.
+func (r ValidationReport[N]) OK() bool {
+	return len(r.Violations) == 0
+}
+
+// String lists the violations of a report, suitable for test output.
+func (r ValidationReport[N]) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d nodes checked, %d violations", r.Nodes, len(r.Violations))
+	for _, v := range r.Violations {
+		fmt.Fprintf(&b, "\n  %s at %v: %s", v.Kind, v.Node, v.Message)
+	}
+	return b.String()
+}
+
+// Add appends a violation of a given kind at node to the report. msg and args
+// are formatted as with fmt.Sprintf.
+func (r *ValidationReport[N]) Add(kind ViolationKind, node N, msg string, args ...interface{}) {
+	r.Violations = append(r.Violations, Violation[N]{
+		Kind:    kind,
+		Node:    node,
+		Message: fmt.Sprintf(msg, args...),
+	})
+}
+
+// Validate checks the invariants of the tree rooted at root:
+//
+//     - every child links back to its parent
+//     - no node is its own ancestor, and no node is reachable on more than one path
+//     - if root carries a rank (see CalcRank), the rank of every node is the
+//       number of nodes of its subtree
+//     - lists of children follow the child slot policy of the tree, i.e. all
+//       nodes share the policy and compact lists of children have no empty slots
+//
+// Trees are modified concurrently by walkers, and corruption tends to show up
+// far away from its cause. Validate is intended to catch corruption early, e.g.
+// in tests. root may be a subtree of a larger tree; its parent link is not
+// checked. Validate should not be called concurrently with modifications of
+// the tree.
+func Validate[T comparable](root *Node[T]) ValidationReport[*Node[T]] {
+	var report ValidationReport[*Node[T]]
+	if root == nil {
+		return report
+	}
+	v := validator[T]{
+		report:  &report,
+		visited: make(map[*Node[T]]bool),
+		onPath:  make(map[*Node[T]]bool),
+		ranked:  root.Rank > 0,
+		policy:  root.ChildSlotPolicy(),
+	}
+	v.validate(root)
+	return report
+}
+
+type validator[T comparable] struct {
+	report  *ValidationReport[*Node[T]]
+	visited map[*Node[T]]bool // nodes checked so far
+	onPath  map[*Node[T]]bool // ancestors of the current node
+	ranked  bool              // check ranks
+	policy  ChildSlotPolicy   // policy of the root
+}
+
+// validate checks node and its subtree, returning the number of nodes of the
+// subtree.
+func (v validator[T]) validate(node *Node[T]) uint32 {
+	v.visited[node] = true
+	v.onPath[node] = true
+	defer delete(v.onPath, node)
+	v.report.Nodes++
+	if policy := node.ChildSlotPolicy(); policy != v.policy {
+		v.report.Add(SlotPolicyMismatch, node, "policy %d differs from policy %d of the root", policy, v.policy)
+	}
+	size := uint32(1)
+	for i, ch := range node.Children(false) {
+		if ch == nil {
+			if v.policy == CompactChildren {
+				v.report.Add(SlotPolicyMismatch, node, "empty slot %d in compact list of children", i)
+			}
+			continue
+		}
+		if ch.parent != node {
+			v.report.Add(BrokenParentLink, ch, "child #%d of %v links to parent %v", i, node, ch.parent)
+		}
+		if v.onPath[ch] {
+			v.report.Add(Cycle, ch, "child #%d of %v is its ancestor", i, node)
+			continue
+		}
+		if v.visited[ch] {
+			v.report.Add(DuplicateNode, ch, "child #%d of %v has been visited before", i, node)
+			continue
+		}
+		size += v.validate(ch)
+	}
+	if v.ranked && node.Rank != size {
+		v.report.Add(InconsistentRank, node, "rank is %d, subtree has %d nodes", node.Rank, size)
+	}
+	return size
+}
@@ -0,0 +1,130 @@
+package tree
+
+// ZipOp is the kind of an entry reported by Zip.
+type ZipOp uint8
+
+// Kinds of entries reported by Zip.
+const (
+	ZipPair      ZipOp = iota // nodes from both trees match
+	ZipInsertion              // node is present in tree b only
+	ZipDeletion               // node is present in tree a only
+)
+
+func (op ZipOp) String() string {
+	switch op {
+	case ZipPair:
+		return "pair"
+	case ZipInsertion:
+		return "insertion"
+	case ZipDeletion:
+		return "deletion"
+	}
+	return "?"
+}
+
+// Zipped is an entry reported by Zip. For pairs, both A and B are set. For
+// insertions, only B is set, for deletions only A. Position is the index of
+// the node within the children of its parent (B's parent for insertions,
+// A's parent otherwise), as returned by IndexOfChild; it is 0 for the roots.
+type Zipped[T comparable] struct {
+	Op       ZipOp
+	A, B     *Node[T]
+	Position int
+}
+
+// Zip walks two trees in lockstep, starting at roots a and b, and reports
+// pairs of matching nodes as well as nodes which have been inserted into b or
+// deleted from a. Entries are reported in depth-first order of the trees.
+//
+// The children of matching nodes are aligned using a longest common subsequence,
+// i.e., the smallest set of insertions and deletions is reported. Children of
+// inserted or deleted nodes are not reported separately: an insertion or
+// deletion always concerns the complete subtree.
+//
+// If match is nil, nodes match if their payloads are equal. Either a or b may
+// be nil, resulting in all of the other tree being reported as inserted or
+// deleted.
+//
+// Zip operates synchronously and does not lock the trees. Clients must not
+// modify either tree while Zip is running.
+func Zip[T comparable](a, b *Node[T], match func(a, b *Node[T]) bool) []Zipped[T] {
+	if match == nil {
+		match = func(a, b *Node[T]) bool {
+			return a.Payload == b.Payload
+		}
+	}
+	var zipped []Zipped[T]
+	switch {
+	case a == nil && b == nil:
+		return nil
+	case a == nil:
+		return append(zipped, Zipped[T]{Op: ZipInsertion, B: b})
+	case b == nil:
+		return append(zipped, Zipped[T]{Op: ZipDeletion, A: a})
+	case !match(a, b):
+		return append(zipped,
+			Zipped[T]{Op: ZipDeletion, A: a},
+			Zipped[T]{Op: ZipInsertion, B: b})
+	}
+	return zipChildren(a, b, 0, match, zipped)
+}
+
+// zipChildren reports a pair of matching nodes, then aligns their children
+// and recurses into children pairs.
+func zipChildren[T comparable](a, b *Node[T], position int, match func(a, b *Node[T]) bool,
+	zipped []Zipped[T]) []Zipped[T] {
+	//
+	zipped = append(zipped, Zipped[T]{Op: ZipPair, A: a, B: b, Position: position})
+	aslots, bslots := a.ChildSlots(), b.ChildSlots()
+	if len(aslots) == 0 && len(bslots) == 0 {
+		return zipped
+	}
+	achs, bchs := slotNodes(aslots), slotNodes(bslots)
+	lcs := lcsTable(achs, bchs, match)
+	i, j := 0, 0
+	for i < len(achs) || j < len(bchs) {
+		switch {
+		case i < len(achs) && j < len(bchs) && match(achs[i], bchs[j]) && lcs[i][j] == lcs[i+1][j+1]+1:
+			zipped = zipChildren(achs[i], bchs[j], aslots[i].Index, match, zipped)
+			i++
+			j++
+		case i < len(achs) && (j == len(bchs) || lcs[i+1][j] >= lcs[i][j+1]):
+			zipped = append(zipped, Zipped[T]{Op: ZipDeletion, A: achs[i], Position: aslots[i].Index})
+			i++
+		default:
+			zipped = append(zipped, Zipped[T]{Op: ZipInsertion, B: bchs[j], Position: bslots[j].Index})
+			j++
+		}
+	}
+	return zipped
+}
+
+// slotNodes returns the nodes of child slots.
+func slotNodes[T comparable](slots []ChildSlot[T]) []*Node[T] {
+	nodes := make([]*Node[T], len(slots))
+	for i, slot := range slots {
+		nodes[i] = slot.Node
+	}
+	return nodes
+}
+
+// lcsTable computes the lengths of longest common subsequences of suffixes of
+// as and bs: lcs[i][j] is the length for as[i:] and bs[j:].
+func lcsTable[T comparable](as, bs []*Node[T], match func(a, b *Node[T]) bool) [][]int {
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if match(as[i], bs[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs
+}